@@ -15,6 +15,7 @@ import (
 	"strings"
 	"time"
 
+	"cloud.google.com/go/errorreporting"
 	"cloud.google.com/go/profiler"
 	"contrib.go.opencensus.io/integrations/ocsql"
 	"github.com/go-redis/redis/v7"
@@ -24,6 +25,7 @@ import (
 	"golang.org/x/pkgsite/internal/database"
 	"golang.org/x/pkgsite/internal/dcensus"
 	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/fetch"
 	"golang.org/x/pkgsite/internal/frontend"
 	"golang.org/x/pkgsite/internal/log"
 	"golang.org/x/pkgsite/internal/middleware"
@@ -32,19 +34,28 @@ import (
 	"golang.org/x/pkgsite/internal/proxydatasource"
 	"golang.org/x/pkgsite/internal/queue"
 	"golang.org/x/pkgsite/internal/source"
+	"golang.org/x/pkgsite/internal/stdlib"
 )
 
 var (
-	queueName      = config.GetEnv("GO_DISCOVERY_FRONTEND_TASK_QUEUE", "")
-	workers        = flag.Int("workers", 10, "number of concurrent requests to the fetch service, when running locally")
-	_              = flag.String("static", "content/static", "path to folder containing static files served")
-	thirdPartyPath = flag.String("third_party", "third_party", "path to folder containing third-party libraries")
-	devMode        = flag.Bool("dev", false, "enable developer mode (reload templates on each page load, serve non-minified JS/CSS, etc.)")
-	proxyURL       = flag.String("proxy_url", "https://proxy.golang.org", "Uses the module proxy referred to by this URL "+
+	queueName = config.GetEnv("GO_DISCOVERY_FRONTEND_TASK_QUEUE", "")
+	// interactiveQueueName is the Cloud Tasks queue for the fetches that
+	// users request. If it is empty, they go to queueName.
+	interactiveQueueName = config.GetEnv("GO_DISCOVERY_FRONTEND_INTERACTIVE_TASK_QUEUE", "")
+	workers              = flag.Int("workers", 10, "number of concurrent requests to the fetch service, when running locally")
+	_                    = flag.String("static", "content/static", "path to folder containing static files served")
+	thirdPartyPath       = flag.String("third_party", "third_party", "path to folder containing third-party libraries")
+	devMode              = flag.Bool("dev", false, "enable developer mode (reload templates on each page load, serve non-minified JS/CSS, etc.)")
+	proxyURL             = flag.String("proxy_url", "https://proxy.golang.org", "Uses the module proxy referred to by this URL "+
 		"for direct proxy mode and frontend fetches")
 	directProxy = flag.Bool("direct_proxy", false, "if set to true, uses the module proxy referred to by this URL "+
 		"as a direct backend, bypassing the database")
 	bypassLicenseCheck = flag.Bool("bypass_license_check", false, "display all information, even for non-redistributable paths")
+	proxyCacheDir      = flag.String("proxy_cache_dir", "", "if set, cache the files of module versions from the proxy in this directory, "+
+		"which has the layout of $GOMODCACHE/cache/download")
+	proxyCacheMaxMB = flag.Int64("proxy_cache_max_mb", 10*1024, "maximum total size of the zips in the proxy cache, in megabytes")
+	localStdlib     = flag.Bool("stdlib", false, "if set, serve the standard library from the GOROOT reported by 'go env GOROOT', "+
+		"at the version of the Go that built this binary, instead of downloading it from the Go repo")
 )
 
 func main() {
@@ -72,6 +83,28 @@ func main() {
 	if err != nil {
 		log.Fatal(ctx, err)
 	}
+	if *proxyCacheDir != "" {
+		dc, err := proxy.NewDiskCache(*proxyCacheDir, *proxyCacheMaxMB*1024*1024)
+		if err != nil {
+			log.Fatal(ctx, err)
+		}
+		proxyClient.SetDiskCache(dc)
+	}
+	fetch.SetModuleLimits(cfg.MaxModuleZipSize, cfg.MaxModuleUncompressedSize, cfg.MaxModuleFiles)
+	fetch.SetPackageLimits(cfg.MaxModulePackages, cfg.TruncateModulePackages)
+	if err := fetch.SetChecksumDB(cfg.ChecksumDB, cfg.NoSumCheck); err != nil {
+		log.Fatal(ctx, err)
+	}
+	if *localStdlib {
+		goroot, err := stdlib.LocalGOROOT()
+		if err != nil {
+			log.Fatal(ctx, err)
+		}
+		if err := stdlib.UseGOROOT(goroot); err != nil {
+			log.Fatal(ctx, err)
+		}
+		log.Infof(ctx, "serving the standard library from %s", goroot)
+	}
 	if *bypassLicenseCheck {
 		log.Info(ctx, "BYPASSING LICENSE CHECKING: DISPLAYING NON-REDISTRIBUTABLE INFORMATION")
 	}
@@ -102,14 +135,18 @@ func main() {
 		} else {
 			db = postgres.New(ddb)
 		}
+		if err := db.SetSearchRanking(cfg.SearchRanking); err != nil {
+			log.Fatal(ctx, err)
+		}
 		defer db.Close()
 		dsg = func(context.Context) internal.DataSource { return db }
 		expg = func(context.Context) internal.ExperimentSource { return db }
 		sourceClient := source.NewClient(config.SourceTimeout)
+		sourceClient.SetPrivatePatterns(cfg.GoPrivate)
 		// queue.New uses the db argument only while it is constructing the queue.Queue.
 		// The closure passed to it is only used for testing and local execution, not in production.
 		// So it's okay that in neither case do we use a per-request connection.
-		fetchQueue, err = queue.New(ctx, cfg, queueName, *workers, db,
+		fetchQueue, err = queue.New(ctx, cfg, queueName, interactiveQueueName, *workers, db,
 			func(ctx context.Context, modulePath, version string) (int, error) {
 				return frontend.FetchAndUpdateState(ctx, modulePath, version, proxyClient, sourceClient, db)
 			})
@@ -117,22 +154,18 @@ func main() {
 			log.Fatalf(ctx, "queue.New: %v", err)
 		}
 	}
-	var haClient *redis.Client
-	if cfg.RedisHAHost != "" {
-		haClient = redis.NewClient(&redis.Options{
-			Addr: cfg.RedisHAHost + ":" + cfg.RedisHAPort,
-		})
-	}
 	server, err := frontend.NewServer(frontend.ServerConfig{
 		DataSourceGetter:     dsg,
 		Queue:                fetchQueue,
-		CompletionClient:     haClient,
 		TaskIDChangeInterval: config.TaskIDChangeIntervalFrontend,
 		StaticPath:           template.TrustedSourceFromFlag(flag.Lookup("static").Value),
 		ThirdPartyPath:       *thirdPartyPath,
 		DevMode:              *devMode,
 		AppVersionLabel:      cfg.AppVersionLabel(),
 		GoogleTagManagerID:   cfg.GoogleTagManagerID,
+		AutocompleteQuota:    cfg.AutocompleteQuota,
+		FetchQuota:           cfg.FetchQuota,
+		VanityImportsFile:    cfg.VanityImportsFile,
 	})
 	if err != nil {
 		log.Fatalf(ctx, "frontend.NewServer: %v", err)
@@ -155,6 +188,7 @@ func main() {
 		middleware.CacheResultCount,
 		middleware.CacheErrorCount,
 		middleware.CacheLatency,
+		middleware.CacheOutcomeCount,
 		middleware.QuotaResultCount,
 	)
 	if err := dcensus.Init(cfg, views...); err != nil {
@@ -181,13 +215,20 @@ func main() {
 	mw := middleware.Chain(
 		middleware.RequestLog(requestLogger),
 		middleware.AcceptRequests(http.MethodGet, http.MethodPost), // accept only GETs and POSTs
-		middleware.Quota(cfg.Quota),
+		middleware.Quota("frontend", cfg.Quota, cacheClient),
+		// Compress must come before caching, so that the cache holds
+		// uncompressed pages.
+		middleware.Compress(cfg.Compression),
 		middleware.GodocURL(),      // potentially redirects so should be early in chain
 		middleware.SecureHeaders(), // must come before any caching for nonces to work
-		middleware.LatestVersions(server.GetLatestMinorVersion, server.GetLatestMajorVersion), // must come before caching for version badge to work
-		middleware.Panic(panicHandler),
-		middleware.Timeout(54*time.Second),
-		middleware.Experiment(experimenter),
+		middleware.LatestVersions(server.GetLatestMinorVersion), // must come before caching for version badge to work
+		// Panic must come before Timeout, so that it recovers from panics
+		// in handlers that run out of time.
+		middleware.Panic(panicHandler, reportPanic(ctx, cfg)),
+		// Timeouts must come before caching, so that the cache can tell
+		// that a response was written after the request ran out of time.
+		middleware.Timeouts(frontend.RequestTimeout),
+		middleware.Experiment(experimenter, cfg.Quota.TrustedHops),
 	)
 	addr := cfg.HostAddr("localhost:8080")
 	log.Infof(ctx, "Listening on addr %s", addr)
@@ -228,6 +269,24 @@ func getLogger(ctx context.Context, cfg *config.Config) middleware.Logger {
 	return middleware.LocalLogger{}
 }
 
+// reportPanic returns the func that reports panics in handlers to Error
+// Reporting, or nil when not running on GCP.
+func reportPanic(ctx context.Context, cfg *config.Config) func(errorreporting.Entry) {
+	if !cfg.OnGCP() {
+		return nil
+	}
+	reporter, err := errorreporting.NewClient(ctx, cfg.ProjectID, errorreporting.Config{
+		ServiceName: cfg.ServiceID,
+		OnError: func(err error) {
+			log.Errorf(ctx, "Error reporting failed: %v", err)
+		},
+	})
+	if err != nil {
+		log.Fatal(ctx, err)
+	}
+	return reporter.Report
+}
+
 // Read a file of experiments used to initialize the local experiment source
 // for use in direct proxy mode.
 // Format of the file: each line is
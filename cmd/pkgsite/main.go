@@ -0,0 +1,92 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Pkgsite serves the documentation of the Go modules in local directories, as
+// pkg.go.dev would show it, without a database or network access.
+//
+// Usage:
+//
+//	go run ./cmd/pkgsite [flags] [dir ...]
+//
+// Each dir holds a module, or a go.work file that lists modules; the default
+// is the current directory. The replacements of the modules that are
+// directories are served as well, so that links between the modules work.
+// Run it from the root of the pkgsite repo, or set -static and -third_party.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/safehtml/template"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/dcensus"
+	"golang.org/x/pkgsite/internal/frontend"
+	"golang.org/x/pkgsite/internal/localdatasource"
+	"golang.org/x/pkgsite/internal/log"
+	"golang.org/x/pkgsite/internal/middleware"
+)
+
+var (
+	httpAddr           = flag.String("http", "localhost:8080", "address to serve on")
+	_                  = flag.String("static", "content/static", "path to folder containing static files served")
+	thirdPartyPath     = flag.String("third_party", "third_party", "path to folder containing third-party libraries")
+	devMode            = flag.Bool("dev", false, "enable developer mode (reload templates on each page load, serve non-minified JS/CSS, etc.)")
+	bypassLicenseCheck = flag.Bool("bypass_license_check", false, "display all information, even for non-redistributable paths")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [dir ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	ctx := context.Background()
+
+	var ds *localdatasource.DataSource
+	if *bypassLicenseCheck {
+		ds = localdatasource.NewBypassingLicenseCheck()
+	} else {
+		ds = localdatasource.New()
+	}
+	dirs := flag.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+	for _, dir := range dirs {
+		if err := ds.Load(ctx, dir); err != nil {
+			log.Fatal(ctx, err)
+		}
+	}
+
+	server, err := frontend.NewServer(frontend.ServerConfig{
+		DataSourceGetter: func(context.Context) internal.DataSource { return ds },
+		StaticPath:       template.TrustedSourceFromFlag(flag.Lookup("static").Value),
+		ThirdPartyPath:   *thirdPartyPath,
+		DevMode:          *devMode,
+	})
+	if err != nil {
+		log.Fatalf(ctx, "frontend.NewServer: %v", err)
+	}
+	router := dcensus.NewRouter(frontend.TagRoute)
+	server.Install(router.Handle, nil, nil)
+	experimenter, err := middleware.NewExperimenter(ctx, time.Minute, func(context.Context) internal.ExperimentSource {
+		return internal.NewLocalExperimentSource(nil)
+	})
+	if err != nil {
+		log.Fatal(ctx, err)
+	}
+	mw := middleware.Chain(
+		middleware.AcceptRequests(http.MethodGet, http.MethodPost),
+		middleware.SecureHeaders(),
+		middleware.LatestVersions(server.GetLatestMinorVersion),
+		middleware.Experiment(experimenter, 0),
+	)
+	log.Infof(ctx, "Listening on addr %s", *httpAddr)
+	log.Fatal(ctx, http.ListenAndServe(*httpAddr, mw(router)))
+}
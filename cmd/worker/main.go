@@ -10,10 +10,13 @@ import (
 	"bufio"
 	"context"
 	"flag"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/errorreporting"
@@ -24,9 +27,12 @@ import (
 	"golang.org/x/pkgsite/internal/config"
 	"golang.org/x/pkgsite/internal/database"
 	"golang.org/x/pkgsite/internal/dcensus"
+	"golang.org/x/pkgsite/internal/fetch"
 	"golang.org/x/pkgsite/internal/index"
 	"golang.org/x/pkgsite/internal/queue"
 	"golang.org/x/pkgsite/internal/source"
+	"golang.org/x/pkgsite/internal/stdlib"
+	"golang.org/x/pkgsite/internal/vuln"
 	"golang.org/x/pkgsite/internal/worker"
 
 	"golang.org/x/pkgsite/internal/log"
@@ -40,10 +46,19 @@ import (
 var (
 	timeout   = config.GetEnv("GO_DISCOVERY_WORKER_TIMEOUT_MINUTES", "10")
 	queueName = config.GetEnv("GO_DISCOVERY_WORKER_TASK_QUEUE", "")
-	workers   = flag.Int("workers", 10, "number of concurrent requests to the fetch service, when running locally")
+	// interactiveQueueName is the Cloud Tasks queue for fetches that users are
+	// waiting for. If it is empty, they go to queueName.
+	interactiveQueueName = config.GetEnv("GO_DISCOVERY_WORKER_INTERACTIVE_TASK_QUEUE", "")
+	workers              = flag.Int("workers", 10, "number of concurrent requests to the fetch service, when running locally")
 	// flag used in call to safehtml/template.TrustedSourceFromFlag
 	_                  = flag.String("static", "content/static", "path to folder containing static files served")
 	bypassLicenseCheck = flag.Bool("bypass_license_check", false, "insert all data into the DB, even for non-redistributable paths")
+	proxyCacheDir      = flag.String("proxy_cache_dir", "", "if set, cache the files of module versions from the proxy in this directory, "+
+		"which has the layout of $GOMODCACHE/cache/download")
+	proxyCacheMaxMB = flag.Int64("proxy_cache_max_mb", 10*1024, "maximum total size of the zips in the proxy cache, in megabytes")
+	// stdlibZipCache is where the zips of the standard library are cached:
+	// a gs://BUCKET/PREFIX URL or a directory. If it is empty, they are not.
+	stdlibZipCache = config.GetEnv("GO_DISCOVERY_STDLIB_ZIP_CACHE", "")
 )
 
 func main() {
@@ -83,6 +98,9 @@ func main() {
 		db = postgres.New(ddb)
 	}
 	defer db.Close()
+	if err := db.SetDocumentationCodec(cfg.DocumentationCodec); err != nil {
+		log.Fatal(ctx, err)
+	}
 
 	populateExcluded(ctx, db)
 
@@ -90,28 +108,73 @@ func main() {
 	if err != nil {
 		log.Fatal(ctx, err)
 	}
+	var vulnClient *vuln.Client
+	if cfg.VulnDBURL != "" {
+		vulnClient, err = vuln.New(cfg.VulnDBURL, cfg.VulnCacheDir)
+		if err != nil {
+			log.Fatal(ctx, err)
+		}
+	}
 	proxyClient, err := proxy.New(cfg.ProxyURL)
 	if err != nil {
 		log.Fatal(ctx, err)
 	}
-	sourceClient := source.NewClient(config.SourceTimeout)
-	fetchQueue, err := queue.New(ctx, cfg, queueName, *workers, db,
-		func(ctx context.Context, modulePath, version string) (int, error) {
-			return worker.FetchAndUpdateState(ctx, modulePath, version, proxyClient, sourceClient, db, cfg.AppVersionLabel())
-		})
+	if *proxyCacheDir != "" {
+		dc, err := proxy.NewDiskCache(*proxyCacheDir, *proxyCacheMaxMB*1024*1024)
+		if err != nil {
+			log.Fatal(ctx, err)
+		}
+		proxyClient.SetDiskCache(dc)
+	}
+	if stdlibZipCache != "" {
+		bs, err := stdlib.OpenBlobStore(ctx, stdlibZipCache)
+		if err != nil {
+			log.Fatal(ctx, err)
+		}
+		stdlib.SetZipCache(bs)
+	}
+	fetch.SetModuleLimits(cfg.MaxModuleZipSize, cfg.MaxModuleUncompressedSize, cfg.MaxModuleFiles)
+	fetch.SetPackageLimits(cfg.MaxModulePackages, cfg.TruncateModulePackages)
+	if err := fetch.SetChecksumDB(cfg.ChecksumDB, cfg.NoSumCheck); err != nil {
+		log.Fatal(ctx, err)
+	}
+	worker.SetModuleFetchLimit(cfg.MaxModuleFetches)
+	directRepos, err := fetch.ParseDirectRepos(cfg.DirectRepos)
+	if err != nil {
+		log.Fatal(ctx, err)
+	}
+	if err := fetch.SetDirectRepos(directRepos); err != nil {
+		log.Fatal(ctx, err)
+	}
+	redisCacheClient := getCacheRedis(ctx, cfg)
+	var sourceCache source.MetaCache
+	if redisCacheClient != nil {
+		sourceCache = source.NewRedisCache(redisCacheClient)
+	}
+	sourceClient := source.NewClientWithCache(config.SourceTimeout, sourceCache, cfg.SourceCacheTTL, cfg.SourceNegativeCacheTTL)
+	sourceClient.SetPrivatePatterns(cfg.GoPrivate)
+	processFunc := func(ctx context.Context, modulePath, version string) (int, error) {
+		return worker.FetchAndUpdateState(ctx, modulePath, version, proxyClient, sourceClient, db, cfg.AppVersionLabel())
+	}
+	var fetchQueue queue.Queue
+	if cfg.ProjectID == "" {
+		// Without a GCP project there are no Cloud Tasks, so process fetches
+		// in this process.
+		fetchQueue, err = queue.NewLocal(ctx, cfg, queueName, *workers, db, processFunc)
+	} else {
+		fetchQueue, err = queue.New(ctx, cfg, queueName, interactiveQueueName, *workers, db, processFunc)
+	}
 	if err != nil {
-		log.Fatalf(ctx, "queue.New: %v", err)
+		log.Fatalf(ctx, "creating queue: %v", err)
 	}
 
 	reportingClient := reportingClient(ctx, cfg)
-	redisHAClient := getHARedis(ctx, cfg)
-	redisCacheClient := getCacheRedis(ctx, cfg)
 	server, err := worker.NewServer(cfg, worker.ServerConfig{
 		DB:                   db,
 		IndexClient:          indexClient,
 		ProxyClient:          proxyClient,
 		SourceClient:         sourceClient,
-		RedisHAClient:        redisHAClient,
+		VulnClient:           vulnClient,
 		RedisCacheClient:     redisCacheClient,
 		Queue:                fetchQueue,
 		ReportingClient:      reportingClient,
@@ -124,7 +187,8 @@ func main() {
 	router := dcensus.NewRouter(nil)
 	server.Install(router.Handle)
 
-	views := append(dcensus.ServerViews, worker.EnqueueResponseCount)
+	views := append(dcensus.ServerViews, worker.EnqueueResponseCount, source.MetaCacheResultCount, fetch.PackageCacheResultCount,
+		queue.LocalQueueDepth, queue.LocalTaskLatency, worker.FetchPhaseLatencyDistribution, worker.FetchErrorCount)
 	if err := dcensus.Init(cfg, views...); err != nil {
 		log.Fatal(ctx, err)
 	}
@@ -151,20 +215,23 @@ func main() {
 	mw := middleware.Chain(
 		middleware.RequestLog(requestLogger),
 		middleware.Timeout(time.Duration(handlerTimeout)*time.Minute),
-		middleware.Experiment(experimenter),
+		middleware.Experiment(experimenter, cfg.Quota.TrustedHops),
 	)
 	http.Handle("/", mw(router))
 
 	addr := cfg.HostAddr("localhost:8000")
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(ctx, err)
+	}
+	// On SIGTERM, as when a new version is deployed, finish or release the
+	// fetches in progress before exiting.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
 	log.Infof(ctx, "Listening on addr %s", addr)
-	log.Fatal(ctx, http.ListenAndServe(addr, nil))
-}
-
-func getHARedis(ctx context.Context, cfg *config.Config) *redis.Client {
-	// We update completions with one big pipeline, so we need long write
-	// timeouts. ReadTimeout is increased only to be consistent with
-	// WriteTimeout.
-	return getRedis(ctx, cfg.RedisHAHost, cfg.RedisHAPort, 5*time.Minute, 5*time.Minute)
+	if err := worker.Serve(ctx, l, http.DefaultServeMux, db, cfg.WorkerDrainTimeout, stop); err != nil {
+		log.Fatal(ctx, err)
+	}
 }
 
 func getCacheRedis(ctx context.Context, cfg *config.Config) *redis.Client {
@@ -102,9 +102,15 @@ type Config struct {
 	// order to bypass checks by the cache.
 	AuthValues []string
 
-	// Discovery environment variables
+	// Discovery environment variables. ProxyURL may be a comma-separated list
+	// of module proxy URLs, which are tried in order; see proxy.New.
 	ProxyURL, IndexURL string
 
+	// VulnDBURL is the URL of the Go vulnerability database, and VulnCacheDir
+	// is the directory in which the worker caches its entries. If VulnDBURL is
+	// empty, the worker does not update vulnerabilities.
+	VulnDBURL, VulnCacheDir string
+
 	// Ports used for hosting. 'DebugPort' is used for serving HTTP debug pages.
 	Port, DebugPort string
 
@@ -143,15 +149,26 @@ type Config struct {
 	// Configuration for redis page cache.
 	RedisCacheHost, RedisCachePort string
 
-	// Configuration for redis autocompletion. This is different from the page
-	// cache instance as it has different availability requirements.
-	RedisHAHost, RedisHAPort string
-
 	// UseProfiler specifies whether to enable Stackdriver Profiler.
 	UseProfiler bool
 
 	Quota QuotaSettings
 
+	// SearchRanking holds the weights of the parts of the search score that
+	// are used when the search-freshness experiment is active.
+	SearchRanking SearchRankingSettings
+
+	// AutocompleteQuota limits requests to the frontend's /autocomplete
+	// endpoint, which is called as the user types, separately from Quota.
+	AutocompleteQuota QuotaSettings
+
+	// FetchQuota limits how often frontend fetch requests may enqueue module
+	// versions to be fetched.
+	FetchQuota FetchQuotaSettings
+
+	// Compression configures the compression of frontend responses.
+	Compression CompressionSettings
+
 	// Teeproxy sepcifies the configuration values for the teeproxy.
 	Teeproxy TeeproxySettings
 
@@ -159,6 +176,68 @@ type Config struct {
 	// Possible values are [debug, info, error, fatal].
 	// In case of invalid/empty value, all logs will be printed.
 	LogLevel string
+
+	// GoPrivate is a comma-separated list of glob patterns, in the format of
+	// the go command's GOPRIVATE, for module paths whose source should not be
+	// looked up over the network.
+	GoPrivate string
+
+	// DirectRepos is a comma-separated list of "root=url" pairs, naming the
+	// repositories whose modules the worker fetches directly with git rather
+	// than from the proxy; see fetch.ParseDirectRepos.
+	DirectRepos string
+
+	// ChecksumDB configures the checksum database that module zips are
+	// verified against, in the format of GOSUMDB, and NoSumCheck is a
+	// comma-separated list of glob patterns, in the format of GONOSUMDB, for
+	// module paths that are not verified; see fetch.SetChecksumDB.
+	ChecksumDB string
+	NoSumCheck string
+
+	// Limits on the modules that are fetched. Values that are not positive
+	// leave the defaults of package fetch unchanged; see fetch.SetModuleLimits.
+	MaxModuleZipSize, MaxModuleUncompressedSize int64
+	MaxModuleFiles                              int
+
+	// MaxModulePackages limits the number of packages processed for a
+	// module, if positive. If TruncateModulePackages is true, modules with
+	// more packages are processed partially rather than failing; see
+	// fetch.SetPackageLimits.
+	MaxModulePackages      int
+	TruncateModulePackages bool
+
+	// MaxModuleFetches limits the number of versions of a single module that
+	// the worker processes at once, if positive; see
+	// worker.SetModuleFetchLimit.
+	MaxModuleFetches int
+
+	// DocumentationCodec names the codec with which the worker compresses
+	// the documentation that it stores; see postgres.DB.SetDocumentationCodec.
+	DocumentationCodec string
+
+	// VanityImportsFile is the path of a YAML file describing the vanity
+	// import paths for which the frontend serves go-import meta tags. If it
+	// is empty, none are served.
+	VanityImportsFile string
+
+	// LocalQueue configures the queue that the worker processes fetches with
+	// when no GCP project is set; see queue.NewLocal.
+	LocalQueue LocalQueueSettings
+
+	// IndexPollOverlap is how far before the index cursor the worker starts
+	// reading the module index when it polls, so that module versions that
+	// the index publishes late with earlier timestamps are not missed.
+	IndexPollOverlap time.Duration
+
+	// WorkerDrainTimeout is how long the worker lets the fetches in progress
+	// finish when it shuts down, before it cancels and releases them.
+	WorkerDrainTimeout time.Duration
+
+	// SourceCacheTTL is how long the worker caches the go-import and
+	// go-source meta tags it fetches for a module path.
+	// SourceNegativeCacheTTL is how long it remembers that a module path has
+	// no meta tags, or that its host timed out.
+	SourceCacheTTL, SourceNegativeCacheTTL time.Duration
 }
 
 // AppVersionLabel returns the version label for the current instance.  This is
@@ -307,6 +386,78 @@ type QuotaSettings struct {
 	// AuthValues is the set of values that could be set on the AuthHeader, in
 	// order to bypass checks by the quota server.
 	AuthValues []string
+	// AllowedCIDRs is the set of networks, in CIDR notation, whose requests
+	// are never limited.
+	AllowedCIDRs []string
+	// TrustedHops is the number of addresses at the end of the
+	// X-Forwarded-For header that were added by proxies in front of the
+	// server, and can be trusted. The client is identified by the first of
+	// them. If it is zero, the whole header is trusted.
+	TrustedHops int
+}
+
+// FetchQuotaSettings holds the limits on the module versions that the
+// frontend enqueues to be fetched when users request them. Each limit is a
+// token bucket, refilled at the given number of requests per minute and
+// holding at most the given burst. A zero rate disables that limit.
+type FetchQuotaSettings struct {
+	// PerIPPerMinute and PerIPBurst limit the requests from each IP block, as
+	// in QuotaSettings.
+	PerIPPerMinute int
+	PerIPBurst     int
+	// GlobalPerMinute and GlobalBurst limit the requests from everyone.
+	GlobalPerMinute int
+	GlobalBurst     int
+	// MaxEntries is the maximum number of IP blocks to keep track of when the
+	// limits are held in memory.
+	MaxEntries int
+	// AuthValues is the set of values that could be set on the
+	// BypassQuotaAuthHeader, in order to bypass the limits.
+	AuthValues []string
+	// TrustedHops is the number of proxies in front of the server, which
+	// determines the address that identifies the client, as in
+	// QuotaSettings.
+	TrustedHops int
+}
+
+// CompressionSettings is config for internal/middleware/compress.go.
+type CompressionSettings struct {
+	// MinSize is the size in bytes below which responses are not compressed.
+	MinSize int
+	// GzipLevel is the compression level of gzip, from gzip.HuffmanOnly (-2)
+	// to gzip.BestCompression (9), or gzip.DefaultCompression (-1).
+	GzipLevel int
+	// BrotliLevel is the quality of brotli, from 0 to 11.
+	BrotliLevel int
+}
+
+// SearchRankingSettings holds the tunable weights of the search score. See
+// postgres.DB.SetSearchRanking.
+type SearchRankingSettings struct {
+	// FreshnessWeight controls how fast scores decay with the age of the
+	// latest version of a module: they are divided by
+	// 1 + FreshnessWeight*ln(1 + age in years). Zero disables the decay.
+	FreshnessWeight float64
+	// StalePseudoVersionPenalty multiplies the scores of packages whose
+	// latest version is a pseudo-version older than StalePseudoVersionAge.
+	// A zero StalePseudoVersionAge disables the penalty.
+	StalePseudoVersionPenalty float64
+	StalePseudoVersionAge     time.Duration
+}
+
+// LocalQueueSettings holds the configuration of a local queue. See
+// queue.NewLocal.
+type LocalQueueSettings struct {
+	// TaskTimeout is how long a task may take.
+	TaskTimeout time.Duration
+	// MaxRetries is the number of times a task that fails with an error that
+	// is retried is tried again, after RetryBackoff the first time, and twice
+	// as long each time after that.
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// Persist reports whether the pending tasks are stored in the database,
+	// so that they are resumed when the worker restarts.
+	Persist bool
 }
 
 // TeeproxySettings contains the configuration values for the teeproxy. See
@@ -360,14 +511,46 @@ func Init(ctx context.Context) (_ *Config, err error) {
 		DBSecret:             os.Getenv("GO_DISCOVERY_DATABASE_SECRET"),
 		RedisCacheHost:       os.Getenv("GO_DISCOVERY_REDIS_HOST"),
 		RedisCachePort:       GetEnv("GO_DISCOVERY_REDIS_PORT", "6379"),
-		RedisHAHost:          os.Getenv("GO_DISCOVERY_REDIS_HA_HOST"),
-		RedisHAPort:          GetEnv("GO_DISCOVERY_REDIS_HA_PORT", "6379"),
+		// The worker only reads the vulnerability database in the
+		// /update-vulns job, so it is safe to default to the public one.
+		VulnDBURL:    GetEnv("GO_DISCOVERY_VULN_DB", "https://vuln.go.dev"),
+		VulnCacheDir: os.Getenv("GO_DISCOVERY_VULN_CACHE_DIR"),
 		Quota: QuotaSettings{
-			QPS:        10,
-			Burst:      20,
-			MaxEntries: 1000,
-			RecordOnly: func() *bool { t := true; return &t }(),
-			AuthValues: parseCommaList(os.Getenv("GO_DISCOVERY_AUTH_VALUES")),
+			QPS:          GetEnvInt("GO_DISCOVERY_QUOTA_QPS", 10),
+			Burst:        GetEnvInt("GO_DISCOVERY_QUOTA_BURST", 20),
+			MaxEntries:   1000,
+			RecordOnly:   func() *bool { t := true; return &t }(),
+			AuthValues:   parseCommaList(os.Getenv("GO_DISCOVERY_AUTH_VALUES")),
+			AllowedCIDRs: parseCommaList(os.Getenv("GO_DISCOVERY_QUOTA_ALLOWED_CIDRS")),
+			TrustedHops:  GetEnvInt("GO_DISCOVERY_QUOTA_TRUSTED_HOPS", 0),
+		},
+		SearchRanking: SearchRankingSettings{
+			FreshnessWeight:           GetEnvFloat64("GO_DISCOVERY_SEARCH_FRESHNESS_WEIGHT", 0.25),
+			StalePseudoVersionPenalty: GetEnvFloat64("GO_DISCOVERY_SEARCH_STALE_PSEUDO_VERSION_PENALTY", 0.5),
+			StalePseudoVersionAge:     time.Duration(GetEnvInt("GO_DISCOVERY_SEARCH_STALE_PSEUDO_VERSION_AGE_DAYS", 730)) * 24 * time.Hour,
+		},
+		AutocompleteQuota: QuotaSettings{
+			QPS:          20,
+			Burst:        40,
+			MaxEntries:   1000,
+			RecordOnly:   func() *bool { f := false; return &f }(),
+			AuthValues:   parseCommaList(os.Getenv("GO_DISCOVERY_AUTH_VALUES")),
+			AllowedCIDRs: parseCommaList(os.Getenv("GO_DISCOVERY_QUOTA_ALLOWED_CIDRS")),
+			TrustedHops:  GetEnvInt("GO_DISCOVERY_QUOTA_TRUSTED_HOPS", 0),
+		},
+		FetchQuota: FetchQuotaSettings{
+			PerIPPerMinute:  GetEnvInt("GO_DISCOVERY_FETCH_QUOTA_PER_IP_PER_MINUTE", 6),
+			PerIPBurst:      GetEnvInt("GO_DISCOVERY_FETCH_QUOTA_PER_IP_BURST", 10),
+			GlobalPerMinute: GetEnvInt("GO_DISCOVERY_FETCH_QUOTA_GLOBAL_PER_MINUTE", 300),
+			GlobalBurst:     GetEnvInt("GO_DISCOVERY_FETCH_QUOTA_GLOBAL_BURST", 600),
+			MaxEntries:      1000,
+			AuthValues:      parseCommaList(os.Getenv("GO_DISCOVERY_AUTH_VALUES")),
+			TrustedHops:     GetEnvInt("GO_DISCOVERY_QUOTA_TRUSTED_HOPS", 0),
+		},
+		Compression: CompressionSettings{
+			MinSize:     GetEnvInt("GO_DISCOVERY_COMPRESSION_MIN_SIZE", 1024),
+			GzipLevel:   GetEnvInt("GO_DISCOVERY_GZIP_LEVEL", -1),
+			BrotliLevel: GetEnvInt("GO_DISCOVERY_BROTLI_LEVEL", 5),
 		},
 		UseProfiler: os.Getenv("GO_DISCOVERY_USE_PROFILER") == "TRUE",
 		Teeproxy: TeeproxySettings{
@@ -383,7 +566,31 @@ func Init(ctx context.Context) (_ *Config, err error) {
 			MaxTimeout:       time.Duration(GetEnvInt("GO_DISCOVERY_TEEPROXY_MAX_TIMEOUT_SECONDS", 240)) * time.Second,
 			SuccsToGreen:     GetEnvInt("GO_DISCOVERY_TEEPROXY_SUCCS_TO_GREEN", 20),
 		},
-		LogLevel: os.Getenv("GO_DISCOVERY_LOG_LEVEL"),
+		LogLevel:  os.Getenv("GO_DISCOVERY_LOG_LEVEL"),
+		GoPrivate: os.Getenv("GO_DISCOVERY_GOPRIVATE"),
+
+		DirectRepos: os.Getenv("GO_DISCOVERY_DIRECT_REPOS"),
+		ChecksumDB:  os.Getenv("GO_DISCOVERY_GOSUMDB"),
+		NoSumCheck:  os.Getenv("GO_DISCOVERY_GONOSUMCHECK"),
+
+		MaxModuleZipSize:          int64(GetEnvInt("GO_DISCOVERY_MAX_MODULE_ZIP_SIZE", 0)),
+		MaxModuleUncompressedSize: int64(GetEnvInt("GO_DISCOVERY_MAX_MODULE_UNCOMPRESSED_SIZE", 0)),
+		MaxModuleFiles:            GetEnvInt("GO_DISCOVERY_MAX_MODULE_FILES", 0),
+		MaxModulePackages:         GetEnvInt("GO_DISCOVERY_MAX_MODULE_PACKAGES", 0),
+		TruncateModulePackages:    os.Getenv("GO_DISCOVERY_TRUNCATE_MODULE_PACKAGES") == "true",
+		MaxModuleFetches:          GetEnvInt("GO_DISCOVERY_MAX_MODULE_FETCHES", 0),
+		DocumentationCodec:        os.Getenv("GO_DISCOVERY_DOCUMENTATION_CODEC"),
+		VanityImportsFile:         os.Getenv("GO_DISCOVERY_VANITY_IMPORTS_FILE"),
+		LocalQueue: LocalQueueSettings{
+			TaskTimeout:  time.Duration(GetEnvInt("GO_DISCOVERY_LOCAL_QUEUE_TASK_TIMEOUT_MINUTES", 5)) * time.Minute,
+			MaxRetries:   GetEnvInt("GO_DISCOVERY_LOCAL_QUEUE_MAX_RETRIES", 5),
+			RetryBackoff: time.Duration(GetEnvInt("GO_DISCOVERY_LOCAL_QUEUE_RETRY_BACKOFF_SECONDS", 30)) * time.Second,
+			Persist:      os.Getenv("GO_DISCOVERY_LOCAL_QUEUE_PERSIST") == "true",
+		},
+		IndexPollOverlap:       time.Duration(GetEnvInt("GO_DISCOVERY_INDEX_POLL_OVERLAP_SECONDS", 0)) * time.Second,
+		WorkerDrainTimeout:     time.Duration(GetEnvInt("GO_DISCOVERY_WORKER_DRAIN_TIMEOUT_SECONDS", 30)) * time.Second,
+		SourceCacheTTL:         time.Duration(GetEnvInt("GO_DISCOVERY_SOURCE_CACHE_TTL_MINUTES", 60)) * time.Minute,
+		SourceNegativeCacheTTL: time.Duration(GetEnvInt("GO_DISCOVERY_SOURCE_NEGATIVE_CACHE_TTL_MINUTES", 10)) * time.Minute,
 	}
 	if cfg.OnGCP() {
 		// Zone is not available in the environment but can be queried via the metadata API.
@@ -0,0 +1,121 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// CopyUpsert is like BulkUpsert, but it sends the values to Postgres with a
+// COPY statement, which takes a constant number of round trips regardless of
+// the number of rows. The rows are copied into a temporary table that has the
+// given columns of table, and then upserted into table from there, in the
+// order of conflictColumns to ensure consistent lock ordering.
+//
+// As with BulkUpsert, values must not contain two rows with the same values of
+// conflictColumns. Values of type []byte are copied as BYTEA, so convert
+// values for other types, like JSONB, to strings.
+//
+// CopyUpsert must be called in a transaction.
+func (db *DB) CopyUpsert(ctx context.Context, table string, columns []string, values []interface{}, conflictColumns []string) (err error) {
+	defer derrors.Wrap(&err, "DB.CopyUpsert(ctx, %q, %v, [%d values], %v)",
+		table, columns, len(values), conflictColumns)
+
+	return db.copyUpsert(ctx, table, columns, nil, values, conflictColumns, nil)
+}
+
+// CopyUpsertReturning is like CopyUpsert, but supports returning values from
+// the upsert, like BulkUpsertReturning.
+func (db *DB) CopyUpsertReturning(ctx context.Context, table string, columns []string, values []interface{}, conflictColumns, returningColumns []string, scanFunc func(*sql.Rows) error) (err error) {
+	defer derrors.Wrap(&err, "DB.CopyUpsertReturning(ctx, %q, %v, [%d values], %v, %v, scanFunc)",
+		table, columns, len(values), conflictColumns, returningColumns)
+
+	if returningColumns == nil || scanFunc == nil {
+		return errors.New("need returningColumns and scan function")
+	}
+	return db.copyUpsert(ctx, table, columns, returningColumns, values, conflictColumns, scanFunc)
+}
+
+func (db *DB) copyUpsert(ctx context.Context, table string, columns, returningColumns []string, values []interface{}, conflictColumns []string, scanFunc func(*sql.Rows) error) error {
+	if !db.InTransaction() {
+		return errors.New("not in a transaction")
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	tmp, err := db.copyToTempTable(ctx, table, columns, values)
+	if err != nil {
+		return err
+	}
+	cols := strings.Join(columns, ", ")
+	query := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s ORDER BY %s %s",
+		table, cols, cols, tmp, strings.Join(conflictColumns, ", "),
+		buildUpsertConflictAction(columns, conflictColumns))
+	if returningColumns == nil {
+		_, err = db.Exec(ctx, query)
+		return err
+	}
+	query += " RETURNING " + strings.Join(returningColumns, ", ")
+	return db.RunQuery(ctx, query, scanFunc)
+}
+
+// copyToTempTable creates a temporary table with the given columns of table,
+// copies values into it, and returns its name. The temporary table replaces
+// any earlier one for the same table, and is dropped at the end of the
+// transaction.
+func (db *DB) copyToTempTable(ctx context.Context, table string, columns []string, values []interface{}) (string, error) {
+	tmp := "copy_" + table
+	// Both statements are sent together, in a single round trip.
+	if _, err := db.Exec(ctx, fmt.Sprintf(`
+		DROP TABLE IF EXISTS %[1]s;
+		CREATE TEMPORARY TABLE %[1]s ON COMMIT DROP AS
+			SELECT %[2]s FROM %[3]s WITH NO DATA`,
+		tmp, strings.Join(columns, ", "), table)); err != nil {
+		return "", err
+	}
+	if err := db.CopyIn(ctx, tmp, columns, values); err != nil {
+		return "", err
+	}
+	return tmp, nil
+}
+
+// CopyIn inserts values into the columns of table with a COPY statement. Like
+// BulkInsert, it takes a single slice of interleaved values. Values are
+// interpreted as in CopyUpsert.
+//
+// CopyIn must be called in a transaction.
+func (db *DB) CopyIn(ctx context.Context, table string, columns []string, values []interface{}) (err error) {
+	defer derrors.Wrap(&err, "DB.CopyIn(ctx, %q, %v, [%d values])", table, columns, len(values))
+	defer logQuery(ctx, pq.CopyIn(table, columns...), nil, db.instanceID)(&err)
+
+	if !db.InTransaction() {
+		return errors.New("not in a transaction")
+	}
+	if remainder := len(values) % len(columns); remainder != 0 {
+		return fmt.Errorf("modulus of len(values) and len(columns) must be 0: got %d", remainder)
+	}
+	stmt, err := db.tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	// Each row is buffered and sent without waiting for a response.
+	for i := 0; i < len(values); i += len(columns) {
+		if _, err := stmt.ExecContext(ctx, values[i:i+len(columns)]...); err != nil {
+			return fmt.Errorf("copying values[%d:%d]: %w", i, i+len(columns), err)
+		}
+	}
+	// Executing the statement with no values ends the COPY, and returns any
+	// error from the rows.
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCopyUpsert(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout*3)
+	defer cancel()
+	if _, err := testDB.Exec(ctx, `
+		DROP TABLE IF EXISTS test_copy_upsert;
+		CREATE TABLE test_copy_upsert (c1 int PRIMARY KEY, c2 text, c3 bytea)`); err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.Exec(ctx, `DROP TABLE test_copy_upsert`)
+
+	for _, values := range [][]interface{}{
+		// First, insert some rows.
+		{2, "b\tx", []byte{0, 1}, 4, nil, nil},
+		// Then replace those rows while inserting others.
+		{1, "a", []byte("a"), 2, "b\ny", []byte{2}, 3, `c\`, nil, 4, "", []byte{}},
+	} {
+		var returned []int
+		err := testDB.Transact(ctx, sql.LevelDefault, func(tx *DB) error {
+			return tx.CopyUpsertReturning(ctx, "test_copy_upsert", []string{"c1", "c2", "c3"}, values,
+				[]string{"c1"}, []string{"c1"}, func(rows *sql.Rows) error {
+					var c1 int
+					if err := rows.Scan(&c1); err != nil {
+						return err
+					}
+					returned = append(returned, c1)
+					return nil
+				})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Ints(returned)
+		var want []int
+		for i := 0; i < len(values); i += 3 {
+			want = append(want, values[i].(int))
+		}
+		if !cmp.Equal(returned, want) {
+			t.Errorf("%v: returned %v, want %v", values, returned, want)
+		}
+
+		var got []interface{}
+		err = testDB.RunQuery(ctx, `SELECT c1, c2, c3 FROM test_copy_upsert ORDER BY c1`, func(rows *sql.Rows) error {
+			var (
+				c1 int
+				c2 sql.NullString
+				c3 []byte
+			)
+			if err := rows.Scan(&c1, &c2, &c3); err != nil {
+				return err
+			}
+			var v2, v3 interface{}
+			if c2.Valid {
+				v2 = c2.String
+			}
+			if c3 != nil {
+				v3 = c3
+			}
+			got = append(got, c1, v2, v3)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cmp.Equal(got, values) {
+			t.Errorf("got %v, want %v", got, values)
+		}
+	}
+}
+
+func TestCopyUpsertNotInTransaction(t *testing.T) {
+	err := testDB.CopyUpsert(context.Background(), "t", []string{"c"}, []interface{}{1}, []string{"c"})
+	if err == nil {
+		t.Error("got nil, want error")
+	}
+}
@@ -7,6 +7,7 @@ package internal
 import (
 	"context"
 
+	"golang.org/x/pkgsite/internal/complete"
 	"golang.org/x/pkgsite/internal/licenses"
 )
 
@@ -14,6 +15,8 @@ import (
 type DataSource interface {
 	// See the internal/postgres package for further documentation of these
 	// methods, particularly as they pertain to the main postgres implementation.
+	// Implementations that cannot support a method return an error wrapping
+	// derrors.Unsupported.
 
 	// GetLatestMajorVersion returns the latest major version of a series path.
 	GetLatestMajorVersion(ctx context.Context, seriesPath string) (_ string, err error)
@@ -25,6 +28,30 @@ type DataSource interface {
 	// GetUnit returns information about a directory, which may also be a module and/or package.
 	// The module and version must both be known.
 	GetUnit(ctx context.Context, pathInfo *UnitMeta, fields FieldSet) (_ *Unit, err error)
+	// GetModuleReadme returns the README of a module version, without
+	// loading the module's units.
+	GetModuleReadme(ctx context.Context, modulePath, version string) (*Readme, error)
+	// GetVersionsForPath returns the tagged versions of the modules that
+	// contain path, and their most recent pseudo-versions.
+	GetVersionsForPath(ctx context.Context, path string) ([]*ModuleInfo, error)
+	// GetImportedBy returns a page of the paths of the packages outside
+	// modulePath that import pkgPath, following cursor, and the cursor of
+	// the next page.
+	GetImportedBy(ctx context.Context, pkgPath, modulePath, cursor string, limit int) (paths []string, nextCursor string, err error)
+	// GetImportedByCount returns the number of packages that import pkgPath.
+	GetImportedByCount(ctx context.Context, pkgPath string) (int, error)
+	// Search returns the results of a search for q, from offset to
+	// offset+limit.
+	Search(ctx context.Context, q string, limit, offset int) ([]*SearchResult, error)
+	// SearchSymbols returns at most limit of the symbols that match sq,
+	// from the latest versions of their packages, best match first.
+	SearchSymbols(ctx context.Context, sq *SymbolQuery, limit int) ([]*SymbolSearchResult, error)
+	// GetStdlibPathsWithSuffix returns the paths of the packages in the
+	// latest version of the standard library that end in "/"+suffix.
+	GetStdlibPathsWithSuffix(ctx context.Context, suffix string) ([]string, error)
+	// GetPathCompletions returns at most limit packages whose paths begin
+	// with prefix, ignoring case, most imported first.
+	GetPathCompletions(ctx context.Context, prefix string, limit int) ([]*complete.Completion, error)
 
 	// TODO(golang/go#39629): Deprecate these methods.
 	//
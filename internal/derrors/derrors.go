@@ -26,12 +26,50 @@ var (
 	InvalidArgument = errors.New("invalid argument")
 	// BadModule indicates a problem with a module.
 	BadModule = errors.New("bad module")
+	// BadModuleZip indicates that the zip file of a module is malformed. It
+	// wraps BadModule.
+	BadModuleZip = fmt.Errorf("malformed zip: %w", BadModule)
+	// BadGoMod indicates that the go.mod file of a module has no module
+	// directive. It wraps BadModule.
+	BadGoMod = fmt.Errorf("go.mod has no module path: %w", BadModule)
+	// ModuleHasNoPackages indicates that a module contains no Go packages.
+	// It wraps BadModule.
+	ModuleHasNoPackages = fmt.Errorf("module has no packages: %w", BadModule)
 	// Excluded indicates that the module is excluded. (See internal/postgres/excluded.go.)
 	Excluded = errors.New("excluded")
+	// PseudoVersionDeleted indicates that a pseudo-version of a module was
+	// deleted from the database to save space, because it was not among the
+	// newest pseudo-versions of the module. It wraps NotFound.
+	PseudoVersionDeleted = fmt.Errorf("pseudo-version deleted: %w", NotFound)
 
 	// AlternativeModule indicates that the path of the module zip file differs
 	// from the path specified in the go.mod file.
 	AlternativeModule = errors.New("alternative module")
+	// ModulePathCasing indicates that the path of the module zip file differs
+	// from the path specified in the go.mod file only in case, as when the
+	// module is requested with the wrong capitalization. It wraps
+	// AlternativeModule.
+	ModulePathCasing = fmt.Errorf("module path has the wrong case: %w", AlternativeModule)
+
+	// ModuleTooLarge indicates that the module exceeds one of the limits on
+	// the size of its zip, the total size of its files, or its number of
+	// files. Fetching it again will not succeed, so it is not retried.
+	ModuleTooLarge = errors.New("module too large")
+	// ModuleTooManyPackages indicates that the module has more packages than
+	// the limit on the number processed for a module. It wraps
+	// ModuleTooLarge.
+	ModuleTooManyPackages = fmt.Errorf("module has too many packages: %w", ModuleTooLarge)
+
+	// ChecksumVerificationFailed indicates that the hash of the module zip
+	// differs from the one in the checksum database, or that the checksum
+	// database has no hash for the module version. The module is not
+	// processed.
+	ChecksumVerificationFailed = errors.New("checksum verification failed")
+
+	// Unsupported indicates that the requested operation is not supported by
+	// the data source, as when the proxy data source is asked for search
+	// results.
+	Unsupported = errors.New("unsupported operation")
 
 	// Unknown indicates that the error has unknown semantics.
 	Unknown = errors.New("unknown")
@@ -99,6 +137,8 @@ var codes = []struct {
 	{DBModuleInsertInvalid, 480},
 	{BadModule, 490},
 	{AlternativeModule, 491},
+	{ModuleTooLarge, 492},
+	{ChecksumVerificationFailed, 493},
 
 	{ProxyTimedOut, http.StatusGatewayTimeout},
 	// 52x and 54x errors represents modules that need to be reprocessed, and the
@@ -120,6 +160,71 @@ var codes = []struct {
 	{PackageBadImportPath, 605},
 }
 
+// Error codes identify the kind of error that a fetch of a module failed with,
+// more precisely than its status code, which is shared by related kinds. They
+// are stored along with the status in the version_map and
+// module_version_states tables, so that their readers need not interpret
+// error messages.
+const (
+	CodeNotFound                   = "not_found"
+	CodePseudoVersionDeleted       = "pseudo_version_deleted"
+	CodeInvalidArgument            = "invalid_argument"
+	CodeExcluded                   = "excluded"
+	CodeBadModule                  = "bad_module"
+	CodeBadModuleZip               = "bad_module_zip"
+	CodeBadGoMod                   = "bad_go_mod"
+	CodeModuleHasNoPackages        = "module_has_no_packages"
+	CodeAlternativeModule          = "alternative_module"
+	CodeModulePathCasing           = "module_path_casing"
+	CodeModuleTooLarge             = "module_too_large"
+	CodeModuleTooManyPackages      = "module_too_many_packages"
+	CodeChecksumVerificationFailed = "checksum_verification_failed"
+	CodeDBModuleInsertInvalid      = "db_module_insert_invalid"
+	CodeProxyTimedOut              = "proxy_timed_out"
+	// CodeUnknown is the code of errors that are not of any of the kinds
+	// above.
+	CodeUnknown = "unknown"
+)
+
+// errorCodes maps errors to their codes. Errors that wrap other errors in the
+// list must come before them.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{BadModuleZip, CodeBadModuleZip},
+	{BadGoMod, CodeBadGoMod},
+	{ModuleHasNoPackages, CodeModuleHasNoPackages},
+	{ModulePathCasing, CodeModulePathCasing},
+	{ModuleTooManyPackages, CodeModuleTooManyPackages},
+	{PseudoVersionDeleted, CodePseudoVersionDeleted},
+
+	{NotFound, CodeNotFound},
+	{InvalidArgument, CodeInvalidArgument},
+	{Excluded, CodeExcluded},
+	{BadModule, CodeBadModule},
+	{AlternativeModule, CodeAlternativeModule},
+	{ModuleTooLarge, CodeModuleTooLarge},
+	{ChecksumVerificationFailed, CodeChecksumVerificationFailed},
+	{DBModuleInsertInvalid, CodeDBModuleInsertInvalid},
+	{ProxyTimedOut, CodeProxyTimedOut},
+}
+
+// ToCode returns the error code corresponding to err. It returns the empty
+// string if err is nil, and CodeUnknown if err is not of a kind that has a
+// code.
+func ToCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			return e.code
+		}
+	}
+	return CodeUnknown
+}
+
 // FromStatus generates an error according for the given status code. It uses
 // the given format string and arguments to create the error string according
 // to the fmt package. If format is the empty string, then the error
@@ -52,6 +52,11 @@ func TestToHTTPStatus(t *testing.T) {
 		{NotFound, http.StatusNotFound},
 		{BadModule, 490},
 		{AlternativeModule, 491},
+		{ModuleTooLarge, 492},
+		{BadModuleZip, 490},
+		{ModulePathCasing, 491},
+		{ModuleTooManyPackages, 492},
+		{ChecksumVerificationFailed, 493},
 		{Unknown, http.StatusInternalServerError},
 		{fmt.Errorf("wrapping: %w", NotFound), http.StatusNotFound},
 		{io.ErrUnexpectedEOF, http.StatusInternalServerError},
@@ -63,6 +68,30 @@ func TestToHTTPStatus(t *testing.T) {
 	}
 }
 
+func TestToCode(t *testing.T) {
+	for _, tc := range []struct {
+		in   error
+		want string
+	}{
+		{nil, ""},
+		{NotFound, CodeNotFound},
+		{BadModule, CodeBadModule},
+		{fmt.Errorf("zip.NewReader: %w", BadModuleZip), CodeBadModuleZip},
+		{ModuleHasNoPackages, CodeModuleHasNoPackages},
+		{AlternativeModule, CodeAlternativeModule},
+		{fmt.Errorf("wrapping: %w", ModulePathCasing), CodeModulePathCasing},
+		{fmt.Errorf("wrapping: %w", ModuleTooManyPackages), CodeModuleTooManyPackages},
+		{fmt.Errorf("wrapping: %w", ChecksumVerificationFailed), CodeChecksumVerificationFailed},
+		{PseudoVersionDeleted, CodePseudoVersionDeleted},
+		{Unknown, CodeUnknown},
+		{io.ErrUnexpectedEOF, CodeUnknown},
+	} {
+		if got := ToCode(tc.in); got != tc.want {
+			t.Errorf("ToCode(%v) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
 func TestAdd(t *testing.T) {
 	var err error
 	Add(&err, "whatever")
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 	"golang.org/x/pkgsite/internal/licenses"
 	"golang.org/x/pkgsite/internal/source"
 	"golang.org/x/pkgsite/internal/stdlib"
@@ -37,7 +38,106 @@ type ModuleInfo struct {
 	CommitTime        time.Time
 	IsRedistributable bool
 	HasGoMod          bool // whether the module zip has a go.mod file
+	HasSecurityPolicy bool // whether the module zip has a SECURITY.md file at its root
 	SourceInfo        *source.Info
+	// RetractedVersions are the versions of this module that its go.mod file
+	// retracts.
+	RetractedVersions []RetractedVersion
+	// Retracted reports whether this version is retracted by the go.mod file
+	// of the latest version of the module. RetractionRationale is the
+	// explanation given for it, if any.
+	Retracted           bool
+	RetractionRationale string
+	// Deprecation is the deprecation message of the module, from the go.mod
+	// file of its latest version, or empty if the module is not deprecated.
+	Deprecation string
+	// If the module has more packages than are processed for a module (see
+	// fetch.MaxModulePackages), TotalPackages is their number, and only the
+	// first ProcessedPackages of them, in path order, were processed.
+	// Otherwise both are zero.
+	ProcessedPackages int
+	TotalPackages     int
+	// GoVersion and Toolchain are the arguments of the go and toolchain
+	// directives of the module's go.mod file. They are empty if the file has
+	// no such directive, or if its argument is invalid.
+	GoVersion string
+	Toolchain string
+	// ChecksumStatus reports whether the module zip was verified against a
+	// checksum database. It is one of the Checksum constants.
+	ChecksumStatus string
+}
+
+// Values of ModuleInfo.ChecksumStatus.
+const (
+	// ChecksumUnchecked means that the module zip was not checked, because no
+	// checksum database was configured or the module is the standard
+	// library.
+	ChecksumUnchecked = ""
+	// ChecksumVerified means that the hash of the module zip matched the one
+	// in the checksum database.
+	ChecksumVerified = "verified"
+	// ChecksumSkipped means that the module path matched a pattern of modules
+	// that are not checked.
+	ChecksumSkipped = "skipped"
+)
+
+// A RetractedVersion is a version named by a retract directive in a go.mod
+// file, along with the rationale comment that accompanied it, if any.
+type RetractedVersion struct {
+	Version string
+	// High, if non-empty, is the upper end of a retracted range of versions,
+	// as in "retract [Version, High]". Both ends are included.
+	High      string
+	Rationale string
+}
+
+// Retracts reports whether version is retracted by rv.
+func (rv RetractedVersion) Retracts(version string) bool {
+	if rv.High == "" {
+		return version == rv.Version
+	}
+	return semver.Compare(rv.Version, version) <= 0 && semver.Compare(version, rv.High) <= 0
+}
+
+// LatestModuleVersions describes the latest version of a module, and the
+// versions that the go.mod file of that version retracts.
+type LatestModuleVersions struct {
+	ModulePath string
+	// RawVersion is the latest version of the module, as reported by the
+	// proxy, whether or not it is retracted.
+	RawVersion string
+	// GoodVersion is the latest version of the module that is not retracted,
+	// preferring releases to pre-releases. It is empty if every known
+	// version of the module is retracted.
+	GoodVersion string
+	// Retractions are the retract directives of the go.mod file at
+	// RawVersion. They are empty if that file could not be parsed.
+	Retractions []RetractedVersion
+	// Deprecation is the message of the "Deprecated:" comment on the module
+	// directive of the go.mod file at RawVersion, or empty if the module is
+	// not deprecated.
+	Deprecation string
+}
+
+// Retraction returns the first retraction in lmv that covers version, and
+// reports whether there is one.
+func (lmv *LatestModuleVersions) Retraction(version string) (RetractedVersion, bool) {
+	for _, rv := range lmv.Retractions {
+		if rv.Retracts(version) {
+			return rv, true
+		}
+	}
+	return RetractedVersion{}, false
+}
+
+// A Modver is a module path and a version of it.
+type Modver struct {
+	Path    string
+	Version string
+}
+
+func (mv Modver) String() string {
+	return mv.Path + "@" + mv.Version
 }
 
 // VersionMap holds metadata associated with module queries for a version.
@@ -48,7 +148,10 @@ type VersionMap struct {
 	GoModPath        string
 	Status           int
 	Error            string
-	UpdatedAt        time.Time
+	// ErrorCode is the derrors error code of Error, or empty if there was
+	// no error.
+	ErrorCode string
+	UpdatedAt time.Time
 }
 
 // SeriesPath returns the series path for the module.
@@ -130,6 +233,9 @@ type ModuleVersionState struct {
 	// service, for a response with an unsuccessful status code. It is used for
 	// debugging only, and has no semantic significance.
 	Error string
+	// ErrorCode identifies the kind of Error, using the codes defined in
+	// internal/derrors, or is empty if there was no error.
+	ErrorCode string
 	// TryCount is the number of times a fetch of this version has been
 	// attempted.
 	TryCount int
@@ -152,6 +258,19 @@ type ModuleVersionState struct {
 	// NumPackages it the number of packages that were processed as part of the
 	// module (regardless of whether the processing was successful).
 	NumPackages *int
+
+	// ProxyURL is the URL of the module proxy that the module zip was most
+	// recently downloaded from. It is used for debugging only.
+	ProxyURL string
+
+	// GoVersion and Toolchain are the arguments of the go and toolchain
+	// directives of the module's go.mod file, if it was fetched.
+	GoVersion string
+	Toolchain string
+
+	// Warnings describe problems with the module that did not prevent it
+	// from being processed, such as files in its zip that were skipped.
+	Warnings []string
 }
 
 // PackageVersionState holds a worker package version state. It is associated
@@ -180,7 +299,14 @@ type SearchResult struct {
 	// NumImportedBy is the number of packages that import PackagePath.
 	NumImportedBy uint64
 
-	// NumResults is the total number of packages that were returned for this
+	// Search returns one result for each module, for its best-ranked
+	// package. NumOtherPackages is the number of the other packages of the
+	// module that match the search, and OtherPackages holds the paths of the
+	// best-ranked of them, in order. It may not hold all of them.
+	NumOtherPackages uint64
+	OtherPackages    []string
+
+	// NumResults is the total number of modules that were returned for this
 	// search.
 	NumResults uint64
 	// Approximate reports whether NumResults is an approximate count. NumResults
@@ -188,3 +314,22 @@ type SearchResult struct {
 	// result count is estimated using the hyperloglog algorithm.
 	Approximate bool
 }
+
+// SymbolSearchResult is a symbol of a package that matches a symbol search
+// query.
+type SymbolSearchResult struct {
+	// SymbolName is the name of the symbol, qualified by its type for
+	// methods and fields, like "Client.Do".
+	SymbolName string
+	// SymbolKind is the kind of the symbol: "constant", "variable",
+	// "function", "type" or "method", or empty if it is not known, as for
+	// struct fields.
+	SymbolKind string
+
+	PackagePath   string
+	ModulePath    string
+	Version       string
+	NumImportedBy uint64
+	// Score is used to sort items in an array of SymbolSearchResult.
+	Score float64
+}
@@ -59,3 +59,25 @@ func TestV1Path(t *testing.T) {
 		}
 	}
 }
+
+func TestRetractedVersionRetracts(t *testing.T) {
+	single := RetractedVersion{Version: "v1.1.0"}
+	rng := RetractedVersion{Version: "v1.2.0", High: "v1.3.0"}
+	for _, tc := range []struct {
+		rv      RetractedVersion
+		version string
+		want    bool
+	}{
+		{single, "v1.1.0", true},
+		{single, "v1.1.1", false},
+		{rng, "v1.1.9", false},
+		{rng, "v1.2.0", true},
+		{rng, "v1.2.5-pre", true},
+		{rng, "v1.3.0", true},
+		{rng, "v1.3.1-pre", false},
+	} {
+		if got := tc.rv.Retracts(tc.version); got != tc.want {
+			t.Errorf("%+v.Retracts(%q) = %t, want %t", tc.rv, tc.version, got, tc.want)
+		}
+	}
+}
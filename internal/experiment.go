@@ -11,28 +11,36 @@ import (
 
 const (
 	ExperimentAutocomplete       = "autocomplete"
+	ExperimentDeclarationSource  = "declaration-source"
 	ExperimentFrontendFetch      = "frontend-fetch"
 	ExperimentMasterVersion      = "master-version"
+	ExperimentSearchFreshness    = "search-freshness"
 	ExperimentExecutableExamples = "executable-examples"
 	ExperimentSidenav            = "sidenav"
+	ExperimentSyntaxHighlighting = "syntax-highlighting"
 	ExperimentTranslateHTML      = "translate-html"
 	ExperimentUseUnits           = "use-units"
 	ExperimentUsePackageImports  = "use-package-imports"
 	ExperimentUsePathInfo        = "use-path-info"
+	ExperimentVulns              = "vulns"
 )
 
 // Experiments represents all of the active experiments in the codebase and
 // a description of each experiment.
 var Experiments = map[string]string{
 	ExperimentAutocomplete:       "Enable autocomplete with search.",
+	ExperimentDeclarationSource:  "Store the source of functions and methods when fetching, and show it under their documentation.",
 	ExperimentFrontendFetch:      "Enable ability to fetch a package that doesn't exist on pkg.go.dev.",
 	ExperimentMasterVersion:      "Enable viewing path@master.",
+	ExperimentSearchFreshness:    "Rank search results by the freshness of their modules, and penalize stale pseudo-versions.",
 	ExperimentExecutableExamples: "Display executable examples with their import statements, so that they are runnable via the Go playground.",
 	ExperimentSidenav:            "Display documentation index on the left sidenav.",
+	ExperimentSyntaxHighlighting: "Highlight the Go syntax of examples and code blocks in documentation when fetching.",
 	ExperimentTranslateHTML:      "Parse HTML text in READMEs, to properly display images.",
 	ExperimentUseUnits:           "Read from paths, documentation, readmes, and package_imports tables.",
 	ExperimentUsePathInfo:        "Check the paths table if a path exists, as opposed to the packages or modules table.",
 	ExperimentUsePackageImports:  "Read imports from the package_imports table.",
+	ExperimentVulns:              "Show entries of the Go vulnerability database on unit pages and in search results, and list them at /vuln/.",
 }
 
 // Experiment holds data associated with an experimental feature for frontend
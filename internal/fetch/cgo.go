@@ -0,0 +1,85 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// stripCgo removes the import of the pseudo-package "C" from f, along with
+// its preamble of C code, so that the documentation neither lists C as an
+// import nor links to it. References to C in declarations are kept, and are
+// shown as written, for example "C.int".
+//
+// It also removes the //export directives that cgo requires above exported
+// functions, which are not part of their documentation.
+//
+// Packages are parsed without cgo preprocessing, so nothing else about them
+// needs special treatment.
+func stripCgo(f *ast.File) {
+	drop := map[*ast.CommentGroup]bool{}
+	decls := f.Decls[:0]
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			if decl.Tok == token.IMPORT {
+				specs := decl.Specs[:0]
+				for _, spec := range decl.Specs {
+					if is := spec.(*ast.ImportSpec); is.Path.Value == `"C"` {
+						drop[is.Doc] = true
+						drop[is.Comment] = true
+						continue
+					}
+					specs = append(specs, spec)
+				}
+				decl.Specs = specs
+				if len(specs) == 0 {
+					// The preamble is the doc comment of `import "C"`.
+					drop[decl.Doc] = true
+					continue
+				}
+			}
+		case *ast.FuncDecl:
+			if decl.Doc != nil {
+				stripExportDirectives(decl.Doc)
+				if len(decl.Doc.List) == 0 {
+					decl.Doc = nil
+				}
+			}
+		}
+		decls = append(decls, decl)
+	}
+	f.Decls = decls
+
+	imports := f.Imports[:0]
+	for _, is := range f.Imports {
+		if is.Path.Value != `"C"` {
+			imports = append(imports, is)
+		}
+	}
+	f.Imports = imports
+
+	comments := f.Comments[:0]
+	for _, cg := range f.Comments {
+		if !drop[cg] && len(cg.List) > 0 {
+			comments = append(comments, cg)
+		}
+	}
+	f.Comments = comments
+}
+
+// stripExportDirectives removes //export lines from cg, which may leave it
+// empty.
+func stripExportDirectives(cg *ast.CommentGroup) {
+	list := cg.List[:0]
+	for _, c := range cg.List {
+		if !strings.HasPrefix(c.Text, "//export ") {
+			list = append(list, c)
+		}
+	}
+	cg.List = list
+}
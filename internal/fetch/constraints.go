@@ -0,0 +1,163 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"fmt"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// matchFile reports whether the file with the given name and contents is
+// part of the package in the build context given by goos and goarch. Like the
+// go command, it considers the GOOS and GOARCH suffixes of the file name, and
+// the file's //go:build line or, if it has none, its // +build lines. Files
+// that aren't .go files, or whose names begin with "_" or ".", never match.
+//
+// The build context has cgo enabled, uses the gc compiler, and has the given
+// release tags.
+func matchFile(goos, goarch string, releaseTags []string, name string, contents []byte) (bool, error) {
+	if !strings.HasSuffix(name, ".go") || strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") {
+		return false, nil
+	}
+	match := matchTag(goos, goarch, releaseTags)
+	if !goodOSArchFile(name, match) {
+		return false, nil
+	}
+	x, err := buildConstraint(name, contents)
+	if err != nil {
+		return false, err
+	}
+	return x == nil || x.Eval(match), nil
+}
+
+// buildConstraint returns the build constraint of the file with the given
+// name and contents, or nil if it has none. Constraints are only recognized in
+// the comments that precede the package clause and are separated from it by a
+// blank line. A //go:build line takes precedence over // +build lines, which
+// are combined as if by &&. Malformed // +build lines are ignored, as they are
+// by the go command.
+func buildConstraint(name string, contents []byte) (constraint.Expr, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), name, contents, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		goBuild   constraint.Expr
+		plusBuild []constraint.Expr
+	)
+	for _, cg := range f.Comments {
+		if cg.Pos() > f.Package {
+			break
+		}
+		if cg == f.Doc {
+			// The doc comment is attached to the package clause.
+			continue
+		}
+		for _, c := range cg.List {
+			switch {
+			case constraint.IsGoBuild(c.Text):
+				if goBuild != nil {
+					return nil, fmt.Errorf("%s: multiple //go:build lines", name)
+				}
+				goBuild, err = constraint.Parse(c.Text)
+				if err != nil {
+					return nil, fmt.Errorf("%s: parsing //go:build line: %v", name, err)
+				}
+			case constraint.IsPlusBuild(c.Text):
+				if x, err := constraint.Parse(c.Text); err == nil {
+					plusBuild = append(plusBuild, x)
+				}
+			}
+		}
+	}
+	if goBuild != nil {
+		return goBuild, nil
+	}
+	var x constraint.Expr
+	for _, y := range plusBuild {
+		if x == nil {
+			x = y
+		} else {
+			x = &constraint.AndExpr{X: x, Y: y}
+		}
+	}
+	return x, nil
+}
+
+// matchTag returns a function that reports whether a build tag is satisfied
+// in the build context given by goos, goarch and releaseTags.
+func matchTag(goos, goarch string, releaseTags []string) func(string) bool {
+	return func(tag string) bool {
+		switch tag {
+		case goos, goarch, "gc", "cgo":
+			return true
+		case "linux":
+			return goos == "android"
+		case "solaris":
+			return goos == "illumos"
+		case "darwin":
+			return goos == "ios"
+		case "unix":
+			return unixOS[goos]
+		}
+		for _, t := range releaseTags {
+			if tag == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// goodOSArchFile reports whether the GOOS and GOARCH suffixes of a file name,
+// as in "name_$GOOS_$GOARCH_test.go", are satisfied by match.
+func goodOSArchFile(name string, match func(string) bool) bool {
+	name = strings.TrimSuffix(name, ".go")
+	// The first element of the name is never a suffix, so "linux.go" is not
+	// constrained.
+	i := strings.Index(name, "_")
+	if i < 0 {
+		return true
+	}
+	l := strings.Split(name[i:], "_")
+	if n := len(l); n > 0 && l[n-1] == "test" {
+		l = l[:n-1]
+	}
+	n := len(l)
+	if n >= 2 && knownOS[l[n-2]] && knownArch[l[n-1]] {
+		return match(l[n-2]) && match(l[n-1])
+	}
+	if n >= 1 && (knownOS[l[n-1]] || knownArch[l[n-1]]) {
+		return match(l[n-1])
+	}
+	return true
+}
+
+// knownOS and knownArch are the values of GOOS and GOARCH that the go command
+// recognizes in file names, and unixOS are the values of GOOS that satisfy the
+// "unix" build tag.
+var (
+	knownOS = map[string]bool{
+		"aix": true, "android": true, "darwin": true, "dragonfly": true,
+		"freebsd": true, "hurd": true, "illumos": true, "ios": true, "js": true,
+		"linux": true, "nacl": true, "netbsd": true, "openbsd": true, "plan9": true,
+		"solaris": true, "wasip1": true, "windows": true, "zos": true,
+	}
+	knownArch = map[string]bool{
+		"386": true, "amd64": true, "amd64p32": true, "arm": true, "armbe": true,
+		"arm64": true, "arm64be": true, "loong64": true, "mips": true, "mipsle": true,
+		"mips64": true, "mips64le": true, "mips64p32": true, "mips64p32le": true,
+		"ppc": true, "ppc64": true, "ppc64le": true, "riscv": true, "riscv64": true,
+		"s390": true, "s390x": true, "sparc": true, "sparc64": true, "wasm": true,
+	}
+	unixOS = map[string]bool{
+		"aix": true, "android": true, "darwin": true, "dragonfly": true,
+		"freebsd": true, "hurd": true, "illumos": true, "ios": true, "linux": true,
+		"netbsd": true, "openbsd": true, "solaris": true,
+	}
+)
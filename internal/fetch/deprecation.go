@@ -0,0 +1,50 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"regexp"
+
+	"golang.org/x/mod/modfile"
+)
+
+// deprecatedRE matches a paragraph of a comment that begins with
+// "Deprecated:", as the go command does.
+var deprecatedRE = regexp.MustCompile(`(?s)(?:^|\n\n)Deprecated: *(.*?)(?:$|\n\n)`)
+
+// parseDeprecation returns the deprecation message of the go.mod file with the
+// given contents, or the empty string if the module is not deprecated. The
+// message is the rest of a paragraph beginning with "Deprecated:" in the
+// comments before or at the end of the module directive, or, if the directive
+// is in a block without comments of its own, those of the block.
+//
+// Like the go command, it ignores a go.mod file that cannot be parsed.
+func parseDeprecation(goMod []byte) string {
+	f, err := modfile.ParseLax("go.mod", goMod, nil)
+	if err != nil {
+		return ""
+	}
+	var text string
+	for _, stmt := range f.Syntax.Stmt {
+		switch x := stmt.(type) {
+		case *modfile.Line:
+			if len(x.Token) > 0 && x.Token[0] == "module" {
+				text = directiveComment(&x.Comments)
+			}
+		case *modfile.LineBlock:
+			if len(x.Token) == 1 && x.Token[0] == "module" && len(x.Line) > 0 {
+				text = directiveComment(&x.Line[0].Comments)
+				if text == "" {
+					text = directiveComment(&x.Comments)
+				}
+			}
+		}
+	}
+	m := deprecatedRE.FindStringSubmatch(text)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import "testing"
+
+func TestParseDeprecation(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		goMod string
+		want  string
+	}{
+		{
+			name:  "not deprecated",
+			goMod: "// A module.\nmodule example.com/m\n",
+		},
+		{
+			name:  "single line",
+			goMod: "// Deprecated: use example.com/new instead.\nmodule example.com/m\n",
+			want:  "use example.com/new instead.",
+		},
+		{
+			name:  "suffix",
+			goMod: "module example.com/m // Deprecated: use example.com/new instead.\n",
+			want:  "use example.com/new instead.",
+		},
+		{
+			name: "paragraph",
+			goMod: `// The m module.
+//
+// Deprecated: use example.com/new instead.
+// It is no longer maintained.
+module example.com/m
+`,
+			want: "use example.com/new instead.\nIt is no longer maintained.",
+		},
+		{
+			name:  "not at start of paragraph",
+			goMod: "// This is not Deprecated: at all.\nmodule example.com/m\n",
+		},
+		{
+			name: "block",
+			goMod: `// Deprecated: use example.com/new instead.
+module (
+	example.com/m
+)
+`,
+			want: "use example.com/new instead.",
+		},
+		{
+			name: "block line",
+			goMod: `module (
+	// Deprecated: use example.com/new instead.
+	example.com/m
+)
+`,
+			want: "use example.com/new instead.",
+		},
+		{
+			name:  "invalid go.mod",
+			goMod: "// Deprecated: use example.com/new instead.\nmodule example.com/m\nrequire\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseDeprecation([]byte(test.goMod)); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
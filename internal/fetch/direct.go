@@ -0,0 +1,426 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	modzip "golang.org/x/mod/zip"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// A DirectRepo is a version control repository whose modules are fetched
+// directly from the repository, rather than from the proxy. This lets private
+// modules that no proxy serves be processed.
+//
+// Only git repositories are supported.
+type DirectRepo struct {
+	// Root is the module path that corresponds to the root of the repository.
+	// The repository provides the modules whose paths are Root or begin with
+	// Root followed by a slash.
+	Root string
+
+	// URL is the URL of the repository, as passed to git.
+	URL string
+}
+
+// DirectProxyURL is the ProxyURL of the FetchResult of a module that was
+// fetched directly from its repository. Like "direct" in GOPROXY, it means
+// that no proxy was involved.
+const DirectProxyURL = "direct"
+
+// directRepos are the repositories from which modules are fetched directly.
+// See SetDirectRepos.
+var directRepos []DirectRepo
+
+// allowedGitSchemes are the URL schemes that git may use to fetch a
+// repository. Other transports, notably "ext", which runs arbitrary commands,
+// are disabled.
+var allowedGitSchemes = []string{"https", "ssh", "file"}
+
+// ParseDirectRepos parses a comma-separated list of repositories of the form
+// "root=url", where root is the module path of the root of the repository and
+// url is its URL. For example,
+//
+//	example.com/team/tools=https://git.example.com/team/tools.git
+func ParseDirectRepos(s string) (_ []DirectRepo, err error) {
+	defer derrors.Wrap(&err, "ParseDirectRepos(%q)", s)
+
+	var repos []DirectRepo
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.Index(entry, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("%q: want root=url: %w", entry, derrors.InvalidArgument)
+		}
+		repos = append(repos, DirectRepo{
+			Root: strings.TrimSpace(entry[:i]),
+			URL:  strings.TrimSpace(entry[i+1:]),
+		})
+	}
+	return repos, nil
+}
+
+// SetDirectRepos configures FetchModule, LatestModuleVersions and
+// ListDirectVersions to fetch the modules of repos directly from their
+// repositories. The URL of each repository must use one of the schemes
+// https, ssh or file.
+//
+// SetDirectRepos must be called before any modules are fetched.
+func SetDirectRepos(repos []DirectRepo) (err error) {
+	defer derrors.Wrap(&err, "SetDirectRepos")
+
+	for _, r := range repos {
+		if err := module.CheckPath(r.Root); err != nil {
+			return fmt.Errorf("%v: %w", err, derrors.InvalidArgument)
+		}
+		u, err := url.Parse(r.URL)
+		if err != nil {
+			return fmt.Errorf("%v: %w", err, derrors.InvalidArgument)
+		}
+		if !allowedGitScheme(u.Scheme) {
+			return fmt.Errorf("%s: URL scheme must be one of %s: %w",
+				r.URL, strings.Join(allowedGitSchemes, ", "), derrors.InvalidArgument)
+		}
+	}
+	directRepos = repos
+	return nil
+}
+
+func allowedGitScheme(scheme string) bool {
+	for _, s := range allowedGitSchemes {
+		if scheme == s {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupDirectRepo returns the repository from which modulePath is fetched
+// directly, or nil if the module is fetched from the proxy. If the roots of
+// several repositories are prefixes of modulePath, the longest wins.
+func lookupDirectRepo(modulePath string) *DirectRepo {
+	var repo *DirectRepo
+	for i, r := range directRepos {
+		if modulePath != r.Root && !strings.HasPrefix(modulePath, r.Root+"/") {
+			continue
+		}
+		if repo == nil || len(r.Root) > len(repo.Root) {
+			repo = &directRepos[i]
+		}
+	}
+	return repo
+}
+
+// ListDirectVersions returns the versions of the module at modulePath that
+// are tagged in its repository, and true, if the module is fetched directly
+// from its repository. Otherwise it returns nil and false.
+func ListDirectVersions(ctx context.Context, modulePath string) (_ []string, direct bool, err error) {
+	defer derrors.Wrap(&err, "ListDirectVersions(%q)", modulePath)
+
+	r := lookupDirectRepo(modulePath)
+	if r == nil {
+		return nil, false, nil
+	}
+	tags, err := r.tags(ctx, modulePath)
+	if err != nil {
+		return nil, true, err
+	}
+	return tags.versions(), true, nil
+}
+
+// A directModule is a module version fetched directly from its repository.
+type directModule struct {
+	version    string
+	commitTime time.Time
+	goMod      []byte
+	zipReader  *zip.Reader
+}
+
+// fetchDirect resolves requestedVersion to a tagged commit of the repository
+// of modulePath, and writes the module zip of the files of the module at that
+// commit to f.
+func (r *DirectRepo) fetchDirect(ctx context.Context, modulePath, requestedVersion string, f *os.File) (_ *directModule, err error) {
+	defer derrors.Wrap(&err, "fetchDirect(%q, %q)", modulePath, requestedVersion)
+
+	tags, err := r.tags(ctx, modulePath)
+	if err != nil {
+		return nil, err
+	}
+	version, err := tags.resolve(requestedVersion)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir("", "direct-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tag := tags.prefix + version
+	if _, err := runGit(ctx, "", "clone", "--quiet", "--depth=1", "--no-tags",
+		"--branch", tag, "--", r.URL, dir); err != nil {
+		return nil, err
+	}
+	out, err := runGit(ctx, dir, "log", "-1", "--format=%H %ct")
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("git log: unexpected output %q", out)
+	}
+	if fields[0] != tags.commits[version] {
+		// The tag was moved after it was listed.
+		return nil, fmt.Errorf("tag %s is at commit %s, want %s", tag, fields[0], tags.commits[version])
+	}
+	secs, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	codeDir := filepath.Join(dir, filepath.FromSlash(r.codeDir(modulePath, func(rel string) bool {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(rel), "go.mod"))
+		return err == nil
+	})))
+	goMod, err := ioutil.ReadFile(filepath.Join(codeDir, "go.mod"))
+	if os.IsNotExist(err) {
+		goMod = defaultGoMod(modulePath)
+	} else if err != nil {
+		return nil, err
+	}
+	if err := modzip.CreateFromDir(f, module.Version{Path: modulePath, Version: version}, codeDir); err != nil {
+		return nil, fmt.Errorf("%v: %w", err, derrors.BadModuleZip)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	zipReader, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return nil, fmt.Errorf("zip.NewReader: %v: %w", err, derrors.BadModuleZip)
+	}
+	return &directModule{
+		version:    version,
+		commitTime: time.Unix(secs, 0).UTC(),
+		goMod:      goMod,
+		zipReader:  zipReader,
+	}, nil
+}
+
+// latest returns the latest version of the module at modulePath that is
+// tagged in r, with the retractions and deprecation of its go.mod file. See
+// LatestModuleVersions.
+func (r *DirectRepo) latest(ctx context.Context, modulePath string) (_ *internal.LatestModuleVersions, err error) {
+	tags, err := r.tags(ctx, modulePath)
+	if err != nil {
+		return nil, err
+	}
+	version, err := tags.resolve(internal.LatestVersion)
+	if err != nil {
+		return nil, err
+	}
+	goMod, err := r.readGoMod(ctx, modulePath, tags.prefix+version)
+	if err != nil {
+		return nil, err
+	}
+	return latestModuleVersions(ctx, modulePath, version, goMod, func() ([]string, error) {
+		return tags.versions(), nil
+	})
+}
+
+// readGoMod returns the go.mod file of the module at modulePath at tag. It
+// clones only the trees of the tagged commit, without checking them out, so
+// that the go.mod file is the only file that is fetched.
+func (r *DirectRepo) readGoMod(ctx context.Context, modulePath, tag string) (_ []byte, err error) {
+	defer derrors.Wrap(&err, "readGoMod(%q, %q)", modulePath, tag)
+
+	dir, err := ioutil.TempDir("", "direct-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// Servers that don't support filters ignore --filter and send the blobs
+	// as well.
+	if _, err := runGit(ctx, "", "clone", "--quiet", "--depth=1", "--no-tags", "--no-checkout",
+		"--filter=blob:none", "--branch", tag, "--", r.URL, dir); err != nil {
+		return nil, err
+	}
+	hasGoMod := func(rel string) bool {
+		// ls-tree reads only trees, so it doesn't fetch the file.
+		out, err := runGit(ctx, dir, "ls-tree", "--name-only", "HEAD", "--", path.Join(rel, "go.mod"))
+		return err == nil && len(bytes.TrimSpace(out)) > 0
+	}
+	codeDir := r.codeDir(modulePath, hasGoMod)
+	if !hasGoMod(codeDir) {
+		return defaultGoMod(modulePath), nil
+	}
+	return runGit(ctx, dir, "show", "HEAD:"+path.Join(codeDir, "go.mod"))
+}
+
+// defaultGoMod returns the go.mod file of a module that has none. Like the go
+// command, it treats the module as if it had one that declared only its path.
+func defaultGoMod(modulePath string) []byte {
+	return []byte(fmt.Sprintf("module %s\n", modulePath))
+}
+
+// codeDir returns the directory of the repository, relative to its root and
+// in slash-separated form, that holds the files of the module at modulePath.
+// hasGoMod reports whether a directory of the repository, in the same form,
+// has a go.mod file.
+//
+// As with the go command, a module whose path ends in a major version suffix
+// such as "/v2" is in the subdirectory of that name if it has a go.mod file,
+// and otherwise in the directory of the path without the suffix.
+func (r *DirectRepo) codeDir(modulePath string, hasGoMod func(rel string) bool) string {
+	rel := strings.TrimPrefix(strings.TrimPrefix(modulePath, r.Root), "/")
+	tagDir := r.tagDir(modulePath)
+	if rel == tagDir {
+		return rel
+	}
+	if hasGoMod(rel) {
+		return rel
+	}
+	return tagDir
+}
+
+// tagDir returns the directory of the repository, relative to its root, whose
+// name prefixes the version tags of the module at modulePath. It is the
+// directory of the module path without its major version suffix.
+func (r *DirectRepo) tagDir(modulePath string) string {
+	prefix := modulePath
+	if p, pathMajor, ok := module.SplitPathVersion(modulePath); ok && strings.HasPrefix(pathMajor, "/") {
+		prefix = p
+	}
+	if len(prefix) < len(r.Root) {
+		// The major version suffix is part of the root.
+		prefix = r.Root
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(prefix, r.Root), "/")
+}
+
+// moduleTags are the version tags of a module in its repository.
+type moduleTags struct {
+	// prefix is the prefix of the module's tags, such as "sub/" for a module
+	// in the subdirectory sub of the repository.
+	prefix string
+	// commits maps each version of the module to the commit that its tag
+	// points to.
+	commits map[string]string
+}
+
+// tags lists the tags of r that are versions of the module at modulePath.
+// Tags that are not canonical semantic versions, or whose major version
+// doesn't match the major version suffix of the module path, are ignored.
+func (r *DirectRepo) tags(ctx context.Context, modulePath string) (_ *moduleTags, err error) {
+	out, err := runGit(ctx, "", "ls-remote", "--tags", "--", r.URL)
+	if err != nil {
+		return nil, err
+	}
+	mt := &moduleTags{commits: map[string]string{}}
+	if d := r.tagDir(modulePath); d != "" {
+		mt.prefix = d + "/"
+	}
+	_, pathMajor, _ := module.SplitPathVersion(modulePath)
+	peeled := map[string]bool{}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		hash, ref := fields[0], fields[1]
+		tag := strings.TrimPrefix(ref, "refs/tags/")
+		// An annotated tag is listed twice: as the tag object, and, with a
+		// "^{}" suffix, as the commit that it points to.
+		isPeeled := strings.HasSuffix(tag, "^{}")
+		tag = strings.TrimSuffix(tag, "^{}")
+		if !strings.HasPrefix(tag, mt.prefix) {
+			continue
+		}
+		v := strings.TrimPrefix(tag, mt.prefix)
+		if module.CanonicalVersion(v) != v || !module.MatchPathMajor(v, pathMajor) {
+			continue
+		}
+		if peeled[v] {
+			continue
+		}
+		mt.commits[v] = hash
+		peeled[v] = isPeeled
+	}
+	return mt, nil
+}
+
+// versions returns the versions of mt in semver order.
+func (mt *moduleTags) versions() []string {
+	var vs []string
+	for v := range mt.commits {
+		vs = append(vs, v)
+	}
+	sort.Slice(vs, func(i, j int) bool { return semver.Compare(vs[i], vs[j]) < 0 })
+	return vs
+}
+
+// resolve returns the version of mt that requestedVersion refers to. It
+// accepts tagged versions and internal.LatestVersion. Other queries, like
+// branch names and commit hashes, are not supported.
+func (mt *moduleTags) resolve(requestedVersion string) (string, error) {
+	if requestedVersion == internal.LatestVersion {
+		if v := latestVersion(mt.versions()); v != "" {
+			return v, nil
+		}
+		return "", fmt.Errorf("no version tags: %w", derrors.NotFound)
+	}
+	if _, ok := mt.commits[requestedVersion]; ok {
+		return requestedVersion, nil
+	}
+	return "", fmt.Errorf("no tag %s%s: %w", mt.prefix, requestedVersion, derrors.NotFound)
+}
+
+// gitConfig configures git so that it only uses the transports of
+// allowedGitSchemes, and never prompts for credentials.
+var gitConfig = func() []string {
+	args := []string{"-c", "protocol.allow=never"}
+	for _, s := range allowedGitSchemes {
+		args = append(args, "-c", "protocol."+s+".allow=always")
+	}
+	return args
+}()
+
+// runGit runs git with args in dir, or in the current directory if dir is
+// empty, and returns its standard output.
+func runGit(ctx context.Context, dir string, args ...string) (_ []byte, err error) {
+	defer derrors.Wrap(&err, "git %s", args[0])
+
+	cmd := exec.CommandContext(ctx, "git", append(gitConfig, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
@@ -0,0 +1,237 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/source"
+	"golang.org/x/pkgsite/internal/testing/testhelper"
+)
+
+const directRoot = "example.com/direct"
+
+var directCommitTime = time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// setupDirectRepo creates a git repository with tagged versions of the
+// modules example.com/direct, example.com/direct/sub and
+// example.com/direct/v2, and configures the fetch package to fetch them
+// directly from it. It returns a function that undoes the configuration.
+func setupDirectRepo(t *testing.T) func() {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := ioutil.TempDir("", "direct-repo-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=gopher", "-c", "user.email=gopher@example.com"}, args...)...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_DATE="+directCommitTime.Format(time.RFC3339),
+			"GIT_COMMITTER_DATE="+directCommitTime.Format(time.RFC3339))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(files map[string]string) {
+		t.Helper()
+		for name, contents := range files {
+			name = filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(name, []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	commit := func(tags ...string) {
+		t.Helper()
+		git("add", "-A")
+		git("commit", "--quiet", "-m", "commit")
+		for _, tag := range tags {
+			git("tag", "-a", "-m", tag, tag)
+		}
+	}
+
+	git("init", "--quiet")
+	write(map[string]string{
+		"go.mod":        "module example.com/direct\n",
+		"LICENSE":       testhelper.MITLicense,
+		"direct.go":     "// Package direct is fetched from git.\npackage direct\n",
+		"sub/go.mod":    "module example.com/direct/sub\n",
+		"sub/sub.go":    "package sub\n",
+		"sub/LICENSE":   testhelper.MITLicense,
+		"internal/a.go": "package internal\n",
+	})
+	commit("v1.0.0", "sub/v1.0.0", "not-a-version")
+	write(map[string]string{
+		"go.mod":     "module example.com/direct\n\nretract v1.0.0 // Broken.\n",
+		"v2/go.mod":  "module example.com/direct/v2\n",
+		"v2/v2.go":   "package direct\n",
+		"v2/LICENSE": testhelper.MITLicense,
+	})
+	commit("v1.1.0", "v1.2.0-pre", "v2.0.0")
+
+	saved := directRepos
+	if err := SetDirectRepos([]DirectRepo{{Root: directRoot, URL: "file://" + filepath.ToSlash(dir)}}); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		directRepos = saved
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFetchModuleDirect(t *testing.T) {
+	defer setupDirectRepo(t)()
+
+	sourceClient := source.NewClient(sourceTimeout)
+	sourceClient.SetPrivatePatterns(directRoot)
+	for _, test := range []struct {
+		modulePath, version string
+		wantVersion         string
+		wantUnits           []string
+	}{
+		{directRoot, "v1.0.0", "v1.0.0", []string{directRoot, directRoot + "/internal"}},
+		{directRoot, internal.LatestVersion, "v1.1.0", []string{directRoot, directRoot + "/internal"}},
+		{directRoot + "/sub", "v1.0.0", "v1.0.0", []string{directRoot + "/sub"}},
+		{directRoot + "/v2", "v2.0.0", "v2.0.0", []string{directRoot + "/v2"}},
+	} {
+		t.Run(test.modulePath+"@"+test.version, func(t *testing.T) {
+			fr := FetchModule(context.Background(), test.modulePath, test.version, nil, sourceClient)
+			if fr.Error != nil {
+				t.Fatal(fr.Error)
+			}
+			if fr.Status != http.StatusOK || fr.ResolvedVersion != test.wantVersion || fr.ProxyURL != DirectProxyURL {
+				t.Errorf("got status %d, resolved version %q, proxy URL %q; want %d, %q, %q",
+					fr.Status, fr.ResolvedVersion, fr.ProxyURL, http.StatusOK, test.wantVersion, DirectProxyURL)
+			}
+			if !fr.Module.CommitTime.Equal(directCommitTime) {
+				t.Errorf("got commit time %s, want %s", fr.Module.CommitTime, directCommitTime)
+			}
+			var gotUnits []string
+			for _, u := range fr.Module.Units {
+				gotUnits = append(gotUnits, u.Path)
+			}
+			sort.Strings(gotUnits)
+			if diff := cmp.Diff(test.wantUnits, gotUnits); diff != "" {
+				t.Errorf("units mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFetchModuleDirectErrors(t *testing.T) {
+	defer setupDirectRepo(t)()
+
+	for _, test := range []struct {
+		modulePath, version string
+		wantErr             error
+	}{
+		{directRoot, "v1.9.0", derrors.NotFound},
+		{directRoot, "not-a-version", derrors.NotFound},
+		{directRoot + "/sub", "v1.1.0", derrors.NotFound},
+		{directRoot + "/missing", internal.LatestVersion, derrors.NotFound},
+	} {
+		fr := FetchModule(context.Background(), test.modulePath, test.version, nil, nil)
+		if !errors.Is(fr.Error, test.wantErr) {
+			t.Errorf("FetchModule(%q, %q): got error %v, want %v", test.modulePath, test.version, fr.Error, test.wantErr)
+		}
+	}
+}
+
+func TestLatestModuleVersionsDirect(t *testing.T) {
+	defer setupDirectRepo(t)()
+
+	got, err := LatestModuleVersions(context.Background(), directRoot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &internal.LatestModuleVersions{
+		ModulePath:  directRoot,
+		RawVersion:  "v1.1.0",
+		GoodVersion: "v1.1.0",
+		Retractions: []internal.RetractedVersion{{Version: "v1.0.0", Rationale: "Broken."}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestListDirectVersions(t *testing.T) {
+	defer setupDirectRepo(t)()
+
+	for _, test := range []struct {
+		modulePath string
+		want       []string
+		wantDirect bool
+	}{
+		{directRoot, []string{"v1.0.0", "v1.1.0", "v1.2.0-pre"}, true},
+		{directRoot + "/sub", []string{"v1.0.0"}, true},
+		{directRoot + "/v2", []string{"v2.0.0"}, true},
+		{"example.com/directory", nil, false},
+	} {
+		got, direct, err := ListDirectVersions(context.Background(), test.modulePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if direct != test.wantDirect {
+			t.Errorf("ListDirectVersions(%q): direct = %t, want %t", test.modulePath, direct, test.wantDirect)
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("ListDirectVersions(%q) mismatch (-want +got):\n%s", test.modulePath, diff)
+		}
+	}
+}
+
+func TestSetDirectRepos(t *testing.T) {
+	saved := directRepos
+	defer func() { directRepos = saved }()
+
+	repos, err := ParseDirectRepos("example.com/a=https://git.example.com/a.git, example.com/b=ssh://git@example.com/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DirectRepo{
+		{Root: "example.com/a", URL: "https://git.example.com/a.git"},
+		{Root: "example.com/b", URL: "ssh://git@example.com/b"},
+	}
+	if diff := cmp.Diff(want, repos); diff != "" {
+		t.Errorf("ParseDirectRepos mismatch (-want +got):\n%s", diff)
+	}
+	if err := SetDirectRepos(repos); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseDirectRepos("example.com/a"); !errors.Is(err, derrors.InvalidArgument) {
+		t.Errorf("ParseDirectRepos without URL: got error %v, want %v", err, derrors.InvalidArgument)
+	}
+	for _, r := range []DirectRepo{
+		{Root: "example.com/a", URL: "ext::sh -c touch% /tmp/pwned"},
+		{Root: "example.com/a", URL: "http://git.example.com/a.git"},
+		{Root: "not a path", URL: "https://git.example.com/a.git"},
+	} {
+		if err := SetDirectRepos([]DirectRepo{r}); !errors.Is(err, derrors.InvalidArgument) {
+			t.Errorf("SetDirectRepos(%+v): got error %v, want %v", r, err, derrors.InvalidArgument)
+		}
+	}
+}
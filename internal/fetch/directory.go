@@ -61,11 +61,15 @@ func moduleUnits(modulePath, version string,
 		if pkg, ok := pkgLookup[dirPath]; ok {
 			dir.Name = pkg.Name
 			dir.Imports = pkg.Imports
-			dir.Documentation = &internal.Documentation{
-				GOOS:     pkg.GOOS,
-				GOARCH:   pkg.GOARCH,
-				Synopsis: pkg.Synopsis,
-				HTML:     pkg.DocumentationHTML,
+			dir.ContentHash = pkg.ContentHash
+			dir.Documentation = pkg.Documentation
+			if len(dir.Documentation) == 0 {
+				dir.Documentation = []*internal.Documentation{{
+					GOOS:     pkg.GOOS,
+					GOARCH:   pkg.GOARCH,
+					Synopsis: pkg.Synopsis,
+					HTML:     pkg.DocumentationHTML,
+				}}
 			}
 		}
 		units = append(units, dir)
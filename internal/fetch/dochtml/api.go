@@ -0,0 +1,86 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dochtml
+
+import (
+	"context"
+	"go/ast"
+	"go/token"
+	"strings"
+
+	"golang.org/x/pkgsite/internal/fetch/dochtml/internal/render"
+	"golang.org/x/pkgsite/internal/fetch/internal/doc"
+	"golang.org/x/pkgsite/internal/godoc"
+)
+
+// API returns the package examples and the documented symbols of p, as
+// Render shows them with modInfo: declarations are formatted in the same
+// way, examples have the same IDs and code, and symbols are in the same
+// order. Like Render, it returns no examples or symbols for commands.
+func API(ctx context.Context, fset *token.FileSet, p *doc.Package, modInfo *ModuleInfo) *godoc.API {
+	api := &godoc.API{}
+	if p.Name == "main" {
+		return api
+	}
+	r := newRenderer(ctx, fset, p, modInfo)
+	declText := func(decl ast.Decl) string {
+		return strings.TrimSpace(r.DeclText(decl))
+	}
+	exs := collectExamples(p)
+	examples := func(id string) []godoc.Example {
+		var gexs []godoc.Example
+		for _, ex := range exs.Map[id] {
+			gexs = append(gexs, godoc.Example{
+				ID:     ex.ID.String(),
+				Suffix: ex.Suffix,
+				Code:   strings.TrimSpace(r.CodeText(ex.Example)),
+				Output: strings.TrimSpace(ex.Output),
+			})
+		}
+		return gexs
+	}
+	symbol := func(name, kind, docText, signature string) godoc.Symbol {
+		return godoc.Symbol{
+			Name:       name,
+			Kind:       kind,
+			Signature:  signature,
+			Doc:        strings.TrimSpace(docText),
+			DocHTML:    strings.TrimSpace(r.DocHTML(docText).String()),
+			Deprecated: render.IsDeprecated(docText),
+		}
+	}
+	addValues := func(kind string, values []*doc.Value) {
+		for _, v := range values {
+			signature := declText(v.Decl)
+			for _, name := range v.Names {
+				if name != "_" {
+					api.Symbols = append(api.Symbols, symbol(name, kind, v.Doc, signature))
+				}
+			}
+		}
+	}
+	addFuncs := func(kind, prefix string, funcs []*doc.Func) {
+		for _, f := range funcs {
+			s := symbol(prefix+f.Name, kind, f.Doc, declText(f.Decl))
+			s.Examples = examples(s.Name)
+			api.Symbols = append(api.Symbols, s)
+		}
+	}
+
+	api.Examples = examples("")
+	addValues("constant", p.Consts)
+	addValues("variable", p.Vars)
+	addFuncs("function", "", p.Funcs)
+	for _, t := range p.Types {
+		s := symbol(t.Name, "type", t.Doc, declText(t.Decl))
+		s.Examples = examples(t.Name)
+		api.Symbols = append(api.Symbols, s)
+		addValues("constant", t.Consts)
+		addValues("variable", t.Vars)
+		addFuncs("function", "", t.Funcs)
+		addFuncs("method", t.Name+".", t.Methods)
+	}
+	return api
+}
@@ -20,7 +20,10 @@ import (
 	"go/token"
 	pathpkg "path"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/safehtml"
 	"github.com/google/safehtml/legacyconversions"
@@ -28,6 +31,7 @@ import (
 	"github.com/google/safehtml/uncheckedconversions"
 	"golang.org/x/pkgsite/internal/fetch/dochtml/internal/render"
 	"golang.org/x/pkgsite/internal/fetch/internal/doc"
+	"golang.org/x/pkgsite/internal/stdlib"
 )
 
 var (
@@ -59,6 +63,17 @@ type RenderOptions struct {
 	// belongs to in order to render module-related documentation.
 	ModInfo *ModuleInfo
 	Limit   int64 // If zero, a default limit of 10 megabytes is used.
+	// Collapsed renders abbreviated documentation, for packages whose full
+	// documentation is too large to serve on every page view. It has the
+	// overview and the index, but each declaration is reduced to its
+	// synopsis and the first sentence of its documentation, and examples are
+	// omitted. Declaration headers keep their IDs, so links from the index
+	// still work.
+	Collapsed bool
+	// DeclSource optionally maps declarations to their source text. The
+	// source of a function or method in the map is shown in a collapsed
+	// block under its documentation. It is ignored if Collapsed is set.
+	DeclSource map[ast.Decl]string
 }
 
 // Render renders package documentation HTML for the
@@ -87,27 +102,7 @@ func Render(ctx context.Context, fset *token.FileSet, p *doc.Package, opt Render
 		p.Examples = nil
 	}
 
-	// Remove everything from the notes section that is not a bug. This
-	// includes TODOs and other arbitrary notes.
-	for k := range p.Notes {
-		if k == "BUG" {
-			continue
-		}
-		delete(p.Notes, k)
-	}
-
-	r := render.New(ctx, fset, p, &render.Options{
-		PackageURL: func(path string) string {
-			// Use the same module version for imported packages that belong to
-			// the same module.
-			versionedPath := path
-			if opt.ModInfo != nil {
-				versionedPath = versionedPkgPath(path, opt.ModInfo)
-			}
-			return pathpkg.Join("/pkg", versionedPath)
-		},
-		DisableHotlinking: true,
-	})
+	r := newRenderer(ctx, fset, p, opt.ModInfo)
 
 	fileLink := func(name string) safehtml.HTML {
 		return linkHTML(name, opt.FileLinkFunc(name), "Documentation-file")
@@ -115,30 +110,170 @@ func Render(ctx context.Context, fset *token.FileSet, p *doc.Package, opt Render
 	sourceLink := func(name string, node ast.Node) safehtml.HTML {
 		return linkHTML(name, opt.SourceLinkFunc(node), "Documentation-source")
 	}
+	noteLink := func(n *doc.Note) safehtml.HTML {
+		p := fset.Position(n.Pos)
+		return linkHTML(fmt.Sprintf("%s:%d", p.Filename, p.Line), opt.SourceLinkFunc(notePos{n.Pos, n.End}), "Documentation-source")
+	}
+
+	renderDecl := r.DeclHTML
+	exs := collectExamples(p)
+	declSource := opt.DeclSource
+	if opt.Collapsed {
+		renderDecl = func(docText string, decl ast.Decl) (out struct{ Doc, Decl safehtml.HTML }) {
+			return collapsedDeclHTML(r, docText, decl)
+		}
+		exs = &examples{Map: map[string][]*example{}}
+		declSource = nil
+	}
 
 	tmpl := template.Must(htmlPackage.Clone()).Funcs(map[string]interface{}{
 		"render_short_synopsis": r.ShortSynopsis,
 		"render_synopsis":       r.Synopsis,
 		"render_doc":            r.DocHTML,
-		"render_decl":           r.DeclHTML,
+		"render_decl":           renderDecl,
 		"render_code":           r.CodeHTML,
 		"file_link":             fileLink,
 		"source_link":           sourceLink,
+		"note_link":             noteLink,
+		"decl_source":           func(decl ast.Decl) string { return declSource[decl] },
 	})
 	data := struct {
 		RootURL string
 		*doc.Package
-		Examples *examples
-		NoteIDs  map[string]safehtml.Identifier
+		Examples  *examples
+		NoteIDs   map[string]safehtml.Identifier
+		Collapsed bool
 	}{
-		RootURL:  "/pkg",
-		Package:  p,
-		Examples: collectExamples(p),
-		NoteIDs:  buildNoteIDs(p.Notes),
+		RootURL:   "/pkg",
+		Package:   p,
+		Examples:  exs,
+		NoteIDs:   buildNoteIDs(p.Notes),
+		Collapsed: opt.Collapsed,
 	}
 	return executeToHTMLWithLimit(tmpl, data, opt.Limit)
 }
 
+// newRenderer returns a renderer for the documentation of p. If modInfo is
+// not nil, links to the other packages of the module are to the same version.
+func newRenderer(ctx context.Context, fset *token.FileSet, p *doc.Package, modInfo *ModuleInfo) *render.Renderer {
+	return render.New(ctx, fset, p, &render.Options{
+		PackageURL: func(path string) string {
+			// Use the same module version for imported packages that belong to
+			// the same module.
+			versionedPath := path
+			if modInfo != nil {
+				versionedPath = versionedPkgPath(path, modInfo)
+			}
+			return pathpkg.Join("/pkg", versionedPath)
+		},
+		DisableHotlinking: true,
+	})
+}
+
+// Synopsis returns a one-sentence summary of the package comment pkgDoc, as
+// doc.Synopsis does. Directive lines, such as "go:generate" or "+build",
+// are removed first. Paragraphs that begin with "Deprecated:" are skipped,
+// so that the summary says what the package does, unless there is nothing
+// else to summarize.
+func Synopsis(pkgDoc string) string {
+	pkgDoc = stripDirectives(pkgDoc)
+	var paras []string
+	for _, p := range strings.Split(pkgDoc, "\n\n") {
+		if !render.IsDeprecated(p) {
+			paras = append(paras, p)
+		}
+	}
+	if len(paras) == 0 {
+		return doc.Synopsis(pkgDoc)
+	}
+	return doc.Synopsis(strings.Join(paras, "\n\n"))
+}
+
+// stripDirectives removes lines that are compiler or build directives, which
+// can end up in a package comment when no blank line separates them from it.
+func stripDirectives(text string) string {
+	lines := strings.Split(text, "\n")
+	out := lines[:0]
+	for _, l := range lines {
+		if !isDirective(strings.TrimSpace(l)) {
+			out = append(out, l)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// isDirective reports whether line is a directive such as "go:generate",
+// "line file.go:1" or "+build linux".
+func isDirective(line string) bool {
+	if strings.HasPrefix(line, "+build ") || strings.HasPrefix(line, "line ") {
+		return true
+	}
+	if !strings.HasPrefix(line, "go:") || len(line) == len("go:") {
+		return false
+	}
+	// As for go/ast, a directive is "go:" followed by a lower-case word.
+	c := line[len("go:")]
+	return 'a' <= c && c <= 'z'
+}
+
+// TrimPackageName removes a leading "Package <name>" from synopsis, and
+// capitalizes what follows. For example, "Package json implements encoding
+// of JSON." becomes "Implements encoding of JSON." Other synopses are
+// returned unchanged.
+func TrimPackageName(synopsis, name string) string {
+	prefix := "Package " + name + " "
+	if name == "" || len(synopsis) <= len(prefix) || !strings.EqualFold(synopsis[:len(prefix)], prefix) {
+		return synopsis
+	}
+	rest := synopsis[len(prefix):]
+	r, size := utf8.DecodeRuneInString(rest)
+	return string(unicode.ToUpper(r)) + rest[size:]
+}
+
+// TruncateSynopsis shortens synopsis to at most max bytes, for display. If a
+// sentence or clause ends in the second half of the allowed length, it cuts
+// there; otherwise it cuts at a word boundary. An ellipsis marks a cut that
+// is not at the end of a sentence. If max is not positive, synopsis is
+// returned unchanged.
+func TruncateSynopsis(synopsis string, max int) string {
+	if max <= 0 || len(synopsis) <= max {
+		return synopsis
+	}
+	const ellipsis = "…"
+	limit := max - len(ellipsis)
+	if limit <= 0 {
+		return ellipsis
+	}
+	// Back up to a rune boundary.
+	for limit > 0 && !utf8.RuneStart(synopsis[limit]) {
+		limit--
+	}
+	s := synopsis[:limit]
+	if i := strings.LastIndexAny(s, ".;:!?"); i >= limit/2 && i+1 < len(synopsis) && synopsis[i+1] == ' ' {
+		if s[i] == ';' || s[i] == ':' {
+			return s[:i] + ellipsis
+		}
+		// The text ends with a complete sentence.
+		return s[:i+1]
+	}
+	if i := strings.LastIndexByte(s, ' '); i > 0 {
+		s = s[:i]
+	}
+	return strings.TrimRight(s, " ,;:") + ellipsis
+}
+
+// collapsedDeclHTML is like r.DeclHTML, but renders only the synopsis of decl
+// and the first sentence of docText.
+func collapsedDeclHTML(r *render.Renderer, docText string, decl ast.Decl) (out struct{ Doc, Decl safehtml.HTML }) {
+	out.Decl = render.ExecuteToHTML(collapsedDeclTmpl, r.Synopsis(decl))
+	if s := doc.Synopsis(docText); s != "" {
+		out.Doc = r.DocHTML(s)
+	}
+	return out
+}
+
+var collapsedDeclTmpl = template.Must(template.New("").Parse("<pre>\n{{.}}</pre>\n"))
+
 // executeToHTMLWithLimit executes tmpl on data and returns the result as a safehtml.HTML.
 // It returns an error if the size of the result exceeds limit.
 func executeToHTMLWithLimit(tmpl *template.Template, data interface{}, limit int64) (safehtml.HTML, error) {
@@ -226,7 +361,7 @@ func collectExamples(p *doc.Package) *examples {
 	WalkExamples(p, func(id string, ex *doc.Example) {
 		suffix := strings.Title(ex.Suffix)
 		ex0 := &example{
-			Example:  ex,
+			Example:  playableExample(ex, p.ImportPath),
 			ID:       exampleID(id, suffix),
 			ParentID: id,
 			Suffix:   suffix,
@@ -242,6 +377,33 @@ func collectExamples(p *doc.Package) *examples {
 	return exs
 }
 
+// playableExample returns ex if it can be run on the Go playground, and
+// otherwise a copy of ex without a runnable program, which is rendered as
+// plain code. A program is playable if it imports only standard library
+// packages and the documented package, importPath.
+func playableExample(ex *doc.Example, importPath string) *doc.Example {
+	if ex.Play == nil {
+		return ex
+	}
+	// The synthesized file does not populate Imports, so look at its
+	// import declarations instead.
+	for _, decl := range ex.Play.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range d.Specs {
+			path, err := strconv.Unquote(spec.(*ast.ImportSpec).Path.Value)
+			if err != nil || (!stdlib.Contains(path) && path != importPath) {
+				ex2 := *ex
+				ex2.Play = nil
+				return &ex2
+			}
+		}
+	}
+	return ex
+}
+
 func exampleID(id, suffix string) safehtml.Identifier {
 	switch {
 	case id == "" && suffix == "":
@@ -261,6 +423,13 @@ func exampleID(id, suffix string) safehtml.Identifier {
 	}
 }
 
+// notePos is an ast.Node spanning the comment that contains a note, so that
+// the note can be linked to its source with RenderOptions.SourceLinkFunc.
+type notePos struct{ pos, end token.Pos }
+
+func (n notePos) Pos() token.Pos { return n.pos }
+func (n notePos) End() token.Pos { return n.end }
+
 // buildNoteIDs constructs safehtml identifiers from note markers.
 // It returns a map from each marker to its corresponding safehtml ID.
 func buildNoteIDs(notes map[string][]*doc.Note) map[string]safehtml.Identifier {
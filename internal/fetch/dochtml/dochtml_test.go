@@ -21,6 +21,7 @@ import (
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/experiment"
 	"golang.org/x/pkgsite/internal/fetch/internal/doc"
+	"golang.org/x/pkgsite/internal/godoc"
 	"golang.org/x/pkgsite/internal/testing/htmlcheck"
 )
 
@@ -46,13 +47,381 @@ func TestRender(t *testing.T) {
 		// Check that the id and data-kind labels are right.
 		testIDsAndKinds(t, htmlDoc)
 	})
+	t.Run("links", func(t *testing.T) {
+		// Check that every link within the page, including those of the
+		// outline, has a target.
+		testLinkTargets(t, htmlDoc)
+	})
+	checker := htmlcheck.In(".Documentation-overview h3", htmlcheck.HasAttr("id", "hdr-Usage"))
+	if err := checker(htmlDoc); err != nil {
+		t.Errorf("overview heading check: %v", err)
+	}
+	checker = htmlcheck.In(".Documentation-type h3:nth-of-type(2)", htmlcheck.HasAttr("id", "hdr-Usage-1"))
+	if err := checker(htmlDoc); err != nil {
+		t.Errorf("type heading check: %v", err)
+	}
 
-	checker := htmlcheck.In(".Documentation-note",
+	checker = htmlcheck.In(".Documentation-note",
 		htmlcheck.In("h2", htmlcheck.HasAttr("id", "pkg-note-BUG")),
-		htmlcheck.In("a", htmlcheck.HasHref("#pkg-note-BUG")))
+		htmlcheck.In("a", htmlcheck.HasHref("#pkg-note-BUG")),
+		htmlcheck.In(".Documentation-noteSource a",
+			htmlcheck.HasHref("src"),
+			htmlcheck.HasText(`^everydecl\.go:44$`)))
 	if err := checker(htmlDoc); err != nil {
 		t.Errorf("note check: %v", err)
 	}
+	checker = htmlcheck.In(".Documentation-note:nth-of-type(2)",
+		htmlcheck.In("h2", htmlcheck.HasAttr("id", "pkg-note-TODO")))
+	if err := checker(htmlDoc); err != nil {
+		t.Errorf("note check: %v", err)
+	}
+	// Notes come right after the overview.
+	if i, j := strings.Index(rawDoc.String(), "Documentation-notes"), strings.Index(rawDoc.String(), "Documentation-index"); i < 0 || i > j {
+		t.Errorf("notes section at %d, want before index at %d", i, j)
+	}
+}
+
+func TestRenderDeprecated(t *testing.T) {
+	fset, d := mustLoadPackage("deprecated")
+	rawDoc, err := Render(context.Background(), fset, d, RenderOptions{
+		FileLinkFunc:   func(string) string { return "file" },
+		SourceLinkFunc: func(ast.Node) string { return "src" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	htmlDoc, err := html.Parse(strings.NewReader(rawDoc.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name    string
+		checker htmlcheck.Checker
+	}{
+		{
+			"package",
+			htmlcheck.In(".Documentation-overview p.Documentation-deprecated",
+				htmlcheck.HasText("^Deprecated: use package everydecl instead")),
+		},
+		{
+			"deprecated function in index",
+			htmlcheck.In(".Documentation-indexFunction.Documentation-indexDeprecated",
+				htmlcheck.HasText("func Old()")),
+		},
+		{
+			"deprecated function",
+			htmlcheck.In(".Documentation-function p.Documentation-deprecated",
+				htmlcheck.HasText("^Deprecated: use New instead")),
+		},
+		{
+			"deprecated type in index",
+			htmlcheck.In(".Documentation-indexType.Documentation-indexDeprecated",
+				htmlcheck.HasText("type T")),
+		},
+		{
+			"deprecated method in index",
+			htmlcheck.In(".Documentation-indexTypeMethods .Documentation-indexDeprecated",
+				htmlcheck.HasText(`func \(T\) M\(\)`)),
+		},
+		{
+			"deprecated struct field",
+			htmlcheck.In(".Documentation-type pre .comment.Documentation-deprecated",
+				htmlcheck.HasText("^// Deprecated: use G.$")),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.checker(htmlDoc); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// Only the deprecated function, type and method are marked in the index.
+	var got []string
+	walk(htmlDoc, func(n *html.Node) {
+		if !strings.Contains(attr(n, "class"), "Documentation-indexDeprecated") {
+			return
+		}
+		walk(n, func(c *html.Node) {
+			if href := attr(c, "href"); href != "" {
+				got = append(got, href)
+			}
+		})
+	})
+	want := []string{"#Old", "#T", "#T.M"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("deprecated index entries mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestRenderCollapsed(t *testing.T) {
+	ctx := context.Background()
+	fset, d := mustLoadPackage("everydecl")
+	rawDoc, err := Render(ctx, fset, d, RenderOptions{
+		FileLinkFunc:   func(string) string { return "file" },
+		SourceLinkFunc: func(ast.Node) string { return "src" },
+		Collapsed:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	htmlDoc, err := html.Parse(strings.NewReader(rawDoc.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := htmlcheck.In(".Documentation-collapsed",
+		htmlcheck.In("a", htmlcheck.HasHref(`?tab=doc&full=1`)))
+	if err := checker(htmlDoc); err != nil {
+		t.Error(err)
+	}
+	checker = htmlcheck.In(".Documentation-types .Documentation-typeMethod pre",
+		htmlcheck.HasText(`^\s*func \(T\) M\(\)$`))
+	if err := checker(htmlDoc); err != nil {
+		t.Error(err)
+	}
+
+	// Every link in the index must have a target.
+	ids := map[string]bool{}
+	walk(htmlDoc, func(n *html.Node) {
+		if id := attr(n, "id"); id != "" {
+			ids[id] = true
+		}
+	})
+	walk(htmlDoc, func(n *html.Node) {
+		if !strings.Contains(attr(n, "class"), "Documentation-indexList") {
+			return
+		}
+		walk(n, func(c *html.Node) {
+			href := attr(c, "href")
+			if strings.HasPrefix(href, "#") && !ids[href[1:]] {
+				t.Errorf("index link %q has no target", href)
+			}
+		})
+	})
+
+	// The collapsed documentation must be smaller than the full one.
+	full, err := Render(ctx, fset, d, RenderOptions{
+		FileLinkFunc:   func(string) string { return "file" },
+		SourceLinkFunc: func(ast.Node) string { return "src" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, max := len(rawDoc.String()), len(full.String()); got >= max {
+		t.Errorf("collapsed documentation has %d bytes, want fewer than %d", got, max)
+	}
+}
+
+func TestSynopsis(t *testing.T) {
+	for _, test := range []struct {
+		doc, want string
+	}{
+		{"Package p does things.", "Package p does things."},
+		{"Package p does things.\n\nDeprecated: use q.\n", "Package p does things."},
+		{"Deprecated: use q.\n\nPackage p does things.\n", "Package p does things."},
+		{"Deprecated: use q.\n", "Deprecated: use q."},
+		{"go:generate stringer -type=T\nPackage p does things.\n", "Package p does things."},
+		{"+build linux\n\nPackage p does things.\n", "Package p does things."},
+		{"Package p does things for\nGo: the language.\n", "Package p does things for Go: the language."},
+	} {
+		if got := Synopsis(test.doc); got != test.want {
+			t.Errorf("Synopsis(%q) = %q, want %q", test.doc, got, test.want)
+		}
+	}
+}
+
+func TestDeclSource(t *testing.T) {
+	fset, d := mustLoadPackage("everydecl")
+	var m *doc.Func
+	for _, typ := range d.Types {
+		if typ.Name == "T" {
+			m = typ.Methods[0]
+		}
+	}
+	opts := RenderOptions{
+		FileLinkFunc:   func(string) string { return "file" },
+		SourceLinkFunc: func(ast.Node) string { return "src" },
+		DeclSource:     map[ast.Decl]string{m.Decl: "func (T) M() { <body> }"},
+	}
+	for _, collapsed := range []bool{false, true} {
+		opts.Collapsed = collapsed
+		rawDoc, err := Render(context.Background(), fset, d, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc := rawDoc.String()
+		want := `<details class="Documentation-declSource">
+<summary class="Documentation-declSourceHeader">Source</summary>
+<pre>
+func (T) M() { &lt;body&gt; }</pre>
+</details>`
+		if got := strings.Contains(doc, want); got == collapsed {
+			t.Errorf("collapsed=%t: got source %t, want %t; documentation:\n%s", collapsed, got, !collapsed, doc)
+		}
+		if got := strings.Count(doc, "Documentation-declSource\""); got > 1 {
+			t.Errorf("collapsed=%t: got %d source blocks, want at most 1", collapsed, got)
+		}
+	}
+}
+
+func TestAPI(t *testing.T) {
+	src := `// Package p is documented.
+package p
+
+// Lines are the number of lines.
+const (
+	Lines = 1
+	Cols  = 2
+)
+
+// F is a function.
+//
+// Deprecated: use G.
+func F() {}
+
+// T is a type.
+type T int
+
+// NewT returns a T.
+func NewT() T { return 0 }
+
+// M is a method.
+func (T) M(x int) {}
+
+// Long is long.
+var Long = "` + strings.Repeat("x", 128) + `"
+`
+	const examples = `package p_test
+
+import "fmt"
+
+func Example() {
+	fmt.Println("hi")
+	// Output: hi
+}
+
+func ExampleT_M_second() {
+	fmt.Println("m")
+}
+`
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for name, src := range map[string]string{"p.go": src, "example_test.go": examples} {
+		f, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	d, err := doc.NewFromFiles(fset, files, "example.com/p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	got := API(ctx, fset, d, nil)
+	want := &godoc.API{
+		Examples: []godoc.Example{{ID: "example-package", Code: `fmt.Println("hi")`, Output: "hi"}},
+		Symbols: []godoc.Symbol{
+			{
+				Name:      "Lines",
+				Kind:      "constant",
+				Signature: "const (\n\tLines = 1\n\tCols  = 2\n)",
+				Doc:       "Lines are the number of lines.",
+			},
+			{
+				Name:      "Cols",
+				Kind:      "constant",
+				Signature: "const (\n\tLines = 1\n\tCols  = 2\n)",
+				Doc:       "Lines are the number of lines.",
+			},
+			{
+				Name:      "Long",
+				Kind:      "variable",
+				Signature: `var Long = "" /* 128 byte string literal not displayed */`,
+				Doc:       "Long is long.",
+			},
+			{
+				Name:       "F",
+				Kind:       "function",
+				Signature:  "func F()",
+				Doc:        "F is a function.\n\nDeprecated: use G.",
+				Deprecated: true,
+			},
+			{Name: "T", Kind: "type", Signature: "type T int", Doc: "T is a type."},
+			{Name: "NewT", Kind: "function", Signature: "func NewT() T", Doc: "NewT returns a T."},
+			{
+				Name:      "T.M",
+				Kind:      "method",
+				Signature: "func (T) M(x int)",
+				Doc:       "M is a method.",
+				Examples:  []godoc.Example{{ID: "example-T.M-Second", Suffix: "Second", Code: `fmt.Println("m")`}},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(godoc.Symbol{}, "DocHTML")); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := got.Symbols[0].DocHTML, "<p>Lines are the number of lines."; !strings.HasPrefix(got, want) {
+		t.Errorf("got DocHTML %q, want it to begin with %q", got, want)
+	}
+
+	// The API describes the documentation as Render shows it, even after
+	// rendering.
+	h, err := Render(ctx, fset, d, RenderOptions{
+		FileLinkFunc:   func(string) string { return "file" },
+		SourceLinkFunc: func(ast.Node) string { return "src" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	examplesFromHTML, symbolsFromHTML, err := godoc.Symbols(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := cmpopts.IgnoreFields(godoc.Symbol{}, "Doc", "DocHTML")
+	if diff := cmp.Diff(&godoc.API{Examples: examplesFromHTML, Symbols: symbolsFromHTML}, API(ctx, fset, d, nil), opts); diff != "" {
+		t.Errorf("API does not match the rendered documentation (-html +api):\n%s", diff)
+	}
+}
+
+func TestTrimPackageName(t *testing.T) {
+	for _, test := range []struct {
+		synopsis, name, want string
+	}{
+		{"Package json implements JSON.", "json", "Implements JSON."},
+		{"package json implements JSON.", "json", "Implements JSON."},
+		{"Package jsonx implements JSON.", "json", "Package jsonx implements JSON."},
+		{"Package json", "json", "Package json"},
+		{"Implements JSON.", "json", "Implements JSON."},
+	} {
+		if got := TrimPackageName(test.synopsis, test.name); got != test.want {
+			t.Errorf("TrimPackageName(%q, %q) = %q, want %q", test.synopsis, test.name, got, test.want)
+		}
+	}
+}
+
+func TestTruncateSynopsis(t *testing.T) {
+	for _, test := range []struct {
+		synopsis string
+		max      int
+		want     string
+	}{
+		{"Package p does things.", 100, "Package p does things."},
+		{"Package p does things.", 0, "Package p does things."},
+		{"Package p does many different things.", 20, "Package p does…"},
+		{"Package p does things; also other things.", 30, "Package p does things…"},
+		{"Package p, e.g. this one. It does things.", 30, "Package p, e.g. this one."},
+		{"Package p does ünïcödé things.", 20, "Package p does…"},
+		{"Supercalifragilistic", 10, "Superca…"},
+	} {
+		got := TruncateSynopsis(test.synopsis, test.max)
+		if got != test.want {
+			t.Errorf("TruncateSynopsis(%q, %d) = %q, want %q", test.synopsis, test.max, got, test.want)
+		}
+		if test.max > 0 && len(got) > test.max {
+			t.Errorf("TruncateSynopsis(%q, %d): got %d bytes, want at most %d", test.synopsis, test.max, len(got), test.max)
+		}
+	}
 }
 
 func TestExampleRender(t *testing.T) {
@@ -156,6 +525,25 @@ func main() {
 				<button class="Documentation-examplePlayButton" aria-label="Play Code">Play</button>
 			</div></details>`,
 		},
+		{
+			name:   "Example importing a non-standard package (no play buttons)",
+			htmlID: "example-package-ThirdParty",
+			want: `<details tabindex="-1" id="example-package-ThirdParty" class="Documentation-exampleDetails js-exampleContainer">
+<summary class="Documentation-exampleDetailsHeader">Example (ThirdParty) <a href="#example-package-ThirdParty">¶</a></summary>
+<div class="Documentation-exampleDetailsBody">
+<p>non-executable example, since it imports a package outside the standard library
+</p>
+<p>Code:</p>
+
+<pre class="Documentation-exampleCode">app := cli.NewApp()
+fmt.Println(app.Name)
+</pre>
+
+<pre class="Documentation-exampleOutput">cli
+</pre>
+</div>
+</details>`,
+		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			diff := cmp.Diff(test.want, got[test.htmlID])
@@ -166,6 +554,34 @@ func main() {
 	}
 }
 
+func TestPlayableExample(t *testing.T) {
+	for _, test := range []struct {
+		imports string
+		want    bool
+	}{
+		{``, true},
+		{`import "fmt"`, true},
+		{`import ("fmt"; "net/http")`, true},
+		{`import "example.com/pkg"`, true},
+		{`import ("fmt"; "example.com/other")`, false},
+		{`import "example.com/pkg/sub"`, false},
+	} {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "", "package main\n"+test.imports+"\nfunc main() {}\n", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ex := &doc.Example{Name: "Ex", Play: file}
+		got := playableExample(ex, "example.com/pkg").Play != nil
+		if got != test.want {
+			t.Errorf("%q: got playable %t, want %t", test.imports, got, test.want)
+		}
+		if ex.Play == nil {
+			t.Errorf("%q: playableExample modified its argument", test.imports)
+		}
+	}
+}
+
 func TestLinkHTML(t *testing.T) {
 	for _, test := range []struct {
 		name string
@@ -350,6 +766,28 @@ func testDuplicateIDs(t *testing.T, htmlDoc *html.Node) {
 	}
 }
 
+func testLinkTargets(t *testing.T, htmlDoc *html.Node) {
+	ids := map[string]bool{}
+	walk(htmlDoc, func(n *html.Node) {
+		if id := attr(n, "id"); id != "" {
+			ids[id] = true
+		}
+	})
+	walk(htmlDoc, func(n *html.Node) {
+		var target string
+		switch {
+		case n.Data == "a" && strings.HasPrefix(attr(n, "href"), "#"):
+			target = strings.TrimPrefix(attr(n, "href"), "#")
+		case n.Data == "option":
+			// Options of the mobile outline.
+			target = attr(n, "value")
+		}
+		if target != "" && !ids[target] {
+			t.Errorf("link to %q, which is not an id on the page", target)
+		}
+	})
+}
+
 func testIDsAndKinds(t *testing.T, htmlDoc *html.Node) {
 	type attrs struct {
 		ID, Kind string // export fields for cmp
@@ -360,6 +798,7 @@ func testIDsAndKinds(t *testing.T, htmlDoc *html.Node) {
 		{"C", "constant"},
 		{"CT", "constant"},
 		{"F", "function"},
+		{"M", "function"},
 		{"TF", "function"},
 		{"T.M", "method"},
 		{"V", "variable"},
@@ -426,3 +865,45 @@ func mustLoadPackage(path string) (*token.FileSet, *doc.Package) {
 
 	return fset, astPackage
 }
+
+// BenchmarkRender measures the cost of syntax highlighting by rendering the
+// documentation of a large package, encoding/json, with and without it.
+func BenchmarkRender(b *testing.B) {
+	dir := filepath.Join("..", "..", "stdlib", "testdata", "v1.12.5", "src", "encoding", "json")
+	filenames, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, fn := range filenames {
+		f, err := parser.ParseFile(fset, fn, nil, parser.ParseComments)
+		if err != nil {
+			b.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	d, err := doc.NewFromFiles(fset, files, "encoding/json")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bench := range []struct {
+		name        string
+		experiments []string
+	}{
+		{"plain", nil},
+		{"highlighted", []string{internal.ExperimentSyntaxHighlighting}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			ctx := experiment.NewContext(context.Background(), bench.experiments...)
+			for i := 0; i < b.N; i++ {
+				if _, err := Render(ctx, fset, d, RenderOptions{
+					FileLinkFunc:   func(string) string { return "file" },
+					SourceLinkFunc: func(ast.Node) string { return "src" },
+				}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package dochtml
+
+import (
+	"context"
+	"go/ast"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/pkgsite/internal/testing/htmlcheck"
+)
+
+func TestRenderGenerics(t *testing.T) {
+	fset, d := mustLoadPackage("generics")
+	rawDoc, err := Render(context.Background(), fset, d, RenderOptions{
+		FileLinkFunc:   func(string) string { return "file" },
+		SourceLinkFunc: func(ast.Node) string { return "src" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	htmlDoc, err := html.Parse(strings.NewReader(rawDoc.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name    string
+		checker htmlcheck.Checker
+	}{
+		{
+			"generic functions in index",
+			htmlcheck.In(".Documentation-indexList",
+				htmlcheck.HasText(`func Map\[S ~\[\]E, E, R any\]\(s S, f func\(E\) R\) \[\]R`),
+				htmlcheck.HasText(`func Sum\[T Number\]\(s \[\]T\) T`)),
+		},
+		{
+			"factory function of generic type in index",
+			htmlcheck.In(".Documentation-indexTypeFunctions",
+				htmlcheck.HasText(`func NewList\[T any\]\(\) \*List\[T\]`)),
+		},
+		{
+			"methods of generic types in index",
+			htmlcheck.In(".Documentation-indexTypeMethods",
+				htmlcheck.HasText(`func \(l \*List\[T\]\) Push\(v T\)`)),
+		},
+		{
+			"method of generic type",
+			htmlcheck.In("#Pair\\.First", htmlcheck.HasText(`func \(Pair\[K, _\]\) First`)),
+		},
+		{
+			"constraint link",
+			htmlcheck.In("#Sum ~ pre", htmlcheck.HasText(`^func Sum\[T Number\]`),
+				htmlcheck.In("a", htmlcheck.HasHref("#Number"))),
+		},
+		{
+			"imported constraint link",
+			htmlcheck.In("#Print ~ pre",
+				htmlcheck.In("a:nth-of-type(2)", htmlcheck.HasHref("/pkg/fmt#Stringer"))),
+		},
+		{
+			"predeclared constraint link",
+			htmlcheck.In("#Pair ~ pre",
+				htmlcheck.In("a", htmlcheck.HasHref("/pkg/builtin#comparable"))),
+		},
+		{
+			"union constraint",
+			htmlcheck.In("#Number ~ pre", htmlcheck.HasText(`~int \| ~int64 \| ~float64`)),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.checker(htmlDoc); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
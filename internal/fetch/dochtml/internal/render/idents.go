@@ -7,6 +7,7 @@ package render
 import (
 	"go/ast"
 	"go/token"
+	"regexp"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -83,6 +84,12 @@ type packageIDs struct {
 
 	// topLevelDecls is the set of all AST declarations for the this package.
 	topLevelDecls map[interface{}]bool // map[T]bool where T is *ast.FuncDecl | *ast.GenDecl | *ast.TypeSpec | *ast.ValueSpec
+
+	// imports maps the names of packages imported by this package to their
+	// import paths, for resolving doc links.
+	//
+	// E.g., imports["json"] == "encoding/json"
+	imports map[string]string // map[name]pkgPath
 }
 
 // newPackageIDs returns a packageIDs that collects all top-level identifiers
@@ -93,6 +100,10 @@ func newPackageIDs(pkg *doc.Package, related ...*doc.Package) *packageIDs {
 		impPaths:      make(map[string]string),
 		pkgIDs:        make(map[string]map[string]bool),
 		topLevelDecls: make(map[interface{}]bool),
+		imports:       make(map[string]string),
+	}
+	for _, path := range pkg.Imports {
+		pids.imports[importPathName(path)] = path
 	}
 
 	// Collect top-level declaration IDs for pkg and related packages.
@@ -318,6 +329,69 @@ type Link struct {
 var LinkTemplate = template.Must(template.New("link").Parse(
 	`<a {{with .Class}}class="{{.}}" {{end}}href="{{.Href}}">{{.Text}}</a>`))
 
+// docLinkURL returns the URL of the target of a doc link, which is the text
+// between the brackets without any leading "*". For example, "Reader.Read"
+// links to a declaration in this package, "json.Marshal" to one in an
+// imported package, "net/http.Client.Do" to one in the package with that
+// import path, and "json" or "net/http" to the package itself.
+//
+// It reports false if the target cannot be resolved.
+func (r identifierResolver) docLinkURL(target string) (string, bool) {
+	var pkg, name string
+	if i := strings.LastIndexByte(target, '/'); i >= 0 {
+		// An import path, optionally followed by a name.
+		pkg = target
+		if j := strings.IndexByte(target[i:], '.'); j >= 0 {
+			pkg, name = target[:i+j], target[i+j+1:]
+		}
+	} else if i := strings.IndexByte(target, '.'); i >= 0 && !isExported(target) {
+		// A package name followed by a name, like "json.Marshal".
+		pkg, name = target[:i], target[i+1:]
+	} else if isExported(target) {
+		name = target
+	} else {
+		// A lone lower-case name, like "json", refers to a package.
+		pkg = target
+	}
+	if name != "" && !docLinkNameRx.MatchString(name) {
+		return "", false
+	}
+	if pkg == "" || pkg == r.name {
+		if name == "" || !r.pkgIDs[r.name][name] {
+			return "", false
+		}
+		return r.toURL("", name), true
+	}
+	path := pkg
+	if !strings.Contains(pkg, "/") {
+		var ok bool
+		if path, ok = r.imports[pkg]; !ok {
+			return "", false
+		}
+	}
+	return r.toURL(path, name), true
+}
+
+// docLinkNameRx matches the name part of a doc link target: an identifier,
+// optionally qualified by a type name.
+var docLinkNameRx = regexp.MustCompile(`^` + identRx + `(\.` + identRx + `)?$`)
+
+// importPathName returns the package name usually used for path: its last
+// element, without a major version suffix.
+func importPathName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && majorVersionRx.MatchString(name) {
+		name = elems[len(elems)-2]
+	}
+	if i := strings.Index(name, ".v"); i > 0 && strings.HasPrefix(path, "gopkg.in/") {
+		name = name[:i] // E.g., "gopkg.in/yaml.v2"
+	}
+	return name
+}
+
+var majorVersionRx = regexp.MustCompile(`^v[0-9]+$`)
+
 // lookup looks up a dot-separated identifier.
 // E.g., "pkg", "pkg.Var", "Recv.Method", "Struct.Field", "pkg.Struct.Field"
 func (r identifierResolver) lookup(id string) (pkgPath, name string, ok bool) {
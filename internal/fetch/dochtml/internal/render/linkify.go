@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"go/ast"
 	"go/format"
+	"go/parser"
 	"go/printer"
 	"go/scanner"
 	"go/token"
@@ -17,6 +18,7 @@ import (
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/safehtml"
 	"github.com/google/safehtml/legacyconversions"
@@ -55,10 +57,16 @@ const (
 
 	// Regexp for RFCs.
 	rfcRx = `RFC\s+(\d{3,5})(,?\s+[Ss]ection\s+(\d+(\.\d+)*))?`
+
+	// Regexp for import paths, such as "net/http" or "golang.org/x/net/html".
+	importPathRx = `[a-zA-Z0-9_\-~]+(?:\.[a-zA-Z0-9_\-~]+)*(?:/[a-zA-Z0-9_\-~]+(?:\.[a-zA-Z0-9_\-~]+)*)*`
+
+	// Regexp for doc links, such as "[fmt.Println]" or "[*bytes.Buffer]".
+	docLinkRx = `\[\*?` + importPathRx + `\]`
 )
 
 var (
-	matchRx     = regexp.MustCompile(urlRx + `|` + rfcRx + `|` + qualIdentRx)
+	matchRx     = regexp.MustCompile(docLinkRx + `|` + urlRx + `|` + rfcRx + `|` + qualIdentRx)
 	badAnchorRx = regexp.MustCompile(`[^a-zA-Z0-9]`)
 )
 
@@ -68,10 +76,15 @@ type docData struct {
 }
 
 type docElement struct {
-	IsHeading   bool
-	IsPreformat bool
+	IsHeading    bool
+	IsPreformat  bool
+	IsList       bool
+	IsDeprecated bool // for a paragraph that begins with "Deprecated:"
 	// for paragraph and preformat
 	Body safehtml.HTML
+	// for list
+	Ordered bool
+	Items   []safehtml.HTML
 	// for heading
 	Title string
 	ID    safehtml.Identifier
@@ -86,8 +99,14 @@ var docTmpl = safetemplate.Must(safetemplate.New("").Parse(`
     </h3>
   {{else if .IsPreformat -}}
     <pre>{{.Body}}</pre>
+  {{- else if .IsList -}}
+    {{- if .Ordered -}}
+      <ol>{{range .Items}}<li>{{.}}</li>{{end}}</ol>
+    {{- else -}}
+      <ul>{{range .Items}}<li>{{.}}</li>{{end}}</ul>
+    {{- end -}}
   {{- else -}}
-    <p>{{.Body}}</p>
+    <p{{if .IsDeprecated}} class="Documentation-deprecated"{{end}}>{{.Body}}</p>
   {{- end -}}
 {{end}}`))
 
@@ -101,14 +120,20 @@ func (r *Renderer) declHTML(doc string, decl ast.Decl) (out struct{ Doc, Decl sa
 			switch blk := blk.(type) {
 			case *paragraph:
 				el.Body = r.linesToHTML(blk.lines, idr)
+				el.IsDeprecated = blk.isDeprecated()
 			case *preformat:
 				el.IsPreformat = true
-				el.Body = r.linesToHTML(blk.lines, nil)
+				el.Body = r.preformatHTML(blk.lines)
+			case *list:
+				el.IsList = true
+				el.Ordered = blk.ordered
+				for _, item := range blk.items {
+					el.Items = append(el.Items, r.linesToHTML(item, idr))
+				}
 			case *heading:
 				el.IsHeading = true
 				el.Title = blk.title
-				id := badAnchorRx.ReplaceAllString(blk.title, "_")
-				el.ID = safehtml.IdentifierFromConstantPrefix("hdr", id)
+				el.ID = safehtml.IdentifierFromConstantPrefix("hdr", r.headingID(blk.title))
 			}
 			els = append(els, el)
 		}
@@ -159,19 +184,39 @@ func (r *Renderer) codeHTML(ex *doc.Example) safehtml.HTML {
 	if err != nil {
 		log.Errorf(r.ctx, "Error converting *doc.Example into string: %v", err)
 	}
-	return codeHTML(codeStr)
+	return codeHTML(codeStr, r.highlight())
+}
+
+// CodeText formats example code as CodeHTML does, but without HTML.
+func (r *Renderer) CodeText(ex *doc.Example) string {
+	codeStr, err := r.codeString(ex)
+	if err != nil {
+		log.Errorf(r.ctx, "Error converting *doc.Example into string: %v", err)
+	}
+	var b strings.Builder
+	for _, el := range codeElements(codeStr, false) {
+		b.WriteString(el.Text)
+	}
+	return b.String()
+}
+
+// highlight reports whether Go code should be syntax highlighted.
+func (r *Renderer) highlight() bool {
+	return experiment.IsActive(r.ctx, internal.ExperimentSyntaxHighlighting)
 }
 
+// A codeElement is a piece of code. If Class is non-empty, the piece is
+// wrapped in a span of that class.
 type codeElement struct {
-	Text    string
-	Comment bool
+	Text  string
+	Class string
 }
 
 var codeTmpl = safetemplate.Must(safetemplate.New("").Parse(`
 <pre class="Documentation-exampleCode">
 {{range .}}
-  {{- if .Comment -}}
-    <span class="comment">{{.Text}}</span>
+  {{- if .Class -}}
+    <span class="{{.Class}}">{{.Text}}</span>
   {{- else -}}
     {{.Text}}
   {{- end -}}
@@ -179,7 +224,16 @@ var codeTmpl = safetemplate.Must(safetemplate.New("").Parse(`
 </pre>
 `))
 
-func codeHTML(src string) safehtml.HTML {
+// codeHTML formats the code of an example. If highlight is true, keywords
+// and literal strings and characters are put in spans, like comments always
+// are.
+func codeHTML(src string, highlight bool) safehtml.HTML {
+	return ExecuteToHTML(codeTmpl, codeElements(src, highlight))
+}
+
+// codeElements splits the code of an example into the pieces that codeHTML
+// shows, stripping the outer braces of a block and the output comment.
+func codeElements(src string, highlight bool) []codeElement {
 	var els []codeElement
 	// If code is an *ast.BlockStmt, then trim the braces.
 	var indent string
@@ -206,7 +260,7 @@ scan:
 		offset := file.Offset(p) // current offset into source file
 		prev := src[lastOffset:offset]
 		prev = strings.Replace(prev, indent, "\n", -1)
-		els = append(els, codeElement{prev, false})
+		els = append(els, codeElement{prev, ""})
 		lastOffset = offset
 		switch tok {
 		case token.EOF:
@@ -216,12 +270,17 @@ scan:
 				outputOffset = len(els)
 			}
 			lit = strings.Replace(lit, indent, "\n", -1)
-			els = append(els, codeElement{lit, true})
+			els = append(els, codeElement{lit, "comment"})
 			lastOffset += len(lit)
 		case token.STRING:
 			// Avoid replacing indents in multi-line string literals.
-			els = append(els, codeElement{lit, false})
+			els = append(els, codeElement{lit, highlightClass(tok, highlight)})
 			lastOffset += len(lit)
+		default:
+			if class := highlightClass(tok, highlight); class != "" {
+				els = append(els, codeElement{lit, class})
+				lastOffset += len(lit)
+			}
 		}
 	}
 
@@ -232,7 +291,93 @@ scan:
 	if len(els) > 0 {
 		els[len(els)-1].Text = strings.TrimRight(els[len(els)-1].Text, "\n")
 	}
-	return ExecuteToHTML(codeTmpl, els)
+	return els
+}
+
+// highlightClass returns the class of the span that a token of kind tok is
+// highlighted with, or the empty string if it isn't. Comments are handled by
+// the callers, since they are always put in spans.
+func highlightClass(tok token.Token, highlight bool) string {
+	switch {
+	case !highlight:
+		return ""
+	case tok == token.STRING || tok == token.CHAR:
+		return "string"
+	case tok.IsKeyword():
+		return "keyword"
+	}
+	return ""
+}
+
+// preformatHTML formats the lines of an indented block of a doc comment. If
+// syntax highlighting is enabled and the block is Go code, comments, keywords
+// and literal strings and characters are put in spans. Otherwise, only URLs
+// are linked.
+func (r *Renderer) preformatHTML(lines []string) safehtml.HTML {
+	src := strings.Join(lines, "\n") + "\n"
+	if !r.highlight() || !isGoSource(src) {
+		return r.linesToHTML(lines, nil)
+	}
+	var htmls []safehtml.HTML
+	var lastOffset int
+	var s scanner.Scanner
+	file := token.NewFileSet().AddFile("", -1, len(src))
+	s.Init(file, []byte(src), nil, scanner.ScanComments)
+	for {
+		p, tok, lit := s.Scan()
+		offset := file.Offset(p)
+		htmls = append(htmls, safehtml.HTMLEscaped(src[lastOffset:offset]))
+		lastOffset = offset
+		if tok == token.EOF {
+			break
+		}
+		switch class := highlightClass(tok, true); {
+		case tok == token.COMMENT:
+			htmls = append(htmls,
+				safetemplate.MustParseAndExecuteToHTML(`<span class="comment">`),
+				r.formatLineHTML(lit, nil),
+				safetemplate.MustParseAndExecuteToHTML(`</span>`))
+			lastOffset += len(lit)
+		case class != "":
+			htmls = append(htmls, ExecuteToHTML(spanTmpl, codeElement{lit, class}))
+			lastOffset += len(lit)
+		}
+	}
+	return safehtml.HTMLConcat(htmls...)
+}
+
+var spanTmpl = safetemplate.Must(safetemplate.New("").Parse(`<span class="{{.Class}}">{{.Text}}</span>`))
+
+// isGoSource reports whether src is a Go file without a package clause, a
+// list of statements or an expression. Indented blocks of doc comments are
+// often shell commands or program output, which should not be highlighted.
+func isGoSource(src string) bool {
+	fset := token.NewFileSet()
+	if _, err := parser.ParseFile(fset, "", "package p\n"+src, parser.ParseComments); err == nil {
+		return true
+	}
+	if _, err := parser.ParseFile(fset, "", "package p\nfunc _() {\n"+src+"\n}", parser.ParseComments); err == nil {
+		return true
+	}
+	_, err := parser.ParseExpr(src)
+	return err == nil
+}
+
+// headingID returns the ID of a heading with the given title, without its
+// "hdr-" prefix. The title is sanitized, so different titles may have the same
+// ID; the first heading on the page with that ID keeps it, and later ones get
+// a suffix of "-1", "-2" and so on. Since the IDs are assigned in document
+// order, they are the same every time a package is rendered.
+func (r *Renderer) headingID(title string) string {
+	id := badAnchorRx.ReplaceAllString(title, "_")
+	n := r.headingIDs[id]
+	r.headingIDs[id]++
+	if n > 0 {
+		// Sanitized titles never contain "-", so this can't collide with
+		// another heading.
+		id = fmt.Sprintf("%s-%d", id, n)
+	}
+	return id
 }
 
 // formatLineHTML formats the line as HTML-annotated text.
@@ -274,6 +419,23 @@ func (r *Renderer) formatLineHTML(line string, idr *identifierResolver) safehtml
 			// TODO: Should we provide hotlinks for related packages?
 
 			switch {
+			case strings.HasPrefix(word, "["):
+				// A doc link, like [fmt.Println]. Unlike identifiers, these
+				// are linked even when hotlinking is disabled, since the
+				// author asked for them.
+				target := strings.TrimSuffix(strings.TrimPrefix(word, "["), "]")
+				var (
+					url string
+					ok  bool
+				)
+				if idr != nil && validDocLinkBoundary(lastChar, nextChar) {
+					url, ok = idr.docLinkURL(strings.TrimPrefix(target, "*"))
+				}
+				if ok {
+					addLink(url, target)
+				} else {
+					htmls = append(htmls, safehtml.HTMLEscaped(word))
+				}
 			case strings.Contains(word, "://"):
 				// Forbid closing brackets without prior opening brackets.
 				// See https://golang.org/issue/22285.
@@ -318,12 +480,24 @@ func (r *Renderer) formatLineHTML(line string, idr *identifierResolver) safehtml
 				htmls = append(htmls, safehtml.HTMLEscaped(word))
 			}
 			numQuotes += countQuotes(word)
+			lastChar = line[m1-1]
 		}
 		line = line[m1:]
 	}
 	return safehtml.HTMLConcat(htmls...)
 }
 
+// validDocLinkBoundary reports whether a doc link may be preceded by before
+// and followed by after. A zero byte means the start or end of the line.
+// Doc links must not be part of a larger word, and "[text]:" at the start of a
+// line is a link definition, not a doc link.
+func validDocLinkBoundary(before, after byte) bool {
+	isWord := func(c byte) bool {
+		return c == '_' || c >= utf8.RuneSelf || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+	}
+	return !isWord(before) && !isWord(after) && !(before == 0 && after == ':')
+}
+
 func ExecuteToHTML(tmpl *safetemplate.Template, data interface{}) safehtml.HTML {
 	h, err := tmpl.ExecuteToHTML(data)
 	if err != nil {
@@ -361,17 +535,9 @@ func (r *Renderer) formatDeclHTML(decl ast.Decl, idr *identifierResolver) safeht
 		return true
 	})
 
-	// Trim large string literals and slices.
-	v := &declVisitor{}
-	ast.Walk(v, decl)
-
-	// Format decl as Go source code file.
-	var b bytes.Buffer
-	p := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 4}
-	p.Fprint(&b, r.fset, &printer.CommentedNode{Node: decl, Comments: v.Comments})
-	src := b.Bytes()
+	src := r.formatDecl(decl)
 	fset := token.NewFileSet()
-	file := fset.AddFile("", fset.Base(), b.Len())
+	file := fset.AddFile("", fset.Base(), len(src))
 
 	// anchorLines is a list of anchor IDs that should be placed for each line.
 	// lineTypes is a list of the type (e.g., comment or code) of each line.
@@ -411,8 +577,12 @@ scan:
 			break scan
 		case token.COMMENT:
 			tokType = commentType
+			open := safetemplate.MustParseAndExecuteToHTML(`<span class="comment">`)
+			if isDeprecatedComment(lit) {
+				open = safetemplate.MustParseAndExecuteToHTML(`<span class="comment Documentation-deprecated">`)
+			}
 			htmlLines[line] = append(htmlLines[line],
-				safetemplate.MustParseAndExecuteToHTML(`<span class="comment">`),
+				open,
 				r.formatLineHTML(lit, idr),
 				safetemplate.MustParseAndExecuteToHTML(`</span>`))
 			lastOffset += len(lit)
@@ -464,6 +634,19 @@ scan:
 	return safehtml.HTMLConcat(htmls...)
 }
 
+// formatDecl formats decl as Go source code, with large string literals and
+// slices trimmed. It leaves decl unchanged.
+func (r *Renderer) formatDecl(decl ast.Decl) []byte {
+	v := &declVisitor{}
+	ast.Walk(v, decl)
+	defer v.undo()
+
+	var b bytes.Buffer
+	p := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 4}
+	p.Fprint(&b, r.fset, &printer.CommentedNode{Node: decl, Comments: v.Comments})
+	return b.Bytes()
+}
+
 var anchorTemplate = safetemplate.Must(safetemplate.New("anchor").Parse(`<span id="{{.ID}}" data-kind="{{.Kind}}"></span>`))
 
 // declVisitor is used to walk over the AST and trim large string
@@ -472,6 +655,15 @@ var anchorTemplate = safetemplate.Must(safetemplate.New("anchor").Parse(`<span i
 // original code is not displayed.
 type declVisitor struct {
 	Comments []*ast.CommentGroup
+	// undos restore the trimmed nodes.
+	undos []func()
+}
+
+// undo restores the nodes that v trimmed.
+func (v *declVisitor) undo() {
+	for _, f := range v.undos {
+		f()
+	}
 }
 
 // Visit implements ast.Visitor.
@@ -484,6 +676,8 @@ func (v *declVisitor) Visit(n ast.Node) ast.Visitor {
 					Slash: n.Pos(),
 					Text:  stringBasicLitSize(n.Value),
 				}}})
+			value := n.Value
+			v.undos = append(v.undos, func() { n.Value = value })
 			n.Value = `""`
 		}
 	case *ast.CompositeLit:
@@ -493,6 +687,8 @@ func (v *declVisitor) Visit(n ast.Node) ast.Visitor {
 					Slash: n.Lbrace,
 					Text:  fmt.Sprintf("/* %d elements not displayed */", len(n.Elts)),
 				}}})
+			elts := n.Elts
+			v.undos = append(v.undos, func() { n.Elts = elts })
 			n.Elts = n.Elts[:0]
 		}
 	}
@@ -630,6 +826,10 @@ func generateAnchorLinks(idr *identifierResolver, decl ast.Decl) map[*ast.Ident]
 					}
 				}
 			}
+			// The selector of any other expression, like the "int" of
+			// "C.int" in a cgo package, is not a top-level or predeclared
+			// identifier.
+			ignore[node.Sel] = true
 		case *ast.Ident:
 			if node.Obj == nil && doc.IsPredeclared(node.Name) {
 				m[node] = idr.toURL("builtin", node.Name)
@@ -9,6 +9,7 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -83,6 +84,15 @@ TLSUnique contains the tls-unique channel binding value (see RFC
 			name: "quoted strings",
 			doc:  `Bar returns the string "bar".`,
 			want: `<p>Bar returns the string &#34;bar&#34;.
+</p>`,
+		},
+		{
+			name: "deprecation notice is styled",
+			doc: `Old does nothing.
+
+Deprecated: use New instead.`,
+			want: `<p>Old does nothing.
+</p><p class="Documentation-deprecated">Deprecated: use New instead.
 </p>`,
 		},
 		{
@@ -103,6 +113,117 @@ TLSUnique contains the tls-unique channel binding value (see RFC
 	}
 }
 
+func TestHeadingIDs(t *testing.T) {
+	// "Café" and "Cafè" are sanitized to the same ID, as are the
+	// repeated headings in the two doc comments.
+	docs := []string{
+		"Café\n\nText.\n\nCafè\n\nText.\n\nUsage\n\nText.",
+		"Usage\n\nText.",
+	}
+	want := []string{"hdr-Caf_", "hdr-Caf_-1", "hdr-Usage", "hdr-Usage-1"}
+	headingRx := regexp.MustCompile(`<h3 id="([^"]*)">`)
+	render := func() []string {
+		r := New(context.Background(), nil, pkgTime, nil)
+		var ids []string
+		for _, d := range docs {
+			for _, m := range headingRx.FindAllStringSubmatch(r.declHTML(d, nil).Doc.String(), -1) {
+				ids = append(ids, m[1])
+			}
+		}
+		return ids
+	}
+	got := render()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("heading IDs mismatch (-want +got)\n%s", diff)
+	}
+	// Rendering again must produce the same IDs.
+	if diff := cmp.Diff(got, render()); diff != "" {
+		t.Errorf("heading IDs are not deterministic (-first +second)\n%s", diff)
+	}
+}
+
+func TestDocHTMLDocLinks(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{
+			name: "local declaration",
+			doc:  `See [File] and [File.Name].`,
+			want: `<p>See <a href="#File">File</a> and <a href="#File.Name">File.Name</a>.
+</p>`,
+		},
+		{
+			name: "pointer and package-qualified local declaration",
+			doc:  `Returns a [*os.File].`,
+			want: `<p>Returns a <a href="#File">*os.File</a>.
+</p>`,
+		},
+		{
+			name: "imported package",
+			doc:  `Like [time.Duration.String], see [errors].`,
+			want: `<p>Like <a href="/time#Duration.String">time.Duration.String</a>, see <a href="/errors">errors</a>.
+</p>`,
+		},
+		{
+			name: "import path",
+			doc:  `Use [net/http.Client.Do] or [golang.org/x/net/html].`,
+			want: `<p>Use <a href="/net/http#Client.Do">net/http.Client.Do</a> or <a href="/golang.org/x/net/html">golang.org/x/net/html</a>.
+</p>`,
+		},
+		{
+			name: "unresolvable links are plain text",
+			doc:  `Not [Nope], [fmt.Println] or [a b].`,
+			want: `<p>Not [Nope], [fmt.Println] or [a b].
+</p>`,
+		},
+		{
+			name: "brackets inside words are not links",
+			doc:  `Index with x[File] or [File]s.`,
+			want: `<p>Index with x[File] or [File]s.
+</p>`,
+		},
+		{
+			name: "heading",
+			doc: `# Files and [File]s
+
+Text.`,
+			want: `<h3 id="hdr-Files_and__File_s">Files and [File]s<a href="#hdr-Files_and__File_s">¶</a></h3>
+  <p>Text.
+</p>`,
+		},
+		{
+			name: "lists",
+			doc: `Kinds:
+  - a [File]
+  - a directory,
+    which holds files
+
+Steps:
+  1. open
+  2. close`,
+			want: `<p>Kinds:
+</p><ul><li>a <a href="#File">File</a>
+</li><li>a directory,
+which holds files
+</li></ul><p>Steps:
+</p><ol><li>open
+</li><li>close
+</li></ol>`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := New(context.Background(), nil, pkgOS, &Options{DisableHotlinking: true})
+			got := r.declHTML(test.doc, nil).Doc
+			want := testconversions.MakeHTMLForTest(test.want)
+			if diff := cmp.Diff(want, got, cmp.AllowUnexported(safehtml.HTML{})); diff != "" {
+				t.Errorf("r.declHTML() mismatch (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestDeclHTML(t *testing.T) {
 	for _, test := range []struct {
 		name   string
@@ -270,7 +391,7 @@ b := 1
 `,
 		},
 	} {
-		out := codeHTML(test.in)
+		out := codeHTML(test.in, false)
 		got := strings.TrimSpace(string(out.String()))
 		want := strings.TrimSpace(test.want)
 		if got != want {
@@ -279,6 +400,66 @@ b := 1
 	}
 }
 
+func TestCodeHTMLHighlight(t *testing.T) {
+	in := "for _, s := range []string{\"a\", `b\n  c`} {\n\tfmt.Println(s, 'x') // print\n}\n"
+	want := `<pre class="Documentation-exampleCode">
+<span class="keyword">for</span> _, s := <span class="keyword">range</span> []string{<span class="string">&#34;a&#34;</span>, <span class="string">` + "`b\n  c`" + `</span>} {
+	fmt.Println(s, <span class="string">&#39;x&#39;</span>) <span class="comment">// print</span>
+}
+</pre>`
+	got := strings.TrimSpace(codeHTML(in, true).String())
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got)\n%s", diff)
+	}
+	if got, want := stripTags(got), stripTags(strings.TrimSpace(codeHTML(in, false).String())); got != want {
+		t.Errorf("highlighting changed the text:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPreformatHighlight(t *testing.T) {
+	for _, test := range []struct {
+		name, doc, want string
+	}{
+		{
+			name: "statements",
+			doc:  "Use it like this:\n\n\tif err := f(\"x\"); err != nil {\n\t\treturn err // see https://go.dev\n\t}\n",
+			want: `<pre><span class="keyword">if</span> err := f(<span class="string">&#34;x&#34;</span>); err != nil {
+	<span class="keyword">return</span> err <span class="comment">// see <a href="https://go.dev">https://go.dev</a></span>
+}
+</pre>`,
+		},
+		{
+			name: "declaration",
+			doc:  "For example:\n\n\ttype T struct{}\n",
+			want: `<pre><span class="keyword">type</span> T <span class="keyword">struct</span>{}
+</pre>`,
+		},
+		{
+			name: "not Go",
+			doc:  "Install it with:\n\n\tgo get example.com/m@latest\n",
+			want: `<pre>go get example.com/m@latest
+</pre>`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := experiment.NewContext(context.Background(), internal.ExperimentSyntaxHighlighting)
+			r := New(ctx, nil, pkgTime, nil)
+			got := r.declHTML(test.doc, nil).Doc.String()
+			got = got[strings.Index(got, "<pre>"):]
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+var tagRx = regexp.MustCompile(`<[^>]*>`)
+
+// stripTags removes the HTML tags from s.
+func stripTags(s string) string {
+	return tagRx.ReplaceAllString(s, "")
+}
+
 func mustParse(t *testing.T, fset *token.FileSet, filename, src string) *ast.File {
 	t.Helper()
 	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
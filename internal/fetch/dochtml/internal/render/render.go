@@ -27,6 +27,12 @@ var (
 
 	headingRx = regexp.MustCompile(headingHead + headingBody + headingTail)
 
+	// Regexp for the explicit heading syntax, "# Heading".
+	hashHeadingRx = regexp.MustCompile(`^#[ \t]+(\S.*)$`)
+
+	// Regexp for list item markers, such as "-", "*" or "1.".
+	listMarkerRx = regexp.MustCompile(`^([-*+•]|[0-9]+[.)])[ \t]+`)
+
 	// Regexp for example outputs.
 	exampleOutputRx = regexp.MustCompile(`(?i)//[[:space:]]*(unordered )?output:`)
 )
@@ -38,6 +44,8 @@ type Renderer struct {
 	disableHotlinking bool
 	disablePermalinks bool
 	ctx               context.Context
+	// headingIDs counts the headings rendered so far, by sanitized title.
+	headingIDs map[string]int
 }
 
 type Options struct {
@@ -88,6 +96,7 @@ func New(ctx context.Context, fset *token.FileSet, pkg *doc.Package, opts *Optio
 		disableHotlinking: disableHotlinking,
 		disablePermalinks: disablePermalinks,
 		ctx:               ctx,
+		headingIDs:        map[string]int{},
 	}
 }
 
@@ -113,7 +122,8 @@ func (r *Renderer) Synopsis(n ast.Node) string {
 // letter, and contains no punctuation is formatted as a heading.
 //
 // A span of indented lines is converted into a <pre> block, with the common
-// indent prefix removed.
+// indent prefix removed. If syntax highlighting is enabled and the block is
+// Go code, it is highlighted like the code of examples.
 //
 // URLs in the comment text are converted into links. Any word that matches
 // an exported top-level identifier in the package is automatically converted
@@ -125,6 +135,15 @@ func (r *Renderer) Synopsis(n ast.Node) string {
 //	<h3 id="hdr-XXX">  elements for headings with the "id" attribute
 //	<a href="XXX">     elements for URL hyperlinks
 //
+// Go 1.19 doc comment syntax is also supported: "# Heading" lines become
+// headings, indented lines that begin with a list marker like "-" or "1."
+// become <ul> or <ol> lists, and doc links like [fmt.Println] or [Reader]
+// become links to the declarations they name. Doc links that cannot be
+// resolved are left as plain text.
+//
+// Paragraphs that begin with "Deprecated:" have the class
+// "Documentation-deprecated".
+//
 // DocHTML is intended for documentation for the package and examples.
 func (r *Renderer) DocHTML(doc string) safehtml.HTML {
 	return r.declHTML(doc, nil).Doc
@@ -141,6 +160,9 @@ func (r *Renderer) DocHTML(doc string) safehtml.HTML {
 //	<span class="comment">      elements for every Go comment
 //	<a href="XXX">              elements for URL hyperlinks
 //
+// Go comments that begin with "Deprecated:", such as those on struct fields,
+// also have the class "Documentation-deprecated".
+//
 // DeclHTML is intended for top-level package declarations.
 func (r *Renderer) DeclHTML(doc string, decl ast.Decl) (out struct{ Doc, Decl safehtml.HTML }) {
 	// This returns an anonymous struct instead of multiple return values since
@@ -158,13 +180,22 @@ func (r *Renderer) DeclHTML(doc string, decl ast.Decl) (out struct{ Doc, Decl sa
 // This returns formatted HTML with:
 //	<pre>                   element wrapping entire block
 //	<span class="comment">  elements for every Go comment
+//	<span class="keyword">  elements for keywords, if syntax highlighting is enabled
+//	<span class="string">   elements for string and character literals, if syntax
+//	                        highlighting is enabled
 //
 // CodeHTML is intended for use with example code snippets.
 func (r *Renderer) CodeHTML(ex *doc.Example) safehtml.HTML {
 	return r.codeHTML(ex)
 }
 
-// block is (*heading | *paragraph | *preformat).
+// DeclText formats decl as Go source code, as DeclHTML does but without
+// HTML.
+func (r *Renderer) DeclText(decl ast.Decl) string {
+	return string(r.formatDecl(decl))
+}
+
+// block is (*heading | *paragraph | *preformat | *list).
 type block interface{}
 
 type (
@@ -178,6 +209,10 @@ type (
 	preformat struct {
 		lines lines
 	}
+	list struct {
+		ordered bool
+		items   []lines
+	}
 )
 
 func docToBlocks(doc string) []block {
@@ -215,7 +250,14 @@ func docToBlocks(doc string) []block {
 		_, wasHeading := lastBlk.(*heading)
 		switch {
 		case indentLength(group[0]) > 0:
-			blks = append(blks, &preformat{unindent(group)})
+			group = unindent(group)
+			if listMarkerRx.MatchString(group[0]) {
+				blks = append(blks, newList(group))
+			} else {
+				blks = append(blks, &preformat{group})
+			}
+		case len(group) == 1 && hashHeadingRx.MatchString(group[0]):
+			blks = append(blks, &heading{strings.TrimSpace(hashHeadingRx.FindStringSubmatch(group[0])[1])})
 		case !wasHeading && len(group) == 1 && headingRx.MatchString(group[0]) && willParagraph:
 			blks = append(blks, &heading{group[0]})
 		default:
@@ -226,6 +268,53 @@ func docToBlocks(doc string) []block {
 	return blks
 }
 
+// deprecatedPrefix begins a paragraph that says an identifier or package
+// is deprecated.
+const deprecatedPrefix = "Deprecated:"
+
+// isDeprecated reports whether p is a deprecation notice.
+func (p *paragraph) isDeprecated() bool {
+	return strings.HasPrefix(p.lines[0], deprecatedPrefix)
+}
+
+// isDeprecatedComment reports whether the Go comment c, as written in a
+// declaration, is a deprecation notice.
+func isDeprecatedComment(c string) bool {
+	c = strings.TrimPrefix(c, "//")
+	c = strings.TrimPrefix(c, "/*")
+	return strings.HasPrefix(strings.TrimSpace(c), deprecatedPrefix)
+}
+
+// IsDeprecated reports whether doc has a paragraph that begins with
+// "Deprecated:", the convention for marking an identifier or package as
+// deprecated.
+func IsDeprecated(doc string) bool {
+	for _, blk := range docToBlocks(doc) {
+		if p, ok := blk.(*paragraph); ok && p.isDeprecated() {
+			return true
+		}
+	}
+	return false
+}
+
+// newList returns the list made of the indented lines ls, the first of which
+// begins with a list marker. Each line that begins with a marker starts a new
+// item, and other lines continue the current one.
+func newList(ls []string) *list {
+	l := &list{ordered: ls[0][0] >= '0' && ls[0][0] <= '9'}
+	for _, line := range ls {
+		if m := listMarkerRx.FindString(line); m != "" {
+			l.items = append(l.items, lines{line[len(m):]})
+			continue
+		}
+		if line = trimIndent(line); line != "" {
+			last := len(l.items) - 1
+			l.items[last] = append(l.items[last], line)
+		}
+	}
+	return l
+}
+
 func indentLength(s string) int {
 	return len(s) - len(trimIndent(s))
 }
@@ -180,6 +180,25 @@ func TestDocToBlocks(t *testing.T) {
 			&preformat{lines{"BenchmarkHello    10000000    282 ns/op"}},
 			&paragraph{lines{"means that the loop ran 10000000 times at a speed of 282 ns per loop."}},
 		},
+	}, {
+		in: `
+			# Overview
+
+			Options:
+			  - fast,
+			    maybe
+			  - slow
+
+			Steps:
+			  1) one
+			  2) two`,
+		want: []block{
+			&heading{"Overview"},
+			&paragraph{lines{"Options:"}},
+			&list{items: []lines{{"fast,", "maybe"}, {"slow"}}},
+			&paragraph{lines{"Steps:"}},
+			&list{ordered: true, items: []lines{{"one"}, {"two"}}},
+		},
 	}}
 
 	for i, tt := range tests {
@@ -189,3 +208,22 @@ func TestDocToBlocks(t *testing.T) {
 		}
 	}
 }
+
+func TestIsDeprecated(t *testing.T) {
+	for _, test := range []struct {
+		doc  string
+		want bool
+	}{
+		{"", false},
+		{"F does things.", false},
+		{"Deprecated: use G.", true},
+		{"F does things.\n\nDeprecated: use G.\n", true},
+		{"F does things.\nDeprecated: in the same paragraph.\n", false},
+		{"F does things.\n\n\tDeprecated: in a code block.\n", false},
+		{"F reports whether x is Deprecated: it is not.", false},
+	} {
+		if got := IsDeprecated(test.doc); got != test.want {
+			t.Errorf("IsDeprecated(%q) = %t, want %t", test.doc, got, test.want)
+		}
+	}
+}
@@ -75,18 +75,20 @@ func oneLineNodeDepth(fset *token.FileSet, node ast.Node, depth int) string {
 		if len(recv) > 0 {
 			recv = "(" + recv + ") "
 		}
+		tparams := oneLineTypeParams(fset, funcTypeParams(n.Type), depth)
 		fnc := oneLineNodeDepth(fset, n.Type, depth)
 		if strings.Index(fnc, "func") == 0 {
 			fnc = fnc[4:]
 		}
-		return fmt.Sprintf("func %s%s%s", recv, name, fnc)
+		return fmt.Sprintf("func %s%s%s%s", recv, name, tparams, fnc)
 
 	case *ast.TypeSpec:
 		sep := " "
 		if n.Assign.IsValid() {
 			sep = " = "
 		}
-		return fmt.Sprintf("type %s%s%s", n.Name.Name, sep, oneLineNodeDepth(fset, n.Type, depth))
+		tparams := oneLineTypeParams(fset, typeSpecParams(n), depth)
+		return fmt.Sprintf("type %s%s%s%s", n.Name.Name, tparams, sep, oneLineNodeDepth(fset, n.Type, depth))
 
 	case *ast.FuncType:
 		var params []string
@@ -194,6 +196,20 @@ func oneLineField(fset *token.FileSet, field *ast.Field, depth int) string {
 	return joinStrings(names) + " " + oneLineNodeDepth(fset, field.Type, depth)
 }
 
+// oneLineTypeParams returns a one-line summary of the type parameter list
+// tparams, including the enclosing brackets. If the list is too long, it is
+// truncated inside the brackets, so that they always balance.
+func oneLineTypeParams(fset *token.FileSet, tparams *ast.FieldList, depth int) string {
+	if tparams == nil || len(tparams.List) == 0 {
+		return ""
+	}
+	var params []string
+	for _, field := range tparams.List {
+		params = append(params, oneLineField(fset, field, depth))
+	}
+	return "[" + joinStrings(params) + "]"
+}
+
 // joinStrings formats the input as a comma-separated list,
 // but truncates the list at some reasonable length if necessary.
 func joinStrings(ss []string) string {
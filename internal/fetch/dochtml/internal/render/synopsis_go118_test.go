@@ -0,0 +1,58 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package render
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestOneLineNodeGenerics(t *testing.T) {
+	src := `
+		package generics
+
+		func Sum[T Number](s []T) T { return 0 }
+
+		func Map[S ~[]E, E, R any](s S, f func(E) R) []R { return nil }
+
+		func Long[AAAAAAAAAA, BBBBBBBBBB, CCCCCCCCCC, DDDDDDDDDD, EEEEEEEEEE, FFFFFFFFFF, GGGGGGGGGG any]() {}
+
+		func (l *List[T]) Push(v T) {}
+
+		func (p Pair[K, _]) First() K { return p.Key }
+
+		type List[T any] struct{ next *List[T] }
+
+		type Number interface{ ~int | ~float64 }
+
+		type Pair[K comparable, V int | string] struct{}
+	`
+	want := []string{
+		`func Sum[T Number](s []T) T`,
+		`func Map[S ~[]E, E, R any](s S, f func(E) R) []R`,
+		`func Long[...]()`,
+		`func (l *List[T]) Push(v T)`,
+		`func (p Pair[K, _]) First() K`,
+		`type List[T any] struct{ ... }`,
+		`type Number interface{ ... }`,
+		`type Pair[K comparable, V int | string] struct{}`,
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, d := range f.Decls {
+		got := oneLineNodeDepth(fset, d, 0)
+		if got != want[i] {
+			t.Errorf("test %d, oneLineNode():\ngot  %s\nwant %s", i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package render
+
+import "go/ast"
+
+// funcTypeParams returns the type parameter list of t, or nil.
+func funcTypeParams(t *ast.FuncType) *ast.FieldList {
+	return t.TypeParams
+}
+
+// typeSpecParams returns the type parameter list of s, or nil.
+func typeSpecParams(s *ast.TypeSpec) *ast.FieldList {
+	return s.TypeParams
+}
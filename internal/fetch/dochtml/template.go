@@ -5,6 +5,7 @@
 package dochtml
 
 import (
+	"go/ast"
 	"reflect"
 
 	"github.com/google/safehtml/template"
@@ -13,8 +14,6 @@ import (
 )
 
 // htmlPackage is the template used to render documentation HTML.
-// TODO(golang.org/issue/5060): finalize URL scheme and design for notes,
-// then it becomes more viable to factor out inline CSS style.
 var htmlPackage = template.Must(template.New("package").Funcs(
 	map[string]interface{}{
 		"ternary": func(q, a, b interface{}) interface{} {
@@ -32,8 +31,11 @@ var htmlPackage = template.Must(template.New("package").Funcs(
 		"render_code":           (*render.Renderer)(nil).CodeHTML,
 		"file_link":             func() string { return "" },
 		"source_link":           func() string { return "" },
+		"note_link":             func(*doc.Note) string { return "" },
+		"decl_source":           func(ast.Decl) string { return "" },
 		"play_url":              func(*doc.Example) string { return "" },
 		"safe_id":               render.SafeGoID,
+		"is_deprecated":         render.IsDeprecated,
 	},
 ).Parse(`{{- "" -}}
 {{- if or .Doc .Consts .Vars .Funcs .Types .Examples.List -}}
@@ -66,6 +68,18 @@ var htmlPackage = template.Must(template.New("package").Funcs(
 					<a href="#pkg-overview" role="treeitem" aria-level="1" tabindex="0">Overview</a>
 				</li>
 			{{end}}
+			{{if .Notes}}
+				<li class="DocNav-notes" role="none">
+					<span class="DocNav-groupLabel" role="treeitem" aria-expanded="true" aria-level="1" aria-owns="nav-group-notes" tabindex="-1">Notes</span>
+					<ul role="group" id="nav-group-notes">
+						{{range $marker, $item := .Notes}}
+							<li role="none">
+								<a href="#pkg-note-{{$marker}}" role="treeitem" aria-level="2" tabindex="-1">{{$marker}}s</a>
+							</li>
+						{{end}}
+					</ul>
+				</li>
+			{{end}}
 			{{if .Examples.List}}
 				<li class="DocNav-examples" role="none">
 					<a href="#pkg-examples" role="treeitem" aria-level="1" tabindex="-1">Examples</a>
@@ -127,19 +141,6 @@ var htmlPackage = template.Must(template.New("package").Funcs(
 				</li>
 			{{end}}
 
-			{{if .Notes}}
-				<li class="DocNav-notes" role="none">
-					<span class="DocNav-groupLabel" role="treeitem" aria-expanded="true" aria-level="1" aria-owns="nav-group-notes" tabindex="-1">Notes</span>
-					<ul role="group" id="nav-group-notes">
-						{{range $marker, $item := .Notes}}
-							<li role="none">
-								<a href="#pkg-note-{{$marker}}" role="treeitem" aria-level="2" tabindex="-1">{{$marker}}s</a>
-							</li>
-						{{end}}
-					</ul>
-				</li>
-			{{end}}
-
 			{{if .Filenames}}
 				<li class="DocNav-files" role="none">
 					<a href="#pkg-files" role="treeitem" aria-level="1" tabindex="-1">Package Files</a>
@@ -159,6 +160,13 @@ var htmlPackage = template.Must(template.New("package").Funcs(
 			{{if or .Doc (index .Examples.Map "")}}
 				<option value="pkg-overview">Overview</option>
 			{{end}}
+			{{if .Notes}}
+				<optgroup label="Notes">
+					{{range $marker, $item := .Notes}}
+						<option value="pkg-note-{{$marker}}">{{$marker}}s</option>
+					{{end}}
+				</optgroup>
+			{{end}}
 			{{if .Examples.List}}
 				<option value="pkg-examples">Examples</option>
 			{{end}}
@@ -191,14 +199,6 @@ var htmlPackage = template.Must(template.New("package").Funcs(
 					{{end}} {{/* range .Types */}}
 				</optgroup>
 			{{end}}
-
-			{{if .Notes}}
-				<optgroup label="Notes">
-					{{range $marker, $item := .Notes}}
-						<option value="pkg-note-{{$marker}}">{{$marker}}s</option>
-					{{end}}
-				</optgroup>
-			{{end}}
 		</select>
 	</nav>
 {{end}}
@@ -213,6 +213,26 @@ var htmlPackage = template.Must(template.New("package").Funcs(
 	</section>
 {{- end -}}
 
+{{- if .Notes -}}
+	<section class="Documentation-notes">
+		{{- range $marker, $content := .Notes -}}
+		<div class="Documentation-note">
+			<h2 tabindex="-1" id="{{index $.NoteIDs $marker}}" class="Documentation-noteHeader">{{$marker}}s <a href="#pkg-note-{{$marker}}">¶</a></h2>
+			<ul class="Documentation-noteList">{{"\n" -}}
+			{{- range $v := $content -}}
+				<li>{{render_doc $v.Body}}<span class="Documentation-noteSource">{{note_link $v}}</span></li>{{"\n" -}}
+			{{- end -}}
+			</ul>{{"\n" -}}
+		</div>
+		{{- end -}}
+	</section>
+{{- end -}}
+
+{{- if .Collapsed -}}
+	<p class="Documentation-collapsed">This package's documentation is too large to show in full, so only
+	a summary of each declaration is shown. <a href="?tab=doc&full=1">Show the full documentation</a>.</p>{{"\n" -}}
+{{- end -}}
+
 {{- if or .Consts .Vars .Funcs .Types .Examples.List -}}
 	<section class="Documentation-index">
 		<h2 id="pkg-index" class="Documentation-indexHeader">Index <a href="#pkg-index">¶</a></h2>{{"\n\n" -}}
@@ -221,22 +241,22 @@ var htmlPackage = template.Must(template.New("package").Funcs(
 			{{- if .Vars -}}<li class="Documentation-indexVariables"><a href="#pkg-variables">Variables</a></li>{{"\n"}}{{- end -}}
 
 			{{- range .Funcs -}}
-			<li class="Documentation-indexFunction">
+			<li class="Documentation-indexFunction{{if is_deprecated .Doc}} Documentation-indexDeprecated{{end}}">
 				<a href="#{{.Name}}">{{render_synopsis .Decl}}</a>
 			</li>{{"\n"}}
 			{{- end -}}
 
 			{{- range .Types -}}
 				{{- $tname := .Name -}}
-				<li class="Documentation-indexType"><a href="#{{$tname}}">type {{$tname}}</a></li>{{"\n"}}
+				<li class="Documentation-indexType{{if is_deprecated .Doc}} Documentation-indexDeprecated{{end}}"><a href="#{{$tname}}">type {{$tname}}</a></li>{{"\n"}}
 				{{- with .Funcs -}}
 					<li><ul class="Documentation-indexTypeFunctions">{{"\n" -}}
-					{{range .}}<li><a href="#{{.Name}}">{{render_synopsis .Decl}}</a></li>{{"\n"}}{{end}}
+					{{range .}}<li{{if is_deprecated .Doc}} class="Documentation-indexDeprecated"{{end}}><a href="#{{.Name}}">{{render_synopsis .Decl}}</a></li>{{"\n"}}{{end}}
 					</ul></li>{{"\n" -}}
 				{{- end -}}
 				{{- with .Methods -}}
 					<li><ul class="Documentation-indexTypeMethods">{{"\n" -}}
-					{{range .}}<li><a href="#{{$tname}}.{{.Name}}">{{render_synopsis .Decl}}</a></li>{{"\n"}}{{end}}
+					{{range .}}<li{{if is_deprecated .Doc}} class="Documentation-indexDeprecated"{{end}}><a href="#{{$tname}}.{{.Name}}">{{render_synopsis .Decl}}</a></li>{{"\n"}}{{end}}
 					</ul></li>{{"\n" -}}
 				{{- end -}}
 			{{- end -}}
@@ -292,6 +312,7 @@ var htmlPackage = template.Must(template.New("package").Funcs(
 			{{- $out.Decl -}}
 			{{- $out.Doc -}}
 			{{"\n"}}
+			{{- template "decl_source" .Decl -}}
 			{{- template "example" (index $.Examples.Map .Name) -}}
 		</div>
 		{{- end -}}
@@ -337,6 +358,7 @@ var htmlPackage = template.Must(template.New("package").Funcs(
 				{{- $out.Decl -}}
 				{{- $out.Doc -}}
 				{{"\n"}}
+				{{- template "decl_source" .Decl -}}
 				{{- template "example" (index $.Examples.Map .Name) -}}
 			</div>
 			{{- end -}}
@@ -350,6 +372,7 @@ var htmlPackage = template.Must(template.New("package").Funcs(
 				{{- $out.Decl -}}
 				{{- $out.Doc -}}
 				{{"\n"}}
+				{{- template "decl_source" .Decl -}}
 				{{- template "example" (index $.Examples.Map $name) -}}
 			</div>
 			{{- end -}}
@@ -368,23 +391,17 @@ var htmlPackage = template.Must(template.New("package").Funcs(
 	{{- end -}}
 {{- end -}}
 
-{{- if .Notes -}}
-<section class="Documentation-notes">
-	{{- range $marker, $content := .Notes -}}
-	<div class="Documentation-note">
-		<h2 tabindex="-1" id="{{index $.NoteIDs $marker}}" class="Documentation-noteHeader">{{$marker}}s <a href="#pkg-note-{{$marker}}">¶</a></h2>
-		<ul class="Documentation-noteList" style="padding-left: 20px; list-style: initial;">{{"\n" -}}
-		{{- range $v := $content -}}
-			<li style="margin: 6px 0 6px 0;">{{render_doc $v.Body}}</li>
-		{{- end -}}
-		</ul>{{"\n" -}}
-	</div>
+</div> {{/* End documentation content container */}}
+
+{{- define "decl_source" -}}
+	{{- with decl_source . -}}
+	<details class="Documentation-declSource">{{"\n" -}}
+		<summary class="Documentation-declSourceHeader">Source</summary>{{"\n" -}}
+		<pre>{{"\n"}}{{.}}</pre>{{"\n" -}}
+	</details>{{"\n" -}}
 	{{- end -}}
-</section>
 {{- end -}}
 
-</div> {{/* End documentation content container */}}
-
 {{- define "example" -}}
 	{{- range . -}}
 	<details tabindex="-1" id="{{.ID}}" class="Documentation-exampleDetails js-exampleContainer">{{"\n" -}}
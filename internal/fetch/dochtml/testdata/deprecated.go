@@ -0,0 +1,33 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package deprecated has deprecated declarations, and is itself deprecated.
+//
+// Deprecated: use package everydecl instead.
+package deprecated
+
+// Old does nothing.
+//
+// Deprecated: use New instead.
+func Old() {}
+
+// New does nothing either.
+func New() {}
+
+// S has a deprecated field.
+type S struct {
+	// Deprecated: use G.
+	F int
+
+	// G is the replacement for F.
+	G int
+}
+
+// Deprecated: T is no longer used.
+type T int
+
+// M is a method of a deprecated type.
+//
+// Deprecated: this method is going away along with T.
+func (T) M() {}
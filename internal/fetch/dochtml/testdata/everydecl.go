@@ -5,6 +5,11 @@
 // Package everydecl has every form of declaration known to dochtml.
 // It is designed to test that the generated HTML has the right id and data-kind
 // attributes.
+//
+// # Usage
+//
+// This heading and the one in the documentation of T have the same ID, unless
+// it is made unique.
 package everydecl
 
 // const
@@ -16,7 +21,14 @@ var V = 2
 // func
 func F() {}
 
+// func with the same name as a method
+func M() {}
+
 // type
+//
+// # Usage
+//
+// T is a type.
 type T int
 
 // typeConstant
@@ -32,6 +44,8 @@ func TF() T { return T(0) }
 // BUG(uid): this verifies that notes are rendered
 func (T) M() {}
 
+// TODO(uid): this verifies that notes with other markers are rendered
+
 type S1 struct {
 	F int // field
 }
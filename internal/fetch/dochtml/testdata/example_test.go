@@ -11,6 +11,8 @@ package example_test
 import (
 	"fmt"
 	"strings"
+
+	"github.com/urfave/cli"
 )
 
 // non-executable example taken from https://github.com/urfave/cli/blob/master/app_test.go#L184
@@ -46,3 +48,12 @@ func Example_stringsCompare() {
 	// 0
 	// 1
 }
+
+// non-executable example, since it imports a package outside the standard library
+func Example_thirdParty() {
+	app := cli.NewApp()
+	fmt.Println(app.Name)
+
+	// Output:
+	// cli
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package generics has generic declarations.
+package generics
+
+import "fmt"
+
+// Number is a constraint for numeric types.
+type Number interface {
+	~int | ~int64 | ~float64
+}
+
+// Ordered is a constraint with an embedded union and a method.
+type Ordered interface {
+	Number | ~string
+	fmt.Stringer
+}
+
+// Sum returns the sum of s.
+func Sum[T Number](s []T) T {
+	var t T
+	for _, x := range s {
+		t += x
+	}
+	return t
+}
+
+// Map applies f to each element of s.
+func Map[S ~[]E, E, R any](s S, f func(E) R) []R { return nil }
+
+// Print prints s.
+func Print[T fmt.Stringer](s []T) {}
+
+// List is a linked list.
+type List[T any] struct {
+	next *List[T]
+	val  T
+}
+
+// NewList returns an empty list.
+func NewList[T any]() *List[T] { return nil }
+
+// Push adds v to l.
+func (l *List[T]) Push(v T) {}
+
+// Pair holds two values.
+type Pair[K comparable, V Number] struct {
+	Key K
+	Val V
+}
+
+// First returns the first value of p.
+func (p Pair[K, _]) First() K { return p.Key }
@@ -0,0 +1,97 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"bytes"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"path"
+	"sort"
+	"unicode/utf8"
+)
+
+// byteOrderMark is the UTF-8 encoding of U+FEFF, which some editors write at
+// the start of a file.
+var byteOrderMark = []byte("\uFEFF")
+
+// fixEncodings prepares the .go files of the package directory innerPath, a
+// map from file names to their contents, for parsing. It removes a byte order
+// mark from the start of each file, and replaces invalid UTF-8 in comments
+// with U+FFFD, so that documentation can be rendered for files whose comments
+// were saved in another encoding, such as Latin-1. Invalid UTF-8 outside of
+// comments is left alone, and the file fails to parse.
+//
+// fixEncodings changes the contents in files, and returns a warning for each
+// file that it changed.
+func fixEncodings(innerPath string, files map[string][]byte) (warnings []string) {
+	for name, contents := range files {
+		filePath := path.Join(innerPath, name)
+		if bytes.HasPrefix(contents, byteOrderMark) {
+			contents = contents[len(byteOrderMark):]
+			warnings = append(warnings, fmt.Sprintf("removed byte order mark from file %q", filePath))
+		}
+		if fixed, ok := fixCommentEncoding(contents); ok {
+			contents = fixed
+			warnings = append(warnings, fmt.Sprintf("replaced invalid UTF-8 in comments of file %q", filePath))
+		}
+		files[name] = contents
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// fixCommentEncoding returns src with the invalid UTF-8 in its comments
+// replaced by U+FFFD, and reports whether there was any. Replacing bytes in
+// comments does not change the line numbers of the rest of the source.
+func fixCommentEncoding(src []byte) ([]byte, bool) {
+	if utf8.Valid(src) {
+		return src, false
+	}
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	// Errors, including those for the invalid UTF-8 being fixed, are
+	// reported when the file is parsed.
+	s.Init(file, src, func(token.Position, string) {}, scanner.ScanComments)
+	var (
+		fixed   []byte
+		last    int // end of the source copied to fixed
+		changed bool
+	)
+	for {
+		pos, tok, _ := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok != token.COMMENT {
+			continue
+		}
+		// The scanner removes carriage returns from the text of comments, so
+		// find the end of the comment in the source.
+		start := file.Offset(pos)
+		end := len(src)
+		if bytes.HasPrefix(src[start:], []byte("//")) {
+			if i := bytes.IndexByte(src[start:], '\n'); i >= 0 {
+				end = start + i
+			}
+		} else if i := bytes.Index(src[start+2:], []byte("*/")); i >= 0 {
+			end = start + 2 + i + 2
+		}
+		comment := src[start:end]
+		if utf8.Valid(comment) {
+			continue
+		}
+		fixed = append(fixed, src[last:start]...)
+		fixed = append(fixed, bytes.ToValidUTF8(comment, []byte("\uFFFD"))...)
+		last = end
+		changed = true
+	}
+	if !changed {
+		return src, false
+	}
+	return append(fixed, src[last:]...), true
+}
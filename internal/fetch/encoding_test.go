@@ -0,0 +1,59 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFixEncodings(t *testing.T) {
+	for _, test := range []struct {
+		name, contents, want string
+		wantWarnings         []string
+	}{
+		{
+			name:     "valid",
+			contents: "// Package p is café.\npackage p",
+			want:     "// Package p is café.\npackage p",
+		},
+		{
+			name:         "byte order mark",
+			contents:     "\uFEFFpackage p",
+			want:         "package p",
+			wantWarnings: []string{`removed byte order mark from file "d/f.go"`},
+		},
+		{
+			name:         "line comments",
+			contents:     "// caf\xe9\r\npackage p // \xe9\xe9 x\r\n\r\nconst c = 1 // ok",
+			want:         "// caf\uFFFD\r\npackage p // \uFFFD x\r\n\r\nconst c = 1 // ok",
+			wantWarnings: []string{`replaced invalid UTF-8 in comments of file "d/f.go"`},
+		},
+		{
+			name:         "general comments",
+			contents:     "/* caf\xe9\r\n\xe9 */ package p /* unterminated \xe9",
+			want:         "/* caf\uFFFD\r\n\uFFFD */ package p /* unterminated \uFFFD",
+			wantWarnings: []string{`replaced invalid UTF-8 in comments of file "d/f.go"`},
+		},
+		{
+			name:         "string",
+			contents:     "package p\n\nconst s = \"caf\xe9\" // \"\xe9\"",
+			want:         "package p\n\nconst s = \"caf\xe9\" // \"\uFFFD\"",
+			wantWarnings: []string{`replaced invalid UTF-8 in comments of file "d/f.go"`},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			files := map[string][]byte{"f.go": []byte(test.contents)}
+			gotWarnings := fixEncodings("d", files)
+			if got := string(files["f.go"]); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if diff := cmp.Diff(test.wantWarnings, gotWarnings); diff != "" {
+				t.Errorf("warnings mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -7,8 +7,8 @@ package fetch
 
 import (
 	"archive/zip"
-	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"go/ast"
@@ -32,6 +32,7 @@ import (
 	"golang.org/x/mod/module"
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/experiment"
 	"golang.org/x/pkgsite/internal/fetch/dochtml"
 	"golang.org/x/pkgsite/internal/fetch/internal/doc"
 	"golang.org/x/pkgsite/internal/licenses"
@@ -41,33 +42,73 @@ import (
 	"golang.org/x/pkgsite/internal/stdlib"
 )
 
-var (
-	errModuleContainsNoPackages = errors.New("module contains 0 packages")
-	errMalformedZip             = errors.New("module zip is malformed")
-)
-
 type FetchResult struct {
 	ModulePath           string
 	RequestedVersion     string
 	ResolvedVersion      string
 	GoModPath            string
+	ProxyURL             string
 	Status               int
 	Error                error
 	Module               *internal.Module
 	PackageVersionStates []*internal.PackageVersionState
+	// GoVersion and Toolchain are the arguments of the go and toolchain
+	// directives of the module's go.mod file, or empty if it has none.
+	GoVersion string
+	Toolchain string
+	// Warnings describe problems with the module that did not prevent it
+	// from being processed, such as files in its zip that were skipped.
+	Warnings []string
+	// Timings are the durations of the phases of the fetch, keyed by phase,
+	// such as PhaseDownload. PackageTimings are the durations of loading
+	// each package and rendering its documentation, keyed by package path.
+	Timings        map[string]time.Duration
+	PackageTimings map[string]time.Duration
+	// ZipSize is the total compressed size of the files of the module zip,
+	// and NumZipFiles their number. MaxAlloc is the most heap memory, in
+	// bytes, that was allocated between the phases of the fetch; it is only
+	// an estimate of the memory that the fetch needed, since the memory may
+	// also have been used by other fetches.
+	ZipSize     int64
+	NumZipFiles int
+	MaxAlloc    uint64
 }
 
 // FetchModule queries the proxy or the Go repo for the requested module
 // version, downloads the module zip, and processes the contents to return an
-// *internal.Module and related information.
+// *internal.Module and related information. Modules in the repositories
+// configured with SetDirectRepos are fetched from those repositories instead
+// of the proxy. If a checksum database is configured with SetChecksumDB, the
+// module zip is verified against it before it is processed.
+//
+// If ctx is done before the fetch completes, the error of the result is a
+// *PhaseError that says what the fetch was doing. Packages are not processed
+// once ctx is done.
 //
 // Even if err is non-nil, the result may contain useful information, like the go.mod path.
 func FetchModule(ctx context.Context, modulePath, requestedVersion string, proxyClient *proxy.Client, sourceClient *source.Client) (fr *FetchResult) {
+	return FetchModuleWithCache(ctx, modulePath, requestedVersion, proxyClient, sourceClient, nil)
+}
+
+// FetchModuleWithCache is like FetchModule, but it looks up each package of
+// the module in cache, if it is non-nil, by its content hash. Packages found
+// there are not processed again: their documentation is copied, with its
+// links changed to refer to the fetched version.
+func FetchModuleWithCache(ctx context.Context, modulePath, requestedVersion string, proxyClient *proxy.Client, sourceClient *source.Client, cache PackageCache) (fr *FetchResult) {
 	fr = &FetchResult{
 		ModulePath:       modulePath,
 		RequestedVersion: requestedVersion,
 	}
+	p := newProgress()
+	p.begin(PhaseDownload)
 	defer func() {
+		if fr.Error != nil && ctx.Err() != nil {
+			fr.Error = p.phaseError(ctx, fr.Error)
+		}
+		p.end()
+		fr.Timings = p.timings
+		fr.PackageTimings = p.packageTimings
+		fr.MaxAlloc = p.maxAlloc
 		if fr.Error != nil {
 			derrors.Wrap(&fr.Error, "FetchModule(%q, %q)", modulePath, requestedVersion)
 			fr.Status = derrors.ToStatus(fr.Error)
@@ -82,6 +123,7 @@ func FetchModule(ctx context.Context, modulePath, requestedVersion string, proxy
 		commitTime      time.Time
 		zipReader       *zip.Reader
 		resolvedVersion string
+		retractions     []internal.RetractedVersion
 		err             error
 	)
 	if modulePath == stdlib.ModulePath {
@@ -92,6 +134,34 @@ func FetchModule(ctx context.Context, modulePath, requestedVersion string, proxy
 		}
 		fr.GoModPath = stdlib.ModulePath
 		fr.ResolvedVersion = resolvedVersion
+	} else if r := lookupDirectRepo(modulePath); r != nil {
+		f, err := ioutil.TempFile("", "module-*.zip")
+		if err != nil {
+			fr.Error = err
+			return fr
+		}
+		defer func() {
+			f.Close()
+			os.Remove(f.Name())
+		}()
+		dm, err := r.fetchDirect(ctx, modulePath, requestedVersion, f)
+		if err != nil {
+			fr.Error = err
+			return fr
+		}
+		fr.ResolvedVersion = dm.version
+		fr.ProxyURL = DirectProxyURL
+		commitTime = dm.commitTime
+		retractions, err = processGoMod(ctx, fr, dm.goMod)
+		if err != nil {
+			fr.Error = err
+			return fr
+		}
+		zipReader = dm.zipReader
+		if err := checkModuleLimits(zipReader); err != nil {
+			fr.Error = err
+			return fr
+		}
 	} else {
 		info, err := proxyClient.GetInfo(ctx, modulePath, requestedVersion)
 		if err != nil {
@@ -106,71 +176,189 @@ func FetchModule(ctx context.Context, modulePath, requestedVersion string, proxy
 			fr.Error = err
 			return fr
 		}
-		goModPath := modfile.ModulePath(goModBytes)
-		if goModPath == "" {
-			fr.Error = fmt.Errorf("go.mod has no module path: %w", derrors.BadModule)
+		retractions, err = processGoMod(ctx, fr, goModBytes)
+		if err != nil {
+			fr.Error = err
 			return fr
 		}
-		fr.GoModPath = goModPath
-		if goModPath != modulePath {
-			// The module path in the go.mod file doesn't match the path of the
-			// zip file. Don't insert the module. Store an AlternativeModule
-			// status in module_version_states.
-			fr.Error = fmt.Errorf("module path=%s, go.mod path=%s: %w", modulePath, goModPath, derrors.AlternativeModule)
+		// Keep the zip on disk rather than in memory, so that the memory
+		// needed to process a module depends on the size of its largest
+		// package rather than the size of the whole module.
+		f, err := ioutil.TempFile("", "module-*.zip")
+		if err != nil {
+			fr.Error = err
 			return fr
 		}
-		zipReader, err = proxyClient.GetZip(ctx, modulePath, fr.ResolvedVersion)
+		defer func() {
+			f.Close()
+			os.Remove(f.Name())
+		}()
+		zipReader, fr.ProxyURL, err = downloadZip(ctx, proxyClient, modulePath, fr.ResolvedVersion, f)
 		if err != nil {
 			fr.Error = err
 			return fr
 		}
+		if err := checkModuleLimits(zipReader); err != nil {
+			fr.Error = err
+			return fr
+		}
+	}
+	fr.NumZipFiles = len(zipReader.File)
+	for _, f := range zipReader.File {
+		fr.ZipSize += int64(f.CompressedSize64)
 	}
-	mod, pvs, err := processZipFile(ctx, modulePath, fr.ResolvedVersion, commitTime, zipReader, sourceClient)
+	p.begin(PhaseChecksum)
+	checksumStatus, err := verifyChecksum(ctx, modulePath, fr.ResolvedVersion, zipReader)
 	if err != nil {
 		fr.Error = err
 		return fr
 	}
-	fr.Module = mod
-	fr.PackageVersionStates = pvs
+	p.begin(PhaseExtract)
+	sourceInfo, err := source.ModuleInfo(ctx, sourceClient, modulePath, fr.ResolvedVersion)
+	if err != nil {
+		log.Infof(ctx, "error getting source info: %v", err)
+	}
+	if err := processModule(ctx, fr, commitTime, zipReader, sourceInfo, sourceClient, cache, p); err != nil {
+		fr.Error = err
+		return fr
+	}
+	fr.Module.RetractedVersions = retractions
+	fr.Module.ChecksumStatus = checksumStatus
 	if modulePath == stdlib.ModulePath {
 		fr.Module.HasGoMod = true
 	}
+	return fr
+}
+
+// processModule processes zipReader, the module zip of the module version of
+// fr, which was committed at commitTime and whose source is described by
+// sourceInfo. It sets fr.Module and fr.PackageVersionStates to the results,
+// adds warnings about the files of the zip to fr.Warnings, and sets fr.Status
+// if any package could not be processed. The caller must have begun
+// PhaseExtract in p.
+func processModule(ctx context.Context, fr *FetchResult, commitTime time.Time, zipReader *zip.Reader, sourceInfo *source.Info, sourceClient *source.Client, cache PackageCache, p *progress) error {
+	zipReader, warnings, err := checkZipFiles(fr.ModulePath, fr.ResolvedVersion, zipReader)
+	if err != nil {
+		return err
+	}
+	fr.Warnings = append(fr.Warnings, warnings...)
+	for _, w := range fr.Warnings {
+		log.Infof(ctx, "%s@%s: %s", fr.ModulePath, fr.ResolvedVersion, w)
+	}
+	mod, pvs, warnings, err := processZipFile(ctx, fr.ModulePath, fr.ResolvedVersion, fr.GoVersion, commitTime, zipReader, sourceInfo, sourceClient, cache, p)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		log.Infof(ctx, "%s@%s: %s", fr.ModulePath, fr.ResolvedVersion, w)
+	}
+	fr.Warnings = append(fr.Warnings, warnings...)
+	mod.GoVersion = fr.GoVersion
+	mod.Toolchain = fr.Toolchain
+	if mod.TotalPackages > 0 {
+		fr.Warnings = append(fr.Warnings, fmt.Sprintf("processed only the first %d of %d packages", mod.ProcessedPackages, mod.TotalPackages))
+	}
+	fr.Module = mod
+	fr.PackageVersionStates = pvs
 	for _, state := range fr.PackageVersionStates {
 		if state.Status != http.StatusOK {
 			fr.Status = derrors.ToStatus(derrors.HasIncompletePackages)
 		}
 	}
-	return fr
+	return nil
 }
 
-// processZipFile extracts information from the module version zip.
-func processZipFile(ctx context.Context, modulePath string, resolvedVersion string, commitTime time.Time, zipReader *zip.Reader, sourceClient *source.Client) (_ *internal.Module, _ []*internal.PackageVersionState, err error) {
+// processGoMod sets fr.GoModPath to the module path declared by the go.mod
+// file with the given contents, and fr.GoVersion and fr.Toolchain to its go
+// and toolchain directives, and returns the retractions of the file. Invalid
+// go and toolchain directives are ignored and added to fr.Warnings. It
+// returns an error if the go.mod file declares no module path, or one other
+// than fr.ModulePath.
+func processGoMod(ctx context.Context, fr *FetchResult, goModBytes []byte) ([]internal.RetractedVersion, error) {
+	goModPath := modfile.ModulePath(goModBytes)
+	if goModPath == "" {
+		return nil, derrors.BadGoMod
+	}
+	fr.GoModPath = goModPath
+	var invalid []string
+	fr.GoVersion, fr.Toolchain, invalid = parseGoDirectives(goModBytes)
+	for _, w := range invalid {
+		fr.Warnings = append(fr.Warnings, "ignored "+w)
+	}
+	retractions, err := parseRetractions(goModBytes)
+	if err != nil {
+		log.Infof(ctx, "ignoring retractions of %s@%s: %v", fr.ModulePath, fr.ResolvedVersion, err)
+	}
+	if goModPath != fr.ModulePath {
+		// The module path in the go.mod file doesn't match the path of the
+		// zip file. Don't insert the module. Store an AlternativeModule
+		// status in module_version_states.
+		errAlt := derrors.AlternativeModule
+		if strings.EqualFold(goModPath, fr.ModulePath) {
+			errAlt = derrors.ModulePathCasing
+		}
+		return nil, fmt.Errorf("module path=%s, go.mod path=%s: %w", fr.ModulePath, goModPath, errAlt)
+	}
+	return retractions, nil
+}
+
+// downloadZip downloads the zip of the given module version from the proxy to
+// f, and returns a reader for it and the URL of the proxy that it came from.
+// Zips larger than MaxModuleZipSize are not downloaded completely.
+func downloadZip(ctx context.Context, proxyClient *proxy.Client, modulePath, resolvedVersion string, f *os.File) (_ *zip.Reader, proxyURL string, err error) {
+	defer derrors.Wrap(&err, "downloadZip(%q, %q)", modulePath, resolvedVersion)
+
+	proxyURL, err = proxyClient.DownloadZip(ctx, modulePath, resolvedVersion, f, MaxModuleZipSize)
+	if err != nil {
+		return nil, "", err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, "", err
+	}
+	zipReader, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return nil, "", fmt.Errorf("zip.NewReader: %v: %w", err, derrors.BadModuleZip)
+	}
+	return zipReader, proxyURL, nil
+}
+
+// processZipFile extracts information from the module version zip, whose go.mod
+// file declares goVersion and whose source is described by sourceInfo, which
+// may be nil. If cache is non-nil, packages are looked up in it before they
+// are processed. It returns warnings about files whose contents were changed
+// so that they could be processed. Its phases are recorded in p.
+func processZipFile(ctx context.Context, modulePath, resolvedVersion, goVersion string, commitTime time.Time, zipReader *zip.Reader, sourceInfo *source.Info, sourceClient *source.Client, cache PackageCache, p *progress) (_ *internal.Module, _ []*internal.PackageVersionState, warnings []string, err error) {
 	defer derrors.Wrap(&err, "processZipFile(%q, %q)", modulePath, resolvedVersion)
 
 	ctx, span := trace.StartSpan(ctx, "fetch.processZipFile")
 	defer span.End()
 
-	sourceInfo, err := source.ModuleInfo(ctx, sourceClient, modulePath, resolvedVersion)
-	if err != nil {
-		log.Infof(ctx, "error getting source info: %v", err)
-	}
 	readmes, err := extractReadmesFromZip(modulePath, resolvedVersion, zipReader)
 	if err != nil {
-		return nil, nil, fmt.Errorf("extractReadmesFromZip(%q, %q, zipReader): %v", modulePath, resolvedVersion, err)
+		return nil, nil, nil, fmt.Errorf("extractReadmesFromZip(%q, %q, zipReader): %v", modulePath, resolvedVersion, err)
 	}
 	logf := func(format string, args ...interface{}) {
 		log.Infof(ctx, format, args...)
 	}
+	p.begin(PhaseLicenses)
 	d := licenses.NewDetector(modulePath, resolvedVersion, zipReader, logf)
 	allLicenses := d.AllLicenses()
-	packages, packageVersionStates, err := extractPackagesFromZip(ctx, modulePath, resolvedVersion, zipReader, d, sourceInfo)
-	if errors.Is(err, errModuleContainsNoPackages) || errors.Is(err, errMalformedZip) {
-		return nil, nil, fmt.Errorf("%v: %w", err.Error(), derrors.BadModule)
+	p.begin(PhaseDocs)
+	reuser := newReuser(cache, sourceClient, modulePath, resolvedVersion, sourceInfo)
+	packages, packageVersionStates, numPackages, warnings, err := extractPackagesFromZip(ctx, modulePath, resolvedVersion, goVersion, zipReader, d, sourceInfo, reuser, p)
+	if errors.Is(err, derrors.ModuleHasNoPackages) || errors.Is(err, derrors.BadModuleZip) || errors.Is(err, derrors.ModuleTooManyPackages) {
+		return nil, nil, nil, err
 	}
 	if err != nil {
-		return nil, nil, fmt.Errorf("extractPackagesFromZip(%q, %q, zipReader, %v): %v", modulePath, resolvedVersion, allLicenses, err)
+		return nil, nil, nil, fmt.Errorf("extractPackagesFromZip(%q, %q, zipReader, %v): %v", modulePath, resolvedVersion, allLicenses, err)
 	}
 	hasGoMod := zipContainsFilename(zipReader, path.Join(moduleVersionDir(modulePath, resolvedVersion), "go.mod"))
+	hasSecurityPolicy := zipContainsFilename(zipReader, path.Join(moduleVersionDir(modulePath, resolvedVersion), "SECURITY.md"))
+	var processedPackages, totalPackages int
+	if numPackages > MaxModulePackages {
+		processedPackages, totalPackages = MaxModulePackages, numPackages
+	}
 
 	var readmeFilePath, readmeContents string
 	for _, r := range readmes {
@@ -189,7 +377,10 @@ func processZipFile(ctx context.Context, modulePath string, resolvedVersion stri
 				CommitTime:        commitTime,
 				IsRedistributable: d.ModuleIsRedistributable(),
 				HasGoMod:          hasGoMod,
+				HasSecurityPolicy: hasSecurityPolicy,
 				SourceInfo:        sourceInfo,
+				ProcessedPackages: processedPackages,
+				TotalPackages:     totalPackages,
 			},
 			LegacyReadmeFilePath: readmeFilePath,
 			LegacyReadmeContents: readmeContents,
@@ -197,7 +388,7 @@ func processZipFile(ctx context.Context, modulePath string, resolvedVersion stri
 		LegacyPackages: packages,
 		Licenses:       allLicenses,
 		Units:          moduleUnits(modulePath, resolvedVersion, packages, readmes, d),
-	}, packageVersionStates, nil
+	}, packageVersionStates, warnings, nil
 }
 
 // moduleVersionDir formats the content subdirectory for the given
@@ -250,9 +441,24 @@ func isReadme(file string) bool {
 // that they contained .go files but couldn't be processed due to current
 // limitations of this site. The limitations are:
 // * a maximum file size (MaxFileSize)
-// * the particular set of build contexts we consider (goEnvs)
+// * the particular set of build contexts we consider (internal.BuildContexts)
 // * whether the import path is valid.
-func extractPackagesFromZip(ctx context.Context, modulePath, resolvedVersion string, r *zip.Reader, d *licenses.Detector, sourceInfo *source.Info) (_ []*internal.LegacyPackage, _ []*internal.PackageVersionState, err error) {
+//
+// Each package's ContentHash is set. Packages that reuser finds for another
+// version of the module are not loaded again.
+//
+// The third return value is the number of directories with .go files in the
+// module. If it is more than MaxModulePackages and TruncateModulePackages is
+// true, only the first MaxModulePackages of them, in path order, are
+// processed; if TruncateModulePackages is false, extractPackagesFromZip fails
+// with derrors.ModuleTooManyPackages.
+//
+// Before the files of a package are parsed, byte order marks and invalid UTF-8
+// in comments are removed from them; see fixEncodings. The fourth return value
+// holds a warning for each file that was changed. A package whose files cannot
+// be parsed is returned with documentation saying so, and a package version
+// state with the status of derrors.PackageInvalidContents.
+func extractPackagesFromZip(ctx context.Context, modulePath, resolvedVersion, goVersion string, r *zip.Reader, d *licenses.Detector, sourceInfo *source.Info, reuser *reuser, p *progress) (_ []*internal.LegacyPackage, _ []*internal.PackageVersionState, numPackages int, warnings []string, err error) {
 	ctx, span := trace.StartSpan(ctx, "fetch.extractPackagesFromZip")
 	defer span.End()
 	defer func() {
@@ -317,8 +523,8 @@ func extractPackagesFromZip(ctx context.Context, modulePath, resolvedVersion str
 		}
 		if !strings.HasPrefix(f.Name, modulePrefix) {
 			// Well-formed module zips have all files under modulePrefix.
-			return nil, nil, fmt.Errorf("expected file to have prefix %q; got = %q: %w",
-				modulePrefix, f.Name, errMalformedZip)
+			return nil, nil, 0, nil, fmt.Errorf("expected file to have prefix %q; got = %q: %w",
+				modulePrefix, f.Name, derrors.BadModuleZip)
 		}
 		innerPath := path.Dir(f.Name[len(modulePrefix):])
 		if incompleteDirs[innerPath] {
@@ -365,40 +571,84 @@ func extractPackagesFromZip(ctx context.Context, modulePath, resolvedVersion str
 			continue
 		}
 		dirs[innerPath] = append(dirs[innerPath], f)
-		if len(dirs) > maxPackagesPerModule {
-			return nil, nil, fmt.Errorf("%d packages found in %q; exceeds limit %d for maxPackagePerModule", len(dirs), modulePath, maxPackagesPerModule)
+		if len(dirs) > MaxModulePackages && !TruncateModulePackages {
+			return nil, nil, 0, nil, fmt.Errorf("more than %d packages found in %q: %w", MaxModulePackages, modulePath, derrors.ModuleTooManyPackages)
 		}
 	}
+	numPackages = len(dirs)
+	// Process the packages in path order, so that warnings are too.
+	var innerPaths []string
+	for innerPath := range dirs {
+		innerPaths = append(innerPaths, innerPath)
+	}
+	sort.Strings(innerPaths)
+	if numPackages > MaxModulePackages {
+		// Process the first packages, and forget the others, so that
+		// nothing links to them.
+		for _, innerPath := range innerPaths[MaxModulePackages:] {
+			delete(dirs, innerPath)
+		}
+		innerPaths = innerPaths[:MaxModulePackages]
+	}
 	for pkgName := range dirs {
 		modInfo.ModulePackages[path.Join(modulePath, pkgName)] = true
 	}
+	salt := contentHashSalt(ctx, goVersion, d, modInfo)
+	tags := releaseTags(goVersion)
 
 	// Phase 2.
 	// If we got this far, the file metadata was okay.
 	// Start reading the file contents now to extract information
 	// about Go packages.
 	var pkgs []*internal.LegacyPackage
-	for innerPath, goFiles := range dirs {
+	for _, innerPath := range innerPaths {
+		goFiles := dirs[innerPath]
 		if incompleteDirs[innerPath] {
 			// Something went wrong when processing this directory, so we skip.
 			log.Infof(ctx, "Skipping %q because it is incomplete", innerPath)
 			continue
 		}
+		// Stop between packages if the fetch was canceled or timed out.
+		if err := ctx.Err(); err != nil {
+			return nil, nil, 0, nil, err
+		}
+		p.beginPackage(path.Join(modulePath, innerPath))
 
 		var (
 			status error
 			errMsg string
 		)
-		pkg, err := loadPackage(ctx, goFiles, innerPath, sourceInfo, modInfo)
+		var (
+			isRedist = true
+			lics     []*licenses.License
+		)
+		if d != nil { //  should only be nil for tests
+			isRedist, lics = d.PackageInfo(innerPath)
+		}
+		// Read the files once, and select from them for each build context.
+		// They can be released as soon as this package has been processed.
+		allFiles, err := readZipFiles(goFiles)
+		if err != nil {
+			return nil, nil, 0, nil, fmt.Errorf("unexpected error loading package: %v", err)
+		}
+		warnings = append(warnings, fixEncodings(innerPath, allFiles)...)
+		contentHash := packageContentHash(salt, innerPath, allFiles)
+		pkg := reuser.reuse(ctx, innerPath, contentHash, allFiles)
+		if pkg == nil {
+			pkg, err = loadPackage(ctx, allFiles, innerPath, sourceInfo, modInfo, tags, isRedist)
+		}
 		if bpe := (*BadPackageError)(nil); errors.As(err, &bpe) {
 			incompleteDirs[innerPath] = true
 			status = derrors.PackageInvalidContents
 			errMsg = err.Error()
+			// Keep the package, so that its page says why it has no
+			// documentation.
+			pkg = unparseablePackage(modulePath, innerPath, allFiles)
 		} else if errors.Is(err, dochtml.ErrTooLarge) {
 			status = derrors.PackageDocumentationHTMLTooLarge
 			errMsg = err.Error()
 		} else if err != nil {
-			return nil, nil, fmt.Errorf("unexpected error loading package: %v", err)
+			return nil, nil, 0, nil, fmt.Errorf("unexpected error loading package: %v", err)
 		}
 
 		var pkgPath string
@@ -411,12 +661,10 @@ func extractPackagesFromZip(ctx context.Context, modulePath, resolvedVersion str
 			}
 			pkgPath = path.Join(modulePath, innerPath)
 		} else {
-			if d != nil { //  should only be nil for tests
-				isRedist, lics := d.PackageInfo(innerPath)
-				pkg.IsRedistributable = isRedist
-				for _, l := range lics {
-					pkg.Licenses = append(pkg.Licenses, l.Metadata)
-				}
+			pkg.IsRedistributable = isRedist
+			pkg.ContentHash = contentHash
+			for _, l := range lics {
+				pkg.Licenses = append(pkg.Licenses, l.Metadata)
 			}
 			pkgs = append(pkgs, pkg)
 			pkgPath = pkg.Path
@@ -432,11 +680,12 @@ func extractPackagesFromZip(ctx context.Context, modulePath, resolvedVersion str
 			Status:      code,
 			Error:       errMsg,
 		})
+		p.endPackage()
 	}
 	if len(pkgs) == 0 {
-		return nil, packageVersionStates, errModuleContainsNoPackages
+		return nil, packageVersionStates, numPackages, warnings, derrors.ModuleHasNoPackages
 	}
-	return pkgs, packageVersionStates, nil
+	return pkgs, packageVersionStates, numPackages, warnings, nil
 }
 
 // ignoredByGoTool reports whether the given import path corresponds
@@ -488,35 +737,77 @@ type BadPackageError struct {
 
 func (bpe *BadPackageError) Error() string { return bpe.Err.Error() }
 
-// Go environments used to construct build contexts in loadPackage.
-var goEnvs = []struct{ GOOS, GOARCH string }{
-	{"linux", "amd64"},
-	{"windows", "amd64"},
-	{"darwin", "amd64"},
-	{"js", "wasm"},
-	{"linux", "js"},
-}
-
 // loadPackage loads a Go package by calling loadPackageWithBuildContext, trying
-// several build contexts in turn. The first build context in the list to produce
-// a non-empty package is used. If none of them result in a package, then
-// loadPackage returns nil, nil.
+// each of internal.BuildContexts in turn. The first build context in the list to
+// produce a non-empty package is used for the package itself. If none of them
+// result in a package, then loadPackage returns nil, nil. allFiles maps the
+// names of the .go files in the package directory to their contents, and
+// releaseTags are the release tags satisfied in every build context.
+//
+// Documentation is also rendered for each later build context that selects a
+// different set of files, and stored in the package's Documentation field,
+// after the documentation for the first one. Errors loading those later build
+// contexts are logged and otherwise ignored.
 //
 // If the package is fine except that its documentation is too large, loadPackage
 // returns both a package and a non-nil error with dochtml.ErrTooLarge in its chain.
-func loadPackage(ctx context.Context, zipGoFiles []*zip.File, innerPath string, sourceInfo *source.Info, modInfo *dochtml.ModuleInfo) (*internal.LegacyPackage, error) {
+func loadPackage(ctx context.Context, allFiles map[string][]byte, innerPath string, sourceInfo *source.Info, modInfo *dochtml.ModuleInfo, releaseTags []string, isRedistributable bool) (_ *internal.LegacyPackage, err error) {
 	ctx, span := trace.StartSpan(ctx, "fetch.loadPackage")
 	defer span.End()
-	for _, env := range goEnvs {
-		pkg, err := loadPackageWithBuildContext(ctx, env.GOOS, env.GOARCH, zipGoFiles, innerPath, sourceInfo, modInfo)
-		if err != nil && !errors.Is(err, dochtml.ErrTooLarge) {
-			return nil, err
+	var (
+		pkg  *internal.LegacyPackage
+		seen = map[string]bool{} // file sets already loaded
+		// Source code is never kept for packages we cannot redistribute.
+		declSource = isRedistributable && experiment.IsActive(ctx, internal.ExperimentDeclarationSource)
+	)
+	for _, bc := range internal.BuildContexts {
+		files, ferr := matchingFiles(bc.GOOS, bc.GOARCH, releaseTags, allFiles)
+		if ferr != nil {
+			if pkg == nil {
+				return nil, ferr
+			}
+			log.Infof(ctx, "loadPackage(%q): %v", innerPath, ferr)
+			continue
+		}
+		key := fileSetKey(files)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		p, perr := loadPackageWithBuildContext(ctx, bc.GOOS, bc.GOARCH, files, innerPath, sourceInfo, modInfo, true, declSource)
+		if perr != nil && !errors.Is(perr, dochtml.ErrTooLarge) {
+			if pkg == nil {
+				return nil, perr
+			}
+			log.Infof(ctx, "loadPackage(%q): %v", innerPath, perr)
+			continue
+		}
+		if p == nil {
+			continue
 		}
-		if pkg != nil {
-			return pkg, err
+		if pkg == nil {
+			pkg = p
+			err = perr
+			continue
 		}
+		if p.Name != pkg.Name {
+			// A different package under other build constraints is not
+			// something we can show on the same page.
+			continue
+		}
+		pkg.Documentation = append(pkg.Documentation, p.Documentation...)
+	}
+	return pkg, err
+}
+
+// fileSetKey returns a string that identifies the set of file names in files.
+func fileSetKey(files map[string][]byte) string {
+	var names []string
+	for name := range files {
+		names = append(names, name)
 	}
-	return nil, nil
+	sort.Strings(names)
+	return strings.Join(names, ",")
 }
 
 // httpPost allows package fetch tests to stub out playground URL fetches.
@@ -524,30 +815,82 @@ var httpPost = http.Post
 
 const docTooLargeReplacement = `<p>Documentation is too large to display.</p>`
 
-// loadPackageWithBuildContext loads a Go package made of .go files in zipGoFiles
-// using a build context constructed from the given GOOS and GOARCH values.
+// docUnparseableReplacement is the documentation of a package whose files
+// cannot be parsed.
+const docUnparseableReplacement = `<p>Documentation could not be generated for this package.</p>`
+
+// unparseablePackage returns a package for the directory innerPath of a
+// module, whose .go files are allFiles but cannot be loaded, with documentation
+// that says so. The package's name is that in the package clause of the first
+// of its non-test files, in name order, whose package clause can be parsed. If
+// there is no such file, unparseablePackage returns nil.
+func unparseablePackage(modulePath, innerPath string, allFiles map[string][]byte) *internal.LegacyPackage {
+	var names []string
+	for name := range allFiles {
+		if !strings.HasSuffix(name, "_test.go") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var packageName string
+	for _, name := range names {
+		f, err := parser.ParseFile(token.NewFileSet(), name, allFiles[name], parser.PackageClauseOnly)
+		if err == nil {
+			packageName = f.Name.Name
+			break
+		}
+	}
+	if packageName == "" {
+		return nil
+	}
+	importPath := path.Join(modulePath, innerPath)
+	if modulePath == stdlib.ModulePath {
+		importPath = innerPath
+	}
+	bc := internal.BuildContexts[0]
+	docHTML := template.MustParseAndExecuteToHTML(docUnparseableReplacement)
+	return &internal.LegacyPackage{
+		Path:              importPath,
+		Name:              packageName,
+		V1Path:            internal.V1Path(importPath, modulePath),
+		DocumentationHTML: docHTML,
+		GOOS:              bc.GOOS,
+		GOARCH:            bc.GOARCH,
+		Documentation: []*internal.Documentation{{
+			GOOS:   bc.GOOS,
+			GOARCH: bc.GOARCH,
+			HTML:   docHTML,
+		}},
+	}
+}
+
+// loadPackageWithBuildContext loads a Go package made of the .go files in files,
+// which were selected by a build context constructed from the given GOOS and
+// GOARCH values.
 // modulePath is stdlib.ModulePath for the Go standard library and the module
 // path for all other modules. innerPath is the path of the Go package directory
 // relative to the module root.
 //
-// zipGoFiles must contain only .go files that have been verified
-// to be of reasonable size.
+// The returned LegacyPackage.Licenses field is not populated, and its
+// Documentation field holds only the documentation for this build context.
+//
+// If collapse is true and the documentation HTML is larger than
+// DocumentationCollapseThreshold, abbreviated documentation is rendered
+// instead, and the package's files are kept in Documentation.Source so that
+// the full documentation can be rendered later by RenderFullDocumentation.
 //
-// The returned LegacyPackage.Licenses field is not populated.
+// If declSource is true, the documentation shows the source of each function
+// and method below its documentation, for those that are not too long. See
+// dochtml.RenderOptions.DeclSource.
 //
 // It returns a nil LegacyPackage if the directory doesn't contain a Go package
 // or all .go files have been excluded by constraints.
 // A *BadPackageError error is returned if the directory
 // contains .go files but do not make up a valid package.
-func loadPackageWithBuildContext(ctx context.Context, goos, goarch string, zipGoFiles []*zip.File, innerPath string, sourceInfo *source.Info, modInfo *dochtml.ModuleInfo) (_ *internal.LegacyPackage, err error) {
+func loadPackageWithBuildContext(ctx context.Context, goos, goarch string, files map[string][]byte, innerPath string, sourceInfo *source.Info, modInfo *dochtml.ModuleInfo, collapse, declSource bool) (_ *internal.LegacyPackage, err error) {
 	modulePath := modInfo.ModulePath
-	defer derrors.Wrap(&err, "loadPackageWithBuildContext(%q, %q, zipGoFiles, %q, %q, %+v)",
+	defer derrors.Wrap(&err, "loadPackageWithBuildContext(%q, %q, files, %q, %q, %+v)",
 		goos, goarch, innerPath, modulePath, sourceInfo)
-	// Apply build constraints to get a map from matching file names to their contents.
-	files, err := matchingFiles(goos, goarch, zipGoFiles)
-	if err != nil {
-		return nil, err
-	}
 
 	// Parse .go files and add them to the goFiles slice.
 	var (
@@ -565,6 +908,7 @@ func loadPackageWithBuildContext(ctx context.Context, goos, goarch string, zipGo
 			}
 			return nil, &BadPackageError{Err: err}
 		}
+		stripCgo(pf)
 		allGoFiles = append(allGoFiles, pf)
 		if strings.HasSuffix(name, "_test.go") {
 			continue
@@ -597,6 +941,12 @@ func loadPackageWithBuildContext(ctx context.Context, goos, goarch string, zipGo
 		noTypeAssociation = true
 	}
 
+	// Capture function bodies, which computing documentation removes.
+	var sources map[ast.Decl]string
+	if declSource {
+		sources = funcSources(fset, goFiles, files)
+	}
+
 	// Compute package documentation.
 	importPath := path.Join(modulePath, innerPath)
 	var m doc.Mode
@@ -625,16 +975,6 @@ func loadPackageWithBuildContext(ctx context.Context, goos, goarch string, zipGo
 	}
 
 	// Render documentation HTML.
-	sourceLinkFunc := func(n ast.Node) string {
-		if sourceInfo == nil {
-			return ""
-		}
-		p := fset.Position(n.Pos())
-		if p.Line == 0 { // invalid Position
-			return ""
-		}
-		return sourceInfo.LineURL(path.Join(innerPath, p.Filename), p.Line)
-	}
 	fileLinkFunc := func(filename string) string {
 		if sourceInfo == nil {
 			return ""
@@ -642,12 +982,29 @@ func loadPackageWithBuildContext(ctx context.Context, goos, goarch string, zipGo
 		return sourceInfo.FileURL(path.Join(innerPath, filename))
 	}
 
-	docHTML, err := dochtml.Render(ctx, fset, d, dochtml.RenderOptions{
+	opts := dochtml.RenderOptions{
 		FileLinkFunc:   fileLinkFunc,
-		SourceLinkFunc: sourceLinkFunc,
+		SourceLinkFunc: sourceLinkFunc(fset, innerPath, sourceInfo),
 		ModInfo:        modInfo,
 		Limit:          int64(MaxDocumentationHTML),
-	})
+		DeclSource:     sources,
+	}
+	api, err := json.Marshal(dochtml.API(ctx, fset, d, modInfo))
+	if err != nil {
+		return nil, err
+	}
+	var docSource []byte
+	docHTML, err := dochtml.Render(ctx, fset, d, opts)
+	if err == nil && collapse && len(docHTML.String()) > DocumentationCollapseThreshold {
+		opts.Collapsed = true
+		docHTML, err = dochtml.Render(ctx, fset, d, opts)
+		if err == nil {
+			docSource, err = zipFiles(files)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
 	if errors.Is(err, dochtml.ErrTooLarge) {
 		docHTML = template.MustParseAndExecuteToHTML(docTooLargeReplacement)
 	} else if err != nil {
@@ -657,25 +1014,81 @@ func loadPackageWithBuildContext(ctx context.Context, goos, goarch string, zipGo
 		importPath = innerPath
 	}
 	v1path := internal.V1Path(importPath, modulePath)
+	fullSynopsis := dochtml.Synopsis(d.Doc)
+	synopsis := fullSynopsis
+	if TrimSynopsisPackageName {
+		synopsis = dochtml.TrimPackageName(synopsis, packageName)
+	}
+	synopsis = dochtml.TruncateSynopsis(synopsis, MaxSynopsisLength)
 	return &internal.LegacyPackage{
 		Path:              importPath,
 		Name:              packageName,
-		Synopsis:          doc.Synopsis(d.Doc),
+		Synopsis:          synopsis,
 		V1Path:            v1path,
 		Imports:           d.Imports,
 		DocumentationHTML: docHTML,
 		GOOS:              goos,
 		GOARCH:            goarch,
+		Documentation: []*internal.Documentation{{
+			GOOS:         goos,
+			GOARCH:       goarch,
+			Synopsis:     synopsis,
+			FullSynopsis: fullSynopsis,
+			HTML:         docHTML,
+			Source:       docSource,
+			API:          api,
+			Symbols:      symbolNames(d),
+		}},
 	}, err
 }
 
-// matchingFiles returns a map from file names to their contents, read from zipGoFiles.
-// It includes only those files that match the build context determined by goos and goarch.
-func matchingFiles(goos, goarch string, zipGoFiles []*zip.File) (files map[string][]byte, err error) {
-	defer derrors.Wrap(&err, "matchingFiles(%q, %q, zipGoFiles)", goos, goarch)
-	// Populate the map with all the zip files.
-	files = make(map[string][]byte)
-	for _, f := range zipGoFiles {
+// maxDeclSourceLines is the maximum number of lines of a function whose
+// source is shown with its documentation.
+const maxDeclSourceLines = 100
+
+// funcSources returns the source text of the function and method
+// declarations in goFiles, whose contents are in files. Declarations longer
+// than maxDeclSourceLines are omitted.
+func funcSources(fset *token.FileSet, goFiles map[string]*ast.File, files map[string][]byte) map[ast.Decl]string {
+	sources := map[ast.Decl]string{}
+	for name, f := range goFiles {
+		contents := files[name]
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			start, end := fset.Position(fd.Pos()), fset.Position(fd.End())
+			if end.Line-start.Line+1 > maxDeclSourceLines || end.Offset > len(contents) {
+				continue
+			}
+			sources[fd] = string(contents[start.Offset:end.Offset])
+		}
+	}
+	return sources
+}
+
+// sourceLinkFunc returns a function that links a declaration to the line of
+// its source file where it begins, or returns the empty string if the
+// position of the declaration is not known.
+func sourceLinkFunc(fset *token.FileSet, innerPath string, sourceInfo *source.Info) func(ast.Node) string {
+	return func(n ast.Node) string {
+		if sourceInfo == nil {
+			return ""
+		}
+		p := fset.Position(n.Pos())
+		if p.Line == 0 { // invalid Position
+			return ""
+		}
+		return sourceInfo.LineURL(path.Join(innerPath, p.Filename), p.Line)
+	}
+}
+
+// readZipFiles returns a map from the base names of zipFiles to their
+// contents. Each file is read up to MaxFileSize bytes.
+func readZipFiles(zipFiles []*zip.File) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, f := range zipFiles {
 		_, name := path.Split(f.Name)
 		b, err := readZipFile(f, MaxFileSize)
 		if err != nil {
@@ -683,40 +1096,22 @@ func matchingFiles(goos, goarch string, zipGoFiles []*zip.File) (files map[strin
 		}
 		files[name] = b
 	}
+	return files, nil
+}
 
-	// bctx is used to make decisions about which of the .go files are included
-	// by build constraints.
-	bctx := &build.Context{
-		GOOS:        goos,
-		GOARCH:      goarch,
-		CgoEnabled:  true,
-		Compiler:    build.Default.Compiler,
-		ReleaseTags: build.Default.ReleaseTags,
-
-		JoinPath: path.Join,
-		OpenFile: func(name string) (io.ReadCloser, error) {
-			return ioutil.NopCloser(bytes.NewReader(files[name])), nil
-		},
-
-		// If left nil, the default implementations of these read from disk,
-		// which we do not want. None of these functions should be used
-		// inside this function; it would be an internal error if they are.
-		// Set them to non-nil values to catch if that happens.
-		SplitPathList: func(string) []string { panic("internal error: unexpected call to SplitPathList") },
-		IsAbsPath:     func(string) bool { panic("internal error: unexpected call to IsAbsPath") },
-		IsDir:         func(string) bool { panic("internal error: unexpected call to IsDir") },
-		HasSubdir:     func(string, string) (string, bool) { panic("internal error: unexpected call to HasSubdir") },
-		ReadDir:       func(string) ([]os.FileInfo, error) { panic("internal error: unexpected call to ReadDir") },
-	}
-
-	for name := range files {
-		match, err := bctx.MatchFile(".", name) // This will access the file we just added to files map above.
+// matchingFiles returns the subset of allFiles, a map from file names to their
+// contents, that match the build context determined by goos, goarch and
+// releaseTags.
+func matchingFiles(goos, goarch string, releaseTags []string, allFiles map[string][]byte) (files map[string][]byte, err error) {
+	defer derrors.Wrap(&err, "matchingFiles(%q, %q, allFiles)", goos, goarch)
+	files = make(map[string][]byte)
+	for name, contents := range allFiles {
+		match, err := matchFile(goos, goarch, releaseTags, name, contents)
 		if err != nil {
-			return nil, &BadPackageError{Err: fmt.Errorf(`bctx.MatchFile(".", %q): %w`, name, err)}
+			return nil, &BadPackageError{Err: err}
 		}
-		if !match {
-			// Excluded by build context.
-			delete(files, name)
+		if match {
+			files[name] = contents
 		}
 	}
 	return files, nil
@@ -9,10 +9,18 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
+	"runtime/debug"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -21,6 +29,7 @@ import (
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/derrors"
 	"golang.org/x/pkgsite/internal/experiment"
+	"golang.org/x/pkgsite/internal/fetch/dochtml"
 	"golang.org/x/pkgsite/internal/proxy"
 	"golang.org/x/pkgsite/internal/source"
 	"golang.org/x/pkgsite/internal/stdlib"
@@ -56,12 +65,18 @@ func TestFetchModule(t *testing.T) {
 		{name: "basic", mod: moduleNoGoMod},
 		{name: "wasm", mod: moduleWasm},
 		{name: "no go.mod file", mod: moduleOnePackage},
+		{name: "module with a security policy", mod: moduleSecurityPolicy},
 		{name: "has go.mod", mod: moduleMultiPackage},
 		{name: "module with bad packages", mod: moduleBadPackages},
+		{name: "module with files in other encodings", mod: moduleEncodings},
 		{name: "module with build constraints", mod: moduleBuildConstraints},
+		{name: "module with //go:build constraints", mod: moduleGoBuildConstraints},
 		{name: "module with packages with bad import paths", mod: moduleBadImportPath},
+		{name: "module with bad file names", mod: moduleBadFileNames},
+		{name: "module requiring a newer Go version", mod: moduleGoVersion},
 		{name: "module with documentation", mod: moduleDocTest},
 		{name: "documentation too large", mod: moduleDocTooLarge},
+		{name: "cgo package", mod: moduleCgo},
 		{name: "module with package-level example", mod: modulePackageExample},
 		{name: "module with function example", mod: moduleFuncExample},
 		{name: "module with type example", mod: moduleTypeExample},
@@ -100,9 +115,14 @@ func TestFetchModule(t *testing.T) {
 			fr := cleanFetchResult(test.mod.fr, d)
 			sortFetchResult(fr)
 			sortFetchResult(got)
+			if modulePath != stdlib.ModulePath && got.ProxyURL == "" {
+				t.Error("got no proxy URL")
+			}
 			opts := []cmp.Option{
-				cmpopts.IgnoreFields(internal.LegacyPackage{}, "DocumentationHTML"),
-				cmpopts.IgnoreFields(internal.Documentation{}, "HTML"),
+				cmpopts.IgnoreFields(FetchResult{}, "ProxyURL", "Timings", "PackageTimings", "ZipSize", "NumZipFiles", "MaxAlloc"),
+				cmpopts.IgnoreFields(internal.LegacyPackage{}, "DocumentationHTML", "ContentHash"),
+				cmpopts.IgnoreFields(internal.Unit{}, "ContentHash"),
+				cmpopts.IgnoreFields(internal.Documentation{}, "HTML", "API", "Symbols"),
 				cmpopts.IgnoreFields(internal.PackageVersionState{}, "Error"),
 				cmp.AllowUnexported(source.Info{}),
 				cmpopts.EquateEmpty(),
@@ -125,7 +145,7 @@ func TestFetchModule_Errors(t *testing.T) {
 		wantGoModPath string
 	}{
 		{name: "alternative", mod: moduleAlternative, wantErr: derrors.AlternativeModule, wantGoModPath: "canonical"},
-		{name: "empty module", mod: moduleEmpty, wantErr: derrors.BadModule},
+		{name: "empty module", mod: moduleEmpty, wantErr: derrors.ModuleHasNoPackages},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			modulePath := test.mod.mod.ModulePath
@@ -153,6 +173,211 @@ func TestFetchModule_Errors(t *testing.T) {
 	}
 }
 
+func TestFetchModuleTooLarge(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer func(zipSize, uncompressedSize int64, files int) {
+		MaxModuleZipSize, MaxModuleUncompressedSize, MaxModuleFiles = zipSize, uncompressedSize, files
+	}(MaxModuleZipSize, MaxModuleUncompressedSize, MaxModuleFiles)
+
+	const modulePath = "github.com/my/module"
+	// The repeated comment compresses well, so the zip is much smaller than
+	// its uncompressed contents.
+	proxyClient, teardownProxy := proxy.SetupTestClient(t, []*proxy.Module{{
+		ModulePath: modulePath,
+		Files: map[string]string{
+			"LICENSE": testhelper.MITLicense,
+			"foo.go":  "// Package foo is large.\npackage foo\n\n//" + strings.Repeat(" large", 10000) + "\n",
+		},
+	}})
+	defer teardownProxy()
+	sourceClient := source.NewClient(sourceTimeout)
+
+	for _, test := range []struct {
+		name                      string
+		zipSize, uncompressedSize int64
+		files                     int
+		wantErr                   error
+	}{
+		{name: "within limits"},
+		{name: "zip size", zipSize: 1000, wantErr: derrors.ModuleTooLarge},
+		{name: "uncompressed size", uncompressedSize: 50000, wantErr: derrors.ModuleTooLarge},
+		{name: "number of files", files: 1, wantErr: derrors.ModuleTooLarge},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			MaxModuleZipSize, MaxModuleUncompressedSize, MaxModuleFiles = megabyte, megabyte, 100
+			SetModuleLimits(test.zipSize, test.uncompressedSize, test.files)
+			got := FetchModule(ctx, modulePath, "v1.0.0", proxyClient, sourceClient)
+			if !errors.Is(got.Error, test.wantErr) {
+				t.Fatalf("FetchModule(ctx, %q, v1.0.0, proxyClient, sourceClient): %v; wantErr = %v", modulePath, got.Error, test.wantErr)
+			}
+			if want := derrors.ToStatus(test.wantErr); got.Status != want {
+				t.Errorf("got status %d, want %d", got.Status, want)
+			}
+		})
+	}
+}
+
+func TestFetchModuleTooManyPackages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer func(maxPackages int, truncate bool) {
+		MaxModulePackages, TruncateModulePackages = maxPackages, truncate
+	}(MaxModulePackages, TruncateModulePackages)
+
+	const modulePath = "github.com/my/module"
+	proxyClient, teardownProxy := proxy.SetupTestClient(t, []*proxy.Module{{
+		ModulePath: modulePath,
+		Files: map[string]string{
+			"LICENSE": testhelper.MITLicense,
+			"d/d.go":  "package d",
+			"c/c.go":  "package c",
+			"b/b.go":  "package b",
+			"a/a.go":  "package a",
+		},
+	}})
+	defer teardownProxy()
+	sourceClient := source.NewClient(sourceTimeout)
+
+	SetPackageLimits(2, false)
+	got := FetchModule(ctx, modulePath, "v1.0.0", proxyClient, sourceClient)
+	if !errors.Is(got.Error, derrors.ModuleTooManyPackages) {
+		t.Fatalf("FetchModule(ctx, %q, v1.0.0, proxyClient, sourceClient): %v; wantErr = %v", modulePath, got.Error, derrors.ModuleTooManyPackages)
+	}
+	if want := derrors.ToStatus(derrors.ModuleTooLarge); got.Status != want {
+		t.Errorf("got status %d, want %d", got.Status, want)
+	}
+
+	SetPackageLimits(2, true)
+	got = FetchModule(ctx, modulePath, "v1.0.0", proxyClient, sourceClient)
+	if got.Error != nil {
+		t.Fatal(got.Error)
+	}
+	if got.Status != http.StatusOK {
+		t.Errorf("got status %d, want %d", got.Status, http.StatusOK)
+	}
+	if got.Module.ProcessedPackages != 2 || got.Module.TotalPackages != 4 {
+		t.Errorf("got %d of %d packages processed, want 2 of 4", got.Module.ProcessedPackages, got.Module.TotalPackages)
+	}
+	var gotPaths []string
+	for _, u := range got.Module.Units {
+		gotPaths = append(gotPaths, u.Path)
+	}
+	sort.Strings(gotPaths)
+	wantPaths := []string{modulePath, modulePath + "/a", modulePath + "/b"}
+	if diff := cmp.Diff(wantPaths, gotPaths); diff != "" {
+		t.Errorf("unit paths mismatch (-want +got):\n%s", diff)
+	}
+	if want := []string{"processed only the first 2 of 4 packages"}; !cmp.Equal(got.Warnings, want) {
+		t.Errorf("got warnings %q, want %q", got.Warnings, want)
+	}
+}
+
+func TestFetchModuleMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping memory test in short mode")
+	}
+	// Compare the peak heap growth when fetching modules that differ only in
+	// the size of their data file, so that memory that doesn't depend on the
+	// size of the zip, such as the proxy test server's, is not counted.
+	const dataSize = 20 * megabyte
+	small := fetchLargeModule(t, 10, megabyte)
+	large := fetchLargeModule(t, 10, dataSize+megabyte)
+	// Holding the zip in memory would take at least dataSize more bytes.
+	var growth uint64
+	if large > small {
+		growth = large - small
+	}
+	if growth > dataSize/4 {
+		t.Errorf("extra peak heap growth for %d more bytes of data: got %d bytes, want at most %d", dataSize, growth, dataSize/4)
+	}
+}
+
+// BenchmarkFetchModuleMemory reports the peak heap growth while fetching a
+// module of about 200 MB, most of it a data file.
+func BenchmarkFetchModuleMemory(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		peak := fetchLargeModule(b, 100, 200*megabyte)
+		b.ReportMetric(float64(peak)/megabyte, "peak-MB")
+	}
+}
+
+// fetchLargeModule fetches a generated module with numPackages packages and
+// a data file of dataSize random bytes, which don't compress, and returns the
+// peak growth of the heap while doing so.
+func fetchLargeModule(t testing.TB, numPackages, dataSize int) uint64 {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	const modulePath = "example.com/large"
+	data := make([]byte, dataSize)
+	rand.New(rand.NewSource(1)).Read(data)
+	files := map[string]string{
+		"LICENSE":       testhelper.MITLicense,
+		"data/blob.bin": string(data),
+	}
+	for i := 0; i < numPackages; i++ {
+		files[fmt.Sprintf("p%d/p.go", i)] = fmt.Sprintf("// Package p%[1]d is generated.\npackage p%[1]d\n\n// F is a function.\nfunc F() int { return %[1]d }\n", i)
+	}
+	proxyClient, teardownProxy := proxy.SetupTestClient(t, []*proxy.Module{{
+		ModulePath: modulePath,
+		Files:      files,
+	}})
+	defer teardownProxy()
+	sourceClient := source.NewClient(sourceTimeout)
+
+	var fr *FetchResult
+	peak := peakHeapGrowth(func() {
+		fr = FetchModule(ctx, modulePath, "v1.0.0", proxyClient, sourceClient)
+	})
+	if fr.Error != nil {
+		t.Fatal(fr.Error)
+	}
+	if got := len(fr.Module.LegacyPackages); got != numPackages {
+		t.Fatalf("got %d packages, want %d", got, numPackages)
+	}
+	return peak
+}
+
+// peakHeapGrowth calls f, and returns the largest growth of the heap over its
+// size before the call, as sampled every millisecond. Garbage is collected
+// aggressively meanwhile, so that the heap size approximates live memory.
+func peakHeapGrowth(f func()) uint64 {
+	defer debug.SetGCPercent(debug.SetGCPercent(5))
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	base := ms.HeapAlloc
+
+	done := make(chan struct{})
+	peakc := make(chan uint64)
+	go func() {
+		var peak uint64
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			var ms runtime.MemStats
+			runtime.ReadMemStats(&ms)
+			if ms.HeapAlloc > peak {
+				peak = ms.HeapAlloc
+			}
+			select {
+			case <-done:
+				peakc <- peak
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	f()
+	close(done)
+	peak := <-peakc
+	if peak < base {
+		return 0
+	}
+	return peak - base
+}
+
 func TestExtractReadmesFromZip(t *testing.T) {
 	stdlib.UseTestData = true
 
@@ -370,13 +595,170 @@ func TestMatchingFiles(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			got, err := matchingFiles(test.goos, test.goarch, r.File)
+			allFiles, err := readZipFiles(r.File)
 			if err != nil {
 				t.Fatal(err)
 			}
+			got, err := matchingFiles(test.goos, test.goarch, releaseTags(""), allFiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMatchFile(t *testing.T) {
+	for _, test := range []struct {
+		name, filename, contents string
+		// want lists the build contexts that match, as "GOOS/GOARCH".
+		want []string
+	}{
+		{
+			name:     "no constraints",
+			filename: "f.go",
+			contents: "package p",
+			want:     []string{"linux/amd64", "windows/amd64", "darwin/arm64", "js/wasm"},
+		},
+		{
+			name:     "file name",
+			filename: "f_windows_amd64_test.go",
+			contents: "package p",
+			want:     []string{"windows/amd64"},
+		},
+		{
+			name:     "first element of file name is not a constraint",
+			filename: "linux.go",
+			contents: "package p",
+			want:     []string{"linux/amd64", "windows/amd64", "darwin/arm64", "js/wasm"},
+		},
+		{
+			name:     "go:build only",
+			filename: "f.go",
+			contents: "//go:build (linux || darwin) && !arm64\n\npackage p",
+			want:     []string{"linux/amd64"},
+		},
+		{
+			name:     "go:build unix",
+			filename: "f.go",
+			contents: "//go:build unix\n\npackage p",
+			want:     []string{"linux/amd64", "darwin/arm64"},
+		},
+		{
+			name:     "go:build with release tag and cgo",
+			filename: "f.go",
+			contents: "//go:build go1.1 && cgo && gc\n\npackage p",
+			want:     []string{"linux/amd64", "windows/amd64", "darwin/arm64", "js/wasm"},
+		},
+		{
+			name:     "go:build with unknown tag",
+			filename: "f.go",
+			contents: "//go:build ignore\n\npackage p",
+		},
+		{
+			name:     "go:build and file name",
+			filename: "f_amd64.go",
+			contents: "//go:build !windows\n\npackage p",
+			want:     []string{"linux/amd64"},
+		},
+		{
+			name:     "+build only",
+			filename: "f.go",
+			contents: "// +build windows,amd64 darwin\n// +build !js\n\npackage p",
+			want:     []string{"windows/amd64", "darwin/arm64"},
+		},
+		{
+			name:     "matching go:build and +build",
+			filename: "f.go",
+			contents: "//go:build js && wasm\n// +build js,wasm\n\npackage p",
+			want:     []string{"js/wasm"},
+		},
+		{
+			name:     "mismatched go:build and +build",
+			filename: "f.go",
+			contents: "//go:build windows\n// +build linux\n\npackage p",
+			want:     []string{"windows/amd64"},
+		},
+		{
+			name:     "constraint in package doc comment is ignored",
+			filename: "f.go",
+			contents: "// Copyright\n\n//go:build windows\n// Package p is a package.\npackage p",
+			want:     []string{"linux/amd64", "windows/amd64", "darwin/arm64", "js/wasm"},
+		},
+		{
+			name:     "not a .go file",
+			filename: "f.s",
+			contents: "package p",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, bc := range []string{"linux/amd64", "windows/amd64", "darwin/arm64", "js/wasm"} {
+				parts := strings.Split(bc, "/")
+				match, err := matchFile(parts[0], parts[1], releaseTags(""), test.filename, []byte(test.contents))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if match {
+					got = append(got, bc)
+				}
+			}
 			if diff := cmp.Diff(test.want, got); diff != "" {
 				t.Errorf("mismatch (-want +got):\n%s", diff)
 			}
 		})
 	}
+
+	for _, contents := range []string{
+		"//go:build linux &&\n\npackage p",
+		"//go:build linux\n//go:build amd64\n\npackage p",
+		"// +build linux\n\nfunc f() {}",
+	} {
+		if _, err := matchFile("linux", "amd64", releaseTags(""), "f.go", []byte(contents)); err == nil {
+			t.Errorf("matchFile(%q): got no error, want one", contents)
+		}
+	}
+}
+
+func TestSourceLinkFunc(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "f.go", "package p\n\n// F is a func.\nfunc F() {}\n", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := source.NewGitHubInfo("https://github.com/a/b", "", "v1.0.0")
+	link := sourceLinkFunc(fset, "dir", info)
+	if got, want := link(f.Decls[0]), "https://github.com/a/b/blob/v1.0.0/dir/f.go#L4"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// A node with no position gets no link.
+	if got := link(&ast.Ident{Name: "x"}); got != "" {
+		t.Errorf("got %q for node without position, want empty", got)
+	}
+	if got := sourceLinkFunc(fset, "dir", nil)(f.Decls[0]); got != "" {
+		t.Errorf("got %q with nil source info, want empty", got)
+	}
+}
+
+func TestDeclSource(t *testing.T) {
+	long := "func Long() {\n" + strings.Repeat("\tprintln()\n", maxDeclSourceLines) + "}\n"
+	files := map[string][]byte{
+		"p.go": []byte("// Package p has functions.\npackage p\n\n// F is a func.\nfunc F() int {\n\treturn 42\n}\n\n// Long is long.\n" + long),
+	}
+	modInfo := &dochtml.ModuleInfo{ModulePath: "example.com/p", ResolvedVersion: "v1.0.0"}
+	for _, declSource := range []bool{true, false} {
+		pkg, err := loadPackageWithBuildContext(context.Background(), "linux", "amd64", files, "", nil, modInfo, false, declSource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		html := pkg.Documentation[0].HTML.String()
+		if got := strings.Contains(html, "return 42"); got != declSource {
+			t.Errorf("declSource=%t: got source of F %t, want %t", declSource, got, declSource)
+		}
+		if strings.Contains(html, "println()") {
+			t.Errorf("declSource=%t: got source of Long, want none", declSource)
+		}
+	}
 }
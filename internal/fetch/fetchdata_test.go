@@ -14,6 +14,7 @@ import (
 	"golang.org/x/pkgsite/internal/proxy"
 	"golang.org/x/pkgsite/internal/source"
 	"golang.org/x/pkgsite/internal/stdlib"
+	"golang.org/x/pkgsite/internal/testing/sample"
 	"golang.org/x/pkgsite/internal/testing/testhelper"
 )
 
@@ -56,9 +57,10 @@ var moduleOnePackage = &testModule{
 						Name: "foo",
 						Path: "github.com/basic/foo",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "package foo exports a helpful constant.",
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "package foo exports a helpful constant.",
+						FullSynopsis: "package foo exports a helpful constant.",
+					}},
 					Imports: []string{"net/http"},
 				},
 			},
@@ -108,6 +110,7 @@ var moduleMultiPackage = &testModule{
 				ModuleInfo: internal.ModuleInfo{
 					ModulePath: "github.com/my/module",
 					HasGoMod:   true,
+					GoVersion:  "1.12",
 					SourceInfo: source.NewGitHubInfo("https://github.com/my/module", "", "v1.0.0"),
 				},
 				LegacyReadmeFilePath: "README.md",
@@ -132,20 +135,22 @@ var moduleMultiPackage = &testModule{
 						Filepath: "bar/README.md",
 						Contents: "Another README FILE FOR TESTING.",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "package bar",
-						HTML:     html("Bar returns the string &#34;bar&#34;."),
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "package bar",
+						FullSynopsis: "package bar",
+						HTML:         html("Bar returns the string &#34;bar&#34;."),
+					}},
 				},
 				{
 					UnitMeta: internal.UnitMeta{
 						Name: "foo",
 						Path: "github.com/my/module/foo",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "package foo",
-						HTML:     html("FooBar returns the string &#34;foo bar&#34;."),
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "package foo",
+						FullSynopsis: "package foo",
+						HTML:         html("FooBar returns the string &#34;foo bar&#34;."),
+					}},
 					Imports: []string{"fmt", "github.com/my/module/bar"},
 				},
 			},
@@ -186,10 +191,49 @@ var moduleNoGoMod = &testModule{
 						Name: "p",
 						Path: "no.mod/module/p",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "Package p is inside a module where a go.mod file hasn't been explicitly added yet.",
-						HTML:     html("const Year = 2009"),
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "Package p is inside a module where a go.mod file hasn't been explicitly added yet.",
+						FullSynopsis: "Package p is inside a module where a go.mod file hasn't been explicitly added yet.",
+						HTML:         html("const Year = 2009"),
+					}},
+				},
+			},
+		},
+	},
+}
+
+var moduleSecurityPolicy = &testModule{
+	mod: &proxy.Module{
+		ModulePath: "github.com/secure",
+		Files: map[string]string{
+			"SECURITY.md": sample.SecurityPolicyContents,
+			"foo/foo.go":  "// package foo exports a helpful constant.\npackage foo\nconst OK = 200",
+			"LICENSE":     testhelper.BSD0License,
+		},
+	},
+	fr: &FetchResult{
+		Module: &internal.Module{
+			LegacyModuleInfo: internal.LegacyModuleInfo{
+				ModuleInfo: internal.ModuleInfo{
+					ModulePath:        "github.com/secure",
+					HasSecurityPolicy: true,
+				},
+			},
+			Units: []*internal.Unit{
+				{
+					UnitMeta: internal.UnitMeta{
+						Path: "github.com/secure",
+					},
+				},
+				{
+					UnitMeta: internal.UnitMeta{
+						Name: "foo",
+						Path: "github.com/secure/foo",
 					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "package foo exports a helpful constant.",
+						FullSynopsis: "package foo exports a helpful constant.",
+					}},
 				},
 			},
 		},
@@ -249,10 +293,29 @@ var moduleBadPackages = &testModule{
 						Name: "good",
 						Path: "bad.mod/module/good",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "Package good is inside a module that has bad packages.",
-						HTML:     html(`const Good = <a href="/pkg/builtin#true">true</a>`),
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "Package good is inside a module that has bad packages.",
+						FullSynopsis: "Package good is inside a module that has bad packages.",
+						HTML:         html(`const Good = <a href="/pkg/builtin#true">true</a>`),
+					}},
+				},
+				{
+					UnitMeta: internal.UnitMeta{
+						Name: "p",
+						Path: "bad.mod/module/illegalchar",
+					},
+					Documentation: []*internal.Documentation{{
+						HTML: html("Documentation could not be generated for this package."),
+					}},
+				},
+				{
+					UnitMeta: internal.UnitMeta{
+						Name: "a",
+						Path: "bad.mod/module/multiplepkgs",
 					},
+					Documentation: []*internal.Documentation{{
+						HTML: html("Documentation could not be generated for this package."),
+					}},
 				},
 			},
 		},
@@ -267,13 +330,101 @@ var moduleBadPackages = &testModule{
 				PackagePath: "bad.mod/module/illegalchar",
 				ModulePath:  "bad.mod/module",
 				Version:     "v1.0.0",
-				Status:      600,
+				Status:      604,
 			},
 			{
 				PackagePath: "bad.mod/module/multiplepkgs",
 				ModulePath:  "bad.mod/module",
 				Version:     "v1.0.0",
-				Status:      600,
+				Status:      604,
+			},
+		},
+	},
+}
+
+// moduleEncodings has files with a byte order mark and with Latin-1 text in
+// comments, which are fixed so that the files can be parsed, and a file with
+// Latin-1 text in a string, which is not.
+var moduleEncodings = &testModule{
+	mod: &proxy.Module{
+		ModulePath: "github.com/my/encodings",
+		Files: map[string]string{
+			"LICENSE":          testhelper.BSD0License,
+			"bom/bom.go":       "\uFEFF// Package bom is saved with a byte order mark.\npackage bom\n\n// BOM is a constant.\nconst BOM = 1",
+			"latin1/latin1.go": "// Package latin1 is by Andr\xe9.\npackage latin1\n\n/* Caf\xe9 is a constant. */\nconst Caf\u00e9 = 1",
+			"str/str.go":       "// Package str has Latin-1 text in a string.\npackage str\n\nconst S = \"caf\xe9\"",
+		},
+	},
+	fr: &FetchResult{
+		Status: derrors.ToStatus(derrors.HasIncompletePackages),
+		Warnings: []string{
+			`removed byte order mark from file "bom/bom.go"`,
+			`replaced invalid UTF-8 in comments of file "latin1/latin1.go"`,
+		},
+		Module: &internal.Module{
+			LegacyModuleInfo: internal.LegacyModuleInfo{
+				ModuleInfo: internal.ModuleInfo{
+					ModulePath: "github.com/my/encodings",
+					SourceInfo: source.NewGitHubInfo("https://github.com/my/encodings", "", "v1.0.0"),
+				},
+			},
+			Units: []*internal.Unit{
+				{
+					UnitMeta: internal.UnitMeta{
+						Path: "github.com/my/encodings",
+					},
+				},
+				{
+					UnitMeta: internal.UnitMeta{
+						Name: "bom",
+						Path: "github.com/my/encodings/bom",
+					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "Package bom is saved with a byte order mark.",
+						FullSynopsis: "Package bom is saved with a byte order mark.",
+						HTML:         html("BOM is a constant."),
+					}},
+				},
+				{
+					UnitMeta: internal.UnitMeta{
+						Name: "latin1",
+						Path: "github.com/my/encodings/latin1",
+					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "Package latin1 is by Andr\uFFFD.",
+						FullSynopsis: "Package latin1 is by Andr\uFFFD.",
+						HTML:         html("Caf\uFFFD is a constant."),
+					}},
+				},
+				{
+					UnitMeta: internal.UnitMeta{
+						Name: "str",
+						Path: "github.com/my/encodings/str",
+					},
+					Documentation: []*internal.Documentation{{
+						HTML: html("Documentation could not be generated for this package."),
+					}},
+				},
+			},
+		},
+		PackageVersionStates: []*internal.PackageVersionState{
+			{
+				PackagePath: "github.com/my/encodings/bom",
+				ModulePath:  "github.com/my/encodings",
+				Version:     "v1.0.0",
+				Status:      200,
+			},
+			{
+				PackagePath: "github.com/my/encodings/latin1",
+				ModulePath:  "github.com/my/encodings",
+				Version:     "v1.0.0",
+				Status:      200,
+			},
+			{
+				PackagePath: "github.com/my/encodings/str",
+				ModulePath:  "github.com/my/encodings",
+				Version:     "v1.0.0",
+				Status:      604,
 			},
 		},
 	},
@@ -314,9 +465,19 @@ var moduleBuildConstraints = &testModule{
 						Name: "cpu",
 						Path: "build.constraints/module/cpu",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "Package cpu implements processor feature detection used by the Go standard library.",
-						HTML:     html("const CacheLinePadSize = 3"),
+					Documentation: []*internal.Documentation{
+						{
+							Synopsis:     "Package cpu implements processor feature detection used by the Go standard library.",
+							FullSynopsis: "Package cpu implements processor feature detection used by the Go standard library.",
+							HTML:         html("const CacheLinePadSize = 3"),
+						},
+						{
+							GOOS:         "js",
+							GOARCH:       "wasm",
+							Synopsis:     "Package cpu implements processor feature detection used by the Go standard library.",
+							FullSynopsis: "Package cpu implements processor feature detection used by the Go standard library.",
+							HTML:         html("Package cpu implements processor feature detection"),
+						},
 					},
 				},
 			},
@@ -338,6 +499,113 @@ var moduleBuildConstraints = &testModule{
 	},
 }
 
+var moduleGoBuildConstraints = &testModule{
+	mod: &proxy.Module{
+		ModulePath: "gobuild.constraints",
+		Files: map[string]string{
+			"LICENSE": testhelper.BSD0License,
+			"sep/sep.go": `
+					// Package sep provides the path separator.
+					package sep`,
+			"sep/sep_unix.go":    "//go:build unix\n\npackage sep\n\n// Sep is the separator.\nconst Sep = '/'",
+			"sep/sep_windows.go": "package sep\n\n// Sep is the separator.\nconst Sep = '\\\\'",
+			"sep/sep_other.go":   "//go:build !unix && !windows\n// +build linux\n\npackage sep\n\n// Sep is the separator.\nconst Sep = 0",
+		},
+	},
+	fr: &FetchResult{
+		GoModPath: "gobuild.constraints",
+		Module: &internal.Module{
+			LegacyModuleInfo: internal.LegacyModuleInfo{
+				ModuleInfo: internal.ModuleInfo{
+					ModulePath: "gobuild.constraints",
+					HasGoMod:   false,
+				},
+			},
+			Units: []*internal.Unit{
+				{
+					UnitMeta: internal.UnitMeta{
+						Path: "gobuild.constraints",
+					},
+				},
+				{
+					UnitMeta: internal.UnitMeta{
+						Name: "sep",
+						Path: "gobuild.constraints/sep",
+					},
+					Documentation: []*internal.Documentation{
+						{
+							Synopsis:     "Package sep provides the path separator.",
+							FullSynopsis: "Package sep provides the path separator.",
+							HTML:         html("const Sep = &#39;/&#39;"),
+						},
+						{
+							GOOS:         "windows",
+							GOARCH:       "amd64",
+							Synopsis:     "Package sep provides the path separator.",
+							FullSynopsis: "Package sep provides the path separator.",
+							HTML:         html("const Sep = &#39;\\\\&#39;"),
+						},
+						{
+							GOOS:         "js",
+							GOARCH:       "wasm",
+							Synopsis:     "Package sep provides the path separator.",
+							FullSynopsis: "Package sep provides the path separator.",
+							HTML:         html("const Sep = 0"),
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+// moduleGoVersion requires a version of Go newer than any this code is built
+// with. Its files constrained by that version's release tag are the ones
+// processed.
+var moduleGoVersion = &testModule{
+	mod: &proxy.Module{
+		ModulePath: "github.com/go/version",
+		Files: map[string]string{
+			"go.mod":   "module github.com/go/version\n\ngo 1.99.0 // a comment\n\ntoolchain go1.99.1\n",
+			"LICENSE":  testhelper.BSD0License,
+			"v/v.go":   "// Package v reports whether Go 1.99 is used.\npackage v",
+			"v/new.go": "//go:build go1.99\n\npackage v\n\n// New is declared for Go 1.99 and later.\nconst New = true",
+			"v/old.go": "//go:build !go1.99\n\npackage v\n\n// Old is declared before Go 1.99.\nconst Old = true",
+		},
+	},
+	fr: &FetchResult{
+		Module: &internal.Module{
+			LegacyModuleInfo: internal.LegacyModuleInfo{
+				ModuleInfo: internal.ModuleInfo{
+					ModulePath: "github.com/go/version",
+					HasGoMod:   true,
+					GoVersion:  "1.99.0",
+					Toolchain:  "go1.99.1",
+					SourceInfo: source.NewGitHubInfo("https://github.com/go/version", "", "v1.0.0"),
+				},
+			},
+			Units: []*internal.Unit{
+				{
+					UnitMeta: internal.UnitMeta{
+						Path: "github.com/go/version",
+					},
+				},
+				{
+					UnitMeta: internal.UnitMeta{
+						Name: "v",
+						Path: "github.com/go/version/v",
+					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "Package v reports whether Go 1.99 is used.",
+						FullSynopsis: "Package v reports whether Go 1.99 is used.",
+						HTML:         html("New is declared for Go 1.99 and later."),
+					}},
+				},
+			},
+		},
+	},
+}
+
 var moduleNonRedist = &testModule{
 	mod: &proxy.Module{
 		ModulePath: "nonredistributable.mod/module",
@@ -388,6 +656,7 @@ var moduleNonRedist = &testModule{
 				ModuleInfo: internal.ModuleInfo{
 					ModulePath: "nonredistributable.mod/module",
 					HasGoMod:   true,
+					GoVersion:  "1.13",
 				},
 				LegacyReadmeFilePath: "README.md",
 				LegacyReadmeContents: "README FILE FOR TESTING.",
@@ -407,20 +676,22 @@ var moduleNonRedist = &testModule{
 						Name: "bar",
 						Path: "nonredistributable.mod/module/bar",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "package bar",
-						HTML:     html("Bar returns the string"),
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "package bar",
+						FullSynopsis: "package bar",
+						HTML:         html("Bar returns the string"),
+					}},
 				},
 				{
 					UnitMeta: internal.UnitMeta{
 						Name: "baz",
 						Path: "nonredistributable.mod/module/bar/baz",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "package baz",
-						HTML:     html("Baz returns the string"),
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "package baz",
+						FullSynopsis: "package baz",
+						HTML:         html("Baz returns the string"),
+					}},
 				},
 				{
 					UnitMeta: internal.UnitMeta{
@@ -431,10 +702,11 @@ var moduleNonRedist = &testModule{
 						Filepath: "foo/README.md",
 						Contents: "README FILE SHOW UP HERE BUT WILL BE REMOVED BEFORE DB INSERT",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "package foo",
-						HTML:     html("FooBar returns the string"),
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "package foo",
+						FullSynopsis: "package foo",
+						HTML:         html("FooBar returns the string"),
+					}},
 					Imports: []string{"fmt", "github.com/my/module/bar"},
 				},
 			},
@@ -479,7 +751,7 @@ var moduleBadImportPath = &testModule{
 						Name: "foo",
 						Path: "bad.import.path.com/good/import/path",
 					},
-					Documentation: &internal.Documentation{},
+					Documentation: []*internal.Documentation{{}},
 				},
 			},
 		},
@@ -500,6 +772,80 @@ var moduleBadImportPath = &testModule{
 	},
 }
 
+// moduleBadFileNames has files that cannot be processed: their names contain
+// backslashes or characters invalid on some operating systems, or differ only
+// in case from the names of other files. They are skipped, and the rest of the
+// module is processed.
+var moduleBadFileNames = &testModule{
+	mod: &proxy.Module{
+		ModulePath: "github.com/bad/filenames",
+		Files: map[string]string{
+			"go.mod":     "module github.com/bad/filenames\n\ngo 1.14",
+			"LICENSE":    testhelper.BSD0License,
+			"README.md":  "README FILE FOR TESTING.",
+			"readme.md":  "Another README FILE FOR TESTING.",
+			"bar\\b.go":  "package bar",
+			"baz/a:b.go": "package other",
+			"baz/baz.go": "// Package baz has a file with an invalid name.\npackage baz\n\n// Baz is a constant.\nconst Baz = 1",
+			"foo/Foo.go": "// Package foo has files whose names differ in case.\npackage foo\n\n// Upper is declared in Foo.go.\nconst Upper = 1",
+			"foo/foo.go": "package foo\n\n// Lower is declared in foo.go.\nconst Lower = 1",
+		},
+	},
+	fr: &FetchResult{
+		Warnings: []string{
+			`skipped file "foo/foo.go": collides with "foo/Foo.go"`,
+			`skipped file "readme.md": collides with "README.md"`,
+			`skipped malformed file path "bar\\b.go": invalid char '\\'`,
+			`skipped malformed file path "baz/a:b.go": invalid char ':'`,
+		},
+		Module: &internal.Module{
+			LegacyModuleInfo: internal.LegacyModuleInfo{
+				ModuleInfo: internal.ModuleInfo{
+					ModulePath: "github.com/bad/filenames",
+					HasGoMod:   true,
+					GoVersion:  "1.14",
+					SourceInfo: source.NewGitHubInfo("https://github.com/bad/filenames", "", "v1.0.0"),
+				},
+				LegacyReadmeFilePath: "README.md",
+				LegacyReadmeContents: "README FILE FOR TESTING.",
+			},
+			Units: []*internal.Unit{
+				{
+					UnitMeta: internal.UnitMeta{
+						Path: "github.com/bad/filenames",
+					},
+					Readme: &internal.Readme{
+						Filepath: "README.md",
+						Contents: "README FILE FOR TESTING.",
+					},
+				},
+				{
+					UnitMeta: internal.UnitMeta{
+						Name: "baz",
+						Path: "github.com/bad/filenames/baz",
+					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "Package baz has a file with an invalid name.",
+						FullSynopsis: "Package baz has a file with an invalid name.",
+						HTML:         html("Baz is a constant."),
+					}},
+				},
+				{
+					UnitMeta: internal.UnitMeta{
+						Name: "foo",
+						Path: "github.com/bad/filenames/foo",
+					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "Package foo has files whose names differ in case.",
+						FullSynopsis: "Package foo has files whose names differ in case.",
+						HTML:         html("Upper is declared in Foo.go."),
+					}},
+				},
+			},
+		},
+	},
+}
+
 var moduleDocTest = &testModule{
 	mod: &proxy.Module{
 		ModulePath: "doc.test",
@@ -539,10 +885,11 @@ var moduleDocTest = &testModule{
 						Name: "permalink",
 						Path: "doc.test/permalink",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "Package permalink is for testing the heading permalink documentation rendering feature.",
-						HTML:     html("<h3 id=\"hdr-This_is_a_heading\">This is a heading<a href=\"#hdr-This_is_a_heading\">¶</a></h3>"),
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "Package permalink is for testing the heading permalink documentation rendering feature.",
+						FullSynopsis: "Package permalink is for testing the heading permalink documentation rendering feature.",
+						HTML:         html("<h3 id=\"hdr-This_is_a_heading\">This is a heading<a href=\"#hdr-This_is_a_heading\">¶</a></h3>"),
+					}},
 				},
 			},
 		},
@@ -575,10 +922,11 @@ var moduleDocTooLarge = &testModule{
 						Name: "bigdoc",
 						Path: "bigdoc.test",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "This documentation is big.",
-						HTML:     html(docTooLargeReplacement),
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "This documentation is big.",
+						FullSynopsis: "This documentation is big.",
+						HTML:         html(docTooLargeReplacement),
+					}},
 				},
 			},
 		},
@@ -593,6 +941,67 @@ var moduleDocTooLarge = &testModule{
 	},
 }
 
+var moduleCgo = &testModule{
+	mod: &proxy.Module{
+		ModulePath: "cgo.test",
+		Files: map[string]string{
+			"LICENSE": testhelper.BSD0License,
+			"cgo.go": `
+				// Package cgo uses cgo.
+				package cgo
+
+				/*
+				#include <stdlib.h>
+
+				int add(int a, int b) { return a + b; }
+				*/
+				import "C"
+
+				import "unsafe"
+
+				// Add adds two C ints.
+				//export Add
+				func Add(a, b C.int) C.int {
+					return C.add(a, b)
+				}
+
+				// Free frees p.
+				func Free(p unsafe.Pointer) {
+					C.free(p)
+				}
+
+				// CString is a C string.
+				type CString *C.char`,
+		},
+	},
+	fr: &FetchResult{
+		GoModPath: "cgo.test",
+		Module: &internal.Module{
+			LegacyModuleInfo: internal.LegacyModuleInfo{
+				ModuleInfo: internal.ModuleInfo{
+					ModulePath: "cgo.test",
+					HasGoMod:   false,
+				},
+			},
+			Units: []*internal.Unit{
+				{
+					UnitMeta: internal.UnitMeta{
+						Name: "cgo",
+						Path: "cgo.test",
+					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "Package cgo uses cgo.",
+						FullSynopsis: "Package cgo uses cgo.",
+						HTML: html("func Add(a, b C.int) C.int</pre>~<p>Add adds two C ints.\n</p>~" +
+							"type CString *C.char</pre>"),
+					}},
+					Imports: []string{"unsafe"},
+				},
+			},
+		},
+	},
+}
+
 var moduleWasm = &testModule{
 	mod: &proxy.Module{
 		ModulePath: "github.com/my/module/js",
@@ -633,11 +1042,12 @@ var moduleWasm = &testModule{
 						Name: "js",
 						Path: "github.com/my/module/js/js",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "Package js only works with wasm.",
-						GOOS:     "js",
-						GOARCH:   "wasm",
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "Package js only works with wasm.",
+						FullSynopsis: "Package js only works with wasm.",
+						GOOS:         "js",
+						GOARCH:       "wasm",
+					}},
 				},
 			},
 		},
@@ -689,9 +1099,10 @@ var moduleStd = &testModule{
 						Name: "builtin",
 						Path: "builtin",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "Package builtin provides documentation for Go's predeclared identifiers.",
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "Package builtin provides documentation for Go's predeclared identifiers.",
+						FullSynopsis: "Package builtin provides documentation for Go's predeclared identifiers.",
+					}},
 				},
 				{
 					UnitMeta: internal.UnitMeta{
@@ -707,8 +1118,17 @@ var moduleStd = &testModule{
 						Filepath: "cmd/pprof/README",
 						Contents: "This directory is the copy of Google's pprof shipped as part of the Go distribution.\n",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "Pprof interprets and displays profiles of Go programs.",
+					Documentation: []*internal.Documentation{
+						{
+							Synopsis:     "Pprof interprets and displays profiles of Go programs.",
+							FullSynopsis: "Pprof interprets and displays profiles of Go programs.",
+						},
+						{
+							GOOS:         "js",
+							GOARCH:       "wasm",
+							Synopsis:     "Pprof interprets and displays profiles of Go programs.",
+							FullSynopsis: "Pprof interprets and displays profiles of Go programs.",
+						},
 					},
 					Imports: []string{
 						"cmd/internal/objfile",
@@ -735,9 +1155,10 @@ var moduleStd = &testModule{
 						Name: "context",
 						Path: "context",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "Package context defines the Context type, which carries deadlines, cancelation signals, and other request-scoped values across API boundaries and between processes.",
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "Package context defines the Context type, which carries deadlines, cancelation signals, and other request-scoped values across API boundaries and between processes.",
+						FullSynopsis: "Package context defines the Context type, which carries deadlines, cancelation signals, and other request-scoped values across API boundaries and between processes.",
+					}},
 					Imports: []string{"errors", "fmt", "reflect", "sync", "time"},
 				},
 				{
@@ -750,9 +1171,10 @@ var moduleStd = &testModule{
 						Name: "json",
 						Path: "encoding/json",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "Package json implements encoding and decoding of JSON as defined in RFC 7159.",
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "Package json implements encoding and decoding of JSON as defined in RFC 7159.",
+						FullSynopsis: "Package json implements encoding and decoding of JSON as defined in RFC 7159.",
+					}},
 					Imports: []string{
 						"bytes",
 						"encoding",
@@ -776,9 +1198,10 @@ var moduleStd = &testModule{
 						Name: "errors",
 						Path: "errors",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "Package errors implements functions to manipulate errors.",
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "Package errors implements functions to manipulate errors.",
+						FullSynopsis: "Package errors implements functions to manipulate errors.",
+					}},
 				},
 				{
 					UnitMeta: internal.UnitMeta{
@@ -786,9 +1209,10 @@ var moduleStd = &testModule{
 						Path: "flag",
 					},
 					Imports: []string{"errors", "fmt", "io", "os", "reflect", "sort", "strconv", "strings", "time"},
-					Documentation: &internal.Documentation{
-						Synopsis: "Package flag implements command-line flag parsing.",
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "Package flag implements command-line flag parsing.",
+						FullSynopsis: "Package flag implements command-line flag parsing.",
+					}},
 				},
 			},
 		},
@@ -824,9 +1248,10 @@ var moduleMaster = &testModule{
 						Name: "foo",
 						Path: "github.com/my/module/foo",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "package foo exports a helpful constant.",
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "package foo exports a helpful constant.",
+						FullSynopsis: "package foo exports a helpful constant.",
+					}},
 				},
 			},
 		},
@@ -862,9 +1287,10 @@ var moduleLatest = &testModule{
 						Name: "foo",
 						Path: "github.com/my/module/foo",
 					},
-					Documentation: &internal.Documentation{
-						Synopsis: "package foo exports a helpful constant.",
-					},
+					Documentation: []*internal.Documentation{{
+						Synopsis:     "package foo exports a helpful constant.",
+						FullSynopsis: "package foo exports a helpful constant.",
+					}},
 				},
 			},
 		},
@@ -914,10 +1340,11 @@ package example_test
 							Name: "example",
 							Path: path + "/example",
 						},
-						Documentation: &internal.Documentation{
-							Synopsis: "Package example contains examples.",
-							HTML:     docHTML,
-						},
+						Documentation: []*internal.Documentation{{
+							Synopsis:     "Package example contains examples.",
+							FullSynopsis: "Package example contains examples.",
+							HTML:         docHTML,
+						}},
 					},
 				},
 			},
@@ -0,0 +1,94 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/safehtml"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/experiment"
+	"golang.org/x/pkgsite/internal/fetch/dochtml"
+)
+
+// RenderFullDocumentation renders the full documentation for doc, which
+// belongs to the package described by um. It is used for packages whose
+// stored documentation was abbreviated because it was too large; see
+// DocumentationCollapseThreshold. If doc has no source, its stored HTML is
+// returned.
+func RenderFullDocumentation(ctx context.Context, um *internal.UnitMeta, doc *internal.Documentation) (_ safehtml.HTML, err error) {
+	defer derrors.Wrap(&err, "RenderFullDocumentation(ctx, %q, %q, %q, %q)", um.Path, um.Version, doc.GOOS, doc.GOARCH)
+	if doc.Source == nil {
+		return doc.HTML, nil
+	}
+	files, err := unzipFiles(doc.Source)
+	if err != nil {
+		return safehtml.HTML{}, err
+	}
+	modInfo := &dochtml.ModuleInfo{
+		ModulePath:      um.ModulePath,
+		ResolvedVersion: um.Version,
+	}
+	innerPath := internal.Suffix(um.Path, um.ModulePath)
+	pkg, err := loadPackageWithBuildContext(ctx, doc.GOOS, doc.GOARCH, files, innerPath, um.SourceInfo, modInfo, false,
+		um.IsRedistributable && experiment.IsActive(ctx, internal.ExperimentDeclarationSource))
+	if pkg == nil && err == nil {
+		err = fmt.Errorf("no package in source: %w", derrors.NotFound)
+	}
+	if pkg == nil {
+		return safehtml.HTML{}, err
+	}
+	// If the documentation is too large, pkg has a replacement for it.
+	return pkg.DocumentationHTML, nil
+}
+
+// zipFiles returns a zip archive of files, which map file names to their
+// contents.
+func zipFiles(files map[string][]byte) (_ []byte, err error) {
+	defer derrors.Wrap(&err, "zipFiles")
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unzipFiles is the inverse of zipFiles.
+func unzipFiles(data []byte) (_ map[string][]byte, err error) {
+	defer derrors.Wrap(&err, "unzipFiles")
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		b, err := readZipFile(f, MaxFileSize)
+		if err != nil {
+			return nil, err
+		}
+		files[f.Name] = b
+	}
+	return files, nil
+}
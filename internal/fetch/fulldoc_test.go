@@ -0,0 +1,76 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/fetch/dochtml"
+)
+
+func TestRenderFullDocumentation(t *testing.T) {
+	defer func(old int) { DocumentationCollapseThreshold = old }(DocumentationCollapseThreshold)
+	DocumentationCollapseThreshold = 100
+
+	ctx := context.Background()
+	files := map[string][]byte{
+		"big.go": []byte(`// Package big has documentation.
+package big
+
+// T is a type. It has a field.
+type T struct {
+	// Field is documented.
+	Field int
+}
+`),
+	}
+	modInfo := &dochtml.ModuleInfo{ModulePath: "example.com/big", ResolvedVersion: "v1.0.0"}
+	pkg, err := loadPackageWithBuildContext(ctx, "linux", "amd64", files, "", nil, modInfo, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := pkg.Documentation[0]
+	if doc.Source == nil {
+		t.Fatal("got no source, want source of collapsed documentation")
+	}
+	html := doc.HTML.String()
+	if !strings.Contains(html, "Documentation-collapsed") || strings.Contains(html, "Field is documented") {
+		t.Errorf("got documentation\n%s\nwant collapsed documentation", html)
+	}
+	gotFiles, err := unzipFiles(doc.Source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(files, gotFiles); diff != "" {
+		t.Errorf("source mismatch (-want, +got):\n%s", diff)
+	}
+
+	um := &internal.UnitMeta{
+		Path:       "example.com/big",
+		ModulePath: "example.com/big",
+		Version:    "v1.0.0",
+	}
+	full, err := RenderFullDocumentation(ctx, um, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := loadPackageWithBuildContext(ctx, "linux", "amd64", files, "", nil, modInfo, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want.Documentation[0].Source != nil {
+		t.Error("got source for documentation that is not collapsed")
+	}
+	if got, want := full.String(), want.DocumentationHTML.String(); got != want {
+		t.Errorf("RenderFullDocumentation:\n%s\nwant\n%s", got, want)
+	}
+	if !strings.Contains(full.String(), "Field is documented") {
+		t.Errorf("RenderFullDocumentation:\n%s\nwant the full documentation", full)
+	}
+}
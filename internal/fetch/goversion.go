@@ -0,0 +1,107 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultGoVersion is the Go version that the go command assumes for a module
+// whose go.mod file has no go directive.
+const defaultGoVersion = "1.16"
+
+var (
+	// goVersionRE matches the versions that a go directive may declare, such
+	// as "1.16", "1.21.0" and "1.22rc1".
+	goVersionRE = regexp.MustCompile(`^[1-9][0-9]*\.(0|[1-9][0-9]*)(\.(0|[1-9][0-9]*))?((rc|beta)[1-9][0-9]*)?$`)
+
+	// toolchainRE matches the names that a toolchain directive may declare,
+	// such as "go1.21.3" or "go1.22rc1-custom", as well as "default".
+	toolchainRE = regexp.MustCompile(`^(default|go[1-9][0-9]*(\.(0|[1-9][0-9]*)){0,2}((rc|beta)[1-9][0-9]*)?(-[^\s]+)?)$`)
+)
+
+// parseGoDirectives returns the arguments of the go and toolchain directives of
+// the go.mod file with the given contents, or the empty string for a directive
+// that is missing. An argument that is not a valid Go version or toolchain
+// name is reported in invalid, and the empty string is returned for it.
+//
+// The version of golang.org/x/mod that this module uses cannot parse go.mod
+// files that declare a Go version of the form "1.21.0" or that have a
+// toolchain directive, so like modfile.ModulePath, parseGoDirectives scans the
+// lines of the file.
+func parseGoDirectives(goMod []byte) (goVersion, toolchain string, invalid []string) {
+	for len(goMod) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(goMod, '\n'); i >= 0 {
+			line, goMod = goMod[:i], goMod[i+1:]
+		} else {
+			line, goMod = goMod, nil
+		}
+		if i := bytes.Index(line, []byte("//")); i >= 0 {
+			line = line[:i]
+		}
+		f := strings.Fields(string(line))
+		if len(f) == 0 {
+			continue
+		}
+		switch f[0] {
+		case "go":
+			if len(f) != 2 || !goVersionRE.MatchString(f[1]) {
+				invalid = append(invalid, fmt.Sprintf("invalid go directive %q", strings.Join(f, " ")))
+				goVersion = ""
+				continue
+			}
+			goVersion = f[1]
+		case "toolchain":
+			if len(f) != 2 || !toolchainRE.MatchString(f[1]) {
+				invalid = append(invalid, fmt.Sprintf("invalid toolchain directive %q", strings.Join(f, " ")))
+				toolchain = ""
+				continue
+			}
+			toolchain = f[1]
+		}
+	}
+	return goVersion, toolchain, invalid
+}
+
+// releaseTags returns the release tags satisfied when building a package of a
+// module whose go.mod file declares goVersion: those of the Go version this
+// binary was built with, and "go1.1" through the minor version of goVersion,
+// since the go command builds the module with at least that version. A
+// module that declares no valid Go version is treated as declaring
+// defaultGoVersion.
+func releaseTags(goVersion string) []string {
+	tags := build.Default.ReleaseTags
+	if !goVersionRE.MatchString(goVersion) {
+		goVersion = defaultGoVersion
+	}
+	minor := goMinorVersion(goVersion)
+	if minor <= len(tags) || !strings.HasPrefix(goVersion, "1.") {
+		return tags
+	}
+	// build.Default.ReleaseTags are "go1.1" through "go1.N" for this binary's
+	// Go version 1.N.
+	all := append([]string(nil), tags...)
+	for i := len(tags) + 1; i <= minor; i++ {
+		all = append(all, fmt.Sprintf("go1.%d", i))
+	}
+	return all
+}
+
+// goMinorVersion returns the minor version of a Go version matched by
+// goVersionRE, such as 21 for "1.21.0" or "1.21rc1".
+func goMinorVersion(goVersion string) int {
+	v := goVersion[strings.IndexByte(goVersion, '.')+1:]
+	if i := strings.IndexAny(v, ".rb"); i >= 0 {
+		v = v[:i]
+	}
+	n, _ := strconv.Atoi(v)
+	return n
+}
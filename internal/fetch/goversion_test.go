@@ -0,0 +1,97 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"fmt"
+	"go/build"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseGoDirectives(t *testing.T) {
+	for _, test := range []struct {
+		name, goMod                  string
+		wantGoVersion, wantToolchain string
+		wantInvalid                  []string
+	}{
+		{
+			name:  "none",
+			goMod: "module m\n\nrequire example.com/go v1.0.0\n",
+		},
+		{
+			name:          "go only",
+			goMod:         "module m\n\ngo 1.16\n",
+			wantGoVersion: "1.16",
+		},
+		{
+			name:          "go and toolchain",
+			goMod:         "module m\n\ngo 1.21.0 // comment\n\ntoolchain go1.21.3\n",
+			wantGoVersion: "1.21.0",
+			wantToolchain: "go1.21.3",
+		},
+		{
+			name:          "prerelease and custom toolchain",
+			goMod:         "module m\ngo 1.22rc1\ntoolchain go1.22rc1-custom",
+			wantGoVersion: "1.22rc1",
+			wantToolchain: "go1.22rc1-custom",
+		},
+		{
+			name:          "commented out",
+			goMod:         "module m\n// go 1.14\ngo 1.13\n",
+			wantGoVersion: "1.13",
+		},
+		{
+			name:        "invalid",
+			goMod:       "module m\ngo 1.21.x\ntoolchain 1.21.3\n",
+			wantInvalid: []string{`invalid go directive "go 1.21.x"`, `invalid toolchain directive "toolchain 1.21.3"`},
+		},
+		{
+			name:        "extra argument",
+			goMod:       "module m\ngo 1.16 1.17\n",
+			wantInvalid: []string{`invalid go directive "go 1.16 1.17"`},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			gotGoVersion, gotToolchain, gotInvalid := parseGoDirectives([]byte(test.goMod))
+			if gotGoVersion != test.wantGoVersion || gotToolchain != test.wantToolchain {
+				t.Errorf("got go %q, toolchain %q; want go %q, toolchain %q",
+					gotGoVersion, gotToolchain, test.wantGoVersion, test.wantToolchain)
+			}
+			if diff := cmp.Diff(test.wantInvalid, gotInvalid); diff != "" {
+				t.Errorf("invalid mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReleaseTags(t *testing.T) {
+	n := len(build.Default.ReleaseTags)
+	defaultLast := build.Default.ReleaseTags[n-1]
+	for _, test := range []struct {
+		goVersion string
+		// The tags are "go1.1" through wantLast.
+		wantLast string
+	}{
+		{"", defaultLast},
+		{"1.16", defaultLast},
+		{"not a version", defaultLast},
+		{"1.99.0", "go1.99"},
+		{"1.99rc1", "go1.99"},
+	} {
+		got := releaseTags(test.goVersion)
+		want := make([]string, goMinorVersion(test.wantLast[len("go"):]))
+		for i := range want {
+			want[i] = fmt.Sprintf("go1.%d", i+1)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("releaseTags(%q) mismatch (-want +got):\n%s", test.goVersion, diff)
+		}
+	}
+	if got := len(build.Default.ReleaseTags); got != n {
+		t.Errorf("build.Default.ReleaseTags changed from %d tags to %d", n, got)
+	}
+}
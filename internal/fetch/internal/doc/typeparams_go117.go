@@ -0,0 +1,22 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !go1.18
+// +build !go1.18
+
+package doc
+
+import "go/ast"
+
+// funcTypeParams returns nil: type parameters cannot be represented before
+// Go 1.18.
+func funcTypeParams(t *ast.FuncType) *ast.FieldList {
+	return nil
+}
+
+// unpackIndexExpr reports false: generic instantiations cannot be
+// represented before Go 1.18.
+func unpackIndexExpr(x ast.Expr) (ast.Expr, []ast.Expr, bool) {
+	return nil, nil, false
+}
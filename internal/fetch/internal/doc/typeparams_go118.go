@@ -0,0 +1,28 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package doc
+
+import "go/ast"
+
+// funcTypeParams returns the type parameter list of t, or nil.
+func funcTypeParams(t *ast.FuncType) *ast.FieldList {
+	return t.TypeParams
+}
+
+// unpackIndexExpr returns the operand and the type arguments of an
+// instantiated generic type such as T[A] or T[A, B]. It reports false if x
+// is not such an expression.
+func unpackIndexExpr(x ast.Expr) (ast.Expr, []ast.Expr, bool) {
+	switch t := x.(type) {
+	case *ast.IndexExpr:
+		return t.X, []ast.Expr{t.Index}, true
+	case *ast.IndexListExpr:
+		return t.X, t.Indices, true
+	}
+	return nil, nil, false
+}
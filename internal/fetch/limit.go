@@ -4,9 +4,15 @@
 
 package fetch
 
+import (
+	"archive/zip"
+	"fmt"
+
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
 // Limits for discovery worker.
 const (
-	maxPackagesPerModule = 10000
 	maxImportsPerPackage = 1000
 
 	// MaxFileSize is the maximum filesize that is allowed for reading.
@@ -15,6 +21,75 @@ const (
 	MaxFileSize = 30 * megabyte
 )
 
+// MaxModuleZipSize, MaxModuleUncompressedSize and MaxModuleFiles limit the
+// modules that are fetched from the proxy: the size of the module zip, the
+// total uncompressed size of the files in it, and their number. A module that
+// exceeds any of them fails to fetch with derrors.ModuleTooLarge.
+//
+// They are variables so that they can be configured; see SetModuleLimits.
+var (
+	MaxModuleZipSize          int64 = 300 * megabyte
+	MaxModuleUncompressedSize int64 = 500 * megabyte
+	MaxModuleFiles                  = 100000
+)
+
+// SetModuleLimits sets MaxModuleZipSize, MaxModuleUncompressedSize and
+// MaxModuleFiles to the given values. Limits that are not positive are left
+// unchanged.
+func SetModuleLimits(zipSize, uncompressedSize int64, files int) {
+	if zipSize > 0 {
+		MaxModuleZipSize = zipSize
+	}
+	if uncompressedSize > 0 {
+		MaxModuleUncompressedSize = uncompressedSize
+	}
+	if files > 0 {
+		MaxModuleFiles = files
+	}
+}
+
+// MaxModulePackages limits the number of packages that are processed for a
+// module. A module with more packages fails to fetch with
+// derrors.ModuleTooManyPackages, unless TruncateModulePackages is true, in
+// which case only the first MaxModulePackages of them, in path order, are
+// processed.
+//
+// They are variables so that they can be configured; see SetPackageLimits.
+var (
+	MaxModulePackages      = 10000
+	TruncateModulePackages = false
+)
+
+// SetPackageLimits sets MaxModulePackages to maxPackages, unless it is not
+// positive, and TruncateModulePackages to truncate.
+func SetPackageLimits(maxPackages int, truncate bool) {
+	if maxPackages > 0 {
+		MaxModulePackages = maxPackages
+	}
+	TruncateModulePackages = truncate
+}
+
+// checkModuleLimits returns an error wrapping derrors.ModuleTooLarge if the
+// module zip r has more than MaxModuleFiles files, or if their total
+// uncompressed size, according to the zip directory, is more than
+// MaxModuleUncompressedSize. Reading any single file is further limited by
+// MaxFileSize.
+func checkModuleLimits(r *zip.Reader) error {
+	if len(r.File) > MaxModuleFiles {
+		return fmt.Errorf("module has %d files, more than the limit of %d: %w",
+			len(r.File), MaxModuleFiles, derrors.ModuleTooLarge)
+	}
+	var size uint64
+	for _, f := range r.File {
+		size += f.UncompressedSize64
+		if size > uint64(MaxModuleUncompressedSize) {
+			return fmt.Errorf("module files are larger than the limit of %d bytes: %w",
+				MaxModuleUncompressedSize, derrors.ModuleTooLarge)
+		}
+	}
+	return nil
+}
+
 // MaxDocumentationHTML is a limit on the rendered documentation HTML size.
 //
 // The current limit of is based on the largest packages that
@@ -23,4 +98,22 @@ const (
 // It is a variable for testing.
 var MaxDocumentationHTML = 20 * megabyte
 
+// DocumentationCollapseThreshold is the rendered documentation HTML size
+// above which only abbreviated documentation is stored, along with the
+// package's source files so that the full documentation can be rendered on
+// demand. See dochtml.RenderOptions.Collapsed.
+//
+// It is a variable for testing.
+var DocumentationCollapseThreshold = 1 * megabyte
+
+// MaxSynopsisLength is the maximum length in bytes of the synopsis displayed
+// for a package. See dochtml.TruncateSynopsis.
+//
+// It is a variable for testing.
+var MaxSynopsisLength = 200
+
+// TrimSynopsisPackageName reports whether a leading "Package <name>" is
+// removed from displayed synopses. See dochtml.TrimPackageName.
+var TrimSynopsisPackageName = false
+
 const megabyte = 1000 * 1000
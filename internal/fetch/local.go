@@ -0,0 +1,128 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	modzip "golang.org/x/mod/zip"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// LocalCommitTime is the commit time of modules fetched from local
+// directories, which have no commit.
+var LocalCommitTime = time.Time{}
+
+// LocalVersion returns the version of the module with modulePath when it is
+// fetched from a local directory: v0.0.0, or the first release of the major
+// version that the path requires, such as v2.0.0 for a path ending in /v2.
+func LocalVersion(modulePath string) string {
+	if _, pathMajor, ok := module.SplitPathVersion(modulePath); ok && pathMajor != "" {
+		return module.PathMajorPrefix(pathMajor) + ".0.0"
+	}
+	return "v0.0.0"
+}
+
+// FetchLocalModule fetches the module in the directory dir, which is not
+// downloaded from anywhere, and processes it as FetchModule processes modules.
+// The version of the module is LocalVersion, and it has no source links.
+//
+// If modulePath is empty, dir must have a go.mod file, which gives the module
+// path. Otherwise the go.mod file of dir, if any, must declare modulePath, as
+// the go command requires of the directory that a replace directive names.
+// Nested modules, which are directories below dir with their own go.mod
+// files, are not part of the module.
+func FetchLocalModule(ctx context.Context, modulePath, dir string) (fr *FetchResult) {
+	fr = &FetchResult{ModulePath: modulePath}
+	p := newProgress()
+	p.begin(PhaseDownload)
+	defer func() {
+		p.end()
+		fr.Timings = p.timings
+		fr.PackageTimings = p.packageTimings
+		fr.MaxAlloc = p.maxAlloc
+		if fr.Error != nil {
+			derrors.Wrap(&fr.Error, "FetchLocalModule(%q, %q)", modulePath, dir)
+			fr.Status = derrors.ToStatus(fr.Error)
+		}
+		if fr.Status == 0 {
+			fr.Status = http.StatusOK
+		}
+	}()
+
+	goModBytes, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if os.IsNotExist(err) && modulePath != "" {
+		goModBytes = defaultGoMod(modulePath)
+	} else if err != nil {
+		fr.Error = err
+		return fr
+	}
+	if fr.ModulePath == "" {
+		fr.ModulePath = modfile.ModulePath(goModBytes)
+	}
+	fr.ResolvedVersion = LocalVersion(fr.ModulePath)
+	fr.RequestedVersion = fr.ResolvedVersion
+	// Retractions only apply to published versions.
+	if _, err := processGoMod(ctx, fr, goModBytes); err != nil {
+		fr.Error = err
+		return fr
+	}
+	f, err := ioutil.TempFile("", "module-*.zip")
+	if err != nil {
+		fr.Error = err
+		return fr
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+	zipReader, err := createLocalZip(f, fr.ModulePath, fr.ResolvedVersion, dir)
+	if err != nil {
+		fr.Error = err
+		return fr
+	}
+	if err := checkModuleLimits(zipReader); err != nil {
+		fr.Error = err
+		return fr
+	}
+	fr.NumZipFiles = len(zipReader.File)
+	for _, f := range zipReader.File {
+		fr.ZipSize += int64(f.CompressedSize64)
+	}
+	p.begin(PhaseExtract)
+	if err := processModule(ctx, fr, LocalCommitTime, zipReader, nil, nil, nil, p); err != nil {
+		fr.Error = err
+		return fr
+	}
+	return fr
+}
+
+// createLocalZip writes the module zip of the files of the module version in
+// dir to f, and returns a reader for it.
+func createLocalZip(f *os.File, modulePath, version, dir string) (_ *zip.Reader, err error) {
+	defer derrors.Wrap(&err, "createLocalZip(%q, %q, %q)", modulePath, version, dir)
+
+	if err := modzip.CreateFromDir(f, module.Version{Path: modulePath, Version: version}, dir); err != nil {
+		return nil, fmt.Errorf("%v: %w", err, derrors.BadModuleZip)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	zipReader, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return nil, fmt.Errorf("zip.NewReader: %v: %w", err, derrors.BadModuleZip)
+	}
+	return zipReader, nil
+}
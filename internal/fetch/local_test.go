@@ -0,0 +1,125 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/testing/testhelper"
+)
+
+// writeLocalModules writes files, keyed by slash-separated paths, to a new
+// temporary directory, and returns the directory and a function that removes
+// it.
+func writeLocalModules(t *testing.T, files map[string]string) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "local-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestFetchLocalModule(t *testing.T) {
+	dir, cleanup := writeLocalModules(t, map[string]string{
+		"go.mod":        "module example.com/local\n\ngo 1.14\n",
+		"LICENSE":       testhelper.MITLicense,
+		"local.go":      "// Package local is in a directory.\npackage local\n",
+		"sub/sub.go":    "package sub\n",
+		"nested/go.mod": "module example.com/local/nested\n",
+		"nested/a.go":   "package nested\n",
+		"v2/go.mod":     "module example.com/local/v2\n",
+		"v2/v2.go":      "package local\n",
+		"v2/LICENSE":    testhelper.MITLicense,
+		"nogomod/a.go":  "package nogomod\n",
+	})
+	defer cleanup()
+
+	localUnits := []string{"example.com/local", "example.com/local/nogomod", "example.com/local/sub"}
+	for _, test := range []struct {
+		name, modulePath, dir string
+		wantModulePath        string
+		wantVersion           string
+		wantUnits             []string
+	}{
+		// Nested modules are not part of the module.
+		{"path from go.mod", "", ".", "example.com/local", "v0.0.0", localUnits},
+		{"path given", "example.com/local", ".", "example.com/local", "v0.0.0", localUnits},
+		{"major version", "", "v2", "example.com/local/v2", "v2.0.0", []string{"example.com/local/v2"}},
+		// A directory without a go.mod file has the path it is given.
+		{"no go.mod", "example.com/other", "nogomod", "example.com/other", "v0.0.0", []string{"example.com/other"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fr := FetchLocalModule(context.Background(), test.modulePath, filepath.Join(dir, test.dir))
+			if fr.Error != nil {
+				t.Fatal(fr.Error)
+			}
+			if fr.Status != http.StatusOK || fr.ModulePath != test.wantModulePath || fr.ResolvedVersion != test.wantVersion {
+				t.Errorf("got status %d, module %s@%s; want %d, %s@%s",
+					fr.Status, fr.ModulePath, fr.ResolvedVersion, http.StatusOK, test.wantModulePath, test.wantVersion)
+			}
+			if !fr.Module.CommitTime.Equal(LocalCommitTime) || fr.Module.SourceInfo != nil {
+				t.Errorf("got commit time %s and source info %v; want %s and none", fr.Module.CommitTime, fr.Module.SourceInfo, LocalCommitTime)
+			}
+			var gotUnits []string
+			for _, u := range fr.Module.Units {
+				gotUnits = append(gotUnits, u.Path)
+			}
+			sort.Strings(gotUnits)
+			if diff := cmp.Diff(test.wantUnits, gotUnits); diff != "" {
+				t.Errorf("units mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFetchLocalModuleErrors(t *testing.T) {
+	dir, cleanup := writeLocalModules(t, map[string]string{
+		"go.mod":       "module example.com/local\n",
+		"local.go":     "package local\n",
+		"nogomod/a.go": "package nogomod\n",
+		"empty/go.mod": "module example.com/empty\n",
+	})
+	defer cleanup()
+
+	for _, test := range []struct {
+		modulePath, dir string
+		wantErr         error
+	}{
+		{"example.com/other", ".", derrors.AlternativeModule},
+		{"example.com/Local", ".", derrors.ModulePathCasing},
+		{"", "empty", derrors.ModuleHasNoPackages},
+		{"", "missing", nil},
+		// Without a go.mod file, the module path must be given.
+		{"", "nogomod", nil},
+	} {
+		fr := FetchLocalModule(context.Background(), test.modulePath, filepath.Join(dir, test.dir))
+		if fr.Error == nil {
+			t.Errorf("FetchLocalModule(%q, %q): got no error", test.modulePath, test.dir)
+			continue
+		}
+		if test.wantErr != nil && !errors.Is(fr.Error, test.wantErr) {
+			t.Errorf("FetchLocalModule(%q, %q): got error %v, want %v", test.modulePath, test.dir, fr.Error, test.wantErr)
+		}
+	}
+}
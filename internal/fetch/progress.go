@@ -0,0 +1,128 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// The phases of a fetch, which key FetchResult.Timings and are named by
+// PhaseError.
+const (
+	// PhaseDownload is resolving the version and downloading the go.mod file
+	// and the zip of the module.
+	PhaseDownload = "download"
+	// PhaseChecksum is verifying the zip against the checksum database.
+	PhaseChecksum = "checksum"
+	// PhaseExtract is checking the files of the zip, looking up the source
+	// of the module and reading its READMEs.
+	PhaseExtract = "extract"
+	// PhaseLicenses is detecting the licenses of the module.
+	PhaseLicenses = "licenses"
+	// PhaseDocs is loading the packages of the module and rendering their
+	// documentation, one package at a time.
+	PhaseDocs = "docs"
+)
+
+// A PhaseError is the error of a fetch that was canceled, or whose deadline
+// passed, before it completed. It says what the fetch was doing at the time.
+type PhaseError struct {
+	// Phase is the phase of the fetch, such as PhaseDocs.
+	Phase string
+	// Package is the path of the package being processed, if any. Since
+	// packages are processed until they are done, it is the package during
+	// which the context was done.
+	Package string
+	// Err wraps the error of the context.
+	Err error
+}
+
+func (e *PhaseError) Error() string {
+	if e.Package != "" {
+		return fmt.Sprintf("%s phase, package %s: %v", e.Phase, e.Package, e.Err)
+	}
+	return fmt.Sprintf("%s phase: %v", e.Phase, e.Err)
+}
+
+func (e *PhaseError) Unwrap() error {
+	return e.Err
+}
+
+// progress tracks the phases of a fetch and the time spent in each, and
+// the package being processed or processed last. It also samples the
+// allocated heap memory at the start and end of each phase.
+type progress struct {
+	phase      string
+	phaseStart time.Time
+	pkg        string
+	pkgStart   time.Time
+	maxAlloc   uint64 // largest sample of allocated heap bytes
+
+	timings        map[string]time.Duration // by phase
+	packageTimings map[string]time.Duration // by package path
+}
+
+func newProgress() *progress {
+	return &progress{
+		timings:        map[string]time.Duration{},
+		packageTimings: map[string]time.Duration{},
+	}
+}
+
+// begin ends the current phase, if any, and starts phase.
+func (p *progress) begin(phase string) {
+	p.end()
+	p.sampleAlloc()
+	p.phase = phase
+	p.phaseStart = time.Now()
+	p.pkg = ""
+}
+
+// end ends the current phase, if any, and records its duration.
+func (p *progress) end() {
+	if p.phase == "" {
+		return
+	}
+	p.timings[p.phase] += time.Since(p.phaseStart)
+	p.phase = ""
+	p.sampleAlloc()
+}
+
+// sampleAlloc records the allocated heap memory, if it is the most seen so
+// far. Reading it stops the world briefly, so it is only done between
+// phases.
+func (p *progress) sampleAlloc() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	if ms.HeapAlloc > p.maxAlloc {
+		p.maxAlloc = ms.HeapAlloc
+	}
+}
+
+// beginPackage records that processing of the package pkgPath started.
+func (p *progress) beginPackage(pkgPath string) {
+	p.pkg = pkgPath
+	p.pkgStart = time.Now()
+}
+
+// endPackage records that the current package has been processed, and its
+// duration.
+func (p *progress) endPackage() {
+	p.packageTimings[p.pkg] = time.Since(p.pkgStart)
+}
+
+// phaseError returns a *PhaseError for err, the error of a fetch whose
+// context ctx is done, naming the current phase and package. The
+// *PhaseError wraps the error of ctx.
+func (p *progress) phaseError(ctx context.Context, err error) error {
+	if !errors.Is(err, ctx.Err()) {
+		err = fmt.Errorf("%v: %w", err, ctx.Err())
+	}
+	return &PhaseError{Phase: p.phase, Package: p.pkg, Err: err}
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/proxy"
+	"golang.org/x/pkgsite/internal/source"
+	"golang.org/x/pkgsite/internal/testing/testhelper"
+)
+
+// cancelingCache is a PackageCache that has no packages, and cancels a fetch
+// when the first package is looked up.
+type cancelingCache struct {
+	cancel func()
+	first  string // path of the first package looked up
+}
+
+func (c *cancelingCache) GetUnitByContentHash(ctx context.Context, pkgPath, contentHash string) (*internal.Unit, error) {
+	if c.first == "" {
+		c.first = pkgPath
+		c.cancel()
+	}
+	return nil, derrors.NotFound
+}
+
+func TestFetchModuleCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	const modulePath = "github.com/my/module"
+	proxyClient, teardownProxy := proxy.SetupTestClient(t, []*proxy.Module{{
+		ModulePath: modulePath,
+		Files: map[string]string{
+			"LICENSE": testhelper.MITLicense,
+			"a/a.go":  "package a",
+			"b/b.go":  "package b",
+		},
+	}})
+	defer teardownProxy()
+	sourceClient := source.NewClient(sourceTimeout)
+
+	fetchCtx, fetchCancel := context.WithCancel(ctx)
+	defer fetchCancel()
+	cache := &cancelingCache{cancel: fetchCancel}
+	got := FetchModuleWithCache(fetchCtx, modulePath, "v1.0.0", proxyClient, sourceClient, cache)
+	if !errors.Is(got.Error, context.Canceled) {
+		t.Fatalf("got error %v, want %v", got.Error, context.Canceled)
+	}
+	var pe *PhaseError
+	if !errors.As(got.Error, &pe) {
+		t.Fatalf("got error %v, want a *PhaseError", got.Error)
+	}
+	// The package that was being processed when the fetch was canceled is
+	// completed, and the fetch stops before the other package.
+	if pe.Phase != PhaseDocs || pe.Package != cache.first {
+		t.Errorf("got phase %q, package %q; want %q, %q", pe.Phase, pe.Package, PhaseDocs, cache.first)
+	}
+	if _, ok := got.PackageTimings[cache.first]; !ok || len(got.PackageTimings) != 1 {
+		t.Errorf("got package timings %v, want only %s", got.PackageTimings, cache.first)
+	}
+	for _, phase := range []string{PhaseDownload, PhaseExtract, PhaseLicenses, PhaseDocs} {
+		if _, ok := got.Timings[phase]; !ok {
+			t.Errorf("no timing for phase %q", phase)
+		}
+	}
+	if got.NumZipFiles != 3 || got.ZipSize == 0 || got.MaxAlloc == 0 {
+		t.Errorf("got %d zip files of size %d, max alloc %d; want 3 files and non-zero sizes", got.NumZipFiles, got.ZipSize, got.MaxAlloc)
+	}
+}
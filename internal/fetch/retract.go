@@ -0,0 +1,198 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/log"
+	"golang.org/x/pkgsite/internal/proxy"
+)
+
+// LatestModuleVersions returns the latest version of the module at
+// modulePath, as reported by the proxy or, for modules fetched directly, by
+// the tags of its repository, along with the deprecation message and
+// retractions in the go.mod file of that version and the latest version that
+// the retractions leave.
+//
+// If the go.mod file cannot be parsed, the error is logged and the module is
+// treated as retracting nothing.
+func LatestModuleVersions(ctx context.Context, modulePath string, proxyClient *proxy.Client) (_ *internal.LatestModuleVersions, err error) {
+	defer derrors.Wrap(&err, "LatestModuleVersions(%q)", modulePath)
+
+	if r := lookupDirectRepo(modulePath); r != nil {
+		return r.latest(ctx, modulePath)
+	}
+	info, err := proxyClient.GetInfo(ctx, modulePath, internal.LatestVersion)
+	if err != nil {
+		return nil, err
+	}
+	goMod, err := proxyClient.GetMod(ctx, modulePath, info.Version)
+	if err != nil {
+		return nil, err
+	}
+	return latestModuleVersions(ctx, modulePath, info.Version, goMod, func() ([]string, error) {
+		return proxyClient.ListVersions(ctx, modulePath)
+	})
+}
+
+// latestModuleVersions returns the LatestModuleVersions of the module at
+// modulePath, given its latest version and the contents of the go.mod file of
+// that version. listVersions is called to list the versions of the module
+// only if the latest version retracts itself.
+func latestModuleVersions(ctx context.Context, modulePath, latest string, goMod []byte, listVersions func() ([]string, error)) (_ *internal.LatestModuleVersions, err error) {
+	lmv := &internal.LatestModuleVersions{
+		ModulePath:  modulePath,
+		RawVersion:  latest,
+		GoodVersion: latest,
+	}
+	lmv.Deprecation = parseDeprecation(goMod)
+	lmv.Retractions, err = parseRetractions(goMod)
+	if err != nil {
+		log.Infof(ctx, "ignoring retractions of %s@%s: %v", modulePath, latest, err)
+		return lmv, nil
+	}
+	if _, ok := lmv.Retraction(lmv.RawVersion); !ok {
+		return lmv, nil
+	}
+	// The latest version retracts itself. Fall back to the latest version
+	// that isn't retracted.
+	versions, err := listVersions()
+	if err != nil {
+		return nil, err
+	}
+	lmv.GoodVersion = latestUnretracted(versions, lmv)
+	return lmv, nil
+}
+
+// latestUnretracted returns the highest of versions that lmv does not retract,
+// preferring releases to pre-releases, or the empty string if there is none.
+func latestUnretracted(versions []string, lmv *internal.LatestModuleVersions) string {
+	var unretracted []string
+	for _, v := range versions {
+		if _, ok := lmv.Retraction(v); !ok {
+			unretracted = append(unretracted, v)
+		}
+	}
+	return latestVersion(unretracted)
+}
+
+// latestVersion returns the highest of versions, preferring releases to
+// pre-releases, or the empty string if there is none. Invalid versions are
+// ignored.
+func latestVersion(versions []string) string {
+	var latestRelease, latestPrerelease string
+	for _, v := range versions {
+		if !semver.IsValid(v) {
+			continue
+		}
+		if semver.Prerelease(v) != "" {
+			if semver.Compare(v, latestPrerelease) > 0 {
+				latestPrerelease = v
+			}
+		} else if semver.Compare(v, latestRelease) > 0 {
+			latestRelease = v
+		}
+	}
+	if latestRelease != "" {
+		return latestRelease
+	}
+	return latestPrerelease
+}
+
+// parseRetractions returns the retract directives of the go.mod file with the
+// given contents, in the order they appear. A range of versions is written
+// "[low, high]". The rationale of a retraction is the text of the comments
+// immediately before the directive or at the end of its line, or, for a
+// directive in a block without comments of its own, those of the block.
+//
+// The version of golang.org/x/mod that this module uses predates retract
+// directives, so they are read from the syntax tree of the file.
+func parseRetractions(goMod []byte) (_ []internal.RetractedVersion, err error) {
+	defer derrors.Wrap(&err, "parseRetractions")
+
+	f, err := modfile.ParseLax("go.mod", goMod, nil)
+	if err != nil {
+		return nil, err
+	}
+	var rvs []internal.RetractedVersion
+	add := func(tokens []string, comments ...*modfile.Comments) error {
+		rv, err := parseRetraction(tokens)
+		if err != nil {
+			return err
+		}
+		for _, c := range comments {
+			if rv.Rationale = directiveComment(c); rv.Rationale != "" {
+				break
+			}
+		}
+		rvs = append(rvs, rv)
+		return nil
+	}
+	for _, stmt := range f.Syntax.Stmt {
+		switch x := stmt.(type) {
+		case *modfile.Line:
+			if len(x.Token) > 0 && x.Token[0] == "retract" {
+				if err := add(x.Token[1:], &x.Comments); err != nil {
+					return nil, err
+				}
+			}
+		case *modfile.LineBlock:
+			if len(x.Token) == 1 && x.Token[0] == "retract" {
+				for _, l := range x.Line {
+					if err := add(l.Token, &l.Comments, &x.Comments); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+	return rvs, nil
+}
+
+// parseRetraction parses the arguments of a retract directive, which are
+// either a single version or a range of the form "[", low, ",", high, "]".
+// Like the go command, it requires versions to be canonical.
+func parseRetraction(tokens []string) (internal.RetractedVersion, error) {
+	var rv internal.RetractedVersion
+	switch {
+	case len(tokens) == 1:
+		rv.Version = tokens[0]
+	case len(tokens) == 5 && tokens[0] == "[" && tokens[2] == "," && tokens[4] == "]":
+		rv.Version, rv.High = tokens[1], tokens[3]
+	default:
+		return rv, fmt.Errorf("retract %s: want a version or a range [low, high]", strings.Join(tokens, " "))
+	}
+	for _, v := range []string{rv.Version, rv.High} {
+		if v != "" && module.CanonicalVersion(v) != v {
+			return rv, fmt.Errorf("retract: invalid version %q", v)
+		}
+	}
+	if rv.High != "" && semver.Compare(rv.Version, rv.High) > 0 {
+		return rv, fmt.Errorf("retract [%s, %s]: version range is empty", rv.Version, rv.High)
+	}
+	return rv, nil
+}
+
+// directiveComment returns the text of the comments before and after a
+// directive, joined by newlines.
+func directiveComment(c *modfile.Comments) string {
+	var lines []string
+	for _, group := range [][]modfile.Comment{c.Before, c.Suffix} {
+		for _, com := range group {
+			if strings.HasPrefix(com.Token, "//") {
+				lines = append(lines, strings.TrimSpace(strings.TrimPrefix(com.Token, "//")))
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/proxy"
+)
+
+func TestParseRetractions(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		goMod string
+		want  []internal.RetractedVersion
+	}{
+		{
+			name:  "no retractions",
+			goMod: "module m\n",
+		},
+		{
+			name: "single versions",
+			goMod: `module m
+
+// Published accidentally.
+retract v1.0.0
+retract v1.0.1 // Contains a bug.
+retract v1.0.2
+`,
+			want: []internal.RetractedVersion{
+				{Version: "v1.0.0", Rationale: "Published accidentally."},
+				{Version: "v1.0.1", Rationale: "Contains a bug."},
+				{Version: "v1.0.2"},
+			},
+		},
+		{
+			name: "range",
+			goMod: `module m
+
+retract [v1.1.0, v1.1.9] // Broken build.
+`,
+			want: []internal.RetractedVersion{
+				{Version: "v1.1.0", High: "v1.1.9", Rationale: "Broken build."},
+			},
+		},
+		{
+			name: "block",
+			goMod: `module m
+
+// Security problems.
+retract (
+	v1.0.0
+	// Incomplete.
+	[v1.2.0, v1.2.3]
+)
+`,
+			want: []internal.RetractedVersion{
+				{Version: "v1.0.0", Rationale: "Security problems."},
+				{Version: "v1.2.0", High: "v1.2.3", Rationale: "Incomplete."},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseRetractions([]byte(test.goMod))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseRetractionsError(t *testing.T) {
+	for _, goMod := range []string{
+		"module m\nretract v1\n",
+		"module m\nretract [v1.2.0, v1.1.0]\n",
+		"module m\nretract [v1.0.0 v1.1.0]\n",
+		"module m\nretract v1.0.0 v1.1.0\n",
+	} {
+		if _, err := parseRetractions([]byte(goMod)); err == nil {
+			t.Errorf("parseRetractions(%q): got nil error, want non-nil", goMod)
+		}
+	}
+}
+
+func TestLatestModuleVersions(t *testing.T) {
+	const modulePath = "example.com/retract"
+	goMod := func(retractions string) map[string]string {
+		return map[string]string{"go.mod": "module " + modulePath + "\n\n" + retractions}
+	}
+	for _, test := range []struct {
+		name    string
+		modules []*proxy.Module
+		want    *internal.LatestModuleVersions
+	}{
+		{
+			name: "no retractions",
+			modules: []*proxy.Module{
+				{ModulePath: modulePath, Version: "v1.0.0"},
+				{ModulePath: modulePath, Version: "v1.1.0"},
+			},
+			want: &internal.LatestModuleVersions{
+				ModulePath:  modulePath,
+				RawVersion:  "v1.1.0",
+				GoodVersion: "v1.1.0",
+			},
+		},
+		{
+			name: "earlier version retracted",
+			modules: []*proxy.Module{
+				{ModulePath: modulePath, Version: "v1.0.0"},
+				{ModulePath: modulePath, Version: "v1.1.0", Files: goMod("retract v1.0.0 // Broken.\n")},
+			},
+			want: &internal.LatestModuleVersions{
+				ModulePath:  modulePath,
+				RawVersion:  "v1.1.0",
+				GoodVersion: "v1.1.0",
+				Retractions: []internal.RetractedVersion{{Version: "v1.0.0", Rationale: "Broken."}},
+			},
+		},
+		{
+			name: "latest version retracts itself",
+			modules: []*proxy.Module{
+				{ModulePath: modulePath, Version: "v1.0.0"},
+				{ModulePath: modulePath, Version: "v1.1.0"},
+				{ModulePath: modulePath, Version: "v1.2.0-pre"},
+				{ModulePath: modulePath, Version: "v1.2.0", Files: goMod("retract [v1.1.0, v1.2.0]\n")},
+			},
+			want: &internal.LatestModuleVersions{
+				ModulePath:  modulePath,
+				RawVersion:  "v1.2.0",
+				GoodVersion: "v1.0.0",
+				Retractions: []internal.RetractedVersion{{Version: "v1.1.0", High: "v1.2.0"}},
+			},
+		},
+		{
+			name: "every version retracted",
+			modules: []*proxy.Module{
+				{ModulePath: modulePath, Version: "v1.0.0"},
+				{ModulePath: modulePath, Version: "v1.1.0", Files: goMod("retract [v1.0.0, v1.1.0]\n")},
+			},
+			want: &internal.LatestModuleVersions{
+				ModulePath:  modulePath,
+				RawVersion:  "v1.1.0",
+				GoodVersion: "",
+				Retractions: []internal.RetractedVersion{{Version: "v1.0.0", High: "v1.1.0"}},
+			},
+		},
+		{
+			name: "deprecated",
+			modules: []*proxy.Module{
+				{ModulePath: modulePath, Version: "v1.0.0"},
+				{ModulePath: modulePath, Version: "v1.1.0", Files: map[string]string{
+					"go.mod": "// Deprecated: use example.com/new.\nmodule " + modulePath + "\n",
+				}},
+			},
+			want: &internal.LatestModuleVersions{
+				ModulePath:  modulePath,
+				RawVersion:  "v1.1.0",
+				GoodVersion: "v1.1.0",
+				Deprecation: "use example.com/new.",
+			},
+		},
+		{
+			name: "invalid retraction",
+			modules: []*proxy.Module{
+				{ModulePath: modulePath, Version: "v1.0.0"},
+				{ModulePath: modulePath, Version: "v1.1.0", Files: goMod("retract [v1.1.0, v1.0.0]\n")},
+			},
+			want: &internal.LatestModuleVersions{
+				ModulePath:  modulePath,
+				RawVersion:  "v1.1.0",
+				GoodVersion: "v1.1.0",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			proxyClient, teardownProxy := proxy.SetupTestClient(t, test.modules)
+			defer teardownProxy()
+
+			got, err := LatestModuleVersions(context.Background(), modulePath, proxyClient)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
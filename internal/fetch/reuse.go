@@ -0,0 +1,316 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/safehtml/template"
+	"github.com/google/safehtml/uncheckedconversions"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/experiment"
+	"golang.org/x/pkgsite/internal/fetch/dochtml"
+	"golang.org/x/pkgsite/internal/licenses"
+	"golang.org/x/pkgsite/internal/log"
+	"golang.org/x/pkgsite/internal/source"
+	"golang.org/x/pkgsite/internal/stdlib"
+)
+
+var (
+	keyPackageCacheHit  = tag.MustNewKey("fetch.package_cache.hit")
+	packageCacheResults = stats.Int64(
+		"go-discovery/fetch/package_cache_result_count",
+		"The result of looking up a package in another version of its module.",
+		stats.UnitDimensionless,
+	)
+
+	// PackageCacheResultCount is a view of package cache lookups, by whether
+	// they were a hit. A miss means that the package was rendered.
+	PackageCacheResultCount = &view.View{
+		Name:        "go-discovery/fetch/package_cache_result_count",
+		Measure:     packageCacheResults,
+		Aggregation: view.Count(),
+		Description: "package cache results, by whether it was a hit",
+		TagKeys:     []tag.Key{keyPackageCacheHit},
+	}
+)
+
+func recordPackageCacheResult(ctx context.Context, hit bool) {
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(keyPackageCacheHit, strconv.FormatBool(hit)),
+	}, packageCacheResults.M(1))
+}
+
+// A PackageCache looks up packages that were processed for other versions of
+// their module, so that a package whose content is unchanged need not be
+// processed again.
+type PackageCache interface {
+	// GetUnitByContentHash returns a package at pkgPath whose ContentHash
+	// is contentHash, with its Name, ModulePath, Version, Documentation,
+	// including its Source, and Imports. It returns an error wrapping
+	// derrors.NotFound if there is none.
+	GetUnitByContentHash(ctx context.Context, pkgPath, contentHash string) (*internal.Unit, error)
+}
+
+// contentHashSalt returns a hash of the properties of the module being
+// processed, other than its version and source location, that the
+// documentation of all of its packages depends on: the Go version declared by
+// its go.mod file, its licenses, the set of its packages, which documentation
+// links to, and the options that documentation is rendered with.
+func contentHashSalt(ctx context.Context, goVersion string, d *licenses.Detector, modInfo *dochtml.ModuleInfo) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "module %s\ngo %s\n", modInfo.ModulePath, goVersion)
+	if d != nil { //  should only be nil for tests
+		for _, l := range d.AllLicenses() {
+			fmt.Fprintf(h, "license %s %q\n", l.FilePath, l.Types)
+			writeHashedFile(h, l.FilePath, l.Contents)
+		}
+	}
+	var pkgs []string
+	for p := range modInfo.ModulePackages {
+		pkgs = append(pkgs, p)
+	}
+	sort.Strings(pkgs)
+	for _, p := range pkgs {
+		fmt.Fprintf(h, "package %s\n", p)
+	}
+	for _, bc := range internal.BuildContexts {
+		fmt.Fprintf(h, "build context %s/%s\n", bc.GOOS, bc.GOARCH)
+	}
+	// Packages processed before their symbols were recorded lack them.
+	fmt.Fprintf(h, "symbols\n")
+	fmt.Fprintf(h, "options %d %d %d %t\n",
+		MaxDocumentationHTML, DocumentationCollapseThreshold, MaxSynopsisLength, TrimSynopsisPackageName)
+	for _, e := range renderingExperiments {
+		fmt.Fprintf(h, "experiment %s %t\n", e, experiment.IsActive(ctx, e))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// renderingExperiments are the experiments that change the documentation
+// rendered for a package, so that a package processed with a different set of
+// them active must not be reused.
+var renderingExperiments = []string{
+	internal.ExperimentDeclarationSource,
+	internal.ExperimentExecutableExamples,
+	internal.ExperimentSyntaxHighlighting,
+}
+
+// packageContentHash returns the content hash of the package in the directory
+// innerPath of a module, whose .go files are files, given the contentHashSalt
+// of the module.
+func packageContentHash(salt, innerPath string, files map[string][]byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "salt %s\ndir %s\n", salt, innerPath)
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeHashedFile(h, name, files[name])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// writeHashedFile writes the name, length and contents of a file to h.
+func writeHashedFile(h hash.Hash, name string, contents []byte) {
+	fmt.Fprintf(h, "file %s %d\n", name, len(contents))
+	h.Write(contents)
+}
+
+// A reuser finds packages of the module version being processed that were
+// processed for another version of the module, and adapts them to this one.
+type reuser struct {
+	cache        PackageCache
+	sourceClient *source.Client
+	modulePath   string
+	version      string
+	sourceInfo   *source.Info // of version
+
+	// sourceInfos holds the source info of the other versions of the
+	// module that packages were found for, or nil if it could not be
+	// determined.
+	sourceInfos map[string]*source.Info
+}
+
+// newReuser returns a reuser that looks up packages in cache, or nil if cache
+// is nil.
+func newReuser(cache PackageCache, sourceClient *source.Client, modulePath, version string, sourceInfo *source.Info) *reuser {
+	if cache == nil {
+		return nil
+	}
+	return &reuser{
+		cache:        cache,
+		sourceClient: sourceClient,
+		modulePath:   modulePath,
+		version:      version,
+		sourceInfo:   sourceInfo,
+		sourceInfos:  map[string]*source.Info{},
+	}
+}
+
+// reuse returns the package in the directory innerPath, whose content hash is
+// contentHash and whose .go files are files, as it was processed for another
+// version of the module, with the links in its documentation changed to
+// refer to this version. It returns nil if there is no such package, or if it
+// cannot be adapted to this version. The returned package's Licenses and
+// IsRedistributable fields are not populated.
+//
+// If r is nil, reuse returns nil.
+func (r *reuser) reuse(ctx context.Context, innerPath, contentHash string, files map[string][]byte) *internal.LegacyPackage {
+	if r == nil {
+		return nil
+	}
+	pkg := r.find(ctx, innerPath, contentHash, files)
+	recordPackageCacheResult(ctx, pkg != nil)
+	return pkg
+}
+
+func (r *reuser) find(ctx context.Context, innerPath, contentHash string, files map[string][]byte) *internal.LegacyPackage {
+	pkgPath := path.Join(r.modulePath, innerPath)
+	if r.modulePath == stdlib.ModulePath {
+		pkgPath = innerPath
+	}
+	u, err := r.cache.GetUnitByContentHash(ctx, pkgPath, contentHash)
+	if err != nil {
+		if !errors.Is(err, derrors.NotFound) {
+			log.Errorf(ctx, "reuse(%q): %v", pkgPath, err)
+		}
+		return nil
+	}
+	if u.ModulePath != r.modulePath || u.Version == r.version || len(u.Documentation) == 0 {
+		return nil
+	}
+	for _, doc := range u.Documentation {
+		// A package whose documentation was too large, or whose files
+		// could not be parsed, is processed again, so that its state
+		// records that.
+		if h := doc.HTML.String(); h == docTooLargeReplacement || h == docUnparseableReplacement {
+			return nil
+		}
+	}
+	oldInfo, ok := r.sourceInfos[u.Version]
+	if !ok {
+		oldInfo, err = source.ModuleInfo(ctx, r.sourceClient, r.modulePath, u.Version)
+		if err != nil {
+			log.Infof(ctx, "error getting source info for %s@%s: %v", r.modulePath, u.Version, err)
+			oldInfo = nil
+		}
+		r.sourceInfos[u.Version] = oldInfo
+	}
+	if (oldInfo == nil) != (r.sourceInfo == nil) || oldInfo.RepoURL() != r.sourceInfo.RepoURL() {
+		return nil
+	}
+	relink, err := r.relinker(innerPath, u.Version, oldInfo, files)
+	if err != nil {
+		log.Errorf(ctx, "reuse(%q): %v", pkgPath, err)
+		return nil
+	}
+	var docs []*internal.Documentation
+	for _, doc := range u.Documentation {
+		d := *doc
+		d.HTML = uncheckedconversions.HTMLFromStringKnownToSatisfyTypeContract(relink.Replace(doc.HTML.String()))
+		docs = append(docs, &d)
+	}
+	first := docs[0]
+	return &internal.LegacyPackage{
+		Path:              pkgPath,
+		Name:              u.Name,
+		Synopsis:          first.Synopsis,
+		V1Path:            internal.V1Path(pkgPath, r.modulePath),
+		Imports:           u.Imports,
+		DocumentationHTML: first.HTML,
+		GOOS:              first.GOOS,
+		GOARCH:            first.GOARCH,
+		Documentation:     docs,
+	}
+}
+
+// hrefTemplate renders a URL the way that dochtml renders the target of a
+// link.
+var hrefTemplate = template.Must(template.New("href").Parse(`href="{{.}}"`))
+
+// relinker returns a Replacer that changes the links in documentation
+// rendered for the package in innerPath at version oldVersion of the module,
+// whose source info was oldInfo, into those rendered for this version. Those
+// are the links to other packages of the module, and to the source of the
+// package's files, which are files.
+func (r *reuser) relinker(innerPath, oldVersion string, oldInfo *source.Info, files map[string][]byte) (_ *strings.Replacer, err error) {
+	defer derrors.Wrap(&err, "relinker(%q, %q)", innerPath, oldVersion)
+
+	replacements := map[string]string{}
+	add := func(oldURL, newURL string) error {
+		if oldURL == newURL {
+			return nil
+		}
+		var oldAttr, newAttr bytes.Buffer
+		if err := hrefTemplate.Execute(&oldAttr, oldURL); err != nil {
+			return err
+		}
+		if err := hrefTemplate.Execute(&newAttr, newURL); err != nil {
+			return err
+		}
+		replacements[oldAttr.String()] = newAttr.String()
+		return nil
+	}
+	for name, contents := range files {
+		filePath := path.Join(innerPath, name)
+		if err := add(oldInfo.FileURL(filePath), r.sourceInfo.FileURL(filePath)); err != nil {
+			return nil, err
+		}
+		if oldInfo == nil {
+			continue
+		}
+		lines := bytes.Count(contents, []byte("\n")) + 1
+		for line := 1; line <= lines; line++ {
+			if err := add(oldInfo.LineURL(filePath, line), r.sourceInfo.LineURL(filePath, line)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// Links to packages of the module have the form
+	// /pkg/MODULE@VERSION/INNERPATH, possibly followed by a fragment, and
+	// only the prefix up to the version changes. The replacements above
+	// match whole attributes, so this one must come first.
+	var oldPrefix, newPrefix bytes.Buffer
+	if err := hrefTemplate.Execute(&oldPrefix, packageURLPrefix(r.modulePath, oldVersion)); err != nil {
+		return nil, err
+	}
+	if err := hrefTemplate.Execute(&newPrefix, packageURLPrefix(r.modulePath, r.version)); err != nil {
+		return nil, err
+	}
+	oldnew := []string{
+		strings.TrimSuffix(oldPrefix.String(), `"`), strings.TrimSuffix(newPrefix.String(), `"`),
+	}
+	var olds []string
+	for o := range replacements {
+		olds = append(olds, o)
+	}
+	sort.Strings(olds)
+	for _, o := range olds {
+		oldnew = append(oldnew, o, replacements[o])
+	}
+	return strings.NewReplacer(oldnew...), nil
+}
+
+// packageURLPrefix returns the prefix of the URLs that documentation rendered
+// for the given version of a module links the module's packages with.
+func packageURLPrefix(modulePath, version string) string {
+	return path.Join("/pkg", modulePath+"@"+version)
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/safehtml"
+	"go.opencensus.io/stats/view"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/experiment"
+	"golang.org/x/pkgsite/internal/fetch/dochtml"
+	"golang.org/x/pkgsite/internal/proxy"
+	"golang.org/x/pkgsite/internal/source"
+	"golang.org/x/pkgsite/internal/testing/testhelper"
+)
+
+// fakePackageCache is a PackageCache holding the packages of the modules
+// added to it.
+type fakePackageCache map[string]*internal.Unit
+
+func (c fakePackageCache) add(m *internal.Module) {
+	for _, u := range m.Units {
+		if u.ContentHash != "" {
+			c[u.Path+" "+u.ContentHash] = u
+		}
+	}
+}
+
+func (c fakePackageCache) GetUnitByContentHash(ctx context.Context, pkgPath, contentHash string) (*internal.Unit, error) {
+	u, ok := c[pkgPath+" "+contentHash]
+	if !ok {
+		return nil, derrors.NotFound
+	}
+	return u, nil
+}
+
+// packageCacheCounts returns the number of package cache hits and misses
+// recorded since PackageCacheResultCount was registered.
+func packageCacheCounts(t *testing.T) map[bool]int {
+	t.Helper()
+	rows, err := view.RetrieveData(PackageCacheResultCount.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[bool]int{}
+	for _, row := range rows {
+		hit, err := strconv.ParseBool(row.Tags[0].Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[hit] = int(row.Data.(*view.CountData).Value)
+	}
+	return counts
+}
+
+func TestFetchModuleWithCache(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	const modulePath = "github.com/my/reuse"
+	files := func(goVersion, license, c string) map[string]string {
+		return map[string]string{
+			"go.mod":  "module " + modulePath + "\n\ngo " + goVersion + "\n",
+			"LICENSE": license,
+			"a/a.go": `// Package a uses b.
+package a
+
+import "github.com/my/reuse/b"
+
+// F returns a T.
+func F() b.T { return 0 }
+`,
+			"b/b.go": "// Package b defines T.\npackage b\n\n// T is a type.\ntype T int\n",
+			"c/c.go": "// Package c is the one that changes.\npackage c\n\n" + c,
+		}
+	}
+	modules := []*proxy.Module{
+		{ModulePath: modulePath, Version: "v1.0.0", Files: files("1.14", testhelper.MITLicense, "func C() {}\n")},
+		// Only package c changes.
+		{ModulePath: modulePath, Version: "v1.1.0", Files: files("1.14", testhelper.MITLicense, "func C2() {}\n")},
+		// Only the license changes.
+		{ModulePath: modulePath, Version: "v1.2.0", Files: files("1.14", testhelper.BSD0License, "func C2() {}\n")},
+		// Only the Go version changes.
+		{ModulePath: modulePath, Version: "v1.3.0", Files: files("1.15", testhelper.BSD0License, "func C2() {}\n")},
+	}
+	proxyClient, teardownProxy := proxy.SetupTestClient(t, modules)
+	defer teardownProxy()
+	sourceClient := source.NewClient(sourceTimeout)
+
+	if err := view.Register(PackageCacheResultCount); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(PackageCacheResultCount)
+
+	var (
+		cache  = fakePackageCache{}
+		last   map[bool]int
+		reused *internal.Module
+	)
+	for _, test := range []struct {
+		version    string
+		wantHits   int
+		wantMisses int
+	}{
+		{"v1.0.0", 0, 3},
+		{"v1.1.0", 2, 1},
+		{"v1.2.0", 0, 3},
+		{"v1.3.0", 0, 3},
+	} {
+		got := FetchModuleWithCache(ctx, modulePath, test.version, proxyClient, sourceClient, cache)
+		if got.Error != nil {
+			t.Fatal(got.Error)
+		}
+		counts := packageCacheCounts(t)
+		if hits, misses := counts[true]-last[true], counts[false]-last[false]; hits != test.wantHits || misses != test.wantMisses {
+			t.Errorf("%s: got %d hits and %d misses, want %d and %d", test.version, hits, misses, test.wantHits, test.wantMisses)
+		}
+		last = counts
+
+		// A reused package must look exactly as if it had been processed
+		// again.
+		want := FetchModule(ctx, modulePath, test.version, proxyClient, sourceClient)
+		if want.Error != nil {
+			t.Fatal(want.Error)
+		}
+		if diff := cmp.Diff(sortedUnits(want.Module), sortedUnits(got.Module), cmp.AllowUnexported(safehtml.HTML{}, source.Info{})); diff != "" {
+			t.Errorf("%s: units mismatch (-processed +reused):\n%s", test.version, diff)
+		}
+		cache.add(got.Module)
+		if test.version == "v1.1.0" {
+			reused = got.Module
+		}
+	}
+
+	// The links of the documentation of package a, which was reused for
+	// v1.1.0, refer to that version.
+	for _, u := range reused.Units {
+		if u.Path != modulePath+"/a" {
+			continue
+		}
+		html := u.Documentation[0].HTML.String()
+		for _, want := range []string{
+			`href="/pkg/github.com/my/reuse@v1.1.0/b#T"`,
+			`href="https://github.com/my/reuse/blob/v1.1.0/a/a.go#L7"`,
+		} {
+			if !strings.Contains(html, want) {
+				t.Errorf("documentation of package a does not contain %s:\n%s", want, html)
+			}
+		}
+	}
+}
+
+// sortedUnits returns the units of m, sorted by path.
+func sortedUnits(m *internal.Module) []*internal.Unit {
+	units := append([]*internal.Unit(nil), m.Units...)
+	sort.Slice(units, func(i, j int) bool { return units[i].Path < units[j].Path })
+	return units
+}
+
+func TestContentHashSaltExperiments(t *testing.T) {
+	modInfo := &dochtml.ModuleInfo{ModulePath: "example.com/m", ModulePackages: map[string]bool{"example.com/m": true}}
+	salt := func(experiments ...string) string {
+		return contentHashSalt(experiment.NewContext(context.Background(), experiments...), "1.14", nil, modInfo)
+	}
+	base := salt()
+	if got := salt(internal.ExperimentFrontendFetch); got != base {
+		t.Errorf("%s changed the salt, but does not affect documentation", internal.ExperimentFrontendFetch)
+	}
+	for _, e := range renderingExperiments {
+		if salt(e) == base {
+			t.Errorf("%s did not change the salt", e)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/net/context/ctxhttp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/log"
+	"golang.org/x/pkgsite/internal/stdlib"
+)
+
+// knownChecksumDBs maps the names of checksum databases to their verifier
+// keys, so that like GOSUMDB, the name alone can configure one.
+var knownChecksumDBs = map[string]string{
+	"sum.golang.org": "sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8",
+}
+
+// maxCachedTiles is the maximum number of tiles of the checksum database that
+// are kept in memory. A tile holds at most 8 KB of hashes.
+const maxCachedTiles = 1000
+
+// A checksumDB is a checksum database against which module zips are verified.
+type checksumDB struct {
+	key        string // verifier key
+	url        string // URL of the server, without a trailing slash
+	noSumCheck string // comma-separated patterns of module paths not to check
+
+	mu     sync.Mutex
+	latest []byte            // latest signed tree head seen
+	tiles  map[string][]byte // cache of tiles, keyed by file name
+}
+
+// sumDB is the checksum database that module zips are verified against, or
+// nil if they are not verified. See SetChecksumDB.
+var sumDB *checksumDB
+
+// SetChecksumDB configures FetchModule to verify module zips against a
+// checksum database, as the go command does. The gosumdb argument has the
+// format of GOSUMDB: it is "off" or empty to disable verification, the name
+// of a known database such as "sum.golang.org", or a verifier key optionally
+// followed by the URL of the database. Modules whose paths match one of the
+// comma-separated glob patterns in noSumCheck, which have the format of
+// GONOSUMDB, are not checked.
+//
+// SetChecksumDB must be called before any modules are fetched.
+func SetChecksumDB(gosumdb, noSumCheck string) (err error) {
+	defer derrors.Wrap(&err, "SetChecksumDB(%q, %q)", gosumdb, noSumCheck)
+
+	fields := strings.Fields(gosumdb)
+	if len(fields) == 0 || (len(fields) == 1 && fields[0] == "off") {
+		sumDB = nil
+		return nil
+	}
+	if len(fields) > 2 {
+		return fmt.Errorf("want key or key and URL: %w", derrors.InvalidArgument)
+	}
+	key := fields[0]
+	if k, ok := knownChecksumDBs[key]; ok {
+		key = k
+	}
+	verifier, err := note.NewVerifier(key)
+	if err != nil {
+		return fmt.Errorf("%v: %w", err, derrors.InvalidArgument)
+	}
+	u := "https://" + verifier.Name()
+	if len(fields) == 2 {
+		u = fields[1]
+	}
+	sumDB = &checksumDB{
+		key:        key,
+		url:        strings.TrimSuffix(u, "/"),
+		noSumCheck: noSumCheck,
+		tiles:      map[string][]byte{},
+	}
+	return nil
+}
+
+// verifyChecksum checks the hash of the zip r of the given module version
+// against the checksum database configured with SetChecksumDB, and returns
+// the resulting checksum status, one of the internal.Checksum constants. It
+// returns an error wrapping derrors.ChecksumVerificationFailed if the hash
+// does not match, or if the database does not have the module version.
+func verifyChecksum(ctx context.Context, modulePath, version string, r *zip.Reader) (_ string, err error) {
+	defer derrors.Wrap(&err, "verifyChecksum(%q, %q)", modulePath, version)
+
+	db := sumDB
+	if db == nil || modulePath == stdlib.ModulePath {
+		return internal.ChecksumUnchecked, nil
+	}
+	// A sumdb.Client caches the results of lookups, including errors, for
+	// its lifetime, so use a new one for each module version. The checksumDB
+	// keeps the state that is shared among them.
+	ops := &checksumOps{ctx: ctx, db: db}
+	client := sumdb.NewClient(ops)
+	client.SetGONOSUMDB(db.noSumCheck)
+	lines, err := client.Lookup(modulePath, version)
+	if errors.Is(err, sumdb.ErrGONOSUMDB) {
+		return internal.ChecksumSkipped, nil
+	}
+	if err != nil {
+		if ops.notFound {
+			return "", fmt.Errorf("%v: %w", err, derrors.ChecksumVerificationFailed)
+		}
+		return "", err
+	}
+	hash, err := hashZip(r)
+	if err != nil {
+		return "", err
+	}
+	want := fmt.Sprintf("%s %s %s", modulePath, version, hash)
+	for _, line := range lines {
+		if line == want {
+			return internal.ChecksumVerified, nil
+		}
+	}
+	return "", fmt.Errorf("zip has hash %s, checksum database has %q: %w", hash, lines, derrors.ChecksumVerificationFailed)
+}
+
+// hashZip returns the hash of the module zip r that the checksum database
+// records, like dirhash.HashZip.
+func hashZip(r *zip.Reader) (string, error) {
+	var names []string
+	files := map[string]*zip.File{}
+	for _, f := range r.File {
+		names = append(names, f.Name)
+		files[f.Name] = f
+	}
+	return dirhash.Hash1(names, func(name string) (io.ReadCloser, error) {
+		return files[name].Open()
+	})
+}
+
+// checksumOps implements sumdb.ClientOps for the verification of a single
+// module version.
+type checksumOps struct {
+	ctx context.Context
+	db  *checksumDB
+
+	// notFound reports whether the database does not have the module
+	// version.
+	notFound bool
+}
+
+func (o *checksumOps) ReadRemote(path string) (_ []byte, err error) {
+	defer derrors.Wrap(&err, "ReadRemote(%q)", path)
+
+	req, err := http.NewRequest("GET", o.db.url+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ctxhttp.Do(o.ctx, nil, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if strings.HasPrefix(path, "/lookup/") &&
+			(resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone) {
+			o.notFound = true
+		}
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (o *checksumOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(o.db.key), nil
+	}
+	if strings.HasSuffix(file, "/latest") {
+		o.db.mu.Lock()
+		defer o.db.mu.Unlock()
+		// An empty tree head is valid, and makes the client start from
+		// scratch.
+		return o.db.latest, nil
+	}
+	return nil, fmt.Errorf("unknown config file %q", file)
+}
+
+func (o *checksumOps) WriteConfig(file string, old, new []byte) error {
+	if !strings.HasSuffix(file, "/latest") {
+		return fmt.Errorf("unknown config file %q", file)
+	}
+	o.db.mu.Lock()
+	defer o.db.mu.Unlock()
+	if !bytes.Equal(o.db.latest, old) {
+		return sumdb.ErrWriteConflict
+	}
+	o.db.latest = new
+	return nil
+}
+
+// Only tiles are cached. Lookups are not, because the module version has
+// just been downloaded, and is unlikely to be verified again soon.
+
+func (o *checksumOps) ReadCache(file string) ([]byte, error) {
+	o.db.mu.Lock()
+	defer o.db.mu.Unlock()
+	if data, ok := o.db.tiles[file]; ok {
+		return data, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func (o *checksumOps) WriteCache(file string, data []byte) {
+	if !strings.Contains(file, "/tile/") {
+		return
+	}
+	o.db.mu.Lock()
+	defer o.db.mu.Unlock()
+	if len(o.db.tiles) >= maxCachedTiles {
+		o.db.tiles = map[string][]byte{}
+	}
+	o.db.tiles[file] = data
+}
+
+func (o *checksumOps) Log(msg string) {
+	log.Infof(o.ctx, "checksum database: %s", msg)
+}
+
+func (o *checksumOps) SecurityError(msg string) {
+	log.Errorf(o.ctx, "checksum database: %s", msg)
+}
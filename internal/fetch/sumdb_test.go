@@ -0,0 +1,141 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/proxy"
+	"golang.org/x/pkgsite/internal/source"
+	"golang.org/x/pkgsite/internal/testing/testhelper"
+)
+
+func TestFetchModuleChecksum(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer func() { sumDB = nil }()
+
+	const (
+		version      = "v1.0.0"
+		goodPath     = "example.com/good"
+		badPath      = "example.com/bad"
+		missingPath  = "example.com/missing"
+		privatePath  = "private.example.com/secret"
+		fakeZipHash  = "h1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+		signerPrefix = "sumdb.example.com"
+	)
+	var modules []*proxy.Module
+	for _, p := range []string{goodPath, badPath, missingPath, privatePath} {
+		modules = append(modules, &proxy.Module{
+			ModulePath: p,
+			Files: map[string]string{
+				"LICENSE": testhelper.MITLicense,
+				"p.go":    "// Package p is a package.\npackage p",
+			},
+		})
+	}
+	proxyClient, teardownProxy := proxy.SetupTestClient(t, modules)
+	defer teardownProxy()
+	sourceClient := source.NewClient(sourceTimeout)
+
+	// The checksum database has the hashes of the zips that the proxy serves,
+	// except for badPath, and does not have missingPath.
+	gosum := func(path, vers string) ([]byte, error) {
+		switch path {
+		case missingPath:
+			return nil, os.ErrNotExist
+		case badPath:
+			return []byte(fmt.Sprintf("%s %s %s\n", path, vers, fakeZipHash)), nil
+		}
+		r, err := proxyClient.GetZip(ctx, path, vers)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := hashZip(r)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(fmt.Sprintf("%s %s %s\n", path, vers, hash)), nil
+	}
+	skey, vkey, err := note.GenerateKey(rand.Reader, signerPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(sumdb.NewServer(sumdb.NewTestServer(skey, gosum)))
+	defer srv.Close()
+	if err := SetChecksumDB(vkey+" "+srv.URL, "private.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		modulePath string
+		wantStatus string
+		wantErr    error
+	}{
+		{goodPath, internal.ChecksumVerified, nil},
+		{badPath, "", derrors.ChecksumVerificationFailed},
+		{missingPath, "", derrors.ChecksumVerificationFailed},
+		{privatePath, internal.ChecksumSkipped, nil},
+	} {
+		t.Run(test.modulePath, func(t *testing.T) {
+			got := FetchModule(ctx, test.modulePath, version, proxyClient, sourceClient)
+			if !errors.Is(got.Error, test.wantErr) {
+				t.Fatalf("FetchModule(ctx, %q, %q, proxyClient, sourceClient): %v; wantErr = %v", test.modulePath, version, got.Error, test.wantErr)
+			}
+			if got.Error != nil {
+				if want := derrors.ToStatus(test.wantErr); got.Status != want {
+					t.Errorf("got status %d, want %d", got.Status, want)
+				}
+				return
+			}
+			if got.Module.ChecksumStatus != test.wantStatus {
+				t.Errorf("got checksum status %q, want %q", got.Module.ChecksumStatus, test.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSetChecksumDB(t *testing.T) {
+	defer func() { sumDB = nil }()
+
+	for _, test := range []struct {
+		gosumdb string
+		wantURL string // empty if verification is disabled
+		wantErr bool
+	}{
+		{gosumdb: ""},
+		{gosumdb: "off"},
+		{gosumdb: "sum.golang.org", wantURL: "https://sum.golang.org"},
+		{gosumdb: knownChecksumDBs["sum.golang.org"] + " https://sum.example.com/", wantURL: "https://sum.example.com"},
+		{gosumdb: "sum.example.com", wantErr: true},
+		{gosumdb: "a b c", wantErr: true},
+	} {
+		err := SetChecksumDB(test.gosumdb, "")
+		if (err != nil) != test.wantErr {
+			t.Errorf("SetChecksumDB(%q): got error %v, want error: %t", test.gosumdb, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var gotURL string
+		if sumDB != nil {
+			gotURL = sumDB.url
+		}
+		if gotURL != test.wantURL {
+			t.Errorf("SetChecksumDB(%q): got URL %q, want %q", test.gosumdb, gotURL, test.wantURL)
+		}
+	}
+}
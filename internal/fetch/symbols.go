@@ -0,0 +1,119 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"go/ast"
+	"sort"
+
+	"golang.org/x/pkgsite/internal/fetch/internal/doc"
+)
+
+// symbolNames returns the sorted names of the symbols documented in d, in
+// the form of internal.Documentation.Symbols. Methods, struct fields and
+// interface methods are qualified by the name of their type. Commands have
+// no symbols. For other packages the result is never nil, so that a package
+// without symbols is stored differently from one whose symbols were not
+// recorded.
+func symbolNames(d *doc.Package) []string {
+	if d.Name == "main" {
+		return nil
+	}
+	seen := map[string]bool{}
+	add := func(name string) {
+		if name != "" && name != "_" {
+			seen[name] = true
+		}
+	}
+	addValues := func(values []*doc.Value) {
+		for _, v := range values {
+			for _, name := range v.Names {
+				add(name)
+			}
+		}
+	}
+	addFuncs := func(prefix string, funcs []*doc.Func) {
+		for _, f := range funcs {
+			add(prefix + f.Name)
+		}
+	}
+	addValues(d.Consts)
+	addValues(d.Vars)
+	addFuncs("", d.Funcs)
+	for _, t := range d.Types {
+		add(t.Name)
+		addValues(t.Consts)
+		addValues(t.Vars)
+		addFuncs("", t.Funcs)
+		addFuncs(t.Name+".", t.Methods)
+		for _, name := range memberNames(t.Decl, t.Name) {
+			add(t.Name + "." + name)
+		}
+	}
+	names := []string{}
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// memberNames returns the names of the fields of the struct type, or the
+// methods of the interface type, named name in decl. Embedded fields are
+// named by their type. The documentation has already removed unexported
+// members, unless all declarations are documented.
+func memberNames(decl *ast.GenDecl, name string) []string {
+	if decl == nil {
+		return nil
+	}
+	var fields *ast.FieldList
+	for _, spec := range decl.Specs {
+		ts, ok := spec.(*ast.TypeSpec)
+		if !ok || ts.Name.Name != name {
+			continue
+		}
+		switch t := ts.Type.(type) {
+		case *ast.StructType:
+			fields = t.Fields
+		case *ast.InterfaceType:
+			fields = t.Methods
+		}
+	}
+	if fields == nil {
+		return nil
+	}
+	var names []string
+	for _, f := range fields.List {
+		if len(f.Names) == 0 {
+			if n := embeddedName(f.Type); n != "" {
+				names = append(names, n)
+			}
+			continue
+		}
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+	}
+	return names
+}
+
+// embeddedName returns the name of the embedded field or interface whose
+// type is expr, or the empty string if it has none, as for a type
+// constraint in an interface.
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.IndexExpr:
+		return embeddedName(t.X)
+	case *ast.IndexListExpr:
+		return embeddedName(t.X)
+	}
+	return ""
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal/fetch/dochtml"
+)
+
+func TestSymbolNames(t *testing.T) {
+	ctx := context.Background()
+	modInfo := &dochtml.ModuleInfo{ModulePath: "example.com/m", ResolvedVersion: "v1.0.0"}
+	for _, test := range []struct {
+		name  string
+		files map[string][]byte
+		goos  string
+		want  []string
+	}{
+		{
+			name: "all kinds",
+			files: map[string][]byte{"p.go": []byte(`package p
+
+import "io"
+
+const (
+	A, b = 1, 2
+	_    = 3
+)
+
+var V int
+
+func F() {}
+
+func f() {}
+
+type T struct {
+	Field int
+	field int
+	io.Reader
+	*Embedded
+}
+
+type Embedded struct{}
+
+func NewT() *T { return nil }
+
+func (T) M() {}
+
+func (T) m() {}
+
+const TC T = T{}
+
+type I interface {
+	Method()
+	io.Writer
+}
+`)},
+			want: []string{
+				"A", "Embedded", "F", "I", "I.Method", "I.Writer", "NewT",
+				"T", "T.Embedded", "T.Field", "T.M", "T.Reader", "TC", "V",
+			},
+		},
+		{
+			name: "build context",
+			files: map[string][]byte{
+				"p.go":         []byte("package p\n\nfunc All() {}\n"),
+				"p_windows.go": []byte("package p\n\nfunc Windows() {}\n"),
+			},
+			goos: "windows",
+			want: []string{"All", "Windows"},
+		},
+		{
+			name:  "command",
+			files: map[string][]byte{"main.go": []byte("package main\n\nfunc Exported() {}\n\nfunc main() {}\n")},
+			want:  nil,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			goos := test.goos
+			if goos == "" {
+				goos = "linux"
+			}
+			files, err := matchingFiles(goos, "amd64", nil, test.files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pkg, err := loadPackageWithBuildContext(ctx, goos, "amd64", files, "", nil, modInfo, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, pkg.Documentation[0].Symbols); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
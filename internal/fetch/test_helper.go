@@ -7,6 +7,7 @@ package fetch
 import (
 	"archive/zip"
 	"context"
+	"fmt"
 	"net/http"
 	"sort"
 	"strings"
@@ -29,6 +30,8 @@ func cleanFetchResult(fr *FetchResult, detector *licenses.Detector) *FetchResult
 	if fr.GoModPath == "" {
 		fr.GoModPath = fr.ModulePath
 	}
+	fr.GoVersion = fr.Module.GoVersion
+	fr.Toolchain = fr.Module.Toolchain
 	if fr.Status == 0 {
 		fr.Status = 200
 	}
@@ -66,10 +69,10 @@ func cleanFetchResult(fr *FetchResult, detector *licenses.Detector) *FetchResult
 			IsRedistributable: u.IsRedistributable,
 			Licenses:          u.Licenses,
 		}
-		if u.Documentation != nil {
-			if u.Documentation.GOOS == "" {
-				u.Documentation.GOOS = "linux"
-				u.Documentation.GOARCH = "amd64"
+		for _, d := range u.Documentation {
+			if d.GOOS == "" {
+				d.GOOS = "linux"
+				d.GOARCH = "amd64"
 			}
 		}
 		if u.IsPackage() {
@@ -78,11 +81,12 @@ func cleanFetchResult(fr *FetchResult, detector *licenses.Detector) *FetchResult
 				Licenses:          u.Licenses,
 				V1Path:            internal.V1Path(u.Path, u.ModulePath),
 				Name:              u.Name,
-				Synopsis:          u.Documentation.Synopsis,
-				DocumentationHTML: u.Documentation.HTML,
+				Synopsis:          u.Documentation[0].Synopsis,
+				DocumentationHTML: u.Documentation[0].HTML,
 				Imports:           u.Imports,
-				GOOS:              u.Documentation.GOOS,
-				GOARCH:            u.Documentation.GOARCH,
+				GOOS:              u.Documentation[0].GOOS,
+				GOARCH:            u.Documentation[0].GOARCH,
+				Documentation:     u.Documentation,
 				IsRedistributable: u.IsRedistributable,
 			})
 			if shouldSetPVS {
@@ -178,6 +182,8 @@ func validateDocumentationHTML(t *testing.T, got, want *internal.Module) {
 		if !want.Units[i].IsPackage() {
 			continue
 		}
-		checkHTML("Directories", i, got.Units[i].Documentation.HTML, want.Units[i].Documentation.HTML)
+		for j, d := range want.Units[i].Documentation {
+			checkHTML(fmt.Sprintf("Directories[%d].Documentation", i), j, got.Units[i].Documentation[j].HTML, d.HTML)
+		}
 	}
 }
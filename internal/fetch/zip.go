@@ -0,0 +1,80 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"archive/zip"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// checkZipFiles returns a reader for the files of the module zip r that can be
+// processed, and a warning for each file that was skipped. Files are skipped
+// if they are not under the module directory of the zip, if their names are
+// not valid module file paths (for example, because they contain backslashes
+// or characters that are invalid on some operating systems), or if they
+// collide with another file whose name is the same or differs only in case.
+// Of colliding files, the one whose name sorts first is kept.
+//
+// A module whose go.mod file collides with another file cannot be processed,
+// and checkZipFiles returns an error wrapping derrors.BadModuleZip for it.
+func checkZipFiles(modulePath, version string, r *zip.Reader) (_ *zip.Reader, warnings []string, err error) {
+	defer derrors.Wrap(&err, "checkZipFiles(%q, %q)", modulePath, version)
+
+	modulePrefix := moduleVersionDir(modulePath, version) + "/"
+	goModName := modulePrefix + "go.mod"
+	skipped := map[*zip.File]bool{}
+	byFoldedName := map[string][]*zip.File{}
+	for _, f := range r.File {
+		if f.Mode().IsDir() {
+			// Directory entries are ignored when the module is processed.
+			continue
+		}
+		if !strings.HasPrefix(f.Name, modulePrefix) {
+			skipped[f] = true
+			warnings = append(warnings, fmt.Sprintf("skipped file %q: not in module directory %q", f.Name, modulePrefix))
+			continue
+		}
+		if err := module.CheckFilePath(f.Name[len(modulePrefix):]); err != nil {
+			skipped[f] = true
+			warnings = append(warnings, fmt.Sprintf("skipped %v", err))
+			continue
+		}
+		key := strings.ToLower(f.Name)
+		byFoldedName[key] = append(byFoldedName[key], f)
+	}
+	for _, files := range byFoldedName {
+		if len(files) == 1 {
+			continue
+		}
+		for _, f := range files {
+			if f.Name == goModName {
+				return nil, nil, fmt.Errorf("go.mod file collides with %d other files: %w", len(files)-1, derrors.BadModuleZip)
+			}
+		}
+		// Files with the same name keep their order in the zip.
+		sort.SliceStable(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+		kept := files[0].Name[len(modulePrefix):]
+		for _, f := range files[1:] {
+			skipped[f] = true
+			warnings = append(warnings, fmt.Sprintf("skipped file %q: collides with %q", f.Name[len(modulePrefix):], kept))
+		}
+	}
+	if len(skipped) == 0 {
+		return r, nil, nil
+	}
+	var files []*zip.File
+	for _, f := range r.File {
+		if !skipped[f] {
+			files = append(files, f)
+		}
+	}
+	sort.Strings(warnings)
+	return &zip.Reader{File: files, Comment: r.Comment}, warnings, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+func TestCheckZipFiles(t *testing.T) {
+	const (
+		modulePath = "github.com/my/module"
+		version    = "v1.0.0"
+		prefix     = modulePath + "@" + version + "/"
+	)
+	// A file is a zip entry; entries may have the same name.
+	type file struct{ name, contents string }
+	for _, test := range []struct {
+		name         string
+		files        []file
+		wantFiles    []file
+		wantWarnings []string
+		wantErr      error
+	}{
+		{
+			name:      "valid",
+			files:     []file{{prefix + "go.mod", "module m"}, {prefix + "a/a.go", "package a"}, {prefix + "a/", ""}},
+			wantFiles: []file{{prefix + "go.mod", "module m"}, {prefix + "a/a.go", "package a"}, {prefix + "a/", ""}},
+		},
+		{
+			name:         "outside module directory",
+			files:        []file{{prefix + "a.go", "package a"}, {"other@v1.0.0/b.go", "package b"}},
+			wantFiles:    []file{{prefix + "a.go", "package a"}},
+			wantWarnings: []string{`skipped file "other@v1.0.0/b.go": not in module directory "` + prefix + `"`},
+		},
+		{
+			name:         "invalid names",
+			files:        []file{{prefix + `a\b.go`, "package a"}, {prefix + "a/aux.go", "package a"}, {prefix + "a/a.go", "package a"}},
+			wantFiles:    []file{{prefix + "a/a.go", "package a"}},
+			wantWarnings: []string{`skipped malformed file path "a/aux.go": "aux" disallowed as path element component on Windows`, `skipped malformed file path "a\\b.go": invalid char '\\'`},
+		},
+		{
+			name:         "same name",
+			files:        []file{{prefix + "a.go", "first"}, {prefix + "a.go", "second"}},
+			wantFiles:    []file{{prefix + "a.go", "first"}},
+			wantWarnings: []string{`skipped file "a.go": collides with "a.go"`},
+		},
+		{
+			name:         "names differing in case",
+			files:        []file{{prefix + "a/x.go", "lower"}, {prefix + "A/X.go", "upper"}, {prefix + "a/X.go", "mixed"}},
+			wantFiles:    []file{{prefix + "A/X.go", "upper"}},
+			wantWarnings: []string{`skipped file "a/X.go": collides with "A/X.go"`, `skipped file "a/x.go": collides with "A/X.go"`},
+		},
+		{
+			name:    "go.mod collides",
+			files:   []file{{prefix + "GO.MOD", "module m"}, {prefix + "go.mod", "module m"}},
+			wantErr: derrors.BadModuleZip,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			zw := zip.NewWriter(&buf)
+			for _, f := range test.files {
+				w, err := zw.Create(f.name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := w.Write([]byte(f.contents)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotReader, gotWarnings, err := checkZipFiles(modulePath, version, r)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var gotFiles []file
+			for _, f := range gotReader.File {
+				contents, err := readZipFile(f, MaxFileSize)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gotFiles = append(gotFiles, file{f.Name, string(contents)})
+			}
+			if diff := cmp.Diff(test.wantFiles, gotFiles, cmp.AllowUnexported(file{})); diff != "" {
+				t.Errorf("files mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantWarnings, gotWarnings); diff != "" {
+				t.Errorf("warnings mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,512 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/semver"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/godoc"
+	"golang.org/x/pkgsite/internal/log"
+	"golang.org/x/pkgsite/internal/stdlib"
+)
+
+// apiDocPrefix is the URL path prefix of the documentation API.
+const apiDocPrefix = "/api/doc"
+
+// DocumentationJSON is the JSON representation of a package's documentation,
+// served at /api/doc/<import-path>[@<version>].
+type DocumentationJSON struct {
+	Path              string
+	ModulePath        string
+	Version           string
+	CommitTime        time.Time
+	Name              string
+	Synopsis          string
+	IsRedistributable bool
+	// Licenses holds the types of the licenses that apply to the package.
+	Licenses []string
+	// GOOS and GOARCH are the build context of the documentation.
+	GOOS   string `json:",omitempty"`
+	GOARCH string `json:",omitempty"`
+	// Message, if non-empty, explains why the documentation is missing.
+	Message  string          `json:",omitempty"`
+	Examples []godoc.Example `json:",omitempty"`
+	Symbols  []godoc.Symbol  `json:",omitempty"`
+}
+
+// serveDocumentationAPI handles requests of the form
+// "/api/doc/<import-path>[@<version>][?GOOS=<goos>&GOARCH=<goarch>]". It
+// resolves the version in the same way as the details pages do.
+func (s *Server) serveDocumentationAPI(w http.ResponseWriter, r *http.Request, ds internal.DataSource) (err error) {
+	if r.Method != http.MethodGet {
+		return &serverError{status: http.StatusMethodNotAllowed}
+	}
+	urlInfo, err := extractURLPathInfo(strings.TrimPrefix(r.URL.Path, apiDocPrefix))
+	if err != nil || urlInfo.isModule {
+		return &serverError{status: http.StatusBadRequest, err: err}
+	}
+	ctx := r.Context()
+	if err := validatePathAndVersion(ctx, ds, urlInfo.fullPath, urlInfo.requestedVersion); err != nil {
+		return err
+	}
+	um, err := ds.GetUnitMeta(ctx, urlInfo.fullPath, urlInfo.modulePath, urlInfo.requestedVersion)
+	if err != nil {
+		if errors.Is(err, derrors.NotFound) {
+			return &serverError{status: http.StatusNotFound, err: err}
+		}
+		return err
+	}
+	if !um.IsPackage() {
+		return &serverError{
+			status:       http.StatusNotFound,
+			responseText: fmt.Sprintf("%s is not a package", um.Path),
+		}
+	}
+	dj, err := fetchDocumentationJSON(ctx, ds, um, r.FormValue("GOOS"), r.FormValue("GOARCH"))
+	if err != nil {
+		return err
+	}
+	return serveJSON(ctx, w, dj)
+}
+
+// APIErrorJSON is the JSON representation of an error returned by the API.
+type APIErrorJSON struct {
+	// Code is the HTTP status code of the response.
+	Code    int
+	Message string
+	// FetchPath, if non-empty, is the path to send a POST request to in order
+	// to ask for the missing path and version to be fetched, as the details
+	// pages offer to do.
+	FetchPath string `json:",omitempty"`
+}
+
+// apiErrorHandler is like Server.errorHandler, but it serves errors as JSON
+// instead of HTML pages, with the same status codes.
+func (s *Server) apiErrorHandler(f func(w http.ResponseWriter, r *http.Request, ds internal.DataSource) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ds := s.getDataSource(r.Context())
+		if err := f(w, r, ds); err != nil {
+			serveAPIError(w, r, err)
+		}
+	}
+}
+
+// serveAPIError writes the JSON representation of err to w.
+func serveAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	ctx := r.Context()
+	var serr *serverError
+	if !errors.As(err, &serr) {
+		serr = &serverError{status: http.StatusInternalServerError, err: err}
+	}
+	if serr.status == http.StatusInternalServerError {
+		log.Error(ctx, err)
+	} else {
+		log.Infof(ctx, "returning %d (%s) for error %v", serr.status, http.StatusText(serr.status), err)
+	}
+	ej := &APIErrorJSON{Code: serr.status, Message: serr.responseText}
+	if ej.Message == "" {
+		ej.Message = http.StatusText(serr.status)
+	}
+	if serr.epage != nil && serr.epage.templateName == "fetch.tmpl" {
+		// See pathNotFoundErrorNew.
+		if path, ok := serr.epage.MessageData.(string); ok {
+			ej.FetchPath = "/fetch/" + path
+		}
+	}
+	response, err := json.Marshal(ej)
+	if err != nil {
+		log.Error(ctx, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(serr.status)
+	if _, err := io.Copy(w, bytes.NewReader(response)); err != nil {
+		log.Errorf(ctx, "Error copying json buffer to ResponseWriter: %v", err)
+	}
+}
+
+// setCacheControl tells clients and proxies that they may cache the response
+// for ttl.
+func setCacheControl(w http.ResponseWriter, ttl time.Duration) {
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(ttl.Seconds())))
+}
+
+// serveJSON writes the JSON encoding of v to w.
+func serveJSON(ctx context.Context, w http.ResponseWriter, v interface{}) error {
+	response, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := io.Copy(w, bytes.NewReader(response)); err != nil {
+		log.Errorf(ctx, "Error copying json buffer to ResponseWriter: %v", err)
+	}
+	return nil
+}
+
+// fetchDocumentationJSON returns the documentation of the package described
+// by um, for the build context that best matches goos and goarch.
+func fetchDocumentationJSON(ctx context.Context, ds internal.DataSource, um *internal.UnitMeta, goos, goarch string) (_ *DocumentationJSON, err error) {
+	defer derrors.Wrap(&err, "fetchDocumentationJSON(%q, %q, %q)", um.Path, goos, goarch)
+
+	dj := &DocumentationJSON{
+		Path:              um.Path,
+		ModulePath:        um.ModulePath,
+		Version:           um.Version,
+		CommitTime:        um.CommitTime,
+		Name:              um.Name,
+		IsRedistributable: um.IsRedistributable,
+		Licenses:          []string{},
+	}
+	for _, l := range um.Licenses {
+		dj.Licenses = append(dj.Licenses, l.Types...)
+	}
+	if !um.IsRedistributable {
+		dj.Message = "Documentation is not displayed for this package because its license does not allow redistribution."
+		return dj, nil
+	}
+	u, err := ds.GetUnit(ctx, um, internal.WithDocumentation|internal.WithDocumentationAPI)
+	if err != nil {
+		return nil, err
+	}
+	doc := u.DocumentationFor(goos, goarch)
+	if doc == nil {
+		dj.Message = "Documentation is not available for this package."
+		if u.BuildFailureReason != "" {
+			dj.Message = u.BuildFailureReason
+		}
+		return dj, nil
+	}
+	dj.GOOS = doc.GOOS
+	dj.GOARCH = doc.GOARCH
+	dj.Synopsis = doc.FullSynopsis
+	if dj.Synopsis == "" {
+		// Documentation stored before full synopses were.
+		dj.Synopsis = doc.Synopsis
+	}
+	if doc.API == nil {
+		dj.Message = "The API of this package is not available yet, because its documentation was processed before the API was recorded."
+		return dj, nil
+	}
+	var api godoc.API
+	if err := json.Unmarshal(doc.API, &api); err != nil {
+		return nil, err
+	}
+	dj.Examples = api.Examples
+	dj.Symbols = api.Symbols
+	return dj, nil
+}
+
+// apiSearchPath is the URL path of the search API.
+const apiSearchPath = "/api/search"
+
+// maxSearchAPILimit is the maximum number of results in a response of the
+// search API.
+const maxSearchAPILimit = 100
+
+// SearchJSON is the JSON representation of a page of search results, served
+// at /api/search?q=<query>[&page=<page>][&limit=<limit>].
+type SearchJSON struct {
+	Query string
+	Page  int
+	// Total is the number of results, one for each module. If Approximate is
+	// true, it is an estimate.
+	Total       int
+	Approximate bool
+	Results     []*SearchResultJSON
+}
+
+// SearchResultJSON is the JSON representation of a search result: the
+// best-ranked matching package of a module, and the other matching packages
+// of the module.
+type SearchResultJSON struct {
+	PackagePath   string
+	ModulePath    string
+	Version       string
+	Name          string
+	Synopsis      string
+	Licenses      []string
+	CommitTime    time.Time
+	NumImportedBy uint64
+	// NumOtherPackages is the number of the other packages of the module
+	// that match the query. OtherPackages holds the paths of at most a few
+	// of them, best first.
+	NumOtherPackages uint64
+	OtherPackages    []string `json:",omitempty"`
+}
+
+// serveSearchAPI handles requests of the form
+// "/api/search?q=<query>[&page=<page>][&limit=<limit>]". The query is
+// interpreted as on the search page, but symbols are not searched for.
+func (s *Server) serveSearchAPI(w http.ResponseWriter, r *http.Request, ds internal.DataSource) error {
+	if r.Method != http.MethodGet {
+		return &serverError{status: http.StatusMethodNotAllowed}
+	}
+	query := searchQuery(r)
+	if query == "" || len(query) > maxSearchQueryLength {
+		return &serverError{status: http.StatusBadRequest}
+	}
+	pageParams := newPaginationParams(r, defaultSearchLimit)
+	if pageParams.limit > maxSearchAPILimit {
+		pageParams.limit = maxSearchAPILimit
+	}
+	ctx := r.Context()
+	sj, err := fetchSearchJSON(ctx, ds, query, pageParams)
+	if errors.Is(err, derrors.Unsupported) {
+		return proxydatasourceNotSupportedErr()
+	}
+	if err != nil {
+		return err
+	}
+	return serveJSON(ctx, w, sj)
+}
+
+// fetchSearchJSON returns the page of search results for query described by
+// pageParams.
+func fetchSearchJSON(ctx context.Context, ds internal.DataSource, query string, pageParams paginationParams) (_ *SearchJSON, err error) {
+	defer derrors.Wrap(&err, "fetchSearchJSON(%q, %d, %d)", query, pageParams.page, pageParams.limit)
+
+	results, err := ds.Search(ctx, query, pageParams.limit, pageParams.offset())
+	if err != nil {
+		return nil, err
+	}
+	sj := &SearchJSON{
+		Query:   query,
+		Page:    pageParams.page,
+		Results: []*SearchResultJSON{},
+	}
+	for _, r := range results {
+		sj.Total = int(r.NumResults)
+		sj.Approximate = r.Approximate
+		licenses := r.Licenses
+		if licenses == nil {
+			licenses = []string{}
+		}
+		sj.Results = append(sj.Results, &SearchResultJSON{
+			PackagePath:      r.PackagePath,
+			ModulePath:       r.ModulePath,
+			Version:          r.Version,
+			Name:             r.Name,
+			Synopsis:         r.Synopsis,
+			Licenses:         licenses,
+			CommitTime:       r.CommitTime,
+			NumImportedBy:    r.NumImportedBy,
+			NumOtherPackages: r.NumOtherPackages,
+			OtherPackages:    r.OtherPackages,
+		})
+	}
+	return sj, nil
+}
+
+// apiLatestPrefix is the URL path prefix of the latest version API.
+const apiLatestPrefix = "/api/latest"
+
+// LatestJSON is the JSON representation of the latest version of a module,
+// served at /api/latest/<module-path>.
+type LatestJSON struct {
+	ModulePath string
+	// Version is the version that the details pages show when no version is
+	// requested, and CommitTime is its commit time.
+	Version    string
+	CommitTime time.Time
+	// LatestRelease is the highest release version of the module that is
+	// not retracted, if any. LatestCompatible is the highest version that is
+	// neither retracted nor +incompatible, if any; it may be a prerelease or
+	// a pseudo-version.
+	LatestRelease    string `json:",omitempty"`
+	LatestCompatible string `json:",omitempty"`
+	// Retracted reports whether Version is retracted, which only happens when
+	// every version of the module is.
+	Retracted           bool
+	RetractionRationale string `json:",omitempty"`
+	// Deprecated reports whether the module is deprecated, and Deprecation
+	// holds the deprecation message.
+	Deprecated  bool
+	Deprecation string `json:",omitempty"`
+}
+
+// serveLatestAPI handles requests of the form "/api/latest/<module-path>".
+// The latest version is resolved in the same way as the details pages do.
+func (s *Server) serveLatestAPI(w http.ResponseWriter, r *http.Request, ds internal.DataSource) error {
+	if r.Method != http.MethodGet {
+		return &serverError{status: http.StatusMethodNotAllowed}
+	}
+	urlInfo, err := extractURLPathInfo(strings.TrimPrefix(r.URL.Path, apiLatestPrefix))
+	if err != nil || urlInfo.requestedVersion != internal.LatestVersion {
+		return &serverError{status: http.StatusBadRequest, err: err}
+	}
+	ctx := r.Context()
+	modulePath := urlInfo.fullPath
+	if err := validatePathAndVersion(ctx, ds, modulePath, internal.LatestVersion); err != nil {
+		return err
+	}
+	lj, err := fetchLatestJSON(ctx, ds, modulePath)
+	if errors.Is(err, derrors.NotFound) {
+		return s.pathNotFoundErr(ctx, ds, modulePath, modulePath, internal.LatestVersion, "module")
+	}
+	if err != nil {
+		return err
+	}
+	setCacheControl(w, shortTTL)
+	return serveJSON(ctx, w, lj)
+}
+
+// fetchLatestJSON returns the latest version of the module with modulePath.
+// It returns an error wrapping derrors.NotFound if there is no such module.
+func fetchLatestJSON(ctx context.Context, ds internal.DataSource, modulePath string) (_ *LatestJSON, err error) {
+	defer derrors.Wrap(&err, "fetchLatestJSON(%q)", modulePath)
+
+	um, err := ds.GetUnitMeta(ctx, modulePath, modulePath, internal.LatestVersion)
+	if err != nil {
+		return nil, err
+	}
+	if um.ModulePath != modulePath {
+		return nil, fmt.Errorf("%s is not a module: %w", modulePath, derrors.NotFound)
+	}
+	lj := &LatestJSON{
+		ModulePath:          um.ModulePath,
+		Version:             um.Version,
+		CommitTime:          um.CommitTime,
+		Retracted:           um.Retracted,
+		RetractionRationale: um.RetractionRationale,
+		Deprecated:          um.Deprecation != "",
+		Deprecation:         um.Deprecation,
+	}
+	modInfos, err := ds.GetVersionsForPath(ctx, modulePath)
+	if err != nil {
+		return nil, err
+	}
+	retractions := collectRetractions(modInfos)
+	for _, mi := range modInfos {
+		if mi.ModulePath != modulePath {
+			continue
+		}
+		if retracted, _ := retraction(mi, retractions); retracted {
+			continue
+		}
+		if isRelease(mi.Version) && semver.Compare(mi.Version, lj.LatestRelease) > 0 {
+			lj.LatestRelease = mi.Version
+		}
+		if !isIncompatible(mi.Version) && semver.Compare(mi.Version, lj.LatestCompatible) > 0 {
+			lj.LatestCompatible = mi.Version
+		}
+	}
+	return lj, nil
+}
+
+// apiUnitPrefix is the URL path prefix of the unit API.
+const apiUnitPrefix = "/api/unit"
+
+// UnitJSON is the JSON representation of the metadata of a unit, served at
+// /api/unit/<import-path>[@<version>].
+type UnitJSON struct {
+	Path              string
+	ModulePath        string
+	Version           string
+	CommitTime        time.Time
+	Name              string `json:",omitempty"`
+	IsModule          bool
+	IsPackage         bool
+	IsRedistributable bool
+	// Licenses holds the types of the licenses that apply to the unit.
+	Licenses            []string
+	Retracted           bool
+	RetractionRationale string `json:",omitempty"`
+	Deprecation         string `json:",omitempty"`
+	// BuildContexts holds the build contexts for which the package has
+	// documentation. It is empty for units that are not packages, and for
+	// packages that are not redistributable.
+	BuildContexts []BuildContextJSON
+	// BuildFailureReason, if non-empty, explains why the package has no
+	// documentation.
+	BuildFailureReason string `json:",omitempty"`
+}
+
+// BuildContextJSON is the JSON representation of a build context.
+type BuildContextJSON struct {
+	GOOS   string
+	GOARCH string
+}
+
+// serveUnitAPI handles requests of the form
+// "/api/unit/<import-path>[@<version>]". It resolves the version in the same
+// way as the details pages do.
+func (s *Server) serveUnitAPI(w http.ResponseWriter, r *http.Request, ds internal.DataSource) error {
+	if r.Method != http.MethodGet {
+		return &serverError{status: http.StatusMethodNotAllowed}
+	}
+	urlPath := strings.TrimPrefix(r.URL.Path, apiUnitPrefix)
+	urlInfo, err := extractURLPathInfo(urlPath)
+	if err != nil || urlInfo.isModule && !stdlib.Contains(urlInfo.fullPath) {
+		return &serverError{status: http.StatusBadRequest, err: err}
+	}
+	ctx := r.Context()
+	if err := validatePathAndVersion(ctx, ds, urlInfo.fullPath, urlInfo.requestedVersion); err != nil {
+		return err
+	}
+	um, err := ds.GetUnitMeta(ctx, urlInfo.fullPath, urlInfo.modulePath, urlInfo.requestedVersion)
+	if err != nil {
+		if !errors.Is(err, derrors.NotFound) {
+			return err
+		}
+		return s.pathNotFoundErr(ctx, ds, urlInfo.fullPath, urlInfo.modulePath, urlInfo.requestedVersion, "package")
+	}
+	urlInfo.modulePath = um.ModulePath
+	s.refreshMaster(ctx, urlInfo, "serveUnitAPI", r.URL.Path)
+	uj, err := fetchUnitJSON(ctx, ds, um)
+	if err != nil {
+		return err
+	}
+	setCacheControl(w, detailsTTLForPath(ctx, urlPath, ""))
+	return serveJSON(ctx, w, uj)
+}
+
+// fetchUnitJSON returns the metadata of the unit described by um.
+func fetchUnitJSON(ctx context.Context, ds internal.DataSource, um *internal.UnitMeta) (_ *UnitJSON, err error) {
+	defer derrors.Wrap(&err, "fetchUnitJSON(%q, %q, %q)", um.Path, um.ModulePath, um.Version)
+
+	uj := &UnitJSON{
+		Path:                um.Path,
+		ModulePath:          um.ModulePath,
+		Version:             um.Version,
+		CommitTime:          um.CommitTime,
+		Name:                um.Name,
+		IsModule:            um.IsModule(),
+		IsPackage:           um.IsPackage(),
+		IsRedistributable:   um.IsRedistributable,
+		Licenses:            []string{},
+		Retracted:           um.Retracted,
+		RetractionRationale: um.RetractionRationale,
+		Deprecation:         um.Deprecation,
+		BuildContexts:       []BuildContextJSON{},
+	}
+	for _, l := range um.Licenses {
+		uj.Licenses = append(uj.Licenses, l.Types...)
+	}
+	if !um.IsPackage() || !um.IsRedistributable {
+		return uj, nil
+	}
+	u, err := ds.GetUnit(ctx, um, internal.WithDocumentation)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range u.Documentation {
+		uj.BuildContexts = append(uj.BuildContexts, BuildContextJSON{GOOS: d.GOOS, GOARCH: d.GOARCH})
+	}
+	uj.BuildFailureReason = u.BuildFailureReason
+	return uj, nil
+}
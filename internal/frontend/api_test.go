@@ -0,0 +1,274 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/safehtml"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/godoc"
+	"golang.org/x/pkgsite/internal/licenses"
+	"golang.org/x/pkgsite/internal/localdatasource"
+	"golang.org/x/pkgsite/internal/testing/sample"
+)
+
+func TestFetchDocumentationJSON(t *testing.T) {
+	api := &godoc.API{
+		Examples: []godoc.Example{{ID: "example-package", Code: `fmt.Println("hi")`, Output: "hi"}},
+		Symbols: []godoc.Symbol{
+			{
+				Name:       "F",
+				Kind:       "function",
+				Signature:  "func F()",
+				Doc:        "F is a function.\n\nDeprecated: use G.",
+				DocHTML:    "<p>F is a function.\n</p>",
+				Deprecated: true,
+			},
+			{
+				Name:      "T.M",
+				Kind:      "method",
+				Signature: "func (T) M(x int)",
+				Examples:  []godoc.Example{{ID: "example-T.M-Second", Suffix: "Second", Code: `fmt.Println("m")`}},
+			},
+		},
+	}
+	encodedAPI, err := json.Marshal(api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &internal.Unit{
+		UnitMeta: internal.UnitMeta{
+			Path:              "example.com/p",
+			ModulePath:        "example.com/p",
+			Version:           "v1.0.0",
+			Name:              "p",
+			IsRedistributable: true,
+			Licenses:          []*licenses.Metadata{{Types: []string{"MIT"}, FilePath: "LICENSE"}},
+		},
+		Documentation: []*internal.Documentation{{
+			GOOS:     "linux",
+			GOARCH:   "amd64",
+			Synopsis: "Package p is documented.",
+			HTML:     safehtml.HTMLEscaped("collapsed"),
+			API:      encodedAPI,
+		}},
+	}
+	ctx := context.Background()
+	got, err := fetchDocumentationJSON(ctx, unitDataSource{unit: u}, &u.UnitMeta, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &DocumentationJSON{
+		Path:              "example.com/p",
+		ModulePath:        "example.com/p",
+		Version:           "v1.0.0",
+		Name:              "p",
+		Synopsis:          "Package p is documented.",
+		IsRedistributable: true,
+		Licenses:          []string{"MIT"},
+		GOOS:              "linux",
+		GOARCH:            "amd64",
+		Examples:          api.Examples,
+		Symbols:           api.Symbols,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// Documentation stored before its API was recorded has none.
+	u.Documentation[0].API = nil
+	got, err = fetchDocumentationJSON(ctx, unitDataSource{unit: u}, &u.UnitMeta, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Message == "" || got.Symbols != nil {
+		t.Errorf("no API: got message %q and %d symbols, want an explanation and no symbols", got.Message, len(got.Symbols))
+	}
+
+	u.Documentation[0].API = encodedAPI
+	u.IsRedistributable = false
+	got, err = fetchDocumentationJSON(ctx, unitDataSource{unit: u}, &u.UnitMeta, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Message == "" || got.Symbols != nil {
+		t.Errorf("non-redistributable: got message %q and %d symbols, want an explanation and no symbols", got.Message, len(got.Symbols))
+	}
+}
+
+func TestFetchSearchJSON(t *testing.T) {
+	ctx := context.Background()
+	ds := localdatasource.New()
+	ds.Add(sample.Module("a.com/m", "v1.0.0", "foo", "x/foo"))
+	ds.Add(sample.Module("b.com/m", "v1.0.0", "foo"))
+
+	got, err := fetchSearchJSON(ctx, ds, "foo", paginationParams{page: 1, limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &SearchJSON{
+		Query: "foo",
+		Page:  1,
+		Total: 2,
+		Results: []*SearchResultJSON{{
+			PackagePath:      "a.com/m/foo",
+			ModulePath:       "a.com/m",
+			Version:          "v1.0.0",
+			Name:             "foo",
+			Synopsis:         sample.Synopsis,
+			Licenses:         []string{"MIT"},
+			CommitTime:       sample.CommitTime,
+			NumOtherPackages: 1,
+			OtherPackages:    []string{"a.com/m/x/foo"},
+		}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	got, err = fetchSearchJSON(ctx, ds, "nothing", paginationParams{page: 1, limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Total != 0 || got.Results == nil || len(got.Results) != 0 {
+		t.Errorf("no results: got %+v, want an empty list of results", got)
+	}
+}
+
+func TestFetchLatestJSON(t *testing.T) {
+	ctx := context.Background()
+	ds := localdatasource.New()
+	ds.Add(sample.Module("a.com/m", "v1.0.0", "pkg"))
+	ds.Add(sample.Module("a.com/m", "v1.1.0", "pkg"))
+	// v1.2.0 is retracted, so v1.1.0 is the latest version.
+	retract := sample.WithRetractedVersions(sample.RetractWithRationale("v1.2.0", "bad"))
+	ds.Add(sample.ModuleWithOptions("a.com/m", "v1.2.0", []string{"pkg"}, retract))
+	ds.Add(sample.ModuleWithOptions("a.com/m", "v1.3.0-pre", []string{"pkg"}, retract))
+	ds.Add(sample.ModuleWithOptions("a.com/m", "v2.0.0+incompatible", []string{"pkg"}, retract))
+
+	got, err := fetchLatestJSON(ctx, ds, "a.com/m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &LatestJSON{
+		ModulePath:       "a.com/m",
+		Version:          "v1.1.0",
+		CommitTime:       sample.CommitTime,
+		LatestRelease:    "v2.0.0+incompatible",
+		LatestCompatible: "v1.3.0-pre",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, path := range []string{"a.com/m/pkg", "b.com/m"} {
+		if _, err := fetchLatestJSON(ctx, ds, path); !errors.Is(err, derrors.NotFound) {
+			t.Errorf("fetchLatestJSON(%q): got %v, want NotFound", path, err)
+		}
+	}
+}
+
+func TestFetchUnitJSON(t *testing.T) {
+	ctx := context.Background()
+	ds := localdatasource.New()
+	ds.Add(sample.Module("a.com/m", "v1.0.0", "pkg"))
+
+	for _, test := range []struct {
+		path string
+		want *UnitJSON
+	}{
+		{
+			path: "a.com/m",
+			want: &UnitJSON{
+				Path:              "a.com/m",
+				ModulePath:        "a.com/m",
+				Version:           "v1.0.0",
+				CommitTime:        sample.CommitTime,
+				IsModule:          true,
+				IsRedistributable: true,
+				Licenses:          []string{"MIT"},
+				BuildContexts:     []BuildContextJSON{},
+			},
+		},
+		{
+			path: "a.com/m/pkg",
+			want: &UnitJSON{
+				Path:              "a.com/m/pkg",
+				ModulePath:        "a.com/m",
+				Version:           "v1.0.0",
+				CommitTime:        sample.CommitTime,
+				Name:              "pkg",
+				IsPackage:         true,
+				IsRedistributable: true,
+				Licenses:          []string{"MIT"},
+				BuildContexts:     []BuildContextJSON{{GOOS: sample.GOOS, GOARCH: sample.GOARCH}},
+			},
+		},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			um, err := ds.GetUnitMeta(ctx, test.path, internal.UnknownModulePath, internal.LatestVersion)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := fetchUnitJSON(ctx, ds, um)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestServeAPIError(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		err  error
+		want APIErrorJSON
+	}{
+		{
+			name: "not found",
+			err:  &serverError{status: http.StatusNotFound},
+			want: APIErrorJSON{Code: http.StatusNotFound, Message: "Not Found"},
+		},
+		{
+			name: "fetch",
+			err:  pathNotFoundErrorNew("a.com/m", "v1.0.0"),
+			want: APIErrorJSON{Code: http.StatusNotFound, Message: "Not Found", FetchPath: "/fetch/a.com/m@v1.0.0"},
+		},
+		{
+			name: "internal",
+			err:  errors.New("bad"),
+			want: APIErrorJSON{Code: http.StatusInternalServerError, Message: "Internal Server Error"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			serveAPIError(w, httptest.NewRequest("GET", "/api/latest/a.com/m", nil), test.err)
+			if w.Code != test.want.Code {
+				t.Errorf("got status %d, want %d", w.Code, test.want.Code)
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("got Content-Type %q, want application/json", got)
+			}
+			var got APIErrorJSON
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -5,33 +5,73 @@
 package frontend
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"io"
+	"errors"
 	"net/http"
-	"sort"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/go-redis/redis/v7"
+	"github.com/golang/groupcache/lru"
+	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/complete"
 	"golang.org/x/pkgsite/internal/derrors"
 	"golang.org/x/pkgsite/internal/log"
+	"golang.org/x/pkgsite/internal/stdlib"
 )
 
-// handleAutoCompletion handles requests for /autocomplete?q=<input prefix>, by
-// querying redis sorted sets indexing package paths.
-func (s *Server) handleAutoCompletion(w http.ResponseWriter, r *http.Request) {
+const (
+	// maxCompletions is the maximum number of completions returned for a
+	// query.
+	maxCompletions = 10
+
+	// minCompletionPrefix is the length of the shortest query that is
+	// completed from the database. A shorter prefix matches too many paths
+	// for the prefix scan to be fast, so only standard library packages are
+	// offered for it.
+	minCompletionPrefix = 3
+
+	// completionTimeout is the latency budget of the database query for a
+	// completion. If it is exceeded, only standard library packages are
+	// returned, and the result is not cached.
+	completionTimeout = 100 * time.Millisecond
+
+	// autocompleteCacheSize is the number of queries whose completions are
+	// cached, and completionTTL is how long they are cached for.
+	autocompleteCacheSize = 10000
+	completionTTL         = 1 * time.Hour
+)
+
+// wellKnownStdPackages are the standard library packages that are offered as
+// completions without querying the database.
+var wellKnownStdPackages = []string{
+	"bufio", "bytes", "context", "crypto/rand", "crypto/sha256", "crypto/tls",
+	"database/sql", "embed", "encoding/base64", "encoding/binary",
+	"encoding/csv", "encoding/hex", "encoding/json", "encoding/xml", "errors",
+	"flag", "fmt", "html/template", "io", "io/ioutil", "log", "math",
+	"math/rand", "net", "net/http", "net/http/httptest", "net/url", "os",
+	"os/exec", "os/signal", "path", "path/filepath", "reflect", "regexp",
+	"sort", "strconv", "strings", "sync", "sync/atomic", "testing",
+	"text/template", "time", "unicode", "unicode/utf8",
+}
+
+// serveAutoCompletion handles requests for /autocomplete?q=<input prefix>. It
+// responds with a JSON array of at most maxCompletions packages: first the
+// well-known standard library packages whose paths, or last path elements,
+// begin with the input, then the most imported packages whose paths begin
+// with it, ignoring case, if it is at least minCompletionPrefix long. Only paths are returned, never synopses, so that
+// nothing is shown for non-redistributable packages that should not be.
+//
+// Completions are answered from an in-memory cache, or with a single indexed
+// query on the database, and never with a full-text search.
+func (s *Server) serveAutoCompletion(w http.ResponseWriter, r *http.Request, ds internal.DataSource) error {
 	ctx := r.Context()
-	var completions []*complete.Completion
-	if s.cmplClient != nil {
-		var err error
-		q := r.FormValue("q")
-		completions, err = doCompletion(r.Context(), s.cmplClient, strings.ToLower(q), 5)
-		if err != nil {
-			code := http.StatusInternalServerError
-			http.Error(w, http.StatusText(code), code)
-			return
+	q := strings.ToLower(strings.TrimSpace(r.FormValue("q")))
+	completions, ok := s.autocompleteCache.get(q)
+	if !ok {
+		completions, ok = doCompletion(ctx, ds, q, maxCompletions)
+		if ok {
+			s.autocompleteCache.put(q, completions)
 		}
 	}
 	if completions == nil {
@@ -40,142 +80,104 @@ func (s *Server) handleAutoCompletion(w http.ResponseWriter, r *http.Request) {
 		// array.
 		completions = []*complete.Completion{}
 	}
-	response, err := json.Marshal(completions)
-	if err != nil {
-		log.Errorf(ctx, "error marshalling completion: json.Marshal: %v", err)
-	}
-	w.Header().Set("Content-Type", "application/json")
-	if _, err := io.Copy(w, bytes.NewReader(response)); err != nil {
-		log.Errorf(ctx, "Error copying json buffer to ResponseWriter: %v", err)
-	}
-}
-
-// scoredCompletion wraps Completions with a relevancy score, so that they can
-// be sorted.
-type scoredCompletion struct {
-	c     *complete.Completion
-	score int
+	return serveJSON(ctx, w, completions)
 }
 
-// doCompletion executes the completion query against redis. This is inspired
-// by http://oldblog.antirez.com/post/autocomplete-with-redis.html, but
-// improved as follows:
-//  + Use ZRANGEBYLEX to avoid storing each possible prefix, since that was
-//    added to Redis since the original blog post.
-//  + Use an additional sorted set that holds popular packages, to improve
-//    completion relevancy.
-//
-// We autocomplete the query 'q' as follows
-//  1. Query for popular completions starting with q using ZRANGEBYLEX (more
-//     details on this below). We fetch an arbitrary number of results (1000)
-//     to bound the amount of work done by redis.
-//  2. Sort the returned completions by our score (a mix of popularity and
-//     proximity to the end of the import path), and filter to the top
-//     maxResults.
-//  3. If we have maxResults results, we're done. Otherwise do (1) on the index
-//     of remaining (unpopular) package paths, add to our result set, and sort
-//     again (because unpopular packages might actually score higher than
-//     popular packages).
-func doCompletion(ctx context.Context, r *redis.Client, q string, maxResults int) (_ []*complete.Completion, err error) {
-	defer derrors.Wrap(&err, "doCompletion(%q, %d)", q, maxResults)
-	scored, err := completeWithIndex(ctx, r, q, complete.PopularKey, maxResults)
+// doCompletion returns at most maxResults completions of q, which must be
+// lower case, as described at serveAutoCompletion. It reports false if the
+// database could not be queried in time, in which case only standard library
+// packages are returned.
+func doCompletion(ctx context.Context, ds internal.DataSource, q string, maxResults int) ([]*complete.Completion, bool) {
+	if q == "" {
+		return nil, true
+	}
+	completions := completeStdPackages(q, maxResults)
+	if len(q) < minCompletionPrefix || len(completions) >= maxResults {
+		return completions, true
+	}
+	ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+	defer cancel()
+	dbCompletions, err := ds.GetPathCompletions(ctx, q, maxResults)
+	if errors.Is(err, derrors.Unsupported) {
+		return completions, true
+	}
 	if err != nil {
-		return nil, err
+		log.Errorf(ctx, "doCompletion(%q): %v", q, err)
+		return completions, false
 	}
-	if len(scored) < maxResults {
-		unpopular, err := completeWithIndex(ctx, r, q, complete.RemainingKey, maxResults-len(scored))
-		if err != nil {
-			return nil, err
-		}
-		scored = append(scored, unpopular...)
-		// Re-sort, as it is possible that an unpopular completion actually has a
-		// higher score than a popular completion due to the weighting for suffix
-		// length.
-		sort.Slice(scored, func(i, j int) bool {
-			return scored[i].score > scored[j].score
-		})
+	seen := map[string]bool{}
+	for _, c := range completions {
+		seen[c.PackagePath] = true
 	}
-	var completions []*complete.Completion
-	for _, s := range scored {
-		completions = append(completions, s.c)
+	for _, c := range dbCompletions {
+		if len(completions) == maxResults {
+			break
+		}
+		if !seen[c.PackagePath] {
+			completions = append(completions, c)
+		}
 	}
-	return completions, nil
+	return completions, true
 }
 
-func completeWithIndex(ctx context.Context, r *redis.Client, q, indexKey string, maxResults int) (_ []*scoredCompletion, err error) {
-	defer derrors.Wrap(&err, "completeWithIndex(%q, %q, %d)", q, indexKey, maxResults)
-
-	// Query for possible completions using ZRANGEBYLEX. See documentation at
-	// https://redis.io/commands/zrangebylex
-	// Notably, the "(" character in the Min and Max fields means 'exclude this
-	// endpoint'.
-	// We bound our search in two ways: (1) by setting Max to the smallest string
-	// that lexically greater than q but does not start with q, and (2) by
-	// setting an arbitrary limit of 1000 results.
-	entries, err := r.WithContext(ctx).ZRangeByLex(indexKey, &redis.ZRangeBy{
-		Min:   "(" + q,
-		Max:   "(" + nextPrefix(q),
-		Count: 1000,
-	}).Result()
-	var scored []*scoredCompletion
-	for _, entry := range entries {
-		c, err := complete.Decode(entry)
-		if err != nil {
-			return nil, err
+// completeStdPackages returns at most maxResults of the well-known standard
+// library packages whose paths, or last path elements, begin with q.
+func completeStdPackages(q string, maxResults int) []*complete.Completion {
+	var completions []*complete.Completion
+	for _, p := range wellKnownStdPackages {
+		if len(completions) == maxResults {
+			break
 		}
-		offset := len(strings.Split(entry, "/"))
-		s := &scoredCompletion{
-			c: c,
-			// Weight importers by distance of the matching text from the end of the
-			// import path. This is done in an attempt to make results more relevant
-			// the closer the match is to the end of the import path. For example, if
-			// the user types 'net', we should have some preference for 'net' over
-			// 'net/http'. In this case, it actually works out like so:
-			//  - net has ~68000 importers
-			//  - net/http has ~130000 importers
-			//
-			// So the score of 'net' is ~68000 (offset=1), and the score of
-			// 'net/http' is ~65000 (130K/2, as offset=2), therefore net should be
-			// sorted above 'net/http' in the results.
-			//
-			// This heuristic is a total guess, but since this is just autocomplete
-			// it probably doesn't matter much. In testing, it felt like autocomplete
-			// was completing the packages I wanted.
-			//
-			// The `- offset` term is added to break ties in the case where all
-			// completion results have 0 importers.
-			score: c.Importers/offset - offset,
+		if strings.HasPrefix(p, q) || strings.HasPrefix(p[strings.LastIndex(p, "/")+1:], q) {
+			completions = append(completions, &complete.Completion{
+				Suffix:      p,
+				ModulePath:  stdlib.ModulePath,
+				PackagePath: p,
+			})
 		}
-		scored = append(scored, s)
-	}
-	// sort by score descending
-	sort.Slice(scored, func(i, j int) bool {
-		return scored[i].score > scored[j].score
-	})
-	if len(scored) > maxResults {
-		scored = scored[:maxResults]
 	}
-	return scored, nil
+	return completions
 }
 
-// nextPrefix returns the first string (according to lexical sorting) that is
-// greater than prefix but does not start with prefix.
-func nextPrefix(prefix string) string {
-	// redis strings are ASCII. Note that among printing ASCII characters '!' has
-	// the smallest byte value and '~' has the largest byte value. It also so
-	// happens that these are both valid characters in a URL.
-	if prefix == "" {
-		return ""
+// completionCache is an LRU cache of the completions of queries. Entries
+// expire after completionTTL, so that changes in popularity are picked up.
+type completionCache struct {
+	mu    sync.Mutex
+	cache *lru.Cache
+}
+
+type completionCacheEntry struct {
+	completions []*complete.Completion
+	expires     time.Time
+}
+
+func newCompletionCache(size int) *completionCache {
+	return &completionCache{cache: lru.New(size)}
+}
+
+// get returns the cached completions of q, and reports whether there were
+// any that had not expired.
+func (c *completionCache) get(q string) ([]*complete.Completion, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.cache.Get(q)
+	if !ok {
+		return nil, false
 	}
-	lastChar := prefix[len(prefix)-1]
-	if lastChar >= '~' {
-		// If the last character is '~', there is no greater ascii character so we
-		// must move to the previous character to find a lexically greater string
-		// that doesn't start with prefix. Note that in the degenerate case where
-		// prefix is nothing but twiddles (e.g. "~~~"), we will recurse until we return "",
-		// which is acceptable: there is no prefix that satisfies our requirements:
-		// all strings greater than "~~~" must also start with "~~~"
-		return nextPrefix(prefix[:len(prefix)-1])
+	e := v.(*completionCacheEntry)
+	if time.Now().After(e.expires) {
+		c.cache.Remove(q)
+		return nil, false
 	}
-	return prefix[:len(prefix)-1] + string(lastChar+1)
+	return e.completions, true
+}
+
+// put caches completions as those of q.
+func (c *completionCache) put(q string, completions []*complete.Completion) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache.Add(q, &completionCacheEntry{
+		completions: completions,
+		expires:     time.Now().Add(completionTTL),
+	})
 }
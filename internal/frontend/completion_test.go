@@ -7,89 +7,64 @@ package frontend
 import (
 	"context"
 	"testing"
+	"time"
 
-	"github.com/alicebob/miniredis/v2"
-	"github.com/go-redis/redis/v7"
 	"github.com/google/go-cmp/cmp"
 	"golang.org/x/pkgsite/internal/complete"
+	"golang.org/x/pkgsite/internal/localdatasource"
+	"golang.org/x/pkgsite/internal/testing/sample"
 )
 
-func TestAutoCompletion(t *testing.T) {
-	s, err := miniredis.Run()
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer s.Close()
-	r := redis.NewClient(&redis.Options{Addr: s.Addr()})
-	// For convenence, populate completion data based on detail path -> imports.
-	pathData := map[string]int{
-		"foo.com/bar@v1.2.3/baz":          123,
-		"foo.com/quux@v1.0.0/bark":        10,
-		"github.com/something@v2.0.0/foo": 80,
-	}
-	for k, v := range pathData {
-		pkgPath, modPath, version, err := parseDetailsURLPath(k)
-		if err != nil {
-			t.Fatal(err)
-		}
-		partial := complete.Completion{
-			PackagePath: pkgPath,
-			ModulePath:  modPath,
-			Version:     version,
-			Importers:   v,
-		}
-		completions := complete.PathCompletions(partial)
-		var zs []*redis.Z
-		for _, cmpl := range completions {
-			zs = append(zs, &redis.Z{Member: cmpl.Encode()})
-		}
-		if v > 0 {
-			r.ZAdd(complete.PopularKey, zs...)
-		} else {
-			r.ZAdd(complete.RemainingKey, zs...)
-		}
-	}
+func TestDoCompletion(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
 	defer cancel()
 
-	tests := []struct {
+	ds := localdatasource.New()
+	ds.Add(sample.Module("github.com/net/x", sample.VersionString, "nettest"))
+	for _, test := range []struct {
 		q    string
+		max  int
 		want []string
 	}{
-		{"baz", []string{"foo.com/bar/baz"}},
-		{"bar", []string{"foo.com/bar/baz", "foo.com/quux/bark"}},
-		{"foo", []string{"github.com/something/foo", "foo.com/bar/baz"}},
-	}
-	for _, test := range tests {
-		t.Run(test.q, func(t *testing.T) {
-			results, err := doCompletion(ctx, r, test.q, 2)
-			if err != nil {
-				t.Fatal(err)
-			}
-			var got []string
-			for _, res := range results {
-				got = append(got, res.PackagePath)
-			}
-			if diff := cmp.Diff(test.want, got); diff != "" {
-				t.Errorf("doCompletion(%q) mismatch (-want +got)\n%s", test.q, diff)
-			}
-		})
+		{"", 10, nil},
+		{"net/h", 10, []string{"net/http", "net/http/httptest"}},
+		// Last path elements match too.
+		{"http", 10, []string{"net/http", "net/http/httptest"}},
+		{"t", 3, []string{"crypto/tls", "html/template", "testing"}},
+		{"github.com/", 10, []string{"github.com/net/x/nettest"}},
+		// Short queries are only completed with standard library packages.
+		{"ne", 10, []string{"net", "net/http", "net/http/httptest", "net/url"}},
+	} {
+		completions, ok := doCompletion(ctx, ds, test.q, test.max)
+		if !ok {
+			t.Errorf("doCompletion(%q): got false, want true", test.q)
+		}
+		var got []string
+		for _, c := range completions {
+			got = append(got, c.PackagePath)
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("doCompletion(%q) mismatch (-want +got)\n%s", test.q, diff)
+		}
 	}
 }
 
-func TestNextPrefix(t *testing.T) {
-	tests := []struct {
-		prefix, want string
-	}{
-		{"", ""},
-		{"~~~", ""},
-		{"aa", "ab"},
-		{"aB", "aC"},
-		{"a~", "b"},
+func TestCompletionCache(t *testing.T) {
+	c := newCompletionCache(1)
+	want := []*complete.Completion{{PackagePath: "fmt"}}
+	c.put("f", want)
+	if got, ok := c.get("f"); !ok || !cmp.Equal(got, want) {
+		t.Errorf(`get("f") = %v, %t; want %v, true`, got, ok, want)
 	}
-	for _, test := range tests {
-		if got := nextPrefix(test.prefix); got != test.want {
-			t.Errorf("nextPrefix(%q) = %q, want %q", test.prefix, got, test.want)
-		}
+	// The least recently used entry is evicted.
+	c.put("fm", want)
+	if _, ok := c.get("f"); ok {
+		t.Error(`get("f") after eviction: got true, want false`)
+	}
+	// Expired entries are not returned.
+	c.put("e", want)
+	c.cache.Add("e", &completionCacheEntry{completions: want, expires: time.Now().Add(-time.Second)})
+	if _, ok := c.get("e"); ok {
+		t.Error(`get("e") after expiry: got true, want false`)
 	}
 }
@@ -23,6 +23,7 @@ import (
 	"golang.org/x/pkgsite/internal/experiment"
 	"golang.org/x/pkgsite/internal/log"
 	"golang.org/x/pkgsite/internal/postgres"
+	"golang.org/x/pkgsite/internal/queue"
 	"golang.org/x/pkgsite/internal/stdlib"
 )
 
@@ -61,6 +62,19 @@ type DetailsPage struct {
 	// For example, if the latest version of /my.module/pkg is version v1.5.2,
 	// the canonical url for that path would be /my.module@v1.5.2/pkg
 	CanonicalURLPath string
+
+	// CanonicalLink, if non-empty, is the URL of the page that search engines
+	// should index instead of this one, such as the documentation for the
+	// default build context when another one is requested.
+	CanonicalLink string
+
+	// LatestMajor, if non-nil, describes a higher major version of the
+	// module than that of the page.
+	LatestMajor *LatestMajorVersion
+
+	// Vulns are the entries of the Go vulnerability database that affect
+	// the package, or any package of the module on a module page.
+	Vulns []*VulnEntry
 }
 
 const (
@@ -98,7 +112,13 @@ func (s *Server) serveDetails(w http.ResponseWriter, r *http.Request, ds interna
 
 	switch r.URL.Path {
 	case "/":
-		s.staticPageHandler("index.tmpl", "")(w, r)
+		page := s.newBasePage(r, "")
+		page.Social = &socialMetadata{
+			Title:       "pkg.go.dev",
+			Description: siteDescription,
+			URL:         "https://" + r.Host + "/",
+		}
+		s.servePage(r.Context(), w, "index.tmpl", page)
 		return nil
 	case "/C":
 		// Package "C" is a special case: redirect to the Go Blog article on cgo.
@@ -141,22 +161,7 @@ func (s *Server) serveDetails(w http.ResponseWriter, r *http.Request, ds interna
 		urlInfo.modulePath = um.ModulePath
 		urlInfo.resolvedVersion = um.Version
 
-		if isActivePathAtMaster(ctx) && urlInfo.requestedVersion == internal.MasterVersion {
-			// Since path@master is a moving target, we don't want it to be stale.
-			// As a result, we enqueue every request of path@master to the frontend
-			// task queue, which will initiate a fetch request depending on the
-			// last time we tried to fetch this module version.
-			//
-			// Use a separate context here to prevent the context from being canceled
-			// elsewhere before a task is enqueued.
-			go func() {
-				ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
-				defer cancel()
-				if _, err := s.queue.ScheduleFetch(ctx, urlInfo.modulePath, internal.MasterVersion, "", s.taskIDChangeInterval); err != nil {
-					log.Errorf(ctx, "serveDetails(%q): %v", r.URL.Path, err)
-				}
-			}()
-		}
+		s.refreshMaster(ctx, urlInfo, "serveDetails", r.URL.Path)
 		if isActiveUseUnits(ctx) {
 			return s.serveDetailsPage(w, r, ds, um, urlInfo)
 		}
@@ -164,6 +169,33 @@ func (s *Server) serveDetails(w http.ResponseWriter, r *http.Request, ds interna
 	return s.legacyServeDetailsPage(w, r, ds, urlInfo)
 }
 
+// refreshMaster schedules a fetch of the master version of the module
+// described by urlInfo, if that version was requested. caller and urlPath
+// are used for logging.
+func (s *Server) refreshMaster(ctx context.Context, urlInfo *urlPathInfo, caller, urlPath string) {
+	if !isActivePathAtMaster(ctx) || urlInfo.requestedVersion != internal.MasterVersion {
+		return
+	}
+	if urlInfo.modulePath == stdlib.ModulePath {
+		// The worker refreshes the standard library at master daily.
+		return
+	}
+	// Since path@master is a moving target, we don't want it to be stale.
+	// As a result, we enqueue every request of path@master to the frontend
+	// task queue, which will initiate a fetch request depending on the
+	// last time we tried to fetch this module version.
+	//
+	// Use a separate context here to prevent the context from being canceled
+	// elsewhere before a task is enqueued.
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+		defer cancel()
+		if _, err := s.queue.ScheduleFetch(ctx, urlInfo.modulePath, internal.MasterVersion, "", queue.PriorityInteractive, s.taskIDChangeInterval); err != nil {
+			log.Errorf(ctx, "%s(%q): %v", caller, urlPath, err)
+		}
+	}()
+}
+
 // serveDetailsPage serves a details page for a path using the paths,
 // modules, documentation, readmes, licenses, and package_imports tables.
 func (s *Server) serveDetailsPage(w http.ResponseWriter, r *http.Request, ds internal.DataSource, um *internal.UnitMeta, info *urlPathInfo) (err error) {
@@ -335,16 +367,18 @@ func validatePathAndVersion(ctx context.Context, ds internal.DataSource, fullPat
 		return err
 	}
 	if excluded {
-		// Return NotFound; don't let the user know that the package was excluded.
-		return &serverError{status: http.StatusNotFound}
+		return excludedPathError(fullPath)
 	}
 	return nil
 }
 
 // isSupportedVersion reports whether the version is supported by the frontend.
+// The standard library at master is always supported: it is served from the
+// snapshot of master that the worker refreshes, and is never fetched by the
+// frontend.
 func isSupportedVersion(ctx context.Context, fullPath, requestedVersion string) bool {
 	if stdlib.Contains(fullPath) && requestedVersion == internal.MasterVersion {
-		return false
+		return true
 	}
 	if requestedVersion == internal.LatestVersion || semver.IsValid(requestedVersion) {
 		return true
@@ -413,12 +447,84 @@ func pathNotFoundErrorNew(fullPath, requestedVersion string) error {
 	}
 }
 
+// excludedPathError returns the error page for a path that is excluded from
+// the site. It deliberately says nothing about why.
+func excludedPathError(fullPath string) error {
+	return &serverError{
+		status: http.StatusNotFound,
+		epage: &errorPage{
+			messageTemplate: template.MakeTrustedTemplate(
+				`<h3 class="Error-message">“{{.}}” is not available on this site.</h3>`),
+			MessageData: fullPath,
+		},
+	}
+}
+
+// A fetchFailure describes the failed fetch of the module of a path, as
+// recorded in version_map. It is the data of the error page for the path.
+type fetchFailure struct {
+	Path string // the requested path, with its version if any
+	// ErrorCode is the derrors error code of the fetch.
+	ErrorCode string
+	// Message explains the error, and Guidance, if non-empty, says what the
+	// module author can do about it.
+	Message  string
+	Guidance string
+}
+
+// fetchFailedError returns the error page for fullPath at requestedVersion,
+// whose module could not be processed as recorded in fr. It returns nil if
+// the error code of fr does not explain why fullPath could not be found.
+func fetchFailedError(fr *fetchResult, fullPath, requestedVersion string) error {
+	msg := fetchErrorText(fr, fullPath, requestedVersion)
+	if msg == "" {
+		return nil
+	}
+	return &serverError{
+		status: http.StatusNotFound,
+		err:    fmt.Errorf("fetching %s@%s: %s", fr.modulePath, requestedVersion, fr.errorCode),
+		epage: &errorPage{
+			messageTemplate: template.MakeTrustedTemplate(`
+				<h3 class="Error-message">“{{.Path}}” could not be processed.</h3>
+				<p class="Error-message js-fetchError" data-error-code="{{.ErrorCode}}">{{.Message}}</p>
+				{{with .Guidance}}<p class="Error-message">{{.}}</p>{{end}}`),
+			MessageData: &fetchFailure{
+				Path:      displayPath(fullPath, requestedVersion),
+				ErrorCode: fr.errorCode,
+				Message:   msg,
+				Guidance:  fetchErrorGuidance(fr.errorCode),
+			},
+		},
+	}
+}
+
+// recordedFetchError returns the error page explaining why fullPath could
+// not be found at requestedVersion, according to results, the recorded
+// fetches of its candidate module paths from longest to shortest. It returns
+// nil if none of them explains it.
+func recordedFetchError(results []*fetchResult, fullPath, requestedVersion string) error {
+	for _, fr := range results {
+		if fr.errorCode == derrors.CodeExcluded {
+			return excludedPathError(fullPath)
+		}
+		if err := fetchFailedError(fr, fullPath, requestedVersion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // pathFoundAtLatestError returns an error page when the fullPath exists, but
 // the version that is requested does not.
 func pathFoundAtLatestError(ctx context.Context, pathType, fullPath, requestedVersion string) error {
 	if isActiveFrontendFetch(ctx) {
 		return pathNotFoundErrorNew(fullPath, requestedVersion)
 	}
+	// Versions of the standard library are displayed as Go tags.
+	modulePath := fullPath
+	if stdlib.Contains(fullPath) {
+		modulePath = stdlib.ModulePath
+	}
 	return &serverError{
 		status: http.StatusNotFound,
 		epage: &errorPage{
@@ -429,7 +535,7 @@ func pathFoundAtLatestError(ctx context.Context, pathType, fullPath, requestedVe
 				  <a href="/{{.Path}}?tab=versions">click here</a>.
 				</p>`),
 			MessageData: struct{ TType, Type, Path, Version string }{
-				strings.Title(pathType), pathType, fullPath, displayVersion(requestedVersion, fullPath)},
+				strings.Title(pathType), pathType, fullPath, displayVersion(requestedVersion, modulePath)},
 		},
 	}
 }
@@ -479,17 +585,67 @@ func (s *Server) servePathNotFoundPage(w http.ResponseWriter, r *http.Request, d
 		http.Redirect(w, r, fmt.Sprintf("/%s", path), http.StatusFound)
 		return
 	}
+	if requestedVersion == internal.LatestVersion {
+		path, candidates, err := packageForShortcut(ctx, ds, fullPath)
+		if err != nil {
+			log.Error(ctx, err)
+		}
+		if path != "" {
+			http.Redirect(w, r, fmt.Sprintf("/%s", path), http.StatusFound)
+			return nil
+		}
+		if len(candidates) > 0 {
+			return shortcutCandidatesError(fullPath, candidates)
+		}
+	}
+	err = s.pathNotFoundErr(ctx, ds, fullPath, modulePath, requestedVersion, pathType)
+	var moved *movedModule
+	if errors.As(err, &moved) && moved.pathAvailable {
+		http.Redirect(w, r, moved.url(requestedVersion), http.StatusFound)
+		return nil
+	}
+	return err
+}
 
+// pathNotFoundErr returns the error to serve when fullPath does not exist at
+// requestedVersion. pathType is always either the string "package" or
+// "module".
+//
+// If fullPath is in a module whose go.mod file declares a different path,
+// the error wraps a *movedModule.
+func (s *Server) pathNotFoundErr(ctx context.Context, ds internal.DataSource, fullPath, modulePath, requestedVersion, pathType string) error {
+	moved, err := findMovedModule(ctx, ds, fullPath, requestedVersion)
+	if err != nil {
+		// Log the error, but prefer a "path not found" error for a
+		// better user experience.
+		log.Error(ctx, err)
+	}
+	if moved != nil {
+		return movedModuleError(moved, fullPath, requestedVersion)
+	}
+	db, isDB := ds.(*postgres.DB)
+	if isDB && !stdlib.Contains(fullPath) && !isActiveFrontendFetch(ctx) {
+		// Even without frontend fetch, explain why the module of fullPath
+		// could not be processed, if that is known.
+		if modulePaths, err := candidateModulePaths(fullPath); err == nil {
+			results := checkForPaths(ctx, db, fullPath, modulePaths, requestedVersion, s.taskIDChangeInterval)
+			if err := recordedFetchError(results, fullPath, requestedVersion); err != nil {
+				return err
+			}
+		}
+	}
 	if isActiveFrontendFetch(ctx) && !stdlib.Contains(fullPath) {
-		db, ok := ds.(*postgres.DB)
-		if !ok {
+		if !isDB {
 			return pathNotFoundError(ctx, pathType, fullPath, requestedVersion)
 		}
 		modulePaths, err := candidateModulePaths(fullPath)
 		if err != nil {
 			return err
 		}
-		results := s.checkPossibleModulePaths(ctx, db, fullPath, requestedVersion, modulePaths, false)
+		results := s.checkPossibleModulePaths(ctx, db, fullPath, requestedVersion, modulePaths, false, fetchRequester{})
+		if err := recordedFetchError(results, fullPath, requestedVersion); err != nil {
+			return err
+		}
 		for _, fr := range results {
 			if fr.status == statusNotFoundInVersionMap {
 				// If the result is statusNotFoundInVersionMap, it means that
@@ -6,13 +6,21 @@ package frontend
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/safehtml/template"
 	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/postgres"
 	"golang.org/x/pkgsite/internal/stdlib"
+	"golang.org/x/pkgsite/internal/testing/sample"
 )
 
 func TestExtractURLPathInfo(t *testing.T) {
@@ -235,3 +243,265 @@ func TestValidatePathAndVersion(t *testing.T) {
 type fakeDataSource struct {
 	internal.DataSource
 }
+
+func TestServeMovedModule(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer postgres.ResetTestDB(testDB, t)
+
+	const (
+		oldPath = "github.com/old/name"
+		newPath = "github.com/new/name"
+	)
+	if err := testDB.InsertModule(ctx, sample.Module(newPath, "v1.0.0", "pkg")); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{internal.LatestVersion, "v1.0.0"} {
+		if err := testDB.UpsertVersionMap(ctx, &internal.VersionMap{
+			ModulePath:       oldPath,
+			RequestedVersion: v,
+			ResolvedVersion:  "v1.0.0",
+			GoModPath:        newPath,
+			Status:           derrors.ToStatus(derrors.AlternativeModule),
+			ErrorCode:        derrors.CodeAlternativeModule,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, handler, teardown := newTestServer(t, nil)
+	defer teardown()
+	for _, test := range []struct {
+		urlPath      string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{"/" + oldPath, http.StatusFound, "/" + newPath, ""},
+		{"/" + oldPath + "/pkg", http.StatusFound, "/" + newPath + "/pkg", ""},
+		{"/" + oldPath + "@v1.0.0/pkg", http.StatusFound, "/" + newPath + "@v1.0.0/pkg", ""},
+		{"/" + oldPath + "/missing", http.StatusNotFound, "", `<a href="/` + newPath + `">` + newPath + `</a>`},
+	} {
+		t.Run(test.urlPath, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", test.urlPath, nil))
+			if w.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, test.wantStatus)
+			}
+			if got := w.Header().Get("Location"); got != test.wantLocation {
+				t.Errorf("Location = %q, want %q", got, test.wantLocation)
+			}
+			if body := w.Body.String(); !strings.Contains(body, test.wantBody) {
+				t.Errorf("body does not contain %q:\n%s", test.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestMovedModuleURL(t *testing.T) {
+	m := &movedModule{
+		modulePath:    "github.com/old/name",
+		goModPath:     "github.com/new/name",
+		path:          "github.com/new/name/pkg",
+		pathAvailable: true,
+	}
+	for _, test := range []struct {
+		version, want string
+	}{
+		{internal.LatestVersion, "/github.com/new/name/pkg"},
+		{"v1.2.3", "/github.com/new/name@v1.2.3/pkg"},
+	} {
+		if got := m.url(test.version); got != test.want {
+			t.Errorf("url(%q) = %q, want %q", test.version, got, test.want)
+		}
+	}
+	m.pathAvailable = false
+	if got, want := m.url("v1.2.3"), "/github.com/new/name"; got != want {
+		t.Errorf("url of unavailable path = %q, want %q", got, want)
+	}
+}
+
+func TestServeNotFoundPages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer postgres.ResetTestDB(testDB, t)
+
+	for _, vm := range []*internal.VersionMap{
+		{
+			ModulePath:       "github.com/big/mod",
+			RequestedVersion: internal.LatestVersion,
+			ResolvedVersion:  "v1.0.0",
+			Status:           derrors.ToStatus(derrors.ModuleTooLarge),
+			ErrorCode:        derrors.CodeModuleTooLarge,
+		},
+		{
+			ModulePath:       "github.com/empty/mod",
+			RequestedVersion: "v1.0.0",
+			ResolvedVersion:  "v1.0.0",
+			Status:           derrors.ToStatus(derrors.ModuleHasNoPackages),
+			ErrorCode:        derrors.CodeModuleHasNoPackages,
+		},
+	} {
+		if err := testDB.UpsertVersionMap(ctx, vm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := testDB.InsertExcludedPrefix(ctx, "github.com/bad", "someone", "because"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name, urlPath string
+		experiments   []string
+		wantBody      []string
+	}{
+		{
+			name:    "too large",
+			urlPath: "/github.com/big/mod/pkg",
+			wantBody: []string{
+				`data-error-code="module_too_large"`,
+				"is in a module that is too large to process",
+				"Consider splitting the module",
+			},
+		},
+		{
+			name:    "no packages",
+			urlPath: "/github.com/empty/mod@v1.0.0",
+			wantBody: []string{
+				`data-error-code="module_has_no_packages"`,
+				"does not contain any Go packages",
+			},
+		},
+		{
+			name:     "excluded",
+			urlPath:  "/github.com/bad/mod",
+			wantBody: []string{"is not available on this site"},
+		},
+		{
+			name:     "unknown",
+			urlPath:  "/github.com/unknown/mod",
+			wantBody: []string{"instructions here"},
+		},
+		{
+			name:        "unknown with frontend fetch",
+			urlPath:     "/github.com/unknown/mod",
+			experiments: []string{internal.ExperimentFrontendFetch, internal.ExperimentUsePathInfo},
+			wantBody:    []string{"js-fetchButton", "Request “github.com/unknown/mod”"},
+		},
+		{
+			name:        "too large with frontend fetch",
+			urlPath:     "/github.com/big/mod/pkg",
+			experiments: []string{internal.ExperimentFrontendFetch, internal.ExperimentUsePathInfo},
+			wantBody:    []string{`data-error-code="module_too_large"`},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, handler, teardown := newTestServer(t, nil, test.experiments...)
+			defer teardown()
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", test.urlPath, nil))
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
+			}
+			body := w.Body.String()
+			for _, want := range test.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("body does not contain %q:\n%s", want, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordedFetchError(t *testing.T) {
+	const fullPath = "github.com/a/b/c"
+	for _, test := range []struct {
+		name     string
+		results  []*fetchResult
+		wantCode string // empty => want nil error
+		wantText string
+	}{
+		{
+			name: "no error codes",
+			results: []*fetchResult{
+				{modulePath: "github.com/a/b/c", status: statusNotFoundInVersionMap},
+				{modulePath: "github.com/a/b", status: http.StatusNotFound},
+			},
+		},
+		{
+			name: "too many packages",
+			results: []*fetchResult{
+				{modulePath: "github.com/a/b/c", status: statusNotFoundInVersionMap},
+				{modulePath: "github.com/a/b", status: http.StatusNotFound, errorCode: derrors.CodeModuleTooManyPackages},
+			},
+			wantCode: derrors.CodeModuleTooManyPackages,
+			wantText: "Consider splitting",
+		},
+		{
+			name: "bad casing",
+			results: []*fetchResult{
+				{modulePath: "github.com/a/b", goModPath: "github.com/A/b", status: http.StatusNotFound, errorCode: derrors.CodeModulePathCasing},
+			},
+			wantCode: derrors.CodeModulePathCasing,
+			wantText: "Were you looking for “github.com/A/b”?",
+		},
+		{
+			name: "excluded",
+			results: []*fetchResult{
+				{modulePath: "github.com/a/b", status: http.StatusNotFound, errorCode: derrors.CodeExcluded},
+			},
+			wantText: "is not available on this site",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := recordedFetchError(test.results, fullPath, internal.LatestVersion)
+			if test.wantText == "" {
+				if err != nil {
+					t.Fatalf("got %v, want nil", err)
+				}
+				return
+			}
+			var serr *serverError
+			if !errors.As(err, &serr) || serr.epage == nil {
+				t.Fatalf("got %v, want serverError with error page", err)
+			}
+			if serr.status != http.StatusNotFound {
+				t.Errorf("status = %d, want %d", serr.status, http.StatusNotFound)
+			}
+			tmpl, err := template.New("message").ParseFromTrustedTemplate(serr.epage.messageTemplate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b strings.Builder
+			if err := tmpl.Execute(&b, serr.epage.MessageData); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(b.String(), test.wantText) {
+				t.Errorf("message %q does not contain %q", b.String(), test.wantText)
+			}
+			if f, ok := serr.epage.MessageData.(*fetchFailure); ok != (test.wantCode != "") || (ok && f.ErrorCode != test.wantCode) {
+				t.Errorf("MessageData = %#v, want fetchFailure with code %q", serr.epage.MessageData, test.wantCode)
+			}
+		})
+	}
+}
+
+func TestPathFoundAtLatestErrorVersion(t *testing.T) {
+	for _, test := range []struct {
+		fullPath, requestedVersion, want string
+	}{
+		{"fmt", "v1.20.14", "go1.20.14"},
+		{"encoding/json", "v1.21.0-rc.2", "go1.21rc2"},
+		{"github.com/a/b", "v1.2.0", "v1.2.0"},
+	} {
+		err := pathFoundAtLatestError(context.Background(), "package", test.fullPath, test.requestedVersion)
+		var serr *serverError
+		if !errors.As(err, &serr) || serr.epage == nil {
+			t.Fatalf("%s@%s: got %v, want a serverError with a page", test.fullPath, test.requestedVersion, err)
+		}
+		v := reflect.ValueOf(serr.epage.MessageData).FieldByName("Version").String()
+		if v != test.want {
+			t.Errorf("%s@%s: displayed version %q, want %q", test.fullPath, test.requestedVersion, v, test.want)
+		}
+	}
+}
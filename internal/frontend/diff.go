@@ -0,0 +1,206 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/safehtml/template"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/godoc"
+)
+
+// DiffPage contains data for the API diff template.
+type DiffPage struct {
+	basePage
+	Path string
+	// OldVersion and NewVersion are the resolved versions being compared.
+	OldVersion, NewVersion string
+	// Groups holds the changes, grouped by kind of symbol. Kinds without
+	// changes are omitted.
+	Groups []*DiffGroup
+}
+
+// A DiffGroup holds the API changes for one kind of symbol.
+type DiffGroup struct {
+	Title   string
+	Added   []godoc.Symbol
+	Removed []godoc.Symbol
+	Changed []godoc.SymbolChange
+}
+
+// diffGroupTitles are the titles of the groups of a DiffPage, by kind.
+var diffGroupTitles = map[string]string{
+	"constant": "Constants",
+	"variable": "Variables",
+	"function": "Functions",
+	"type":     "Types",
+	"method":   "Methods",
+}
+
+// serveDiff serves a page listing the symbols that were added, removed or
+// changed between two versions of a package. It expects paths of the form
+// "/diff/<import-path>@<version1>..<version2>".
+func (s *Server) serveDiff(w http.ResponseWriter, r *http.Request, ds internal.DataSource) (err error) {
+	if r.Method != http.MethodGet {
+		return &serverError{status: http.StatusMethodNotAllowed}
+	}
+	fullPath, oldVersion, newVersion, err := parseDiffURLPath(strings.TrimPrefix(r.URL.Path, "/diff"))
+	if err != nil {
+		return &serverError{status: http.StatusBadRequest, err: err}
+	}
+	ctx := r.Context()
+	var ums [2]*internal.UnitMeta
+	for i, v := range []string{oldVersion, newVersion} {
+		info, err := extractURLPathInfo("/" + fullPath + "@" + v)
+		if err != nil {
+			return &serverError{status: http.StatusBadRequest, err: err}
+		}
+		if err := validatePathAndVersion(ctx, ds, info.fullPath, info.requestedVersion); err != nil {
+			return err
+		}
+		um, err := ds.GetUnitMeta(ctx, info.fullPath, info.modulePath, info.requestedVersion)
+		if err != nil {
+			if errors.Is(err, derrors.NotFound) {
+				return &serverError{status: http.StatusNotFound, err: err}
+			}
+			return err
+		}
+		if !um.IsPackage() {
+			return &serverError{status: http.StatusNotFound, err: fmt.Errorf("%s@%s is not a package", fullPath, um.Version)}
+		}
+		if !um.IsRedistributable {
+			return &serverError{
+				status: http.StatusNotFound,
+				epage: &errorPage{
+					messageTemplate: template.MakeTrustedTemplate(`
+						<h3 class="Error-message">The API of {{.Path}}@{{.Version}} cannot be compared, because its license does not allow redistribution.</h3>`),
+					MessageData: struct{ Path, Version string }{fullPath, um.Version},
+				},
+			}
+		}
+		ums[i] = um
+	}
+	d, err := fetchAPIDiff(ctx, ds, ums[0], ums[1])
+	if errors.Is(err, errNoAPI) {
+		return &serverError{
+			status: http.StatusNotFound,
+			err:    err,
+			epage: &errorPage{
+				messageTemplate: template.MakeTrustedTemplate(`
+					<h3 class="Error-message">The API of {{.}} cannot be compared yet, because the documentation of one of the versions was processed before APIs were recorded.</h3>`),
+				MessageData: fullPath,
+			},
+		}
+	}
+	if err != nil {
+		return err
+	}
+	page := &DiffPage{
+		basePage:   s.newBasePage(r, fmt.Sprintf("%s API changes from %s to %s - go.dev", fullPath, ums[0].Version, ums[1].Version)),
+		Path:       fullPath,
+		OldVersion: ums[0].Version,
+		NewVersion: ums[1].Version,
+		Groups:     groupAPIDiff(d),
+	}
+	s.servePage(ctx, w, "diff.tmpl", page)
+	return nil
+}
+
+// parseDiffURLPath parses a path of the form
+// "/<import-path>@<version1>..<version2>".
+func parseDiffURLPath(urlPath string) (fullPath, oldVersion, newVersion string, err error) {
+	defer derrors.Wrap(&err, "parseDiffURLPath(%q)", urlPath)
+
+	parts := strings.SplitN(strings.TrimPrefix(urlPath, "/"), "@", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", "", errors.New("missing versions")
+	}
+	versions := strings.Split(parts[1], "..")
+	if len(versions) != 2 || versions[0] == "" || versions[1] == "" {
+		return "", "", "", errors.New("versions must have the form <version1>..<version2>")
+	}
+	return strings.TrimSuffix(parts[0], "/"), versions[0], versions[1], nil
+}
+
+// fetchAPIDiff returns the API changes from the package described by oldUM
+// to the one described by newUM.
+func fetchAPIDiff(ctx context.Context, ds internal.DataSource, oldUM, newUM *internal.UnitMeta) (_ *godoc.APIDiff, err error) {
+	defer derrors.Wrap(&err, "fetchAPIDiff(%q, %q, %q)", oldUM.Path, oldUM.Version, newUM.Version)
+
+	oldSymbols, err := fetchPackageSymbols(ctx, ds, oldUM)
+	if err != nil {
+		return nil, err
+	}
+	newSymbols, err := fetchPackageSymbols(ctx, ds, newUM)
+	if err != nil {
+		return nil, err
+	}
+	return godoc.Diff(oldSymbols, newSymbols), nil
+}
+
+// errNoAPI is returned by fetchPackageSymbols for documentation stored
+// before the API of packages was recorded.
+var errNoAPI = errors.New("no API recorded")
+
+// fetchPackageSymbols returns the symbols in the default build context's
+// documentation of the package described by um, from its stored API.
+func fetchPackageSymbols(ctx context.Context, ds internal.DataSource, um *internal.UnitMeta) ([]godoc.Symbol, error) {
+	u, err := ds.GetUnit(ctx, um, internal.WithDocumentation|internal.WithDocumentationAPI)
+	if err != nil {
+		return nil, err
+	}
+	doc := u.DocumentationFor("", "")
+	if doc == nil {
+		return nil, nil
+	}
+	if doc.API == nil {
+		return nil, fmt.Errorf("%s@%s: %w", um.Path, um.Version, errNoAPI)
+	}
+	var api godoc.API
+	if err := json.Unmarshal(doc.API, &api); err != nil {
+		return nil, err
+	}
+	return api.Symbols, nil
+}
+
+// groupAPIDiff groups the changes in d by kind of symbol, in the order of
+// godoc.Kinds.
+func groupAPIDiff(d *godoc.APIDiff) []*DiffGroup {
+	groups := map[string]*DiffGroup{}
+	group := func(kind string) *DiffGroup {
+		g := groups[kind]
+		if g == nil {
+			g = &DiffGroup{Title: diffGroupTitles[kind]}
+			groups[kind] = g
+		}
+		return g
+	}
+	for _, s := range d.Added {
+		g := group(s.Kind)
+		g.Added = append(g.Added, s)
+	}
+	for _, s := range d.Removed {
+		g := group(s.Kind)
+		g.Removed = append(g.Removed, s)
+	}
+	for _, c := range d.Changed {
+		g := group(c.New.Kind)
+		g.Changed = append(g.Changed, c)
+	}
+	var gs []*DiffGroup
+	for _, k := range godoc.Kinds {
+		if g := groups[k]; g != nil {
+			gs = append(gs, g)
+		}
+	}
+	return gs
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/safehtml"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/godoc"
+)
+
+// versionsDataSource is an internal.DataSource whose GetUnit method returns
+// the unit for the requested version. Its other methods are unimplemented.
+type versionsDataSource struct {
+	internal.DataSource
+	units map[string]*internal.Unit
+}
+
+func (ds versionsDataSource) GetUnit(_ context.Context, um *internal.UnitMeta, _ internal.FieldSet) (*internal.Unit, error) {
+	return ds.units[um.Version], nil
+}
+
+func TestFetchAPIDiff(t *testing.T) {
+	ds := versionsDataSource{units: map[string]*internal.Unit{}}
+	for version, symbols := range map[string][]godoc.Symbol{
+		"v1.3.0": {
+			{Name: "F", Kind: "function", Signature: "func F()"},
+			{Name: "G", Kind: "function", Signature: "func G()"},
+			{Name: "T", Kind: "type", Signature: "type T int"},
+		},
+		"v1.4.0": {
+			{Name: "F", Kind: "function", Signature: "func F(x int)"},
+			{Name: "T", Kind: "type", Signature: "type T int"},
+			{Name: "T.M", Kind: "method", Signature: "func (T) M()"},
+		},
+		"v1.5.0": nil,
+	} {
+		doc := &internal.Documentation{
+			GOOS:   "linux",
+			GOARCH: "amd64",
+			HTML:   safehtml.HTMLEscaped("documentation"),
+		}
+		if symbols != nil {
+			api, err := json.Marshal(&godoc.API{Symbols: symbols})
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc.API = api
+		}
+		ds.units[version] = &internal.Unit{
+			UnitMeta:      internal.UnitMeta{Path: "example.com/p", ModulePath: "example.com/p", Version: version},
+			Documentation: []*internal.Documentation{doc},
+		}
+	}
+	ctx := context.Background()
+	d, err := fetchAPIDiff(ctx, ds, &ds.units["v1.3.0"].UnitMeta, &ds.units["v1.4.0"].UnitMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type change struct{ Title, Name, Change string }
+	var got []change
+	for _, g := range groupAPIDiff(d) {
+		for _, s := range g.Added {
+			got = append(got, change{g.Title, s.Name, "added"})
+		}
+		for _, s := range g.Removed {
+			got = append(got, change{g.Title, s.Name, "removed"})
+		}
+		for _, c := range g.Changed {
+			got = append(got, change{g.Title, c.New.Name, c.Old.Signature + " -> " + c.New.Signature})
+		}
+	}
+	want := []change{
+		{"Functions", "G", "removed"},
+		{"Functions", "F", "func F() -> func F(x int)"},
+		{"Methods", "T.M", "added"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	// Documentation stored before its API was recorded cannot be compared.
+	if _, err := fetchAPIDiff(ctx, ds, &ds.units["v1.4.0"].UnitMeta, &ds.units["v1.5.0"].UnitMeta); !errors.Is(err, errNoAPI) {
+		t.Errorf("got error %v, want %v", err, errNoAPI)
+	}
+}
+
+func TestParseDiffURLPath(t *testing.T) {
+	for _, test := range []struct {
+		path, wantPath, wantOld, wantNew string
+		wantErr                          bool
+	}{
+		{path: "/example.com/p@v1.3.0..v1.4.0", wantPath: "example.com/p", wantOld: "v1.3.0", wantNew: "v1.4.0"},
+		{path: "/encoding/json@go1.14..go1.15", wantPath: "encoding/json", wantOld: "go1.14", wantNew: "go1.15"},
+		{path: "/example.com/p", wantErr: true},
+		{path: "/example.com/p@v1.3.0", wantErr: true},
+		{path: "/example.com/p@v1.3.0..", wantErr: true},
+		{path: "/@v1.3.0..v1.4.0", wantErr: true},
+	} {
+		gotPath, gotOld, gotNew, err := parseDiffURLPath(test.path)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseDiffURLPath(%q): got error %v, want error %t", test.path, err, test.wantErr)
+			continue
+		}
+		if gotPath != test.wantPath || gotOld != test.wantOld || gotNew != test.wantNew {
+			t.Errorf("parseDiffURLPath(%q) = %q, %q, %q; want %q, %q, %q",
+				test.path, gotPath, gotOld, gotNew, test.wantPath, test.wantOld, test.wantNew)
+		}
+	}
+}
@@ -34,8 +34,41 @@ type DirectoryHeader struct {
 // Directory contains information for an individual directory.
 type Directory struct {
 	DirectoryHeader
-	Packages      []*Package
-	NestedModules []*internal.ModuleInfo
+	// Packages are the packages of the module version in the directory.
+	Packages []*Package
+	// Subdirectories are the trees of packages in the directory, including
+	// those of nested modules, grouped under headings.
+	Subdirectories []*SubdirectoryGroup
+	// ExpandAllURL is the URL of the page with all subdirectories expanded.
+	// It is empty if none are collapsed.
+	ExpandAllURL string
+}
+
+// A SubdirectoryGroup is a list of subdirectory trees under a heading.
+type SubdirectoryGroup struct {
+	Heading string // empty for the main group
+	Trees   []*Subdirectory
+}
+
+// A Subdirectory is a node in a tree of subdirectories.
+type Subdirectory struct {
+	// Suffix is the path of the subdirectory relative to its parent. It
+	// spans several path elements when the intermediate directories hold
+	// nothing but the next one.
+	Suffix string
+	// URL is the URL of the package or nested module in the subdirectory. It
+	// is empty for other directories.
+	URL      string
+	Synopsis string
+	// ModulePath and Version are set when the subdirectory is the root of a
+	// nested module, and identify its latest version.
+	ModulePath string
+	Version    string
+	Children   []*Subdirectory
+	// Expanded reports whether the children are shown initially.
+	Expanded bool
+
+	isPackage bool
 }
 
 // serveDirectoryPage serves a directory view for a directory in a module
@@ -50,10 +83,15 @@ func (s *Server) serveDirectoryPage(ctx context.Context, w http.ResponseWriter,
 		settings = directoryTabLookup[tab]
 	}
 	mi := &internal.ModuleInfo{
-		ModulePath:        um.ModulePath,
-		Version:           um.Version,
-		CommitTime:        um.CommitTime,
-		IsRedistributable: um.IsRedistributable,
+		ModulePath:          um.ModulePath,
+		Version:             um.Version,
+		CommitTime:          um.CommitTime,
+		IsRedistributable:   um.IsRedistributable,
+		Retracted:           um.Retracted,
+		RetractionRationale: um.RetractionRationale,
+		Deprecation:         um.Deprecation,
+		GoVersion:           um.GoVersion,
+		Toolchain:           um.Toolchain,
 	}
 	header := createDirectoryHeader(um.Path, mi, um.Licenses)
 	if requestedVersion == internal.LatestVersion {
@@ -75,7 +113,9 @@ func (s *Server) serveDirectoryPage(ctx context.Context, w http.ResponseWriter,
 		Tabs:             directoryTabSettings,
 		PageType:         pageTypeDirectory,
 		CanonicalURLPath: constructPackageURL(um.Path, um.ModulePath, linkver),
+		LatestMajor:      s.latestMajorVersion(ctx, ds, um.Path, um.ModulePath, um.Version),
 	}
+	page.basePage.Social = unitSocialMetadata(r, page.HTMLTitle, um.Path, "", um.IsRedistributable)
 	s.servePage(ctx, w, settings.TemplateName, page)
 	return nil
 }
@@ -111,11 +151,27 @@ func fetchDirectoryDetails(ctx context.Context, ds internal.DataSource, um *inte
 		header := createDirectoryHeader(um.Path, mi, um.Licenses)
 		return &Directory{DirectoryHeader: *header}, nil
 	}
-	nestedModules, err := ds.GetNestedModules(ctx, um.Path)
+	return createDirectory(um.Path, mi, u.Subdirectories, um.Licenses, includeDirPath)
+}
+
+// fetchSubdirectoriesDetails is like fetchDirectoryDetails, but expands all
+// subdirectories if r asks for it, or otherwise links to a page where they
+// are.
+func fetchSubdirectoriesDetails(r *http.Request, ds internal.DataSource, um *internal.UnitMeta, includeDirPath bool) (_ *Directory, err error) {
+	d, err := fetchDirectoryDetails(r.Context(), ds, um, includeDirPath)
 	if err != nil {
 		return nil, err
 	}
-	return createDirectory(um.Path, mi, u.Subdirectories, nestedModules, um.Licenses, includeDirPath)
+	if r.FormValue("expand") == "all" {
+		for _, g := range d.Subdirectories {
+			expandSubdirectories(g.Trees)
+		}
+	} else if hasCollapsedSubdirectories(d.Subdirectories) {
+		q := r.URL.Query()
+		q.Set("expand", "all")
+		d.ExpandAllURL = "?" + q.Encode()
+	}
+	return d, nil
 }
 
 // createDirectory constructs a *Directory for the given dirPath.
@@ -127,13 +183,19 @@ func fetchDirectoryDetails(ctx context.Context, ds internal.DataSource, um *inte
 // the module path. However, on the package and directory view's
 // "Subdirectories" tab, we do not want to include packages whose import paths
 // are the same as the dirPath.
-func createDirectory(dirPath string, mi *internal.ModuleInfo, pkgMetas []*internal.PackageMeta, nestedModules []*internal.ModuleInfo,
+//
+// Packages in pkgMetas whose ModulePath is neither empty nor that of mi are in
+// nested modules. They appear in the subdirectory trees only.
+func createDirectory(dirPath string, mi *internal.ModuleInfo, pkgMetas []*internal.PackageMeta,
 	licmetas []*licenses.Metadata, includeDirPath bool) (_ *Directory, err error) {
 	var packages []*Package
 	for _, pm := range pkgMetas {
 		if !includeDirPath && pm.Path == dirPath {
 			continue
 		}
+		if pm.ModulePath != "" && pm.ModulePath != mi.ModulePath {
+			continue
+		}
 		newPkg, err := createPackage(pm, mi, false)
 		if err != nil {
 			return nil, err
@@ -151,10 +213,156 @@ func createDirectory(dirPath string, mi *internal.ModuleInfo, pkgMetas []*intern
 	return &Directory{
 		DirectoryHeader: *header,
 		Packages:        packages,
-		NestedModules:   nestedModules,
+		Subdirectories:  subdirectoryGroups(dirPath, mi, pkgMetas, includeDirPath),
 	}, nil
 }
 
+// subdirectoryGroups arranges pkgMetas, the packages in dirPath, into trees
+// of subdirectories. Packages with an internal path element below dirPath
+// are grouped under an "Internal" heading, except for the commands of the
+// standard library, whose tree is collapsed instead. Other trees are
+// expanded to show their first level.
+func subdirectoryGroups(dirPath string, mi *internal.ModuleInfo, pkgMetas []*internal.PackageMeta, includeDirPath bool) []*SubdirectoryGroup {
+	var (
+		public, internalRoot Subdirectory
+		nodes                = map[*Subdirectory]map[string]*Subdirectory{}
+	)
+	// node returns the node for the subdirectory with the given path
+	// elements below root, creating it and its parents as needed.
+	node := func(root *Subdirectory, elems []string) *Subdirectory {
+		n := root
+		for _, e := range elems {
+			if nodes[n] == nil {
+				nodes[n] = map[string]*Subdirectory{}
+			}
+			c, ok := nodes[n][e]
+			if !ok {
+				c = &Subdirectory{Suffix: e}
+				nodes[n][e] = c
+				n.Children = append(n.Children, c)
+			}
+			n = c
+		}
+		return n
+	}
+	linkver := linkVersion(mi.Version, mi.ModulePath)
+	for _, pm := range pkgMetas {
+		nested := pm.ModulePath != "" && pm.ModulePath != mi.ModulePath
+		if pm.Path == dirPath {
+			if includeDirPath && !nested {
+				public.Children = append(public.Children, &Subdirectory{
+					Suffix:    effectiveName(pm.Path, pm.Name) + " (root)",
+					URL:       constructPackageURL(pm.Path, mi.ModulePath, linkver),
+					Synopsis:  pm.Synopsis,
+					isPackage: true,
+				})
+			}
+			continue
+		}
+		suffix := internal.Suffix(pm.Path, dirPath)
+		elems := strings.Split(suffix, "/")
+		root := &public
+		if isInternalSuffix(elems) && !(dirPath == stdlib.ModulePath && elems[0] == "cmd") {
+			root = &internalRoot
+		}
+		if nested {
+			// Mark the root of the nested module.
+			mn := node(root, strings.Split(internal.Suffix(pm.ModulePath, dirPath), "/"))
+			if mn.ModulePath == "" {
+				mn.ModulePath = pm.ModulePath
+				mn.Version = pm.Version
+				if !mn.isPackage {
+					mn.URL = constructDirectoryURL(pm.ModulePath, pm.ModulePath, linkVersion(pm.Version, pm.ModulePath))
+				}
+			}
+		}
+		n := node(root, elems)
+		if n.isPackage {
+			// The package of the module version comes first, and takes
+			// precedence over that of a nested module.
+			continue
+		}
+		n.isPackage = true
+		n.Synopsis = pm.Synopsis
+		if nested {
+			n.URL = constructPackageURL(pm.Path, pm.ModulePath, linkVersion(pm.Version, pm.ModulePath))
+		} else {
+			n.URL = constructPackageURL(pm.Path, mi.ModulePath, linkver)
+		}
+	}
+
+	var groups []*SubdirectoryGroup
+	for _, g := range []struct {
+		heading string
+		root    *Subdirectory
+	}{
+		{"", &public},
+		{"Internal", &internalRoot},
+	} {
+		if len(g.root.Children) == 0 {
+			continue
+		}
+		compactSubdirectories(g.root.Children)
+		for _, t := range g.root.Children {
+			t.Expanded = !(dirPath == stdlib.ModulePath && t.Suffix == "cmd")
+		}
+		groups = append(groups, &SubdirectoryGroup{Heading: g.heading, Trees: g.root.Children})
+	}
+	return groups
+}
+
+// isInternalSuffix reports whether the path elements contain "internal".
+func isInternalSuffix(elems []string) bool {
+	for _, e := range elems {
+		if e == "internal" {
+			return true
+		}
+	}
+	return false
+}
+
+// compactSubdirectories sorts the trees by suffix, and merges each directory
+// that is neither a package nor a module root into its only child.
+func compactSubdirectories(trees []*Subdirectory) {
+	sort.Slice(trees, func(i, j int) bool { return trees[i].Suffix < trees[j].Suffix })
+	for _, t := range trees {
+		for !t.isPackage && t.ModulePath == "" && len(t.Children) == 1 {
+			c := t.Children[0]
+			c.Suffix = t.Suffix + "/" + c.Suffix
+			*t = *c
+		}
+		compactSubdirectories(t.Children)
+	}
+}
+
+// expandSubdirectories expands all the subdirectories in trees.
+func expandSubdirectories(trees []*Subdirectory) {
+	for _, t := range trees {
+		t.Expanded = true
+		expandSubdirectories(t.Children)
+	}
+}
+
+// hasCollapsedSubdirectories reports whether the children of a subdirectory
+// in groups are hidden initially.
+func hasCollapsedSubdirectories(groups []*SubdirectoryGroup) bool {
+	var collapsed func([]*Subdirectory) bool
+	collapsed = func(trees []*Subdirectory) bool {
+		for _, t := range trees {
+			if len(t.Children) > 0 && (!t.Expanded || collapsed(t.Children)) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, g := range groups {
+		if collapsed(g.Trees) {
+			return true
+		}
+	}
+	return false
+}
+
 func createDirectoryHeader(dirPath string, mi *internal.ModuleInfo, licmetas []*licenses.Metadata) (_ *DirectoryHeader) {
 	mod := createModule(mi, licmetas, false)
 	return &DirectoryHeader{
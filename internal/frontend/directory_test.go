@@ -8,9 +8,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/google/safehtml"
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/derrors"
@@ -57,10 +59,14 @@ func TestFetchDirectoryDetails(t *testing.T) {
 				Path:   dirPath,
 				URL:    constructDirectoryURL(dirPath, mi.ModulePath, linkVersion(mi.Version, mi.ModulePath)),
 			},
-			Packages:      wantPkgs,
-			NestedModules: nil,
+			Packages: wantPkgs,
 		}
-		if diff := cmp.Diff(want, got, cmp.AllowUnexported(safehtml.Identifier{})); diff != "" {
+		// The subdirectory trees are checked by TestSubdirectoryGroups.
+		opts := cmp.Options{
+			cmp.AllowUnexported(safehtml.Identifier{}),
+			cmpopts.IgnoreFields(Directory{}, "Subdirectories"),
+		}
+		if diff := cmp.Diff(want, got, opts); diff != "" {
 			t.Errorf("fetchDirectoryDetails(ctx, %q, %q, %q) mismatch (-want +got):\n%s", dirPath, modulePath, version, diff)
 		}
 	}
@@ -225,3 +231,162 @@ func TestFetchDirectoryDetailsInvalidArguments(t *testing.T) {
 		})
 	}
 }
+
+func TestSubdirectoryGroups(t *testing.T) {
+	pm := func(path, modulePath, version string) *internal.PackageMeta {
+		return &internal.PackageMeta{
+			Path:       path,
+			Name:       path[strings.LastIndex(path, "/")+1:],
+			Synopsis:   "Package " + path,
+			ModulePath: modulePath,
+			Version:    version,
+		}
+	}
+	const m = "example.com/m"
+	mi := sample.ModuleInfo(m, "v1.2.0")
+
+	for _, test := range []struct {
+		name           string
+		dirPath        string
+		mi             *internal.ModuleInfo
+		pkgs           []*internal.PackageMeta
+		includeDirPath bool
+		want           []*SubdirectoryGroup
+	}{
+		{
+			name:    "tree",
+			dirPath: m,
+			mi:      mi,
+			pkgs: []*internal.PackageMeta{
+				pm(m, m, "v1.2.0"),
+				pm(m+"/a", m, "v1.2.0"),
+				pm(m+"/a/b", m, "v1.2.0"),
+				pm(m+"/a/b/c", m, "v1.2.0"),
+				pm(m+"/x/y/z", m, "v1.2.0"),
+				pm(m+"/a/internal/p", m, "v1.2.0"),
+			},
+			includeDirPath: true,
+			want: []*SubdirectoryGroup{
+				{Trees: []*Subdirectory{
+					{
+						Suffix:   "a",
+						URL:      "/example.com/m@v1.2.0/a",
+						Synopsis: "Package example.com/m/a",
+						Expanded: true,
+						Children: []*Subdirectory{{
+							Suffix:   "b",
+							URL:      "/example.com/m@v1.2.0/a/b",
+							Synopsis: "Package example.com/m/a/b",
+							Children: []*Subdirectory{{
+								Suffix:   "c",
+								URL:      "/example.com/m@v1.2.0/a/b/c",
+								Synopsis: "Package example.com/m/a/b/c",
+							}},
+						}},
+					},
+					{
+						Suffix:   "m (root)",
+						URL:      "/example.com/m@v1.2.0",
+						Synopsis: "Package example.com/m",
+						Expanded: true,
+					},
+					{
+						Suffix:   "x/y/z",
+						URL:      "/example.com/m@v1.2.0/x/y/z",
+						Synopsis: "Package example.com/m/x/y/z",
+						Expanded: true,
+					},
+				}},
+				{Heading: "Internal", Trees: []*Subdirectory{{
+					Suffix:   "a/internal/p",
+					URL:      "/example.com/m@v1.2.0/a/internal/p",
+					Synopsis: "Package example.com/m/a/internal/p",
+					Expanded: true,
+				}}},
+			},
+		},
+		{
+			name:    "nested modules",
+			dirPath: m,
+			mi:      mi,
+			pkgs: []*internal.PackageMeta{
+				pm(m+"/a", m, "v1.2.0"),
+				pm(m+"/a", m+"/a", "v0.1.0"),
+				pm(m+"/tools/cmd/t", m+"/tools", "v0.3.0"),
+			},
+			want: []*SubdirectoryGroup{
+				{Trees: []*Subdirectory{
+					{
+						Suffix:     "a",
+						URL:        "/example.com/m@v1.2.0/a",
+						Synopsis:   "Package example.com/m/a",
+						ModulePath: m + "/a",
+						Version:    "v0.1.0",
+						Expanded:   true,
+					},
+					{
+						Suffix:     "tools",
+						URL:        "/example.com/m/tools@v0.3.0",
+						ModulePath: m + "/tools",
+						Version:    "v0.3.0",
+						Expanded:   true,
+						Children: []*Subdirectory{{
+							Suffix:   "cmd/t",
+							URL:      "/example.com/m/tools@v0.3.0/cmd/t",
+							Synopsis: "Package example.com/m/tools/cmd/t",
+						}},
+					},
+				}},
+			},
+		},
+		{
+			name:    "standard library",
+			dirPath: stdlib.ModulePath,
+			mi:      sample.ModuleInfo(stdlib.ModulePath, "v1.13.4"),
+			pkgs: []*internal.PackageMeta{
+				pm("cmd/go", "", ""),
+				pm("cmd/internal/obj", "", ""),
+				pm("fmt", "", ""),
+				pm("internal/cpu", "", ""),
+			},
+			want: []*SubdirectoryGroup{
+				{Trees: []*Subdirectory{
+					{
+						Suffix: "cmd",
+						Children: []*Subdirectory{
+							{
+								Suffix:   "go",
+								URL:      "/cmd/go@go1.13.4",
+								Synopsis: "Package cmd/go",
+							},
+							{
+								Suffix:   "internal/obj",
+								URL:      "/cmd/internal/obj@go1.13.4",
+								Synopsis: "Package cmd/internal/obj",
+							},
+						},
+					},
+					{
+						Suffix:   "fmt",
+						URL:      "/fmt@go1.13.4",
+						Synopsis: "Package fmt",
+						Expanded: true,
+					},
+				}},
+				{Heading: "Internal", Trees: []*Subdirectory{{
+					Suffix:   "internal/cpu",
+					URL:      "/internal/cpu@go1.13.4",
+					Synopsis: "Package internal/cpu",
+					Expanded: true,
+				}}},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := subdirectoryGroups(test.dirPath, test.mi, test.pkgs, test.includeDirPath)
+			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreUnexported(Subdirectory{})); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
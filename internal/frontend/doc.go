@@ -7,6 +7,7 @@ package frontend
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"strings"
 
 	"github.com/google/safehtml"
@@ -19,20 +20,80 @@ import (
 type DocumentationDetails struct {
 	GOOS          string
 	GOARCH        string
+	Synopsis      string
 	Documentation safehtml.HTML
+	// OtherBuildContexts are the other build contexts for which
+	// documentation is available.
+	OtherBuildContexts []internal.BuildContext
+	// DefaultBuildContext is the build context of the documentation shown
+	// when none is requested.
+	DefaultBuildContext internal.BuildContext
+	// RequestedBuildContext, if non-nil, is the requested build context,
+	// for which there is no documentation. The closest match is shown
+	// instead. It is nil for a package with a single documentation, since
+	// every build context selects the same files for it.
+	RequestedBuildContext *internal.BuildContext
+	// BuildFailureReason, if non-empty, explains why there is no
+	// documentation.
+	BuildFailureReason string
 }
 
-// fetchDocumentationDetails returns a DocumentationDetails.
-func fetchDocumentationDetails(ctx context.Context, ds internal.DataSource, um *internal.UnitMeta) (_ *DocumentationDetails, err error) {
-	u, err := ds.GetUnit(ctx, um, internal.WithDocumentation)
+// fetchDocumentationDetails returns a DocumentationDetails for the
+// documentation that best matches goos and goarch, either of which may be
+// empty.
+//
+// If full is true and the stored documentation is abbreviated because it is
+// too large, the full documentation is rendered from the package's source by
+// fullDocs.
+func fetchDocumentationDetails(ctx context.Context, ds internal.DataSource, fullDocs *fullDocRenderer, um *internal.UnitMeta, goos, goarch string, full bool) (_ *DocumentationDetails, err error) {
+	fields := internal.WithDocumentation
+	if full {
+		fields |= internal.WithDocumentationSource
+	}
+	u, err := ds.GetUnit(ctx, um, fields)
 	if err != nil {
 		return nil, err
 	}
-	return &DocumentationDetails{
-		GOOS:          u.Documentation.GOOS,
-		GOARCH:        u.Documentation.GOARCH,
-		Documentation: u.Documentation.HTML,
-	}, nil
+	doc := u.DocumentationFor(goos, goarch)
+	if doc == nil {
+		return &DocumentationDetails{BuildFailureReason: u.BuildFailureReason}, nil
+	}
+	dflt := u.DocumentationFor("", "")
+	dd := &DocumentationDetails{
+		GOOS:                doc.GOOS,
+		GOARCH:              doc.GOARCH,
+		Synopsis:            doc.Synopsis,
+		Documentation:       doc.HTML,
+		DefaultBuildContext: internal.BuildContext{GOOS: dflt.GOOS, GOARCH: dflt.GOARCH},
+	}
+	if len(u.Documentation) > 1 && ((goos != "" && goos != doc.GOOS) || (goarch != "" && goarch != doc.GOARCH)) {
+		dd.RequestedBuildContext = &internal.BuildContext{GOOS: goos, GOARCH: goarch}
+	}
+	if full && doc.Source != nil {
+		h, err := fullDocs.render(ctx, &u.UnitMeta, doc)
+		if err != nil {
+			// Fall back to the abbreviated documentation.
+			log.Errorf(ctx, "fetchDocumentationDetails: %v", err)
+		} else {
+			dd.Documentation = h
+		}
+	}
+	for _, d := range u.Documentation {
+		if d != doc {
+			dd.OtherBuildContexts = append(dd.OtherBuildContexts, internal.BuildContext{GOOS: d.GOOS, GOARCH: d.GOARCH})
+		}
+	}
+	return dd, nil
+}
+
+// BuildContextURL returns the URL of the documentation for bc, relative to
+// the current page. The documentation for the default build context has no
+// GOOS or GOARCH in its URL, so that it is the canonical one.
+func (dd *DocumentationDetails) BuildContextURL(bc internal.BuildContext) string {
+	if bc == dd.DefaultBuildContext {
+		return "?tab=doc"
+	}
+	return fmt.Sprintf("?tab=doc&GOOS=%s&GOARCH=%s", url.QueryEscape(bc.GOOS), url.QueryEscape(bc.GOARCH))
 }
 
 // fileSource returns the original filepath in the module zip where the given
@@ -44,13 +105,13 @@ func fileSource(modulePath, version, filePath string) string {
 	}
 
 	root := strings.TrimPrefix(stdlib.GoRepoURL, "https://")
-	tag, err := stdlib.TagForVersion(version)
+	ref, err := stdlib.RefForVersion(version)
 	if err != nil {
 		// This should never happen unless there is a bug in
-		// stdlib.TagForVersion. In which case, fallback to the default
+		// stdlib.RefForVersion. In which case, fallback to the default
 		// zipFilePath.
 		log.Errorf(context.TODO(), "fileSource: %v", err)
 		return fmt.Sprintf("%s/+/refs/heads/master/%s", root, filePath)
 	}
-	return fmt.Sprintf("%s/+/refs/tags/%s/%s", root, tag, filePath)
+	return fmt.Sprintf("%s/+/%s/%s", root, ref, filePath)
 }
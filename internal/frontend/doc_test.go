@@ -5,9 +5,18 @@
 package frontend
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/safehtml"
+	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/stdlib"
 	"golang.org/x/pkgsite/internal/testing/sample"
 )
@@ -34,6 +43,12 @@ func TestFileSource(t *testing.T) {
 			filePath:   "README.md",
 			want:       fmt.Sprintf("go.googlesource.com/go/+/refs/heads/master/%s", "README.md"),
 		},
+		{
+			modulePath: stdlib.ModulePath,
+			version:    "v0.0.0-20201016154802-8ea2fd3b7e95",
+			filePath:   "README.md",
+			want:       fmt.Sprintf("go.googlesource.com/go/+/%s/%s", "8ea2fd3b7e95", "README.md"),
+		},
 	} {
 		t.Run(fmt.Sprintf("%s@%s/%s", tc.modulePath, tc.version, tc.filePath), func(t *testing.T) {
 			if got := fileSource(tc.modulePath, tc.version, tc.filePath); got != tc.want {
@@ -42,3 +57,177 @@ func TestFileSource(t *testing.T) {
 		})
 	}
 }
+
+// unitDataSource is an internal.DataSource whose GetUnit method always returns
+// the same unit. Its other methods are unimplemented.
+type unitDataSource struct {
+	internal.DataSource
+	unit *internal.Unit
+}
+
+func (ds unitDataSource) GetUnit(context.Context, *internal.UnitMeta, internal.FieldSet) (*internal.Unit, error) {
+	return ds.unit, nil
+}
+
+func TestFetchDocumentationDetailsBuildFailure(t *testing.T) {
+	const reason = "package requires cgo"
+	pkg := sample.LegacyPackageWithBuildFailure(sample.ModulePath, sample.Suffix, reason)
+	u := sample.UnitForPackage(pkg, sample.ModulePath, sample.VersionString)
+	if u.Documentation != nil {
+		t.Fatalf("UnitForPackage: got documentation %+v, want nil", u.Documentation)
+	}
+
+	got, err := fetchDocumentationDetails(context.Background(), unitDataSource{unit: u}, nil, &u.UnitMeta, "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &DocumentationDetails{BuildFailureReason: reason}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(safehtml.HTML{})); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFetchDocumentationDetailsBuildContext(t *testing.T) {
+	u := &internal.Unit{Documentation: []*internal.Documentation{
+		{GOOS: "linux", GOARCH: "amd64", HTML: safehtml.HTMLEscaped("linux")},
+		{GOOS: "windows", GOARCH: "amd64", HTML: safehtml.HTMLEscaped("windows")},
+	}}
+	linux := internal.BuildContext{GOOS: "linux", GOARCH: "amd64"}
+	windows := internal.BuildContext{GOOS: "windows", GOARCH: "amd64"}
+	for _, test := range []struct {
+		goos, goarch string
+		want         *DocumentationDetails
+	}{
+		{
+			goos: "", goarch: "",
+			want: &DocumentationDetails{
+				GOOS:                "linux",
+				GOARCH:              "amd64",
+				Documentation:       safehtml.HTMLEscaped("linux"),
+				OtherBuildContexts:  []internal.BuildContext{windows},
+				DefaultBuildContext: linux,
+			},
+		},
+		{
+			goos: "windows", goarch: "amd64",
+			want: &DocumentationDetails{
+				GOOS:                "windows",
+				GOARCH:              "amd64",
+				Documentation:       safehtml.HTMLEscaped("windows"),
+				OtherBuildContexts:  []internal.BuildContext{linux},
+				DefaultBuildContext: linux,
+			},
+		},
+		{
+			// The closest match is shown, with a notice.
+			goos: "windows", goarch: "arm64",
+			want: &DocumentationDetails{
+				GOOS:                  "windows",
+				GOARCH:                "amd64",
+				Documentation:         safehtml.HTMLEscaped("windows"),
+				OtherBuildContexts:    []internal.BuildContext{linux},
+				DefaultBuildContext:   linux,
+				RequestedBuildContext: &internal.BuildContext{GOOS: "windows", GOARCH: "arm64"},
+			},
+		},
+		{
+			goos: "plan9", goarch: "",
+			want: &DocumentationDetails{
+				GOOS:                  "linux",
+				GOARCH:                "amd64",
+				Documentation:         safehtml.HTMLEscaped("linux"),
+				OtherBuildContexts:    []internal.BuildContext{windows},
+				DefaultBuildContext:   linux,
+				RequestedBuildContext: &internal.BuildContext{GOOS: "plan9"},
+			},
+		},
+	} {
+		got, err := fetchDocumentationDetails(context.Background(), unitDataSource{unit: u}, nil, &u.UnitMeta, test.goos, test.goarch, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(safehtml.HTML{})); diff != "" {
+			t.Errorf("GOOS=%q, GOARCH=%q: mismatch (-want +got):\n%s", test.goos, test.goarch, diff)
+		}
+	}
+
+	// A package documented for a single build context is the same in every
+	// one, so there is no notice.
+	portable := &internal.Unit{Documentation: []*internal.Documentation{
+		{GOOS: "linux", GOARCH: "amd64", HTML: safehtml.HTMLEscaped("linux")},
+	}}
+	got, err := fetchDocumentationDetails(context.Background(), unitDataSource{unit: portable}, nil, &portable.UnitMeta, "windows", "arm64", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RequestedBuildContext != nil {
+		t.Errorf("portable package: got RequestedBuildContext %+v, want nil", got.RequestedBuildContext)
+	}
+}
+
+func TestBuildContextURL(t *testing.T) {
+	dd := &DocumentationDetails{DefaultBuildContext: internal.BuildContext{GOOS: "linux", GOARCH: "amd64"}}
+	for _, test := range []struct {
+		bc   internal.BuildContext
+		want string
+	}{
+		{internal.BuildContext{GOOS: "linux", GOARCH: "amd64"}, "?tab=doc"},
+		{internal.BuildContext{GOOS: "js", GOARCH: "wasm"}, "?tab=doc&GOOS=js&GOARCH=wasm"},
+	} {
+		if got := dd.BuildContextURL(test.bc); got != test.want {
+			t.Errorf("BuildContextURL(%v) = %q, want %q", test.bc, got, test.want)
+		}
+	}
+}
+
+func TestFetchDocumentationDetailsFull(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("p.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "// Package p is documented.\npackage p\n\n// F is a function.\nfunc F() {}\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	u := &internal.Unit{
+		UnitMeta: internal.UnitMeta{Path: "example.com/p", ModulePath: "example.com/p", Version: "v1.0.0"},
+		Documentation: []*internal.Documentation{
+			{GOOS: "linux", GOARCH: "amd64", HTML: safehtml.HTMLEscaped("collapsed"), Source: buf.Bytes()},
+		},
+	}
+	ctx := context.Background()
+	fullDocs := newFullDocRenderer(1, 1)
+	got, err := fetchDocumentationDetails(ctx, unitDataSource{unit: u}, fullDocs, &u.UnitMeta, "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := got.Documentation.String(), "collapsed"; got != want {
+		t.Errorf("full=false: got documentation %q, want %q", got, want)
+	}
+	got, err = fetchDocumentationDetails(ctx, unitDataSource{unit: u}, fullDocs, &u.UnitMeta, "", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc := got.Documentation.String(); !strings.Contains(doc, "F is a function.") {
+		t.Errorf("full=true: got documentation\n%s\nwant the full documentation", doc)
+	}
+
+	// While no more renders can start, the cached documentation is still
+	// served, and other documentation waits until ctx is done.
+	fullDocs.renders <- struct{}{}
+	defer func() { <-fullDocs.renders }()
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := fullDocs.render(cctx, &u.UnitMeta, u.Documentation[0]); err != nil {
+		t.Errorf("rendering cached documentation: %v", err)
+	}
+	other := u.UnitMeta
+	other.Version = "v1.0.1"
+	if _, err := fullDocs.render(cctx, &other, u.Documentation[0]); !errors.Is(err, context.Canceled) {
+		t.Errorf("rendering uncached documentation: got error %v, want %v", err, context.Canceled)
+	}
+}
@@ -9,9 +9,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"go.opencensus.io/plugin/ochttp"
@@ -19,13 +19,17 @@ import (
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
 	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/config"
 	"golang.org/x/pkgsite/internal/derrors"
 	"golang.org/x/pkgsite/internal/experiment"
 	"golang.org/x/pkgsite/internal/fetch"
 	"golang.org/x/pkgsite/internal/log"
+	"golang.org/x/pkgsite/internal/middleware"
 	"golang.org/x/pkgsite/internal/postgres"
 	"golang.org/x/pkgsite/internal/proxy"
+	"golang.org/x/pkgsite/internal/queue"
 	"golang.org/x/pkgsite/internal/source"
 	"golang.org/x/pkgsite/internal/stdlib"
 )
@@ -100,27 +104,55 @@ func (s *Server) serveFetch(w http.ResponseWriter, r *http.Request, ds internal.
 	if !isActivePathAtMaster(ctx) && urlInfo.requestedVersion == internal.MasterVersion {
 		return &serverError{status: http.StatusBadRequest}
 	}
-	if !isSupportedVersion(ctx, urlInfo.fullPath, urlInfo.requestedVersion) ||
-		// TODO(https://golang.org/issue/39973): add support for fetching the
-		// latest and master versions of the standard library.
-		(stdlib.Contains(urlInfo.fullPath) && urlInfo.requestedVersion == internal.LatestVersion) {
-		return &serverError{status: http.StatusBadRequest}
+	// fetchAndPoll checks whether the version can be fetched.
+	requester := fetchRequester{
+		ipKey:     middleware.IPKey(r, s.fetchLimiter.settings.TrustedHops),
+		unlimited: s.fetchLimiter.bypass(r.Header.Get(config.BypassQuotaAuthHeader)),
+	}
+	status, responseText, retryAfter := s.fetchAndPoll(r.Context(), ds, requester, urlInfo.modulePath, urlInfo.fullPath, urlInfo.requestedVersion)
+	if status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
 	}
-	status, responseText := s.fetchAndPoll(r.Context(), ds, urlInfo.modulePath, urlInfo.fullPath, urlInfo.requestedVersion)
 	if status != http.StatusOK {
 		return &serverError{status: status, responseText: responseText}
 	}
 	return nil
 }
 
+// A fetchRequester describes where a fetch request comes from, for the
+// purpose of limiting the rate of fetch requests.
+type fetchRequester struct {
+	// ipKey identifies the block of IP addresses that the request originates
+	// from; see middleware.IPKey.
+	ipKey string
+	// unlimited is set for requests that bypass the limits.
+	unlimited bool
+}
+
+// fetchLimitedError is the error of a fetchResult for a module version that
+// was not enqueued because a fetch limit was reached.
+type fetchLimitedError struct {
+	retryAfter time.Duration
+}
+
+func (e *fetchLimitedError) Error() string {
+	return fmt.Sprintf("fetch limit reached; retry after %s", e.retryAfter)
+}
+
 type fetchResult struct {
 	modulePath string
 	goModPath  string
 	status     int
-	err        error
+	// errorCode is the derrors error code of the fetch of the module, as
+	// recorded in version_map.
+	errorCode string
+	err       error
 }
 
-func (s *Server) fetchAndPoll(ctx context.Context, ds internal.DataSource, modulePath, fullPath, requestedVersion string) (status int, responseText string) {
+// If the module versions that need to be fetched can't be enqueued because
+// requester has reached a fetch limit, the status is
+// http.StatusTooManyRequests and retryAfter says when to try again.
+func (s *Server) fetchAndPoll(ctx context.Context, ds internal.DataSource, requester fetchRequester, modulePath, fullPath, requestedVersion string) (status int, responseText string, retryAfter time.Duration) {
 	start := time.Now()
 	defer func() {
 		log.Infof(ctx, "fetchAndPoll(ctx, ds, q, %q, %q, %q): status=%d, responseText=%q",
@@ -130,9 +162,10 @@ func (s *Server) fetchAndPoll(ctx context.Context, ds internal.DataSource, modul
 
 	if !isSupportedVersion(ctx, fullPath, requestedVersion) ||
 		// TODO(https://golang.org/issue/39973): add support for fetching the
-		// latest and master versions of the standard library
-		(stdlib.Contains(fullPath) && requestedVersion == internal.LatestVersion) {
-		return http.StatusBadRequest, http.StatusText(http.StatusBadRequest)
+		// latest version of the standard library. Its master version is
+		// only fetched by the worker.
+		(stdlib.Contains(fullPath) && (requestedVersion == internal.LatestVersion || requestedVersion == internal.MasterVersion)) {
+		return http.StatusBadRequest, http.StatusText(http.StatusBadRequest), 0
 	}
 
 	// Generate all possible module paths for the fullPath.
@@ -141,61 +174,125 @@ func (s *Server) fetchAndPoll(ctx context.Context, ds internal.DataSource, modul
 	if err != nil {
 		var serr *serverError
 		if errors.As(err, &serr) {
-			return serr.status, http.StatusText(serr.status)
+			return serr.status, http.StatusText(serr.status), 0
 		}
-		return http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+		return http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), 0
 	}
-	results := s.checkPossibleModulePaths(ctx, db, fullPath, requestedVersion, modulePaths, true)
-	return fetchRequestStatusAndResponseText(results, fullPath, requestedVersion)
+	results := s.checkPossibleModulePaths(ctx, db, fullPath, requestedVersion, modulePaths, true, requester)
+	status, responseText = fetchRequestStatusAndResponseText(results, fullPath, requestedVersion)
+	if status == http.StatusTooManyRequests {
+		for _, fr := range results {
+			var lerr *fetchLimitedError
+			if errors.As(fr.err, &lerr) {
+				retryAfter = lerr.retryAfter
+				break
+			}
+		}
+	}
+	return status, responseText, retryAfter
 }
 
 // checkPossibleModulePaths checks all modulePaths at the requestedVersion, to see
-// if the fullPath exists. For each module path, it first checks version_map to
-// see if we already attempted to fetch the module. If not, and shouldQueue is
-// true, it will enqueue the module to the frontend task queue to be fetched.
-// checkPossibleModulePaths will then poll the database for each module path,
-// until a result is returned or the request times out. If shouldQueue is false,
-// it will return the fetchResult, regardless of what the status is.
+// if the fullPath exists. It first checks version_map to see if we already
+// attempted to fetch each module path. If not, and shouldQueue is true, it
+// will enqueue the module to the frontend task queue to be fetched.
+// checkPossibleModulePaths will then poll the database for the enqueued module
+// paths, until a result is returned for each or the request times out. If
+// shouldQueue is false, it will return the fetchResults, regardless of what
+// the statuses are.
+//
+// Module versions that were recently enqueued by another request are not
+// enqueued again, but polled for. Enqueuing others counts against the fetch
+// limits of requester; if one is reached, their results have status
+// http.StatusTooManyRequests.
 func (s *Server) checkPossibleModulePaths(ctx context.Context, db *postgres.DB,
-	fullPath, requestedVersion string, modulePaths []string, shouldQueue bool) []*fetchResult {
-	var wg sync.WaitGroup
+	fullPath, requestedVersion string, modulePaths []string, shouldQueue bool, requester fetchRequester) []*fetchResult {
 	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
 	defer cancel()
-	results := make([]*fetchResult, len(modulePaths))
-	for i, modulePath := range modulePaths {
-		wg.Add(1)
-		i := i
-		modulePath := modulePath
-		go func() {
-			defer wg.Done()
-			start := time.Now()
-
-			// Before enqueuing the module version to be fetched, check if we
-			// have already attempted to fetch it in the past. If so, just
-			// return the result from that fetch process.
-			fr := checkForPath(ctx, db, fullPath, modulePath, requestedVersion, s.taskIDChangeInterval)
-			if !shouldQueue || fr.status != statusNotFoundInVersionMap {
-				results[i] = fr
-				return
-			}
-			// A row for this modulePath and requestedVersion combination does not
-			// exist in version_map. Enqueue the module version to be fetched.
-			if _, err := s.queue.ScheduleFetch(ctx, modulePath, requestedVersion, "", s.taskIDChangeInterval); err != nil {
-				fr.err = err
-				fr.status = http.StatusInternalServerError
-			}
-			// After the fetch request is enqueued, poll the database until it has been
-			// inserted or the request times out.
-			fr = pollForPath(ctx, db, pollEvery, fullPath, modulePath, requestedVersion, s.taskIDChangeInterval)
-			logf := log.Infof
-			if fr.status == http.StatusInternalServerError {
-				logf = log.Errorf
+	start := time.Now()
+
+	// Before enqueuing the module versions to be fetched, check if we
+	// have already attempted to fetch them in the past. If so, just
+	// return the results from those fetch processes.
+	results := checkForPaths(ctx, db, fullPath, modulePaths, requestedVersion, s.taskIDChangeInterval)
+	if !shouldQueue {
+		return results
+	}
+	var (
+		pending   []int // indexes of the results that are being fetched
+		toEnqueue []int // indexes of the results that this request must enqueue
+	)
+	for i, fr := range results {
+		if fr.status != statusNotFoundInVersionMap {
+			continue
+		}
+		// A row for this modulePath and requestedVersion combination does not
+		// exist in version_map. Unless another request has just enqueued the
+		// module version, enqueue it to be fetched.
+		inFlight, err := s.fetchLimiter.inFlight(ctx, fr.modulePath, requestedVersion)
+		if err != nil {
+			// Fail open: at worst, the module version is enqueued twice.
+			log.Errorf(ctx, "checkPossibleModulePaths: %v", err)
+		}
+		if inFlight {
+			pending = append(pending, i)
+		} else {
+			toEnqueue = append(toEnqueue, i)
+		}
+	}
+	if len(toEnqueue) > 0 && !requester.unlimited {
+		allowed, retryAfter, err := s.fetchLimiter.allow(ctx, requester.ipKey)
+		if err != nil {
+			log.Errorf(ctx, "checkPossibleModulePaths: %v", err)
+			allowed = true
+		}
+		if !allowed {
+			log.Infof(ctx, "fetch limit reached for %q: not enqueuing %s@%s", requester.ipKey, fullPath, requestedVersion)
+			for _, i := range toEnqueue {
+				results[i].status = http.StatusTooManyRequests
+				results[i].err = &fetchLimitedError{retryAfter: retryAfter}
 			}
-			logf(ctx, "fetched %s@%s for %s: status=%d, err=%v; took %.3fs", modulePath, requestedVersion, fullPath, fr.status, fr.err, time.Since(start).Seconds())
-			results[i] = fr
-		}()
+			toEnqueue = nil
+		}
+	}
+	// Module versions stay in flight for as long as the queue ignores
+	// duplicate tasks, but at least as long as requests wait for them.
+	inFlightTTL := s.taskIDChangeInterval
+	if inFlightTTL < fetchTimeout {
+		inFlightTTL = fetchTimeout
+	}
+	for _, i := range toEnqueue {
+		fr := results[i]
+		pending = append(pending, i)
+		claimed, err := s.fetchLimiter.claim(ctx, fr.modulePath, requestedVersion, inFlightTTL)
+		if err != nil {
+			log.Errorf(ctx, "checkPossibleModulePaths: %v", err)
+			claimed = true
+		}
+		if !claimed {
+			// Another request enqueued it in the meantime.
+			continue
+		}
+		if _, err := s.queue.ScheduleFetch(ctx, fr.modulePath, requestedVersion, "", queue.PriorityInteractive, s.taskIDChangeInterval); err != nil {
+			fr.err = err
+			fr.status = http.StatusInternalServerError
+		}
+	}
+	sort.Ints(pending)
+	if len(pending) == 0 {
+		return results
+	}
+	// After the fetch requests are enqueued, poll the database until they have
+	// been inserted or the request times out.
+	pollForPaths(ctx, db, pollEvery, fullPath, requestedVersion, s.taskIDChangeInterval, results, pending)
+	for _, i := range pending {
+		fr := results[i]
+		logf := log.Infof
+		if fr.status == http.StatusInternalServerError {
+			logf = log.Errorf
+		}
+		logf(ctx, "fetched %s@%s for %s: status=%d, err=%v; took %.3fs", fr.modulePath, requestedVersion, fullPath, fr.status, fr.err, time.Since(start).Seconds())
 	}
-	wg.Wait()
 	return results
 }
 
@@ -223,12 +320,11 @@ func fetchRequestStatusAndResponseText(results []*fetchResult, fullPath, request
 			return fr.status, fmt.Sprintf("We're still working on “%s”. Check back in a few minutes!", displayPath(fullPath, requestedVersion))
 		case http.StatusInternalServerError:
 			return fr.status, "Oops! Something went wrong."
-		case derrors.ToStatus(derrors.AlternativeModule):
-			// TODO(https://golang.org/issue/40306): Make the canonical module
-			// path a clickable link.
-			return http.StatusNotFound,
-				fmt.Sprintf("“%s” is not a valid package or module. Were you looking for “%s”?",
-					displayPath(fullPath, requestedVersion), fr.goModPath)
+		case http.StatusTooManyRequests:
+			return fr.status, fmt.Sprintf("Too many fetch requests. Try fetching “%s” again later.", displayPath(fullPath, requestedVersion))
+		}
+		if text := fetchErrorText(fr, fullPath, requestedVersion); text != "" {
+			return http.StatusNotFound, text
 		}
 
 		// A module was found for a prefix of the path, but the path did not exist
@@ -257,6 +353,66 @@ func fetchRequestStatusAndResponseText(results []*fetchResult, fullPath, request
 	return http.StatusNotFound, fmt.Sprintf("%q could not be found.", p)
 }
 
+// fetchErrorText returns the text to display for the result of a fetch that
+// failed with an error code that the user can act on, or the empty string if
+// there is none.
+func fetchErrorText(fr *fetchResult, fullPath, requestedVersion string) string {
+	switch fr.errorCode {
+	case derrors.CodeAlternativeModule:
+		// TODO(https://golang.org/issue/40306): Make the canonical module
+		// path a clickable link.
+		return fmt.Sprintf("“%s” is not a valid package or module. Were you looking for “%s”?",
+			displayPath(fullPath, requestedVersion), fr.goModPath)
+	case derrors.CodeModulePathCasing:
+		return fmt.Sprintf("“%s” is not a valid package or module, because module paths are case-sensitive. "+
+			"Were you looking for “%s”?",
+			displayPath(fullPath, requestedVersion), fr.goModPath)
+	case derrors.CodeModuleTooLarge:
+		return fmt.Sprintf("“%s” is in a module that is too large to process. "+
+			"Modules may have a zip file of at most %d MB, containing at most %d files "+
+			"that total at most %d MB uncompressed.",
+			displayPath(fullPath, requestedVersion),
+			fetch.MaxModuleZipSize/1e6, fetch.MaxModuleFiles, fetch.MaxModuleUncompressedSize/1e6)
+	case derrors.CodeModuleTooManyPackages:
+		return fmt.Sprintf("“%s” is in a module that has too many packages to process. "+
+			"Modules may have at most %d packages.",
+			displayPath(fullPath, requestedVersion), fetch.MaxModulePackages)
+	case derrors.CodeModuleHasNoPackages:
+		return fmt.Sprintf("Module “%s” does not contain any Go packages.",
+			displayPath(fr.modulePath, requestedVersion))
+	case derrors.CodeBadGoMod:
+		return fmt.Sprintf("The go.mod file of module “%s” does not declare a module path.",
+			displayPath(fr.modulePath, requestedVersion))
+	case derrors.CodeBadModuleZip:
+		return fmt.Sprintf("The zip file of module “%s” is malformed.",
+			displayPath(fr.modulePath, requestedVersion))
+	case derrors.CodeChecksumVerificationFailed:
+		return fmt.Sprintf("The zip file of module “%s” does not match the checksum database.",
+			displayPath(fr.modulePath, requestedVersion))
+	}
+	return ""
+}
+
+// fetchErrorGuidance returns what the author of a module can do about an
+// error with the given derrors code, or the empty string if there is nothing
+// to say.
+func fetchErrorGuidance(code string) string {
+	switch code {
+	case derrors.CodeModulePathCasing:
+		return "Use the module path exactly as it is declared in the go.mod file of the module."
+	case derrors.CodeModuleTooLarge, derrors.CodeModuleTooManyPackages:
+		return "Consider splitting the module into smaller modules."
+	case derrors.CodeModuleHasNoPackages:
+		return "Only modules with at least one package containing .go files can be displayed. " +
+			"Check that the .go files of the module are not all excluded by build constraints or ignored directories."
+	case derrors.CodeBadGoMod:
+		return "Add a module directive to the go.mod file and publish a new version."
+	case derrors.CodeBadModuleZip, derrors.CodeChecksumVerificationFailed:
+		return "Publish a new version of the module."
+	}
+	return ""
+}
+
 func displayPath(path, version string) string {
 	if version == internal.LatestVersion {
 		return path
@@ -264,39 +420,92 @@ func displayPath(path, version string) string {
 	return fmt.Sprintf("%s@%s", path, version)
 }
 
-// pollForPath polls the database until a row for fullPath is found.
-func pollForPath(ctx context.Context, db *postgres.DB, pollEvery time.Duration,
-	fullPath, modulePath, requestedVersion string, taskIDChangeInterval time.Duration) *fetchResult {
-	fr := &fetchResult{modulePath: modulePath}
-	defer derrors.Wrap(&fr.err, "pollForRedirectURL(%q, %q, %q)", modulePath, fullPath, requestedVersion)
+// pollForPaths polls the database until a row for fullPath is found for each
+// of the results whose indexes are in pending, and replaces those results.
+// All of the pending module paths are checked with a single query to
+// version_map each time.
+func pollForPaths(ctx context.Context, db *postgres.DB, pollEvery time.Duration,
+	fullPath, requestedVersion string, taskIDChangeInterval time.Duration, results []*fetchResult, pending []int) {
 	ticker := time.NewTicker(pollEvery)
 	defer ticker.Stop()
-	for {
+	for len(pending) > 0 {
 		select {
 		case <-ctx.Done():
-			// The request timed out before the fetch process completed.
-			fr.status = http.StatusRequestTimeout
-			fr.err = ctx.Err()
-			return fr
+			// The request timed out before the fetch processes completed.
+			for _, i := range pending {
+				modulePath := results[i].modulePath
+				fr := &fetchResult{
+					modulePath: modulePath,
+					status:     http.StatusRequestTimeout,
+					err:        ctx.Err(),
+				}
+				derrors.Wrap(&fr.err, "pollForPaths(%q, %q, %q)", modulePath, fullPath, requestedVersion)
+				results[i] = fr
+			}
+			return
 		case <-ticker.C:
+			var modulePaths []string
+			for _, i := range pending {
+				modulePaths = append(modulePaths, results[i].modulePath)
+			}
 			ctx2, cancel := context.WithTimeout(ctx, pollEvery)
-			defer cancel()
-			fr = checkForPath(ctx2, db, fullPath, modulePath, requestedVersion, taskIDChangeInterval)
-			if fr.status != statusNotFoundInVersionMap {
-				return fr
+			frs := checkForPaths(ctx2, db, fullPath, modulePaths, requestedVersion, taskIDChangeInterval)
+			cancel()
+			var stillPending []int
+			for j, i := range pending {
+				if frs[j].status == statusNotFoundInVersionMap {
+					stillPending = append(stillPending, i)
+					continue
+				}
+				results[i] = frs[j]
 			}
+			pending = stillPending
 		}
 	}
 }
 
+// retryableFailure reports whether the failed fetch recorded in vm may
+// succeed if the module version is fetched again: the failure may have been
+// transient, or the requested version is a query like "latest" or "master",
+// which may now resolve to a different version. The other failures are known
+// to recur, so fetch requests don't enqueue them again. If a module version
+// that the proxy did not have is published later, the worker fetches it from
+// the module index, and module versions that failed because of a bug are
+// reprocessed once it is fixed.
+func retryableFailure(vm *internal.VersionMap) bool {
+	return vm.Status == http.StatusInternalServerError || !semver.IsValid(vm.RequestedVersion)
+}
+
+// checkForPaths calls checkForPath for each of modulePaths, after looking up
+// all of their rows in version_map with a single query.
+func checkForPaths(ctx context.Context, db *postgres.DB,
+	fullPath string, modulePaths []string, requestedVersion string, taskIDChangeInterval time.Duration) []*fetchResult {
+	var mvs []internal.Modver
+	for _, modulePath := range modulePaths {
+		mvs = append(mvs, internal.Modver{Path: modulePath, Version: requestedVersion})
+	}
+	vms, err := db.GetVersionMaps(ctx, mvs)
+	results := make([]*fetchResult, len(modulePaths))
+	for i, modulePath := range modulePaths {
+		var vm *internal.VersionMap
+		if err == nil {
+			vm = vms[i]
+		}
+		results[i] = checkForPath(ctx, db, fullPath, modulePath, requestedVersion, vm, err, taskIDChangeInterval)
+	}
+	return results
+}
+
 // checkForPath checks for the existence of fullPath, modulePath, and
-// requestedVersion in the database. If the modulePath does not exist in
+// requestedVersion in the database, given vm, the row of version_map for
+// modulePath and requestedVersion, or nil if there is none, and vmErr, the
+// error from looking it up. If the modulePath does not exist in
 // version_map, it returns errModuleNotInVersionMap, signaling that the fetch
 // process that was initiated is not yet complete.  If the row exists version_map
 // but not paths, it means that a module was found at the requestedVersion, but
 // not the fullPath, so errPathDoesNotExistInModule is returned.
 func checkForPath(ctx context.Context, db *postgres.DB,
-	fullPath, modulePath, requestedVersion string, taskIDChangeInterval time.Duration) (fr *fetchResult) {
+	fullPath, modulePath, requestedVersion string, vm *internal.VersionMap, vmErr error, taskIDChangeInterval time.Duration) (fr *fetchResult) {
 	defer func() {
 		// Based on
 		// https://github.com/lib/pq/issues/577#issuecomment-298341053, it seems
@@ -313,7 +522,10 @@ func checkForPath(ctx context.Context, db *postgres.DB,
 
 	// Check the version_map table to see if a row exists for modulePath and
 	// requestedVersion.
-	vm, err := db.GetVersionMap(ctx, modulePath, requestedVersion)
+	err := vmErr
+	if err == nil && vm == nil {
+		err = derrors.NotFound
+	}
 	if err != nil {
 		// If an error is returned, there are two possibilities:
 		// (1) A row for this modulePath and version does not exist.
@@ -338,21 +550,17 @@ func checkForPath(ctx context.Context, db *postgres.DB,
 	fr = &fetchResult{
 		modulePath: modulePath,
 		status:     vm.Status,
+		errorCode:  vm.ErrorCode,
 		goModPath:  vm.GoModPath,
 	}
 	switch fr.status {
 	case http.StatusNotFound,
 		derrors.ToStatus(derrors.DBModuleInsertInvalid),
 		http.StatusInternalServerError:
-		if time.Since(vm.UpdatedAt) > taskIDChangeInterval {
+		if time.Since(vm.UpdatedAt) > taskIDChangeInterval && retryableFailure(vm) {
 			// If the duration of taskIDChangeInterval has passed since
-			// a module_path was last inserted into version_map with a failed status,
-			// treat that data as expired.
-			//
-			// It is possible that the module has appeared in the Go Module
-			// Mirror during that time, the failure was transient, or the
-			// error has been fixed but the module version has not yet been
-			// reprocessed.
+			// a module_path was last inserted into version_map with a
+			// failed status that may not recur, treat that data as expired.
 			//
 			// Return statusNotFoundInVersionMap here, so that the fetch
 			// request will try to fetch this module version again.
@@ -370,6 +578,11 @@ func checkForPath(ctx context.Context, db *postgres.DB,
 		// /<modulePath>/@v/<requestedPath>.mod.
 		fr.err = derrors.AlternativeModule
 		return fr
+	case derrors.ToStatus(derrors.ModuleTooLarge):
+		// The module exceeded a limit of package fetch, so fetching it
+		// again will not help.
+		fr.err = derrors.ModuleTooLarge
+		return fr
 	default:
 		// The module was marked for reprocessing by the worker.
 		// Return statusNotFoundInVersionMap here, so that the tasks gets enqueued
@@ -519,6 +732,7 @@ func FetchAndUpdateState(ctx context.Context, modulePath, requestedVersion strin
 		GoModPath:        fr.GoModPath,
 		Status:           fr.Status,
 		Error:            errMsg,
+		ErrorCode:        derrors.ToCode(fr.Error),
 	}
 	if err := db.UpsertVersionMap(ctx, vm); err != nil {
 		return http.StatusInternalServerError, err
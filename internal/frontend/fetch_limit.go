@@ -0,0 +1,180 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/golang/groupcache/lru"
+	"golang.org/x/pkgsite/internal/config"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/ratelimit"
+)
+
+// A fetchLimiter limits the rate at which frontend fetch requests enqueue
+// module versions to be fetched, for each IP block and for everyone. It also
+// remembers which module versions were recently enqueued, so that requests
+// for a module version that is already being fetched wait for that fetch
+// instead of enqueuing it again, and are not counted against the limits.
+type fetchLimiter struct {
+	settings config.FetchQuotaSettings
+	store    limitStore
+}
+
+// A limitStore holds the token buckets and in-flight markers of a
+// fetchLimiter.
+type limitStore interface {
+	ratelimit.Store
+	// claim marks key for ttl, and reports whether it was not already marked.
+	claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// marked reports whether key is marked.
+	marked(ctx context.Context, key string) (bool, error)
+}
+
+// newFetchLimiter returns a fetchLimiter that holds its state in redis, or
+// in memory if client is nil.
+func newFetchLimiter(settings config.FetchQuotaSettings, client *redis.Client) *fetchLimiter {
+	var store limitStore
+	if client != nil {
+		store = &redisLimitStore{RedisStore: ratelimit.NewRedisStore(client, ""), client: client}
+	} else {
+		store = newMemoryLimitStore(settings.MaxEntries)
+	}
+	return &fetchLimiter{settings: settings, store: store}
+}
+
+// bypass reports whether authValue allows requests to bypass the limits.
+func (l *fetchLimiter) bypass(authValue string) bool {
+	if authValue == "" {
+		return false
+	}
+	for _, v := range l.settings.AuthValues {
+		if authValue == v {
+			return true
+		}
+	}
+	return false
+}
+
+// allow takes a token from the bucket of the IP block ipKey, and from the
+// global bucket. If either is empty, it reports false and how long the caller
+// should wait before trying again; a token taken from the bucket of ipKey is
+// then returned. Requests whose IP block is unknown are only subject to the
+// global limit.
+func (l *fetchLimiter) allow(ctx context.Context, ipKey string) (_ bool, _ time.Duration, err error) {
+	defer derrors.Wrap(&err, "fetchLimiter.allow(%q)", ipKey)
+	ipBucket := ""
+	if ipKey != "" && l.settings.PerIPPerMinute > 0 {
+		ipBucket = "fetch-quota:ip:" + ipKey
+		ok, retryAfter, err := l.store.Take(ctx, ipBucket, perSecond(l.settings.PerIPPerMinute), l.settings.PerIPBurst)
+		if err != nil || !ok {
+			return ok, retryAfter, err
+		}
+	}
+	if l.settings.GlobalPerMinute <= 0 {
+		return true, 0, nil
+	}
+	ok, retryAfter, err := l.store.Take(ctx, "fetch-quota:global", perSecond(l.settings.GlobalPerMinute), l.settings.GlobalBurst)
+	if err != nil || ok || ipBucket == "" {
+		return ok, retryAfter, err
+	}
+	// The request is refused, so it doesn't count against its IP block.
+	if err := l.store.Refund(ctx, ipBucket, l.settings.PerIPBurst); err != nil {
+		return false, 0, err
+	}
+	return false, retryAfter, nil
+}
+
+// inFlight reports whether modulePath@version was recently enqueued.
+func (l *fetchLimiter) inFlight(ctx context.Context, modulePath, version string) (bool, error) {
+	return l.store.marked(ctx, inFlightKey(modulePath, version))
+}
+
+// claim records that modulePath@version is about to be enqueued, and will be
+// in flight for ttl. It reports false if another request claimed it first.
+func (l *fetchLimiter) claim(ctx context.Context, modulePath, version string, ttl time.Duration) (bool, error) {
+	return l.store.claim(ctx, inFlightKey(modulePath, version), ttl)
+}
+
+// perSecond converts a rate per minute to a rate per second.
+func perSecond(perMinute int) float64 {
+	return float64(perMinute) / 60
+}
+
+func inFlightKey(modulePath, version string) string {
+	return fmt.Sprintf("fetch-inflight:%s@%s", modulePath, version)
+}
+
+// memoryLimitStore is a limitStore for a single frontend instance.
+type memoryLimitStore struct {
+	*ratelimit.MemoryStore
+	now func() time.Time
+
+	mu     sync.Mutex
+	claims *lru.Cache // key to expiration time
+}
+
+func newMemoryLimitStore(size int) *memoryLimitStore {
+	s := &memoryLimitStore{
+		claims: lru.New(size),
+		now:    time.Now,
+	}
+	s.MemoryStore = ratelimit.NewMemoryStore(size, func() time.Time { return s.now() })
+	return s
+}
+
+func (s *memoryLimitStore) claim(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.markedLocked(key) {
+		return false, nil
+	}
+	s.claims.Add(key, s.now().Add(ttl))
+	return true, nil
+}
+
+func (s *memoryLimitStore) marked(_ context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.markedLocked(key), nil
+}
+
+func (s *memoryLimitStore) markedLocked(key string) bool {
+	v, ok := s.claims.Get(key)
+	if !ok {
+		return false
+	}
+	if s.now().After(v.(time.Time)) {
+		s.claims.Remove(key)
+		return false
+	}
+	return true
+}
+
+// redisLimitStore is a limitStore shared by all frontend instances.
+type redisLimitStore struct {
+	*ratelimit.RedisStore
+	client *redis.Client
+}
+
+func (s *redisLimitStore) claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return s.client.WithContext(ctx).SetNX(key, 1, ttl).Result()
+}
+
+func (s *redisLimitStore) marked(ctx context.Context, key string) (bool, error) {
+	n, err := s.client.WithContext(ctx).Exists(key).Result()
+	return n > 0, err
+}
+
+// retryAfterSeconds returns d as a whole number of seconds, rounded up, for
+// use in a Retry-After header.
+func retryAfterSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
+	"golang.org/x/pkgsite/internal/config"
+)
+
+var testFetchQuota = config.FetchQuotaSettings{
+	PerIPPerMinute:  1,
+	PerIPBurst:      2,
+	GlobalPerMinute: 60,
+	GlobalBurst:     3,
+	MaxEntries:      10,
+	AuthValues:      []string{"secret"},
+}
+
+func TestFetchLimiterMemory(t *testing.T) {
+	l := newFetchLimiter(testFetchQuota, nil)
+	now := time.Now()
+	l.store.(*memoryLimitStore).now = func() time.Time { return now }
+	testFetchLimiter(t, l, func(d time.Duration) { now = now.Add(d) })
+}
+
+func TestFetchLimiterRedis(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	l := newFetchLimiter(testFetchQuota, redis.NewClient(&redis.Options{Addr: s.Addr()}))
+	// The redis store reads the time from the clock, so only check what
+	// happens within the first second.
+	testFetchLimiter(t, l, nil)
+}
+
+// testFetchLimiter checks l, which must have the settings of testFetchQuota.
+// If advance is non-nil, it moves the clock of l forward.
+func testFetchLimiter(t *testing.T, l *fetchLimiter, advance func(time.Duration)) {
+	t.Helper()
+	ctx := context.Background()
+
+	check := func(ipKey string, want bool) time.Duration {
+		t.Helper()
+		got, retryAfter, err := l.allow(ctx, ipKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("allow(%q) = %t; want %t", ipKey, got, want)
+		}
+		return retryAfter
+	}
+
+	// A burst from one IP block is cut off after PerIPBurst requests.
+	check("1.2.3", true)
+	check("1.2.3", true)
+	if got := retryAfterSeconds(check("1.2.3", false)); got < 59 || got > 60 {
+		t.Errorf("retry after %ds; want about 60s", got)
+	}
+	// Other IP blocks are only subject to the global limit.
+	check("4.5.6", true)
+	check("7.8.9", false)
+	check("", false)
+
+	if advance != nil {
+		// The request that the global limit refused did not count against
+		// the limit of 7.8.9.
+		advance(time.Second)
+		check("7.8.9", true)
+		advance(time.Second)
+		check("7.8.9", true)
+		check("7.8.9", false)
+
+		advance(time.Minute)
+		check("1.2.3", true)
+		check("1.2.3", false)
+	}
+
+	// In-flight markers.
+	const modulePath, version = "example.com/mod", "v1.0.0"
+	inFlight := func(want bool) {
+		t.Helper()
+		got, err := l.inFlight(ctx, modulePath, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("inFlight = %t; want %t", got, want)
+		}
+	}
+	claim := func(want bool) {
+		t.Helper()
+		got, err := l.claim(ctx, modulePath, version, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("claim = %t; want %t", got, want)
+		}
+	}
+	inFlight(false)
+	claim(true)
+	inFlight(true)
+	claim(false)
+	if advance != nil {
+		advance(2 * time.Minute)
+		inFlight(false)
+		claim(true)
+	}
+}
+
+func TestFetchLimiterBypass(t *testing.T) {
+	l := newFetchLimiter(testFetchQuota, nil)
+	for _, test := range []struct {
+		authValue string
+		want      bool
+	}{
+		{"", false},
+		{"wrong", false},
+		{"secret", true},
+	} {
+		if got := l.bypass(test.authValue); got != test.want {
+			t.Errorf("bypass(%q) = %t; want %t", test.authValue, got, test.want)
+		}
+	}
+}
+
+func TestFetchLimiterDisabled(t *testing.T) {
+	l := newFetchLimiter(config.FetchQuotaSettings{}, nil)
+	for i := 0; i < 100; i++ {
+		ok, _, err := l.allow(context.Background(), "1.2.3")
+		if err != nil || !ok {
+			t.Fatalf("allow #%d = %t, %v; want true, nil", i, ok, err)
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/config"
 	"golang.org/x/pkgsite/internal/derrors"
 	"golang.org/x/pkgsite/internal/experiment"
 	"golang.org/x/pkgsite/internal/proxy"
@@ -79,7 +80,7 @@ func TestFetch(t *testing.T) {
 				internal.ExperimentMasterVersion,
 				internal.ExperimentUsePathInfo)
 
-			status, responseText := s.fetchAndPoll(ctx, s.getDataSource(ctx), testModulePath, test.fullPath, test.version)
+			status, responseText, _ := s.fetchAndPoll(ctx, s.getDataSource(ctx), fetchRequester{}, testModulePath, test.fullPath, test.version)
 			if status != http.StatusOK {
 				t.Fatalf("fetchAndPoll(%q, %q, %q) = %d, %s; want status = %d",
 					testModulePath, test.fullPath, test.version, status, responseText, http.StatusOK)
@@ -134,7 +135,7 @@ func TestFetchErrors(t *testing.T) {
 			ctx = experiment.NewContext(ctx, internal.ExperimentFrontendFetch)
 			s, _, teardown := newTestServer(t, testModulesForProxy)
 			defer teardown()
-			got, _ := s.fetchAndPoll(ctx, s.getDataSource(ctx), test.modulePath, test.fullPath, test.version)
+			got, _, _ := s.fetchAndPoll(ctx, s.getDataSource(ctx), fetchRequester{}, test.modulePath, test.fullPath, test.version)
 			if got != test.want {
 				t.Fatalf("fetchAndPoll(ctx, testDB, q, %q, %q, %q): %d; want = %d",
 					test.modulePath, test.fullPath, test.version, got, test.want)
@@ -143,15 +144,41 @@ func TestFetchErrors(t *testing.T) {
 	}
 }
 
+func TestFetchLimited(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testFetchTimeout)
+	defer cancel()
+	ctx = experiment.NewContext(ctx, internal.ExperimentFrontendFetch)
+
+	s, _, teardown := newTestServer(t, testModulesForProxy)
+	defer teardown()
+	s.fetchLimiter = newFetchLimiter(config.FetchQuotaSettings{PerIPPerMinute: 1, PerIPBurst: 0}, nil)
+
+	requester := fetchRequester{ipKey: "1.2.3"}
+	got, _, retryAfter := s.fetchAndPoll(ctx, s.getDataSource(ctx), requester, testModulePath, testModulePath, internal.LatestVersion)
+	if got != http.StatusTooManyRequests || retryAfter <= 0 {
+		t.Fatalf("fetchAndPoll: %d, retry after %s; want %d, retry after > 0", got, retryAfter, http.StatusTooManyRequests)
+	}
+
+	// Requests that bypass the limits are still served.
+	requester.unlimited = true
+	got, _, _ = s.fetchAndPoll(ctx, s.getDataSource(ctx), requester, testModulePath, testModulePath, internal.LatestVersion)
+	if got != http.StatusOK {
+		t.Fatalf("fetchAndPoll with unlimited requester: %d; want %d", got, http.StatusOK)
+	}
+}
+
 func TestFetchPathAlreadyExists(t *testing.T) {
 	for _, test := range []struct {
-		status, want int
+		status    int
+		errorCode string
+		want      int
 	}{
-		{http.StatusOK, http.StatusOK},
-		{http.StatusNotFound, http.StatusNotFound},
-		{derrors.ToStatus(derrors.AlternativeModule), http.StatusNotFound},
+		{http.StatusOK, "", http.StatusOK},
+		{http.StatusNotFound, derrors.CodeNotFound, http.StatusNotFound},
+		{derrors.ToStatus(derrors.AlternativeModule), derrors.CodeAlternativeModule, http.StatusNotFound},
+		{derrors.ToStatus(derrors.AlternativeModule), derrors.CodeModulePathCasing, http.StatusNotFound},
 	} {
-		t.Run(strconv.Itoa(test.status), func(t *testing.T) {
+		t.Run(strconv.Itoa(test.status)+test.errorCode, func(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), testFetchTimeout)
 			defer cancel()
 			ctx = experiment.NewContext(ctx,
@@ -165,13 +192,14 @@ func TestFetchPathAlreadyExists(t *testing.T) {
 				RequestedVersion: sample.VersionString,
 				ResolvedVersion:  sample.VersionString,
 				Status:           test.status,
+				ErrorCode:        test.errorCode,
 			}); err != nil {
 				t.Fatal(err)
 			}
 
 			s, _, teardown := newTestServer(t, testModulesForProxy)
 			defer teardown()
-			got, _ := s.fetchAndPoll(ctx, s.getDataSource(ctx), sample.ModulePath, sample.PackagePath, sample.VersionString)
+			got, _, _ := s.fetchAndPoll(ctx, s.getDataSource(ctx), fetchRequester{}, sample.ModulePath, sample.PackagePath, sample.VersionString)
 			if got != test.want {
 				t.Fatalf("fetchAndPoll for status %d: %d; want = %d)", test.status, got, test.want)
 			}
@@ -179,6 +207,80 @@ func TestFetchPathAlreadyExists(t *testing.T) {
 	}
 }
 
+func TestFetchAndPollUnsupportedVersion(t *testing.T) {
+	ctx := experiment.NewContext(context.Background(), internal.ExperimentFrontendFetch, internal.ExperimentMasterVersion)
+	for _, test := range []struct {
+		modulePath, fullPath, version string
+	}{
+		{testModulePath, testModulePath, "not-a-version"},
+		{"std", "net/http", internal.LatestVersion},
+		{"std", "net/http", internal.MasterVersion},
+	} {
+		// Unsupported versions are rejected before the database is read.
+		s := &Server{}
+		got, _, _ := s.fetchAndPoll(ctx, nil, fetchRequester{}, test.modulePath, test.fullPath, test.version)
+		if got != http.StatusBadRequest {
+			t.Errorf("fetchAndPoll(%q, %q, %q) = %d; want %d", test.modulePath, test.fullPath, test.version, got, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestCheckForPathExpiredFailure(t *testing.T) {
+	const interval = time.Hour
+	for _, test := range []struct {
+		status           int
+		requestedVersion string
+		age              time.Duration
+		want             int
+	}{
+		{http.StatusNotFound, sample.VersionString, 2 * interval, http.StatusNotFound},
+		{http.StatusNotFound, internal.MasterVersion, 2 * interval, statusNotFoundInVersionMap},
+		{http.StatusNotFound, internal.MasterVersion, interval / 2, http.StatusNotFound},
+		{derrors.ToStatus(derrors.DBModuleInsertInvalid), sample.VersionString, 2 * interval, derrors.ToStatus(derrors.DBModuleInsertInvalid)},
+		{http.StatusInternalServerError, sample.VersionString, 2 * interval, statusNotFoundInVersionMap},
+		{http.StatusInternalServerError, sample.VersionString, interval / 2, http.StatusInternalServerError},
+	} {
+		vm := &internal.VersionMap{
+			ModulePath:       sample.ModulePath,
+			RequestedVersion: test.requestedVersion,
+			Status:           test.status,
+			UpdatedAt:        time.Now().Add(-test.age),
+		}
+		// The database is only read for module versions that were fetched.
+		fr := checkForPath(context.Background(), nil, sample.PackagePath, sample.ModulePath, test.requestedVersion, vm, nil, interval)
+		if fr.status != test.want {
+			t.Errorf("status %d for %s, %s ago: got %d, want %d", test.status, test.requestedVersion, test.age, fr.status, test.want)
+		}
+	}
+}
+
+func TestFetchErrorText(t *testing.T) {
+	for _, test := range []struct {
+		code string
+		want string
+	}{
+		{"", ""},
+		{derrors.CodeNotFound, ""},
+		{derrors.CodeAlternativeModule, "“github.com/A/b@v1.0.0” is not a valid package or module. Were you looking for “github.com/a/b”?"},
+		{derrors.CodeModulePathCasing, "“github.com/A/b@v1.0.0” is not a valid package or module, because module paths are case-sensitive. " +
+			"Were you looking for “github.com/a/b”?"},
+		{derrors.CodeModuleHasNoPackages, "Module “github.com/A/b@v1.0.0” does not contain any Go packages."},
+		{derrors.CodeBadGoMod, "The go.mod file of module “github.com/A/b@v1.0.0” does not declare a module path."},
+		{derrors.CodeBadModuleZip, "The zip file of module “github.com/A/b@v1.0.0” is malformed."},
+		{derrors.CodeModuleTooManyPackages, "“github.com/A/b@v1.0.0” is in a module that has too many packages to process. " +
+			"Modules may have at most 10000 packages."},
+	} {
+		fr := &fetchResult{
+			modulePath: "github.com/A/b",
+			goModPath:  "github.com/a/b",
+			errorCode:  test.code,
+		}
+		if got := fetchErrorText(fr, "github.com/A/b", "v1.0.0"); got != test.want {
+			t.Errorf("fetchErrorText(%q) = %q, want %q", test.code, got, test.want)
+		}
+	}
+}
+
 func TestCandidateModulePaths(t *testing.T) {
 	maxPathsToFetch = 7
 	for _, test := range []struct {
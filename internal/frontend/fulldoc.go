@@ -0,0 +1,87 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/golang/groupcache/lru"
+	"github.com/google/safehtml"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/fetch"
+)
+
+const (
+	// fullDocCacheSize is the number of full documentations rendered from
+	// source that are cached. Each is larger than
+	// fetch.DocumentationCollapseThreshold, so only a few are kept.
+	fullDocCacheSize = 16
+
+	// maxFullDocRenders is the maximum number of full documentations that
+	// are rendered at once. Rendering parses the whole package and uses a
+	// lot of CPU and memory, so further requests wait.
+	maxFullDocRenders = 2
+)
+
+// fullDocRenderer renders the full documentation of packages whose stored
+// documentation is abbreviated because it is too large. It caches what it
+// renders, keyed by package, version and build context, and limits the
+// number of renders at once.
+type fullDocRenderer struct {
+	renders chan struct{}
+
+	mu    sync.Mutex
+	cache *lru.Cache
+}
+
+func newFullDocRenderer(cacheSize, maxRenders int) *fullDocRenderer {
+	return &fullDocRenderer{
+		renders: make(chan struct{}, maxRenders),
+		cache:   lru.New(cacheSize),
+	}
+}
+
+// render returns the full documentation for doc, which belongs to the
+// package described by um. If doc has no source, its stored HTML is
+// returned.
+func (r *fullDocRenderer) render(ctx context.Context, um *internal.UnitMeta, doc *internal.Documentation) (safehtml.HTML, error) {
+	if doc.Source == nil {
+		return doc.HTML, nil
+	}
+	key := fmt.Sprintf("%s@%s?GOOS=%s&GOARCH=%s", um.Path, um.Version, doc.GOOS, doc.GOARCH)
+	if h, ok := r.get(key); ok {
+		return h, nil
+	}
+	select {
+	case r.renders <- struct{}{}:
+	case <-ctx.Done():
+		return safehtml.HTML{}, ctx.Err()
+	}
+	defer func() { <-r.renders }()
+	// Another request may have rendered it while this one waited.
+	if h, ok := r.get(key); ok {
+		return h, nil
+	}
+	h, err := fetch.RenderFullDocumentation(ctx, um, doc)
+	if err != nil {
+		return safehtml.HTML{}, err
+	}
+	r.mu.Lock()
+	r.cache.Add(key, h)
+	r.mu.Unlock()
+	return h, nil
+}
+
+func (r *fullDocRenderer) get(key string) (safehtml.HTML, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.cache.Get(key)
+	if !ok {
+		return safehtml.HTML{}, false
+	}
+	return v.(safehtml.HTML), true
+}
@@ -7,6 +7,8 @@ package frontend
 import (
 	"fmt"
 	"path"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -40,6 +42,30 @@ type Module struct {
 	URL               string // relative to this site
 	LatestURL         string // link with latest-version placeholder, relative to this site
 	Licenses          []LicenseMetadata
+	// Retracted reports whether the go.mod file of the latest version of the
+	// module retracts this version, and RetractionRationale is the
+	// explanation given for it, if any.
+	Retracted           bool
+	RetractionRationale string
+	// AllVersionsRetracted reports whether this version was shown as the
+	// latest version of the module even though it is retracted, which only
+	// happens when every version of the module is retracted.
+	AllVersionsRetracted bool
+	// Deprecation is the deprecation message of the module, split so that
+	// the paths it mentions can be linked. Parts of the message without an
+	// Href are plain text. It is empty if the module is not deprecated.
+	Deprecation []link
+	// TruncatedPackages describes how many of the module's packages have
+	// documentation, like "8,000 of 41,000", if the module had too many
+	// packages to process them all. Otherwise it is empty.
+	TruncatedPackages string
+	// GoVersion and Toolchain are the arguments of the go and toolchain
+	// directives of the module's go.mod file, or empty if it has none.
+	GoVersion string
+	Toolchain string
+	// DevelVersion reports whether this is a development version of the
+	// standard library, a snapshot of the master branch of the Go repo.
+	DevelVersion bool
 }
 
 // createPackage returns a *Package based on the fields of the specified
@@ -85,17 +111,80 @@ func createModule(mi *internal.ModuleInfo, licmetas []*licenses.Metadata, latest
 		urlVersion = internal.LatestVersion
 	}
 	return &Module{
-		DisplayVersion:    displayVersion(mi.Version, mi.ModulePath),
-		LinkVersion:       linkVersion(mi.Version, mi.ModulePath),
-		ModulePath:        mi.ModulePath,
-		CommitTime:        elapsedTime(mi.CommitTime),
-		IsRedistributable: mi.IsRedistributable,
-		Licenses:          transformLicenseMetadata(licmetas),
-		URL:               constructModuleURL(mi.ModulePath, urlVersion),
-		LatestURL:         constructModuleURL(mi.ModulePath, middleware.LatestMinorVersionPlaceholder),
+		DisplayVersion:       displayVersion(mi.Version, mi.ModulePath),
+		LinkVersion:          linkVersion(mi.Version, mi.ModulePath),
+		ModulePath:           mi.ModulePath,
+		CommitTime:           elapsedTime(mi.CommitTime),
+		IsRedistributable:    mi.IsRedistributable,
+		Licenses:             transformLicenseMetadata(licmetas),
+		URL:                  constructModuleURL(mi.ModulePath, urlVersion),
+		LatestURL:            constructModuleURL(mi.ModulePath, middleware.LatestMinorVersionPlaceholder),
+		Retracted:            mi.Retracted,
+		RetractionRationale:  mi.RetractionRationale,
+		AllVersionsRetracted: latestRequested && mi.Retracted,
+		Deprecation:          deprecationParts(mi.Deprecation),
+		TruncatedPackages:    truncatedPackages(mi.ProcessedPackages, mi.TotalPackages),
+		GoVersion:            mi.GoVersion,
+		Toolchain:            mi.Toolchain,
+		DevelVersion:         mi.ModulePath == stdlib.ModulePath && stdlib.IsDevelVersion(mi.Version),
 	}
 }
 
+// truncatedPackages returns a description of the number of packages that
+// were processed out of the total, or the empty string if total is zero.
+func truncatedPackages(processed, total int) string {
+	if total == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s of %s", formatCount(processed), formatCount(total))
+}
+
+// formatCount formats n with commas separating groups of three digits.
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// deprecationParts splits the deprecation message of a module into parts, so
+// that the module paths it mentions, such as "example.com/new" in
+// "use example.com/new instead", link to their pages. Only paths with more
+// than one element are linked, so that words like "e.g." are left alone.
+func deprecationParts(msg string) []link {
+	if msg == "" {
+		return nil
+	}
+	var (
+		parts []link
+		start int // start of the text not yet added to parts
+	)
+	for _, loc := range wordRegexp.FindAllStringIndex(msg, -1) {
+		word := msg[loc[0]:loc[1]]
+		lo := loc[0] + len(word) - len(strings.TrimLeft(word, "(\"'`"))
+		hi := loc[0] + len(strings.TrimRight(word, ".,;:!?)\"'`"))
+		if lo >= hi {
+			continue
+		}
+		p := msg[lo:hi]
+		if !strings.Contains(p, "/") || module.CheckPath(p) != nil {
+			continue
+		}
+		if start < lo {
+			parts = append(parts, link{Body: msg[start:lo]})
+		}
+		parts = append(parts, link{Href: "/" + p, Body: p})
+		start = hi
+	}
+	if start < len(msg) {
+		parts = append(parts, link{Body: msg[start:]})
+	}
+	return parts
+}
+
+var wordRegexp = regexp.MustCompile(`\S+`)
+
 func constructModuleURL(modulePath, linkVersion string) string {
 	url := "/"
 	if modulePath != stdlib.ModulePath {
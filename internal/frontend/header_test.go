@@ -123,6 +123,42 @@ func TestCreatePackage(t *testing.T) {
 				p.LinkVersion = internal.LatestVersion
 			}),
 		},
+		{
+			label: "go version and toolchain",
+			pkg: func() *internal.LegacyVersionedPackage {
+				vp := vpkg(sample.ModulePath, sample.Suffix, "")
+				vp.GoVersion, vp.Toolchain = "1.21.0", "go1.21.3"
+				return vp
+			}(),
+			wantPkg: samplePackage(func(p *Package) {
+				p.GoVersion, p.Toolchain = "1.21.0", "go1.21.3"
+			}),
+		},
+		{
+			label: "retracted",
+			pkg: func() *internal.LegacyVersionedPackage {
+				vp := vpkg(sample.ModulePath, sample.Suffix, "")
+				vp.Retracted, vp.RetractionRationale = true, "Broken."
+				return vp
+			}(),
+			wantPkg: samplePackage(func(p *Package) {
+				p.Retracted, p.RetractionRationale = true, "Broken."
+			}),
+		},
+		{
+			label: "retracted, latest",
+			pkg: func() *internal.LegacyVersionedPackage {
+				vp := vpkg(sample.ModulePath, sample.Suffix, "")
+				vp.Retracted = true
+				return vp
+			}(),
+			linkVersion: true,
+			wantPkg: samplePackage(func(p *Package) {
+				p.LinkVersion = internal.LatestVersion
+				p.Retracted = true
+				p.AllVersionsRetracted = true
+			}),
+		},
 		{
 			label:       "command package",
 			pkg:         vpkg(sample.ModulePath, sample.Suffix, "main"),
@@ -241,3 +277,50 @@ func TestBreadcrumbPath(t *testing.T) {
 		})
 	}
 }
+
+func TestDeprecationParts(t *testing.T) {
+	for _, test := range []struct {
+		msg  string
+		want []link
+	}{
+		{"", nil},
+		{"no longer maintained", []link{{Body: "no longer maintained"}}},
+		{
+			"use example.com/new instead.",
+			[]link{
+				{Body: "use "},
+				{Href: "/example.com/new", Body: "example.com/new"},
+				{Body: " instead."},
+			},
+		},
+		{
+			"Moved (see github.com/a/b/v2), e.g. for v2.",
+			[]link{
+				{Body: "Moved ("},
+				{Href: "/github.com/a/b/v2", Body: "github.com/a/b/v2"},
+				{Body: "), e.g. for v2."},
+			},
+		},
+	} {
+		got := deprecationParts(test.msg)
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("deprecationParts(%q) mismatch (-want +got):\n%s", test.msg, diff)
+		}
+	}
+}
+
+func TestTruncatedPackages(t *testing.T) {
+	for _, test := range []struct {
+		processed, total int
+		want             string
+	}{
+		{0, 0, ""},
+		{10, 12, "10 of 12"},
+		{8000, 41000, "8,000 of 41,000"},
+		{999, 1234567, "999 of 1,234,567"},
+	} {
+		if got := truncatedPackages(test.processed, test.total); got != test.want {
+			t.Errorf("truncatedPackages(%d, %d) = %q, want %q", test.processed, test.total, got, test.want)
+		}
+	}
+}
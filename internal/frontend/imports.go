@@ -6,9 +6,11 @@ package frontend
 
 import (
 	"context"
+	"errors"
 	"strings"
 
 	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
 	"golang.org/x/pkgsite/internal/experiment"
 	"golang.org/x/pkgsite/internal/postgres"
 	"golang.org/x/pkgsite/internal/stdlib"
@@ -20,19 +22,47 @@ type ImportsDetails struct {
 
 	// ExternalImports is the collection of package imports that are not in
 	// the Go standard library and are not part of the same module
-	ExternalImports []string
+	ExternalImports []*Import
 
 	// InternalImports is an array of packages representing the package's
 	// imports that are part of the same module.
-	InternalImports []string
+	InternalImports []*Import
 
 	// StdLib is an array of packages representing the package's imports
 	// that are in the Go standard library.
-	StdLib []string
+	StdLib []*Import
+}
+
+// An Import is a package imported by the package of an imports tab.
+type Import struct {
+	Path string
+
+	// URL is the URL of the package page. It is empty if the package is
+	// not known, or is not redistributable; the path is then shown as plain
+	// text.
+	URL string
+
+	// ModulePath and ModuleURL describe the module that the package is
+	// currently in, for external imports.
+	ModulePath string
+	ModuleURL  string
+
+	// NotIndexed reports whether the package is not known, and
+	// NotRedistributable whether it is not redistributable.
+	NotIndexed         bool
+	NotRedistributable bool
+
+	// FetchURL, if non-empty, is the URL of the page from which a package
+	// that is not known can be fetched.
+	FetchURL string
 }
 
 // fetchImportsDetails fetches imports for the package version specified by
 // pkgPath, modulePath and version from the database and returns a ImportsDetails.
+//
+// If ds is a postgres.DB, the module that each external import is currently
+// in is looked up, and imports that are not known or not redistributable are
+// marked as such.
 func fetchImportsDetails(ctx context.Context, ds internal.DataSource, pkgPath, modulePath, resolvedVersion string) (_ *ImportsDetails, err error) {
 	var dsImports []string
 	if isActiveUseUnits(ctx) && experiment.IsActive(ctx, internal.ExperimentUsePackageImports) {
@@ -52,68 +82,117 @@ func fetchImportsDetails(ctx context.Context, ds internal.DataSource, pkgPath, m
 		}
 	}
 
-	var externalImports, moduleImports, std []string
+	var externalPaths, moduleImports, std []string
 	for _, p := range dsImports {
 		if stdlib.Contains(p) {
 			std = append(std, p)
 		} else if strings.HasPrefix(p+"/", modulePath+"/") {
 			moduleImports = append(moduleImports, p)
 		} else {
-			externalImports = append(externalImports, p)
+			externalPaths = append(externalPaths, p)
 		}
 	}
 
+	var externalImports []*Import
+	if db, ok := ds.(*postgres.DB); ok && len(externalPaths) > 0 {
+		pkgs, err := db.GetImportedPackages(ctx, externalPaths)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range externalPaths {
+			externalImports = append(externalImports, externalImport(ctx, p, pkgs[p]))
+		}
+	} else {
+		externalImports = linkedImports(externalPaths)
+	}
 	return &ImportsDetails{
 		ModulePath:      modulePath,
 		ExternalImports: externalImports,
-		InternalImports: moduleImports,
-		StdLib:          std,
+		InternalImports: linkedImports(moduleImports),
+		StdLib:          linkedImports(std),
 	}, nil
 }
 
+// linkedImports returns an Import linking to the page of each of paths.
+func linkedImports(paths []string) []*Import {
+	var imps []*Import
+	for _, p := range paths {
+		imps = append(imps, &Import{Path: p, URL: "/" + p})
+	}
+	return imps
+}
+
+// externalImport returns the Import for path, which is the path of pkg, or of
+// no known package if pkg is nil.
+func externalImport(ctx context.Context, path string, pkg *postgres.ImportedPackage) *Import {
+	imp := &Import{Path: path}
+	if pkg == nil {
+		imp.NotIndexed = true
+		if isActiveFrontendFetch(ctx) {
+			imp.FetchURL = "/" + path
+		}
+		return imp
+	}
+	imp.ModulePath = pkg.ModulePath
+	imp.ModuleURL = constructModuleURL(pkg.ModulePath, internal.LatestVersion)
+	if pkg.IsRedistributable {
+		imp.URL = "/" + path
+	} else {
+		imp.NotRedistributable = true
+	}
+	return imp
+}
+
 // ImportedByDetails contains information for the collection of packages that
 // import a given package.
 type ImportedByDetails struct {
 	ModulePath string
 
-	// ImportedBy is the collection of packages that import the
+	// ImportedBy is the collection of packages on this page that import the
 	// given package and are not part of the same module.
 	// They are organized into a tree of sections by prefix.
 	ImportedBy []*Section
 
-	Total        int  // number of packages in ImportedBy
-	TotalIsExact bool // if false, then there may be more than Total
+	// Total is the number of packages that import the given package, as last
+	// computed for search. It is zero if it is not known.
+	Total int
+
+	// Cursor is the cursor of this page, or empty for the first page.
+	Cursor string
+
+	// NextCursor is the cursor of the next page, or empty if this is the
+	// last page.
+	NextCursor string
 }
 
-const importedByLimit = 20001
+// importedByPageSize is the number of importers shown on each page of the
+// imported by tab.
+const importedByPageSize = 1000
 
-// etchImportedByDetails fetches importers for the package version specified by
-// path and version from the database and returns a ImportedByDetails.
-func fetchImportedByDetails(ctx context.Context, ds internal.DataSource, pkgPath, modulePath string) (*ImportedByDetails, error) {
-	db, ok := ds.(*postgres.DB)
-	if !ok {
+// fetchImportedByDetails fetches the page of importers of the package with
+// pkgPath that follows cursor, and returns a ImportedByDetails. The first page
+// is fetched if cursor is empty.
+func fetchImportedByDetails(ctx context.Context, ds internal.DataSource, pkgPath, modulePath, cursor string) (*ImportedByDetails, error) {
+	importedBy, nextCursor, err := ds.GetImportedBy(ctx, pkgPath, modulePath, cursor, importedByPageSize)
+	if errors.Is(err, derrors.Unsupported) {
 		// The proxydatasource does not support the imported by page.
 		return nil, proxydatasourceNotSupportedErr()
 	}
-
-	importedBy, err := db.GetImportedBy(ctx, pkgPath, modulePath, importedByLimit)
 	if err != nil {
 		return nil, err
 	}
-	// If we reached the query limit, then we don't know the total.
-	// Say so, and show one less than the limit.
-	// For example, if the limit is 101 and we get 101 results, then we'll
-	// say there are more than 100, and show the first 100.
-	totalIsExact := true
-	if len(importedBy) == importedByLimit {
-		importedBy = importedBy[:len(importedBy)-1]
-		totalIsExact = false
+	// The count is computed periodically rather than from the importers, so
+	// that the tab does not need to read all of them.
+	total, err := ds.GetImportedByCount(ctx, pkgPath)
+	if err != nil && !errors.Is(err, derrors.NotFound) {
+		return nil, err
 	}
 	sections := Sections(importedBy, nextPrefixAccount)
 	return &ImportedByDetails{
-		ModulePath:   modulePath,
-		ImportedBy:   sections,
-		Total:        len(importedBy),
-		TotalIsExact: totalIsExact,
+		ModulePath: modulePath,
+		ImportedBy: sections,
+		Total:      total,
+		Cursor:     cursor,
+		NextCursor: nextCursor,
 	}, nil
 }
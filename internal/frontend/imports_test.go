@@ -16,6 +16,20 @@ import (
 )
 
 func TestFetchImportsDetails(t *testing.T) {
+	nonRedist := sample.Module("github.com/nonredist/mod", sample.VersionString, "pkg")
+	nonRedist.IsRedistributable = false
+	for _, u := range nonRedist.Units {
+		u.IsRedistributable = false
+	}
+	for _, p := range nonRedist.LegacyPackages {
+		p.IsRedistributable = false
+	}
+	otherModules := []*internal.Module{
+		sample.Module("github.com/other/mod", "v1.0.0", "pkg"),
+		sample.Module("github.com/other/mod", "v1.1.0", "pkg"),
+		nonRedist,
+	}
+
 	for _, tc := range []struct {
 		name        string
 		imports     []string
@@ -29,17 +43,43 @@ func TestFetchImportsDetails(t *testing.T) {
 				"context",
 			},
 			wantDetails: &ImportsDetails{
-				ExternalImports: []string{"pa.th/import/1"},
-				InternalImports: []string{sample.PackagePath},
-				StdLib:          []string{"context"},
+				ExternalImports: []*Import{{Path: "pa.th/import/1", NotIndexed: true}},
+				InternalImports: []*Import{{Path: sample.PackagePath, URL: "/" + sample.PackagePath}},
+				StdLib:          []*Import{{Path: "context", URL: "/context"}},
 			},
 		},
 		{
 			name:    "want expected imports details with multiple",
 			imports: []string{"pa.th/import/1", "pa.th/import/2", "pa.th/import/3"},
 			wantDetails: &ImportsDetails{
-				ExternalImports: []string{"pa.th/import/1", "pa.th/import/2", "pa.th/import/3"},
-				StdLib:          nil,
+				ExternalImports: []*Import{
+					{Path: "pa.th/import/1", NotIndexed: true},
+					{Path: "pa.th/import/2", NotIndexed: true},
+					{Path: "pa.th/import/3", NotIndexed: true},
+				},
+				StdLib: nil,
+			},
+		},
+		{
+			name:    "want external imports resolved to their modules",
+			imports: []string{"github.com/other/mod/pkg", "github.com/nonredist/mod/pkg", "github.com/other/mod"},
+			wantDetails: &ImportsDetails{
+				ExternalImports: []*Import{
+					{
+						Path:       "github.com/other/mod/pkg",
+						URL:        "/github.com/other/mod/pkg",
+						ModulePath: "github.com/other/mod",
+						ModuleURL:  "/mod/github.com/other/mod",
+					},
+					{
+						Path:               "github.com/nonredist/mod/pkg",
+						ModulePath:         "github.com/nonredist/mod",
+						ModuleURL:          "/mod/github.com/nonredist/mod",
+						NotRedistributable: true,
+					},
+					// The module root is not a package.
+					{Path: "github.com/other/mod", NotIndexed: true},
+				},
 			},
 		},
 	} {
@@ -52,8 +92,10 @@ func TestFetchImportsDetails(t *testing.T) {
 			module := sample.Module(sample.ModulePath, sample.VersionString, sample.Suffix)
 			module.LegacyPackages[0].Imports = tc.imports
 
-			if err := testDB.InsertModule(ctx, module); err != nil {
-				t.Fatal(err)
+			for _, m := range append(otherModules, module) {
+				if err := testDB.InsertModule(ctx, m); err != nil {
+					t.Fatal(err)
+				}
 			}
 
 			pkg := firstVersionedPackage(module)
@@ -113,6 +155,9 @@ func TestFetchImportedByDetails(t *testing.T) {
 			t.Fatal(err)
 		}
 	}
+	if _, err := testDB.UpdateSearchDocumentsImportedByCount(ctx); err != nil {
+		t.Fatal(err)
+	}
 
 	for _, tc := range []struct {
 		pkg         *internal.LegacyPackage
@@ -120,14 +165,13 @@ func TestFetchImportedByDetails(t *testing.T) {
 	}{
 		{
 			pkg:         pkg3,
-			wantDetails: &ImportedByDetails{TotalIsExact: true},
+			wantDetails: &ImportedByDetails{},
 		},
 		{
 			pkg: pkg2,
 			wantDetails: &ImportedByDetails{
-				ImportedBy:   []*Section{{Prefix: pkg3.Path, NumLines: 0}},
-				Total:        1,
-				TotalIsExact: true,
+				ImportedBy: []*Section{{Prefix: pkg3.Path, NumLines: 0}},
+				Total:      1,
 			},
 		},
 		{
@@ -137,8 +181,7 @@ func TestFetchImportedByDetails(t *testing.T) {
 					{Prefix: pkg2.Path, NumLines: 0},
 					{Prefix: pkg3.Path, NumLines: 0},
 				},
-				Total:        2,
-				TotalIsExact: true,
+				Total: 2,
 			},
 		},
 	} {
@@ -146,7 +189,7 @@ func TestFetchImportedByDetails(t *testing.T) {
 			otherVersion := newModule(path.Dir(tc.pkg.Path), tc.pkg)
 			otherVersion.Version = "v1.0.5"
 			vp := firstVersionedPackage(otherVersion)
-			got, err := fetchImportedByDetails(ctx, testDB, vp.Path, vp.ModulePath)
+			got, err := fetchImportedByDetails(ctx, testDB, vp.Path, vp.ModulePath, "")
 			if err != nil {
 				t.Fatalf("fetchImportedByDetails(ctx, db, %q) = %v err = %v, want %v",
 					tc.pkg.Path, got, err, tc.wantDetails)
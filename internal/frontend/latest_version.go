@@ -7,28 +7,23 @@ package frontend
 import (
 	"context"
 	"errors"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/golang/groupcache/lru"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/derrors"
 	"golang.org/x/pkgsite/internal/experiment"
 	"golang.org/x/pkgsite/internal/log"
+	"golang.org/x/pkgsite/internal/postgres"
+	"golang.org/x/pkgsite/internal/stdlib"
 )
 
-// GetLatestMajorVersion returns the major version of a package or module.
-// If a module isn't found from the series path or an error ocurs, an empty string is returned
-// It is intended to be used as an argument to middleware.LatestVersions.
-func (s *Server) GetLatestMajorVersion(ctx context.Context, seriesPath string) string {
-	mv, err := s.getDataSource(ctx).GetLatestMajorVersion(ctx, seriesPath)
-	if err != nil {
-		if !errors.Is(err, derrors.NotFound) {
-			log.Errorf(ctx, "GetLatestMajorVersion: %v", err)
-		}
-		return ""
-	}
-
-	return mv
-}
-
 // GetLatestMinorVersion returns the latest minor version of the package or module.
 // The linkable form of the minor version is returned and is an empty string on error.
 // It is intended to be used as an argument to middleware.LatestVersions.
@@ -82,3 +77,173 @@ func latestMinorVersion(ctx context.Context, ds internal.DataSource, packagePath
 	}
 	return linkVersion(mi.Version, modulePath), nil
 }
+
+// LatestMajorVersion describes the highest major version of a module series,
+// when it is higher than that of the page being served.
+type LatestMajorVersion struct {
+	// Display is the module path of the highest major version, with its
+	// version if the major version is that of a +incompatible version.
+	Display string
+	// URL is the URL of the unit with the same path in the highest major
+	// version, or of its module root if there is no such unit.
+	URL string
+}
+
+// seriesCacheSize is the number of series whose module versions are cached,
+// and seriesCacheTTL is how long they are cached for.
+const (
+	seriesCacheSize = 10000
+	seriesCacheTTL  = shortTTL
+)
+
+// seriesCache is an LRU cache of the module versions in each module series.
+type seriesCache struct {
+	mu    sync.Mutex
+	cache *lru.Cache
+}
+
+type seriesCacheEntry struct {
+	modvers []internal.Modver
+	expires time.Time
+}
+
+func newSeriesCache(size int) *seriesCache {
+	return &seriesCache{cache: lru.New(size)}
+}
+
+// get returns the cached module versions of seriesPath, and reports whether
+// they had not expired.
+func (c *seriesCache) get(seriesPath string) ([]internal.Modver, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.cache.Get(seriesPath)
+	if !ok {
+		return nil, false
+	}
+	e := v.(*seriesCacheEntry)
+	if time.Now().After(e.expires) {
+		c.cache.Remove(seriesPath)
+		return nil, false
+	}
+	return e.modvers, true
+}
+
+// put caches modvers as the module versions of seriesPath.
+func (c *seriesCache) put(seriesPath string, modvers []internal.Modver) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache.Add(seriesPath, &seriesCacheEntry{
+		modvers: modvers,
+		expires: time.Now().Add(seriesCacheTTL),
+	})
+}
+
+// latestMajorVersion returns the LatestMajorVersion for the unit with
+// fullPath in the module with modulePath at version, or nil if the module is
+// at the highest major version of its series. Errors are logged, and result
+// in nil.
+func (s *Server) latestMajorVersion(ctx context.Context, ds internal.DataSource, fullPath, modulePath, version string) *LatestMajorVersion {
+	if modulePath == stdlib.ModulePath {
+		return nil
+	}
+	lmv, err := latestMajorVersion(ctx, ds, s.seriesCache, fullPath, modulePath, version)
+	if err != nil {
+		log.Errorf(ctx, "latestMajorVersion: %v", err)
+		return nil
+	}
+	return lmv
+}
+
+func latestMajorVersion(ctx context.Context, ds internal.DataSource, cache *seriesCache, fullPath, modulePath, version string) (_ *LatestMajorVersion, err error) {
+	defer derrors.Wrap(&err, "latestMajorVersion(%q, %q, %q)", fullPath, modulePath, version)
+
+	seriesPath := internal.SeriesPathForModule(modulePath)
+	modvers, ok := cache.get(seriesPath)
+	if !ok {
+		modvers, err = seriesModuleVersions(ctx, ds, seriesPath)
+		if err != nil {
+			return nil, err
+		}
+		cache.put(seriesPath, modvers)
+	}
+	highest, ok := highestMajorVersion(modvers)
+	if !ok || majorVersion(highest) <= majorVersion(internal.Modver{Path: modulePath, Version: version}) {
+		return nil, nil
+	}
+
+	lmv := &LatestMajorVersion{Display: highest.Path}
+	// The latest version of a module is preferred to its +incompatible
+	// versions, so link to those explicitly.
+	v := internal.LatestVersion
+	if isIncompatible(highest.Version) {
+		v = highest.Version
+		lmv.Display += "@" + highest.Version
+	}
+	unitPath := path.Join(highest.Path, internal.Suffix(fullPath, modulePath))
+	if _, err := ds.GetUnitMeta(ctx, unitPath, highest.Path, v); err != nil {
+		if !errors.Is(err, derrors.NotFound) {
+			return nil, err
+		}
+		unitPath = highest.Path
+	}
+	lmv.URL = constructPackageURL(unitPath, highest.Path, v)
+	return lmv, nil
+}
+
+// seriesModuleVersions returns the latest versions of the modules in the
+// series with seriesPath. Only the database knows about +incompatible
+// versions; other data sources just report the latest major version.
+func seriesModuleVersions(ctx context.Context, ds internal.DataSource, seriesPath string) ([]internal.Modver, error) {
+	if db, ok := ds.(*postgres.DB); ok {
+		return db.GetSeriesModuleVersions(ctx, seriesPath)
+	}
+	major, err := ds.GetLatestMajorVersion(ctx, seriesPath)
+	if errors.Is(err, derrors.NotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []internal.Modver{{Path: seriesPath + major, Version: internal.LatestVersion}}, nil
+}
+
+// highestMajorVersion returns the module version of modvers with the highest
+// major version. Of two with the same major version, the one whose module
+// path has the major version is preferred to a +incompatible version. It
+// reports false if modvers is empty.
+func highestMajorVersion(modvers []internal.Modver) (internal.Modver, bool) {
+	var (
+		highest internal.Modver
+		found   bool
+	)
+	for _, mv := range modvers {
+		if !found || majorVersion(mv) > majorVersion(highest) ||
+			(majorVersion(mv) == majorVersion(highest) && isIncompatible(highest.Version) && !isIncompatible(mv.Version)) {
+			highest = mv
+			found = true
+		}
+	}
+	return highest, found
+}
+
+// majorVersion returns the major version of mv: that of its module path,
+// like "/v3" or ".v3" for gopkg.in paths, or of a +incompatible version. It
+// is 1 for other versions of module paths without one, which may be at v0 or
+// v1.
+func majorVersion(mv internal.Modver) int {
+	_, pathMajor, _ := module.SplitPathVersion(mv.Path)
+	if pathMajor != "" {
+		// Trim the "/" or "." separator, and gopkg.in's "-unstable" suffix.
+		m := strings.TrimSuffix(strings.TrimLeft(pathMajor, "/."), "-unstable")
+		if n, err := strconv.Atoi(strings.TrimPrefix(m, "v")); err == nil && n > 1 {
+			return n
+		}
+		return 1
+	}
+	if isIncompatible(mv.Version) {
+		if n, err := strconv.Atoi(strings.TrimPrefix(semver.Major(mv.Version), "v")); err == nil {
+			return n
+		}
+	}
+	return 1
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+func TestMajorVersion(t *testing.T) {
+	for _, test := range []struct {
+		path, version string
+		want          int
+	}{
+		{"github.com/foo/bar", "v0.1.0", 1},
+		{"github.com/foo/bar", "v1.2.3", 1},
+		{"github.com/foo/bar", "v3.0.0+incompatible", 3},
+		{"github.com/foo/bar/v2", "v2.0.0", 2},
+		{"github.com/foo/bar/v10", "v10.1.0", 10},
+		{"gopkg.in/yaml.v1", "v1.0.0", 1},
+		{"gopkg.in/yaml.v3", "v3.0.0", 3},
+		{"gopkg.in/yaml.v4-unstable", "v4.0.0", 4},
+	} {
+		if got := majorVersion(internal.Modver{Path: test.path, Version: test.version}); got != test.want {
+			t.Errorf("majorVersion(%s@%s) = %d, want %d", test.path, test.version, got, test.want)
+		}
+	}
+}
+
+func TestHighestMajorVersion(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		modvers []internal.Modver
+		want    internal.Modver
+	}{
+		{
+			name: "path major",
+			modvers: []internal.Modver{
+				{Path: "github.com/foo/bar", Version: "v1.2.0"},
+				{Path: "github.com/foo/bar/v3", Version: "v3.1.0"},
+				{Path: "github.com/foo/bar/v2", Version: "v2.0.0"},
+			},
+			want: internal.Modver{Path: "github.com/foo/bar/v3", Version: "v3.1.0"},
+		},
+		{
+			name: "incompatible",
+			modvers: []internal.Modver{
+				{Path: "github.com/foo/bar", Version: "v1.2.0"},
+				{Path: "github.com/foo/bar", Version: "v4.0.0+incompatible"},
+				{Path: "github.com/foo/bar/v3", Version: "v3.1.0"},
+			},
+			want: internal.Modver{Path: "github.com/foo/bar", Version: "v4.0.0+incompatible"},
+		},
+		{
+			name: "path major preferred to incompatible",
+			modvers: []internal.Modver{
+				{Path: "github.com/foo/bar", Version: "v3.0.0+incompatible"},
+				{Path: "github.com/foo/bar/v3", Version: "v3.1.0"},
+			},
+			want: internal.Modver{Path: "github.com/foo/bar/v3", Version: "v3.1.0"},
+		},
+		{
+			name: "gopkg.in",
+			modvers: []internal.Modver{
+				{Path: "gopkg.in/yaml.v2", Version: "v2.4.0"},
+				{Path: "gopkg.in/yaml.v3", Version: "v3.0.0"},
+				{Path: "gopkg.in/yaml.v1", Version: "v1.0.0"},
+			},
+			want: internal.Modver{Path: "gopkg.in/yaml.v3", Version: "v3.0.0"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := highestMajorVersion(test.modvers)
+			if !ok {
+				t.Fatal("got false, want true")
+			}
+			if got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+	if _, ok := highestMajorVersion(nil); ok {
+		t.Error("empty: got true, want false")
+	}
+}
+
+// majorVersionDataSource is an internal.DataSource with a latest major
+// version and a set of units. Its other methods are unimplemented.
+type majorVersionDataSource struct {
+	internal.DataSource
+	latestMajor string
+	units       map[string]bool
+	calls       int
+}
+
+func (ds *majorVersionDataSource) GetLatestMajorVersion(context.Context, string) (string, error) {
+	ds.calls++
+	return ds.latestMajor, nil
+}
+
+func (ds *majorVersionDataSource) GetUnitMeta(_ context.Context, path, modulePath, version string) (*internal.UnitMeta, error) {
+	if !ds.units[path] {
+		return nil, derrors.NotFound
+	}
+	return &internal.UnitMeta{Path: path, ModulePath: modulePath, Version: version}, nil
+}
+
+func TestLatestMajorVersion(t *testing.T) {
+	ctx := context.Background()
+	ds := &majorVersionDataSource{
+		latestMajor: "/v3",
+		units: map[string]bool{
+			"github.com/foo/bar/v3":     true,
+			"github.com/foo/bar/v3/pkg": true,
+		},
+	}
+	cache := newSeriesCache(10)
+	for _, test := range []struct {
+		fullPath, modulePath, version string
+		want                          *LatestMajorVersion
+	}{
+		{
+			"github.com/foo/bar/pkg", "github.com/foo/bar", "v1.0.0",
+			&LatestMajorVersion{Display: "github.com/foo/bar/v3", URL: "/github.com/foo/bar/v3/pkg"},
+		},
+		{
+			// The package was removed in v3.
+			"github.com/foo/bar/v2/old", "github.com/foo/bar/v2", "v2.0.0",
+			&LatestMajorVersion{Display: "github.com/foo/bar/v3", URL: "/github.com/foo/bar/v3"},
+		},
+		{
+			"github.com/foo/bar", "github.com/foo/bar", "v0.1.0",
+			&LatestMajorVersion{Display: "github.com/foo/bar/v3", URL: "/github.com/foo/bar/v3"},
+		},
+		{"github.com/foo/bar/v3/pkg", "github.com/foo/bar/v3", "v3.0.0", nil},
+	} {
+		got, err := latestMajorVersion(ctx, ds, cache, test.fullPath, test.modulePath, test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("%s@%s: mismatch (-want, +got):\n%s", test.fullPath, test.version, diff)
+		}
+	}
+	// The series is looked up once.
+	if ds.calls != 1 {
+		t.Errorf("got %d lookups of the series, want 1", ds.calls)
+	}
+}
@@ -19,9 +19,10 @@ import (
 // from pkg.
 func legacyFetchDocumentationDetails(pkg *internal.LegacyVersionedPackage) *DocumentationDetails {
 	return &DocumentationDetails{
-		GOOS:          pkg.GOOS,
-		GOARCH:        pkg.GOARCH,
-		Documentation: pkg.DocumentationHTML,
+		GOOS:               pkg.GOOS,
+		GOARCH:             pkg.GOARCH,
+		Documentation:      pkg.DocumentationHTML,
+		BuildFailureReason: pkg.BuildFailureReason,
 	}
 }
 
@@ -70,7 +71,7 @@ func legacyFetchDirectoryDetails(ctx context.Context, ds internal.DataSource, di
 		}, licmetas, includeDirPath)
 	}
 
-	dbDir, err := ds.LegacyGetDirectory(ctx, dirPath, mi.ModulePath, mi.Version, internal.AllFields)
+	dbDir, err := ds.LegacyGetDirectory(ctx, dirPath, mi.ModulePath, mi.Version, internal.MinimalFields)
 	if errors.Is(err, derrors.NotFound) {
 		return legacyCreateDirectory(&internal.LegacyDirectory{
 			LegacyModuleInfo: internal.LegacyModuleInfo{ModuleInfo: *mi},
@@ -91,14 +92,13 @@ func legacyFetchPackageVersionsDetails(ctx context.Context, ds internal.DataSour
 	if err != nil {
 		return nil, err
 	}
-	// If no tagged versions for the package series are found, fetch the
-	// pseudo-versions instead.
-	if len(versions) == 0 {
-		versions, err = ds.LegacyGetPsuedoVersionsForPackageSeries(ctx, pkgPath)
-		if err != nil {
-			return nil, err
-		}
+	// The pseudo-versions are folded after the tagged versions of their
+	// version lists.
+	pseudo, err := ds.LegacyGetPsuedoVersionsForPackageSeries(ctx, pkgPath)
+	if err != nil {
+		return nil, err
 	}
+	versions = append(versions, pseudo...)
 
 	linkify := func(mi *internal.ModuleInfo) string {
 		// Here we have only version information, but need to construct the full
@@ -111,7 +111,7 @@ func legacyFetchPackageVersionsDetails(ctx context.Context, ds internal.DataSour
 		}
 		return constructPackageURL(versionPath, mi.ModulePath, linkVersion(mi.Version, mi.ModulePath))
 	}
-	return buildVersionDetails(modulePath, versions, linkify), nil
+	return buildVersionDetails(modulePath, versions, linkify, nil), nil
 }
 
 // legacyFetchPackageLicensesDetails fetches license data for the package version specified by
@@ -121,5 +121,5 @@ func legacyFetchPackageLicensesDetails(ctx context.Context, ds internal.DataSour
 	if err != nil {
 		return nil, err
 	}
-	return &LicensesDetails{Licenses: transformLicenses(modulePath, resolvedVersion, dsLicenses)}, nil
+	return &LicensesDetails{Licenses: transformLicenses(modulePath, resolvedVersion, nil, dsLicenses)}, nil
 }
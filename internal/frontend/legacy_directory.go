@@ -53,7 +53,9 @@ func (s *Server) legacyServeDirectoryPage(ctx context.Context, w http.ResponseWr
 			dbDir.ModulePath,
 			linkVersion(dbDir.Version, dbDir.ModulePath),
 		),
+		LatestMajor: s.latestMajorVersion(ctx, ds, dbDir.Path, dbDir.ModulePath, dbDir.Version),
 	}
+	page.basePage.Social = unitSocialMetadata(r, page.HTMLTitle, dbDir.Path, "", dbDir.IsRedistributable)
 	s.servePage(ctx, w, settings.TemplateName, page)
 	return nil
 }
@@ -66,5 +68,5 @@ func legacyCreateDirectory(dbDir *internal.LegacyDirectory, licmetas []*licenses
 		newPkg := packageMetaFromLegacyPackage(pkg)
 		packages = append(packages, newPkg)
 	}
-	return createDirectory(dbDir.Path, &dbDir.ModuleInfo, packages, nil, licmetas, includeDirPath)
+	return createDirectory(dbDir.Path, &dbDir.ModuleInfo, packages, licmetas, includeDirPath)
 }
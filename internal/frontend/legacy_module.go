@@ -41,7 +41,7 @@ func (s *Server) legacyServeModulePage(w http.ResponseWriter, r *http.Request, d
 	if requestedVersion != internal.LatestVersion {
 		_, err = ds.LegacyGetModuleInfo(ctx, modulePath, internal.LatestVersion)
 		if err == nil {
-			return pathFoundAtLatestError(ctx, "module", modulePath, displayVersion(requestedVersion, modulePath))
+			return pathFoundAtLatestError(ctx, "module", modulePath, requestedVersion)
 		}
 		if !errors.Is(err, derrors.NotFound) {
 			log.Errorf(ctx, "error checking for latest module: %v", err)
@@ -91,7 +91,10 @@ func (s *Server) legacyServeModulePageWithModule(ctx context.Context, w http.Res
 			mi.ModulePath,
 			linkVersion(mi.Version, mi.ModulePath),
 		),
+		LatestMajor: s.latestMajorVersion(ctx, ds, mi.ModulePath, mi.ModulePath, mi.Version),
+		Vulns:       vulnsForUnit(ctx, ds, "", mi.ModulePath, mi.Version),
 	}
+	page.basePage.Social = unitSocialMetadata(r, page.HTMLTitle, mi.ModulePath, "", mi.IsRedistributable)
 	s.servePage(ctx, w, settings.TemplateName, page)
 	return nil
 }
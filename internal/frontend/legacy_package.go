@@ -37,7 +37,7 @@ func (s *Server) legacyServePackagePage(w http.ResponseWriter, r *http.Request,
 		// If we've already checked the latest version, then we know that this path
 		// is not a package at any version, so just skip ahead and serve the
 		// directory page.
-		dbDir, err := ds.LegacyGetDirectory(ctx, pkgPath, modulePath, resolvedVersion, internal.AllFields)
+		dbDir, err := ds.LegacyGetDirectory(ctx, pkgPath, modulePath, resolvedVersion, internal.WithReadme)
 		if err != nil {
 			if errors.Is(err, derrors.NotFound) {
 				return pathNotFoundError(ctx, "package", pkgPath, requestedVersion)
@@ -46,7 +46,7 @@ func (s *Server) legacyServePackagePage(w http.ResponseWriter, r *http.Request,
 		}
 		return s.legacyServeDirectoryPage(ctx, w, r, ds, dbDir, requestedVersion)
 	}
-	dir, err := ds.LegacyGetDirectory(ctx, pkgPath, modulePath, resolvedVersion, internal.AllFields)
+	dir, err := ds.LegacyGetDirectory(ctx, pkgPath, modulePath, resolvedVersion, internal.WithReadme)
 	if err == nil {
 		return s.legacyServeDirectoryPage(ctx, w, r, ds, dir, requestedVersion)
 	}
@@ -133,8 +133,11 @@ func (s *Server) legacyServePackagePageWithPackage(w http.ResponseWriter, r *htt
 			pkg.ModulePath,
 			linkVersion(pkg.Version, pkg.ModulePath),
 		),
+		LatestMajor: s.latestMajorVersion(r.Context(), ds, pkg.Path, pkg.ModulePath, pkg.Version),
+		Vulns:       vulnsForUnit(r.Context(), ds, pkg.Path, pkg.ModulePath, pkg.Version),
 	}
 	page.basePage.AllowWideContent = tab == tabDoc
+	page.basePage.Social = unitSocialMetadata(r, page.HTMLTitle, pkg.Path, pkg.Synopsis, pkg.IsRedistributable)
 	s.servePage(r.Context(), w, settings.TemplateName, page)
 	return nil
 }
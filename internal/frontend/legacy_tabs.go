@@ -10,7 +10,6 @@ import (
 
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/licenses"
-	"golang.org/x/pkgsite/internal/postgres"
 )
 
 // legacyFetchDetailsForModule returns tab details by delegating to the correct detail
@@ -21,9 +20,9 @@ func legacyFetchDetailsForModule(r *http.Request, tab string, ds internal.DataSo
 	case "packages":
 		return legacyFetchDirectoryDetails(ctx, ds, mi.ModulePath, mi, licensesToMetadatas(licenses), true)
 	case tabLicenses:
-		return &LicensesDetails{Licenses: transformLicenses(mi.ModulePath, mi.Version, licenses)}, nil
+		return &LicensesDetails{Licenses: transformLicenses(mi.ModulePath, mi.Version, mi.SourceInfo, licenses)}, nil
 	case tabVersions:
-		return fetchModuleVersionsDetails(ctx, ds, mi.ModulePath)
+		return fetchModuleVersionsDetails(ctx, ds, mi.ModulePath, r.FormValue("devel") == "1")
 	case tabOverview:
 		return constructOverviewDetails(ctx, mi, readme, mi.IsRedistributable, urlIsVersioned(r.URL))
 	}
@@ -45,7 +44,7 @@ func legacyFetchDetailsForDirectory(r *http.Request, tab string, dir *internal.L
 		// postgres.GetUnit again.
 		return legacyCreateDirectory(dir, licensesToMetadatas(licenses), false)
 	case tabLicenses:
-		return &LicensesDetails{Licenses: transformLicenses(dir.ModulePath, dir.Version, licenses)}, nil
+		return &LicensesDetails{Licenses: transformLicenses(dir.ModulePath, dir.Version, dir.SourceInfo, licenses)}, nil
 	}
 	return nil, fmt.Errorf("BUG: unable to fetch details: unknown tab %q", tab)
 }
@@ -64,12 +63,7 @@ func legacyFetchDetailsForPackage(r *http.Request, tab string, ds internal.DataS
 	case tabImports:
 		return fetchImportsDetails(ctx, ds, pkg.Path, pkg.ModulePath, pkg.Version)
 	case tabImportedBy:
-		db, ok := ds.(*postgres.DB)
-		if !ok {
-			// The proxydatasource does not support the imported by page.
-			return nil, proxydatasourceNotSupportedErr()
-		}
-		return fetchImportedByDetails(ctx, db, pkg.Path, pkg.ModulePath)
+		return fetchImportedByDetails(ctx, ds, pkg.Path, pkg.ModulePath, r.FormValue("cursor"))
 	case tabLicenses:
 		return legacyFetchPackageLicensesDetails(ctx, ds, pkg.Path, pkg.ModulePath, pkg.Version)
 	case tabOverview:
@@ -7,12 +7,15 @@ package frontend
 import (
 	"bytes"
 	"context"
+	"regexp"
 	"sort"
 	"strconv"
 
 	"github.com/google/safehtml"
+	"github.com/google/safehtml/uncheckedconversions"
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/licenses"
+	"golang.org/x/pkgsite/internal/source"
 )
 
 // License contains information used for a single license section.
@@ -20,6 +23,15 @@ type License struct {
 	*licenses.License
 	Anchor safehtml.Identifier
 	Source string
+	// SourceURL is a link to the license file in the module's repository,
+	// if known.
+	SourceURL string
+}
+
+// CoveragePercent returns the percentage of the license file's text that
+// was matched by a known license, rounded down to an integer.
+func (l License) CoveragePercent() int {
+	return int(l.Coverage.Percent)
 }
 
 // LicensesDetails contains license information for a package or module.
@@ -41,12 +53,13 @@ func fetchLicensesDetails(ctx context.Context, ds internal.DataSource, um *inter
 	if err != nil {
 		return nil, err
 	}
-	return &LicensesDetails{Licenses: transformLicenses(um.ModulePath, um.Version, u.LicenseContents)}, nil
+	return &LicensesDetails{Licenses: transformLicenses(um.ModulePath, um.Version, um.SourceInfo, u.LicenseContents)}, nil
 }
 
 // transformLicenses transforms licenses.License into a License
-// by adding an anchor field.
-func transformLicenses(modulePath, requestedVersion string, dbLicenses []*licenses.License) []License {
+// by adding anchor and source fields. info may be nil, in which case
+// the licenses have no SourceURL.
+func transformLicenses(modulePath, requestedVersion string, info *source.Info, dbLicenses []*licenses.License) []License {
 	licenses := make([]License, len(dbLicenses))
 	var filePaths []string
 	for _, l := range dbLicenses {
@@ -56,9 +69,10 @@ func transformLicenses(modulePath, requestedVersion string, dbLicenses []*licens
 	for i, l := range dbLicenses {
 		l.Contents = bytes.ReplaceAll(l.Contents, []byte("\r"), nil)
 		licenses[i] = License{
-			Anchor:  anchors[i],
-			License: l,
-			Source:  fileSource(modulePath, requestedVersion, l.FilePath),
+			Anchor:    anchors[i],
+			License:   l,
+			Source:    fileSource(modulePath, requestedVersion, l.FilePath),
+			SourceURL: info.FileURL(l.FilePath),
 		}
 	}
 	return licenses
@@ -88,6 +102,10 @@ func transformLicenseMetadata(dbLicenses []*licenses.Metadata) []LicenseMetadata
 // licenseAnchors returns anchors (HTML identifiers) for all the paths, in the
 // same order. If the paths are unique, it ensures that the resulting anchors
 // are unique. The argument is modified.
+//
+// Where possible, the anchor is the file path itself, so that a license can be
+// linked to as ?tab=licenses#LICENSE.md. Paths that can't be used as an
+// identifier get an anchor based on their position in sorted order.
 func licenseAnchors(paths []string) []safehtml.Identifier {
 	// Remember the original index of each path.
 	index := map[string]int{}
@@ -99,11 +117,23 @@ func licenseAnchors(paths []string) []safehtml.Identifier {
 	sort.Strings(paths)
 	ids := make([]safehtml.Identifier, len(paths))
 	for i, p := range paths {
-		ids[index[p]] = safehtml.IdentifierFromConstantPrefix("lic", strconv.Itoa(i))
+		if licenseAnchorRegexp.MatchString(p) {
+			// The regexp only admits characters that are safe in an id
+			// attribute and cannot collide with the generated "lic-N" anchors.
+			ids[index[p]] = uncheckedconversions.IdentifierFromStringKnownToSatisfyTypeContract(p)
+		} else {
+			ids[index[p]] = safehtml.IdentifierFromConstantPrefix("lic", strconv.Itoa(i))
+		}
 	}
 	return ids
 }
 
+// licenseAnchorRegexp matches license file paths that can be used directly
+// as an anchor: files at the module root whose names begin with an
+// upper-case letter, as all of licenses.FileNames do. That distinguishes them
+// from "lic-N".
+var licenseAnchorRegexp = regexp.MustCompile(`^[A-Z][-_.A-Za-z0-9]*$`)
+
 // licensesToMetadatas converts a slice of Licenses to a slice of Metadatas.
 func licensesToMetadatas(lics []*licenses.License) []*licenses.Metadata {
 	var ms []*licenses.Metadata
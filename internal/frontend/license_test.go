@@ -12,10 +12,12 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/licensecheck"
 	"github.com/google/safehtml"
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/licenses"
 	"golang.org/x/pkgsite/internal/postgres"
+	"golang.org/x/pkgsite/internal/source"
 	"golang.org/x/pkgsite/internal/stdlib"
 	"golang.org/x/pkgsite/internal/testing/sample"
 	"golang.org/x/pkgsite/internal/testing/testhelper"
@@ -25,10 +27,13 @@ func TestLicenseAnchors(t *testing.T) {
 	for _, test := range []struct {
 		in, want []string
 	}{
-		{[]string{"L.md"}, []string{"lic-0"}},
-		// Identifiers are distinguished by the position in the sorted list.
-		{[]string{"L.md", "L_md"}, []string{"lic-0", "lic-1"}},
-		{[]string{"L_md", "L.md"}, []string{"lic-1", "lic-0"}},
+		{[]string{"L.md"}, []string{"L.md"}},
+		{[]string{"A/B/LICENSE", "LICENSE"}, []string{"lic-0", "LICENSE"}},
+		// Paths that can't be used as identifiers are distinguished by the
+		// position in the sorted list.
+		{[]string{"l.md", "l_md"}, []string{"lic-0", "lic-1"}},
+		{[]string{"l_md", "l.md"}, []string{"lic-1", "lic-0"}},
+		{[]string{"LICENSE", "a b", "license"}, []string{"LICENSE", "lic-1", "lic-2"}},
 	} {
 		gotIDs := licenseAnchors(test.in)
 		if len(test.want) != len(gotIDs) {
@@ -43,6 +48,35 @@ func TestLicenseAnchors(t *testing.T) {
 	}
 }
 
+func TestTransformLicenses(t *testing.T) {
+	mit := &licenses.License{
+		Metadata: &licenses.Metadata{
+			Types:    []string{"MIT"},
+			FilePath: "LICENSE.md",
+			Coverage: licensecheck.Coverage{Percent: 99.5},
+		},
+		Contents: []byte("a\r\nb"),
+	}
+	info := source.NewGitHubInfo("https://github.com/some/repo", "", "v1.2.3")
+	got := transformLicenses("github.com/some/repo", "v1.2.3", info, []*licenses.License{mit})
+	if len(got) != 1 {
+		t.Fatalf("got %d licenses, want 1", len(got))
+	}
+	l := got[0]
+	if got, want := l.Anchor.String(), "LICENSE.md"; got != want {
+		t.Errorf("Anchor = %q, want %q", got, want)
+	}
+	if got, want := l.SourceURL, "https://github.com/some/repo/blob/v1.2.3/LICENSE.md"; got != want {
+		t.Errorf("SourceURL = %q, want %q", got, want)
+	}
+	if got, want := l.CoveragePercent(), 99; got != want {
+		t.Errorf("CoveragePercent() = %d, want %d", got, want)
+	}
+	if got, want := string(l.Contents), "a\nb"; got != want {
+		t.Errorf("Contents = %q, want %q", got, want)
+	}
+}
+
 func TestFetchLicensesDetails(t *testing.T) {
 	testModule := sample.Module(sample.ModulePath, "v1.2.3", "A/B")
 	stdlibModule := sample.Module(stdlib.ModulePath, "v1.13.0", "cmd/go")
@@ -146,7 +180,7 @@ func TestFetchLicensesDetails(t *testing.T) {
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			wantDetails := &LicensesDetails{Licenses: transformLicenses(
-				test.modulePath, test.version, test.want)}
+				test.modulePath, test.version, nil, test.want)}
 			got, err := fetchLicensesDetails(ctx, testDB, &internal.UnitMeta{
 				Path:       test.fullPath,
 				ModulePath: test.modulePath,
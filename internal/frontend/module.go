@@ -17,10 +17,17 @@ import (
 func (s *Server) serveModulePage(ctx context.Context, w http.ResponseWriter, r *http.Request, ds internal.DataSource,
 	um *internal.UnitMeta, requestedVersion string) error {
 	mi := &internal.ModuleInfo{
-		ModulePath:        um.ModulePath,
-		Version:           um.Version,
-		CommitTime:        um.CommitTime,
-		IsRedistributable: um.IsRedistributable,
+		ModulePath:          um.ModulePath,
+		Version:             um.Version,
+		CommitTime:          um.CommitTime,
+		IsRedistributable:   um.IsRedistributable,
+		Retracted:           um.Retracted,
+		RetractionRationale: um.RetractionRationale,
+		Deprecation:         um.Deprecation,
+		ProcessedPackages:   um.ProcessedPackages,
+		TotalPackages:       um.TotalPackages,
+		GoVersion:           um.GoVersion,
+		Toolchain:           um.Toolchain,
 	}
 	modHeader := createModule(mi, um.Licenses, requestedVersion == internal.LatestVersion)
 	tab := r.FormValue("tab")
@@ -58,7 +65,10 @@ func (s *Server) serveModulePage(ctx context.Context, w http.ResponseWriter, r *
 			um.ModulePath,
 			linkVersion(um.Version, um.ModulePath),
 		),
+		LatestMajor: s.latestMajorVersion(ctx, ds, um.ModulePath, um.ModulePath, um.Version),
+		Vulns:       vulnsForUnit(ctx, ds, "", um.ModulePath, um.Version),
 	}
+	page.basePage.Social = unitSocialMetadata(r, page.HTMLTitle, um.ModulePath, "", um.IsRedistributable)
 	s.servePage(ctx, w, settings.TemplateName, page)
 	return nil
 }
@@ -0,0 +1,113 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/safehtml/template"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/postgres"
+	"golang.org/x/pkgsite/internal/stdlib"
+)
+
+// A movedModule describes a module that was requested with a path other than
+// the one declared in its go.mod file, as happens when a repository is forked
+// or renamed. It is the error wrapped by the error page for paths in the
+// module.
+type movedModule struct {
+	modulePath string // the requested module path
+	goModPath  string // the module path declared in the go.mod file
+	// path is the requested path, moved under goModPath, and pathAvailable
+	// reports whether it exists at the requested version.
+	path          string
+	pathAvailable bool
+}
+
+func (m *movedModule) Error() string {
+	return fmt.Sprintf("module %s is served as %s", m.modulePath, m.goModPath)
+}
+
+// findMovedModule returns the movedModule containing fullPath, if the
+// version_map records that one of the module paths that fullPath could be in
+// has a go.mod file declaring a different path at requestedVersion. It
+// returns nil if there is none, or if ds has no version_map.
+func findMovedModule(ctx context.Context, ds internal.DataSource, fullPath, requestedVersion string) (_ *movedModule, err error) {
+	defer derrors.Wrap(&err, "findMovedModule(%q, %q)", fullPath, requestedVersion)
+
+	db, ok := ds.(*postgres.DB)
+	if !ok || stdlib.Contains(fullPath) {
+		return nil, nil
+	}
+	modulePaths, err := candidateModulePaths(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	var mvs []internal.Modver
+	for _, mp := range modulePaths {
+		mvs = append(mvs, internal.Modver{Path: mp, Version: requestedVersion})
+	}
+	vms, err := db.GetVersionMaps(ctx, mvs)
+	if err != nil {
+		return nil, err
+	}
+	// The candidate module paths are ordered from longest to shortest, and
+	// the longest one wins.
+	for _, vm := range vms {
+		if vm == nil || vm.GoModPath == "" || vm.GoModPath == vm.ModulePath {
+			continue
+		}
+		m := &movedModule{
+			modulePath: vm.ModulePath,
+			goModPath:  vm.GoModPath,
+			path:       vm.GoModPath + strings.TrimPrefix(fullPath, vm.ModulePath),
+		}
+		_, err := ds.GetUnitMeta(ctx, m.path, m.goModPath, requestedVersion)
+		switch {
+		case err == nil:
+			m.pathAvailable = true
+		case !errors.Is(err, derrors.NotFound):
+			return nil, err
+		}
+		return m, nil
+	}
+	return nil, nil
+}
+
+// url returns the URL of the moved path at requestedVersion, if it is
+// available, or else that of the latest version of the module it moved to.
+func (m *movedModule) url(requestedVersion string) string {
+	if !m.pathAvailable {
+		return "/" + m.goModPath
+	}
+	return constructPackageURL(m.path, m.goModPath, linkVersion(requestedVersion, m.goModPath))
+}
+
+// movedModuleError returns the error page for fullPath at requestedVersion,
+// which is in the moved module m.
+func movedModuleError(m *movedModule, fullPath, requestedVersion string) error {
+	return &serverError{
+		status: http.StatusNotFound,
+		err:    m,
+		epage: &errorPage{
+			messageTemplate: template.MakeTrustedTemplate(`
+				<h3 class="Error-message">Module moved</h3>
+				<p class="Error-message">
+				  “{{.Path}}” could not be found, because the go.mod file of
+				  module {{.ModulePath}} declares a different module path.
+				  This module is now served as
+				  <a href="{{.URL}}">{{.GoModPath}}</a>.
+				</p>`),
+			MessageData: struct{ Path, ModulePath, GoModPath, URL string }{
+				displayPath(fullPath, requestedVersion), m.modulePath, m.goModPath, m.url(requestedVersion),
+			},
+		},
+	}
+}
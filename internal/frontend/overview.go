@@ -7,6 +7,7 @@ package frontend
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
@@ -36,27 +37,30 @@ type OverviewDetails struct {
 	ReadMeSource     string
 	Redistributable  bool
 	RepositoryURL    string
+	// SecurityPolicyURL is a link to the module's SECURITY.md file, if
+	// it has one.
+	SecurityPolicyURL string
 }
 
 // fetchOverviewDetails uses the given version to fetch an OverviewDetails.
 // versionedLinks says whether the constructed URLs should have versions.
+//
+// Only the README of the module is read; the overview does not need the
+// rest of the unit.
 func fetchOverviewDetails(ctx context.Context, ds internal.DataSource, um *internal.UnitMeta, versionedLinks bool) (*OverviewDetails, error) {
-	u, err := ds.GetUnit(ctx, um, internal.WithReadme)
-	if err != nil {
+	readme, err := ds.GetModuleReadme(ctx, um.ModulePath, um.Version)
+	if err != nil && !errors.Is(err, derrors.NotFound) {
 		return nil, err
 	}
-	var readme *internal.Readme
-	if u.Readme != nil {
-		readme = &internal.Readme{Filepath: u.Readme.Filepath, Contents: u.Readme.Contents}
-	}
 	mi := &internal.ModuleInfo{
 		ModulePath:        um.ModulePath,
 		Version:           um.Version,
 		CommitTime:        um.CommitTime,
 		IsRedistributable: um.IsRedistributable,
-		SourceInfo:        u.SourceInfo,
+		HasSecurityPolicy: um.HasSecurityPolicy,
+		SourceInfo:        um.SourceInfo,
 	}
-	return constructOverviewDetails(ctx, mi, readme, u.IsRedistributable, versionedLinks)
+	return constructOverviewDetails(ctx, mi, readme, um.IsRedistributable, versionedLinks)
 }
 
 // constructOverviewDetails uses the given module version and readme to
@@ -74,6 +78,9 @@ func constructOverviewDetails(ctx context.Context, mi *internal.ModuleInfo, read
 		RepositoryURL:   mi.SourceInfo.RepoURL(),
 		Redistributable: isRedistributable,
 	}
+	if mi.HasSecurityPolicy {
+		overview.SecurityPolicyURL = mi.SourceInfo.FileURL("SECURITY.md")
+	}
 	if overview.Redistributable && readme != nil {
 		overview.ReadMeSource = fileSource(mi.ModulePath, mi.Version, readme.Filepath)
 		r, err := ReadmeHTML(ctx, mi, readme)
@@ -180,21 +187,47 @@ func isMarkdown(filename string) bool {
 // repository. As the discovery site doesn't host the full repository content,
 // in order for the image to render, we need to convert the relative path to an
 // absolute URL to a hosted image.
+//
+// Paths are resolved against the README's directory, except for paths
+// beginning with a slash, which are resolved against the module root. Any
+// query or fragment on dest is preserved. Absolute URLs, scheme-relative URLs
+// and fragment-only links are left alone, as are paths that would resolve
+// outside of the module.
 func translateRelativeLink(dest string, info *source.Info, useRaw bool, readme *internal.Readme) string {
-	destURL, err := url.Parse(dest)
-	if err != nil || destURL.IsAbs() {
+	destURL, err := url.Parse(strings.TrimSpace(dest))
+	if err != nil || destURL.IsAbs() || destURL.Host != "" {
 		return ""
 	}
 	if destURL.Path == "" {
 		// This is a fragment; leave it.
 		return ""
 	}
-	// Paths are relative to the README location.
-	destPath := path.Join(path.Dir(readme.Filepath), path.Clean(trimmedEscapedPath(destURL)))
+	var destPath string
+	if p := trimmedEscapedPath(destURL); strings.HasPrefix(p, "/") {
+		destPath = path.Clean(strings.TrimPrefix(p, "/"))
+	} else {
+		// Paths are relative to the README location.
+		destPath = path.Join(path.Dir(readme.Filepath), path.Clean(p))
+	}
+	if destPath == ".." || strings.HasPrefix(destPath, "../") {
+		return ""
+	}
+	var u string
 	if useRaw {
-		return info.RawURL(destPath)
+		u = info.RawURL(destPath)
+	} else {
+		u = info.FileURL(destPath)
+	}
+	if u == "" {
+		return ""
 	}
-	return info.FileURL(destPath)
+	if destURL.RawQuery != "" {
+		u += "?" + destURL.RawQuery
+	}
+	if i := strings.IndexByte(dest, '#'); i >= 0 && destURL.Fragment != "" {
+		u += strings.TrimSpace(dest[i:])
+	}
+	return u
 }
 
 // trimmedEscapedPath trims surrounding whitespace from u's path, then returns it escaped.
@@ -246,22 +279,33 @@ func translateHTML(htmlText []byte, info *source.Info, readme *internal.Readme)
 
 // walkHTML crawls through an html node and replaces the src
 // tag link with a link that properly represents the image
-// from the repo source.
+// from the repo source. The href of anchor tags is likewise
+// replaced with a link to the file in the repo.
 // It reports whether it made a change.
 func walkHTML(n *html.Node, info *source.Info, readme *internal.Readme) bool {
 	changed := false
-	if n.Type == html.ElementNode && n.DataAtom == atom.Img {
-		var attrs []html.Attribute
-		for _, a := range n.Attr {
-			if a.Key == "src" {
-				if v := translateRelativeLink(a.Val, info, true, readme); v != "" {
-					a.Val = v
-					changed = true
+	if n.Type == html.ElementNode {
+		var key string
+		switch n.DataAtom {
+		case atom.Img:
+			key = "src"
+		case atom.A:
+			key = "href"
+		}
+		if key != "" {
+			useRaw := n.DataAtom == atom.Img
+			var attrs []html.Attribute
+			for _, a := range n.Attr {
+				if a.Key == key {
+					if v := translateRelativeLink(a.Val, info, useRaw, readme); v != "" {
+						a.Val = v
+						changed = true
+					}
 				}
+				attrs = append(attrs, a)
 			}
-			attrs = append(attrs, a)
+			n.Attr = attrs
 		}
-		n.Attr = attrs
 	}
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
 		if walkHTML(c, info, readme) {
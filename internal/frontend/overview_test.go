@@ -58,6 +58,36 @@ func TestFetchOverviewDetails(t *testing.T) {
 	}
 }
 
+func TestOverviewDetailsSecurityPolicy(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		name   string
+		module *internal.Module
+		want   string
+	}{
+		{
+			name:   "no security policy",
+			module: sample.DefaultModule(),
+			want:   "",
+		},
+		{
+			name:   "security policy",
+			module: sample.ModuleWithOptions(sample.ModulePath, sample.VersionString, []string{sample.Suffix}, sample.WithSecurityPolicy()),
+			want:   sample.RepositoryURL + "/blob/v1.0.0/SECURITY.md",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := constructOverviewDetails(ctx, &test.module.ModuleInfo, nil, true, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.SecurityPolicyURL != test.want {
+				t.Errorf("SecurityPolicyURL = %q, want %q", got.SecurityPolicyURL, test.want)
+			}
+		})
+	}
+}
+
 func TestPackageOverviewDetails(t *testing.T) {
 	for _, test := range []struct {
 		name           string
@@ -289,6 +319,30 @@ func TestReadmeHTML(t *testing.T) {
 			},
 			want: `<p><img src="https://github.com/some/repo/raw/v1.2.3/dir/sub/img/thing.png" alt="alt"/></p>`,
 		},
+		{
+			name: "image URLs for module in repo subdirectory",
+			mi: &internal.ModuleInfo{
+				Version:    "v1.2.3",
+				SourceInfo: source.NewGitHubInfo("https://github.com/some/repo", "sub/mod", "sub/mod/v1.2.3"),
+			},
+			readme: &internal.Readme{
+				Filepath: "dir/README.md",
+				Contents: "![diagram](docs/arch.png)",
+			},
+			want: `<p><img src="https://github.com/some/repo/raw/sub/mod/v1.2.3/sub/mod/dir/docs/arch.png" alt="diagram"/></p>`,
+		},
+		{
+			name: "non-image links for module in repo subdirectory",
+			mi: &internal.ModuleInfo{
+				Version:    "v1.2.3",
+				SourceInfo: source.NewGitHubInfo("https://github.com/some/repo", "sub/mod", "sub/mod/v1.2.3"),
+			},
+			readme: &internal.Readme{
+				Filepath: "README.md",
+				Contents: "[design](docs/design.md)",
+			},
+			want: `<p><a href="https://github.com/some/repo/blob/sub/mod/v1.2.3/sub/mod/docs/design.md" rel="nofollow">design</a></p>`,
+		},
 		{
 			name: "non-image links relative to README directory",
 			mi:   aModule,
@@ -356,6 +410,60 @@ func TestReadmeHTML(t *testing.T) {
 			},
 			want: `<p><img src="https://github.com/some/repo/raw/v1.2.3/images/Jupyter%20Notebook_sparkline.svg"/></p>`,
 		},
+		{
+			name: "relative links keep their fragment",
+			mi:   aModule,
+			readme: &internal.Readme{
+				Filepath: "README.md",
+				Contents: "[usage](doc/usage.md#install) and [below](#install)",
+			},
+			want: `<p><a href="https://github.com/some/repo/blob/v1.2.3/doc/usage.md#install" rel="nofollow">usage</a> and <a href="#install" rel="nofollow">below</a></p>`,
+		},
+		{
+			name: "root-relative links resolve against module root",
+			mi:   aModule,
+			readme: &internal.Readme{
+				Filepath: "dir/README.md",
+				Contents: "![logo](/assets/logo.png)",
+			},
+			want: `<p><img src="https://github.com/some/repo/raw/v1.2.3/assets/logo.png" alt="logo"/></p>`,
+		},
+		{
+			name: "reference-style links",
+			mi:   aModule,
+			readme: &internal.Readme{
+				Filepath: "dir/README.md",
+				Contents: "See the [guide][g] and ![badge][b].\n\n[g]: guide.md\n[b]: badge.svg\n",
+			},
+			want: `<p>See the <a href="https://github.com/some/repo/blob/v1.2.3/dir/guide.md" rel="nofollow">guide</a> and <img src="https://github.com/some/repo/raw/v1.2.3/dir/badge.svg" alt="badge" title=""/>.</p>`,
+		},
+		{
+			name: "anchor link in embedded HTML",
+			mi:   aModule,
+			readme: &internal.Readme{
+				Filepath: "README.md",
+				Contents: `<p><a href="CONTRIBUTING.md"><img src="logo.png"></a></p>` + "\n",
+			},
+			want: `<p><a href="https://github.com/some/repo/blob/v1.2.3/CONTRIBUTING.md" rel="nofollow"><img src="https://github.com/some/repo/raw/v1.2.3/logo.png"/></a></p>`,
+		},
+		{
+			name: "absolute and scheme-relative URLs are left alone",
+			mi:   aModule,
+			readme: &internal.Readme{
+				Filepath: "README.md",
+				Contents: "![a](https://example.com/a.png) ![b](//example.com/b.png)",
+			},
+			want: `<p><img src="https://example.com/a.png" alt="a"/> <img src="//example.com/b.png" alt="b"/></p>`,
+		},
+		{
+			name: "paths outside the module are left alone",
+			mi:   aModule,
+			readme: &internal.Readme{
+				Filepath: "README.md",
+				Contents: "![up](../other/logo.png)",
+			},
+			want: `<p><img src="../other/logo.png" alt="up"/></p>`,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			hgot, err := ReadmeHTML(ctx, tc.mi, tc.readme)
@@ -6,13 +6,14 @@ package frontend
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/derrors"
-	"golang.org/x/pkgsite/internal/postgres"
 	"golang.org/x/pkgsite/internal/stdlib"
 )
 
@@ -29,11 +30,10 @@ func stdlibPathForShortcut(ctx context.Context, ds internal.DataSource, shortcut
 	if !stdlib.Contains(shortcut) {
 		return "", nil
 	}
-	db, ok := ds.(*postgres.DB)
-	if !ok {
+	matches, err := ds.GetStdlibPathsWithSuffix(ctx, shortcut)
+	if errors.Is(err, derrors.Unsupported) {
 		return "", proxydatasourceNotSupportedErr()
 	}
-	matches, err := db.GetStdlibPathsWithSuffix(ctx, shortcut)
 	if err != nil {
 		return "", err
 	}
@@ -48,10 +48,15 @@ func stdlibPathForShortcut(ctx context.Context, ds internal.DataSource, shortcut
 func (s *Server) servePackagePage(ctx context.Context,
 	w http.ResponseWriter, r *http.Request, ds internal.DataSource, um *internal.UnitMeta, requestedVersion string) error {
 	mi := &internal.ModuleInfo{
-		ModulePath:        um.ModulePath,
-		Version:           um.Version,
-		CommitTime:        um.CommitTime,
-		IsRedistributable: um.IsRedistributable,
+		ModulePath:          um.ModulePath,
+		Version:             um.Version,
+		CommitTime:          um.CommitTime,
+		IsRedistributable:   um.IsRedistributable,
+		Retracted:           um.Retracted,
+		RetractionRationale: um.RetractionRationale,
+		Deprecation:         um.Deprecation,
+		GoVersion:           um.GoVersion,
+		Toolchain:           um.Toolchain,
 	}
 	pkgHeader, err := createPackage(&internal.PackageMeta{
 		Path:              um.Path,
@@ -72,7 +77,14 @@ func (s *Server) servePackagePage(ctx context.Context,
 		} else {
 			tab = tabOverview
 		}
-		http.Redirect(w, r, fmt.Sprintf(r.URL.Path+"?tab=%s", tab), http.StatusFound)
+		// Keep the requested build context, if any.
+		q := url.Values{"tab": {tab}}
+		for _, k := range []string{"GOOS", "GOARCH"} {
+			if v := r.FormValue(k); v != "" {
+				q.Set(k, v)
+			}
+		}
+		http.Redirect(w, r, r.URL.Path+"?"+q.Encode(), http.StatusFound)
 		return nil
 	}
 	canShowDetails := um.IsRedistributable || settings.AlwaysShowDetails
@@ -80,7 +92,7 @@ func (s *Server) servePackagePage(ctx context.Context,
 	var details interface{}
 	if canShowDetails {
 		var err error
-		details, err = fetchDetailsForPackage(r, tab, ds, um)
+		details, err = s.fetchDetailsForPackage(r, tab, ds, um)
 		if err != nil {
 			return fmt.Errorf("fetching page for %q: %v", tab, err)
 		}
@@ -108,8 +120,18 @@ func (s *Server) servePackagePage(ctx context.Context,
 			pkgHeader.Path,
 			pkgHeader.Module.ModulePath,
 			pkgHeader.Module.LinkVersion),
+		LatestMajor: s.latestMajorVersion(ctx, ds, um.Path, um.ModulePath, um.Version),
+		Vulns:       vulnsForUnit(ctx, ds, um.Path, um.ModulePath, um.Version),
 	}
 	page.basePage.AllowWideContent = tab == tabDoc
+	var synopsis string
+	if dd, ok := details.(*DocumentationDetails); ok {
+		synopsis = dd.Synopsis
+	}
+	page.basePage.Social = unitSocialMetadata(r, page.HTMLTitle, um.Path, synopsis, um.IsRedistributable)
+	if tab == tabDoc && (r.FormValue("GOOS") != "" || r.FormValue("GOARCH") != "") {
+		page.CanonicalLink = "https://" + r.Host + r.URL.Path + "?tab=doc"
+	}
 	s.servePage(ctx, w, settings.TemplateName, page)
 	return nil
 }
@@ -8,27 +8,65 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"go/token"
 	"math"
 	"net/http"
+	"net/url"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/google/safehtml/template"
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/derrors"
 	"golang.org/x/pkgsite/internal/experiment"
 	"golang.org/x/pkgsite/internal/log"
-	"golang.org/x/pkgsite/internal/postgres"
+	"golang.org/x/pkgsite/internal/middleware"
+	"golang.org/x/pkgsite/internal/stdlib"
 )
 
 const defaultSearchLimit = 10
 
+// symbolSearchLimit is the maximum number of symbols shown above the package
+// results of a search.
+const symbolSearchLimit = 5
+
+// pinnedSearchLimit is the maximum number of packages whose names are the
+// query that are pinned above the other results of a search.
+const pinnedSearchLimit = 3
+
+// searchTimeMargin is how long before the deadline of a search request
+// fetchSearchPage stops searching and returns the results it has found, so
+// that there is time left to show them.
+var searchTimeMargin = 3 * time.Second
+
 // SearchPage contains all of the data that the search template needs to
 // populate.
 type SearchPage struct {
 	basePage
 	Pagination pagination
 	Results    []*SearchResult
+	// Pinned are the packages whose names are the query, shown above
+	// Results, which does not include them. They are only searched for on
+	// the first page of results.
+	Pinned []*SearchResult
+	// Symbols are the symbols whose names match the query. They are only
+	// searched for on the first page of results.
+	Symbols []*SymbolResult
+	// Filters are the filters of the query, like "license:MIT".
+	Filters []*SearchFilterChip
+	// Partial reports whether the search ran out of time before searching
+	// all packages, so that the page only has the Symbols and Pinned found
+	// before then, and no Results or count of them.
+	Partial bool
+}
+
+// SearchFilterChip contains data needed to display an active filter of a
+// search query.
+type SearchFilterChip struct {
+	Label string
+	// RemoveURL is the URL of the search without the filter.
+	RemoveURL string
 }
 
 // SearchResult contains data needed to display a single search result.
@@ -42,28 +80,149 @@ type SearchResult struct {
 	CommitTime     string
 	NumImportedBy  uint64
 	Approximate    bool
+
+	// NumOtherPackages is the number of the other packages of the module
+	// that match the query, and OtherPackages holds the paths of some of
+	// them. If it does not hold all of them, ModuleSearchURL is the URL of
+	// a search for the query restricted to the module.
+	NumOtherPackages int
+	OtherPackages    []string
+	ModuleSearchURL  string
+
+	// NumVulns is the number of entries of the Go vulnerability database
+	// that affect the package at this version.
+	NumVulns int
+}
+
+// SymbolResult contains data needed to display a symbol that matches a
+// search query.
+type SymbolResult struct {
+	SymbolName  string
+	Kind        string // "func", "type", "method", "const", "var" or ""
+	PackagePath string
+	// Link is the URL of the documentation of the symbol.
+	Link string
+}
+
+// shortSymbolKinds maps the kinds of symbols in documentation to the keywords
+// shown in search results.
+var shortSymbolKinds = map[string]string{
+	"function": "func",
+	"constant": "const",
+	"variable": "var",
 }
 
 // fetchSearchPage fetches data matching the search query from the database and
-// returns a SearchPage.
-func fetchSearchPage(ctx context.Context, db *postgres.DB, query string, pageParams paginationParams) (*SearchPage, error) {
-	dbresults, err := db.Search(ctx, query, pageParams.limit, pageParams.offset())
-	if err != nil {
-		return nil, err
+// returns a SearchPage. If the query looks like the name of a symbol and has
+// no filters, the first page also includes the matching symbols. Queries that
+// begin with "#" only search for symbols. If the query is a package name,
+// possibly followed by "@version", the packages with that name are pinned to
+// the top of the first page.
+//
+// If the searches are not done searchTimeMargin before the deadline of ctx,
+// fetchSearchPage stops them and returns a page with the symbols and pinned
+// packages found so far, marked as partial. The search of all packages is
+// only done if they were found in time, and its results are all or nothing.
+// If there are none, it returns an error wrapping context.DeadlineExceeded.
+func fetchSearchPage(ctx context.Context, ds internal.DataSource, query string, pageParams paginationParams) (*SearchPage, error) {
+	sctx, cancel := middleware.SoftDeadline(ctx, searchTimeMargin)
+	defer cancel()
+	var partial bool
+	// outOfTime reports whether err happened because the soft deadline
+	// passed, so that the results found so far should be shown.
+	outOfTime := func(err error) bool {
+		return err != nil && sctx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+	}
+
+	var filters []*SearchFilterChip
+	searchQuery := internal.ParseSearchQuery(query)
+	for _, f := range searchQuery.Filters {
+		filters = append(filters, &SearchFilterChip{
+			Label:     f.String(),
+			RemoveURL: "/search?q=" + url.QueryEscape(searchQuery.Without(f)),
+		})
+	}
+
+	var symbols []*SymbolResult
+	sq, isSymbolQuery := internal.ParseSymbolQuery(query)
+	isSymbolQuery = isSymbolQuery && len(filters) == 0
+	if isSymbolQuery && pageParams.page <= 1 {
+		srs, err := ds.SearchSymbols(sctx, sq, symbolSearchLimit)
+		switch {
+		case outOfTime(err):
+			partial = true
+		case err != nil:
+			return nil, err
+		}
+		for _, r := range srs {
+			kind := r.SymbolKind
+			if k, ok := shortSymbolKinds[kind]; ok {
+				kind = k
+			}
+			symbols = append(symbols, &SymbolResult{
+				SymbolName:  r.SymbolName,
+				Kind:        kind,
+				PackagePath: r.PackagePath,
+				Link:        fmt.Sprintf("/%s#%s", r.PackagePath, r.SymbolName),
+			})
+		}
+	}
+	if isSymbolQuery && sq.Explicit {
+		if partial {
+			return nil, fmt.Errorf("searching for symbols: %w", context.DeadlineExceeded)
+		}
+		return &SearchPage{
+			Symbols:    symbols,
+			Pagination: newPagination(pageParams, 0, 0),
+		}, nil
+	}
+
+	var pinned []*SearchResult
+	pinnedIndex := map[string]int{}
+	// versions holds the version of each result, by package path.
+	versions := map[string]string{}
+	if name := searchPackageName(query); name != "" && !isSymbolQuery && len(filters) == 0 && pageParams.page <= 1 {
+		nq := &internal.SearchQuery{Filters: []internal.SearchFilter{{Qualifier: internal.NameQualifier, Value: name}}}
+		prs, err := ds.Search(sctx, nq.String(), pinnedSearchLimit, 0)
+		switch {
+		case outOfTime(err):
+			partial = true
+		case err != nil:
+			return nil, err
+		}
+		for _, r := range prs {
+			versions[r.PackagePath] = r.Version
+			pinnedIndex[r.PackagePath] = len(pinned)
+			pinned = append(pinned, newSearchResult(r, searchQuery))
+		}
+	}
+
+	var dbresults []*internal.SearchResult
+	if !partial {
+		var err error
+		dbresults, err = ds.Search(sctx, query, pageParams.limit, pageParams.offset())
+		switch {
+		case outOfTime(err):
+			partial = true
+		case err != nil:
+			return nil, err
+		}
+	}
+	if partial && len(symbols) == 0 && len(pinned) == 0 && len(dbresults) == 0 {
+		return nil, fmt.Errorf("searching for %q: %w", query, context.DeadlineExceeded)
 	}
 
 	var results []*SearchResult
 	for _, r := range dbresults {
-		results = append(results, &SearchResult{
-			Name:           r.Name,
-			PackagePath:    r.PackagePath,
-			ModulePath:     r.ModulePath,
-			Synopsis:       r.Synopsis,
-			DisplayVersion: displayVersion(r.Version, r.ModulePath),
-			Licenses:       r.Licenses,
-			CommitTime:     elapsedTime(r.CommitTime),
-			NumImportedBy:  r.NumImportedBy,
-		})
+		versions[r.PackagePath] = r.Version
+		sr := newSearchResult(r, searchQuery)
+		if i, ok := pinnedIndex[r.PackagePath]; ok {
+			// Show the pinned package with the other packages of its module
+			// that match the query, rather than those with the same name.
+			pinned[i] = sr
+			continue
+		}
+		results = append(results, sr)
 	}
 
 	var (
@@ -80,14 +239,60 @@ func fetchSearchPage(ctx context.Context, db *postgres.DB, query string, pagePar
 		}
 	}
 
+	if !partial {
+		addVulnCounts(sctx, ds, append(pinned, results...), versions)
+	}
+
 	pgs := newPagination(pageParams, len(results), numResults)
 	pgs.Approximate = approximate
 	return &SearchPage{
 		Results:    results,
+		Pinned:     pinned,
+		Symbols:    symbols,
+		Filters:    filters,
 		Pagination: pgs,
+		Partial:    partial,
 	}, nil
 }
 
+// newSearchResult returns the SearchResult for r, a result of sq.
+func newSearchResult(r *internal.SearchResult, sq *internal.SearchQuery) *SearchResult {
+	sr := &SearchResult{
+		Name:             r.Name,
+		PackagePath:      r.PackagePath,
+		ModulePath:       r.ModulePath,
+		Synopsis:         r.Synopsis,
+		DisplayVersion:   displayVersion(r.Version, r.ModulePath),
+		Licenses:         r.Licenses,
+		CommitTime:       elapsedTime(r.CommitTime),
+		NumImportedBy:    r.NumImportedBy,
+		NumOtherPackages: int(r.NumOtherPackages),
+		OtherPackages:    r.OtherPackages,
+	}
+	if r.NumOtherPackages > uint64(len(r.OtherPackages)) {
+		mq := &internal.SearchQuery{
+			Text:    sq.Text,
+			Filters: []internal.SearchFilter{{Qualifier: internal.ModuleQualifier, Value: r.ModulePath}},
+		}
+		sr.ModuleSearchURL = "/search?q=" + url.QueryEscape(mq.String())
+	}
+	return sr
+}
+
+// searchPackageName returns the package name that query consists of, with
+// any "@version" suffix removed, or the empty string if query is not a
+// package name.
+func searchPackageName(query string) string {
+	name := query
+	if i := strings.IndexByte(name, '@'); i >= 0 {
+		name = name[:i]
+	}
+	if !token.IsIdentifier(name) {
+		return ""
+	}
+	return name
+}
+
 // approximateNumber returns an approximation of the estimate, calibrated by
 // the statistical estimate of standard error.
 // i.e., a number that isn't misleading when we say '1-10 of approximately N
@@ -109,20 +314,15 @@ func approximateNumber(estimate int, sigma float64) int {
 const maxSearchQueryLength = 500
 
 // serveSearch applies database data to the search template. Handles endpoint
-// /search?q=<query>. If <query> is an exact match for a package path, the user
-// will be redirected to the details page.
+// /search?q=<query>. If <query> is an exact match for a package path, possibly
+// with a version or pasted from the URL of a page, the user will be redirected
+// to the details page.
 func (s *Server) serveSearch(w http.ResponseWriter, r *http.Request, ds internal.DataSource) error {
 	if r.Method != http.MethodGet {
 		return &serverError{status: http.StatusMethodNotAllowed}
 	}
-	db, ok := ds.(*postgres.DB)
-	if !ok {
-		// The proxydatasource does not support the imported by page.
-		return proxydatasourceNotSupportedErr()
-	}
-
 	ctx := r.Context()
-	query := searchQuery(r)
+	query := trimSearchURL(searchQuery(r))
 	if len(query) > maxSearchQueryLength {
 		return &serverError{
 			status: http.StatusBadRequest,
@@ -140,11 +340,24 @@ func (s *Server) serveSearch(w http.ResponseWriter, r *http.Request, ds internal
 		http.Redirect(w, r, path, http.StatusFound)
 		return nil
 	}
-	page, err := fetchSearchPage(ctx, db, query, newPaginationParams(r, defaultSearchLimit))
+	page, err := fetchSearchPage(ctx, ds, query, newPaginationParams(r, defaultSearchLimit))
+	if errors.Is(err, derrors.Unsupported) {
+		// The proxydatasource does not support search.
+		return proxydatasourceNotSupportedErr()
+	}
 	if err != nil {
-		return fmt.Errorf("fetchSearchPage(ctx, db, %q): %v", query, err)
+		return fmt.Errorf("fetchSearchPage(ctx, ds, %q): %w", query, err)
+	}
+	if page.Partial {
+		// Serve the whole page next time, if it can be found in time.
+		w.Header().Set("Cache-Control", "no-store")
 	}
 	page.basePage = s.newBasePage(r, query)
+	page.basePage.Social = &socialMetadata{
+		Title:       query + " - Search Results",
+		Description: fmt.Sprintf("Go packages matching “%s”.", sanitizeDescription(query)),
+		URL:         "https://" + r.Host + r.URL.RequestURI(),
+	}
 	s.servePage(ctx, w, "search.tmpl", page)
 	return nil
 }
@@ -152,45 +365,51 @@ func (s *Server) serveSearch(w http.ResponseWriter, r *http.Request, ds internal
 // searchRequestRedirectPath returns the path that a search request should be
 // redirected to, or the empty string if there is no such path. If the user
 // types an existing package path into the search bar, we will redirect the
-// user to the details page. Standard library packages that only contain one
-// element (such as fmt, errors, etc.) will not redirect, to allow users to
-// search by those terms.
+// user to the details page. The path may be followed by a version, as in
+// "rsc.io/quote@v1.5.2", or contain one, as in "rsc.io/quote@v1.5.2/buggy".
+// Standard library packages that only contain one element (such as fmt,
+// errors, etc.) will not redirect, to allow users to search by those terms,
+// unless they are given a version, like "errors@go1.15".
 func searchRequestRedirectPath(ctx context.Context, ds internal.DataSource, query string) string {
 	requestedPath := path.Clean(query)
-	if !strings.Contains(requestedPath, "/") {
+	info, err := extractURLPathInfo("/" + requestedPath)
+	if err != nil || (info.isModule && info.fullPath == stdlib.ModulePath) {
+		return ""
+	}
+	if !strings.Contains(info.fullPath, "/") && info.requestedVersion == internal.LatestVersion {
 		return ""
 	}
 	if experiment.IsActive(ctx, internal.ExperimentUsePathInfo) {
-		um, err := ds.GetUnitMeta(ctx, requestedPath, internal.UnknownModulePath, internal.LatestVersion)
+		um, err := ds.GetUnitMeta(ctx, info.fullPath, info.modulePath, info.requestedVersion)
 		if err != nil {
 			if !errors.Is(err, derrors.NotFound) {
 				log.Errorf(ctx, "searchRequestRedirectPath(%q): %v", requestedPath, err)
 			}
 			return ""
 		}
-		if um.IsPackage() || um.ModulePath != requestedPath {
+		if um.IsPackage() || um.ModulePath != info.fullPath {
 			return fmt.Sprintf("/%s", requestedPath)
 		}
 		return fmt.Sprintf("/mod/%s", requestedPath)
 	}
 
-	pkg, err := ds.LegacyGetPackage(ctx, requestedPath, internal.UnknownModulePath, internal.LatestVersion)
+	_, err = ds.LegacyGetPackage(ctx, info.fullPath, info.modulePath, info.requestedVersion)
 	if err == nil {
-		return fmt.Sprintf("/%s", pkg.Path)
+		return fmt.Sprintf("/%s", requestedPath)
 	} else if !errors.Is(err, derrors.NotFound) {
 		log.Errorf(ctx, "error getting package for %s: %v", requestedPath, err)
 		return ""
 	}
-	mi, err := ds.LegacyGetModuleInfo(ctx, requestedPath, internal.LatestVersion)
+	_, err = ds.LegacyGetModuleInfo(ctx, info.fullPath, info.requestedVersion)
 	if err == nil {
-		return fmt.Sprintf("/mod/%s", mi.ModulePath)
+		return fmt.Sprintf("/mod/%s", requestedPath)
 	} else if !errors.Is(err, derrors.NotFound) {
 		log.Errorf(ctx, "error getting module for %s: %v", requestedPath, err)
 		return ""
 	}
-	dir, err := ds.LegacyGetDirectory(ctx, requestedPath, internal.UnknownModulePath, internal.LatestVersion, internal.AllFields)
+	_, err = ds.LegacyGetDirectory(ctx, info.fullPath, info.modulePath, info.requestedVersion, internal.MinimalFields)
 	if err == nil {
-		return fmt.Sprintf("/%s", dir.Path)
+		return fmt.Sprintf("/%s", requestedPath)
 	} else if !errors.Is(err, derrors.NotFound) {
 		log.Errorf(ctx, "error getting directory for %s: %v", requestedPath, err)
 		return ""
@@ -198,6 +417,24 @@ func searchRequestRedirectPath(ctx context.Context, ds internal.DataSource, quer
 	return ""
 }
 
+// trimSearchURL returns query without a leading "https://" or "http://" and
+// "pkg.go.dev/", so that the URL of a page or repository pasted into the
+// search bar is treated as an import path. If query had such a prefix, the
+// URL query and fragment are also removed.
+func trimSearchURL(query string) string {
+	q := strings.TrimPrefix(strings.TrimPrefix(query, "https://"), "http://")
+	if strings.HasPrefix(q, "pkg.go.dev/") {
+		q = strings.TrimPrefix(strings.TrimPrefix(q, "pkg.go.dev/"), "mod/")
+	}
+	if q == query {
+		return query
+	}
+	if i := strings.IndexAny(q, "?#"); i >= 0 {
+		q = q[:i]
+	}
+	return strings.TrimSuffix(q, "/")
+}
+
 // searchQuery extracts a search query from the request.
 func searchQuery(r *http.Request) string {
 	return strings.TrimSpace(r.FormValue("q"))
@@ -6,13 +6,21 @@ package frontend
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/safehtml/template"
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/experiment"
 	"golang.org/x/pkgsite/internal/licenses"
+	"golang.org/x/pkgsite/internal/middleware"
 	"golang.org/x/pkgsite/internal/postgres"
 	"golang.org/x/pkgsite/internal/testing/sample"
 )
@@ -153,6 +161,44 @@ func TestFetchSearchPage(t *testing.T) {
 	}
 }
 
+func TestTrimSearchURL(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"errors", "errors"},
+		{"#Reader io", "#Reader io"},
+		{"github.com/pkg/errors", "github.com/pkg/errors"},
+		{"https://pkg.go.dev/github.com/pkg/errors", "github.com/pkg/errors"},
+		{"https://pkg.go.dev/github.com/pkg/errors?tab=doc#Wrap", "github.com/pkg/errors"},
+		{"http://pkg.go.dev/errors@go1.15/", "errors@go1.15"},
+		{"pkg.go.dev/rsc.io/quote/v3", "rsc.io/quote/v3"},
+		{"https://pkg.go.dev/mod/rsc.io/quote@v1.5.2", "rsc.io/quote@v1.5.2"},
+		{"https://github.com/pkg/errors", "github.com/pkg/errors"},
+	} {
+		if got := trimSearchURL(test.in); got != test.want {
+			t.Errorf("trimSearchURL(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestSearchPackageName(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"errors", "errors"},
+		{"errors@v0.9.1", "errors"},
+		{"yaml_v2", "yaml_v2"},
+		{"net/http", ""},
+		{"go cloud", ""},
+		{"json.Unmarshal", ""},
+		{"@v1.0.0", ""},
+	} {
+		if got := searchPackageName(test.in); got != test.want {
+			t.Errorf("searchPackageName(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
 func TestApproximateNumber(t *testing.T) {
 	tests := []struct {
 		estimate int
@@ -197,7 +243,9 @@ func testSearchRequestRedirectPath(t *testing.T, experimentNames ...string) {
 	golangTools := sample.Module("golang.org/x/tools", sample.VersionString, "internal/lsp")
 	std := sample.Module("std", sample.VersionString,
 		"cmd/go", "cmd/go/internal/auth", "fmt")
-	modules := []*internal.Module{golangTools, std}
+	quote := sample.Module("rsc.io/quote/v3", "v3.1.0", "")
+	pkgErrors := sample.Module("github.com/pkg/errors", "v0.9.1", "")
+	modules := []*internal.Module{golangTools, std, quote, pkgErrors}
 
 	for _, v := range modules {
 		if err := testDB.InsertModule(ctx, v); err != nil {
@@ -217,11 +265,168 @@ func testSearchRequestRedirectPath(t *testing.T, experimentNames ...string) {
 		{"stdlib directory does redirect", "cmd/go/internal", "/cmd/go/internal"},
 		{"std does not redirect", "std", ""},
 		{"non-existent path does not redirect", "github.com/non-existent", ""},
+		{"major version package", "rsc.io/quote/v3", "/rsc.io/quote/v3"},
+		{"versioned package", "github.com/pkg/errors@v0.9.1", "/github.com/pkg/errors@v0.9.1"},
+		{"versioned module", "golang.org/x/tools@" + sample.VersionString, "/mod/golang.org/x/tools@" + sample.VersionString},
+		{"version in the middle", "golang.org/x/tools@" + sample.VersionString + "/internal/lsp",
+			"/golang.org/x/tools@" + sample.VersionString + "/internal/lsp"},
+		{"non-existent version does not redirect", "github.com/pkg/errors@v0.8.0", ""},
+		{"versioned stdlib package does redirect", "fmt@go1", "/fmt@go1"},
+		{"stdlib package with non-stdlib version does not redirect", "errors@v0.9.1", ""},
+		{"pasted URL", "https://pkg.go.dev/github.com/pkg/errors?tab=doc", "/github.com/pkg/errors"},
+		{"pasted module URL", "https://pkg.go.dev/mod/golang.org/x/tools", "/mod/golang.org/x/tools"},
+		{"pasted versioned URL", "pkg.go.dev/github.com/pkg/errors@v0.9.1#Wrap", "/github.com/pkg/errors@v0.9.1"},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
-			if got := searchRequestRedirectPath(ctx, testDB, tc.query); got != tc.want {
+			if got := searchRequestRedirectPath(ctx, testDB, trimSearchURL(tc.query)); got != tc.want {
 				t.Errorf("searchRequestRedirectPath(ctx, %q) = %q; want = %q", tc.query, got, tc.want)
 			}
 		})
 	}
 }
+
+// slowSearchDataSource is a DataSource whose searches are slow when their
+// query contains "slow": they do not return until their context is done, and
+// then fail like a canceled database query. Searches for package names are
+// always fast.
+type slowSearchDataSource struct {
+	internal.DataSource
+}
+
+func (slowSearchDataSource) Search(ctx context.Context, q string, limit, offset int) ([]*internal.SearchResult, error) {
+	if name := strings.TrimPrefix(q, "name:"); name != q {
+		return []*internal.SearchResult{{
+			Name:        name,
+			PackagePath: "example.com/" + name,
+			ModulePath:  "example.com/" + name,
+			Version:     "v1.0.0",
+			NumResults:  1,
+		}}, nil
+	}
+	if strings.Contains(q, "slow") {
+		<-ctx.Done()
+		return nil, errors.New("pq: canceling statement due to user request")
+	}
+	return []*internal.SearchResult{{
+		Name:        "other",
+		PackagePath: "example.com/other",
+		ModulePath:  "example.com/other",
+		Version:     "v1.0.0",
+		NumResults:  1,
+	}}, nil
+}
+
+func (slowSearchDataSource) SearchSymbols(ctx context.Context, sq *internal.SymbolQuery, limit int) ([]*internal.SymbolSearchResult, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestFetchSearchPagePartial(t *testing.T) {
+	defer func(m time.Duration) { searchTimeMargin = m }(searchTimeMargin)
+	searchTimeMargin = time.Second
+
+	ds := slowSearchDataSource{}
+	for _, test := range []struct {
+		query        string
+		wantPartial  bool
+		wantPinned   []string
+		wantResults  []string
+		wantDeadline bool // want an error wrapping context.DeadlineExceeded
+	}{
+		{query: "fast", wantResults: []string{"example.com/other"}, wantPinned: []string{"example.com/fast"}},
+		{query: "slow", wantPartial: true, wantPinned: []string{"example.com/slow"}},
+		{query: "very slow", wantDeadline: true},
+		{query: "#Slow", wantDeadline: true},
+	} {
+		t.Run(test.query, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), searchTimeMargin+100*time.Millisecond)
+			defer cancel()
+			got, err := fetchSearchPage(ctx, ds, test.query, paginationParams{limit: 10, page: 1})
+			if test.wantDeadline {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Fatalf("got error %v, want one wrapping %v", err, context.DeadlineExceeded)
+				}
+				if ctx.Err() != nil {
+					t.Error("fetchSearchPage returned after the deadline")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Partial != test.wantPartial {
+				t.Errorf("got Partial %t, want %t", got.Partial, test.wantPartial)
+			}
+			var pinned, results []string
+			for _, r := range got.Pinned {
+				pinned = append(pinned, r.PackagePath)
+			}
+			for _, r := range got.Results {
+				results = append(results, r.PackagePath)
+			}
+			if diff := cmp.Diff(test.wantPinned, pinned); diff != "" {
+				t.Errorf("pinned mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.wantResults, results); diff != "" {
+				t.Errorf("results mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestServeSearchTimeout(t *testing.T) {
+	defer func(m time.Duration) { searchTimeMargin = m }(searchTimeMargin)
+	searchTimeMargin = 100 * time.Millisecond
+
+	s, err := NewServer(ServerConfig{
+		DataSourceGetter: func(context.Context) internal.DataSource { return slowSearchDataSource{} },
+		StaticPath:       template.TrustedSourceFromConstant("../../content/static"),
+		ThirdPartyPath:   "../../third_party",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	s.Install(mux.Handle, nil, nil)
+	handler := middleware.Timeout(200 * time.Millisecond)(mux)
+
+	for _, test := range []struct {
+		query        string
+		wantStatus   int
+		wantNoStore  bool
+		wantContents []string
+	}{
+		{"fast", http.StatusOK, false, []string{"example.com/fast", "example.com/other"}},
+		{"slow", http.StatusOK, true, []string{
+			"example.com/slow",
+			`<p class="SearchResults-partial">`,
+		}},
+		{"very slow", http.StatusServiceUnavailable, true, []string{
+			"This page took too long to load.",
+			"try a more specific query",
+		}},
+	} {
+		t.Run(test.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/search?q="+url.QueryEscape(test.query), nil))
+			if w.Code != test.wantStatus {
+				t.Errorf("got status %d, want %d", w.Code, test.wantStatus)
+			}
+			if got := w.Header().Get("Cache-Control") == "no-store"; got != test.wantNoStore {
+				t.Errorf("got Cache-Control %q, want no-store: %t", w.Header().Get("Cache-Control"), test.wantNoStore)
+			}
+			body := w.Body.String()
+			for _, want := range test.wantContents {
+				if !strings.Contains(body, want) {
+					t.Errorf("body does not contain %q", want)
+				}
+			}
+			if !test.wantNoStore && strings.Contains(body, "SearchResults-partial") {
+				t.Error("complete results have the partial results notice")
+			}
+			if strings.Contains(body, "SearchResults-partial") && strings.Contains(body, "SearchResults-resultCount") {
+				t.Error("partial results have a result count")
+			}
+		})
+	}
+}
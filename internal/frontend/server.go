@@ -10,6 +10,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"image"
 	"io"
 	"net/http"
 	"strings"
@@ -19,12 +20,15 @@ import (
 	"github.com/go-redis/redis/v7"
 	"github.com/google/safehtml/template"
 	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/config"
 	"golang.org/x/pkgsite/internal/derrors"
 	"golang.org/x/pkgsite/internal/experiment"
 	"golang.org/x/pkgsite/internal/licenses"
 	"golang.org/x/pkgsite/internal/log"
 	"golang.org/x/pkgsite/internal/middleware"
+	"golang.org/x/pkgsite/internal/postgres"
 	"golang.org/x/pkgsite/internal/queue"
+	"golang.org/x/pkgsite/internal/stdlib"
 )
 
 // Server can be installed to serve the go discovery frontend.
@@ -32,9 +36,13 @@ type Server struct {
 	// getDataSource should never be called from a handler. It is called only in Server.errorHandler.
 	getDataSource func(context.Context) internal.DataSource
 	queue         queue.Queue
-	// cmplClient is a redis client that has access to the "completions" sorted
-	// set.
-	cmplClient           *redis.Client
+	// autocompleteQuota limits requests to /autocomplete, and
+	// autocompleteCache holds recent completions. fetchLimiter limits the
+	// module versions that frontend fetch requests enqueue; Install moves its
+	// state to redis, if redis is used.
+	autocompleteQuota    config.QuotaSettings
+	autocompleteCache    *completionCache
+	fetchLimiter         *fetchLimiter
 	taskIDChangeInterval time.Duration
 	staticPath           template.TrustedSource
 	thirdPartyPath       string
@@ -43,6 +51,26 @@ type Server struct {
 	errorPage            []byte
 	appVersionLabel      string
 	googleTagManagerID   string
+	// vanityImports serves go-import meta tags for vanity import paths, if
+	// any are configured.
+	vanityImports *vanityImports
+	// sitemap holds the packages listed in the sitemap files.
+	sitemap *sitemap
+	// seriesCache holds the module versions of recently served module
+	// series, to find their highest major versions.
+	seriesCache *seriesCache
+	// socialImageCache holds recently rendered social images, and
+	// socialCard is the template they are drawn on, read once by
+	// socialCardTemplate. socialImageRenders limits the number of images
+	// rendered at once.
+	socialImageCache   *socialImageCache
+	socialImageRenders chan struct{}
+	socialCardOnce     sync.Once
+	socialCard         image.Image
+	socialCardErr      error
+	// fullDocs renders the full documentation of packages whose stored
+	// documentation is abbreviated.
+	fullDocs *fullDocRenderer
 
 	mu        sync.Mutex // Protects all fields below
 	templates map[string]*template.Template
@@ -54,13 +82,21 @@ type ServerConfig struct {
 	// It should be goroutine-safe.
 	DataSourceGetter     func(context.Context) internal.DataSource
 	Queue                queue.Queue
-	CompletionClient     *redis.Client
 	TaskIDChangeInterval time.Duration
 	StaticPath           template.TrustedSource
 	ThirdPartyPath       string
 	DevMode              bool
 	AppVersionLabel      string
 	GoogleTagManagerID   string
+	// AutocompleteQuota limits requests to /autocomplete by IP. If its QPS is
+	// zero, requests are not limited.
+	AutocompleteQuota config.QuotaSettings
+	// FetchQuota limits the module versions that frontend fetch requests
+	// enqueue.
+	FetchQuota config.FetchQuotaSettings
+	// VanityImportsFile is the path of a YAML file describing vanity import
+	// paths, for which go-import meta tags are served. It may be empty.
+	VanityImportsFile string
 }
 
 // NewServer creates a new Server for the given database and template directory.
@@ -74,7 +110,9 @@ func NewServer(scfg ServerConfig) (_ *Server, err error) {
 	s := &Server{
 		getDataSource:        scfg.DataSourceGetter,
 		queue:                scfg.Queue,
-		cmplClient:           scfg.CompletionClient,
+		autocompleteQuota:    scfg.AutocompleteQuota,
+		autocompleteCache:    newCompletionCache(autocompleteCacheSize),
+		fetchLimiter:         newFetchLimiter(scfg.FetchQuota, nil),
 		staticPath:           scfg.StaticPath,
 		thirdPartyPath:       scfg.ThirdPartyPath,
 		templateDir:          templateDir,
@@ -83,12 +121,23 @@ func NewServer(scfg ServerConfig) (_ *Server, err error) {
 		taskIDChangeInterval: scfg.TaskIDChangeInterval,
 		appVersionLabel:      scfg.AppVersionLabel,
 		googleTagManagerID:   scfg.GoogleTagManagerID,
+		sitemap:              newSitemap(maxSitemapURLs),
+		seriesCache:          newSeriesCache(seriesCacheSize),
+		socialImageCache:     newSocialImageCache(socialImageCacheSize),
+		socialImageRenders:   make(chan struct{}, maxSocialImageRenders),
+		fullDocs:             newFullDocRenderer(fullDocCacheSize, maxFullDocRenders),
 	}
 	errorPageBytes, err := s.renderErrorPage(context.Background(), http.StatusInternalServerError, "error.tmpl", nil)
 	if err != nil {
 		return nil, fmt.Errorf("s.renderErrorPage(http.StatusInternalServerError, nil): %v", err)
 	}
 	s.errorPage = errorPageBytes
+	if scfg.VanityImportsFile != "" {
+		s.vanityImports, err = newVanityImports(scfg.VanityImportsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return s, nil
 }
 
@@ -97,13 +146,23 @@ func NewServer(scfg ServerConfig) (_ *Server, err error) {
 // cache.
 func (s *Server) Install(handle func(string, http.Handler), redisClient *redis.Client, authValues []string) {
 	var (
-		detailHandler http.Handler = s.errorHandler(s.serveDetails)
-		fetchHandler  http.Handler = s.errorHandler(s.serveFetch)
-		searchHandler http.Handler = s.errorHandler(s.serveSearch)
+		detailHandler       http.Handler = s.errorHandler(s.serveDetails)
+		fetchHandler        http.Handler = s.errorHandler(s.serveFetch)
+		searchHandler       http.Handler = s.errorHandler(s.serveSearch)
+		autocompleteHandler http.Handler = s.errorHandler(s.serveAutoCompletion)
 	)
+	if s.autocompleteQuota.QPS > 0 {
+		autocompleteHandler = middleware.Quota("autocomplete", s.autocompleteQuota, redisClient)(autocompleteHandler)
+	}
 	if redisClient != nil {
-		detailHandler = middleware.Cache("details", redisClient, detailsTTL, authValues)(detailHandler)
-		searchHandler = middleware.Cache("search", redisClient, middleware.TTL(defaultTTL), authValues)(searchHandler)
+		s.fetchLimiter = newFetchLimiter(s.fetchLimiter.settings, redisClient)
+		detailHandler = middleware.Cache("details", redisClient, detailsTTL, detailsGrace, authValues)(detailHandler)
+		searchHandler = middleware.Cache("search", redisClient, middleware.TTL(defaultTTL), nil, authValues)(searchHandler)
+	}
+	if s.vanityImports != nil {
+		// Serve go-import meta tags ahead of the cache, so that they are
+		// always up to date.
+		detailHandler = s.vanityImports.handler(detailHandler)
 	}
 	handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(s.staticPath.String()))))
 	handle("/third_party/", http.StripPrefix("/third_party", http.FileServer(http.Dir(s.thirdPartyPath))))
@@ -111,6 +170,12 @@ func (s *Server) Install(handle func(string, http.Handler), redisClient *redis.C
 		http.ServeFile(w, r, fmt.Sprintf("%s/img/favicon.ico", http.Dir(s.staticPath.String())))
 	}))
 	handle("/fetch/", fetchHandler)
+	handle(apiDocPrefix+"/", s.apiErrorHandler(s.serveDocumentationAPI))
+	handle(apiSearchPath, s.apiErrorHandler(s.serveSearchAPI))
+	handle(apiLatestPrefix+"/", s.apiErrorHandler(s.serveLatestAPI))
+	handle(apiUnitPrefix+"/", s.apiErrorHandler(s.serveUnitAPI))
+	handle("/diff/", s.errorHandler(s.serveDiff))
+	handle("/vuln/", s.errorHandler(s.serveVulns))
 	handle("/play/", http.HandlerFunc(s.handlePlay))
 	handle("/pkg/", http.HandlerFunc(s.handlePackageDetailsRedirect))
 	handle("/search", searchHandler)
@@ -118,13 +183,22 @@ func (s *Server) Install(handle func(string, http.Handler), redisClient *redis.C
 	handle("/license-policy", s.licensePolicyHandler())
 	handle("/about", http.RedirectHandler("https://go.dev/about", http.StatusFound))
 	handle("/badge/", http.HandlerFunc(s.badgeHandler))
+	handle(sitemapPrefix, s.errorHandler(s.serveSitemap))
+	if db, ok := s.getDataSource(context.Background()).(*postgres.DB); ok {
+		// Generate the sitemap now, so that it is ready when it is first
+		// requested.
+		s.sitemap.start(context.Background(), db)
+	}
+	handle(socialImagePrefix, s.errorHandler(s.serveSocialImage))
 	handle("/", detailHandler)
-	handle("/autocomplete", http.HandlerFunc(s.handleAutoCompletion))
+	handle("/autocomplete", autocompleteHandler)
 	handle("/robots.txt", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(`User-agent: *
 Disallow: /search?*
 Disallow: /fetch/*
+
+Sitemap: https://`+r.Host+sitemapIndexPath+`
 `))
 	}))
 }
@@ -140,6 +214,37 @@ const (
 	longTTL = 24 * time.Hour
 )
 
+const (
+	// defaultTimeout bounds the time taken to serve most requests.
+	defaultTimeout = 30 * time.Second
+	// shortTimeout is used for requests that are cheap to serve or not worth
+	// waiting for, like autocompletion and badges.
+	shortTimeout = 5 * time.Second
+	// searchTimeout is used for searches. Shortly before it, a search stops
+	// and shows what it has found so far; see searchTimeMargin.
+	searchTimeout = 20 * time.Second
+	// longTimeout is used for requests known to take a long time, like
+	// fetching a module, listing the importers of a popular package or
+	// generating the sitemap. It is
+	// just under the 60 second timeout of the load balancer.
+	longTimeout = 54 * time.Second
+)
+
+// RequestTimeout returns the time allowed for serving r, for use with
+// middleware.Timeouts.
+func RequestTimeout(r *http.Request) time.Duration {
+	switch {
+	case r.URL.Path == "/autocomplete", strings.HasPrefix(r.URL.Path, "/badge/"):
+		return shortTimeout
+	case r.URL.Path == "/search":
+		return searchTimeout
+	case strings.HasPrefix(r.URL.Path, "/fetch/"), strings.HasPrefix(r.URL.Path, sitemapPrefix),
+		r.URL.Query().Get("tab") == "importedby":
+		return longTimeout
+	}
+	return defaultTimeout
+}
+
 // detailsTTL assigns the cache TTL for package detail requests.
 func detailsTTL(r *http.Request) time.Duration {
 	return detailsTTLForPath(r.Context(), r.URL.Path, r.FormValue("tab"))
@@ -166,6 +271,25 @@ func detailsTTLForPath(ctx context.Context, urlPath, tab string) time.Duration {
 	return longTTL
 }
 
+// detailsGrace assigns the grace period for package detail requests, during
+// which an expired page is still served from the cache while it is refreshed.
+// The home page and the pages of the standard library, which are the most
+// requested, get a long one.
+func detailsGrace(r *http.Request) time.Duration {
+	urlPath := r.URL.Path
+	if urlPath == "/" {
+		return longTTL
+	}
+	if strings.HasPrefix(urlPath, "/mod") {
+		urlPath = strings.TrimPrefix(urlPath, "/mod")
+	}
+	fullPath, _, _, err := parseDetailsURLPath(urlPath)
+	if err == nil && stdlib.Contains(fullPath) {
+		return longTTL
+	}
+	return shortTTL
+}
+
 // TagRoute categorizes incoming requests to the frontend for use in
 // monitoring.
 func TagRoute(route string, r *http.Request) string {
@@ -219,6 +343,10 @@ type basePage struct {
 	// AllowWideContent indicates whether the content should be displayed in a
 	// way that’s amenable to wider viewports.
 	AllowWideContent bool
+
+	// Social, if non-nil, is the content of the Open Graph and Twitter card
+	// meta tags of the page.
+	Social *socialMetadata
 }
 
 // licensePolicyPage is used to generate the static license policy page.
@@ -262,8 +390,9 @@ type errorPage struct {
 }
 
 // PanicHandler returns an http.HandlerFunc that can be used in HTTP
-// middleware. It returns an error if something goes wrong pre-rendering the
-// error template.
+// middleware. It serves the error page, with the incident ID that
+// middleware.Panic gives the panic, so that users can refer to it. It returns
+// an error if something goes wrong pre-rendering the error template.
 func (s *Server) PanicHandler() (_ http.HandlerFunc, err error) {
 	defer derrors.Wrap(&err, "PanicHandler")
 	status := http.StatusInternalServerError
@@ -272,9 +401,25 @@ func (s *Server) PanicHandler() (_ http.HandlerFunc, err error) {
 		return nil, err
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if id := middleware.IncidentID(ctx); id != "" {
+			b, err := s.renderErrorPage(ctx, status, "error.tmpl", &errorPage{
+				messageTemplate: template.MakeTrustedTemplate(`
+					<h3 class="Error-message">{{.Status}}</h3>
+					<p class="Error-message">Incident ID: {{.IncidentID}}</p>`),
+				MessageData: struct{ Status, IncidentID string }{
+					fmt.Sprintf("%d %s", status, http.StatusText(status)), id,
+				},
+			})
+			if err != nil {
+				log.Errorf(ctx, "Error rendering panic template for incident %s: %v", id, err)
+			} else {
+				buf = b
+			}
+		}
 		w.WriteHeader(status)
 		if _, err := io.Copy(w, bytes.NewReader(buf)); err != nil {
-			log.Errorf(r.Context(), "Error copying panic template to ResponseWriter: %v", err)
+			log.Errorf(ctx, "Error copying panic template to ResponseWriter: %v", err)
 		}
 	}, nil
 }
@@ -310,6 +455,12 @@ func (s *Server) serveError(w http.ResponseWriter, r *http.Request, err error) {
 	if !errors.As(err, &serr) {
 		serr = &serverError{status: http.StatusInternalServerError, err: err}
 	}
+	if serr.status == http.StatusInternalServerError && timedOut(ctx, err) {
+		serr = timeoutError(r, err)
+		// Don't let the page be cached anywhere, since it says nothing about
+		// the requested one.
+		w.Header().Set("Cache-Control", "no-store")
+	}
 	if serr.status == http.StatusInternalServerError {
 		log.Error(ctx, err)
 	} else {
@@ -325,6 +476,34 @@ func (s *Server) serveError(w http.ResponseWriter, r *http.Request, err error) {
 	s.serveErrorPage(w, r, serr.status, serr.epage)
 }
 
+// timedOut reports whether err happened because the request ran out of time.
+// Some datasource errors caused by the deadline do not wrap
+// context.DeadlineExceeded, so the request context is checked too.
+func timedOut(ctx context.Context, err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded
+}
+
+// timeoutError returns the error for a request that did not complete within
+// the time given by RequestTimeout. Unlike an internal server error, it tells
+// the user to try again.
+func timeoutError(r *http.Request, err error) *serverError {
+	hint := "Please try again later."
+	if r.URL.Path == "/search" {
+		hint = "Please try again later, or try a more specific query."
+	}
+	return &serverError{
+		status:       http.StatusServiceUnavailable,
+		responseText: "The request took too long to complete.",
+		epage: &errorPage{
+			messageTemplate: template.MakeTrustedTemplate(`
+				<h3 class="Error-message">This page took too long to load.</h3>
+				<p class="Error-message">{{.}}</p>`),
+			MessageData: hint,
+		},
+		err: err,
+	}
+}
+
 func (s *Server) serveErrorPage(w http.ResponseWriter, r *http.Request, status int, page *errorPage) {
 	template := "error.tmpl"
 	if page != nil {
@@ -449,12 +628,14 @@ func parsePageTemplates(base template.TrustedSource) (map[string]*template.Templ
 
 	htmlSets := [][]template.TrustedSource{
 		{tsc("badge.tmpl")},
+		{tsc("diff.tmpl")},
 		{tsc("error.tmpl")},
 		{tsc("fetch.tmpl")},
 		{tsc("index.tmpl")},
 		{tsc("license_policy.tmpl")},
 		{tsc("search.tmpl")},
 		{tsc("search_help.tmpl")},
+		{tsc("vulns.tmpl")},
 		{tsc("overview.tmpl"), tsc("details.tmpl")},
 		{tsc("subdirectories.tmpl"), tsc("details.tmpl")},
 		{tsc("pkg_doc.tmpl"), tsc("details.tmpl")},
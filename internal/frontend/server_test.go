@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"regexp"
 	"strings"
@@ -21,6 +22,7 @@ import (
 	"golang.org/x/net/html"
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/experiment"
+	"golang.org/x/pkgsite/internal/localdatasource"
 	"golang.org/x/pkgsite/internal/middleware"
 	"golang.org/x/pkgsite/internal/postgres"
 	"golang.org/x/pkgsite/internal/proxy"
@@ -147,6 +149,16 @@ var testModules = []testModule{
 }
 
 func insertTestModules(ctx context.Context, t *testing.T, mods []testModule) {
+	for _, m := range buildTestModules(mods) {
+		if err := testDB.InsertModule(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// buildTestModules returns the module versions described by mods.
+func buildTestModules(mods []testModule) []*internal.Module {
+	var ms []*internal.Module
 	for _, mod := range mods {
 		var ps []*internal.LegacyPackage
 		for _, pkg := range mod.packages {
@@ -181,11 +193,10 @@ func insertTestModules(ctx context.Context, t *testing.T, mods []testModule) {
 					u.Licenses = nil
 				}
 			}
-			if err := testDB.InsertModule(ctx, m); err != nil {
-				t.Fatal(err)
-			}
+			ms = append(ms, m)
 		}
 	}
+	return ms
 }
 
 // serverTestCases are the test cases valid for any experiment. For experiments
@@ -377,6 +388,19 @@ func serverTestCases() []serverTestCase {
 			wantStatusCode: http.StatusOK,
 			want:           nil,
 		},
+		{
+			// just check that it returns 200
+			name:           "social image",
+			urlPath:        "/og-image/" + sample.PackagePath + ".png",
+			wantStatusCode: http.StatusOK,
+			want:           nil,
+		},
+		{
+			name:           "social image not found",
+			urlPath:        "/og-image/github.com/no/such/package.png",
+			wantStatusCode: http.StatusNotFound,
+			want:           nil,
+		},
 		{
 			name:           "robots.txt",
 			urlPath:        "/robots.txt",
@@ -388,11 +412,44 @@ func serverTestCases() []serverTestCase {
 			urlPath:        fmt.Sprintf("/search?q=%s", sample.PackageName),
 			wantStatusCode: http.StatusOK,
 			want: in("",
-				in(".SearchResults-resultCount", text("2 results")),
+				// Both packages are in the same module.
+				in(".SearchResults-resultCount", text("1 result")),
 				in(".SearchSnippet-header",
 					in("a",
 						href("/"+sample.ModulePath+"/foo"),
-						text(sample.ModulePath+"/foo")))),
+						text(sample.ModulePath+"/foo"))),
+				in(".SearchSnippet-otherPackages",
+					in("summary", text("1 more package in this module")))),
+		},
+		{
+			name:           "search with filter",
+			urlPath:        fmt.Sprintf("/search?q=%s+module:%s", sample.PackageName, sample.ModulePath),
+			wantStatusCode: http.StatusOK,
+			want: in("",
+				in(".SearchResults-filter", text("module:"+sample.ModulePath)),
+				in(".SearchResults-filterRemove", href("/search?q="+sample.PackageName))),
+		},
+		{
+			name:           "search pins std package name",
+			urlPath:        "/search?q=http",
+			wantStatusCode: http.StatusOK,
+			want: in(".SearchResults-pinned",
+				in(".SearchSnippet-header",
+					in("a", href("/net/http")))),
+		},
+		{
+			name:                "search versioned std path redirect",
+			urlPath:             "/search?q=" + url.QueryEscape("net/http@go1.13"),
+			wantStatusCode:      http.StatusFound,
+			wantLocation:        "/net/http@go1.13",
+			requiredExperiments: experiment.NewSet(internal.ExperimentUsePathInfo),
+		},
+		{
+			name:                "search pasted URL redirect",
+			urlPath:             "/search?q=" + url.QueryEscape("https://pkg.go.dev/"+sample.PackagePath+"?tab=doc"),
+			wantStatusCode:      http.StatusFound,
+			wantLocation:        "/" + sample.PackagePath,
+			requiredExperiments: experiment.NewSet(internal.ExperimentUsePathInfo),
 		},
 		{
 			name:           "package default",
@@ -404,7 +461,11 @@ func serverTestCases() []serverTestCase {
 					in("a",
 						href("/"+sample.ModulePath+"@v1.0.0"),
 						text(sample.ModulePath))),
-				in(".Documentation", text(`This is the documentation HTML`))),
+				in(".Documentation", text(`This is the documentation HTML`)),
+				in(`meta[property="og:title"]`, attr("content", "foo package - "+sample.PackagePath)),
+				in(`meta[property="og:description"]`, attr("content", sample.Synopsis)),
+				in(`meta[property="og:image"]`, attr("content", "https://example.com/og-image/"+sample.PackagePath+".png")),
+				in(`meta[name="twitter:card"]`, attr("content", "summary_large_image"))),
 		},
 		{
 			name:           "package default redirect",
@@ -412,12 +473,31 @@ func serverTestCases() []serverTestCase {
 			wantStatusCode: http.StatusFound,
 			wantLocation:   "/" + sample.ModulePath + "/foo?tab=doc",
 		},
+		{
+			name:           "package default redirect with build context",
+			urlPath:        fmt.Sprintf("/%s?GOOS=windows&GOARCH=amd64", sample.PackagePath),
+			wantStatusCode: http.StatusFound,
+			wantLocation:   "/" + sample.ModulePath + "/foo?GOARCH=amd64&GOOS=windows&tab=doc",
+		},
+		{
+			name:           "package doc missing build context",
+			urlPath:        fmt.Sprintf("/%s?tab=doc&GOOS=windows", sample.PackagePath),
+			wantStatusCode: http.StatusOK,
+			want: in("",
+				in(".Documentation-buildContextNotice",
+					text(`not available for\s+GOOS=windows\.`),
+					text(`closest match, GOOS=linux and GOARCH=amd64`)),
+				in(".Documentation", text(`This is the documentation HTML`)),
+				in("link[rel=canonical]", attr("href", "https://example.com/"+sample.PackagePath+"?tab=doc"))),
+		},
 		{
 			name: "package default nonredistributable",
 			// For a non-redistributable package, the "latest" route goes to the overview tab.
 			urlPath:        "/github.com/non_redistributable/bar?tab=overview",
 			wantStatusCode: http.StatusOK,
-			want:           pagecheck.PackageHeader(pkgNonRedist, unversioned),
+			want: in("",
+				pagecheck.PackageHeader(pkgNonRedist, unversioned),
+				in(`meta[property="og:description"]`, attr("content", "github.com/non_redistributable/bar"))),
 		},
 		{
 			name:           "package at version default",
@@ -911,11 +991,15 @@ func frontendFetchTestCases() []serverTestCase {
 // 5. the tab (overview / doc / imports / ...)
 //
 // We aim to test all combinations of these.
+//
+// Each set of test cases is run against the database, and, unless it depends
+// on fetching modules, against a localdatasource holding the same modules.
 func TestServer(t *testing.T) {
 	for _, test := range []struct {
 		name          string
 		testCasesFunc func() []serverTestCase
 		experiments   []string
+		postgresOnly  bool
 	}{
 		{
 			name:          "no experiments",
@@ -930,24 +1014,38 @@ func TestServer(t *testing.T) {
 			name:          "frontend fetch",
 			testCasesFunc: frontendFetchTestCases,
 			experiments:   []string{internal.ExperimentFrontendFetch, internal.ExperimentUsePathInfo},
+			postgresOnly:  true,
 		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
-			testServer(t, test.testCasesFunc(), test.experiments...)
+			t.Run("postgres", func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+				defer cancel()
+				defer postgres.ResetTestDB(testDB, t)
+
+				// Experiments need to be set in the context, for DB work, and as a
+				// middleware, for request handling.
+				ctx = experiment.NewContext(ctx, test.experiments...)
+				insertTestModules(ctx, t, testModules)
+				testServer(t, testDB, test.testCasesFunc(), test.experiments...)
+			})
+			if test.postgresOnly {
+				return
+			}
+			t.Run("local", func(t *testing.T) {
+				ds := localdatasource.New()
+				for _, m := range buildTestModules(testModules) {
+					ds.Add(m)
+				}
+				testServer(t, ds, test.testCasesFunc(), test.experiments...)
+			})
 		})
 	}
 }
 
-func testServer(t *testing.T, testCases []serverTestCase, experimentNames ...string) {
-	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
-	defer cancel()
-	defer postgres.ResetTestDB(testDB, t)
-
-	// Experiments need to be set in the context, for DB work, and as a
-	// middleware, for request handling.
-	ctx = experiment.NewContext(ctx, experimentNames...)
-	insertTestModules(ctx, t, testModules)
-	_, handler, _ := newTestServer(t, nil, experimentNames...)
+// testServer runs testCases against a server whose data source is ds.
+func testServer(t *testing.T, ds internal.DataSource, testCases []serverTestCase, experimentNames ...string) {
+	_, handler, _ := newTestServerWithDataSource(t, ds, nil, experimentNames...)
 
 	experimentsSet := experiment.NewSet(experimentNames...)
 
@@ -1071,6 +1169,25 @@ func TestDetailsTTL(t *testing.T) {
 	}
 }
 
+func TestDetailsGrace(t *testing.T) {
+	for _, test := range []struct {
+		r    *http.Request
+		want time.Duration
+	}{
+		{mustRequest("/", t), longTTL},
+		{mustRequest("/net/http", t), longTTL},
+		{mustRequest("/net/http@go1.15.2", t), longTTL},
+		{mustRequest("/std", t), longTTL},
+		{mustRequest("/mod/std@go1.15.2", t), longTTL},
+		{mustRequest("/host.com/module@v1.2.3/suffix", t), shortTTL},
+		{mustRequest("/mod/host.com/module", t), shortTTL},
+	} {
+		if got := detailsGrace(test.r); got != test.want {
+			t.Errorf("detailsGrace(%v) = %v, want %v", test.r, got, test.want)
+		}
+	}
+}
+
 func TestTagRoute(t *testing.T) {
 	mustRequest := func(url string) *http.Request {
 		req, err := http.NewRequest("GET", url, nil)
@@ -1097,6 +1214,13 @@ func TestTagRoute(t *testing.T) {
 }
 
 func newTestServer(t *testing.T, proxyModules []*proxy.Module, experimentNames ...string) (*Server, http.Handler, func()) {
+	t.Helper()
+	return newTestServerWithDataSource(t, testDB, proxyModules, experimentNames...)
+}
+
+// newTestServerWithDataSource is like newTestServer, but the server reads
+// from ds. Modules are still fetched into testDB.
+func newTestServerWithDataSource(t *testing.T, ds internal.DataSource, proxyModules []*proxy.Module, experimentNames ...string) (*Server, http.Handler, func()) {
 	t.Helper()
 	proxyClient, teardown := proxy.SetupTestClient(t, proxyModules)
 	sourceClient := source.NewClient(sourceTimeout)
@@ -1108,7 +1232,7 @@ func newTestServer(t *testing.T, proxyModules []*proxy.Module, experimentNames .
 		})
 
 	s, err := NewServer(ServerConfig{
-		DataSourceGetter:     func(context.Context) internal.DataSource { return testDB },
+		DataSourceGetter:     func(context.Context) internal.DataSource { return ds },
 		Queue:                q,
 		TaskIDChangeInterval: 10 * time.Minute,
 		StaticPath:           template.TrustedSourceFromConstant("../../content/static"),
@@ -1131,10 +1255,97 @@ func newTestServer(t *testing.T, proxyModules []*proxy.Module, experimentNames .
 		t.Fatal(err)
 	}
 	mw := middleware.Chain(
-		middleware.LatestVersions(s.GetLatestMinorVersion, s.GetLatestMajorVersion),
-		middleware.Experiment(exp))
+		middleware.LatestVersions(s.GetLatestMinorVersion),
+		middleware.Experiment(exp, 0))
 	return s, mw(mux), func() {
 		teardown()
 		postgres.ResetTestDB(testDB, t)
 	}
 }
+
+func TestPanicHandler(t *testing.T) {
+	s, err := NewServer(ServerConfig{
+		DataSourceGetter: func(context.Context) internal.DataSource { return nil },
+		StaticPath:       template.TrustedSourceFromConstant("../../content/static"),
+		ThirdPartyPath:   "../../third_party",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ph, err := s.PanicHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := middleware.Panic(ph, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/net/http", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	body := w.Body.String()
+	for _, re := range []string{
+		`<h3 class="Error-message">500 Internal Server Error</h3>`,
+		`<p class="Error-message">Incident ID: [0-9a-f]{16}</p>`,
+		`<img class="Error-gopher"`,
+	} {
+		if !regexp.MustCompile(re).MatchString(body) {
+			t.Errorf("body does not match %q:\n%s", re, body)
+		}
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	for _, test := range []struct {
+		url  string
+		want time.Duration
+	}{
+		{"/", defaultTimeout},
+		{"/net/http", defaultTimeout},
+		{"/fmt?tab=importedby", longTimeout},
+		{"/fetch/golang.org/x/net", longTimeout},
+		{"/sitemap/index.xml", longTimeout},
+		{"/sitemap/3.xml", longTimeout},
+		{"/search?q=a", searchTimeout},
+		{"/autocomplete?q=a", shortTimeout},
+		{"/badge/golang.org/x/net", shortTimeout},
+	} {
+		if got := RequestTimeout(httptest.NewRequest("GET", test.url, nil)); got != test.want {
+			t.Errorf("RequestTimeout(%q) = %s, want %s", test.url, got, test.want)
+		}
+	}
+}
+
+func TestTimeoutPage(t *testing.T) {
+	s, err := NewServer(ServerConfig{
+		DataSourceGetter: func(context.Context) internal.DataSource { return nil },
+		StaticPath:       template.TrustedSourceFromConstant("../../content/static"),
+		ThirdPartyPath:   "../../third_party",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := middleware.Timeout(10 * time.Millisecond)(s.errorHandler(func(w http.ResponseWriter, r *http.Request, ds internal.DataSource) error {
+		// A canceled database query need not return a context error.
+		<-r.Context().Done()
+		return fmt.Errorf("pq: canceling statement due to user request")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/fmt?tab=importedby", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("got Cache-Control %q, want %q", got, "no-store")
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`<h3 class="Error-message">This page took too long to load.</h3>`,
+		`<p class="Error-message">Please try again later.</p>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body does not contain %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/safehtml/template"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/postgres"
+)
+
+const (
+	// maxShortcutCandidates is the maximum number of packages listed on the
+	// page for an ambiguous shortcut.
+	maxShortcutCandidates = 20
+
+	// shortcutDominance is how many times more importers than the next
+	// candidate a package needs for a shortcut to redirect to it.
+	shortcutDominance = 10
+)
+
+// packageForShortcut resolves a shortcut path like "yaml", which is neither a
+// package path nor the suffix of a standard library package, to the packages
+// whose name or last path element it is. If one of them is the only one or
+// overwhelmingly the most imported, its path is returned. Otherwise the
+// candidates are returned, most imported first.
+//
+// Shortcuts are only resolved for single-element paths, and only if ds is a
+// *postgres.DB.
+func packageForShortcut(ctx context.Context, ds internal.DataSource, shortcut string) (path string, candidates []*postgres.ShortcutCandidate, err error) {
+	defer derrors.Wrap(&err, "packageForShortcut(ctx, %q)", shortcut)
+
+	db, ok := ds.(*postgres.DB)
+	if !ok || shortcut == "" || strings.Contains(shortcut, "/") {
+		return "", nil, nil
+	}
+	candidates, err = db.GetShortcutCandidates(ctx, shortcut, maxShortcutCandidates)
+	if err != nil {
+		return "", nil, err
+	}
+	if c := dominantCandidate(candidates); c != nil {
+		return c.PackagePath, nil, nil
+	}
+	return "", candidates, nil
+}
+
+// dominantCandidate returns the first of candidates, which are ordered by
+// imported-by count, if it is the only one or has at least shortcutDominance
+// times as many importers as the second. Otherwise it returns nil.
+func dominantCandidate(candidates []*postgres.ShortcutCandidate) *postgres.ShortcutCandidate {
+	switch len(candidates) {
+	case 0:
+		return nil
+	case 1:
+		return candidates[0]
+	}
+	first, second := candidates[0].ImportedByCount, candidates[1].ImportedByCount
+	if first > 0 && first >= shortcutDominance*second {
+		return candidates[0]
+	}
+	return nil
+}
+
+// shortcutCandidatesError returns the error page for an ambiguous shortcut,
+// which lists the packages it may refer to.
+func shortcutCandidatesError(shortcut string, candidates []*postgres.ShortcutCandidate) error {
+	return &serverError{
+		status: http.StatusNotFound,
+		epage: &errorPage{
+			messageTemplate: template.MakeTrustedTemplate(`
+				<h3 class="Error-message">“{{.Shortcut}}” is not a package path.</h3>
+				<p class="Error-message">Did you mean one of these packages?</p>
+				<ul class="Error-candidates">
+				  {{range .Candidates}}
+				    <li>
+				      <a href="/{{.PackagePath}}">{{.PackagePath}}</a>
+				      {{with .Synopsis}}<span class="Error-candidateSynopsis">{{.}}</span>{{end}}
+				    </li>
+				  {{end}}
+				</ul>`),
+			MessageData: struct {
+				Shortcut   string
+				Candidates []*postgres.ShortcutCandidate
+			}{shortcut, candidates},
+		},
+	}
+}
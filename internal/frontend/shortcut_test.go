@@ -0,0 +1,105 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/pkgsite/internal/postgres"
+	"golang.org/x/pkgsite/internal/testing/sample"
+)
+
+func TestServeShortcut(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer postgres.ResetTestDB(testDB, t)
+
+	for _, m := range []struct {
+		path     string
+		suffixes []string
+	}{
+		{"github.com/a/mod", []string{"yaml", "toml"}},
+		{"github.com/b/mod", []string{"yaml", "toml"}},
+		{"github.com/c/mod", []string{"ini"}},
+	} {
+		if err := testDB.InsertModule(ctx, sample.Module(m.path, sample.VersionString, m.suffixes...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// github.com/b/mod/yaml dominates yaml, but the tomls are as popular as
+	// each other.
+	if _, err := testDB.Underlying().Exec(ctx, `
+		UPDATE search_documents SET imported_by_count = 100
+		WHERE package_path IN ('github.com/b/mod/yaml', 'github.com/a/mod/toml', 'github.com/b/mod/toml')`); err != nil {
+		t.Fatal(err)
+	}
+
+	_, handler, teardown := newTestServer(t, nil)
+	defer teardown()
+	for _, test := range []struct {
+		urlPath      string
+		wantStatus   int
+		wantLocation string
+		wantBody     []string
+	}{
+		{"/yaml", http.StatusFound, "/github.com/b/mod/yaml", nil},
+		{"/ini", http.StatusFound, "/github.com/c/mod/ini", nil},
+		{"/toml", http.StatusNotFound, "", []string{
+			`<a href="/github.com/a/mod/toml">github.com/a/mod/toml</a>`,
+			`<a href="/github.com/b/mod/toml">github.com/b/mod/toml</a>`,
+		}},
+	} {
+		t.Run(test.urlPath, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", test.urlPath, nil))
+			if w.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, test.wantStatus)
+			}
+			if got := w.Header().Get("Location"); got != test.wantLocation {
+				t.Errorf("Location = %q, want %q", got, test.wantLocation)
+			}
+			body := w.Body.String()
+			for _, want := range test.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("body does not contain %q:\n%s", want, body)
+				}
+			}
+		})
+	}
+}
+
+func TestDominantCandidate(t *testing.T) {
+	candidates := func(counts ...int) []*postgres.ShortcutCandidate {
+		var cs []*postgres.ShortcutCandidate
+		for _, c := range counts {
+			cs = append(cs, &postgres.ShortcutCandidate{ImportedByCount: c})
+		}
+		return cs
+	}
+	for _, test := range []struct {
+		counts []int
+		want   bool
+	}{
+		{nil, false},
+		{[]int{0}, true},
+		{[]int{100, 10}, true},
+		{[]int{100, 11, 3}, false},
+		{[]int{5, 0}, true},
+		{[]int{0, 0}, false},
+	} {
+		cs := candidates(test.counts...)
+		got := dominantCandidate(cs)
+		if (got != nil) != test.want {
+			t.Errorf("dominantCandidate(%v) = %v, want dominant: %t", test.counts, got, test.want)
+		}
+		if got != nil && got != cs[0] {
+			t.Errorf("dominantCandidate(%v) did not return the first candidate", test.counts)
+		}
+	}
+}
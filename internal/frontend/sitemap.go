@@ -0,0 +1,224 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/log"
+	"golang.org/x/pkgsite/internal/postgres"
+	"golang.org/x/pkgsite/internal/xcontext"
+)
+
+const (
+	sitemapPrefix    = "/sitemap/"
+	sitemapIndexPath = sitemapPrefix + "index.xml"
+
+	// maxSitemapURLs is the maximum number of URLs in a sitemap file,
+	// according to https://www.sitemaps.org/protocol.html.
+	maxSitemapURLs = 50000
+
+	// sitemapRefreshInterval is how long the sitemap is served before it is
+	// regenerated.
+	sitemapRefreshInterval = 6 * time.Hour
+
+	// sitemapTimeout bounds the generation of the sitemap.
+	sitemapTimeout = 5 * time.Minute
+)
+
+// sitemap holds the pages of the sitemap, each listing the range of
+// packages served as one sitemap file. It is generated from the database in
+// the background when the server starts or the sitemap is first requested,
+// and regenerated once it is older than sitemapRefreshInterval, so requests
+// never generate it themselves.
+type sitemap struct {
+	pageSize int
+	ready    chan struct{} // closed when the first generation finishes
+
+	mu         sync.Mutex
+	pages      []*postgres.SitemapPage
+	generated  time.Time
+	refreshing bool
+	err        error // of the last generation
+}
+
+func newSitemap(pageSize int) *sitemap {
+	return &sitemap{pageSize: pageSize, ready: make(chan struct{})}
+}
+
+// start generates the sitemap from db in the background, unless that is
+// already happening. The generation keeps the values of ctx, but not its
+// deadline or cancellation.
+func (sm *sitemap) start(ctx context.Context, db *postgres.DB) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.startLocked(ctx, db)
+}
+
+func (sm *sitemap) startLocked(ctx context.Context, db *postgres.DB) {
+	if sm.refreshing {
+		return
+	}
+	sm.refreshing = true
+	go sm.refresh(xcontext.Detach(ctx), db)
+}
+
+// get returns the pages of the sitemap. If it has never been generated, it
+// waits for the first generation, as long as ctx allows.
+func (sm *sitemap) get(ctx context.Context, db *postgres.DB) ([]*postgres.SitemapPage, error) {
+	sm.mu.Lock()
+	if sm.generated.IsZero() || time.Since(sm.generated) > sitemapRefreshInterval {
+		sm.startLocked(ctx, db)
+	}
+	sm.mu.Unlock()
+	select {
+	case <-sm.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.generated.IsZero() {
+		return nil, fmt.Errorf("sitemap not generated: %v", sm.err)
+	}
+	return sm.pages, nil
+}
+
+// refresh generates the sitemap. On failure, the previous sitemap continues
+// to be served.
+func (sm *sitemap) refresh(ctx context.Context, db *postgres.DB) {
+	ctx, cancel := context.WithTimeout(ctx, sitemapTimeout)
+	defer cancel()
+	pages, err := db.GetSitemapPages(ctx, sm.pageSize)
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.refreshing = false
+	sm.err = err
+	if err != nil {
+		log.Errorf(ctx, "generating sitemap: %v", err)
+	} else {
+		sm.pages = pages
+		sm.generated = time.Now()
+	}
+	select {
+	case <-sm.ready:
+	default:
+		close(sm.ready)
+	}
+}
+
+// serveSitemap serves the sitemap index at /sitemap/index.xml, and the
+// sitemap files it lists at /sitemap/N.xml.
+func (s *Server) serveSitemap(w http.ResponseWriter, r *http.Request, ds internal.DataSource) (err error) {
+	defer derrors.Wrap(&err, "serveSitemap(%q)", r.URL.Path)
+
+	db, ok := ds.(*postgres.DB)
+	if !ok {
+		return &serverError{status: http.StatusNotFound}
+	}
+	pages, err := s.sitemap.get(r.Context(), db)
+	if err != nil {
+		return err
+	}
+	siteURL := "https://" + r.Host
+	var v interface{}
+	if r.URL.Path == sitemapIndexPath {
+		v = sitemapIndex(siteURL, pages)
+	} else {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, sitemapPrefix), ".xml"))
+		if err != nil || n < 0 || n >= len(pages) || r.URL.Path != sitemapFileURL("", n) {
+			return &serverError{status: http.StatusNotFound}
+		}
+		var end string
+		if n+1 < len(pages) {
+			end = pages[n+1].First
+		}
+		entries, err := db.GetSitemapEntries(r.Context(), pages[n].First, end, s.sitemap.pageSize)
+		if err != nil {
+			return err
+		}
+		v = sitemapURLSet(siteURL, entries)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Errorf(r.Context(), "serveSitemap: writing response: %v", err)
+	}
+	return nil
+}
+
+const sitemapXMLNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+type xmlSitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	XMLNS    string       `xml:"xmlns,attr"`
+	Sitemaps []xmlSitemap `xml:"sitemap"`
+}
+
+type xmlSitemap struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type xmlURLSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	URLs    []xmlURL `xml:"url"`
+}
+
+type xmlURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// sitemapIndex returns the sitemap index listing a file for each of pages.
+func sitemapIndex(siteURL string, pages []*postgres.SitemapPage) *xmlSitemapIndex {
+	index := &xmlSitemapIndex{XMLNS: sitemapXMLNS, Sitemaps: []xmlSitemap{}}
+	for n, p := range pages {
+		index.Sitemaps = append(index.Sitemaps, xmlSitemap{
+			Loc:     sitemapFileURL(siteURL, n),
+			LastMod: formatSitemapTime(p.LastModified),
+		})
+	}
+	return index
+}
+
+// sitemapURLSet returns the sitemap file listing entries.
+func sitemapURLSet(siteURL string, entries []*postgres.SitemapEntry) *xmlURLSet {
+	set := &xmlURLSet{XMLNS: sitemapXMLNS}
+	for _, e := range entries {
+		set.URLs = append(set.URLs, xmlURL{
+			Loc:     siteURL + (&url.URL{Path: "/" + e.PackagePath}).EscapedPath(),
+			LastMod: formatSitemapTime(e.LastModified),
+		})
+	}
+	return set
+}
+
+func sitemapFileURL(siteURL string, n int) string {
+	return fmt.Sprintf("%s%s%d.xml", siteURL, sitemapPrefix, n)
+}
+
+func formatSitemapTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal/postgres"
+)
+
+func TestSitemap(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	pages := []*postgres.SitemapPage{
+		{First: "a.com/m/p1", LastModified: t2},
+		{First: "b.com/m", LastModified: t1},
+	}
+	entries := []*postgres.SitemapEntry{
+		{PackagePath: "a.com/m/p1", LastModified: t1},
+		{PackagePath: "a.com/m/p2", LastModified: t2},
+	}
+
+	encode := func(v interface{}) string {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := xml.NewEncoder(&buf).Encode(v); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	const site = "https://pkg.go.dev"
+	got := encode(sitemapIndex(site, pages))
+	want := `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` +
+		`<sitemap><loc>https://pkg.go.dev/sitemap/0.xml</loc><lastmod>2020-02-01T00:00:00Z</lastmod></sitemap>` +
+		`<sitemap><loc>https://pkg.go.dev/sitemap/1.xml</loc><lastmod>2020-01-01T00:00:00Z</lastmod></sitemap>` +
+		`</sitemapindex>`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("index mismatch (-want, +got):\n%s", diff)
+	}
+	got = encode(sitemapURLSet(site, entries))
+	want = `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` +
+		`<url><loc>https://pkg.go.dev/a.com/m/p1</loc><lastmod>2020-01-01T00:00:00Z</lastmod></url>` +
+		`<url><loc>https://pkg.go.dev/a.com/m/p2</loc><lastmod>2020-02-01T00:00:00Z</lastmod></url>` +
+		`</urlset>`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("file mismatch (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/uncheckedconversions"
+)
+
+// siteDescription is the description of pages that do not have their own.
+const siteDescription = "Go is an open source programming language that makes it easy to build simple, reliable, and efficient software."
+
+// maxSocialDescriptionLength is the number of characters that descriptions
+// in social metadata are truncated to.
+const maxSocialDescriptionLength = 200
+
+// socialMetadata is the content of the Open Graph and Twitter card meta tags
+// of a page, which describe the preview shown for links to it.
+type socialMetadata struct {
+	Title       string
+	Description string
+	URL         string
+	// ImageURL is the URL of the image of the preview. If it is empty, the
+	// preview has no image.
+	ImageURL string
+}
+
+// SocialMetaTags returns the Open Graph and Twitter card meta tags for the
+// social metadata of the page, or nothing if it has none. They are built by
+// hand because safehtml does not allow templates to set the content of meta
+// tags.
+func (p basePage) SocialMetaTags() safehtml.HTML {
+	sm := p.Social
+	if sm == nil {
+		return safehtml.HTML{}
+	}
+	var b strings.Builder
+	meta := func(attr, name, content string) {
+		if content != "" {
+			fmt.Fprintf(&b, "<meta %s=%q content=\"%s\">\n", attr, name, html.EscapeString(content))
+		}
+	}
+	card := "summary"
+	if sm.ImageURL != "" {
+		card = "summary_large_image"
+	}
+	meta("property", "og:site_name", "pkg.go.dev")
+	meta("property", "og:type", "website")
+	meta("property", "og:title", sm.Title)
+	meta("property", "og:description", sm.Description)
+	meta("property", "og:url", sm.URL)
+	meta("property", "og:image", sm.ImageURL)
+	meta("name", "twitter:card", card)
+	meta("name", "twitter:title", sm.Title)
+	meta("name", "twitter:description", sm.Description)
+	meta("name", "twitter:image", sm.ImageURL)
+	// The attribute names are constants, and their values are escaped.
+	return uncheckedconversions.HTMLFromStringKnownToSatisfyTypeContract(b.String())
+}
+
+// unitSocialMetadata returns the social metadata of the page of the unit at
+// fullPath, whose HTML title is title. The description is the synopsis of the
+// unit, if it has one and is redistributable, and its path otherwise.
+func unitSocialMetadata(r *http.Request, title, fullPath, synopsis string, isRedistributable bool) *socialMetadata {
+	if !strings.Contains(title, fullPath) {
+		title += " - " + fullPath
+	}
+	description := fullPath
+	if s := sanitizeDescription(synopsis); isRedistributable && s != "" {
+		description = s
+	}
+	return &socialMetadata{
+		Title:       title,
+		Description: description,
+		URL:         "https://" + r.Host + r.URL.Path,
+		ImageURL:    "https://" + r.Host + socialImageURLPath(fullPath),
+	}
+}
+
+// sanitizeDescription removes control characters and extra whitespace from
+// s, and truncates it to maxSocialDescriptionLength characters, between
+// words if possible.
+func sanitizeDescription(s string) string {
+	s = strings.Join(strings.Fields(strings.Map(func(r rune) rune {
+		if r == unicode.ReplacementChar || (unicode.IsControl(r) && !unicode.IsSpace(r)) {
+			return -1
+		}
+		return r
+	}, s)), " ")
+	rs := []rune(s)
+	if len(rs) <= maxSocialDescriptionLength {
+		return s
+	}
+	s = string(rs[:maxSocialDescriptionLength-1])
+	if i := strings.LastIndexByte(s, ' '); i > 0 {
+		s = s[:i]
+	}
+	return s + "…"
+}
@@ -0,0 +1,189 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/log"
+	"golang.org/x/pkgsite/internal/socialcard"
+)
+
+const (
+	socialImagePrefix = "/og-image/"
+
+	// socialImageCacheSize is the number of rendered social images that are
+	// cached, and socialImageTTL is how long they are cached for, both by the
+	// server and by clients.
+	socialImageCacheSize = 1000
+	socialImageTTL       = longTTL
+
+	// socialImageNotFoundTTL is how long the absence of a unit is cached,
+	// so that requests for images of paths that do not exist do not each
+	// query the database.
+	socialImageNotFoundTTL = shortTTL
+
+	// maxSocialImageRenders is the maximum number of social images that
+	// are rendered at once. Rendering is CPU-bound, so further requests
+	// wait.
+	maxSocialImageRenders = 4
+)
+
+// socialImageURLPath returns the path of the social image of the unit at
+// fullPath.
+func socialImageURLPath(fullPath string) string {
+	return socialImagePrefix + fullPath + ".png"
+}
+
+// socialImageCache is an LRU cache of rendered social images, keyed by unit
+// path. A nil image records that there is no unit at the path.
+type socialImageCache struct {
+	mu    sync.Mutex
+	cache *lru.Cache
+}
+
+type socialImageCacheEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+func newSocialImageCache(size int) *socialImageCache {
+	return &socialImageCache{cache: lru.New(size)}
+}
+
+// get returns the cached image of fullPath, and reports whether there was
+// one that has not expired. The image is nil if there is no unit at fullPath.
+func (c *socialImageCache) get(fullPath string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.cache.Get(fullPath)
+	if !ok {
+		return nil, false
+	}
+	e := v.(*socialImageCacheEntry)
+	if time.Now().After(e.expires) {
+		c.cache.Remove(fullPath)
+		return nil, false
+	}
+	return e.data, true
+}
+
+// put caches data as the image of fullPath. A nil image is cached for
+// socialImageNotFoundTTL only, since the unit may be fetched soon.
+func (c *socialImageCache) put(fullPath string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ttl := socialImageTTL
+	if data == nil {
+		ttl = socialImageNotFoundTTL
+	}
+	c.cache.Add(fullPath, &socialImageCacheEntry{
+		data:    data,
+		expires: time.Now().Add(ttl),
+	})
+}
+
+// serveSocialImage serves the social image of the latest version of the unit
+// at <path>, for requests to /og-image/<path>.png.
+func (s *Server) serveSocialImage(w http.ResponseWriter, r *http.Request, ds internal.DataSource) (err error) {
+	defer derrors.Wrap(&err, "serveSocialImage(%q)", r.URL.Path)
+
+	fullPath := strings.TrimPrefix(r.URL.Path, socialImagePrefix)
+	if !strings.HasSuffix(fullPath, ".png") {
+		return &serverError{status: http.StatusNotFound}
+	}
+	fullPath = strings.TrimSuffix(fullPath, ".png")
+	data, ok := s.socialImageCache.get(fullPath)
+	if !ok {
+		select {
+		case s.socialImageRenders <- struct{}{}:
+		case <-r.Context().Done():
+			return r.Context().Err()
+		}
+		data, err = s.renderSocialImage(r.Context(), ds, fullPath)
+		<-s.socialImageRenders
+		if err != nil {
+			if errors.Is(err, derrors.NotFound) || errors.Is(err, derrors.InvalidArgument) {
+				s.socialImageCache.put(fullPath, nil)
+				return &serverError{status: http.StatusNotFound, err: err}
+			}
+			return err
+		}
+		s.socialImageCache.put(fullPath, data)
+	}
+	if data == nil {
+		return &serverError{status: http.StatusNotFound}
+	}
+	w.Header().Set("Content-Type", "image/png")
+	setCacheControl(w, socialImageTTL)
+	if _, err := w.Write(data); err != nil {
+		log.Errorf(r.Context(), "serveSocialImage: writing response: %v", err)
+	}
+	return nil
+}
+
+// renderSocialImage renders the social image of the latest version of the
+// unit at fullPath. Its synopsis is only shown if it is redistributable.
+func (s *Server) renderSocialImage(ctx context.Context, ds internal.DataSource, fullPath string) ([]byte, error) {
+	um, err := ds.GetUnitMeta(ctx, fullPath, internal.UnknownModulePath, internal.LatestVersion)
+	if err != nil {
+		return nil, err
+	}
+	card := &socialcard.Card{
+		Path:    um.Path,
+		Version: displayVersion(um.Version, um.ModulePath),
+	}
+	seen := map[string]bool{}
+	for _, l := range um.Licenses {
+		for _, typ := range l.Types {
+			if !seen[typ] {
+				seen[typ] = true
+				card.Licenses = append(card.Licenses, typ)
+			}
+		}
+	}
+	if um.IsRedistributable && um.IsPackage() {
+		u, err := ds.GetUnit(ctx, um, internal.WithDocumentation)
+		if err != nil {
+			return nil, err
+		}
+		if doc := u.DocumentationFor("", ""); doc != nil {
+			card.Synopsis = doc.Synopsis
+		}
+	}
+	tmpl, err := s.socialCardTemplate()
+	if err != nil {
+		return nil, err
+	}
+	return socialcard.Render(tmpl, card)
+}
+
+// socialCardTemplate returns the image that social cards are drawn on. It
+// is read from the static directory the first time it is needed.
+func (s *Server) socialCardTemplate() (image.Image, error) {
+	s.socialCardOnce.Do(func() {
+		filename := fmt.Sprintf("%s/img/social-card.png", s.staticPath)
+		f, err := os.Open(filename)
+		if err != nil {
+			s.socialCardErr = err
+			return
+		}
+		defer f.Close()
+		s.socialCard, s.socialCardErr = png.Decode(f)
+	})
+	return s.socialCard, s.socialCardErr
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSanitizeDescription(t *testing.T) {
+	long := strings.Repeat("word ", maxSocialDescriptionLength)
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"Package p does\n\tthings.  ", "Package p does things."},
+		{"bad\x00control\x1b chars�", "badcontrol chars"},
+		{long, strings.Repeat("word ", maxSocialDescriptionLength/5-2) + "word…"},
+	} {
+		got := sanitizeDescription(test.in)
+		if got != test.want {
+			t.Errorf("sanitizeDescription(%q) = %q, want %q", test.in, got, test.want)
+		}
+		if n := len([]rune(got)); n > maxSocialDescriptionLength {
+			t.Errorf("sanitizeDescription(%q) has length %d, want at most %d", test.in, n, maxSocialDescriptionLength)
+		}
+	}
+}
+
+func TestUnitSocialMetadata(t *testing.T) {
+	r := httptest.NewRequest("GET", "/github.com/a/b/c?tab=doc", nil)
+	for _, test := range []struct {
+		name              string
+		title, synopsis   string
+		isRedistributable bool
+		want              *socialMetadata
+	}{
+		{
+			name:              "package",
+			title:             "c package",
+			synopsis:          "Package c is  a package.",
+			isRedistributable: true,
+			want: &socialMetadata{
+				Title:       "c package - github.com/a/b/c",
+				Description: "Package c is a package.",
+				URL:         "https://example.com/github.com/a/b/c",
+				ImageURL:    "https://example.com/og-image/github.com/a/b/c.png",
+			},
+		},
+		{
+			name:     "non-redistributable",
+			title:    "github.com/a/b/c directory",
+			synopsis: "Package c is a package.",
+			want: &socialMetadata{
+				Title:       "github.com/a/b/c directory",
+				Description: "github.com/a/b/c",
+				URL:         "https://example.com/github.com/a/b/c",
+				ImageURL:    "https://example.com/og-image/github.com/a/b/c.png",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := unitSocialMetadata(r, test.title, "github.com/a/b/c", test.synopsis, test.isRedistributable)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSocialMetaTags(t *testing.T) {
+	if got := (basePage{}).SocialMetaTags().String(); got != "" {
+		t.Errorf("no social metadata: got %q, want empty", got)
+	}
+	got := basePage{Social: &socialMetadata{
+		Title:       `a "quoted" <title>`,
+		Description: "d & e",
+	}}.SocialMetaTags().String()
+	for _, want := range []string{
+		`<meta property="og:title" content="a &#34;quoted&#34; &lt;title&gt;">`,
+		`<meta name="twitter:description" content="d &amp; e">`,
+		`<meta name="twitter:card" content="summary">`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got\n%s\nwant it to contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "og:image") {
+		t.Errorf("got\n%s\nwant no image", got)
+	}
+}
+
+func TestSocialImageCacheNotFound(t *testing.T) {
+	c := newSocialImageCache(2)
+	c.put("a.com/m", []byte("png"))
+	c.put("a.com/none", nil)
+	if data, ok := c.get("a.com/m"); !ok || string(data) != "png" {
+		t.Errorf(`get("a.com/m") = %q, %t; want "png", true`, data, ok)
+	}
+	if data, ok := c.get("a.com/none"); !ok || data != nil {
+		t.Errorf(`get("a.com/none") = %q, %t; want nil, true`, data, ok)
+	}
+	// The absence of a unit is cached for less time than an image.
+	v, _ := c.cache.Get("a.com/none")
+	if e := v.(*socialImageCacheEntry); e.expires.After(time.Now().Add(socialImageNotFoundTTL)) {
+		t.Errorf("not-found entry expires at %v, want within %v", e.expires, socialImageNotFoundTTL)
+	}
+}
@@ -149,21 +149,21 @@ const (
 
 // fetchDetailsForPackage returns tab details by delegating to the correct detail
 // handler.
-func fetchDetailsForPackage(r *http.Request, tab string, ds internal.DataSource, um *internal.UnitMeta) (interface{}, error) {
+func (s *Server) fetchDetailsForPackage(r *http.Request, tab string, ds internal.DataSource, um *internal.UnitMeta) (interface{}, error) {
 	ctx := r.Context()
 	switch tab {
 	case tabDoc:
-		return fetchDocumentationDetails(ctx, ds, um)
+		return fetchDocumentationDetails(ctx, ds, s.fullDocs, um, r.FormValue("GOOS"), r.FormValue("GOARCH"), r.FormValue("full") == "1")
 	case tabOverview:
 		return fetchPackageOverviewDetails(ctx, ds, um, urlIsVersioned(r.URL))
 	case tabSubdirectories:
-		return fetchDirectoryDetails(ctx, ds, um, false)
+		return fetchSubdirectoriesDetails(r, ds, um, false)
 	case tabVersions:
-		return fetchVersionsDetails(ctx, ds, um.Path, um.ModulePath)
+		return fetchVersionsDetails(ctx, ds, um.Path, um.ModulePath, r.FormValue("devel") == "1")
 	case tabImports:
 		return fetchImportsDetails(ctx, ds, um.Path, um.ModulePath, um.Version)
 	case tabImportedBy:
-		return fetchImportedByDetails(ctx, ds, um.Path, um.ModulePath)
+		return fetchImportedByDetails(ctx, ds, um.Path, um.ModulePath, r.FormValue("cursor"))
 	case tabLicenses:
 		return fetchLicensesDetails(ctx, ds, um)
 	}
@@ -178,9 +178,9 @@ func fetchDetailsForModule(r *http.Request, tab string, ds internal.DataSource,
 	case tabOverview:
 		return fetchOverviewDetails(ctx, ds, um, urlIsVersioned(r.URL))
 	case "packages":
-		return fetchDirectoryDetails(ctx, ds, um, true)
+		return fetchSubdirectoriesDetails(r, ds, um, true)
 	case tabVersions:
-		return fetchModuleVersionsDetails(ctx, ds, um.ModulePath)
+		return fetchModuleVersionsDetails(ctx, ds, um.ModulePath, r.FormValue("devel") == "1")
 	case tabLicenses:
 		return fetchLicensesDetails(ctx, ds, um)
 	}
@@ -195,7 +195,7 @@ func fetchDetailsForDirectory(r *http.Request, tab string, ds internal.DataSourc
 	case tabOverview:
 		return fetchOverviewDetails(ctx, ds, um, urlIsVersioned(r.URL))
 	case tabSubdirectories:
-		return fetchDirectoryDetails(ctx, ds, um, false)
+		return fetchSubdirectoriesDetails(r, ds, um, false)
 	case tabLicenses:
 		return fetchLicensesDetails(ctx, ds, um)
 	}
@@ -0,0 +1,211 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/log"
+)
+
+// A vanityPrefix describes the packages under a vanity import path prefix.
+type vanityPrefix struct {
+	// Prefix is the import path prefix, which is also the root of the
+	// repository, like "go.example.com/tools".
+	Prefix string `json:"prefix"`
+	// VCS and Repo are the version control system and the URL of the
+	// repository, as in the go-import meta tag.
+	VCS  string `json:"vcs"`
+	Repo string `json:"repo"`
+	// Source holds the URL templates of the go-source meta tag. If it is
+	// nil, no go-source meta tag is served.
+	Source *vanitySource `json:"source"`
+	// Proxy is the URL of a module proxy serving the modules under the
+	// prefix. If it is set, a go-import meta tag of the mod form is served as
+	// well.
+	Proxy string `json:"proxy"`
+}
+
+// vanitySource holds the URL templates of a go-source meta tag; see
+// https://github.com/golang/gddo/wiki/Source-Code-Links.
+type vanitySource struct {
+	Home      string `json:"home"`
+	Directory string `json:"directory"`
+	File      string `json:"file"`
+}
+
+// vanityImports serves go-import meta tags for the vanity import paths
+// described in a file, which is reread when it changes.
+type vanityImports struct {
+	filename string
+
+	mu       sync.Mutex
+	modTime  time.Time
+	prefixes []*vanityPrefix // longest first
+}
+
+// newVanityImports returns a vanityImports for the prefixes in filename.
+func newVanityImports(filename string) (_ *vanityImports, err error) {
+	defer derrors.Wrap(&err, "newVanityImports(%q)", filename)
+	v := &vanityImports{filename: filename}
+	if err := v.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// reloadIfChanged rereads the file of v if it was modified since it was last
+// read. Callers must hold v.mu, unless v is not yet shared.
+func (v *vanityImports) reloadIfChanged() error {
+	fi, err := os.Stat(v.filename)
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(v.modTime) {
+		return nil
+	}
+	data, err := ioutil.ReadFile(v.filename)
+	if err != nil {
+		return err
+	}
+	prefixes, err := parseVanityPrefixes(data)
+	if err != nil {
+		return err
+	}
+	v.prefixes = prefixes
+	v.modTime = fi.ModTime()
+	return nil
+}
+
+// parseVanityPrefixes parses and validates a YAML list of vanityPrefixes,
+// and sorts them from longest to shortest.
+func parseVanityPrefixes(data []byte) ([]*vanityPrefix, error) {
+	var prefixes []*vanityPrefix
+	if err := yaml.Unmarshal(data, &prefixes); err != nil {
+		return nil, err
+	}
+	for _, p := range prefixes {
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("prefix %q: %v", p.Prefix, err)
+		}
+	}
+	sort.SliceStable(prefixes, func(i, j int) bool { return len(prefixes[i].Prefix) > len(prefixes[j].Prefix) })
+	return prefixes, nil
+}
+
+func (p *vanityPrefix) validate() error {
+	if p.Prefix == "" || strings.Contains(p.Prefix, "://") || strings.HasPrefix(p.Prefix, "/") || strings.HasSuffix(p.Prefix, "/") {
+		return fmt.Errorf("invalid prefix: %w", derrors.InvalidArgument)
+	}
+	if p.Repo == "" && p.Proxy == "" {
+		return fmt.Errorf("one of repo or proxy must be set: %w", derrors.InvalidArgument)
+	}
+	if p.Repo != "" {
+		switch p.VCS {
+		case "git", "hg", "svn", "bzr", "fossil":
+		default:
+			return fmt.Errorf("unknown vcs %q: %w", p.VCS, derrors.InvalidArgument)
+		}
+		if !isAbsoluteURL(p.Repo) {
+			return fmt.Errorf("repo %q is not an absolute URL: %w", p.Repo, derrors.InvalidArgument)
+		}
+	}
+	if p.Proxy != "" && !isAbsoluteURL(p.Proxy) {
+		return fmt.Errorf("proxy %q is not an absolute URL: %w", p.Proxy, derrors.InvalidArgument)
+	}
+	if p.Source != nil && p.Source.Home == "" {
+		return fmt.Errorf("source must have a home: %w", derrors.InvalidArgument)
+	}
+	return nil
+}
+
+func isAbsoluteURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// lookup returns the prefix that importPath is under, or nil if there is
+// none. If the file of v has changed, it is reread first; if it has become
+// invalid, the prefixes that were last read are used.
+func (v *vanityImports) lookup(ctx context.Context, importPath string) *vanityPrefix {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.reloadIfChanged(); err != nil {
+		log.Errorf(ctx, "vanityImports: reading %q: %v", v.filename, err)
+	}
+	for _, p := range v.prefixes {
+		if importPath == p.Prefix || strings.HasPrefix(importPath, p.Prefix+"/") {
+			return p
+		}
+	}
+	return nil
+}
+
+// handler returns a handler that serves the go-import meta tags for requests
+// with ?go-get=1 on a path under a vanity prefix, and passes other requests
+// to next.
+func (v *vanityImports) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("go-get") != "1" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		importPath := strings.Trim(r.URL.Path, "/")
+		p := v.lookup(r.Context(), importPath)
+		if p == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if _, err := w.Write(vanityPage(p, importPath)); err != nil {
+			log.Errorf(r.Context(), "vanityImports: writing response for %q: %v", importPath, err)
+		}
+	})
+}
+
+// vanityPage returns the page with the meta tags of p for importPath. It is
+// built by hand because safehtml does not allow templates to set the content
+// of meta tags.
+func vanityPage(p *vanityPrefix, importPath string) []byte {
+	var buf bytes.Buffer
+	meta := func(name string, content ...string) {
+		fmt.Fprintf(&buf, "<meta name=%q content=\"%s\">\n", name, html.EscapeString(strings.Join(content, " ")))
+	}
+	buf.WriteString("<!DOCTYPE html>\n<html>\n<head>\n")
+	buf.WriteString("<meta http-equiv=\"Content-Type\" content=\"text/html; charset=utf-8\">\n")
+	if p.Proxy != "" {
+		meta("go-import", p.Prefix, "mod", p.Proxy)
+	}
+	if p.Repo != "" {
+		meta("go-import", p.Prefix, p.VCS, p.Repo)
+	}
+	if src := p.Source; src != nil {
+		dir, file := src.Directory, src.File
+		if dir == "" {
+			dir = "_"
+		}
+		if file == "" {
+			file = "_"
+		}
+		meta("go-source", p.Prefix, src.Home, dir, file)
+	}
+	buf.WriteString("</head>\n<body>\n")
+	fmt.Fprintf(&buf, "<a href=\"/%s\">%[1]s</a>\n", html.EscapeString(importPath))
+	buf.WriteString("</body>\n</html>\n")
+	return buf.Bytes()
+}
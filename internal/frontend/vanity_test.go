@@ -0,0 +1,146 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testVanityImports = `
+- prefix: go.example.com/tools
+  vcs: git
+  repo: https://github.com/example/tools
+  source:
+    home: https://github.com/example/tools
+    directory: https://github.com/example/tools/tree/master{/dir}
+    file: https://github.com/example/tools/blob/master{/dir}/{file}#L{line}
+- prefix: go.example.com/tools/exp
+  vcs: hg
+  repo: https://hg.example.com/exp
+  proxy: https://proxy.example.com
+`
+
+func TestVanityImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vanity-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "vanity.yaml")
+	if err := ioutil.WriteFile(filename, []byte(testVanityImports), 0644); err != nil {
+		t.Fatal(err)
+	}
+	v, err := newVanityImports(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("next"))
+	})
+	handler := v.handler(next)
+	get := func(target string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d, want %d", target, w.Code, http.StatusOK)
+		}
+		return w.Body.String()
+	}
+
+	for _, test := range []struct {
+		target      string
+		want, avoid []string
+	}{
+		{
+			target: "/go.example.com/tools/cmd/stringer?go-get=1",
+			want: []string{
+				`<meta name="go-import" content="go.example.com/tools git https://github.com/example/tools">`,
+				`<meta name="go-source" content="go.example.com/tools https://github.com/example/tools https://github.com/example/tools/tree/master{/dir} https://github.com/example/tools/blob/master{/dir}/{file}#L{line}">`,
+				`<a href="/go.example.com/tools/cmd/stringer">`,
+			},
+			avoid: []string{" mod "},
+		},
+		{
+			target: "/go.example.com/tools?go-get=1",
+			want:   []string{`content="go.example.com/tools git https://github.com/example/tools"`},
+		},
+		{
+			// The longest prefix wins, and proxy-backed prefixes have the mod
+			// form too.
+			target: "/go.example.com/tools/exp/slices?go-get=1",
+			want: []string{
+				`<meta name="go-import" content="go.example.com/tools/exp mod https://proxy.example.com">`,
+				`<meta name="go-import" content="go.example.com/tools/exp hg https://hg.example.com/exp">`,
+			},
+			avoid: []string{"go-source"},
+		},
+		{target: "/go.example.com/toolsx?go-get=1", want: []string{"next"}},
+		{target: "/go.example.com/tools/cmd/stringer", want: []string{"next"}},
+		{target: "/go.example.com/tools?go-get=0", want: []string{"next"}},
+	} {
+		got := get(test.target)
+		for _, w := range test.want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s: got\n%s\nwant it to contain %q", test.target, got, w)
+			}
+		}
+		for _, a := range test.avoid {
+			if strings.Contains(got, a) {
+				t.Errorf("%s: got\n%s\nwant it not to contain %q", test.target, got, a)
+			}
+		}
+	}
+
+	// Changes to the file are picked up; invalid changes are ignored.
+	update := func(contents string, modTime time.Time) {
+		t.Helper()
+		if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filename, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	update("- prefix: go.example.com/other\n  vcs: git\n  repo: https://github.com/example/other\n", time.Now().Add(time.Hour))
+	if got := get("/go.example.com/other/pkg?go-get=1"); !strings.Contains(got, "https://github.com/example/other") {
+		t.Errorf("after update: got\n%s\nwant the new prefix to be served", got)
+	}
+	if got := get("/go.example.com/tools?go-get=1"); got != "next" {
+		t.Errorf("after update: got\n%s\nwant the removed prefix not to be served", got)
+	}
+	update("- prefix: go.example.com/other\n  vcs: cvs\n", time.Now().Add(2*time.Hour))
+	if got := get("/go.example.com/other/pkg?go-get=1"); !strings.Contains(got, "https://github.com/example/other") {
+		t.Errorf("after invalid update: got\n%s\nwant the previous prefixes to be served", got)
+	}
+}
+
+func TestParseVanityPrefixesErrors(t *testing.T) {
+	for _, test := range []struct {
+		name, data string
+	}{
+		{"no prefix", "- vcs: git\n  repo: https://github.com/a/b\n"},
+		{"trailing slash", "- prefix: a.com/b/\n  vcs: git\n  repo: https://github.com/a/b\n"},
+		{"no repo or proxy", "- prefix: a.com/b\n  vcs: git\n"},
+		{"unknown vcs", "- prefix: a.com/b\n  vcs: cvs\n  repo: https://github.com/a/b\n"},
+		{"relative repo", "- prefix: a.com/b\n  vcs: git\n  repo: github.com/a/b\n"},
+		{"bad proxy", "- prefix: a.com/b\n  proxy: proxy\n"},
+		{"source without home", "- prefix: a.com/b\n  vcs: git\n  repo: https://github.com/a/b\n  source:\n    file: https://x.com/{file}\n"},
+		{"not a list", "prefix: a.com/b\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseVanityPrefixes([]byte(test.data)); err == nil {
+				t.Error("got nil error, want non-nil")
+			}
+		})
+	}
+}
@@ -8,13 +8,13 @@ import (
 	"context"
 	"fmt"
 	"path"
+	"sort"
 	"strings"
 
 	"golang.org/x/mod/module"
 	"golang.org/x/mod/semver"
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/log"
-	"golang.org/x/pkgsite/internal/postgres"
 	"golang.org/x/pkgsite/internal/stdlib"
 	"golang.org/x/pkgsite/internal/version"
 )
@@ -47,11 +47,20 @@ type VersionListKey struct {
 // major version) tuple in the version hierarchy.
 type VersionList struct {
 	VersionListKey
-	// Versions holds the nested version summaries, organized in descending
-	// semver order.
+	// Versions holds the release and prerelease versions, organized in
+	// descending semver order.
 	Versions []*VersionSummary
+	// PseudoVersions holds the most recent pseudo-versions, in descending
+	// order, and HiddenPseudoVersions holds the others, which are only shown
+	// on request.
+	PseudoVersions       []*VersionSummary
+	HiddenPseudoVersions []*VersionSummary
 }
 
+// numShownPseudoVersions is the number of pseudo-versions of a VersionList
+// that are shown without expanding it.
+const numShownPseudoVersions = 3
+
 // VersionSummary holds data required to format the version link on the
 // versions tab.
 type VersionSummary struct {
@@ -59,46 +68,90 @@ type VersionSummary struct {
 	// Link to this version, for use in the anchor href.
 	Link    string
 	Version string
+	// Latest reports whether this is the version that pages for the path show
+	// by default, among the versions of the module of the page.
+	Latest bool
+	// Retracted reports whether a go.mod file of the module retracts this
+	// version. RetractionRationale is the explanation given for it, if any.
+	Retracted           bool
+	RetractionRationale string
+	// Deprecation is the deprecation message of the module, or empty if it
+	// is not deprecated.
+	Deprecation string
+	// ChangesURL is the link to the API changes of the package from the
+	// preceding tagged version in the list, or empty if there is none or the
+	// list is of a module.
+	ChangesURL string
 }
 
-func fetchVersionsDetails(ctx context.Context, ds internal.DataSource, fullPath, modulePath string) (*VersionsDetails, error) {
-	db, ok := ds.(*postgres.DB)
-	if !ok {
-		// The proxydatasource does not support the imported by page.
-		return nil, proxydatasourceNotSupportedErr()
-	}
-	versions, err := db.GetVersionsForPath(ctx, fullPath)
+// fetchVersionsDetails returns the versions of the package or directory at
+// fullPath in the module at modulePath. If develFirst is true, the development
+// versions of the standard library are listed above its releases; see
+// promoteDevelVersions.
+func fetchVersionsDetails(ctx context.Context, ds internal.DataSource, fullPath, modulePath string, develFirst bool) (*VersionsDetails, error) {
+	versions, err := ds.GetVersionsForPath(ctx, fullPath)
 	if err != nil {
 		return nil, err
 	}
-	linkify := func(mi *internal.ModuleInfo) string {
-		// Here we have only version information, but need to construct the full
-		// import path of the package corresponding to this version.
-		var versionPath string
+	// Here we have only version information, but need to construct the full
+	// import path of the package corresponding to each version.
+	versionPath := func(mi *internal.ModuleInfo) string {
 		if mi.ModulePath == stdlib.ModulePath {
-			versionPath = fullPath
-		} else {
-			versionPath = pathInVersion(internal.V1Path(fullPath, modulePath), mi)
+			return fullPath
+		}
+		return pathInVersion(internal.V1Path(fullPath, modulePath), mi)
+	}
+	linkify := func(mi *internal.ModuleInfo) string {
+		return constructPackageURL(versionPath(mi), mi.ModulePath, linkVersion(mi.Version, mi.ModulePath))
+	}
+	changesURL := func(older, newer *internal.ModuleInfo) string {
+		if !older.IsRedistributable || !newer.IsRedistributable {
+			return ""
 		}
-		return constructPackageURL(versionPath, mi.ModulePath, linkVersion(mi.Version, mi.ModulePath))
+		return fmt.Sprintf("/diff/%s@%s..%s", versionPath(newer),
+			linkVersion(older.Version, older.ModulePath), linkVersion(newer.Version, newer.ModulePath))
 	}
-	return buildVersionDetails(modulePath, versions, linkify), nil
+	details := buildVersionDetails(modulePath, versions, linkify, changesURL)
+	if develFirst {
+		promoteDevelVersions(details)
+	}
+	return details, nil
 }
 
-func fetchModuleVersionsDetails(ctx context.Context, ds internal.DataSource, modulePath string) (*VersionsDetails, error) {
-	db, ok := ds.(*postgres.DB)
-	if !ok {
-		// The proxydatasource does not support the imported by page.
-		return nil, proxydatasourceNotSupportedErr()
-	}
-	versions, err := db.GetVersionsForPath(ctx, modulePath)
+// fetchModuleVersionsDetails returns the versions of the module at
+// modulePath. develFirst is as for fetchVersionsDetails.
+func fetchModuleVersionsDetails(ctx context.Context, ds internal.DataSource, modulePath string, develFirst bool) (*VersionsDetails, error) {
+	versions, err := ds.GetVersionsForPath(ctx, modulePath)
 	if err != nil {
 		return nil, err
 	}
 	linkify := func(m *internal.ModuleInfo) string {
 		return constructModuleURL(m.ModulePath, linkVersion(m.Version, m.ModulePath))
 	}
-	return buildVersionDetails(modulePath, versions, linkify), nil
+	details := buildVersionDetails(modulePath, versions, linkify, nil)
+	if develFirst {
+		promoteDevelVersions(details)
+	}
+	return details, nil
+}
+
+// promoteDevelVersions moves the development versions of the standard library
+// in details, the snapshots of its master branch, from the pseudo-versions
+// folded after its releases to the top of its list. By semver, the
+// pseudo-versions of the snapshots sort below all releases, which is where
+// they are listed unless this is explicitly requested.
+func promoteDevelVersions(details *VersionsDetails) {
+	for _, vls := range [][]*VersionList{details.ThisModule, details.OtherModules} {
+		for _, vl := range vls {
+			if vl.ModulePath != stdlib.ModulePath {
+				continue
+			}
+			devel := append(vl.PseudoVersions, vl.HiddenPseudoVersions...)
+			vl.Versions = append(devel, vl.Versions...)
+			vl.PseudoVersions = nil
+			vl.HiddenPseudoVersions = nil
+		}
+	}
 }
 
 // pathInVersion constructs the full import path of the package corresponding
@@ -123,70 +176,174 @@ func pathInVersion(v1Path string, mi *internal.ModuleInfo) string {
 
 // buildVersionDetails constructs the version hierarchy to be rendered on the
 // versions tab, organizing major versions into those that have the same module
-// path as the package version under consideration, and those that don't.  The
-// given versions MUST be sorted first by module path and then by semver.
-func buildVersionDetails(currentModulePath string, modInfos []*internal.ModuleInfo, linkify func(v *internal.ModuleInfo) string) *VersionsDetails {
+// path as the package version under consideration, and those that don't. The
+// version lists of each are sorted by descending major version, and the
+// pseudo-versions of each list are folded after its tagged versions. The
+// tagged versions and the pseudo-versions of each module path MUST each be in
+// descending semver order.
+//
+// If changesURL is not nil, it is called with each pair of consecutive tagged
+// versions in a list to get the ChangesURL of the newer one.
+func buildVersionDetails(currentModulePath string, modInfos []*internal.ModuleInfo, linkify func(v *internal.ModuleInfo) string,
+	changesURL func(older, newer *internal.ModuleInfo) string) *VersionsDetails {
 
 	// lists organizes versions by VersionListKey. Note that major version isn't
 	// sufficient as a key: there are packages contained in the same major
 	// version of different modules, for example github.com/hashicorp/vault/api,
 	// which exists in v1 of both of github.com/hashicorp/vault and
 	// github.com/hashicorp/vault/api.
-	lists := make(map[VersionListKey][]*VersionSummary)
+	lists := make(map[VersionListKey]*VersionList)
 	// seenLists tracks the order in which we encounter entries of each version
-	// list. We want to preserve this order.
+	// list. We want to preserve this order among lists of the same major
+	// version.
 	var seenLists []VersionListKey
-	for _, mi := range modInfos {
-		// Try to resolve the most appropriate major version for this version. If
-		// we detect a +incompatible version (when the path version does not match
-		// the sematic version), we prefer the path version.
-		major := semver.Major(mi.Version)
-		if mi.ModulePath == stdlib.ModulePath {
-			var err error
-			major, err = stdlib.MajorVersionForVersion(mi.Version)
-			if err != nil {
-				panic(err)
-			}
-		}
-		if _, pathMajor, ok := module.SplitPathVersion(mi.ModulePath); ok {
-			// We prefer the path major version except for v1 import paths where the
-			// semver major version is v0. In this case, we prefer the more specific
-			// semver version.
-			if pathMajor != "" {
-				// Trim both '/' and '.' from the path major version to account for
-				// standard and gopkg.in module paths.
-				major = strings.TrimLeft(pathMajor, "/.")
-			} else if major != "v0" && !strings.HasPrefix(major, "go") {
-				major = "v1"
-			}
-		}
-		key := VersionListKey{ModulePath: mi.ModulePath, Major: major}
+	retractions := collectRetractions(modInfos)
+	summaries := make([]*VersionSummary, len(modInfos))
+	for i, mi := range modInfos {
 		vs := &VersionSummary{
-			Link:       linkify(mi),
-			CommitTime: elapsedTime(mi.CommitTime),
-			Version:    linkVersion(mi.Version, mi.ModulePath),
+			Link:        linkify(mi),
+			CommitTime:  elapsedTime(mi.CommitTime),
+			Version:     linkVersion(mi.Version, mi.ModulePath),
+			Deprecation: mi.Deprecation,
 		}
-		if _, ok := lists[key]; !ok {
+		vs.Retracted, vs.RetractionRationale = retraction(mi, retractions)
+		summaries[i] = vs
+	}
+	if i := latestVersionIndex(currentModulePath, modInfos, summaries); i >= 0 {
+		summaries[i].Latest = true
+	}
+
+	// lastTagged holds the index in modInfos of the last tagged version
+	// added to each list.
+	lastTagged := map[VersionListKey]int{}
+	for i, mi := range modInfos {
+		key := VersionListKey{ModulePath: mi.ModulePath, Major: versionListMajor(mi)}
+		vl, ok := lists[key]
+		if !ok {
+			vl = &VersionList{VersionListKey: key}
+			lists[key] = vl
 			seenLists = append(seenLists, key)
 		}
-		lists[key] = append(lists[key], vs)
+		vs := summaries[i]
+		switch {
+		case !version.IsPseudo(mi.Version):
+			if j, ok := lastTagged[key]; ok && changesURL != nil {
+				summaries[j].ChangesURL = changesURL(mi, modInfos[j])
+			}
+			lastTagged[key] = i
+			vl.Versions = append(vl.Versions, vs)
+		case len(vl.PseudoVersions) < numShownPseudoVersions:
+			vl.PseudoVersions = append(vl.PseudoVersions, vs)
+		default:
+			vl.HiddenPseudoVersions = append(vl.HiddenPseudoVersions, vs)
+		}
 	}
 
 	var details VersionsDetails
 	for _, key := range seenLists {
-		vl := &VersionList{
-			VersionListKey: key,
-			Versions:       lists[key],
-		}
 		if key.ModulePath == currentModulePath {
-			details.ThisModule = append(details.ThisModule, vl)
+			details.ThisModule = append(details.ThisModule, lists[key])
 		} else {
-			details.OtherModules = append(details.OtherModules, vl)
+			details.OtherModules = append(details.OtherModules, lists[key])
 		}
 	}
+	for _, vls := range [][]*VersionList{details.ThisModule, details.OtherModules} {
+		sort.SliceStable(vls, func(i, j int) bool {
+			return semver.Compare(vls[i].Major, vls[j].Major) > 0
+		})
+	}
 	return &details
 }
 
+// versionListMajor returns the major version of the list that mi belongs to.
+// The major version of a module path, like "/v2" or ".v2", is preferred to
+// that of the version, so that v0 and v1 versions of the same module are in
+// different lists, while +incompatible versions are under their own major
+// version.
+func versionListMajor(mi *internal.ModuleInfo) string {
+	if mi.ModulePath == stdlib.ModulePath {
+		major, err := stdlib.MajorVersionForVersion(mi.Version)
+		if err != nil {
+			panic(err)
+		}
+		return major
+	}
+	if _, pathMajor, ok := module.SplitPathVersion(mi.ModulePath); ok && pathMajor != "" {
+		// Trim both '/' and '.' from the path major version to account for
+		// standard and gopkg.in module paths.
+		return strings.TrimLeft(pathMajor, "/.")
+	}
+	return semver.Major(mi.Version)
+}
+
+// collectRetractions maps each module path in modInfos to the retractions in
+// the go.mod files of its versions.
+func collectRetractions(modInfos []*internal.ModuleInfo) map[string][]internal.RetractedVersion {
+	retractions := map[string][]internal.RetractedVersion{}
+	for _, mi := range modInfos {
+		retractions[mi.ModulePath] = append(retractions[mi.ModulePath], mi.RetractedVersions...)
+	}
+	return retractions
+}
+
+// retraction reports whether mi is retracted, either by the go.mod file of
+// the latest version of its module or by one of retractions, and the
+// rationale for the retraction.
+func retraction(mi *internal.ModuleInfo, retractions map[string][]internal.RetractedVersion) (bool, string) {
+	if mi.Retracted {
+		return true, mi.RetractionRationale
+	}
+	for _, rv := range retractions[mi.ModulePath] {
+		if rv.Retracts(mi.Version) {
+			return true, rv.Rationale
+		}
+	}
+	return false, ""
+}
+
+// latestVersionIndex returns the index in modInfos of the version of
+// modulePath that pages show by default, or -1 if modInfos has no versions
+// of modulePath. The versions of other modules, such as other major versions,
+// are not considered. Like the database, it prefers versions that are not
+// retracted, then compatible versions, then release versions, and then higher
+// versions. summaries[i] holds the retraction status of modInfos[i].
+func latestVersionIndex(modulePath string, modInfos []*internal.ModuleInfo, summaries []*VersionSummary) int {
+	latest := -1
+	better := func(i, j int) bool {
+		a, b := modInfos[i], modInfos[j]
+		if ra, rb := summaries[i].Retracted, summaries[j].Retracted; ra != rb {
+			return !ra
+		}
+		if ia, ib := isIncompatible(a.Version), isIncompatible(b.Version); ia != ib {
+			return !ia
+		}
+		if ra, rb := isRelease(a.Version), isRelease(b.Version); ra != rb {
+			return ra
+		}
+		return semver.Compare(a.Version, b.Version) > 0
+	}
+	for i, mi := range modInfos {
+		if mi.ModulePath != modulePath {
+			continue
+		}
+		if latest < 0 || better(i, latest) {
+			latest = i
+		}
+	}
+	return latest
+}
+
+// isIncompatible reports whether v is a +incompatible version.
+func isIncompatible(v string) bool {
+	return strings.HasSuffix(v, "+incompatible")
+}
+
+// isRelease reports whether v is a release version.
+func isRelease(v string) bool {
+	vt, err := version.ParseType(v)
+	return err == nil && vt == version.TypeRelease
+}
+
 // formatVersion formats a more readable representation of the given version
 // string. On any parsing error, it simply returns the input unmodified.
 //
@@ -230,8 +387,17 @@ func pseudoVersionRev(v string) string {
 }
 
 // displayVersion returns the version string, formatted for display.
+// Development versions of the standard library are shown as the master branch
+// at a commit, like "master (8ea2fd3)".
 func displayVersion(v string, modulePath string) string {
 	if modulePath == stdlib.ModulePath {
+		if version.IsPseudo(v) {
+			rev := pseudoVersionRev(v)
+			if len(rev) > 7 {
+				rev = rev[:7]
+			}
+			return fmt.Sprintf("%s (%s)", stdlib.MasterVersion, rev)
+		}
 		return goTagForVersion(v)
 	}
 	return formatVersion(v)
@@ -6,11 +6,14 @@ package frontend
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/postgres"
+	"golang.org/x/pkgsite/internal/stdlib"
 	"golang.org/x/pkgsite/internal/testing/sample"
 	"golang.org/x/pkgsite/internal/version"
 )
@@ -44,6 +47,38 @@ func versionSummaries(path string, versions []string, linkify func(path, version
 	return vs
 }
 
+// makeVersionList returns the VersionList with key and summaries, with the
+// pseudo-versions folded as buildVersionDetails does.
+func makeVersionList(key VersionListKey, summaries []*VersionSummary) *VersionList {
+	vl := &VersionList{VersionListKey: key}
+	for _, vs := range summaries {
+		switch {
+		case !version.IsPseudo(vs.Version):
+			vl.Versions = append(vl.Versions, vs)
+		case len(vl.PseudoVersions) < numShownPseudoVersions:
+			vl.PseudoVersions = append(vl.PseudoVersions, vs)
+		default:
+			vl.HiddenPseudoVersions = append(vl.HiddenPseudoVersions, vs)
+		}
+	}
+	return vl
+}
+
+// markLatest sets the Latest field of the summary of v in d.
+func markLatest(d *VersionsDetails, v string) {
+	for _, vls := range [][]*VersionList{d.ThisModule, d.OtherModules} {
+		for _, vl := range vls {
+			for _, vss := range [][]*VersionSummary{vl.Versions, vl.PseudoVersions, vl.HiddenPseudoVersions} {
+				for _, vs := range vss {
+					if vs.Version == v {
+						vs.Latest = true
+					}
+				}
+			}
+		}
+	}
+}
+
 func TestFetchModuleVersionDetails(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
 	defer cancel()
@@ -51,12 +86,10 @@ func TestFetchModuleVersionDetails(t *testing.T) {
 	info1 := sample.ModuleInfo(modulePath1, "v1.2.1")
 	info2 := sample.ModuleInfo(modulePath2, "v2.2.1-alpha.1")
 	makeList := func(path, major string, versions []string) *VersionList {
-		return &VersionList{
-			VersionListKey: VersionListKey{ModulePath: path, Major: major},
-			Versions: versionSummaries(path, versions, func(path, version string) string {
+		return makeVersionList(VersionListKey{ModulePath: path, Major: major},
+			versionSummaries(path, versions, func(path, version string) string {
 				return constructModuleURL(path, version)
-			}),
-		}
+			}))
 	}
 
 	for _, tc := range []struct {
@@ -64,6 +97,7 @@ func TestFetchModuleVersionDetails(t *testing.T) {
 		info        *internal.ModuleInfo
 		modules     []*internal.Module
 		wantDetails *VersionsDetails
+		wantLatest  string
 	}{
 		{
 			name: "want v1 first",
@@ -79,11 +113,13 @@ func TestFetchModuleVersionDetails(t *testing.T) {
 			wantDetails: &VersionsDetails{
 				ThisModule: []*VersionList{
 					makeList("test.com/module", "v1", []string{"v1.3.0", "v1.2.3", "v1.2.1"}),
+					makeList("test.com/module", "v0", []string{"v0.0.0-20140414041502-3c2ca4d52544"}),
 				},
 				OtherModules: []*VersionList{
 					makeList("test.com/module/v2", "v2", []string{"v2.2.1-alpha.1", "v2.0.0"}),
 				},
 			},
+			wantLatest: "v1.3.0",
 		},
 		{
 			name: "want v2 first",
@@ -101,9 +137,12 @@ func TestFetchModuleVersionDetails(t *testing.T) {
 					makeList("test.com/module/v2", "v2", []string{"v2.2.1-alpha.1", "v2.0.0"}),
 				},
 				OtherModules: []*VersionList{
-					makeList("test.com/module", "v1", []string{"v1.2.3", "v1.2.1", "v2.1.0+incompatible"}),
+					makeList("test.com/module", "v2", []string{"v2.1.0+incompatible"}),
+					makeList("test.com/module", "v1", []string{"v1.2.3", "v1.2.1"}),
+					makeList("test.com/module", "v0", []string{"v0.0.0-20140414041502-3c2ca4d52544"}),
 				},
 			},
+			wantLatest: "v2.0.0",
 		},
 		{
 			name: "want only pseudo",
@@ -126,6 +165,7 @@ func TestFetchModuleVersionDetails(t *testing.T) {
 					),
 				},
 			},
+			wantLatest: "v2.0.0-20200325151822-abb995c46634",
 		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
@@ -136,7 +176,8 @@ func TestFetchModuleVersionDetails(t *testing.T) {
 					t.Fatal(err)
 				}
 			}
-			got, err := fetchModuleVersionsDetails(ctx, testDB, tc.info.ModulePath)
+			markLatest(tc.wantDetails, tc.wantLatest)
+			got, err := fetchModuleVersionsDetails(ctx, testDB, tc.info.ModulePath, false)
 			if err != nil {
 				t.Fatalf("fetchModuleVersionsDetails(ctx, db, %q): %v", tc.info.ModulePath, err)
 			}
@@ -169,12 +210,14 @@ func TestFetchPackageVersionsDetails(t *testing.T) {
 		LegacyPackage:    *sample.LegacyPackage("std", "net/http"),
 	}
 	makeList := func(pkgPath, modulePath, major string, versions []string) *VersionList {
-		return &VersionList{
-			VersionListKey: VersionListKey{ModulePath: modulePath, Major: major},
-			Versions: versionSummaries(pkgPath, versions, func(path, version string) string {
+		vl := makeVersionList(VersionListKey{ModulePath: modulePath, Major: major},
+			versionSummaries(pkgPath, versions, func(path, version string) string {
 				return constructPackageURL(pkgPath, modulePath, version)
-			}),
+			}))
+		for i := 0; i+1 < len(vl.Versions); i++ {
+			vl.Versions[i].ChangesURL = fmt.Sprintf("/diff/%s@%s..%s", pkgPath, vl.Versions[i+1].Version, vl.Versions[i].Version)
 		}
+		return vl
 	}
 
 	for _, tc := range []struct {
@@ -182,6 +225,7 @@ func TestFetchPackageVersionsDetails(t *testing.T) {
 		pkg         *internal.LegacyVersionedPackage
 		modules     []*internal.Module
 		wantDetails *VersionsDetails
+		wantLatest  string
 	}{
 		{
 			name: "want stdlib versions",
@@ -195,6 +239,7 @@ func TestFetchPackageVersionsDetails(t *testing.T) {
 					makeList("net/http", "std", "go1", []string{"go1.12.5", "go1.11.6"}),
 				},
 			},
+			wantLatest: "go1.12.5",
 		},
 		{
 			name: "want v1 first",
@@ -217,6 +262,7 @@ func TestFetchPackageVersionsDetails(t *testing.T) {
 					makeList(v1Path, "test.com", "v1", []string{"v1.2.1"}),
 				},
 			},
+			wantLatest: "v1.3.0",
 		},
 		{
 			name: "want v2 first",
@@ -234,9 +280,12 @@ func TestFetchPackageVersionsDetails(t *testing.T) {
 					makeList(v2Path, modulePath2, "v2", []string{"v2.2.1-alpha.1", "v2.0.0"}),
 				},
 				OtherModules: []*VersionList{
-					makeList(v1Path, modulePath1, "v1", []string{"v1.2.3", "v1.2.1", "v2.1.0+incompatible"}),
+					makeList(v1Path, modulePath1, "v2", []string{"v2.1.0+incompatible"}),
+					makeList(v1Path, modulePath1, "v1", []string{"v1.2.3", "v1.2.1"}),
+					makeList(v1Path, modulePath1, "v0", []string{"v0.0.0-20140414041502-3c2ca4d52544"}),
 				},
 			},
+			wantLatest: "v2.0.0",
 		},
 		{
 			name: "want only pseudo",
@@ -253,6 +302,8 @@ func TestFetchPackageVersionsDetails(t *testing.T) {
 					}),
 				},
 			},
+			// None of the versions are of the module of the package.
+			wantLatest: "",
 		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
@@ -263,9 +314,10 @@ func TestFetchPackageVersionsDetails(t *testing.T) {
 					t.Fatal(err)
 				}
 			}
+			markLatest(tc.wantDetails, tc.wantLatest)
 
 			t.Run("use-directories", func(t *testing.T) {
-				got, err := fetchVersionsDetails(ctx, testDB, tc.pkg.Path, tc.pkg.ModulePath)
+				got, err := fetchVersionsDetails(ctx, testDB, tc.pkg.Path, tc.pkg.ModulePath, false)
 				if err != nil {
 					t.Fatalf("fetchVersionsDetails(ctx, db, %q, %q): %v", tc.pkg.Path, tc.pkg.ModulePath, err)
 				}
@@ -278,7 +330,8 @@ func TestFetchPackageVersionsDetails(t *testing.T) {
 				if err != nil {
 					t.Fatalf("legacyFetchPackageVersionsDetails(ctx, db, %q, %q, %q): %v", tc.pkg.Path, tc.pkg.V1Path, tc.pkg.ModulePath, err)
 				}
-				if diff := cmp.Diff(tc.wantDetails, got); diff != "" {
+				// The legacy versions tab does not link to API changes.
+				if diff := cmp.Diff(tc.wantDetails, got, cmpopts.IgnoreFields(VersionSummary{}, "ChangesURL")); diff != "" {
 					t.Errorf("mismatch (-want +got):\n%s", diff)
 				}
 			})
@@ -286,6 +339,152 @@ func TestFetchPackageVersionsDetails(t *testing.T) {
 	}
 }
 
+func TestBuildVersionDetails(t *testing.T) {
+	const deprecation = "Use test.com/module/v2."
+	var modInfos []*internal.ModuleInfo
+	for _, mv := range []struct{ path, version string }{
+		{modulePath2, "v2.1.0"},
+		{modulePath2, "v2.0.0"},
+		{modulePath1, "v1.1.0"},
+		{modulePath1, "v1.0.0"},
+		{modulePath1, "v0.0.0-20200104000000-000000000004"},
+		{modulePath1, "v0.0.0-20200103000000-000000000003"},
+		{modulePath1, "v0.0.0-20200102000000-000000000002"},
+		{modulePath1, "v0.0.0-20200101000000-000000000001"},
+		{modulePath1, "v2.0.0+incompatible"},
+	} {
+		mi := sample.ModuleInfo(mv.path, mv.version)
+		if mv.path == modulePath1 {
+			mi.Deprecation = deprecation
+		}
+		modInfos = append(modInfos, mi)
+	}
+	linkify := func(mi *internal.ModuleInfo) string {
+		return constructModuleURL(mi.ModulePath, mi.Version)
+	}
+	changesURL := func(older, newer *internal.ModuleInfo) string {
+		return older.Version + ".." + newer.Version
+	}
+	got := buildVersionDetails(modulePath1, modInfos, linkify, changesURL)
+
+	summaries := func(path string, versions ...string) []*VersionSummary {
+		vs := versionSummaries(path, versions, constructModuleURL)
+		for _, v := range vs {
+			if path == modulePath1 {
+				v.Deprecation = deprecation
+			}
+		}
+		return vs
+	}
+	v2 := summaries(modulePath2, "v2.1.0", "v2.0.0")
+	v2[0].ChangesURL = "v2.0.0..v2.1.0"
+	v1 := summaries(modulePath1, "v1.1.0", "v1.0.0")
+	// v2.1.0 is higher, but it is a version of another module.
+	v1[0].Latest = true
+	v1[0].ChangesURL = "v1.0.0..v1.1.0"
+	v0 := summaries(modulePath1,
+		"v0.0.0-20200104000000-000000000004",
+		"v0.0.0-20200103000000-000000000003",
+		"v0.0.0-20200102000000-000000000002",
+		"v0.0.0-20200101000000-000000000001")
+	want := &VersionsDetails{
+		// The +incompatible version is under its own major version, and the
+		// lists are sorted by major version.
+		ThisModule: []*VersionList{
+			{
+				VersionListKey: VersionListKey{ModulePath: modulePath1, Major: "v2"},
+				Versions:       summaries(modulePath1, "v2.0.0+incompatible"),
+			},
+			{
+				VersionListKey: VersionListKey{ModulePath: modulePath1, Major: "v1"},
+				Versions:       v1,
+			},
+			{
+				VersionListKey:       VersionListKey{ModulePath: modulePath1, Major: "v0"},
+				PseudoVersions:       v0[:numShownPseudoVersions],
+				HiddenPseudoVersions: v0[numShownPseudoVersions:],
+			},
+		},
+		OtherModules: []*VersionList{{
+			VersionListKey: VersionListKey{ModulePath: modulePath2, Major: "v2"},
+			Versions:       v2,
+		}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildVersionDetailsRetracted(t *testing.T) {
+	const rationale = "Published accidentally."
+	var modInfos []*internal.ModuleInfo
+	for _, m := range []*internal.Module{
+		sample.ModuleWithOptions(modulePath1, "v1.2.0", nil,
+			sample.WithRetractedVersions(
+				sample.RetractWithRationale("v1.1.0", rationale),
+				sample.RetractWithRationale("v1.0.0", ""))),
+		sample.Module(modulePath1, "v1.1.0"),
+		sample.Module(modulePath1, "v1.0.0"),
+	} {
+		modInfos = append(modInfos, &m.ModuleInfo)
+	}
+	linkify := func(mi *internal.ModuleInfo) string {
+		return constructModuleURL(mi.ModulePath, mi.Version)
+	}
+	got := buildVersionDetails(modulePath1, modInfos, linkify, nil)
+
+	vs := versionSummaries(modulePath1, []string{"v1.2.0", "v1.1.0", "v1.0.0"}, constructModuleURL)
+	vs[0].Latest = true
+	vs[1].Retracted = true
+	vs[1].RetractionRationale = rationale
+	vs[2].Retracted = true
+	want := &VersionsDetails{
+		ThisModule: []*VersionList{{
+			VersionListKey: VersionListKey{ModulePath: modulePath1, Major: "v1"},
+			Versions:       vs,
+		}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildVersionDetailsRetractedByLatest(t *testing.T) {
+	// v1.3.0 retracts itself, so the versions are marked as retracted by the
+	// worker rather than by the go.mod files of the versions shown here.
+	var modInfos []*internal.ModuleInfo
+	for _, v := range []string{"v1.3.0", "v1.2.0", "v1.1.1", "v1.1.0", "v1.0.0"} {
+		modInfos = append(modInfos, &sample.Module(modulePath1, v).ModuleInfo)
+	}
+	modInfos[0].Retracted = true
+	modInfos[0].RetractionRationale = "Published accidentally."
+	modInfos[1].RetractedVersions = []internal.RetractedVersion{
+		{Version: "v1.1.0", High: "v1.1.9", Rationale: "Broken."},
+	}
+	linkify := func(mi *internal.ModuleInfo) string {
+		return constructModuleURL(mi.ModulePath, mi.Version)
+	}
+	got := buildVersionDetails(modulePath1, modInfos, linkify, nil)
+
+	vs := versionSummaries(modulePath1, []string{"v1.3.0", "v1.2.0", "v1.1.1", "v1.1.0", "v1.0.0"}, constructModuleURL)
+	vs[1].Latest = true
+	vs[0].Retracted = true
+	vs[0].RetractionRationale = "Published accidentally."
+	for _, v := range vs[2:4] {
+		v.Retracted = true
+		v.RetractionRationale = "Broken."
+	}
+	want := &VersionsDetails{
+		ThisModule: []*VersionList{{
+			VersionListKey: VersionListKey{ModulePath: modulePath1, Major: "v1"},
+			Versions:       vs,
+		}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestPathInVersion(t *testing.T) {
 	tests := []struct {
 		v1Path, modulePath, want string
@@ -326,3 +525,61 @@ func TestFormatVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestDisplayVersion(t *testing.T) {
+	for _, test := range []struct {
+		version, modulePath, want string
+	}{
+		{"v1.2.3", sample.ModulePath, "v1.2.3"},
+		{"v1.0.0-20190311183353-d8887717615a", sample.ModulePath, "v1.0.0 (d888771)"},
+		{"v1.14.6", stdlib.ModulePath, "go1.14.6"},
+		{"v1.16.0-rc.1", stdlib.ModulePath, "go1.16rc1"},
+		{"v1.20.14", stdlib.ModulePath, "go1.20.14"},
+		{"v1.21.0", stdlib.ModulePath, "go1.21.0"},
+		{"v1.21.0-rc.2", stdlib.ModulePath, "go1.21rc2"},
+		{"v0.0.0-20201016154802-8ea2fd3b7e95", stdlib.ModulePath, "master (8ea2fd3)"},
+	} {
+		t.Run(test.version, func(t *testing.T) {
+			if got := displayVersion(test.version, test.modulePath); got != test.want {
+				t.Errorf("displayVersion(%q, %q) = %q, want %q", test.version, test.modulePath, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPromoteDevelVersions(t *testing.T) {
+	releases := versionSummaries(stdlib.ModulePath, []string{"v1.15.3", "v1.15.2"}, constructModuleURL)
+	devel := versionSummaries(stdlib.ModulePath, []string{
+		"v0.0.0-20201016154802-8ea2fd3b7e95",
+		"v0.0.0-20201015154802-7ea2fd3b7e95",
+	}, constructModuleURL)
+	details := &VersionsDetails{
+		ThisModule: []*VersionList{
+			{
+				VersionListKey: VersionListKey{ModulePath: stdlib.ModulePath, Major: "go1"},
+				Versions:       releases,
+			},
+			{
+				VersionListKey:       VersionListKey{ModulePath: stdlib.ModulePath, Major: "v0"},
+				PseudoVersions:       devel[:1],
+				HiddenPseudoVersions: devel[1:],
+			},
+		},
+	}
+	promoteDevelVersions(details)
+	want := &VersionsDetails{
+		ThisModule: []*VersionList{
+			{
+				VersionListKey: VersionListKey{ModulePath: stdlib.ModulePath, Major: "go1"},
+				Versions:       releases,
+			},
+			{
+				VersionListKey: VersionListKey{ModulePath: stdlib.ModulePath, Major: "v0"},
+				Versions:       devel,
+			},
+		},
+	}
+	if diff := cmp.Diff(want, details); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
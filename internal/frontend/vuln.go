@@ -0,0 +1,205 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/safehtml"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/experiment"
+	"golang.org/x/pkgsite/internal/log"
+	"golang.org/x/pkgsite/internal/postgres"
+	"golang.org/x/pkgsite/internal/vuln"
+)
+
+// VulnEntry holds the data for displaying an entry of the Go vulnerability
+// database.
+type VulnEntry struct {
+	ID        string
+	Details   string
+	Aliases   []string
+	Published string
+	// Anchor is the ID of the element of the entry on the /vuln/ page, and
+	// URL is the link to it.
+	Anchor   safehtml.Identifier
+	URL      string
+	Affected []*VulnAffected
+}
+
+// VulnAffected describes the versions of a module that a VulnEntry is about.
+type VulnAffected struct {
+	ModulePath string
+	// Packages are the affected packages. If there are none, every package of
+	// the module is affected.
+	Packages []string
+	// Versions describes the affected versions, for example
+	// "from v1.2.0 before v1.3.1".
+	Versions string
+}
+
+// VulnsPage holds the data for the /vuln/ page.
+type VulnsPage struct {
+	basePage
+	Entries []*VulnEntry
+}
+
+// serveVulns serves the /vuln/ page, which lists every entry of the Go
+// vulnerability database that has not been withdrawn.
+func (s *Server) serveVulns(w http.ResponseWriter, r *http.Request, ds internal.DataSource) error {
+	ctx := r.Context()
+	if !experiment.IsActive(ctx, internal.ExperimentVulns) || r.URL.Path != "/vuln/" {
+		return &serverError{status: http.StatusNotFound}
+	}
+	db, ok := ds.(*postgres.DB)
+	if !ok {
+		return proxydatasourceNotSupportedErr()
+	}
+	entries, err := db.GetVulnEntries(ctx)
+	if err != nil {
+		return err
+	}
+	page := &VulnsPage{basePage: s.newBasePage(r, "Vulnerabilities - go.dev")}
+	for _, e := range entries {
+		page.Entries = append(page.Entries, newVulnEntry(e))
+	}
+	s.servePage(ctx, w, "vulns.tmpl", page)
+	return nil
+}
+
+// vulnsForUnit returns the entries that affect the unit with unitPath at
+// modulePath@version, or those that affect any package of the module if
+// unitPath is empty. Vulnerabilities are only shown on a best-effort basis,
+// so errors are logged and nil is returned.
+func vulnsForUnit(ctx context.Context, ds internal.DataSource, unitPath, modulePath, version string) []*VulnEntry {
+	if !experiment.IsActive(ctx, internal.ExperimentVulns) {
+		return nil
+	}
+	db, ok := ds.(*postgres.DB)
+	if !ok {
+		return nil
+	}
+	entries, err := db.GetVulnEntriesForUnit(ctx, unitPath, modulePath, version)
+	if err != nil {
+		log.Errorf(ctx, "vulnsForUnit(%q, %q, %q): %v", unitPath, modulePath, version, err)
+		return nil
+	}
+	var vulns []*VulnEntry
+	for _, e := range entries {
+		vulns = append(vulns, newVulnEntry(e))
+	}
+	return vulns
+}
+
+func newVulnEntry(e *vuln.Entry) *VulnEntry {
+	anchor := vulnAnchor(e.ID)
+	ve := &VulnEntry{
+		ID:      e.ID,
+		Details: e.Details,
+		Aliases: e.Aliases,
+		Anchor:  anchor,
+		URL:     "/vuln/#" + anchor.String(),
+	}
+	if !e.Published.IsZero() {
+		ve.Published = e.Published.Format("Jan _2, 2006")
+	}
+	for i := range e.Affected {
+		a := &e.Affected[i]
+		modulePath := a.ModulePath()
+		ve.Affected = append(ve.Affected, &VulnAffected{
+			ModulePath: modulePath,
+			Packages:   a.PackagePaths(),
+			Versions:   affectedVersions(a, modulePath),
+		})
+	}
+	return ve
+}
+
+// vulnAnchor returns the ID of the element for the entry with id on the /vuln/
+// page. Runes that cannot appear in an identifier are replaced by hyphens.
+func vulnAnchor(id string) safehtml.Identifier {
+	return safehtml.IdentifierFromConstantPrefix("vuln", strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '-'
+	}, id))
+}
+
+// affectedVersions returns a description of the versions of modulePath in
+// the semver ranges of a, with versions displayed as they are on unit pages.
+func affectedVersions(a *vuln.Affected, modulePath string) string {
+	if len(a.Ranges) == 0 {
+		return "all versions"
+	}
+	display := func(v string) string {
+		return displayVersion("v"+strings.TrimPrefix(v, "v"), modulePath)
+	}
+	var parts []string
+	for i := range a.Ranges {
+		r := &a.Ranges[i]
+		if r.Type != vuln.RangeTypeSemver {
+			continue
+		}
+		// introduced is the version that opened the current range of
+		// affected versions, or empty if no range is open.
+		var introduced string
+		for _, e := range r.SortedEvents() {
+			switch {
+			case e.Introduced != "":
+				if introduced == "" {
+					introduced = e.Introduced
+				}
+			case introduced == "":
+				// A fix with nothing to fix.
+			case introduced == "0":
+				parts = append(parts, "before "+display(e.Fixed))
+				introduced = ""
+			default:
+				parts = append(parts, fmt.Sprintf("from %s before %s", display(introduced), display(e.Fixed)))
+				introduced = ""
+			}
+		}
+		switch introduced {
+		case "":
+		case "0":
+			parts = append(parts, "all versions")
+		default:
+			parts = append(parts, "from "+display(introduced))
+		}
+	}
+	if len(parts) == 0 {
+		return "no versions"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// addVulnCounts sets the NumVulns field of each of results, whose versions
+// are in versions by package path. Like vulnsForUnit, it logs errors rather
+// than returning them.
+func addVulnCounts(ctx context.Context, ds internal.DataSource, results []*SearchResult, versions map[string]string) {
+	if len(results) == 0 || !experiment.IsActive(ctx, internal.ExperimentVulns) {
+		return
+	}
+	db, ok := ds.(*postgres.DB)
+	if !ok {
+		return
+	}
+	var pkgs []internal.Modver
+	for _, r := range results {
+		pkgs = append(pkgs, internal.Modver{Path: r.PackagePath, Version: versions[r.PackagePath]})
+	}
+	counts, err := db.GetVulnCounts(ctx, pkgs)
+	if err != nil {
+		log.Errorf(ctx, "addVulnCounts: %v", err)
+		return
+	}
+	for _, r := range results {
+		r.NumVulns = counts[internal.Modver{Path: r.PackagePath, Version: versions[r.PackagePath]}]
+	}
+}
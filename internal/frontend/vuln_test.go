@@ -0,0 +1,93 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package frontend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/safehtml"
+	"golang.org/x/pkgsite/internal/stdlib"
+	"golang.org/x/pkgsite/internal/vuln"
+)
+
+func TestAffectedVersions(t *testing.T) {
+	const modulePath = "example.com/mod"
+	semver := func(events ...vuln.RangeEvent) vuln.Range {
+		return vuln.Range{Type: vuln.RangeTypeSemver, Events: events}
+	}
+	intro := func(v string) vuln.RangeEvent { return vuln.RangeEvent{Introduced: v} }
+	fixed := func(v string) vuln.RangeEvent { return vuln.RangeEvent{Fixed: v} }
+	for _, test := range []struct {
+		name       string
+		modulePath string
+		ranges     []vuln.Range
+		want       string
+	}{
+		{"no ranges", modulePath, nil, "all versions"},
+		{"introduced at 0", modulePath, []vuln.Range{semver(intro("0"))}, "all versions"},
+		{"fixed", modulePath, []vuln.Range{semver(intro("0"), fixed("1.2.0"))}, "before v1.2.0"},
+		{"introduced", modulePath, []vuln.Range{semver(intro("1.1.0"))}, "from v1.1.0"},
+		{
+			"unsorted events",
+			modulePath,
+			[]vuln.Range{semver(fixed("1.4.1"), intro("1.3.0"), fixed("1.2.0"), intro("0"))},
+			"before v1.2.0, from v1.3.0 before v1.4.1",
+		},
+		{"fix without introduction", modulePath, []vuln.Range{semver(fixed("1.0.0"))}, "no versions"},
+		{
+			"other range types",
+			modulePath,
+			[]vuln.Range{{Type: "GIT", Events: []vuln.RangeEvent{intro("0")}}},
+			"no versions",
+		},
+		{"stdlib", stdlib.ModulePath, []vuln.Range{semver(intro("1.15.0"), fixed("1.15.7"))}, "from go1.15 before go1.15.7"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := affectedVersions(&vuln.Affected{Ranges: test.ranges}, test.modulePath)
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewVulnEntry(t *testing.T) {
+	e := &vuln.Entry{
+		ID:        "GO-2021-0001",
+		Published: time.Date(2021, 4, 14, 20, 4, 52, 0, time.UTC),
+		Aliases:   []string{"CVE-2021-1234"},
+		Details:   "A vulnerability.",
+		Affected: []vuln.Affected{
+			{
+				Package: vuln.Package{Name: vuln.StdlibName, Ecosystem: "Go"},
+				Ranges: []vuln.Range{{
+					Type:   vuln.RangeTypeSemver,
+					Events: []vuln.RangeEvent{{Introduced: "0"}, {Fixed: "1.16.3"}},
+				}},
+				EcosystemSpecific: vuln.EcosystemSpecific{Imports: []vuln.Import{{Path: "net/http"}}},
+			},
+			{
+				Package: vuln.Package{Name: "golang.org/x/net", Ecosystem: "Go"},
+			},
+		},
+	}
+	want := &VulnEntry{
+		ID:        "GO-2021-0001",
+		Details:   "A vulnerability.",
+		Aliases:   []string{"CVE-2021-1234"},
+		Published: "Apr 14, 2021",
+		Anchor:    safehtml.IdentifierFromConstant("vuln-GO-2021-0001"),
+		URL:       "/vuln/#vuln-GO-2021-0001",
+		Affected: []*VulnAffected{
+			{ModulePath: stdlib.ModulePath, Packages: []string{"net/http"}, Versions: "before go1.16.3"},
+			{ModulePath: "golang.org/x/net", Versions: "all versions"},
+		},
+	}
+	if diff := cmp.Diff(want, newVulnEntry(e), cmp.AllowUnexported(safehtml.Identifier{})); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package godoc
+
+import (
+	"strings"
+)
+
+// Kinds are the kinds of symbols, in the order in which documentation
+// lists them.
+var Kinds = []string{"constant", "variable", "function", "type", "method"}
+
+// An APIDiff describes how the documented API of a package changed from one
+// version to another.
+type APIDiff struct {
+	// Added holds the symbols that are only in the newer version, and
+	// Removed those that are only in the older one.
+	Added   []Symbol
+	Removed []Symbol
+	// Changed holds the symbols whose kind or signature changed.
+	Changed []SymbolChange
+}
+
+// A SymbolChange is a symbol whose kind or signature differs between two
+// versions.
+type SymbolChange struct {
+	Old, New Symbol
+}
+
+// Empty reports whether d has no changes.
+func (d *APIDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff returns the differences between the symbols of an older version of a
+// package, old, and those of a newer one, new. Constants and variables are
+// compared by their own line of the declaration they are part of, so that
+// adding a name to a group does not change the others.
+func Diff(old, new []Symbol) *APIDiff {
+	oldByName := map[string]Symbol{}
+	for _, s := range old {
+		oldByName[s.Name] = s
+	}
+	newByName := map[string]bool{}
+	d := &APIDiff{}
+	for _, s := range new {
+		newByName[s.Name] = true
+		o, ok := oldByName[s.Name]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, s)
+		case o.Kind != s.Kind || comparableSignature(o) != comparableSignature(s):
+			d.Changed = append(d.Changed, SymbolChange{Old: o, New: s})
+		}
+	}
+	for _, s := range old {
+		if !newByName[s.Name] {
+			d.Removed = append(d.Removed, s)
+		}
+	}
+	return d
+}
+
+// comparableSignature returns the part of s's signature that is about s.
+// For constants and variables, that is the line of the declaration that
+// declares s, if it can be found. For other symbols, it is the whole
+// signature.
+func comparableSignature(s Symbol) string {
+	if s.Kind != "constant" && s.Kind != "variable" {
+		return s.Signature
+	}
+	for _, line := range strings.Split(s.Signature, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimPrefix(line, "const ")
+		line = strings.TrimPrefix(line, "var ")
+		// The names come first, separated by commas, and the last one may
+		// be followed by a type.
+		names := line
+		if i := strings.Index(line, "="); i >= 0 {
+			names = line[:i]
+		}
+		for _, n := range strings.Split(names, ",") {
+			if f := strings.Fields(n); len(f) > 0 && f[0] == s.Name {
+				return line
+			}
+		}
+	}
+	return s.Signature
+}
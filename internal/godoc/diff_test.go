@@ -0,0 +1,76 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package godoc
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiff(t *testing.T) {
+	const (
+		oldConsts = "const (\n\tA = 1\n\tB = 2\n)"
+		newConsts = "const (\n\tA = 1\n\tB = 3\n\tC = 4\n)"
+	)
+	old := []Symbol{
+		{Name: "A", Kind: "constant", Signature: oldConsts},
+		{Name: "B", Kind: "constant", Signature: oldConsts},
+		{Name: "Y", Kind: "variable", Signature: "var X, Y int"},
+		{Name: "F", Kind: "function", Signature: "func F()"},
+		{Name: "G", Kind: "function", Signature: "func G()"},
+		{Name: "T", Kind: "type", Signature: "type T int"},
+		{Name: "T.M", Kind: "method", Signature: "func (T) M()"},
+	}
+	new := []Symbol{
+		{Name: "A", Kind: "constant", Signature: newConsts},
+		{Name: "B", Kind: "constant", Signature: newConsts},
+		{Name: "C", Kind: "constant", Signature: newConsts},
+		{Name: "Y", Kind: "variable", Signature: "var X, Y int"},
+		{Name: "F", Kind: "function", Signature: "func F(int)"},
+		{Name: "T", Kind: "type", Signature: "type T int"},
+		{Name: "T.M", Kind: "method", Signature: "func (T) M()"},
+		{Name: "T.N", Kind: "method", Signature: "func (T) N()"},
+	}
+	got := Diff(old, new)
+	want := &APIDiff{
+		Added: []Symbol{
+			{Name: "C", Kind: "constant", Signature: newConsts},
+			{Name: "T.N", Kind: "method", Signature: "func (T) N()"},
+		},
+		Removed: []Symbol{
+			{Name: "G", Kind: "function", Signature: "func G()"},
+		},
+		Changed: []SymbolChange{
+			{Old: old[1], New: new[1]},
+			{Old: old[3], New: new[4]},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+	if got.Empty() {
+		t.Error("Empty() = true, want false")
+	}
+	if d := Diff(old, old); !d.Empty() {
+		t.Errorf("Diff(old, old) = %+v, want no changes", d)
+	}
+}
+
+func TestComparableSignature(t *testing.T) {
+	for _, test := range []struct {
+		name, kind, sig, want string
+	}{
+		{"A", "constant", "const A = 1", "A = 1"},
+		{"B", "constant", "const (\n\tA = 1\n\tB = 2\n)", "B = 2"},
+		{"Y", "variable", "var (\n\tX, Y int = 1, 2\n\tZ string\n)", "X, Y int = 1, 2"},
+		{"Z", "variable", "var (\n\tX, Y int = 1, 2\n\tZ string\n)", "Z string"},
+		{"F", "function", "func F()", "func F()"},
+	} {
+		if got := comparableSignature(Symbol{Name: test.name, Kind: test.kind, Signature: test.sig}); got != test.want {
+			t.Errorf("comparableSignature(%q, %q) = %q, want %q", test.name, test.sig, got, test.want)
+		}
+	}
+}
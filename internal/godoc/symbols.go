@@ -0,0 +1,329 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package godoc holds structured information about a package's API.
+//
+// The API of a package is computed from its go/doc AST when the module is
+// fetched, by dochtml.API, and stored with its documentation. For
+// documentation stored before then, kinds of symbols are recovered from the
+// documentation HTML rendered by the dochtml package.
+package godoc
+
+import (
+	"go/token"
+	"strings"
+
+	"github.com/google/safehtml"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// An API is the documented API of a package for one build context.
+type API struct {
+	// Examples are the package examples.
+	Examples []Example `json:",omitempty"`
+	// Symbols are the documented symbols, in the order in which the
+	// documentation lists them.
+	Symbols []Symbol `json:",omitempty"`
+}
+
+// A Symbol is a documented identifier of a package.
+type Symbol struct {
+	// Name is the identifier, qualified by its type for methods
+	// (for example, "Buffer.Len").
+	Name string
+	// Kind is one of "constant", "variable", "function", "type" or "method".
+	Kind string
+	// Signature is the declaration of the symbol, as Go source.
+	Signature string
+	// Doc is the doc comment as plain text, and DocHTML as HTML.
+	Doc        string    `json:",omitempty"`
+	DocHTML    string    `json:",omitempty"`
+	Deprecated bool      `json:",omitempty"`
+	Examples   []Example `json:",omitempty"`
+}
+
+// An Example is an example of a package or symbol.
+type Example struct {
+	ID     string
+	Suffix string `json:",omitempty"`
+	Code   string
+	Output string `json:",omitempty"`
+}
+
+// Symbols extracts the package examples and the documented symbols from
+// documentation HTML produced by the dochtml package.
+func Symbols(h safehtml.HTML) (_ []Example, _ []Symbol, err error) {
+	defer derrors.Wrap(&err, "godoc.Symbols")
+
+	nodes, err := html.ParseFragment(strings.NewReader(h.String()), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "div",
+		DataAtom: atom.Div,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		examples []Example
+		symbols  []Symbol
+	)
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case hasClass(n, "Documentation-overview"):
+			// Package examples are shown in the overview.
+			examples = append(examples, findExamples(n)...)
+			return
+		case hasClass(n, "Documentation-constants"), hasClass(n, "Documentation-variables"),
+			hasClass(n, "Documentation-typeConstant"), hasClass(n, "Documentation-typeVariable"):
+			symbols = append(symbols, valueSymbols(n)...)
+			return
+		case hasClass(n, "Documentation-function"), hasClass(n, "Documentation-type"),
+			hasClass(n, "Documentation-typeFunc"), hasClass(n, "Documentation-typeMethod"):
+			if s, ok := declSymbol(n); ok {
+				symbols = append(symbols, s)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return examples, symbols, nil
+}
+
+// SymbolKinds returns the kinds of the exported symbols of a package, keyed
+// by name, from its documentation for each build context. The names are
+// those of Documentation.Symbols, along with those of the symbols in the
+// documentation HTML. Symbols whose kind cannot be recovered from the HTML,
+// like struct fields or the symbols of abbreviated documentation, have the
+// empty kind. HTML that cannot be parsed is skipped.
+func SymbolKinds(docs []*internal.Documentation) map[string]string {
+	kinds := map[string]string{}
+	for _, d := range docs {
+		for _, name := range d.Symbols {
+			if _, ok := kinds[name]; !ok {
+				kinds[name] = ""
+			}
+		}
+		_, symbols, err := Symbols(d.HTML)
+		if err != nil {
+			continue
+		}
+		for _, s := range symbols {
+			if isExported(s.Name) {
+				kinds[s.Name] = s.Kind
+			}
+		}
+	}
+	return kinds
+}
+
+// isExported reports whether name, which may be qualified by a type, is
+// exported.
+func isExported(name string) bool {
+	for _, p := range strings.Split(name, ".") {
+		if !token.IsExported(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// declSymbol returns the symbol for a function, type or method element,
+// which holds a header, the declaration, the doc comment and the examples.
+func declSymbol(n *html.Node) (Symbol, bool) {
+	var (
+		s      Symbol
+		doc    []*html.Node
+		header bool
+	)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch {
+		case !header:
+			if c.DataAtom != atom.H3 || attr(c, "data-kind") == "" {
+				return s, false
+			}
+			header = true
+			s.Name = attr(c, "id")
+			s.Kind = attr(c, "data-kind")
+		case s.Signature == "" && c.DataAtom == atom.Pre:
+			s.Signature = strings.TrimSpace(textContent(c))
+		case c.DataAtom == atom.Details:
+			if ex, ok := exampleFromHTML(c); ok {
+				s.Examples = append(s.Examples, ex)
+			}
+		case c.DataAtom == atom.Div:
+			// Nested declarations, which are handled by the caller.
+		default:
+			doc = append(doc, c)
+		}
+	}
+	setDoc(&s, doc)
+	return s, header
+}
+
+// valueSymbols returns the symbols for the constant or variable
+// declarations in n. Each declaration is a <pre> followed by its doc
+// comment, and may declare several names.
+func valueSymbols(n *html.Node) []Symbol {
+	var (
+		symbols []Symbol
+		group   Symbol
+		names   []string
+		doc     []*html.Node
+	)
+	flush := func() {
+		if len(names) == 0 {
+			return
+		}
+		setDoc(&group, doc)
+		for _, name := range names {
+			s := group
+			s.Name = name
+			symbols = append(symbols, s)
+		}
+		group, names, doc = Symbol{}, nil, nil
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		if c.DataAtom == atom.Pre {
+			var (
+				kind string
+				ids  []string
+			)
+			forEachElement(c, func(e *html.Node) {
+				if k := attr(e, "data-kind"); k == "constant" || k == "variable" {
+					kind = k
+					ids = append(ids, attr(e, "id"))
+				}
+			})
+			if len(ids) > 0 {
+				flush()
+				group = Symbol{Kind: kind, Signature: strings.TrimSpace(textContent(c))}
+				names = ids
+				continue
+			}
+		}
+		if len(names) > 0 {
+			doc = append(doc, c)
+		}
+	}
+	flush()
+	return symbols
+}
+
+// setDoc sets the documentation fields of s from the doc comment elements
+// in doc.
+func setDoc(s *Symbol, doc []*html.Node) {
+	var text, buf strings.Builder
+	for _, d := range doc {
+		if hasClass(d, "Documentation-deprecated") {
+			s.Deprecated = true
+		}
+		if text.Len() > 0 {
+			text.WriteString("\n\n")
+		}
+		text.WriteString(strings.TrimSpace(textContent(d)))
+		// Rendering to a strings.Builder cannot fail.
+		_ = html.Render(&buf, d)
+	}
+	s.Doc = text.String()
+	s.DocHTML = buf.String()
+}
+
+// findExamples returns the examples in n.
+func findExamples(n *html.Node) []Example {
+	var examples []Example
+	forEachElement(n, func(e *html.Node) {
+		if ex, ok := exampleFromHTML(e); ok {
+			examples = append(examples, ex)
+		}
+	})
+	return examples
+}
+
+// exampleJSON returns the example rendered in the <details> element n.
+func exampleFromHTML(n *html.Node) (Example, bool) {
+	if n.DataAtom != atom.Details || !hasClass(n, "Documentation-exampleDetails") {
+		return Example{}, false
+	}
+	ex := Example{ID: attr(n, "id")}
+	forEachElement(n, func(e *html.Node) {
+		switch {
+		case e.DataAtom == atom.Summary:
+			// The summary is "Example" or "Example (Suffix)", followed by a
+			// permalink.
+			t := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(textContent(e)), "¶"))
+			if i := strings.Index(t, "("); i >= 0 && strings.HasSuffix(t, ")") {
+				ex.Suffix = t[i+1 : len(t)-1]
+			}
+		case hasClass(e, "Documentation-exampleCode"):
+			ex.Code = strings.TrimSpace(textContent(e))
+		case hasClass(e, "Documentation-exampleOutput"):
+			ex.Output = strings.TrimSpace(textContent(e))
+		}
+	})
+	return ex, true
+}
+
+// forEachElement calls f for each element in the tree rooted at n, including
+// n itself.
+func forEachElement(n *html.Node, f func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		f(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		forEachElement(c, f)
+	}
+}
+
+// textContent returns the concatenated text in the tree rooted at n.
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// attr returns the value of n's attribute key, or the empty string.
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasClass reports whether n is an element with the given class.
+func hasClass(n *html.Node, class string) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package godoc
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/safehtml/testconversions"
+	"golang.org/x/pkgsite/internal"
+)
+
+func TestSymbolKinds(t *testing.T) {
+	// The documentation of a package with a variable V, a function F, and a
+	// struct type T with a field X and a method M, as rendered by dochtml.
+	const docHTML = `<section class="Documentation-variables">
+<pre><span id="V" data-kind="variable"></span>var V int</pre>
+</section><section class="Documentation-functions"><div class="Documentation-function"><h3 id="F" data-kind="function">func F</h3>
+<pre>func F()</pre>
+</div></section><section class="Documentation-types"><div class="Documentation-type"><h3 id="T" data-kind="type">type T</h3>
+<pre><span id="T.X" data-kind="field"></span>type T struct{ X int }</pre>
+<div class="Documentation-typeMethod"><h3 id="T.M" data-kind="method">func (T) M</h3>
+<pre>func (T) M()</pre>
+</div></div></section>`
+	docs := []*internal.Documentation{
+		{
+			GOOS:    "linux",
+			GOARCH:  "amd64",
+			HTML:    testconversions.MakeHTMLForTest(docHTML),
+			Symbols: []string{"F", "T", "T.M", "T.X", "V"},
+		},
+		// Abbreviated documentation, whose symbols are only named.
+		{
+			GOOS:    "windows",
+			GOARCH:  "amd64",
+			Symbols: []string{"F", "G"},
+		},
+	}
+	want := map[string]string{
+		"F":   "function",
+		"G":   "",
+		"T":   "type",
+		"T.M": "method",
+		"T.X": "",
+		"V":   "variable",
+	}
+	if diff := cmp.Diff(want, SymbolKinds(docs)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
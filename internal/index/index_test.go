@@ -6,6 +6,7 @@ package index
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -59,3 +60,45 @@ func TestGetVersions(t *testing.T) {
 		})
 	}
 }
+
+func TestGetVersionsPaged(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	var versions []*internal.IndexVersion
+	for i := 0; i < 5; i++ {
+		versions = append(versions, &internal.IndexVersion{
+			Path:      "github.com/my/module",
+			Version:   fmt.Sprintf("v1.%d.0", i),
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	ix, client, teardown := SetupTestPagedIndex(t, versions)
+	defer teardown()
+
+	got, err := client.GetVersions(ctx, start.Add(time.Minute), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(versions[1:3], got); diff != "" {
+		t.Errorf("GetVersions mismatch (-want +got):\n%s", diff)
+	}
+
+	ix.CutOffNextResponse(1)
+	if _, err := client.GetVersions(ctx, start, 3); err == nil {
+		t.Error("GetVersions of cut off response succeeded, want error")
+	}
+
+	// A late version is served in timestamp order.
+	late := &internal.IndexVersion{Path: "github.com/my/late", Version: "v1.0.0", Timestamp: start.Add(90 * time.Second)}
+	ix.Add(late)
+	got, err = client.GetVersions(ctx, start.Add(time.Minute), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*internal.IndexVersion{versions[1], late, versions[2]}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetVersions mismatch (-want +got):\n%s", diff)
+	}
+}
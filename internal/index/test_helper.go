@@ -7,8 +7,11 @@ package index
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/testing/testhelper"
@@ -47,3 +50,93 @@ func SetupTestIndex(t *testing.T, versions []*internal.IndexVersion) (*Client, f
 	}
 	return client, fn
 }
+
+// A TestIndex is a module index for testing that pages through its versions
+// like the real index: each response holds the versions whose timestamps are
+// at or after the "since" query parameter, up to "limit" of them.
+type TestIndex struct {
+	mu       sync.Mutex
+	versions []*internal.IndexVersion
+	// If cutOff is non-negative, the next response is cut off after that
+	// many versions.
+	cutOff int
+}
+
+// SetupTestPagedIndex creates a TestIndex holding versions. It returns the index, a Client for it and a function for
+// tearing down the index server after the test is completed.
+func SetupTestPagedIndex(t *testing.T, versions []*internal.IndexVersion) (*TestIndex, *Client, func()) {
+	t.Helper()
+
+	ix := &TestIndex{cutOff: -1}
+	ix.Add(versions...)
+	httpClient, server, serverCloseFn := testhelper.SetupTestClientAndServer(http.HandlerFunc(ix.serve))
+	client, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.httpClient = httpClient
+	return ix, client, serverCloseFn
+}
+
+// Add appends versions to the index. Their timestamps may be earlier than
+// those of the versions already there, as when the index publishes a module
+// version late.
+func (ix *TestIndex) Add(versions ...*internal.IndexVersion) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.versions = append(ix.versions, versions...)
+	sort.SliceStable(ix.versions, func(i, j int) bool {
+		return ix.versions[i].Timestamp.Before(ix.versions[j].Timestamp)
+	})
+}
+
+// CutOffNextResponse makes the index stop in the middle of its next response,
+// after n versions, as if the server had crashed.
+func (ix *TestIndex) CutOffNextResponse(n int) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.cutOff = n
+}
+
+func (ix *TestIndex) serve(w http.ResponseWriter, r *http.Request) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	cutOff := ix.cutOff
+	ix.cutOff = -1
+
+	var since time.Time
+	if param := r.FormValue("since"); param != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, param)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 2000
+	if param := r.FormValue("limit"); param != "" {
+		var err error
+		limit, err = strconv.Atoi(param)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var page []*internal.IndexVersion
+	for _, v := range ix.versions {
+		if len(page) < limit && !v.Timestamp.Before(since) {
+			page = append(page, v)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	for i, v := range page {
+		if i == cutOff {
+			// Write part of a version, then drop the connection.
+			w.Write([]byte(`{"Path":`))
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		enc.Encode(v)
+	}
+}
@@ -38,10 +38,21 @@ type LegacyPackage struct {
 	// package.
 	GOOS   string
 	GOARCH string
+	// Documentation holds the documentation for each build context whose
+	// files differ. The first entry matches the fields above.
+	Documentation []*Documentation
+
+	// BuildFailureReason, if non-empty, explains why documentation could not
+	// be generated for the package. DocumentationHTML is empty in that case.
+	BuildFailureReason string
 
 	// V1Path is the package path of a package with major version 1 in a given
 	// series.
 	V1Path string
+
+	// ContentHash is the hash of the package's files and of the properties of
+	// its module that its documentation depends on. See Unit.ContentHash.
+	ContentHash string
 }
 
 // LegacyVersionedPackage is a LegacyPackage along with its corresponding module
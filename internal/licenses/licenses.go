@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"path"
 	"path/filepath"
 	"sort"
@@ -156,6 +157,7 @@ var (
 		"MPL-2.0":              true,
 		"NIST":                 true,
 		"NCSA":                 true,
+		"OFL-1.1":              true,
 		"OpenSSL":              true,
 		"OSL-3.0":              true,
 		"Unlicense":            true,
@@ -229,7 +231,19 @@ func AcceptedLicenses() []AcceptedLicenseInfo {
 	return lics
 }
 
-var checker *licensecheck.Checker = licensecheck.New(licensecheck.BuiltinLicenses())
+var checker *licensecheck.Checker = newChecker()
+
+// newChecker returns a checker for the built-in licenses and extraLicenses.
+func newChecker() *licensecheck.Checker {
+	lics := append(licensecheck.BuiltinLicenses(), extraLicenses...)
+	// licensecheck.New indexes licenses by their position in the list, but
+	// only stores those with text. Put the licenses with text first so the
+	// two agree.
+	sort.SliceStable(lics, func(i, j int) bool {
+		return lics[i].Text != "" && lics[j].Text == ""
+	})
+	return licensecheck.New(lics)
+}
 
 // A Detector detects licenses in a module and its packages.
 type Detector struct {
@@ -373,6 +387,12 @@ func (d *Detector) Files(which WhichFiles) []*zip.File {
 			// Skip if f is in the vendor directory.
 			continue
 		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			// Skip symlinks. The go command doesn't include their targets
+			// in module zips, so there is nothing to read.
+			d.logf("skipping symlink %q", f.Name)
+			continue
+		}
 		if err := module.CheckFilePath(f.Name); err != nil {
 			// Skip if the file path is bad.
 			d.logf("module.CheckFilePath(%q): %v", f.Name, err)
@@ -400,6 +400,47 @@ func TestFiles(t *testing.T) {
 	}
 }
 
+func TestDetectSymlinksOnly(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, target := range map[string]string{
+		"LICENSE":     "../LICENSE",
+		"COPYING":     "docs/COPYING",
+		"foo/LICENSE": "../LICENSE.txt",
+	} {
+		fh := &zip.FileHeader{Name: path.Join("m@v1", name)}
+		fh.SetMode(os.ModeSymlink | 0777)
+		fw, err := zw.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(fw, target); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDetector("m", "v1", zr, nil)
+	if got := d.Files(AllFiles); len(got) != 0 {
+		t.Errorf("Files(AllFiles) returned %d files, want none", len(got))
+	}
+	if got := d.ModuleLicenses(); got != nil {
+		t.Errorf("ModuleLicenses() = %v, want nil", got)
+	}
+	if got := d.AllLicenses(); len(got) != 0 {
+		t.Errorf("AllLicenses() = %v, want none", got)
+	}
+	if d.ModuleIsRedistributable() {
+		t.Error("ModuleIsRedistributable() = true, want false")
+	}
+}
+
 func TestDetectFiles(t *testing.T) {
 	defer func(m uint64) { maxLicenseSize = m }(maxLicenseSize)
 	maxLicenseSize = uint64(len(mitLicense) * 10)
@@ -504,6 +545,22 @@ func TestDetectFiles(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "font license",
+			contents: map[string]string{
+				"fonts/LICENSE": "Copyright 2020 The Go Font Authors\n\n" + oflText,
+			},
+			want: []*Metadata{
+				{
+					Types:    []string{"OFL-1.1"},
+					FilePath: "fonts/LICENSE",
+					Coverage: lc.Coverage{
+						Percent: 100,
+						Match:   []lc.Match{{Name: "OFL-1.1", Type: lc.Other, Percent: 100}},
+					},
+				},
+			},
+		},
 		{
 			name: "apache sans appendix",
 			contents: map[string]string{
@@ -0,0 +1,272 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package localdatasource implements an internal.DataSource over modules
+// held in memory, for running the frontend without a database.
+package localdatasource
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/uncheckedconversions"
+	"golang.org/x/mod/semver"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/version"
+)
+
+var _ internal.DataSource = (*DataSource)(nil)
+
+// New returns a new, empty in-memory datasource.
+func New() *DataSource {
+	return &DataSource{modules: map[string][]*internal.Module{}}
+}
+
+// NewBypassingLicenseCheck returns a new, empty in-memory datasource that
+// bypasses license checks. That means all data will be returned for
+// non-redistributable modules, packages and directories.
+func NewBypassingLicenseCheck() *DataSource {
+	ds := New()
+	ds.bypassLicenseCheck = true
+	return ds
+}
+
+// DataSource implements the internal.DataSource interface over a set of
+// modules, as they would be returned by fetch.FetchModule or built with the
+// sample package.
+//
+// Data that the postgres implementation derives when a module is inserted is
+// computed on demand instead. In particular, whether a version is retracted,
+// and whether its module is deprecated, is decided by the go.mod file of the
+// latest version of the module that has been added.
+type DataSource struct {
+	bypassLicenseCheck bool
+
+	mu sync.RWMutex
+	// modules maps each module path to its versions, in the order they
+	// were added. The modules are never modified.
+	modules map[string][]*internal.Module
+}
+
+// Add adds m to the data source, replacing any module with the same path
+// and version. m must not be modified afterwards.
+func (ds *DataSource) Add(m *internal.Module) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	mods := ds.modules[m.ModulePath]
+	for i, old := range mods {
+		if old.Version == m.Version {
+			mods[i] = m
+			return
+		}
+	}
+	ds.modules[m.ModulePath] = append(mods, m)
+}
+
+// getModule returns the module with modulePath at version, which may be
+// internal.LatestVersion. Since the data source does not know which version a
+// branch refers to, internal.MasterVersion is never found.
+func (ds *DataSource) getModule(modulePath, vers string) (_ *internal.Module, err error) {
+	defer derrors.Wrap(&err, "getModule(%q, %q)", modulePath, vers)
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	mods := ds.modules[modulePath]
+	if vers == internal.LatestVersion {
+		if m := ds.latest(mods); m != nil {
+			return m, nil
+		}
+	}
+	for _, m := range mods {
+		if m.Version == vers {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("module %s@%s: %w", modulePath, vers, derrors.NotFound)
+}
+
+// A unitVersion is a unit of a module version.
+type unitVersion struct {
+	module *internal.Module
+	unit   *internal.Unit
+}
+
+// findUnit returns the unit with fullPath in the module with modulePath at
+// version. Either modulePath or version may be unknown, in which case the
+// latest of the matching units is returned, as for postgres.DB.GetUnitMeta.
+func (ds *DataSource) findUnit(fullPath, modulePath, vers string) (_ *unitVersion, err error) {
+	defer derrors.Wrap(&err, "findUnit(%q, %q, %q)", fullPath, modulePath, vers)
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	var uvs []*unitVersion
+	for mpath, mods := range ds.modules {
+		if modulePath != internal.UnknownModulePath && mpath != modulePath {
+			continue
+		}
+		for _, m := range mods {
+			if vers != internal.LatestVersion && m.Version != vers {
+				continue
+			}
+			for _, u := range m.Units {
+				if u.Path == fullPath {
+					uvs = append(uvs, &unitVersion{m, u})
+					break
+				}
+			}
+		}
+	}
+	if len(uvs) == 0 {
+		return nil, fmt.Errorf("%s in %s@%s: %w", fullPath, modulePath, vers, derrors.NotFound)
+	}
+	sort.Slice(uvs, func(i, j int) bool { return ds.isLater(uvs[i].module, uvs[j].module) })
+	return uvs[0], nil
+}
+
+// latest returns the module in mods that the frontend shows by default, or
+// nil if mods is empty. Callers must hold ds.mu.
+func (ds *DataSource) latest(mods []*internal.Module) *internal.Module {
+	var best *internal.Module
+	for _, m := range mods {
+		if best == nil || ds.isLater(m, best) {
+			best = m
+		}
+	}
+	return best
+}
+
+// isLater reports whether module a should be preferred to module b as the
+// latest version, in the same order as the postgres implementation:
+// unretracted versions come first, then compatible ones, then releases, then
+// higher versions and finally longer module paths. Callers must hold ds.mu.
+func (ds *DataSource) isLater(a, b *internal.Module) bool {
+	if ra, rb := ds.isRetracted(a), ds.isRetracted(b); ra != rb {
+		return !ra
+	}
+	if ia, ib := isIncompatible(a.Version), isIncompatible(b.Version); ia != ib {
+		return !ia
+	}
+	if ra, rb := isRelease(a.Version), isRelease(b.Version); ra != rb {
+		return ra
+	}
+	if c := semver.Compare(a.Version, b.Version); c != 0 {
+		return c > 0
+	}
+	return a.ModulePath > b.ModulePath
+}
+
+// latestModuleVersions returns the latest version of the module with
+// modulePath, as the proxy would report it, along with the retractions and
+// deprecation of its go.mod file. It returns nil if there is no such module.
+// Callers must hold ds.mu.
+func (ds *DataSource) latestModuleVersions(modulePath string) *internal.LatestModuleVersions {
+	var raw *internal.Module
+	for _, m := range ds.modules[modulePath] {
+		if raw == nil || rawVersionRank(m.Version) < rawVersionRank(raw.Version) ||
+			(rawVersionRank(m.Version) == rawVersionRank(raw.Version) && semver.Compare(m.Version, raw.Version) > 0) {
+			raw = m
+		}
+	}
+	if raw == nil {
+		return nil
+	}
+	return &internal.LatestModuleVersions{
+		ModulePath:  modulePath,
+		RawVersion:  raw.Version,
+		Retractions: raw.RetractedVersions,
+		Deprecation: raw.Deprecation,
+	}
+}
+
+// rawVersionRank orders versions by the proxy's preference for the latest
+// version: releases, then prereleases, then pseudo-versions.
+func rawVersionRank(v string) int {
+	vt, err := version.ParseType(v)
+	if err != nil {
+		return 3
+	}
+	switch vt {
+	case version.TypeRelease:
+		return 0
+	case version.TypePrerelease:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// isRetracted reports whether m is retracted by the latest version of its
+// module. Callers must hold ds.mu.
+func (ds *DataSource) isRetracted(m *internal.Module) bool {
+	lmv := ds.latestModuleVersions(m.ModulePath)
+	if lmv == nil {
+		return false
+	}
+	_, ok := lmv.Retraction(m.Version)
+	return ok
+}
+
+// moduleInfo returns a copy of the LegacyModuleInfo of m, with the fields
+// that depend on the latest version of the module set. Callers must hold
+// ds.mu.
+func (ds *DataSource) moduleInfo(m *internal.Module) *internal.LegacyModuleInfo {
+	mi := m.LegacyModuleInfo
+	mi.Retracted = false
+	mi.RetractionRationale = ""
+	mi.Deprecation = ""
+	if lmv := ds.latestModuleVersions(m.ModulePath); lmv != nil {
+		if rv, ok := lmv.Retraction(m.Version); ok {
+			mi.Retracted = true
+			mi.RetractionRationale = rv.Rationale
+		}
+		mi.Deprecation = lmv.Deprecation
+	}
+	if !ds.bypassLicenseCheck {
+		mi.RemoveNonRedistributableData()
+	}
+	return &mi
+}
+
+// allModules returns every module version in the data source, ordered by
+// module path and then version. Callers must hold ds.mu.
+func (ds *DataSource) allModules() []*internal.Module {
+	var mods []*internal.Module
+	for _, ms := range ds.modules {
+		mods = append(mods, ms...)
+	}
+	sort.Slice(mods, func(i, j int) bool {
+		if mods[i].ModulePath != mods[j].ModulePath {
+			return mods[i].ModulePath < mods[j].ModulePath
+		}
+		return semver.Compare(mods[i].Version, mods[j].Version) < 0
+	})
+	return mods
+}
+
+func isRelease(v string) bool {
+	vt, err := version.ParseType(v)
+	return err == nil && vt == version.TypeRelease
+}
+
+func isIncompatible(v string) bool {
+	return strings.HasSuffix(v, "+incompatible")
+}
+
+// packageLinkRegexp matches the cross-package identifier links generated by
+// the dochtml package. See hackUpDocumentation in internal/postgres.
+var packageLinkRegexp = regexp.MustCompile(`(<a href="/)pkg/([^?#"]+)((?:#[^"]*)?">.*?</a>)`)
+
+// convertDocumentation rewrites the links in doc in the same way that the
+// postgres implementation does when it reads documentation, so that pages
+// look the same with either data source.
+func convertDocumentation(doc safehtml.HTML) safehtml.HTML {
+	s := packageLinkRegexp.ReplaceAllString(doc.String(), `$1$2?tab=doc$3`)
+	// The rewrite preserves the safety of doc.
+	return uncheckedconversions.HTMLFromStringKnownToSatisfyTypeContract(s)
+}
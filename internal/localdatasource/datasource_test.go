@@ -0,0 +1,360 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localdatasource
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/stdlib"
+	"golang.org/x/pkgsite/internal/testing/sample"
+)
+
+// testModule returns a sample module with a single package, "pkg", that imports
+// imports.
+func testModule(modulePath, version string, imports ...string) *internal.Module {
+	m := sample.Module(modulePath, version, "pkg")
+	for _, u := range m.Units {
+		if u.Name != "" {
+			u.Imports = imports
+		}
+	}
+	m.LegacyPackages[0].Imports = imports
+	return m
+}
+
+func TestGetUnitMeta(t *testing.T) {
+	ctx := context.Background()
+	ds := New()
+	ds.Add(testModule("a.com/m", "v1.0.0"))
+	ds.Add(testModule("a.com/m", "v1.1.0"))
+	// v1.2.0 retracts itself, so v1.1.0 is the latest version.
+	ds.Add(sample.ModuleWithOptions("a.com/m", "v1.2.0", []string{"pkg"},
+		sample.WithRetractedVersions(sample.RetractWithRationale("v1.2.0", "bad"))))
+	ds.Add(testModule("a.com/m", "v1.3.0-pre"))
+	// The package is also in a nested module, whose path is longer.
+	ds.Add(testModule("a.com/m/pkg", "v1.0.0"))
+
+	for _, test := range []struct {
+		path, modulePath, version string
+		wantModulePath            string
+		wantVersion               string
+		wantRetracted             bool
+	}{
+		{"a.com/m/pkg", "a.com/m", internal.LatestVersion, "a.com/m", "v1.1.0", false},
+		{"a.com/m/pkg", "a.com/m", "v1.2.0", "a.com/m", "v1.2.0", true},
+		{"a.com/m/pkg", internal.UnknownModulePath, internal.LatestVersion, "a.com/m", "v1.1.0", false},
+		{"a.com/m/pkg", internal.UnknownModulePath, "v1.0.0", "a.com/m/pkg", "v1.0.0", false},
+		{"a.com/m", internal.UnknownModulePath, "v1.3.0-pre", "a.com/m", "v1.3.0-pre", false},
+	} {
+		um, err := ds.GetUnitMeta(ctx, test.path, test.modulePath, test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if um.ModulePath != test.wantModulePath || um.Version != test.wantVersion || um.Retracted != test.wantRetracted {
+			t.Errorf("GetUnitMeta(%q, %q, %q) = %s@%s, retracted %t; want %s@%s, retracted %t",
+				test.path, test.modulePath, test.version, um.ModulePath, um.Version, um.Retracted,
+				test.wantModulePath, test.wantVersion, test.wantRetracted)
+		}
+	}
+
+	if _, err := ds.GetUnitMeta(ctx, "a.com/m/other", internal.UnknownModulePath, internal.LatestVersion); !errors.Is(err, derrors.NotFound) {
+		t.Errorf("got %v, want NotFound", err)
+	}
+}
+
+func TestGetVersionsForPath(t *testing.T) {
+	ctx := context.Background()
+	ds := New()
+	for _, v := range []string{"v1.0.0", "v1.1.0-pre", "v2.0.0+incompatible", "v0.0.0-20190101000000-000000000000"} {
+		ds.Add(testModule("a.com/m", v))
+	}
+	ds.Add(testModule("a.com/m/v2", "v2.1.0"))
+	ds.Add(testModule("b.com/m", "v0.0.0-20200101000000-000000000000"))
+	ds.Add(testModule("b.com/m", "v0.0.0-20200201000000-000000000000"))
+
+	for _, test := range []struct {
+		path string
+		want []string
+	}{
+		{"a.com/m/pkg", []string{"a.com/m/v2@v2.1.0", "a.com/m@v1.1.0-pre", "a.com/m@v1.0.0", "a.com/m@v0.0.0-20190101000000-000000000000", "a.com/m@v2.0.0+incompatible"}},
+		{"a.com/m/v2/pkg", []string{"a.com/m/v2@v2.1.0", "a.com/m@v1.1.0-pre", "a.com/m@v1.0.0", "a.com/m@v0.0.0-20190101000000-000000000000", "a.com/m@v2.0.0+incompatible"}},
+		{"b.com/m/pkg", []string{"b.com/m@v0.0.0-20200201000000-000000000000", "b.com/m@v0.0.0-20200101000000-000000000000"}},
+		{"c.com/m", nil},
+	} {
+		infos, err := ds.GetVersionsForPath(ctx, test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, mi := range infos {
+			got = append(got, mi.ModulePath+"@"+mi.Version)
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("GetVersionsForPath(%q) mismatch (-want +got):\n%s", test.path, diff)
+		}
+	}
+}
+
+func TestGetImportedBy(t *testing.T) {
+	ctx := context.Background()
+	ds := New()
+	// Importers in the same module are not counted.
+	m := testModule("a.com/m", "v1.0.0")
+	sample.AddPackage(m, sample.LegacyPackage("a.com/m", "other"))
+	m.Units[len(m.Units)-1].Imports = []string{"a.com/m/pkg"}
+	ds.Add(m)
+	ds.Add(testModule("c.com/m", "v1.0.0", "a.com/m/pkg"))
+	ds.Add(testModule("b.com/m", "v1.0.0", "a.com/m/pkg", "fmt"))
+	// An older version of an importer does not add another path.
+	ds.Add(testModule("b.com/m", "v0.9.0", "a.com/m/pkg"))
+	ds.Add(testModule("d.com/m", "v1.0.0", "fmt"))
+
+	paths, next, err := ds.GetImportedBy(ctx, "a.com/m/pkg", "a.com/m", "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b.com/m/pkg"}; !cmp.Equal(paths, want) || next != "b.com/m/pkg" {
+		t.Errorf("first page: got %v, %q; want %v, %q", paths, next, want, "b.com/m/pkg")
+	}
+	paths, next, err = ds.GetImportedBy(ctx, "a.com/m/pkg", "a.com/m", next, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"c.com/m/pkg"}; !cmp.Equal(paths, want) || next != "" {
+		t.Errorf("second page: got %v, %q; want %v, %q", paths, next, want, "")
+	}
+	if _, _, err := ds.GetImportedBy(ctx, "a.com/m/pkg", "a.com/m", "", 0); !errors.Is(err, derrors.InvalidArgument) {
+		t.Errorf("limit 0: got %v, want InvalidArgument", err)
+	}
+
+	n, err := ds.GetImportedByCount(ctx, "a.com/m/pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("GetImportedByCount = %d, want 2", n)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	ds := New()
+	ds.Add(testModule("a.com/m", "v1.0.0"))
+	ds.Add(testModule("a.com/m", "v1.1.0"))
+	ds.Add(testModule("b.com/m", "v1.0.0", "a.com/m/pkg"))
+	ds.Add(sample.Module("c.com/m", "v1.0.0", "internal/pkg"))
+
+	results, err := ds.Search(ctx, "PKG synopsis", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range results {
+		got = append(got, r.PackagePath+"@"+r.Version)
+		if r.NumResults != 2 {
+			t.Errorf("%s: NumResults = %d, want 2", r.PackagePath, r.NumResults)
+		}
+	}
+	if want := []string{"a.com/m/pkg@v1.1.0", "b.com/m/pkg@v1.0.0"}; !cmp.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	results, err = ds.Search(ctx, "pkg", 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].PackagePath != "b.com/m/pkg" {
+		t.Errorf("with offset 1: got %v, want b.com/m/pkg only", results)
+	}
+
+	for _, test := range []struct {
+		q    string
+		want []string
+	}{
+		{"pkg module:b.com/*", []string{"b.com/m/pkg"}},
+		{"module:a.com/m license:mit", []string{"a.com/m/pkg"}},
+		{"pkg goos:" + sample.GOOS, []string{"a.com/m/pkg", "b.com/m/pkg"}},
+		{"pkg goos:plan9", nil},
+		{"name:pkg", []string{"a.com/m/pkg", "b.com/m/pkg"}},
+		{"name:synopsis", nil},
+		{"pkg module:a.com/m module:b.com/m", nil},
+		{`pkg license:"BSD-3-Clause"`, nil},
+	} {
+		results, err := ds.Search(ctx, test.q, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.PackagePath)
+		}
+		if !cmp.Equal(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.q, got, test.want)
+		}
+	}
+}
+
+func TestSearchGroupsByModule(t *testing.T) {
+	ctx := context.Background()
+	ds := New()
+	ds.Add(sample.Module("a.com/m", "v1.0.0", "foo", "x/foo", "y/foo"))
+	ds.Add(sample.Module("b.com/m", "v1.0.0", "foo"))
+
+	results, err := ds.Search(ctx, "foo", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		Path             string
+		NumOtherPackages uint64
+		OtherPackages    []string
+		NumResults       uint64
+	}
+	var got []result
+	for _, r := range results {
+		got = append(got, result{r.PackagePath, r.NumOtherPackages, r.OtherPackages, r.NumResults})
+	}
+	want := []result{
+		{"a.com/m/foo", 2, []string{"a.com/m/x/foo", "a.com/m/y/foo"}, 2},
+		{"b.com/m/foo", 0, nil, 2},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSearchSymbols(t *testing.T) {
+	ctx := context.Background()
+	ds := New()
+	// withSymbols returns m with the given symbols in the documentation of
+	// its package.
+	withSymbols := func(m *internal.Module, symbols ...string) *internal.Module {
+		for _, u := range m.Units {
+			if u.IsPackage() {
+				u.Documentation[0].Symbols = symbols
+			}
+		}
+		return m
+	}
+	ds.Add(withSymbols(testModule("a.com/m", "v1.0.0"), "Unmarshal", "Old"))
+	ds.Add(withSymbols(testModule("a.com/m", "v1.1.0"), "Decoder", "Decoder.Unmarshal", "Unmarshal"))
+	ds.Add(withSymbols(testModule("b.com/m", "v1.0.0", "a.com/m/pkg"), "unmarshal"))
+	ds.Add(withSymbols(sample.Module("c.com/m", "v1.0.0", "internal/pkg"), "Unmarshal"))
+
+	for _, test := range []struct {
+		q    string
+		want []string
+	}{
+		{"Unmarshal", []string{"a.com/m/pkg Unmarshal", "b.com/m/pkg unmarshal", "a.com/m/pkg Decoder.Unmarshal"}},
+		{"#unmarshal b.com", []string{"b.com/m/pkg unmarshal"}},
+		{"pkg.Decoder.Unmarshal", []string{"a.com/m/pkg Decoder.Unmarshal"}},
+		{"other.Unmarshal", nil},
+		{"Old", nil},
+	} {
+		sq, ok := internal.ParseSymbolQuery(test.q)
+		if !ok {
+			t.Fatalf("ParseSymbolQuery(%q) failed", test.q)
+		}
+		results, err := ds.SearchSymbols(ctx, sq, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.PackagePath+" "+r.SymbolName)
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("%q: mismatch (-want +got):\n%s", test.q, diff)
+		}
+	}
+}
+
+func TestGetStdlibPathsWithSuffix(t *testing.T) {
+	ctx := context.Background()
+	ds := New()
+	ds.Add(sample.Module(stdlib.ModulePath, "v1.14.0", "crypto/rand", "math/rand"))
+	ds.Add(sample.Module(stdlib.ModulePath, "v1.15.0", "crypto/rand", "math/rand", "cmd/rand"))
+	ds.Add(sample.Module(stdlib.ModulePath, "v1.16.0-beta1", "rand"))
+
+	got, err := ds.GetStdlibPathsWithSuffix(ctx, "rand")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"crypto/rand", "math/rand"}; !cmp.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGetPathCompletions(t *testing.T) {
+	ctx := context.Background()
+	ds := New()
+	ds.Add(testModule("a.com/m", "v1.0.0"))
+	ds.Add(testModule("a.com/n", "v1.0.0"))
+	ds.Add(testModule("b.com/m", "v1.0.0", "a.com/n/pkg"))
+
+	completions, err := ds.GetPathCompletions(ctx, "A.com/", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range completions {
+		got = append(got, c.PackagePath)
+	}
+	// The imported package comes first.
+	if want := []string{"a.com/n/pkg", "a.com/m/pkg"}; !cmp.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestBypass(t *testing.T) {
+	ctx := context.Background()
+	m := testModule("a.com/m", "v1.0.0")
+	for _, u := range m.Units {
+		u.IsRedistributable = false
+	}
+	m.LegacyPackages[0].IsRedistributable = false
+
+	for _, bypass := range []bool{false, true} {
+		ds := New()
+		if bypass {
+			ds = NewBypassingLicenseCheck()
+		}
+		ds.Add(m)
+		um, err := ds.GetUnitMeta(ctx, "a.com/m/pkg", "a.com/m", "v1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := ds.GetUnit(ctx, um, internal.AllFields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := u.Documentation != nil; got != bypass {
+			t.Errorf("bypass %t: got documentation %t, want %t", bypass, got, bypass)
+		}
+		pkg, err := ds.LegacyGetPackage(ctx, "a.com/m/pkg", "a.com/m", "v1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pkg.Synopsis != ""; got != bypass {
+			t.Errorf("bypass %t: got synopsis %t, want %t", bypass, got, bypass)
+		}
+		readme, err := ds.GetModuleReadme(ctx, "a.com/m", "v1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readme.Contents != ""; got != bypass {
+			t.Errorf("bypass %t: got README contents %t, want %t", bypass, got, bypass)
+		}
+	}
+	// The stored module is not modified.
+	if m.Units[len(m.Units)-1].Documentation == nil || m.LegacyPackages[0].Synopsis == "" {
+		t.Error("module was modified")
+	}
+}
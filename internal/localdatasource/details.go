@@ -0,0 +1,307 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localdatasource
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/licenses"
+	"golang.org/x/pkgsite/internal/stdlib"
+)
+
+// GetUnitMeta returns information about the latest unit with the given path
+// that matches requestedModulePath and requestedVersion, either of which may
+// be unknown. See postgres.DB.GetUnitMeta.
+func (ds *DataSource) GetUnitMeta(ctx context.Context, fullPath, requestedModulePath, requestedVersion string) (_ *internal.UnitMeta, err error) {
+	defer derrors.Wrap(&err, "GetUnitMeta(%q, %q, %q)", fullPath, requestedModulePath, requestedVersion)
+
+	uv, err := ds.findUnit(fullPath, requestedModulePath, requestedVersion)
+	if err != nil {
+		return nil, err
+	}
+	ds.mu.RLock()
+	mi := ds.moduleInfo(uv.module)
+	ds.mu.RUnlock()
+	return &internal.UnitMeta{
+		Path:                fullPath,
+		Name:                uv.unit.Name,
+		IsRedistributable:   uv.unit.IsRedistributable,
+		Licenses:            uv.unit.Licenses,
+		Version:             mi.Version,
+		ModulePath:          mi.ModulePath,
+		CommitTime:          mi.CommitTime,
+		HasSecurityPolicy:   mi.HasSecurityPolicy,
+		SourceInfo:          mi.SourceInfo,
+		Retracted:           mi.Retracted,
+		RetractionRationale: mi.RetractionRationale,
+		Deprecation:         mi.Deprecation,
+		ProcessedPackages:   mi.ProcessedPackages,
+		TotalPackages:       mi.TotalPackages,
+		GoVersion:           mi.GoVersion,
+		Toolchain:           mi.Toolchain,
+		ChecksumStatus:      mi.ChecksumStatus,
+	}, nil
+}
+
+// GetUnit returns the unit described by um, with the fields in fields.
+func (ds *DataSource) GetUnit(ctx context.Context, um *internal.UnitMeta, fields internal.FieldSet) (_ *internal.Unit, err error) {
+	defer derrors.Wrap(&err, "GetUnit(%q, %q, %q)", um.Path, um.ModulePath, um.Version)
+
+	m, err := ds.getModule(um.ModulePath, um.Version)
+	if err != nil {
+		return nil, err
+	}
+	var src, root *internal.Unit
+	for _, u := range m.Units {
+		if u.Path == um.Path {
+			src = u
+		}
+		if u.Path == m.ModulePath {
+			root = u
+		}
+	}
+	if src == nil {
+		return nil, fmt.Errorf("%q missing from module %s: %w", um.Path, m.ModulePath, derrors.NotFound)
+	}
+
+	u := &internal.Unit{UnitMeta: *um}
+	if fields&internal.WithReadme != 0 && root != nil && root.Readme != nil {
+		// As in the database, the README of a unit is that of its module.
+		readme := *root.Readme
+		u.Readme = &readme
+	}
+	if fields&(internal.WithDocumentation|internal.WithDocumentationSource|internal.WithDocumentationAPI) != 0 {
+		for _, d := range src.Documentation {
+			doc := *d
+			doc.Symbols = nil
+			doc.HTML = convertDocumentation(doc.HTML)
+			if fields&internal.WithDocumentationSource == 0 {
+				doc.Source = nil
+			}
+			if fields&internal.WithDocumentationAPI == 0 {
+				doc.API = nil
+			}
+			u.Documentation = append(u.Documentation, &doc)
+		}
+		internal.SortDocumentation(u.Documentation)
+	}
+	if fields&internal.WithImports != 0 && len(src.Imports) > 0 {
+		u.Imports = append([]string(nil), src.Imports...)
+	}
+	if fields&internal.WithLicenses != 0 {
+		u.LicenseContents = ds.licensesForPath(m, u.Path)
+	}
+	if fields&internal.WithSubdirectories != 0 {
+		u.Subdirectories = ds.packagesInUnit(m, u.Path)
+	}
+	if !ds.bypassLicenseCheck {
+		u.RemoveNonRedistributableData()
+	}
+	return u, nil
+}
+
+// GetModuleReadme returns the README at the root of the module with
+// modulePath at version. Its contents are removed if the root is not
+// redistributable.
+func (ds *DataSource) GetModuleReadme(ctx context.Context, modulePath, version string) (_ *internal.Readme, err error) {
+	defer derrors.Wrap(&err, "GetModuleReadme(%q, %q)", modulePath, version)
+
+	m, err := ds.getModule(modulePath, version)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range m.Units {
+		if u.Path == m.ModulePath && u.Readme != nil {
+			readme := *u.Readme
+			if !u.IsRedistributable && !ds.bypassLicenseCheck {
+				readme.Contents = ""
+			}
+			return &readme, nil
+		}
+	}
+	return nil, fmt.Errorf("README of %s@%s: %w", modulePath, version, derrors.NotFound)
+}
+
+// licensesForPath returns copies of the licenses of m that apply to
+// fullPath: those in the directory of fullPath or one of its parents.
+func (ds *DataSource) licensesForPath(m *internal.Module, fullPath string) []*licenses.License {
+	var lics []*licenses.License
+	for _, l := range m.Licenses {
+		licensePath := path.Join(m.ModulePath, path.Dir(l.FilePath))
+		if m.ModulePath == stdlib.ModulePath || strings.HasPrefix(fullPath, licensePath) {
+			lics = append(lics, ds.copyLicense(l))
+		}
+	}
+	return lics
+}
+
+// copyLicense returns a copy of l, without its contents if they may not be
+// redistributed.
+func (ds *DataSource) copyLicense(l *licenses.License) *licenses.License {
+	lic := *l
+	if !ds.bypassLicenseCheck {
+		lic.RemoveNonRedistributableData()
+	}
+	return &lic
+}
+
+// packagesInUnit returns the packages of m at or below fullPath, followed by
+// those below fullPath in the latest version of each nested module, in path
+// order. Like the database, it omits packages without documentation.
+func (ds *DataSource) packagesInUnit(m *internal.Module, fullPath string) []*internal.PackageMeta {
+	mods := []*internal.Module{m}
+	if fullPath != stdlib.ModulePath {
+		ds.mu.RLock()
+		mods = append(mods, ds.nestedModules(fullPath, internal.SeriesPathForModule(m.ModulePath))...)
+		ds.mu.RUnlock()
+	}
+	var pkgs []*internal.PackageMeta
+	for _, m := range mods {
+		for _, u := range m.Units {
+			if len(u.Documentation) == 0 {
+				continue
+			}
+			if fullPath != stdlib.ModulePath && u.Path != fullPath && !strings.HasPrefix(u.Path, fullPath+"/") {
+				continue
+			}
+			pm := &internal.PackageMeta{
+				Path:              u.Path,
+				Name:              u.Name,
+				Synopsis:          synopsis(u),
+				IsRedistributable: u.IsRedistributable,
+				Licenses:          u.Licenses,
+				ModulePath:        m.ModulePath,
+				Version:           m.Version,
+			}
+			if !ds.bypassLicenseCheck {
+				pm.RemoveNonRedistributableData()
+			}
+			pkgs = append(pkgs, pm)
+		}
+	}
+	// The packages of the module version come first for a path.
+	sort.SliceStable(pkgs, func(i, j int) bool { return pkgs[i].Path < pkgs[j].Path })
+	return pkgs
+}
+
+// GetNestedModules returns the latest version of each module series whose
+// modules are nested below modulePath, ordered by series path.
+func (ds *DataSource) GetNestedModules(ctx context.Context, modulePath string) (_ []*internal.ModuleInfo, err error) {
+	defer derrors.Wrap(&err, "GetNestedModules(%q)", modulePath)
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	var infos []*internal.ModuleInfo
+	for _, m := range ds.nestedModules(modulePath, "") {
+		infos = append(infos, &ds.moduleInfo(m).ModuleInfo)
+	}
+	return infos, nil
+}
+
+// nestedModules returns the latest version of each module series whose
+// modules are nested below dirPath, except the series with path
+// excludedSeries, ordered by series path. Callers must hold ds.mu.
+func (ds *DataSource) nestedModules(dirPath, excludedSeries string) []*internal.Module {
+	series := map[string][]*internal.Module{}
+	for mpath, mods := range ds.modules {
+		if strings.HasPrefix(mpath, dirPath+"/") {
+			sp := internal.SeriesPathForModule(mpath)
+			if sp != excludedSeries {
+				series[sp] = append(series[sp], mods...)
+			}
+		}
+	}
+	var seriesPaths []string
+	for sp := range series {
+		seriesPaths = append(seriesPaths, sp)
+	}
+	sort.Strings(seriesPaths)
+	var latest []*internal.Module
+	for _, sp := range seriesPaths {
+		latest = append(latest, ds.latest(series[sp]))
+	}
+	return latest
+}
+
+// GetImportedBy returns the paths of up to limit packages that import the
+// package with pkgPath, excluding the packages of the module with modulePath,
+// in path order, following cursor. See postgres.DB.GetImportedBy.
+func (ds *DataSource) GetImportedBy(ctx context.Context, pkgPath, modulePath, cursor string, limit int) (paths []string, nextCursor string, err error) {
+	defer derrors.Wrap(&err, "GetImportedBy(%q, %q, %q, %d)", pkgPath, modulePath, cursor, limit)
+	if pkgPath == "" {
+		return nil, "", fmt.Errorf("pkgPath cannot be empty: %w", derrors.InvalidArgument)
+	}
+	if limit <= 0 {
+		return nil, "", fmt.Errorf("limit must be positive: %w", derrors.InvalidArgument)
+	}
+	for _, p := range ds.importers(pkgPath, modulePath) {
+		if p > cursor {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) > limit {
+		paths = paths[:limit]
+		nextCursor = paths[limit-1]
+	}
+	return paths, nextCursor, nil
+}
+
+// GetImportedByCount returns the number of packages outside the module of
+// the package with pkgPath that import it. Unlike the database, which
+// recomputes the count periodically, it is always current. It returns an
+// error wrapping derrors.NotFound if there is no package with pkgPath.
+func (ds *DataSource) GetImportedByCount(ctx context.Context, pkgPath string) (_ int, err error) {
+	defer derrors.Wrap(&err, "GetImportedByCount(%q)", pkgPath)
+
+	uv, err := ds.findUnit(pkgPath, internal.UnknownModulePath, internal.LatestVersion)
+	if err != nil {
+		return 0, err
+	}
+	return len(ds.importers(pkgPath, uv.module.ModulePath)), nil
+}
+
+// importers returns the sorted paths of the packages, in any version of any
+// module other than the one with modulePath, that import pkgPath.
+func (ds *DataSource) importers(pkgPath, modulePath string) []string {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	seen := map[string]bool{}
+	for mpath, mods := range ds.modules {
+		if mpath == modulePath {
+			continue
+		}
+		for _, m := range mods {
+			for _, u := range m.Units {
+				for _, imp := range u.Imports {
+					if imp == pkgPath {
+						seen[u.Path] = true
+						break
+					}
+				}
+			}
+		}
+	}
+	var paths []string
+	for p := range seen {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// synopsis returns the synopsis of u in its preferred build context, or the
+// empty string if u has no documentation.
+func synopsis(u *internal.Unit) string {
+	if d := u.DocumentationFor("", ""); d != nil {
+		return d.Synopsis
+	}
+	return ""
+}
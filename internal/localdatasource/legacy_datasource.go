@@ -0,0 +1,260 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localdatasource
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/safehtml"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/licenses"
+	"golang.org/x/pkgsite/internal/stdlib"
+	"golang.org/x/pkgsite/internal/version"
+)
+
+// LegacyGetDirectory returns the packages at or below dirPath in the module
+// version that best matches modulePath and version, which may be unknown.
+func (ds *DataSource) LegacyGetDirectory(ctx context.Context, dirPath, modulePath, version string, fields internal.FieldSet) (_ *internal.LegacyDirectory, err error) {
+	defer derrors.Wrap(&err, "LegacyGetDirectory(%q, %q, %q)", dirPath, modulePath, version)
+
+	inDir := func(p *internal.LegacyPackage) bool {
+		return p.Path == dirPath || strings.HasPrefix(p.Path, dirPath+"/")
+	}
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	m := ds.findModuleWithPackage(modulePath, version, inDir)
+	if m == nil {
+		return nil, fmt.Errorf("packages in directory not found: %w", derrors.NotFound)
+	}
+	dir := &internal.LegacyDirectory{
+		LegacyModuleInfo: *ds.moduleInfo(m),
+		Path:             dirPath,
+	}
+	if fields&internal.WithReadme == 0 {
+		dir.LegacyReadmeContents = internal.StringFieldMissing
+	}
+	for _, p := range m.LegacyPackages {
+		if !inDir(p) {
+			continue
+		}
+		pkg := ds.copyPackage(p)
+		if fields&internal.WithDocumentation == 0 {
+			pkg.DocumentationHTML = safehtml.HTML{}
+		}
+		dir.Packages = append(dir.Packages, pkg)
+	}
+	sort.Slice(dir.Packages, func(i, j int) bool { return dir.Packages[i].Path < dir.Packages[j].Path })
+	return dir, nil
+}
+
+// LegacyGetImports returns the imports of the package with pkgPath in the
+// module with modulePath at version, in path order.
+func (ds *DataSource) LegacyGetImports(ctx context.Context, pkgPath, modulePath, version string) (_ []string, err error) {
+	defer derrors.Wrap(&err, "LegacyGetImports(%q, %q, %q)", pkgPath, modulePath, version)
+
+	p, _, err := ds.getPackage(pkgPath, modulePath, version)
+	if err != nil {
+		return nil, err
+	}
+	imports := append([]string(nil), p.Imports...)
+	sort.Strings(imports)
+	return imports, nil
+}
+
+// LegacyGetLicenses returns the licenses that apply to fullPath in the module
+// with modulePath at resolvedVersion.
+func (ds *DataSource) LegacyGetLicenses(ctx context.Context, fullPath, modulePath, resolvedVersion string) (_ []*licenses.License, err error) {
+	defer derrors.Wrap(&err, "LegacyGetLicenses(%q, %q, %q)", fullPath, modulePath, resolvedVersion)
+
+	uv, err := ds.findUnit(fullPath, modulePath, resolvedVersion)
+	if err != nil {
+		return nil, err
+	}
+	return ds.licensesForPath(uv.module, fullPath), nil
+}
+
+// LegacyGetModuleInfo returns the LegacyModuleInfo of the module with
+// modulePath at version, which may be internal.LatestVersion.
+func (ds *DataSource) LegacyGetModuleInfo(ctx context.Context, modulePath, version string) (_ *internal.LegacyModuleInfo, err error) {
+	defer derrors.Wrap(&err, "LegacyGetModuleInfo(%q, %q)", modulePath, version)
+
+	m, err := ds.getModule(modulePath, version)
+	if err != nil {
+		return nil, err
+	}
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.moduleInfo(m), nil
+}
+
+// LegacyGetModuleLicenses returns the licenses at the root of the module with
+// modulePath at version.
+func (ds *DataSource) LegacyGetModuleLicenses(ctx context.Context, modulePath, version string) (_ []*licenses.License, err error) {
+	defer derrors.Wrap(&err, "LegacyGetModuleLicenses(%q, %q)", modulePath, version)
+
+	m, err := ds.getModule(modulePath, version)
+	if err != nil {
+		return nil, err
+	}
+	var lics []*licenses.License
+	for _, l := range m.Licenses {
+		if !strings.Contains(l.FilePath, "/") {
+			lics = append(lics, ds.copyLicense(l))
+		}
+	}
+	return lics, nil
+}
+
+// LegacyGetPackage returns the package with pkgPath in the module version
+// that best matches modulePath and version, which may be unknown.
+func (ds *DataSource) LegacyGetPackage(ctx context.Context, pkgPath, modulePath, version string) (_ *internal.LegacyVersionedPackage, err error) {
+	defer derrors.Wrap(&err, "LegacyGetPackage(%q, %q, %q)", pkgPath, modulePath, version)
+
+	p, m, err := ds.getPackage(pkgPath, modulePath, version)
+	if err != nil {
+		return nil, err
+	}
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return &internal.LegacyVersionedPackage{
+		LegacyPackage:    *ds.copyPackage(p),
+		LegacyModuleInfo: *ds.moduleInfo(m),
+	}, nil
+}
+
+// LegacyGetPackageLicenses returns the licenses that apply to the package
+// with pkgPath in the module with modulePath at version.
+func (ds *DataSource) LegacyGetPackageLicenses(ctx context.Context, pkgPath, modulePath, version string) (_ []*licenses.License, err error) {
+	defer derrors.Wrap(&err, "LegacyGetPackageLicenses(%q, %q, %q)", pkgPath, modulePath, version)
+
+	p, m, err := ds.getPackage(pkgPath, modulePath, version)
+	if err != nil {
+		return nil, err
+	}
+	var lics []*licenses.License
+	for _, lmd := range p.Licenses {
+		for _, l := range m.Licenses {
+			if l.FilePath == lmd.FilePath {
+				lics = append(lics, ds.copyLicense(l))
+				break
+			}
+		}
+	}
+	return lics, nil
+}
+
+// LegacyGetPackagesInModule returns the packages of the module with
+// modulePath at version, in path order.
+func (ds *DataSource) LegacyGetPackagesInModule(ctx context.Context, modulePath, version string) (_ []*internal.LegacyPackage, err error) {
+	defer derrors.Wrap(&err, "LegacyGetPackagesInModule(%q, %q)", modulePath, version)
+
+	m, err := ds.getModule(modulePath, version)
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []*internal.LegacyPackage
+	for _, p := range m.LegacyPackages {
+		pkgs = append(pkgs, ds.copyPackage(p))
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Path < pkgs[j].Path })
+	return pkgs, nil
+}
+
+// LegacyGetPsuedoVersionsForModule returns the most recent pseudo-versions
+// of the modules in the series of modulePath.
+func (ds *DataSource) LegacyGetPsuedoVersionsForModule(ctx context.Context, modulePath string) (_ []*internal.ModuleInfo, err error) {
+	defer derrors.Wrap(&err, "LegacyGetPsuedoVersionsForModule(%q)", modulePath)
+	return ds.seriesVersions(modulePath, version.TypePseudo), nil
+}
+
+// LegacyGetPsuedoVersionsForPackageSeries returns the most recent
+// pseudo-versions of the modules that contain a package in the series of
+// pkgPath.
+func (ds *DataSource) LegacyGetPsuedoVersionsForPackageSeries(ctx context.Context, pkgPath string) (_ []*internal.ModuleInfo, err error) {
+	defer derrors.Wrap(&err, "LegacyGetPsuedoVersionsForPackageSeries(%q)", pkgPath)
+	return ds.packageSeriesVersions(pkgPath, version.TypePseudo), nil
+}
+
+// LegacyGetTaggedVersionsForModule returns the release and prerelease
+// versions of the modules in the series of modulePath.
+func (ds *DataSource) LegacyGetTaggedVersionsForModule(ctx context.Context, modulePath string) (_ []*internal.ModuleInfo, err error) {
+	defer derrors.Wrap(&err, "LegacyGetTaggedVersionsForModule(%q)", modulePath)
+	return ds.seriesVersions(modulePath, version.TypeRelease, version.TypePrerelease), nil
+}
+
+// LegacyGetTaggedVersionsForPackageSeries returns the release and prerelease
+// versions of the modules that contain a package in the series of pkgPath.
+func (ds *DataSource) LegacyGetTaggedVersionsForPackageSeries(ctx context.Context, pkgPath string) (_ []*internal.ModuleInfo, err error) {
+	defer derrors.Wrap(&err, "LegacyGetTaggedVersionsForPackageSeries(%q)", pkgPath)
+	return ds.packageSeriesVersions(pkgPath, version.TypeRelease, version.TypePrerelease), nil
+}
+
+// getPackage returns the package with pkgPath, and its module, in the module
+// version that best matches modulePath and version.
+func (ds *DataSource) getPackage(pkgPath, modulePath, version string) (*internal.LegacyPackage, *internal.Module, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	isPkg := func(p *internal.LegacyPackage) bool { return p.Path == pkgPath }
+	m := ds.findModuleWithPackage(modulePath, version, isPkg)
+	if m == nil {
+		return nil, nil, fmt.Errorf("package %s@%s: %w", pkgPath, version, derrors.NotFound)
+	}
+	for _, p := range m.LegacyPackages {
+		if isPkg(p) {
+			return p, m, nil
+		}
+	}
+	panic("unreachable")
+}
+
+// findModuleWithPackage returns the module version with a package for which
+// match returns true, matching modulePath and version in the same way as the
+// legacy postgres queries: if modulePath is unknown or the standard library,
+// any module may match, and if several modules match a version other than
+// internal.LatestVersion, the one with the longest path wins. It returns nil
+// if no module matches. Callers must hold ds.mu.
+func (ds *DataSource) findModuleWithPackage(modulePath, version string, match func(*internal.LegacyPackage) bool) *internal.Module {
+	anyModule := modulePath == internal.UnknownModulePath || modulePath == stdlib.ModulePath
+	var mods []*internal.Module
+	for _, m := range ds.allModules() {
+		if !anyModule && m.ModulePath != modulePath {
+			continue
+		}
+		if version != internal.LatestVersion && m.Version != version {
+			continue
+		}
+		for _, p := range m.LegacyPackages {
+			if match(p) {
+				mods = append(mods, m)
+				break
+			}
+		}
+	}
+	if version == internal.LatestVersion {
+		return ds.latest(mods)
+	}
+	var best *internal.Module
+	for _, m := range mods {
+		if best == nil || m.ModulePath > best.ModulePath {
+			best = m
+		}
+	}
+	return best
+}
+
+// copyPackage returns a copy of p, with its documentation converted as by
+// convertDocumentation and without the data that may not be redistributed.
+func (ds *DataSource) copyPackage(p *internal.LegacyPackage) *internal.LegacyPackage {
+	pkg := *p
+	pkg.DocumentationHTML = convertDocumentation(pkg.DocumentationHTML)
+	if !ds.bypassLicenseCheck {
+		pkg.RemoveNonRedistributableData()
+	}
+	return &pkg
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localdatasource
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/fetch"
+	"golang.org/x/pkgsite/internal/log"
+)
+
+// Load fetches the module in the directory dir with fetch.FetchLocalModule
+// and adds it to ds. If dir has a go.work file, the modules that the file
+// uses are loaded instead, as the go command would build them.
+//
+// Like the go command, Load follows the replace directives of the go.work
+// file and of the go.mod files of the loaded modules, but not those of other
+// modules. Each replacement that is a directory is loaded as well, under the
+// path of the module that it replaces, so that imports of that module, and
+// links to it in documentation, lead to the local copy. Replacements in the
+// go.work file override those in go.mod files.
+func (ds *DataSource) Load(ctx context.Context, dir string) (err error) {
+	defer derrors.Wrap(&err, "Load(%q)", dir)
+
+	l := &loader{ds: ds, loaded: map[string]string{}}
+	workBytes, err := ioutil.ReadFile(filepath.Join(dir, "go.work"))
+	if os.IsNotExist(err) {
+		return l.loadMain(ctx, []string{dir})
+	}
+	if err != nil {
+		return err
+	}
+	wf, err := modfile.ParseWork(filepath.Join(dir, "go.work"), workBytes, nil)
+	if err != nil {
+		return err
+	}
+	if err := l.loadReplacements(ctx, dir, wf.Replace); err != nil {
+		return err
+	}
+	var dirs []string
+	for _, u := range wf.Use {
+		dirs = append(dirs, resolveDir(dir, u.Path))
+	}
+	return l.loadMain(ctx, dirs)
+}
+
+// A loader loads local modules into a DataSource.
+type loader struct {
+	ds *DataSource
+	// loaded maps the path of each module that has been loaded to its
+	// directory.
+	loaded map[string]string
+}
+
+// loadMain loads the main modules in dirs, which must have go.mod files, and
+// then the replacements of their go.mod files. A main module is never
+// replaced.
+func (l *loader) loadMain(ctx context.Context, dirs []string) error {
+	for _, dir := range dirs {
+		if err := l.load(ctx, "", dir); err != nil {
+			return err
+		}
+	}
+	for _, dir := range dirs {
+		goModFile := filepath.Join(dir, "go.mod")
+		goModBytes, err := ioutil.ReadFile(goModFile)
+		if err != nil {
+			return err
+		}
+		mf, err := modfile.Parse(goModFile, goModBytes, nil)
+		if err != nil {
+			return err
+		}
+		if err := l.loadReplacements(ctx, dir, mf.Replace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadReplacements loads the modules that the replace directives reps, of a
+// file in dir, replace with directories. Modules that have already been
+// loaded are skipped.
+func (l *loader) loadReplacements(ctx context.Context, dir string, reps []*modfile.Replace) error {
+	for _, r := range reps {
+		if r.New.Version != "" || !modfile.IsDirectoryPath(r.New.Path) {
+			// The replacement is another module version, which is not local.
+			continue
+		}
+		if _, ok := l.loaded[r.Old.Path]; ok {
+			continue
+		}
+		if err := l.load(ctx, r.Old.Path, resolveDir(dir, r.New.Path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load fetches the module with modulePath, which may be empty, from dir, and
+// adds it to the data source.
+func (l *loader) load(ctx context.Context, modulePath, dir string) error {
+	fr := fetch.FetchLocalModule(ctx, modulePath, dir)
+	if fr.Error != nil {
+		return fr.Error
+	}
+	if prev, ok := l.loaded[fr.ModulePath]; ok {
+		return fmt.Errorf("module %s is in both %s and %s: %w", fr.ModulePath, prev, dir, derrors.InvalidArgument)
+	}
+	l.loaded[fr.ModulePath] = dir
+	for _, w := range fr.Warnings {
+		log.Infof(ctx, "%s: %s", dir, w)
+	}
+	l.ds.Add(fr.Module)
+	return nil
+}
+
+// resolveDir returns the directory path, which is relative to dir unless it
+// is absolute.
+func resolveDir(dir, path string) string {
+	path = filepath.FromSlash(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localdatasource
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// TestLoad loads the modules of testdata, example.com/app and
+// example.com/lib, which import each other. The go.mod file of each replaces
+// the other with its directory, and the go.work file uses both.
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		name, dir string
+	}{
+		// example.com/lib is loaded as the replacement of the main module,
+		// whose own replacement of example.com/app is ignored.
+		{"replace", "app"},
+		{"work", "."},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ds := New()
+			if err := ds.Load(ctx, filepath.Join("testdata", test.dir)); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, m := range ds.allModules() {
+				got = append(got, m.ModulePath+"@"+m.Version)
+			}
+			want := []string{"example.com/app@v0.0.0", "example.com/lib@v0.0.0"}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("modules mismatch (-want +got):\n%s", diff)
+			}
+
+			// The imports of each module resolve to the other.
+			for _, test := range []struct {
+				pkgPath, importPath string
+			}{
+				{"example.com/app", "example.com/lib"},
+				{"example.com/lib/hello", "example.com/app"},
+			} {
+				imports, err := ds.LegacyGetImports(ctx, test.pkgPath, internal.UnknownModulePath, internal.LatestVersion)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !contains(imports, test.importPath) {
+					t.Errorf("imports of %s = %v; want %s", test.pkgPath, imports, test.importPath)
+				}
+				if _, err := ds.GetUnitMeta(ctx, test.importPath, internal.UnknownModulePath, internal.LatestVersion); err != nil {
+					t.Errorf("import %s of %s: %v", test.importPath, test.pkgPath, err)
+				}
+				importedBy, _, err := ds.GetImportedBy(ctx, test.importPath, internal.UnknownModulePath, "", 10)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !contains(importedBy, test.pkgPath) {
+					t.Errorf("importers of %s = %v; want %s", test.importPath, importedBy, test.pkgPath)
+				}
+			}
+
+			// The documentation of example.com/app links to the local
+			// example.com/lib.
+			um, err := ds.GetUnitMeta(ctx, "example.com/app", internal.UnknownModulePath, internal.LatestVersion)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, err := ds.GetUnit(ctx, um, internal.WithDocumentation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			const wantLink = `href="/example.com/lib?tab=doc#Greeting"`
+			if len(u.Documentation) == 0 {
+				t.Fatal("example.com/app has no documentation")
+			}
+			if doc := u.Documentation[0].HTML.String(); !strings.Contains(doc, wantLink) {
+				t.Errorf("documentation of example.com/app does not contain %s:\n%s", wantLink, doc)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		name    string
+		files   map[string]string
+		wantErr error
+	}{
+		{
+			name:  "no go.mod file",
+			files: map[string]string{"a.go": "package a\n"},
+		},
+		{
+			name: "replacement declares another path",
+			files: map[string]string{
+				"go.mod":   "module example.com/a\n\nreplace example.com/b => ./b\n",
+				"a.go":     "package a\n",
+				"b/go.mod": "module example.com/c\n",
+				"b/b.go":   "package b\n",
+			},
+			wantErr: derrors.AlternativeModule,
+		},
+		{
+			name: "module in two directories",
+			files: map[string]string{
+				"go.work":  "go 1.18\n\nuse (\n\t./a\n\t./b\n)\n",
+				"a/go.mod": "module example.com/a\n",
+				"a/a.go":   "package a\n",
+				"b/go.mod": "module example.com/a\n",
+				"b/a.go":   "package a\n",
+			},
+			wantErr: derrors.InvalidArgument,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "localdatasource-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			for name, contents := range test.files {
+				name = filepath.Join(dir, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(name, []byte(contents), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = New().Load(ctx, dir)
+			if err == nil {
+				t.Fatal("got nil error")
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Errorf("got %v; want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
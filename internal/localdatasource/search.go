@@ -0,0 +1,319 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localdatasource
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/complete"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/godoc"
+	"golang.org/x/pkgsite/internal/stdlib"
+)
+
+// Search returns the packages, in the latest version of their module, whose
+// path, name or synopsis contains every word of q, ignoring case. Internal
+// packages are never returned. Packages must also satisfy the filters of q,
+// as parsed by internal.ParseSearchQuery. Packages are ordered by the number
+// of packages that import them, then by path, and only the first package of
+// each module is returned, listing the others. At most limit results are
+// returned, starting at offset.
+//
+// This is a much simpler search than that of the database, meant only to
+// make the search page usable without one.
+func (ds *DataSource) Search(ctx context.Context, q string, limit, offset int) (_ []*internal.SearchResult, err error) {
+	defer derrors.Wrap(&err, "Search(%q, %d, %d)", q, limit, offset)
+
+	sq := internal.ParseSearchQuery(q)
+	terms := strings.Fields(strings.ToLower(sq.Text))
+	var results []*internal.SearchResult
+	for path, uv := range ds.latestPackages() {
+		if isInternalPackage(path) || !matchesAll(uv, terms) || !matchesFilters(uv, sq.Filters) {
+			continue
+		}
+		r := &internal.SearchResult{
+			Name:        uv.unit.Name,
+			PackagePath: path,
+			ModulePath:  uv.module.ModulePath,
+			Version:     uv.module.Version,
+			CommitTime:  uv.module.CommitTime,
+		}
+		if uv.unit.IsRedistributable || ds.bypassLicenseCheck {
+			r.Synopsis = synopsis(uv.unit)
+		}
+		for _, l := range uv.unit.Licenses {
+			r.Licenses = append(r.Licenses, l.Types...)
+		}
+		r.NumImportedBy = uint64(len(ds.importers(path, uv.module.ModulePath)))
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].NumImportedBy != results[j].NumImportedBy {
+			return results[i].NumImportedBy > results[j].NumImportedBy
+		}
+		return results[i].PackagePath < results[j].PackagePath
+	})
+	results = groupByModule(results)
+	for i, r := range results {
+		r.NumResults = uint64(len(results))
+		r.Score = float64(len(results) - i)
+	}
+	if offset >= len(results) {
+		return nil, nil
+	}
+	results = results[offset:]
+	if limit >= 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// maxOtherPackages is the maximum number of the other packages of a module
+// that are listed with a search result, as in the database.
+const maxOtherPackages = 5
+
+// groupByModule returns the first of results for each module, in order, with
+// the paths of the later results for the module as its other packages.
+func groupByModule(results []*internal.SearchResult) []*internal.SearchResult {
+	var grouped []*internal.SearchResult
+	first := map[string]*internal.SearchResult{}
+	for _, r := range results {
+		f, ok := first[r.ModulePath]
+		if !ok {
+			first[r.ModulePath] = r
+			grouped = append(grouped, r)
+			continue
+		}
+		f.NumOtherPackages++
+		if len(f.OtherPackages) < maxOtherPackages {
+			f.OtherPackages = append(f.OtherPackages, r.PackagePath)
+		}
+	}
+	return grouped
+}
+
+// SearchSymbols returns the symbols of the latest version of each package
+// that match sq. They match as in postgres.DB.SearchSymbols, but are ranked
+// more simply: symbols whose names are sq.Name come first, then those whose
+// names are sq.Name ignoring case, then methods and fields with that name.
+// Each group is ordered by the number of packages that import the package of
+// the symbol, then by path.
+func (ds *DataSource) SearchSymbols(ctx context.Context, sq *internal.SymbolQuery, limit int) (_ []*internal.SymbolSearchResult, err error) {
+	defer derrors.Wrap(&err, "SearchSymbols(%+v, %d)", sq, limit)
+
+	var results []*internal.SymbolSearchResult
+	for path, uv := range ds.latestPackages() {
+		if isInternalPackage(path) || (sq.PackageName != "" && uv.unit.Name != sq.PackageName) ||
+			!containsAll(path, sq.PackageTerms) || (!uv.unit.IsRedistributable && !ds.bypassLicenseCheck) {
+			continue
+		}
+		var numImportedBy uint64
+		for name, kind := range godoc.SymbolKinds(uv.unit.Documentation) {
+			rank := symbolMatchRank(name, sq.Name)
+			if rank == 0 {
+				continue
+			}
+			if numImportedBy == 0 {
+				numImportedBy = uint64(len(ds.importers(path, uv.module.ModulePath)))
+			}
+			results = append(results, &internal.SymbolSearchResult{
+				SymbolName:    name,
+				SymbolKind:    kind,
+				PackagePath:   path,
+				ModulePath:    uv.module.ModulePath,
+				Version:       uv.module.Version,
+				NumImportedBy: numImportedBy,
+				Score:         float64(rank),
+			})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		ri, rj := results[i], results[j]
+		switch {
+		case ri.Score != rj.Score:
+			return ri.Score > rj.Score
+		case ri.NumImportedBy != rj.NumImportedBy:
+			return ri.NumImportedBy > rj.NumImportedBy
+		case ri.PackagePath != rj.PackagePath:
+			return ri.PackagePath < rj.PackagePath
+		}
+		return ri.SymbolName < rj.SymbolName
+	})
+	if limit >= 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// symbolMatchRank returns 3 if the symbol name is q, 2 if it is q ignoring
+// case, 1 if q is unqualified and is the name of the method or field, ignoring
+// case, and 0 if name does not match q.
+func symbolMatchRank(name, q string) int {
+	switch {
+	case name == q:
+		return 3
+	case strings.EqualFold(name, q):
+		return 2
+	case !strings.Contains(q, ".") && strings.EqualFold(name[strings.LastIndex(name, ".")+1:], q):
+		return 1
+	}
+	return 0
+}
+
+// containsAll reports whether path contains each of terms, ignoring case.
+func containsAll(path string, terms []string) bool {
+	path = strings.ToLower(path)
+	for _, t := range terms {
+		if !strings.Contains(path, strings.ToLower(t)) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetPathCompletions returns at most limit of the packages, in the latest
+// version of their module, whose paths begin with prefix, ignoring case. They
+// are ordered by the number of packages that import them, then by path. See
+// postgres.DB.GetPathCompletions.
+func (ds *DataSource) GetPathCompletions(ctx context.Context, prefix string, limit int) (_ []*complete.Completion, err error) {
+	defer derrors.Wrap(&err, "GetPathCompletions(%q, %d)", prefix, limit)
+
+	prefix = strings.ToLower(prefix)
+	var completions []*complete.Completion
+	for path, uv := range ds.latestPackages() {
+		if !strings.HasPrefix(strings.ToLower(path), prefix) {
+			continue
+		}
+		completions = append(completions, &complete.Completion{
+			Suffix:      path,
+			ModulePath:  uv.module.ModulePath,
+			Version:     uv.module.Version,
+			PackagePath: path,
+			Importers:   len(ds.importers(path, uv.module.ModulePath)),
+		})
+	}
+	sort.Slice(completions, func(i, j int) bool {
+		if completions[i].Importers != completions[j].Importers {
+			return completions[i].Importers > completions[j].Importers
+		}
+		return completions[i].PackagePath < completions[j].PackagePath
+	})
+	if len(completions) > limit {
+		completions = completions[:limit]
+	}
+	return completions, nil
+}
+
+// GetStdlibPathsWithSuffix returns the paths of the packages in the latest
+// version of the standard library whose last components are suffix,
+// excluding commands. See postgres.DB.GetStdlibPathsWithSuffix.
+func (ds *DataSource) GetStdlibPathsWithSuffix(ctx context.Context, suffix string) (_ []string, err error) {
+	defer derrors.Wrap(&err, "GetStdlibPathsWithSuffix(%q)", suffix)
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	var std *internal.Module
+	for _, m := range ds.modules[stdlib.ModulePath] {
+		if std == nil || rawVersionRank(m.Version) < rawVersionRank(std.Version) ||
+			(rawVersionRank(m.Version) == rawVersionRank(std.Version) && semver.Compare(m.Version, std.Version) > 0) {
+			std = m
+		}
+	}
+	if std == nil {
+		return nil, nil
+	}
+	var paths []string
+	for _, u := range std.Units {
+		if u.Name != "" && !strings.HasPrefix(u.Path, "cmd/") && strings.HasSuffix(u.Path, "/"+suffix) {
+			paths = append(paths, u.Path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// latestPackages returns the latest version of each package in the data
+// source, keyed by package path.
+func (ds *DataSource) latestPackages() map[string]*unitVersion {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	latest := map[string]*unitVersion{}
+	for _, m := range ds.allModules() {
+		for _, u := range m.Units {
+			if !u.IsPackage() {
+				continue
+			}
+			if uv, ok := latest[u.Path]; !ok || ds.isLater(m, uv.module) {
+				latest[u.Path] = &unitVersion{m, u}
+			}
+		}
+	}
+	return latest
+}
+
+// matchesAll reports whether every one of terms, which must be lower case,
+// is contained in the path, name or synopsis of the unit of uv.
+func matchesAll(uv *unitVersion, terms []string) bool {
+	text := strings.ToLower(strings.Join([]string{
+		uv.unit.Path,
+		uv.unit.Name,
+		synopsis(uv.unit),
+	}, " "))
+	for _, t := range terms {
+		if !strings.Contains(text, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesFilters reports whether the unit of uv satisfies every one of
+// filters.
+func matchesFilters(uv *unitVersion, filters []internal.SearchFilter) bool {
+	for _, f := range filters {
+		if !matchesFilter(uv, f) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesFilter(uv *unitVersion, f internal.SearchFilter) bool {
+	switch f.Qualifier {
+	case internal.LicenseQualifier:
+		for _, l := range uv.unit.Licenses {
+			for _, t := range l.Types {
+				if strings.EqualFold(t, f.Value) {
+					return true
+				}
+			}
+		}
+	case internal.ModuleQualifier:
+		return internal.MatchModulePattern(f.Value, uv.module.ModulePath)
+	case internal.GOOSQualifier:
+		for _, d := range uv.unit.Documentation {
+			if d.GOOS == f.Value {
+				return true
+			}
+		}
+	case internal.NameQualifier:
+		return uv.unit.Name == f.Value
+	}
+	return false
+}
+
+// isInternalPackage reports whether path has an internal component.
+func isInternalPackage(path string) bool {
+	for _, p := range strings.Split(path, "/") {
+		if p == "internal" {
+			return true
+		}
+	}
+	return false
+}
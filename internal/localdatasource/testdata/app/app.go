@@ -0,0 +1,13 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package app greets the world with the lib module.
+package app
+
+import "example.com/lib"
+
+// Hello returns a greeting.
+func Hello() lib.Greeting {
+	return lib.Greeting("hello")
+}
@@ -0,0 +1,7 @@
+module example.com/lib
+
+go 1.18
+
+require example.com/app v1.0.0
+
+replace example.com/app => ../app
@@ -0,0 +1,17 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package hello prints the greeting of the app module.
+package hello
+
+import (
+	"fmt"
+
+	"example.com/app"
+)
+
+// Print prints the greeting of app.Hello.
+func Print() {
+	fmt.Println(app.Hello())
+}
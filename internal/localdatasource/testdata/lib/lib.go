@@ -0,0 +1,9 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lib is used by the app module.
+package lib
+
+// A Greeting is something to say.
+type Greeting string
@@ -0,0 +1,171 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localdatasource
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/version"
+)
+
+// maxPseudoVersions is the number of pseudo-versions returned by the methods
+// that list them, as in the database.
+const maxPseudoVersions = 10
+
+// GetVersionsForPath returns the versions of the modules that have a unit
+// with the same v1 path as fullPath. See postgres.DB.GetVersionsForPath.
+func (ds *DataSource) GetVersionsForPath(ctx context.Context, fullPath string) (_ []*internal.ModuleInfo, err error) {
+	defer derrors.Wrap(&err, "GetVersionsForPath(%q)", fullPath)
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	var (
+		v1Path string
+		mods   []*internal.Module
+	)
+	for _, m := range ds.allModules() {
+		for _, u := range m.Units {
+			if u.Path == fullPath {
+				v1Path = internal.V1Path(fullPath, m.ModulePath)
+			}
+		}
+	}
+	if v1Path == "" {
+		return nil, nil
+	}
+	for _, m := range ds.allModules() {
+		for _, u := range m.Units {
+			if internal.V1Path(u.Path, m.ModulePath) == v1Path {
+				mods = append(mods, m)
+				break
+			}
+		}
+	}
+	// Order by compatibility, then module path and version, both descending.
+	sort.SliceStable(mods, func(i, j int) bool {
+		a, b := mods[i], mods[j]
+		if ia, ib := isIncompatible(a.Version), isIncompatible(b.Version); ia != ib {
+			return !ia
+		}
+		if a.ModulePath != b.ModulePath {
+			return a.ModulePath > b.ModulePath
+		}
+		return semver.Compare(a.Version, b.Version) > 0
+	})
+	return ds.filterVersions(mods, version.TypeRelease, version.TypePrerelease, version.TypePseudo), nil
+}
+
+// GetLatestMajorVersion returns the major version suffix, such as "/v3", of
+// the latest module in the series with seriesPath, or the empty string if it
+// has none.
+func (ds *DataSource) GetLatestMajorVersion(ctx context.Context, seriesPath string) (_ string, err error) {
+	defer derrors.Wrap(&err, "GetLatestMajorVersion(%q)", seriesPath)
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	var mods []*internal.Module
+	for mpath, ms := range ds.modules {
+		if internal.SeriesPathForModule(mpath) == seriesPath {
+			mods = append(mods, ms...)
+		}
+	}
+	m := ds.latest(mods)
+	if m == nil {
+		return "", fmt.Errorf("series %s: %w", seriesPath, derrors.NotFound)
+	}
+	_, majorPath, ok := module.SplitPathVersion(m.ModulePath)
+	if !ok {
+		return "", fmt.Errorf("module.SplitPathVersion(%q): %v", m.ModulePath, majorPath)
+	}
+	return majorPath, nil
+}
+
+// filterVersions returns the ModuleInfo of the modules in mods whose
+// versions have one of the given types, keeping their order. If the only
+// type is version.TypePseudo, at most maxPseudoVersions are returned.
+// Callers must hold ds.mu.
+func (ds *DataSource) filterVersions(mods []*internal.Module, types ...version.Type) []*internal.ModuleInfo {
+	var infos []*internal.ModuleInfo
+	for _, m := range mods {
+		vt, err := version.ParseType(m.Version)
+		if err != nil {
+			continue
+		}
+		for _, t := range types {
+			if vt == t {
+				infos = append(infos, &ds.moduleInfo(m).ModuleInfo)
+				break
+			}
+		}
+	}
+	if len(types) == 1 && types[0] == version.TypePseudo && len(infos) > maxPseudoVersions {
+		infos = infos[:maxPseudoVersions]
+	}
+	return infos
+}
+
+// seriesVersions returns the ModuleInfo of the versions of the modules in
+// the series of modulePath with the given types, in descending order.
+func (ds *DataSource) seriesVersions(modulePath string, types ...version.Type) []*internal.ModuleInfo {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	seriesPath := internal.SeriesPathForModule(modulePath)
+	var mods []*internal.Module
+	for _, m := range ds.allModules() {
+		if internal.SeriesPathForModule(m.ModulePath) == seriesPath {
+			mods = append(mods, m)
+		}
+	}
+	sortByVersionDesc(mods)
+	return ds.filterVersions(mods, types...)
+}
+
+// packageSeriesVersions returns the ModuleInfo of the module versions with a
+// package whose v1 path is that of the package with pkgPath, with the given
+// types, in descending order.
+func (ds *DataSource) packageSeriesVersions(pkgPath string, types ...version.Type) []*internal.ModuleInfo {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	var v1Path string
+	for _, m := range ds.allModules() {
+		for _, p := range m.LegacyPackages {
+			if p.Path == pkgPath {
+				v1Path = p.V1Path
+			}
+		}
+	}
+	if v1Path == "" {
+		return nil
+	}
+	var mods []*internal.Module
+	for _, m := range ds.allModules() {
+		for _, p := range m.LegacyPackages {
+			if p.V1Path == v1Path {
+				mods = append(mods, m)
+				break
+			}
+		}
+	}
+	sortByVersionDesc(mods)
+	return ds.filterVersions(mods, types...)
+}
+
+// sortByVersionDesc sorts mods with compatible versions first, then by
+// descending version.
+func sortByVersionDesc(mods []*internal.Module) {
+	sort.SliceStable(mods, func(i, j int) bool {
+		a, b := mods[i], mods[j]
+		if ia, ib := isIncompatible(a.Version), isIncompatible(b.Version); ia != ib {
+			return !ia
+		}
+		return semver.Compare(a.Version, b.Version) > 0
+	})
+}
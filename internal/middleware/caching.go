@@ -12,6 +12,8 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v7"
@@ -21,12 +23,14 @@ import (
 	"go.opencensus.io/tag"
 	"golang.org/x/pkgsite/internal/config"
 	"golang.org/x/pkgsite/internal/log"
+	"golang.org/x/pkgsite/internal/xcontext"
 )
 
 var (
 	keyCacheHit       = tag.MustNewKey("cache.hit")
 	keyCacheName      = tag.MustNewKey("cache.name")
 	keyCacheOperation = tag.MustNewKey("cache.operation")
+	keyCacheOutcome   = tag.MustNewKey("cache.outcome")
 	cacheResults      = stats.Int64(
 		"go-discovery/cache/result_count",
 		"The result of a cache request.",
@@ -42,6 +46,11 @@ var (
 		"Errors retrieving from cache.",
 		stats.UnitDimensionless,
 	)
+	cacheOutcomes = stats.Int64(
+		"go-discovery/cache/outcome_count",
+		"The outcome of a cache request or refresh.",
+		stats.UnitDimensionless,
+	)
 
 	CacheResultCount = &view.View{
 		Name:        "go-discovery/cache/result_count",
@@ -64,6 +73,17 @@ var (
 		Description: "cache errors, by cache name",
 		TagKeys:     []tag.Key{keyCacheName, keyCacheOperation},
 	}
+	// CacheOutcomeCount counts cache requests by whether they were served
+	// from a fresh entry ("hit"), from an expired entry within its grace
+	// period ("stale-hit") or by the handler ("miss"), and background
+	// refreshes of expired entries ("refresh").
+	CacheOutcomeCount = &view.View{
+		Name:        "go-discovery/cache/outcome_count",
+		Measure:     cacheOutcomes,
+		Aggregation: view.Count(),
+		Description: "cache outcomes, by cache name and outcome",
+		TagKeys:     []tag.Key{keyCacheName, keyCacheOutcome},
+	}
 
 	// To avoid test flakiness, when testMode is true, cache writes are
 	// synchronous.
@@ -78,6 +98,21 @@ func recordCacheResult(ctx context.Context, name string, hit bool, latency time.
 	}, cacheResults.M(1), cacheLatency.M(ms))
 }
 
+// The outcomes recorded by CacheOutcomeCount.
+const (
+	cacheHit      = "hit"
+	cacheStaleHit = "stale-hit"
+	cacheMiss     = "miss"
+	cacheRefresh  = "refresh"
+)
+
+func recordCacheOutcome(ctx context.Context, name, outcome string) {
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(keyCacheName, name),
+		tag.Upsert(keyCacheOutcome, outcome),
+	}, cacheOutcomes.M(1))
+}
+
 func recordCacheError(ctx context.Context, name, operation string) {
 	stats.RecordWithTags(ctx, []tag.Mutator{
 		tag.Upsert(keyCacheName, name),
@@ -91,6 +126,12 @@ type cache struct {
 	client     *redis.Client
 	delegate   http.Handler
 	expirer    Expirer
+	grace      Expirer
+
+	mu sync.Mutex
+	// refreshing holds the keys of the expired entries being refreshed, so
+	// that only one refresh of each runs at a time.
+	refreshing map[string]bool
 }
 
 // An Expirer computes the TTL that should be used when caching a page.
@@ -106,11 +147,19 @@ func TTL(ttl time.Duration) Expirer {
 // Cache returns a new Middleware that caches every request.
 // The name of the cache is used only for metrics.
 // The expirer is a func that is used to map a new request to its TTL.
+// The grace is a func that is used to map a request to its grace period, the
+// time after its TTL during which the expired page is still served while a
+// single background request refreshes it. If grace is nil, expired pages are
+// never served.
 // authHeader is the header key used by the cache to know that a
 // request should bypass the cache.
 // authValues is the set of values that could be set on the authHeader in
 // order to bypass the cache.
-func Cache(name string, client *redis.Client, expirer Expirer, authValues []string) Middleware {
+//
+// Only 200 OK responses that do not set cookies, are not marked
+// "Cache-Control: no-store" and are written before the request times out are
+// cached.
+func Cache(name string, client *redis.Client, expirer, grace Expirer, authValues []string) Middleware {
 	return func(h http.Handler) http.Handler {
 		return &cache{
 			name:       name,
@@ -118,6 +167,8 @@ func Cache(name string, client *redis.Client, expirer Expirer, authValues []stri
 			client:     client,
 			delegate:   h,
 			expirer:    expirer,
+			grace:      grace,
+			refreshing: map[string]bool{},
 		}
 	}
 }
@@ -133,19 +184,40 @@ func (c *cache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	ctx := r.Context()
 	key := r.URL.String()
+	var grace time.Duration
+	if c.grace != nil {
+		grace = c.grace(r)
+	}
 	start := time.Now()
-	reader, hit := c.get(ctx, key)
+	reader, remaining, hit := c.get(ctx, key)
 	recordCacheResult(ctx, c.name, hit, time.Since(start))
 	if hit {
+		// Entries are stored for their TTL plus their grace period, so an
+		// entry with no more than the grace period left has expired.
+		if remaining > grace {
+			recordCacheOutcome(ctx, c.name, cacheHit)
+		} else {
+			recordCacheOutcome(ctx, c.name, cacheStaleHit)
+			if c.startRefresh(key) {
+				if testMode {
+					c.refresh(r, key, grace)
+				} else {
+					go c.refresh(r, key, grace)
+				}
+			}
+		}
 		if _, err := io.Copy(w, reader); err != nil {
 			log.Errorf(ctx, "error copying zip bytes: %v", err)
 		}
 		return
 	}
+	recordCacheOutcome(ctx, c.name, cacheMiss)
 	rec := newRecorder(w)
 	c.delegate.ServeHTTP(rec, r)
-	if rec.bufErr == nil && (rec.statusCode == 0 || rec.statusCode == http.StatusOK) {
-		ttl := c.expirer(r)
+	// A handler that ran out of time may have written an error or incomplete
+	// page, even if it says otherwise.
+	if rec.cacheable() && ctx.Err() == nil {
+		ttl := c.expirer(r) + grace
 		if testMode {
 			c.put(ctx, key, rec, ttl)
 		} else {
@@ -154,14 +226,73 @@ func (c *cache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (c *cache) get(ctx context.Context, key string) (io.Reader, bool) {
+// refreshTimeout bounds the time taken by the handler to refresh an expired
+// entry, if the request that found it expired has no deadline.
+const refreshTimeout = time.Minute
+
+// startRefresh reports whether a refresh of the entry for key may start,
+// because none is running. If so, the refresh is recorded as running until
+// refresh returns.
+func (c *cache) startRefresh(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refreshing[key] {
+		return false
+	}
+	c.refreshing[key] = true
+	return true
+}
+
+// refresh serves r again, without writing the response anywhere, and replaces
+// the cache entry for key with the response if it can be cached. It must only
+// be called after startRefresh(key) returns true.
+func (c *cache) refresh(r *http.Request, key string, grace time.Duration) {
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.refreshing, key)
+	}()
+
+	// The request that found the entry expired may be done before the
+	// refresh is, so don't let its cancelation end the refresh. The refresh
+	// has the same deadline instead, which the Timeouts middleware set from
+	// the budget of its route.
+	ctx := xcontext.Detach(r.Context())
+	var cancel context.CancelFunc
+	if deadline, ok := r.Context().Deadline(); ok {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, refreshTimeout)
+	}
+	defer cancel()
+	r = r.WithContext(ctx)
+	recordCacheOutcome(ctx, c.name, cacheRefresh)
+	rec := newRecorder(&discardResponseWriter{header: http.Header{}})
+	c.delegate.ServeHTTP(rec, r)
+	if rec.cacheable() && ctx.Err() == nil {
+		c.put(ctx, key, rec, c.expirer(r)+grace)
+	} else {
+		log.Infof(ctx, "cache: not refreshing %q: status %d, context error %v", key, rec.statusCode, ctx.Err())
+	}
+}
+
+// get returns a reader for the entry for key, and how long it will be kept.
+func (c *cache) get(ctx context.Context, key string) (io.Reader, time.Duration, bool) {
 	// Set a short timeout for redis requests, so that we can quickly
 	// fall back to un-cached serving if redis is unavailable.
 	getCtx, cancelGet := context.WithTimeout(ctx, 100*time.Millisecond)
 	defer cancelGet()
-	val, err := c.client.WithContext(getCtx).Get(key).Bytes()
+	var (
+		get  *redis.StringCmd
+		pttl *redis.DurationCmd
+	)
+	_, err := c.client.WithContext(getCtx).TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(key)
+		pttl = pipe.PTTL(key)
+		return nil
+	})
 	if err == redis.Nil {
-		return nil, false
+		return nil, 0, false
 	}
 	if err != nil {
 		select {
@@ -171,15 +302,19 @@ func (c *cache) get(ctx context.Context, key string) (io.Reader, bool) {
 			log.Infof(ctx, "cache get(%q): %v", key, err)
 		}
 		recordCacheError(ctx, c.name, "GET")
-		return nil, false
+		return nil, 0, false
+	}
+	val, err := get.Bytes()
+	if err != nil {
+		return nil, 0, false
 	}
 	zr, err := gzip.NewReader(bytes.NewReader(val))
 	if err != nil {
 		log.Errorf(ctx, "cache: gzip.NewReader: %v", err)
 		recordCacheError(ctx, c.name, "UNZIP")
-		return nil, false
+		return nil, 0, false
 	}
-	return zr, true
+	return zr, pttl.Val(), true
 }
 
 func (c *cache) put(ctx context.Context, key string, rec *cacheRecorder, ttl time.Duration) {
@@ -197,6 +332,16 @@ func (c *cache) put(ctx context.Context, key string, rec *cacheRecorder, ttl tim
 	}
 }
 
+// discardResponseWriter is an http.ResponseWriter that discards what is
+// written to it.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
+
 func newRecorder(w http.ResponseWriter) *cacheRecorder {
 	buf := &bytes.Buffer{}
 	zw := gzip.NewWriter(buf)
@@ -215,6 +360,30 @@ type cacheRecorder struct {
 	zipWriter *gzip.Writer
 }
 
+// cacheable reports whether the recorded response can be cached: it was
+// recorded without error, it is a 200 OK, it does not set a cookie, which
+// would then be sent to everyone, and its handler did not forbid storing it,
+// as it does for partial results.
+func (r *cacheRecorder) cacheable() bool {
+	return r.bufErr == nil &&
+		(r.statusCode == 0 || r.statusCode == http.StatusOK) &&
+		len(r.Header().Values("Set-Cookie")) == 0 &&
+		!noStore(r.Header())
+}
+
+// noStore reports whether h has a Cache-Control header with the no-store
+// directive.
+func noStore(h http.Header) bool {
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(d), "no-store") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (r *cacheRecorder) Write(b []byte) (int, error) {
 	n, err := r.ResponseWriter.Write(b)
 	// Only try writing to the buffer if we haven't yet encountered an error.
@@ -5,11 +5,13 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -44,7 +46,7 @@ func TestCache(t *testing.T) {
 
 	c := redis.NewClient(&redis.Options{Addr: s.Addr()})
 	mux := http.NewServeMux()
-	mux.Handle("/A", Cache("A", c, TTL(1*time.Minute), []string{"yes"})(handler))
+	mux.Handle("/A", Cache("A", c, TTL(1*time.Minute), nil, []string{"yes"})(handler))
 	mux.Handle("/B", handler)
 	ts := httptest.NewServer(mux)
 	view.Register(CacheResultCount)
@@ -178,3 +180,263 @@ func TestCache(t *testing.T) {
 		}
 	}
 }
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	testMode = true
+	var (
+		body   string
+		status int
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status > 0 {
+			w.WriteHeader(status)
+		}
+		fmt.Fprint(w, body)
+	})
+
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	c := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	ts := httptest.NewServer(Cache("S", c, TTL(1*time.Minute), TTL(10*time.Minute), nil)(handler))
+	defer ts.Close()
+	view.Register(CacheOutcomeCount)
+	defer view.Unregister(CacheOutcomeCount)
+
+	// The following tests are stateful, like those of TestCache.
+	for _, test := range []struct {
+		label        string
+		advanceTime  time.Duration
+		body         string
+		status       int
+		wantBody     string
+		wantOutcomes map[string]int
+	}{
+		{
+			label:        "first request",
+			body:         "1",
+			wantBody:     "1",
+			wantOutcomes: map[string]int{"miss": 1},
+		},
+		{
+			label:        "fresh",
+			advanceTime:  30 * time.Second,
+			body:         "2",
+			wantBody:     "1",
+			wantOutcomes: map[string]int{"miss": 1, "hit": 1},
+		},
+		{
+			label:        "expired within grace",
+			advanceTime:  1 * time.Minute,
+			body:         "2",
+			wantBody:     "1",
+			wantOutcomes: map[string]int{"miss": 1, "hit": 1, "stale-hit": 1, "refresh": 1},
+		},
+		{
+			label:        "refreshed",
+			body:         "3",
+			wantBody:     "2",
+			wantOutcomes: map[string]int{"miss": 1, "hit": 2, "stale-hit": 1, "refresh": 1},
+		},
+		{
+			label:        "failed refresh",
+			advanceTime:  2 * time.Minute,
+			body:         "4",
+			status:       http.StatusInternalServerError,
+			wantBody:     "2",
+			wantOutcomes: map[string]int{"miss": 1, "hit": 2, "stale-hit": 2, "refresh": 2},
+		},
+		{
+			label:        "still stale",
+			body:         "5",
+			status:       http.StatusInternalServerError,
+			wantBody:     "2",
+			wantOutcomes: map[string]int{"miss": 1, "hit": 2, "stale-hit": 3, "refresh": 3},
+		},
+		{
+			label:        "grace period over",
+			advanceTime:  10 * time.Minute,
+			body:         "6",
+			wantBody:     "6",
+			wantOutcomes: map[string]int{"miss": 2, "hit": 2, "stale-hit": 3, "refresh": 3},
+		},
+	} {
+		s.FastForward(test.advanceTime)
+		body = test.body
+		status = test.status
+		resp, err := ts.Client().Get(ts.URL + "/S")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if string(got) != test.wantBody {
+			t.Errorf("[%s] GET returned body %s, want %s", test.label, got, test.wantBody)
+		}
+		if diff := cmp.Diff(test.wantOutcomes, collectCacheOutcomes(t, "S")); diff != "" {
+			t.Errorf("[%s] CacheOutcomeCount diff (-want +got):\n%s", test.label, diff)
+		}
+	}
+}
+
+func TestCacheSetCookie(t *testing.T) {
+	testMode = true
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	n := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: strconv.Itoa(n)})
+		fmt.Fprint(w, n)
+	})
+	c := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	h := Cache("C", c, TTL(1*time.Minute), nil, nil)(handler)
+	for i := 1; i <= 2; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/C", nil))
+		if got, want := w.Body.String(), strconv.Itoa(i); got != want {
+			t.Errorf("request %d: got body %q, want %q", i, got, want)
+		}
+	}
+	if keys := s.Keys(); len(keys) != 0 {
+		t.Errorf("got cache keys %v, want none", keys)
+	}
+}
+
+func TestCacheNotStored(t *testing.T) {
+	// Neither responses marked no-store nor those written after the request
+	// timed out are cached.
+	testMode = true
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/nostore", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private, no-store")
+		fmt.Fprint(w, "partial")
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		fmt.Fprint(w, "too late")
+	})
+	c := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	h := Chain(
+		Timeout(10*time.Millisecond),
+		Cache("C", c, TTL(1*time.Minute), nil, nil),
+	)(mux)
+	for _, path := range []string{"/nostore", "/slow"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: got status %d, want %d", path, w.Code, http.StatusOK)
+		}
+	}
+	if keys := s.Keys(); len(keys) != 0 {
+		t.Errorf("got cache keys %v, want none", keys)
+	}
+}
+
+func TestCacheRefreshOnce(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var (
+		mu       sync.Mutex
+		calls    int
+		deadline time.Time
+		started  = make(chan struct{})
+		release  = make(chan struct{})
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		deadline, _ = r.Context().Deadline()
+		mu.Unlock()
+		close(started)
+		<-release
+		fmt.Fprint(w, "refreshed")
+	})
+	c := &cache{
+		name:       "R",
+		client:     redis.NewClient(&redis.Options{Addr: s.Addr()}),
+		delegate:   handler,
+		expirer:    TTL(time.Minute),
+		refreshing: map[string]bool{},
+	}
+	// The request is canceled as soon as the refresh starts, but the
+	// refresh keeps its deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	wantDeadline, _ := ctx.Deadline()
+	r := httptest.NewRequest("GET", "/R", nil).WithContext(ctx)
+	if !c.startRefresh("/R") {
+		t.Fatal("startRefresh: got false with no refresh running, want true")
+	}
+	done := make(chan struct{})
+	go func() {
+		c.refresh(r, "/R", 0)
+		close(done)
+	}()
+	<-started
+	cancel()
+	for i := 0; i < 10; i++ {
+		if c.startRefresh("/R") {
+			t.Fatal("startRefresh: got true with a refresh running, want false")
+		}
+	}
+	close(release)
+	<-done
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+	if !deadline.Equal(wantDeadline) {
+		t.Errorf("refresh deadline = %v, want %v", deadline, wantDeadline)
+	}
+	if !s.Exists("/R") {
+		t.Error("entry was not refreshed")
+	}
+	if !c.startRefresh("/R") {
+		t.Error("startRefresh after the refresh: got false, want true")
+	}
+}
+
+// collectCacheOutcomes returns the counts of the outcomes of the cache with
+// the given name recorded since CacheOutcomeCount was registered.
+func collectCacheOutcomes(t *testing.T, name string) map[string]int {
+	t.Helper()
+	rows, err := view.RetrieveData(CacheOutcomeCount.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for _, row := range rows {
+		var rowName, outcome string
+		for _, tg := range row.Tags {
+			switch tg.Key {
+			case keyCacheName:
+				rowName = tg.Value
+			case keyCacheOutcome:
+				outcome = tg.Value
+			}
+		}
+		if rowName == name {
+			counts[outcome] = int(row.Data.(*view.CountData).Value)
+		}
+	}
+	return counts
+}
@@ -0,0 +1,295 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/pkgsite/internal/config"
+	"golang.org/x/pkgsite/internal/log"
+)
+
+// compressibleTypes are the media types of the responses that Compress
+// compresses. Images other than SVG, fonts and archives are already
+// compressed.
+var compressibleTypes = map[string]bool{
+	"application/javascript": true,
+	"application/json":       true,
+	"application/xml":        true,
+	"image/svg+xml":          true,
+	"text/css":               true,
+	"text/html":              true,
+	"text/javascript":        true,
+	"text/plain":             true,
+	"text/xml":               true,
+}
+
+// Compress returns a Middleware that compresses responses with brotli or
+// gzip, whichever the request accepts, preferring brotli. Only responses of
+// compressible types that are at least settings.MinSize bytes long are
+// compressed; Vary: Accept-Encoding is added to all of those, whether or not
+// they are compressed for this request.
+//
+// Compress should come before Cache, so that the cache holds uncompressed
+// pages, which are compressed for each request according to its encoding.
+func Compress(settings config.CompressionSettings) Middleware {
+	gzipLevel := settings.GzipLevel
+	if _, err := gzip.NewWriterLevel(nil, gzipLevel); err != nil {
+		log.Errorf(context.Background(), "Compress: %v; using the default level", err)
+		gzipLevel = gzip.DefaultCompression
+	}
+	brotliLevel := settings.BrotliLevel
+	if brotliLevel < brotli.BestSpeed || brotliLevel > brotli.BestCompression {
+		log.Errorf(context.Background(), "Compress: invalid brotli level %d; using the default level", brotliLevel)
+		brotliLevel = brotli.DefaultCompression
+	}
+	c := &compressor{
+		minSize: settings.MinSize,
+		gzipPool: sync.Pool{New: func() interface{} {
+			w, _ := gzip.NewWriterLevel(nil, gzipLevel)
+			return w
+		}},
+		brotliPool: sync.Pool{New: func() interface{} {
+			return brotli.NewWriterLevel(nil, brotliLevel)
+		}},
+	}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cw := &compressWriter{
+				ResponseWriter: w,
+				c:              c,
+				encoding:       negotiateEncoding(r.Header.Get("Accept-Encoding")),
+			}
+			defer cw.close()
+			h.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// A compressor holds the settings of Compress, and reuses its encoders.
+type compressor struct {
+	minSize    int
+	gzipPool   sync.Pool // of *gzip.Writer
+	brotliPool sync.Pool // of *brotli.Writer
+}
+
+// An encoder compresses what is written to it.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// newEncoder returns an encoder for encoding that writes to w.
+func (c *compressor) newEncoder(encoding string, w io.Writer) encoder {
+	switch encoding {
+	case "br":
+		bw := c.brotliPool.Get().(*brotli.Writer)
+		bw.Reset(w)
+		return bw
+	case "gzip":
+		gw := c.gzipPool.Get().(*gzip.Writer)
+		gw.Reset(w)
+		return gw
+	}
+	return nil
+}
+
+// putEncoder returns e, which has been closed, for reuse.
+func (c *compressor) putEncoder(e encoder) {
+	switch e := e.(type) {
+	case *brotli.Writer:
+		c.brotliPool.Put(e)
+	case *gzip.Writer:
+		c.gzipPool.Put(e)
+	}
+}
+
+// negotiateEncoding returns the encoding to compress a response with, given
+// the Accept-Encoding header of its request: "br" or "gzip", whichever has the
+// higher quality value, preferring "br", or the empty string if neither is
+// accepted.
+func negotiateEncoding(accept string) string {
+	br, gz, star := -1.0, -1.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					v = 0
+				}
+				q = v
+			}
+		}
+		switch name {
+		case "br":
+			br = q
+		case "gzip", "x-gzip":
+			gz = q
+		case "*":
+			star = q
+		}
+	}
+	if br < 0 {
+		br = star
+	}
+	if gz < 0 {
+		gz = star
+	}
+	switch {
+	case br > 0 && br >= gz:
+		return "br"
+	case gz > 0:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressWriter is an http.ResponseWriter that compresses the response with
+// encoding if it should be compressed. It holds back the start of the
+// response until it knows whether the response is long enough.
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	encoding string
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder // non-nil if the response is being compressed
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.c.minSize {
+			return len(b), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(); err != nil {
+			return
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// decide determines whether to compress the response, writes its header, and
+// writes what has been held back.
+func (w *compressWriter) decide() error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 && h.Get("Content-Encoding") == "" {
+		// Sniff the type now, as net/http would, since it can't sniff
+		// compressed bytes.
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if w.compressible() {
+		addVary(h, "Accept-Encoding")
+		if w.encoding != "" {
+			h.Del("Content-Length")
+			h.Set("Content-Encoding", w.encoding)
+			w.enc = w.c.newEncoder(w.encoding, w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// compressible reports whether the response can be compressed: it has a
+// body of a compressible type that is not already encoded and is at least
+// minSize bytes long, and it is not part of a larger one.
+func (w *compressWriter) compressible() bool {
+	h := w.Header()
+	if w.status < 200 || w.status == http.StatusNoContent || w.status == http.StatusNotModified ||
+		w.status == http.StatusPartialContent {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	if len(w.buf) < w.c.minSize || len(w.buf) == 0 {
+		return false
+	}
+	mediaType := strings.TrimSpace(strings.SplitN(h.Get("Content-Type"), ";", 2)[0])
+	return compressibleTypes[strings.ToLower(mediaType)]
+}
+
+// close finishes the response.
+func (w *compressWriter) close() {
+	if !w.decided {
+		if err := w.decide(); err != nil {
+			return
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Close(); err != nil {
+			log.Errorf(context.Background(), "compressWriter.close: %v", err)
+		}
+		w.c.putEncoder(w.enc)
+		w.enc = nil
+	}
+}
+
+// addVary adds value to the Vary header of h, unless it is already there.
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
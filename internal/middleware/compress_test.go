@@ -0,0 +1,260 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/andybalholm/brotli"
+	"github.com/go-redis/redis/v7"
+	"golang.org/x/pkgsite/internal/config"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"x-gzip", "gzip"},
+		{"GZIP, deflate", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"br;q=1.0, gzip;q=1.0", "br"},
+		{"br;q=0, gzip;q=0", ""},
+		{"*", "br"},
+		{"*;q=0.5, br;q=0", "gzip"},
+		{"deflate, gzip;q=junk", ""},
+	} {
+		if got := negotiateEncoding(test.in); got != test.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+// testPage returns an HTML page of at least n bytes, resembling a
+// documentation page.
+func testPage(n int) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html><head><title>Documentation</title></head><body>\n")
+	for i := 0; b.Len() < n; i++ {
+		fmt.Fprintf(&b, `<div class="Documentation-declaration"><pre>func F%d(ctx context.Context, name string) (*Result%d, error)</pre></div>
+<p>F%d returns the result for name. It is safe to call F%d concurrently.</p>
+`, i, i%7, i, i)
+	}
+	b.WriteString("</body></html>\n")
+	return b.String()
+}
+
+func TestCompress(t *testing.T) {
+	page := testPage(4000)
+	small := "<p>small</p>"
+	png := strings.Repeat("\x89PNG\r\n\x1a\n", 1000)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(page)))
+		// Write in pieces, some smaller than the minimum size.
+		for i := 0; i < len(page); i += 100 {
+			end := i + 100
+			if end > len(page) {
+				end = len(page)
+			}
+			io.WriteString(w, page[i:end])
+		}
+	})
+	mux.HandleFunc("/sniffed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Cookie")
+		io.WriteString(w, page)
+	})
+	mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, small)
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(png)))
+		io.WriteString(w, png)
+	})
+	mux.HandleFunc("/encoded", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		io.WriteString(zw, page)
+		zw.Close()
+	})
+	mux.HandleFunc("/notfound", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, page)
+	})
+	ts := httptest.NewServer(Compress(config.CompressionSettings{MinSize: 1024, GzipLevel: -1, BrotliLevel: 5})(mux))
+	defer ts.Close()
+	// Don't let the client decompress responses.
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	for _, test := range []struct {
+		path, accept string
+		wantStatus   int
+		wantEncoding string
+		wantVary     []string
+		wantBody     string
+	}{
+		{"/page", "gzip, deflate, br", 200, "br", []string{"Accept-Encoding"}, page},
+		{"/page", "gzip", 200, "gzip", []string{"Accept-Encoding"}, page},
+		{"/page", "", 200, "", []string{"Accept-Encoding"}, page},
+		{"/sniffed", "gzip", 200, "gzip", []string{"Cookie", "Accept-Encoding"}, page},
+		{"/small", "gzip", 200, "", nil, small},
+		{"/image", "gzip", 200, "", nil, png},
+		{"/encoded", "br", 200, "gzip", nil, page},
+		{"/notfound", "br", 404, "br", []string{"Accept-Encoding"}, page},
+	} {
+		t.Run(test.path+"-"+test.accept, func(t *testing.T) {
+			req, err := http.NewRequest("GET", ts.URL+test.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept-Encoding", test.accept)
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			raw, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.wantStatus {
+				t.Errorf("got status %d, want %d", res.StatusCode, test.wantStatus)
+			}
+			if got := res.Header.Get("Content-Encoding"); got != test.wantEncoding {
+				t.Errorf("got Content-Encoding %q, want %q", got, test.wantEncoding)
+			}
+			if got := res.Header.Values("Vary"); fmt.Sprint(got) != fmt.Sprint(test.wantVary) {
+				t.Errorf("got Vary %q, want %q", got, test.wantVary)
+			}
+			// Content-Length, if any, must be that of the body as sent.
+			if cl := res.Header.Get("Content-Length"); cl != "" && cl != strconv.Itoa(len(raw)) {
+				t.Errorf("got Content-Length %s, but read %d bytes", cl, len(raw))
+			}
+			if test.wantEncoding != "" && len(raw) >= len(test.wantBody) {
+				t.Errorf("encoded body has %d bytes, not fewer than %d", len(raw), len(test.wantBody))
+			}
+			body, err := decode(test.wantEncoding, raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != test.wantBody {
+				t.Errorf("got body of %d bytes, want %d", len(body), len(test.wantBody))
+			}
+		})
+	}
+}
+
+func TestCompressCache(t *testing.T) {
+	// The cache holds the uncompressed page, which is compressed for each
+	// request according to its encoding.
+	testMode = true
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+	page := testPage(4000)
+	n := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, page)
+	})
+	h := Chain(
+		Compress(config.CompressionSettings{MinSize: 1024, GzipLevel: -1, BrotliLevel: 5}),
+		Cache("compress", c, TTL(time.Minute), nil, nil),
+	)(handler)
+	for _, encoding := range []string{"gzip", "br", ""} {
+		req := httptest.NewRequest("GET", "/page", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if got := w.Header().Get("Content-Encoding"); got != encoding {
+			t.Errorf("%q: got Content-Encoding %q", encoding, got)
+		}
+		body, err := decode(encoding, w.Body.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != page {
+			t.Errorf("%q: got body of %d bytes, want %d", encoding, len(body), len(page))
+		}
+	}
+	if n != 1 {
+		t.Errorf("handler called %d times, want 1", n)
+	}
+}
+
+func decode(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(zr)
+	case "br":
+		return ioutil.ReadAll(brotli.NewReader(bytes.NewReader(data)))
+	}
+	return data, nil
+}
+
+// BenchmarkCompress compares the time to compress a documentation page of
+// about 200KB with each encoding and level, and reports the size of the
+// compressed page.
+func BenchmarkCompress(b *testing.B) {
+	page := testPage(200 << 10)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, page)
+	})
+	for _, bm := range []struct {
+		name     string
+		encoding string
+		settings config.CompressionSettings
+	}{
+		{"identity", "", config.CompressionSettings{}},
+		{"gzip-1", "gzip", config.CompressionSettings{GzipLevel: gzip.BestSpeed}},
+		{"gzip-default", "gzip", config.CompressionSettings{GzipLevel: gzip.DefaultCompression}},
+		{"gzip-9", "gzip", config.CompressionSettings{GzipLevel: gzip.BestCompression}},
+		{"br-1", "br", config.CompressionSettings{BrotliLevel: 1}},
+		{"br-5", "br", config.CompressionSettings{BrotliLevel: 5}},
+		{"br-11", "br", config.CompressionSettings{BrotliLevel: 11}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			h := Compress(bm.settings)(handler)
+			req := httptest.NewRequest("GET", "/page", nil)
+			req.Header.Set("Accept-Encoding", bm.encoding)
+			var size int
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+				size = w.Body.Len()
+			}
+			b.ReportMetric(float64(size), "bytes/page")
+			b.ReportMetric(float64(size)/float64(len(page))*100, "%size")
+		})
+	}
+}
@@ -6,10 +6,14 @@ package middleware
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"hash/fnv"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,7 +23,18 @@ import (
 	"golang.org/x/pkgsite/internal/log"
 )
 
-const experimentQueryParamKey = "experiment"
+const (
+	experimentQueryParamKey = "experiment"
+
+	// experimentCookieName is the name of the cookie that identifies a client
+	// whose IP address is unknown, so that its requests are enrolled in the
+	// same experiments.
+	experimentCookieName = "go-discovery-experiment-id"
+
+	// experimentsHeader is the response header that lists the experiments
+	// active for the request, for debugging.
+	experimentsHeader = "X-Go-Discovery-Experiments"
+)
 
 // An Experimenter contains information about active experiments from the
 // experiment source.
@@ -46,25 +61,35 @@ func NewExperimenter(ctx context.Context, pollEvery time.Duration, esf func(cont
 }
 
 // Experiment returns a new Middleware that sets active experiments for each
-// incoming request.
-func Experiment(e *Experimenter) Middleware {
+// incoming request, and lists them in the X-Go-Discovery-Experiments response
+// header. trustedHops is the number of proxies in front of the server, as in
+// config.QuotaSettings; it determines which address identifies the client.
+func Experiment(e *Experimenter, trustedHops int) Middleware {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			r2 := e.setExperimentsForRequest(r)
+			r2 := e.setExperimentsForRequest(w, r, trustedHops)
+			if active := experiment.FromContext(r2.Context()).Active(); len(active) > 0 {
+				sort.Strings(active)
+				w.Header().Set(experimentsHeader, strings.Join(active, ","))
+			}
 			h.ServeHTTP(w, r2)
 		})
 	}
 }
 
 // setExperimentsForRequest sets the experiments for a given request.
-// Experiments should be stable for a given IP address.
-func (e *Experimenter) setExperimentsForRequest(r *http.Request) *http.Request {
+// Experiments should be stable for a given client; see experimentClientID.
+func (e *Experimenter) setExperimentsForRequest(w http.ResponseWriter, r *http.Request, trustedHops int) *http.Request {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	var id string
+	if partialRollout(e.snapshot) {
+		id = experimentClientID(w, r, trustedHops)
+	}
 	var exps []string
 	for _, exp := range e.snapshot {
-		if shouldSetExperiment(r, exp) {
+		if shouldSetExperiment(id, exp) {
 			exps = append(exps, exp.Name)
 		}
 	}
@@ -72,6 +97,46 @@ func (e *Experimenter) setExperimentsForRequest(r *http.Request) *http.Request {
 	return r.WithContext(experiment.NewContext(r.Context(), exps...))
 }
 
+// partialRollout reports whether any of exps is rolled out to some requests
+// but not all of them.
+func partialRollout(exps []*internal.Experiment) bool {
+	for _, e := range exps {
+		if e.Rollout > 0 && e.Rollout < 100 {
+			return true
+		}
+	}
+	return false
+}
+
+// experimentClientID returns the identifier that the experiments of the
+// client of r are chosen by: the block of IP addresses that it comes from or,
+// if that is unknown, the ID in its experiment cookie. A client with neither
+// is assigned a new ID, which is set in the cookie with w. If an ID can't be
+// made, it returns the empty string.
+func experimentClientID(w http.ResponseWriter, r *http.Request, trustedHops int) string {
+	if ip := IPKey(r, trustedHops); ip != "" {
+		return ip
+	}
+	if c, err := r.Cookie(experimentCookieName); err == nil && c.Value != "" {
+		return c.Value
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Errorf(r.Context(), "experimentClientID: %v", err)
+		return ""
+	}
+	id := hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     experimentCookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
+}
+
 // pollUpdates polls the experiment source for updates to the snapshot, until
 // e.closeChan is closed.
 func (e *Experimenter) pollUpdates(ctx context.Context) {
@@ -110,24 +175,31 @@ func (e *Experimenter) loadNextSnapshot(ctx context.Context) (err error) {
 	return nil
 }
 
-// shouldSetExperiment reports whether a given request should be enrolled in
-// the experiment, based on the ip. e.Name, and e.Rollout.
+// shouldSetExperiment reports whether requests from the client with the given
+// id should be enrolled in the experiment, based on id, e.Name, and
+// e.Rollout.
 //
-// Requests from empty ip addresses are never enrolled.
-// All requests from the same IP will be enrolled in the same set of
-// experiments.
-func shouldSetExperiment(r *http.Request, e *internal.Experiment) bool {
+// Clients with an empty id are never enrolled, unless e.Rollout is 100.
+// All requests from the same client will be enrolled in the same set of
+// experiments, and raising e.Rollout only adds clients to the experiment.
+func shouldSetExperiment(id string, e *internal.Experiment) bool {
 	if e.Rollout == 0 {
 		return false
 	}
 	if e.Rollout >= 100 {
 		return true
 	}
-	ip := ipKey(r.Header.Get("X-Forwarded-For"))
-	if ip == "" {
+	if id == "" {
 		return false
 	}
+	return experimentBucket(id, e.Name) < e.Rollout
+}
+
+// experimentBucket returns the bucket, from 0 to 99, that the client with the
+// given id is in for the named experiment. Each experiment divides clients
+// into buckets independently.
+func experimentBucket(id, name string) uint {
 	h := fnv.New32a()
-	fmt.Fprintf(h, "%s %s", ip, e.Name)
-	return uint(h.Sum32())%100 < e.Rollout
+	fmt.Fprintf(h, "%s %s", id, name)
+	return uint(h.Sum32()) % 100
 }
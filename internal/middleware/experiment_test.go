@@ -7,6 +7,7 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"math"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
@@ -60,7 +61,7 @@ func TestSetAndLoadExperiments(t *testing.T) {
 	})
 
 	mux := http.NewServeMux()
-	mux.Handle("/", Experiment(experimenter)(handler))
+	mux.Handle("/", Experiment(experimenter, 0)(handler))
 	ts := httptest.NewServer(mux)
 	makeRequest := func(t *testing.T) {
 		t.Helper()
@@ -92,20 +93,20 @@ func TestSetAndLoadExperiments(t *testing.T) {
 }
 
 func TestShouldSetExperiment(t *testing.T) {
+	// The use case is simple enough that a deterministic seed should provide
+	// enough coverage.
+	rnd := rand.New(rand.NewSource(1))
 	ipv4Addr := func() string {
 		a := make([]string, 4)
 		for i := 0; i < 4; i++ {
-			// The use case is simple enough that a deterministic
-			// seed should provide enough coverage.
-			a[i] = strconv.Itoa(rand.Intn(256))
+			a[i] = strconv.Itoa(rnd.Intn(256))
 		}
 		return strings.Join(a, ".")
 	}
-	var ipAddresses []string
+	var ids []string
 	const numIPs = 10000.0
 	for i := 0; i < numIPs; i++ {
-		ip := ipv4Addr()
-		ipAddresses = append(ipAddresses, ip)
+		ids = append(ids, ipKey(ipv4Addr(), 0))
 	}
 
 	for _, rollout := range []uint{0, 33, 47, 50, 53, 75, 100} {
@@ -115,13 +116,8 @@ func TestShouldSetExperiment(t *testing.T) {
 				Rollout: rollout,
 			}
 			var inExperiment int
-			for _, ip := range ipAddresses {
-				req, err := http.NewRequest("GET", "http://foo", nil)
-				if err != nil {
-					t.Fatal(err)
-				}
-				req.Header.Add("X-Forwarded-For", ip)
-				if shouldSetExperiment(req, test) {
+			for _, id := range ids {
+				if shouldSetExperiment(id, test) {
 					inExperiment++
 				}
 			}
@@ -131,10 +127,108 @@ func TestShouldSetExperiment(t *testing.T) {
 				}
 				return
 			}
-			got := uint(100 * inExperiment / numIPs)
-			if got != test.Rollout {
-				t.Errorf("rollout = %d; want = %d", got, test.Rollout)
+			// The share of clients in the experiment should be within two
+			// percentage points of the rollout.
+			got := 100 * float64(inExperiment) / numIPs
+			if math.Abs(got-float64(test.Rollout)) > 2 {
+				t.Errorf("rollout = %.1f; want = %d +/- 2", got, test.Rollout)
 			}
 		})
 	}
 }
+
+func TestShouldSetExperimentStable(t *testing.T) {
+	// A client stays in the experiment while the rollout grows.
+	for _, id := range []string{"1.2.3.0", "8.8.8.0", "2001:db8::ff00:42:8300", "0123456789abcdef"} {
+		var was bool
+		for rollout := uint(0); rollout <= 100; rollout++ {
+			e := &internal.Experiment{Name: "test", Rollout: rollout}
+			got := shouldSetExperiment(id, e)
+			if got != shouldSetExperiment(id, e) {
+				t.Fatalf("%s, rollout %d: got different results for the same client", id, rollout)
+			}
+			if was && !got {
+				t.Errorf("%s left the experiment when its rollout grew to %d", id, rollout)
+			}
+			was = got
+		}
+		if !was {
+			t.Errorf("%s is not in the experiment at a rollout of 100", id)
+		}
+	}
+	if shouldSetExperiment("", &internal.Experiment{Name: "test", Rollout: 99}) {
+		t.Error("client with no ID is in the experiment at a rollout of 99")
+	}
+}
+
+func TestExperimentClient(t *testing.T) {
+	ctx := context.Background()
+	const testFeature = "test-feature"
+	source := &testExperimentSource{
+		experiments: []*internal.Experiment{
+			{Name: testFeature, Rollout: 50},
+			{Name: "everyone", Rollout: 100},
+		},
+	}
+	experimenter, err := NewExperimenter(ctx, time.Hour, func(context.Context) internal.ExperimentSource { return source })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var active bool
+	// One proxy in front of the server appends the address of the client.
+	h := Experiment(experimenter, 1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		active = experiment.IsActive(r.Context(), testFeature)
+	}))
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	// Requests from the same IP block get the same experiments, whatever
+	// addresses the client makes up in front of the one the proxy added.
+	var first bool
+	for i := 0; i < 10; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Forwarded-For", fmt.Sprintf("10.%d.0.1, 1.2.3.%d", i, i))
+		w := serve(r)
+		if i == 0 {
+			first = active
+		} else if active != first {
+			t.Fatalf("request from 1.2.3.%d: got active %t, want %t", i, active, first)
+		}
+		want := "everyone"
+		if active {
+			want = "everyone," + testFeature
+		}
+		if got := w.Header().Get(experimentsHeader); got != want {
+			t.Errorf("got %s header %q, want %q", experimentsHeader, got, want)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Error("cookie set for a client with an IP address")
+		}
+	}
+
+	// A client without an IP address is assigned a cookie, and bucketed by
+	// it from then on.
+	w := serve(httptest.NewRequest("GET", "/", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != experimentCookieName {
+		t.Fatalf("got cookies %v, want one %s cookie", cookies, experimentCookieName)
+	}
+	first = active
+	if want := experimentBucket(cookies[0].Value, testFeature) < 50; first != want {
+		t.Errorf("got active %t for the new client, want %t", first, want)
+	}
+	for i := 0; i < 10; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(cookies[0])
+		w := serve(r)
+		if active != first {
+			t.Fatalf("request %d with cookie: got active %t, want %t", i, active, first)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Fatal("cookie set again")
+		}
+	}
+}
@@ -5,23 +5,68 @@
 package middleware
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"net/http"
+	"runtime/debug"
 
+	"cloud.google.com/go/errorreporting"
 	"golang.org/x/pkgsite/internal/log"
 )
 
+// incidentIDKey is the type of the context key for incident IDs.
+type incidentIDKey struct{}
+
+// IncidentID returns the ID of the panic that the request with context ctx
+// is being served for, as set by Panic, or the empty string.
+func IncidentID(ctx context.Context) string {
+	id, _ := ctx.Value(incidentIDKey{}).(string)
+	return id
+}
+
 // Panic returns a middleware that executes panicHandler on any panic
-// originating from the delegate handler.
-func Panic(panicHandler http.Handler) Middleware {
+// originating from the delegate handler. Each panic is given a new incident
+// ID, which is logged with the request URL and the stack of the panic, and
+// which panicHandler can show to the user by calling IncidentID on the context
+// of its request. If report is non-nil, the panic is also reported with it.
+//
+// Panics with http.ErrAbortHandler are not recovered from, so that net/http
+// aborts the response quietly.
+func Panic(panicHandler http.Handler, report func(errorreporting.Entry)) Middleware {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
-				if e := recover(); e != nil {
-					log.Errorf(r.Context(), "middleware.Panic: %v", e)
-					panicHandler.ServeHTTP(w, r)
+				e := recover()
+				if e == nil {
+					return
+				}
+				if e == http.ErrAbortHandler {
+					panic(e)
 				}
+				stack := debug.Stack()
+				id := newIncidentID()
+				log.Errorf(r.Context(), "middleware.Panic: incident %s: %s %s: %v\n%s", id, r.Method, r.URL, e, stack)
+				if report != nil {
+					report(errorreporting.Entry{
+						Error: fmt.Errorf("panic serving %s (incident %s): %v", r.URL, id, e),
+						Req:   r,
+						Stack: stack,
+					})
+				}
+				panicHandler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), incidentIDKey{}, id)))
 			}()
 			h.ServeHTTP(w, r)
 		})
 	}
 }
+
+// newIncidentID returns a random ID for a panic.
+func newIncidentID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
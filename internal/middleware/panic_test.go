@@ -5,11 +5,17 @@
 package middleware
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
+	stdlog "log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+
+	"cloud.google.com/go/errorreporting"
 )
 
 func TestPanic(t *testing.T) {
@@ -20,26 +26,38 @@ func TestPanic(t *testing.T) {
 		}
 		fmt.Fprint(w, "ok")
 	})
+	var incidentID string
 	panicHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		incidentID = IncidentID(r.Context())
 		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, "don't panic")
+		fmt.Fprintf(w, "don't panic: incident %s", incidentID)
 	})
-	mw := Panic(panicHandler)
+	var reports []errorreporting.Entry
+	mw := Panic(panicHandler, func(e errorreporting.Entry) { reports = append(reports, e) })
 	ts := httptest.NewServer(mw(handler))
+	defer ts.Close()
+
+	// Capture the log.
+	var logBuf bytes.Buffer
+	stdlog.SetOutput(&logBuf)
+	defer stdlog.SetOutput(os.Stderr)
 
 	tests := []struct {
 		doPanic  bool
 		wantBody string
 		wantCode int
 	}{
-		{true, "don't panic", http.StatusInternalServerError},
+		{true, "don't panic: incident ", http.StatusInternalServerError},
 		{false, "ok", http.StatusOK},
 	}
 
 	for _, test := range tests {
 		t.Run(fmt.Sprintf("doPanic=%t", test.doPanic), func(t *testing.T) {
 			doPanic = test.doPanic
-			resp, err := ts.Client().Get(ts.URL)
+			incidentID = ""
+			reports = nil
+			logBuf.Reset()
+			resp, err := ts.Client().Get(ts.URL + "/some/path")
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -51,9 +69,50 @@ func TestPanic(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			if got := string(body); got != test.wantBody {
-				t.Errorf("body=%q, want %q", got, test.wantBody)
+			if got, want := string(body), test.wantBody+incidentID; got != want {
+				t.Errorf("body=%q, want %q", got, want)
+			}
+			if !test.doPanic {
+				if len(reports) != 0 || logBuf.Len() != 0 {
+					t.Errorf("got %d reports and log %q, want none", len(reports), logBuf.String())
+				}
+				return
+			}
+			if incidentID == "" {
+				t.Fatal("no incident ID")
+			}
+			// The log has the incident ID, the URL, the panic value and the
+			// stack.
+			logged := logBuf.String()
+			for _, want := range []string{incidentID, "/some/path", "panic!", "panic_test.go"} {
+				if !strings.Contains(logged, want) {
+					t.Errorf("log %q does not contain %q", logged, want)
+				}
+			}
+			if len(reports) != 1 {
+				t.Fatalf("got %d reports, want 1", len(reports))
+			}
+			if got := reports[0].Error.Error(); !strings.Contains(got, incidentID) {
+				t.Errorf("reported error %q does not contain the incident ID", got)
+			}
+			if len(reports[0].Stack) == 0 {
+				t.Error("reported no stack")
 			}
 		})
 	}
 }
+
+func TestPanicAbortHandler(t *testing.T) {
+	panicHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("panic handler called for http.ErrAbortHandler")
+	})
+	h := Panic(panicHandler, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if e := recover(); e != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", e)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
@@ -6,19 +6,20 @@ package middleware
 
 import (
 	"context"
+	"math"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 
-	"github.com/golang/groupcache/lru"
+	"github.com/go-redis/redis/v7"
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
 	"golang.org/x/pkgsite/internal/config"
 	"golang.org/x/pkgsite/internal/log"
-	"golang.org/x/time/rate"
+	"golang.org/x/pkgsite/internal/ratelimit"
 )
 
 var (
@@ -38,18 +39,32 @@ var (
 	}
 )
 
-// Quota implements a simple IP-based rate limiter. Each set of incoming IP
-// addresses with the same low-order byte gets qps requests per second, with the
-// given burst.
-// Information is kept in an LRU cache of size maxEntries.
+// Quota implements an IP-based rate limiter. Each set of incoming IP addresses
+// with the same low-order byte gets settings.QPS requests per second, with
+// settings.Burst as the size of its token bucket.
 //
-// If a request is disallowed, a 429 (TooManyRequests) will be served.
-func Quota(settings config.QuotaSettings) Middleware {
-	var mu sync.Mutex
-	cache := lru.New(settings.MaxEntries)
+// The token buckets are kept in redis under keys that begin with name, so
+// that all instances of the server share them. If client is nil, they are
+// instead kept in an LRU cache of size settings.MaxEntries.
+//
+// Requests for static assets, requests from settings.AllowedCIDRs and requests
+// that bypass the quota with an auth value are never limited. If a request is
+// disallowed, a 429 (TooManyRequests) will be served, with a Retry-After header.
+func Quota(name string, settings config.QuotaSettings, client *redis.Client) Middleware {
+	var store ratelimit.Store
+	if client != nil {
+		store = ratelimit.NewRedisStore(client, "quota:"+name+":")
+	} else {
+		store = ratelimit.NewMemoryStore(settings.MaxEntries, nil)
+	}
+	allowed := parseCIDRs(name, settings.AllowedCIDRs)
 
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isStaticPath(r.URL.Path) {
+				h.ServeHTTP(w, r)
+				return
+			}
 			authVal := r.Header.Get(config.BypassQuotaAuthHeader)
 			for _, wantVal := range settings.AuthValues {
 				if authVal == wantVal {
@@ -60,24 +75,33 @@ func Quota(settings config.QuotaSettings) Middleware {
 				}
 			}
 
-			key := ipKey(r.Header.Get("X-Forwarded-For"))
+			ip := clientIP(r.Header.Get("X-Forwarded-For"), settings.TrustedHops)
+			for _, n := range allowed {
+				if ip != nil && n.Contains(ip) {
+					recordQuotaMetric(r.Context(), "accepted")
+					h.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			key := blockKey(ip)
 			// key is empty if we couldn't parse an IP, or there is no IP.
-			// Fail open in this case: allow serving.
-			var limiter *rate.Limiter
+			// Fail open in this case: allow serving. Also fail open if the
+			// store can't be reached.
+			blocked := false
+			var retryAfter time.Duration
 			if key != "" {
-				mu.Lock()
-				if v, ok := cache.Get(key); ok {
-					limiter = v.(*rate.Limiter)
-				} else {
-					limiter = rate.NewLimiter(rate.Limit(settings.QPS), settings.Burst)
-					cache.Add(key, limiter)
+				ok, d, err := store.Take(r.Context(), key, float64(settings.QPS), settings.Burst)
+				if err != nil {
+					log.Errorf(r.Context(), "Quota(%q): %v", name, err)
 				}
-				mu.Unlock()
+				blocked = err == nil && !ok
+				retryAfter = d
 			}
-			blocked := limiter != nil && !limiter.Allow()
 			recordQuotaMetric(r.Context(), strconv.FormatBool(blocked))
 			if blocked && settings.RecordOnly != nil && !*settings.RecordOnly {
 				const tmr = http.StatusTooManyRequests
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
 				http.Error(w, http.StatusText(tmr), tmr)
 				return
 			}
@@ -86,21 +110,75 @@ func Quota(settings config.QuotaSettings) Middleware {
 	}
 }
 
+// isStaticPath reports whether path is that of a static asset, which Quota
+// does not limit.
+func isStaticPath(path string) bool {
+	return strings.HasPrefix(path, "/static/") ||
+		strings.HasPrefix(path, "/third_party/") ||
+		path == "/favicon.ico"
+}
+
+// parseCIDRs parses the networks in cidrs, logging and skipping those that
+// are invalid.
+func parseCIDRs(name string, cidrs []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			log.Errorf(context.Background(), "Quota(%q): ignoring allowed CIDR: %v", name, err)
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
 func recordQuotaMetric(ctx context.Context, blocked string) {
 	stats.RecordWithTags(ctx, []tag.Mutator{
 		tag.Upsert(keyQuotaBlocked, blocked),
 	}, quotaResults.M(1))
 }
 
-func ipKey(s string) string {
-	fields := strings.SplitN(s, ",", 2)
-	// First field is the originating IP address.
-	origin := strings.TrimSpace(fields[0])
-	ip := net.ParseIP(origin)
+// IPKey returns the key that Quota uses to identify the block of IP addresses
+// that r originates from, or the empty string if it can't be determined.
+// trustedHops is the number of proxies in front of the server, as in
+// config.QuotaSettings.
+func IPKey(r *http.Request, trustedHops int) string {
+	return ipKey(r.Header.Get("X-Forwarded-For"), trustedHops)
+}
+
+func ipKey(s string, trustedHops int) string {
+	return blockKey(clientIP(s, trustedHops))
+}
+
+// clientIP returns the address of the client in the X-Forwarded-For header
+// value s, or nil if it can't be determined.
+//
+// Each proxy in front of the server appends the address it received the
+// request from to the header, after whatever the client sent. If trustedHops
+// is positive, only the last trustedHops addresses are trusted, and the client
+// is the first of them; addresses before it may have been made up by the
+// client. If the header has fewer addresses, all of them were added by trusted
+// proxies, and the first is used. If trustedHops is zero, the whole header is
+// trusted, and the first address is used.
+func clientIP(s string, trustedHops int) net.IP {
+	fields := strings.Split(s, ",")
+	i := 0
+	if trustedHops > 0 && len(fields) > trustedHops {
+		i = len(fields) - trustedHops
+	}
+	return net.ParseIP(strings.TrimSpace(fields[i]))
+}
+
+// blockKey returns the key of the block of IP addresses that ip belongs to, or
+// the empty string if ip is nil.
+func blockKey(ip net.IP) string {
 	if ip == nil {
 		return ""
 	}
-	// Zero out last byte, to cover ranges.
+	// Zero out last byte, to cover ranges. Copy ip first, so as not to
+	// modify it.
+	ip = append(net.IP(nil), ip...)
 	ip[len(ip)-1] = 0
 	return ip.String()
 }
@@ -5,19 +5,24 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
 	"github.com/google/go-cmp/cmp"
 	"go.opencensus.io/stats/view"
 	"golang.org/x/pkgsite/internal/config"
 )
 
 func TestQuota(t *testing.T) {
-	mw := Quota(config.QuotaSettings{QPS: 1, Burst: 2, MaxEntries: 1, RecordOnly: boolptr(false)})
+	mw := Quota("test", config.QuotaSettings{QPS: 1, Burst: 2, MaxEntries: 1, RecordOnly: boolptr(false)}, nil)
 	var npass int
 	h := func(w http.ResponseWriter, r *http.Request) {
 		npass++
@@ -72,7 +77,7 @@ func TestQuota(t *testing.T) {
 
 func TestQuotaRecordOnly(t *testing.T) {
 	// Like TestQuota, but with in RecordOnly mode nothing is actually blocked.
-	mw := Quota(config.QuotaSettings{QPS: 1, Burst: 2, MaxEntries: 1, RecordOnly: boolptr(true)})
+	mw := Quota("test", config.QuotaSettings{QPS: 1, Burst: 2, MaxEntries: 1, RecordOnly: boolptr(true)}, nil)
 	npass := 0
 	h := func(w http.ResponseWriter, r *http.Request) {
 		npass++
@@ -108,7 +113,7 @@ func TestQuotaRecordOnly(t *testing.T) {
 
 func TestQuotaBadKey(t *testing.T) {
 	// Verify that invalid IP addresses are not blocked.
-	mw := Quota(config.QuotaSettings{QPS: 1, Burst: 2, MaxEntries: 1, RecordOnly: boolptr(true)})
+	mw := Quota("test", config.QuotaSettings{QPS: 1, Burst: 2, MaxEntries: 1, RecordOnly: boolptr(true)}, nil)
 	npass := 0
 	h := func(w http.ResponseWriter, r *http.Request) {
 		npass++
@@ -142,6 +147,159 @@ func TestQuotaBadKey(t *testing.T) {
 	}
 }
 
+func TestQuotaRedis(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer c.Close()
+
+	// Two instances sharing redis share the buckets.
+	settings := config.QuotaSettings{QPS: 1, Burst: 2, RecordOnly: boolptr(false)}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handlers := []http.Handler{
+		Quota("test", settings, c)(h),
+		Quota("test", settings, c)(h),
+	}
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Forwarded-For", "1.2.3.4")
+		w := httptest.NewRecorder()
+		handlers[i%2].ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("#%d: got %d, want %d", i, w.Code, want)
+		}
+		if want == http.StatusTooManyRequests {
+			if got := w.Header().Get("Retry-After"); got != "1" {
+				t.Errorf("#%d: got Retry-After %q, want 1", i, got)
+			}
+		}
+	}
+	// A different quota has its own buckets.
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	w := httptest.NewRecorder()
+	Quota("other", settings, c)(h).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("other quota: got %d, want 200", w.Code)
+	}
+}
+
+func TestQuotaConcurrent(t *testing.T) {
+	const burst = 10
+	settings := config.QuotaSettings{QPS: 1, Burst: burst, MaxEntries: 10, RecordOnly: boolptr(false)}
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer c.Close()
+
+	for _, test := range []struct {
+		name   string
+		client *redis.Client
+	}{
+		{"memory", nil},
+		{"redis", c},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var npass int32
+			mw := Quota("concurrent", settings, test.client)
+			h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&npass, 1)
+			}))
+			var wg sync.WaitGroup
+			for i := 0; i < 5*burst; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					req := httptest.NewRequest("GET", "/", nil)
+					req.Header.Set("X-Forwarded-For", "1.2.3.4")
+					h.ServeHTTP(httptest.NewRecorder(), req)
+				}()
+			}
+			wg.Wait()
+			// A token may have been added while the requests were served.
+			if got := atomic.LoadInt32(&npass); got < burst || got > burst+1 {
+				t.Errorf("%d requests passed, want %d", got, burst)
+			}
+		})
+	}
+}
+
+func TestQuotaSpoofing(t *testing.T) {
+	// One proxy in front of the server appends the address of the client.
+	mw := Quota("test", config.QuotaSettings{QPS: 1, Burst: 2, MaxEntries: 10, RecordOnly: boolptr(false), TrustedHops: 1}, nil)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func(xff string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Forwarded-For", xff)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The client makes up a different address for each request, but they are
+	// all counted against the address the proxy saw.
+	for i := 0; i < 5; i++ {
+		want := http.StatusOK
+		if i >= 2 {
+			want = http.StatusTooManyRequests
+		}
+		xff := fmt.Sprintf("10.0.%d.1, 1.2.3.4", i)
+		if got := get(xff); got != want {
+			t.Errorf("%q: got %d, want %d", xff, got, want)
+		}
+	}
+	// Another client is not affected.
+	if got := get("1.2.3.4, 5.6.7.8"); got != http.StatusOK {
+		t.Errorf("other client: got %d, want 200", got)
+	}
+}
+
+func TestQuotaExempt(t *testing.T) {
+	mw := Quota("test", config.QuotaSettings{
+		QPS:          1,
+		Burst:        1,
+		MaxEntries:   10,
+		RecordOnly:   boolptr(false),
+		AllowedCIDRs: []string{"10.1.0.0/16", "bad"},
+		TrustedHops:  1,
+	}, nil)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, test := range []struct {
+		name, path, xff string
+	}{
+		{"static", "/static/css/stylesheet.css", "1.2.3.4"},
+		{"third_party", "/third_party/dialog-polyfill/dialog-polyfill.js", "1.2.3.4"},
+		{"allowed", "/", "10.1.2.3"},
+		// Only the address added by the proxy counts.
+		{"spoofed allowed", "/", "10.1.2.3, 1.2.3.4"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var codes []int
+			for i := 0; i < 3; i++ {
+				req := httptest.NewRequest("GET", test.path, nil)
+				req.Header.Set("X-Forwarded-For", test.xff)
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+				codes = append(codes, w.Code)
+			}
+			want := []int{200, 200, 200}
+			if test.name == "spoofed allowed" {
+				// Static assets did not use the only token of 1.2.3.4.
+				want = []int{200, 429, 429}
+			}
+			if diff := cmp.Diff(want, codes); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func collectViewData(t *testing.T) map[bool]int {
 	m := map[bool]int{}
 	rows, err := view.RetrieveData(QuotaResultCount.Name)
@@ -160,19 +318,48 @@ func collectViewData(t *testing.T) map[bool]int {
 }
 
 func TestIPKey(t *testing.T) {
+	for _, test := range []struct {
+		in          string
+		trustedHops int
+		want        interface{}
+	}{
+		{"", 0, ""},
+		{"1.2.3", 0, ""},
+		{"128.197.17.3", 0, "128.197.17.0"},
+		{"  128.197.17.3, foo  ", 0, "128.197.17.0"},
+		{"2001:db8::ff00:42:8329", 0, "2001:db8::ff00:42:8300"},
+		// With one trusted proxy, the spoofed leading hop is ignored.
+		{"10.0.0.1, 128.197.17.3", 1, "128.197.17.0"},
+		{"10.0.0.1, 128.197.17.3, 35.1.2.3", 2, "128.197.17.0"},
+		{"128.197.17.3", 1, "128.197.17.0"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Forwarded-For", test.in)
+		got := IPKey(r, test.trustedHops)
+		if got != test.want {
+			t.Errorf("%q, %d trusted hops: got %v, want %v", test.in, test.trustedHops, got, test.want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
 	for _, test := range []struct {
 		in   string
-		want interface{}
+		hops int
+		want string
 	}{
-		{"", ""},
-		{"1.2.3", ""},
-		{"128.197.17.3", "128.197.17.0"},
-		{"  128.197.17.3, foo  ", "128.197.17.0"},
-		{"2001:db8::ff00:42:8329", "2001:db8::ff00:42:8300"},
+		{"", 0, "<nil>"},
+		{"1.2.3.4", 0, "1.2.3.4"},
+		{"1.2.3.4, 5.6.7.8", 0, "1.2.3.4"},
+		{"1.2.3.4, 5.6.7.8", 1, "5.6.7.8"},
+		{"1.2.3.4, 5.6.7.8, 9.10.11.12", 2, "5.6.7.8"},
+		{"5.6.7.8, 9.10.11.12", 2, "5.6.7.8"},
+		{"9.10.11.12", 2, "9.10.11.12"},
+		{"1.2.3.4, junk", 1, "<nil>"},
 	} {
-		got := ipKey(test.in)
+		got := clientIP(test.in, test.hops).String()
 		if got != test.want {
-			t.Errorf("%q: got %v, want %v", test.in, got, test.want)
+			t.Errorf("clientIP(%q, %d) = %s, want %s", test.in, test.hops, got, test.want)
 		}
 	}
 }
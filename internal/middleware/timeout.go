@@ -13,11 +13,34 @@ import (
 // Timeout returns a new Middleware that times out each request after the given
 // duration.
 func Timeout(d time.Duration) Middleware {
+	return Timeouts(func(*http.Request) time.Duration { return d })
+}
+
+// Timeouts returns a new Middleware that times out each request after the
+// duration that budget returns for it. When the request times out, its
+// context is canceled, so that the work done for it stops; the handler is
+// responsible for the response it then writes.
+func Timeouts(budget func(*http.Request) time.Duration) Middleware {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx, cancel := context.WithTimeout(r.Context(), d)
+			ctx, cancel := context.WithTimeout(r.Context(), budget(r))
 			defer cancel()
 			h.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// SoftDeadline returns a context that is done margin before the deadline of
+// ctx, leaving the caller that much time to make do with what it has, such as
+// by serving partial results. If ctx has no deadline, the returned context is
+// only done when ctx is, or when cancel is called.
+//
+// The caller can tell that the soft deadline passed, rather than the deadline
+// of ctx, if the returned context has expired but ctx has not.
+func SoftDeadline(ctx context.Context, margin time.Duration) (_ context.Context, cancel context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline.Add(-margin))
+}
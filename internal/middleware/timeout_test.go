@@ -5,6 +5,7 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -67,3 +68,53 @@ func TestTimeout(t *testing.T) {
 		})
 	}
 }
+
+func TestTimeouts(t *testing.T) {
+	budget := func(r *http.Request) time.Duration {
+		if r.URL.Path == "/slow" {
+			return time.Minute
+		}
+		return time.Second
+	}
+	var got time.Duration
+	h := Timeouts(budget)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok := r.Context().Deadline()
+		if !ok {
+			t.Fatal("request has no deadline")
+		}
+		got = time.Until(deadline)
+	}))
+	for _, test := range []struct {
+		path string
+		want time.Duration
+	}{
+		{"/slow", time.Minute},
+		{"/fast", time.Second},
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", test.path, nil))
+		if got > test.want || got < test.want-100*time.Millisecond {
+			t.Errorf("%s: got deadline in %s, want %s", test.path, got, test.want)
+		}
+	}
+}
+
+func TestSoftDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	sctx, scancel := SoftDeadline(ctx, 10*time.Second)
+	defer scancel()
+	deadline, _ := ctx.Deadline()
+	if got, _ := sctx.Deadline(); !got.Equal(deadline.Add(-10 * time.Second)) {
+		t.Errorf("got soft deadline %s before the deadline, want 10s", deadline.Sub(got))
+	}
+
+	// Without a deadline, the soft deadline never passes.
+	sctx, scancel = SoftDeadline(context.Background(), time.Second)
+	if _, ok := sctx.Deadline(); ok {
+		t.Error("got a soft deadline for a context without a deadline")
+	}
+	scancel()
+	if sctx.Err() != context.Canceled {
+		t.Errorf("got %v after cancel, want %v", sctx.Err(), context.Canceled)
+	}
+}
@@ -9,6 +9,7 @@ package internal
 
 import (
 	"github.com/google/safehtml"
+	"golang.org/x/pkgsite/internal/licenses"
 )
 
 func (m *LegacyModuleInfo) RemoveNonRedistributableData() {
@@ -35,6 +36,16 @@ func (u *Unit) RemoveNonRedistributableData() {
 	if !u.IsRedistributable {
 		u.Readme = nil
 		u.Documentation = nil
+		// The license files themselves are kept so their paths and types can
+		// be shown, but not their contents. Copy them, because they may be
+		// shared with other units of the module.
+		var lics []*licenses.License
+		for _, l := range u.LicenseContents {
+			lic := *l
+			lic.Contents = nil
+			lics = append(lics, &lic)
+		}
+		u.LicenseContents = lics
 	}
 }
 
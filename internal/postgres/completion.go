@@ -0,0 +1,55 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"golang.org/x/pkgsite/internal/complete"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// GetPathCompletions returns at most limit packages in search_documents whose
+// paths begin with prefix, ignoring case, ordered by the number of packages
+// that import them. Only paths and the number of importers are returned.
+//
+// It is a single query on an index of the lower-case paths, with no full-text
+// search, so that it can be run as the user types.
+func (db *DB) GetPathCompletions(ctx context.Context, prefix string, limit int) (_ []*complete.Completion, err error) {
+	defer derrors.Wrap(&err, "GetPathCompletions(ctx, %q, %d)", prefix, limit)
+
+	query := `
+		SELECT package_path, module_path, version, imported_by_count
+		FROM search_documents
+		WHERE lower(package_path) LIKE $1
+		ORDER BY imported_by_count DESC, package_path
+		LIMIT $2`
+	var completions []*complete.Completion
+	collect := func(rows *sql.Rows) error {
+		var c complete.Completion
+		if err := rows.Scan(&c.PackagePath, &c.ModulePath, &c.Version, &c.Importers); err != nil {
+			return err
+		}
+		c.Suffix = c.PackagePath
+		completions = append(completions, &c)
+		return nil
+	}
+	pattern := escapeLikePattern(strings.ToLower(prefix)) + "%"
+	if err := db.db.RunQuery(ctx, query, collect, pattern, limit); err != nil {
+		return nil, err
+	}
+	return completions, nil
+}
+
+// likeEscaper escapes the characters that are special to LIKE.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLikePattern returns s with the characters that are special to LIKE
+// escaped, so that the pattern matches only s.
+func escapeLikePattern(s string) string {
+	return likeEscaper.Replace(s)
+}
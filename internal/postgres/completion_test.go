@@ -0,0 +1,63 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal/testing/sample"
+)
+
+func TestGetPathCompletions(t *testing.T) {
+	defer ResetTestDB(testDB, t)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	for _, m := range []struct {
+		path     string
+		suffixes []string
+	}{
+		{"github.com/Foo/bar", []string{"a", "b"}},
+		{"github.com/foo_bar/baz", []string{"c"}},
+		{"gitlab.com/foo/bar", []string{"d"}},
+	} {
+		if err := testDB.InsertModule(ctx, sample.Module(m.path, sample.VersionString, m.suffixes...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := testDB.db.Exec(ctx, `
+		UPDATE search_documents SET imported_by_count = 5
+		WHERE package_path = 'github.com/Foo/bar/b'`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		prefix string
+		limit  int
+		want   []string
+	}{
+		// More popular packages come first, and case is ignored.
+		{"github.com/foo", 10, []string{"github.com/Foo/bar/b", "github.com/Foo/bar/a", "github.com/foo_bar/baz/c"}},
+		{"github.com/foo", 1, []string{"github.com/Foo/bar/b"}},
+		// The "_" is not a wildcard.
+		{"github.com/foo_", 10, []string{"github.com/foo_bar/baz/c"}},
+		{"git%", 10, nil},
+		{"bar", 10, nil},
+	} {
+		completions, err := testDB.GetPathCompletions(ctx, test.prefix, test.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, c := range completions {
+			got = append(got, c.PackagePath)
+		}
+		if !cmp.Equal(got, test.want) {
+			t.Errorf("GetPathCompletions(%q, %d) = %v, want %v", test.prefix, test.limit, got, test.want)
+		}
+	}
+}
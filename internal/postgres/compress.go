@@ -0,0 +1,192 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// Documentation HTML and source can be stored compressed. A compressed blob
+// starts with blobMagic followed by the ID of the codec that compressed it,
+// so that it can be read whatever codec is configured for writing, and so
+// that blobs written before compression was added, which never start with
+// blobMagic, are read unchanged.
+var blobMagic = []byte("\xffpkgsite-blob:")
+
+// A codec compresses documentation blobs.
+type codec struct {
+	name       string
+	id         byte
+	compress   func([]byte) ([]byte, error)
+	decompress func([]byte) ([]byte, error)
+}
+
+// codecs are the codecs that SetDocumentationCodec accepts, by name. The ID
+// of a codec must never change, or blobs that it wrote can no longer be read.
+var codecs = map[string]*codec{
+	"gzip": {
+		name:       "gzip",
+		id:         'g',
+		compress:   gzipCompress,
+		decompress: gzipDecompress,
+	},
+}
+
+// CodecNone is the name of the codec that stores blobs uncompressed.
+const CodecNone = "none"
+
+// SetDocumentationCodec sets the codec with which db compresses the
+// documentation HTML and source that it writes: "gzip", or CodecNone or the
+// empty string to store them uncompressed. Rows are compressed the next time
+// they are written. Documentation written with any codec can be read
+// regardless of the codec that is set.
+func (db *DB) SetDocumentationCodec(name string) (err error) {
+	defer derrors.Wrap(&err, "SetDocumentationCodec(%q)", name)
+
+	if name == "" || name == CodecNone {
+		db.docCodec = nil
+		return nil
+	}
+	c, ok := codecs[name]
+	if !ok {
+		var names []string
+		for n := range codecs {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown codec; want %s or one of %q: %w", CodecNone, names, derrors.InvalidArgument)
+	}
+	db.docCodec = c
+	return nil
+}
+
+// compressBlob compresses b with c, and prefixes the result with blobMagic
+// and the ID of c. If c is nil, compressBlob returns b unchanged.
+func compressBlob(c *codec, b []byte) ([]byte, error) {
+	if c == nil {
+		return b, nil
+	}
+	z, err := c.compress(b)
+	if err != nil {
+		return nil, fmt.Errorf("compressing with %s: %v", c.name, err)
+	}
+	prefix := append(append([]byte(nil), blobMagic...), c.id)
+	return append(prefix, z...), nil
+}
+
+// decompressBlob is the inverse of compressBlob. Blobs that do not start with
+// blobMagic are returned unchanged.
+func decompressBlob(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, blobMagic) {
+		return b, nil
+	}
+	b = b[len(blobMagic):]
+	if len(b) == 0 {
+		return nil, fmt.Errorf("compressed blob has no codec ID: %w", derrors.InvalidArgument)
+	}
+	for _, c := range codecs {
+		if c.id == b[0] {
+			d, err := c.decompress(b[1:])
+			if err != nil {
+				return nil, fmt.Errorf("decompressing with %s: %v", c.name, err)
+			}
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown codec ID %q: %w", b[0], derrors.InvalidArgument)
+}
+
+func gzipCompress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gzipDecompress(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// encodeDocumentation returns the values of the html, compressed_html, zip
+// and api columns of the documentation table for doc. If c is nil, the HTML
+// is stored in the html column and compressedHTML is nil, for NULL;
+// otherwise html is empty, and compressedHTML holds the compressed HTML. The
+// source and the API are compressed with c, if they are not empty.
+func encodeDocumentation(doc *internal.Documentation, c *codec) (html string, compressedHTML interface{}, source, api []byte, err error) {
+	defer derrors.Wrap(&err, "encodeDocumentation(%q, %q)", doc.GOOS, doc.GOARCH)
+
+	html = makeValidUnicode(doc.HTML.String())
+	source = doc.Source
+	api = doc.API
+	if c == nil {
+		return html, nil, source, api, nil
+	}
+	compressedHTML, err = compressBlob(c, []byte(html))
+	if err != nil {
+		return "", nil, nil, nil, err
+	}
+	if len(source) > 0 {
+		source, err = compressBlob(c, source)
+		if err != nil {
+			return "", nil, nil, nil, err
+		}
+	}
+	if len(api) > 0 {
+		api, err = compressBlob(c, api)
+		if err != nil {
+			return "", nil, nil, nil, err
+		}
+	}
+	return "", compressedHTML, source, api, nil
+}
+
+// decodeDocumentation is the inverse of encodeDocumentation. It sets the HTML
+// and, if they are not nil, the Source and API of doc from the values of the
+// html, compressed_html, zip and api columns of the documentation table.
+func decodeDocumentation(doc *internal.Documentation, html string, compressedHTML, source, api []byte) (err error) {
+	defer derrors.Wrap(&err, "decodeDocumentation(%q, %q)", doc.GOOS, doc.GOARCH)
+
+	if len(compressedHTML) > 0 {
+		b, err := decompressBlob(compressedHTML)
+		if err != nil {
+			return err
+		}
+		html = string(b)
+	}
+	doc.HTML = convertDocumentation(html)
+	if source != nil {
+		doc.Source, err = decompressBlob(source)
+		if err != nil {
+			return err
+		}
+	}
+	if api != nil {
+		doc.API, err = decompressBlob(api)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/template"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/testing/sample"
+)
+
+// sampleDocumentationHTML returns documentation HTML for a package with many
+// declarations, like the documentation that dochtml renders.
+func sampleDocumentationHTML(t *testing.T) safehtml.HTML {
+	t.Helper()
+	tmpl := template.Must(template.New("doc").Parse(`
+<section class="Documentation-index">
+{{range .}}<li><a href="#{{.ID}}">func {{.Name}}(ctx context.Context, s string) (int, error)</a></li>
+{{end}}</section>
+<section class="Documentation-functions">
+{{range .}}<div class="Documentation-declaration">
+  <h3 id="{{.ID}}" data-kind="function">func <a class="Documentation-source" href="https://github.com/valid/module_name/blob/v1.0.0/foo.go#L10">{{.Name}}</a></h3>
+  <pre>func {{.Name}}(ctx <a href="/context?tab=doc#Context">context.Context</a>, s <a href="/builtin?tab=doc#string">string</a>) (<a href="/builtin?tab=doc#int">int</a>, <a href="/builtin?tab=doc#error">error</a>)</pre>
+  <p>{{.Name}} returns the number of things in s, and an error if there are none &lt;or&gt; "too many".</p>
+</div>
+{{end}}</section>`))
+	type decl struct {
+		Name string
+		ID   safehtml.Identifier
+	}
+	var decls []decl
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("Func%d", i)
+		decls = append(decls, decl{name, safehtml.IdentifierFromConstantPrefix("Func", fmt.Sprint(i))})
+	}
+	h, err := tmpl.ExecuteToHTML(decls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestEncodeDocumentation(t *testing.T) {
+	want := &internal.Documentation{
+		GOOS:   sample.GOOS,
+		GOARCH: sample.GOARCH,
+		HTML:   sampleDocumentationHTML(t),
+		Source: bytes.Repeat([]byte("package p\n\nfunc F() {}\n"), 100),
+		API:    []byte(`{"Symbols":[` + strings.Repeat(`{"Name":"F","Kind":"function","Signature":"func F()"},`, 100) + `{}]}`),
+	}
+	for _, name := range []string{CodecNone, "gzip"} {
+		t.Run(name, func(t *testing.T) {
+			db := &DB{}
+			if err := db.SetDocumentationCodec(name); err != nil {
+				t.Fatal(err)
+			}
+			html, compressedHTML, source, api, err := encodeDocumentation(want, db.docCodec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ch []byte
+			if compressedHTML != nil {
+				ch = compressedHTML.([]byte)
+			}
+			if name == CodecNone {
+				if html != want.HTML.String() || ch != nil || !bytes.Equal(source, want.Source) || !bytes.Equal(api, want.API) {
+					t.Fatalf("got HTML of length %d, compressed HTML %v; want documentation unchanged", len(html), ch)
+				}
+			} else {
+				if html != "" {
+					t.Errorf("got HTML of length %d, want empty", len(html))
+				}
+				if got, max := len(ch), len(want.HTML.String())/5; got > max {
+					t.Errorf("got compressed HTML of length %d, want at most %d", got, max)
+				}
+				if got, max := len(source), len(want.Source)/5; got > max {
+					t.Errorf("got compressed source of length %d, want at most %d", got, max)
+				}
+				if got, max := len(api), len(want.API)/5; got > max {
+					t.Errorf("got compressed API of length %d, want at most %d", got, max)
+				}
+			}
+
+			got := &internal.Documentation{GOOS: want.GOOS, GOARCH: want.GOARCH}
+			if err := decodeDocumentation(got, html, ch, source, api); err != nil {
+				t.Fatal(err)
+			}
+			if got.HTML.String() != convertDocumentation(want.HTML.String()).String() {
+				t.Errorf("HTML did not round-trip:\ngot  %s\nwant %s", got.HTML, want.HTML)
+			}
+			if !bytes.Equal(got.Source, want.Source) {
+				t.Error("source did not round-trip")
+			}
+			if !bytes.Equal(got.API, want.API) {
+				t.Error("API did not round-trip")
+			}
+		})
+	}
+}
+
+func TestDecompressBlob(t *testing.T) {
+	// Blobs written before compression was added are read unchanged.
+	for _, b := range [][]byte{nil, []byte("PK\x03\x04zip"), []byte("<p>doc</p>")} {
+		got, err := decompressBlob(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, b) {
+			t.Errorf("decompressBlob(%q) = %q, want it unchanged", b, got)
+		}
+	}
+
+	for _, b := range [][]byte{
+		blobMagic,
+		append(append([]byte(nil), blobMagic...), '?'),
+	} {
+		if _, err := decompressBlob(b); !errors.Is(err, derrors.InvalidArgument) {
+			t.Errorf("decompressBlob(%q): got error %v, want %v", b, err, derrors.InvalidArgument)
+		}
+	}
+}
+
+func TestSetDocumentationCodec(t *testing.T) {
+	db := &DB{}
+	for _, name := range []string{"", CodecNone, "gzip"} {
+		if err := db.SetDocumentationCodec(name); err != nil {
+			t.Errorf("SetDocumentationCodec(%q): %v", name, err)
+		}
+	}
+	if err := db.SetDocumentationCodec("lz4"); !errors.Is(err, derrors.InvalidArgument) {
+		t.Errorf("SetDocumentationCodec(%q): got error %v, want %v", "lz4", err, derrors.InvalidArgument)
+	}
+}
+
+func TestInsertCompressedDocumentation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer ResetTestDB(testDB, t)
+	defer testDB.SetDocumentationCodec(CodecNone)
+
+	m := sample.Module(sample.ModulePath, sample.VersionString, sample.Suffix)
+	doc := m.Units[1].Documentation[0]
+	doc.HTML = sampleDocumentationHTML(t)
+	doc.Source = []byte("PK\x03\x04zip")
+	doc.API = []byte(`{"Symbols":[{"Name":"F","Kind":"function","Signature":"func F()"}]}`)
+	um := sample.UnitMeta(m.Units[1].Path, m.ModulePath, m.Version, m.Units[1].Name, true)
+
+	for _, name := range []string{"gzip", CodecNone} {
+		if err := testDB.SetDocumentationCodec(name); err != nil {
+			t.Fatal(err)
+		}
+		if err := testDB.InsertModule(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+		u, err := testDB.GetUnit(ctx, um, internal.WithDocumentation|internal.WithDocumentationSource|internal.WithDocumentationAPI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := u.Documentation[0]
+		if got.HTML.String() != convertDocumentation(doc.HTML.String()).String() || !bytes.Equal(got.Source, doc.Source) ||
+			!bytes.Equal(got.API, doc.API) {
+			t.Errorf("%s: documentation did not round-trip", name)
+		}
+
+		var (
+			html           string
+			compressedHTML []byte
+		)
+		if err := testDB.db.QueryRow(ctx, `
+			SELECT d.html, d.compressed_html
+			FROM documentation d
+			INNER JOIN paths p ON p.id = d.path_id
+			WHERE p.path = $1`, um.Path).Scan(&html, &compressedHTML); err != nil {
+			t.Fatal(err)
+		}
+		if compressed := compressedHTML != nil; compressed != (name != CodecNone) || (html == "") != compressed {
+			t.Errorf("%s: got html of length %d and compressed_html of length %d", name, len(html), len(compressedHTML))
+		}
+	}
+}
@@ -40,6 +40,7 @@ func (db *DB) GetNestedModules(ctx context.Context, modulePath string) (_ []*int
 			m.module_path LIKE $1 || '/%'
 		ORDER BY
 			m.series_path,
+			m.retracted,
 			m.incompatible,
 			m.version_type = 'release' DESC,
 			m.sort_version DESC;
@@ -154,16 +155,77 @@ func (db *DB) LegacyGetImports(ctx context.Context, pkgPath, modulePath, version
 	return imports, nil
 }
 
-// GetImportedBy fetches and returns all of the packages that import the
-// package with path.
-// The returned error may be checked with derrors.IsInvalidArgument to
-// determine if it resulted from an invalid package path or version.
+// An ImportedPackage describes the package that an import path refers to.
+type ImportedPackage struct {
+	Path              string
+	ModulePath        string // of the latest version of a module with the package
+	Version           string
+	IsRedistributable bool
+}
+
+// GetImportedPackages returns the ImportedPackage for each of paths that is
+// a package in some module version, keyed by path. Paths that are not the
+// path of a known package are not in the map. The package of a path is
+// chosen from the latest module version that has one, in the same way as
+// GetUnitMeta.
+func (db *DB) GetImportedPackages(ctx context.Context, paths []string) (_ map[string]*ImportedPackage, err error) {
+	defer derrors.Wrap(&err, "DB.GetImportedPackages(ctx, %d paths)", len(paths))
+
+	query := `
+		SELECT DISTINCT ON (p.path)
+			p.path,
+			m.module_path,
+			m.version,
+			p.redistributable
+		FROM paths p
+		INNER JOIN modules m ON (p.module_id = m.id)
+		WHERE p.path = ANY($1)
+		AND p.name != ''
+		ORDER BY
+			p.path,
+			-- The same order as orderByLatest.
+			m.retracted,
+			m.incompatible,
+			m.version_type = 'release' DESC,
+			m.sort_version DESC,
+			m.module_path DESC`
+	pkgs := map[string]*ImportedPackage{}
+	collect := func(rows *sql.Rows) error {
+		var p ImportedPackage
+		if err := rows.Scan(&p.Path, &p.ModulePath, &p.Version, &p.IsRedistributable); err != nil {
+			return err
+		}
+		if db.bypassLicenseCheck {
+			p.IsRedistributable = true
+		}
+		pkgs[p.Path] = &p
+		return nil
+	}
+	if err := db.db.RunQuery(ctx, query, collect, pq.Array(paths)); err != nil {
+		return nil, err
+	}
+	return pkgs, nil
+}
+
+// GetImportedBy returns the paths of up to limit packages that import the
+// package with pkgPath, excluding the packages of the module with modulePath,
+// in path order. It returns the first page of paths if cursor is empty, and
+// otherwise the paths that follow cursor, which is the nextCursor returned
+// for the previous page. The returned nextCursor is empty if there are no
+// more paths.
+//
+// Since cursor is the last path of the previous page, a page is read from
+// the index of imports_unique however deep it is.
 //
-// Instead of supporting pagination, this query runs with a limit.
-func (db *DB) GetImportedBy(ctx context.Context, pkgPath, modulePath string, limit int) (paths []string, err error) {
-	defer derrors.Wrap(&err, "GetImportedBy(ctx, %q, %q)", pkgPath, modulePath)
+// The returned error may be checked with derrors.IsInvalidArgument to
+// determine if it resulted from an invalid package path or limit.
+func (db *DB) GetImportedBy(ctx context.Context, pkgPath, modulePath, cursor string, limit int) (paths []string, nextCursor string, err error) {
+	defer derrors.Wrap(&err, "GetImportedBy(ctx, %q, %q, %q, %d)", pkgPath, modulePath, cursor, limit)
 	if pkgPath == "" {
-		return nil, fmt.Errorf("pkgPath cannot be empty: %w", derrors.InvalidArgument)
+		return nil, "", fmt.Errorf("pkgPath cannot be empty: %w", derrors.InvalidArgument)
+	}
+	if limit <= 0 {
+		return nil, "", fmt.Errorf("limit must be positive: %w", derrors.InvalidArgument)
 	}
 	query := `
 		SELECT
@@ -174,23 +236,52 @@ func (db *DB) GetImportedBy(ctx context.Context, pkgPath, modulePath string, lim
 			to_path = $1
 		AND
 			from_module_path <> $2
+		AND
+			from_path > $3
 		ORDER BY
 			from_path
-		LIMIT $3`
+		LIMIT $4`
 
-	var importedby []string
 	collect := func(rows *sql.Rows) error {
 		var fromPath string
 		if err := rows.Scan(&fromPath); err != nil {
 			return fmt.Errorf("row.Scan(): %v", err)
 		}
-		importedby = append(importedby, fromPath)
+		paths = append(paths, fromPath)
 		return nil
 	}
-	if err := db.db.RunQuery(ctx, query, collect, pkgPath, modulePath, limit); err != nil {
-		return nil, err
+	// Read one more path than requested, to learn whether there is another
+	// page.
+	if err := db.db.RunQuery(ctx, query, collect, pkgPath, modulePath, cursor, limit+1); err != nil {
+		return nil, "", err
+	}
+	if len(paths) > limit {
+		paths = paths[:limit]
+		nextCursor = paths[limit-1]
+	}
+	return paths, nextCursor, nil
+}
+
+// GetImportedByCount returns the number of packages that import the package
+// with pkgPath, as last computed by UpdateSearchDocumentsImportedByCount. It
+// returns an error wrapping derrors.NotFound if the package has no search
+// document.
+func (db *DB) GetImportedByCount(ctx context.Context, pkgPath string) (_ int, err error) {
+	defer derrors.Wrap(&err, "GetImportedByCount(ctx, %q)", pkgPath)
+
+	var n int
+	err = db.db.QueryRow(ctx, `
+		SELECT imported_by_count
+		FROM search_documents
+		WHERE package_path = $1`, pkgPath).Scan(&n)
+	switch err {
+	case sql.ErrNoRows:
+		return 0, derrors.NotFound
+	case nil:
+		return n, nil
+	default:
+		return 0, err
 	}
-	return importedby, nil
 }
 
 // GetModuleInfo fetches a module version from the database with the primary key
@@ -300,13 +300,36 @@ func TestPostgres_GetImportsAndImportedBy(t *testing.T) {
 				testGetImports(ctx, t, tc.path, tc.modulePath, tc.version, tc.wantImports)
 			})
 
-			gotImportedBy, err := testDB.GetImportedBy(ctx, tc.path, tc.modulePath, 100)
+			gotImportedBy, nextCursor, err := testDB.GetImportedBy(ctx, tc.path, tc.modulePath, "", 100)
 			if err != nil {
 				t.Fatal(err)
 			}
 			if diff := cmp.Diff(tc.wantImportedBy, gotImportedBy); diff != "" {
 				t.Errorf("testDB.GetImportedBy(%q, %q) mismatch (-want +got):\n%s", tc.path, tc.modulePath, diff)
 			}
+			if nextCursor != "" {
+				t.Errorf("testDB.GetImportedBy(%q, %q): nextCursor = %q, want empty", tc.path, tc.modulePath, nextCursor)
+			}
+
+			// Page through the importers one at a time.
+			var (
+				paged  []string
+				cursor string
+			)
+			for {
+				page, next, err := testDB.GetImportedBy(ctx, tc.path, tc.modulePath, cursor, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				paged = append(paged, page...)
+				if next == "" {
+					break
+				}
+				cursor = next
+			}
+			if diff := cmp.Diff(tc.wantImportedBy, paged); diff != "" {
+				t.Errorf("testDB.GetImportedBy(%q, %q) paged by 1 mismatch (-want +got):\n%s", tc.path, tc.modulePath, diff)
+			}
 		})
 	}
 }
@@ -325,6 +348,35 @@ func testGetImports(ctx context.Context, t *testing.T, path, modulePath, version
 	}
 }
 
+func TestGetImportedPackages(t *testing.T) {
+	defer ResetTestDB(testDB, t)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	// The package b.com/m/sub/p moved from module b.com/m to the module
+	// b.com/m/sub in a later version.
+	for _, m := range []*internal.Module{
+		sample.Module("a.com/m", "v1.0.0", "p"),
+		sample.Module("b.com/m", "v1.0.0", "sub/p"),
+		sample.Module("b.com/m/sub", "v1.1.0", "p"),
+	} {
+		if err := testDB.InsertModule(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := testDB.GetImportedPackages(ctx, []string{"a.com/m/p", "b.com/m/sub/p", "a.com/m", "c.com/m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*ImportedPackage{
+		"a.com/m/p":     {Path: "a.com/m/p", ModulePath: "a.com/m", Version: "v1.0.0", IsRedistributable: true},
+		"b.com/m/sub/p": {Path: "b.com/m/sub/p", ModulePath: "b.com/m/sub", Version: "v1.1.0", IsRedistributable: true},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+}
+
 func TestGetPackagesInVersion(t *testing.T) {
 	testVersion := sample.Module("test.module", "v1.2.3", "", "foo")
 
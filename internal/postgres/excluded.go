@@ -7,6 +7,9 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"path"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -15,7 +18,25 @@ import (
 	"golang.org/x/pkgsite/internal/log"
 )
 
+// An ExcludedPrefix is a row of the excluded_prefixes table.
+type ExcludedPrefix struct {
+	// Prefix is a literal path prefix, or a pattern if it contains any of the
+	// characters *?[\. See IsExcluded for how each is matched.
+	Prefix    string
+	CreatedBy string
+	Reason    string
+	CreatedAt time.Time
+}
+
 // IsExcluded reports whether the path matches the excluded list.
+//
+// A literal prefix matches every path that starts with it. A pattern is
+// split into elements at slashes, and matches a path whose leading elements
+// each match the corresponding pattern element, using the syntax of
+// path.Match. So "*.corp.example.com" matches "a.corp.example.com/b", and
+// "example.com/spam/v*" matches every major version suffix below
+// example.com/spam. A pattern ending in a slash only matches paths with more
+// elements than the pattern.
 func (db *DB) IsExcluded(ctx context.Context, path string) (_ bool, err error) {
 	defer derrors.Wrap(&err, "DB.IsExcluded(ctx, %q)", path)
 
@@ -25,36 +46,58 @@ func (db *DB) IsExcluded(ctx context.Context, path string) (_ bool, err error) {
 	if excludedPrefixes.err != nil {
 		return false, excludedPrefixes.err
 	}
-	for _, prefix := range excludedPrefixes.prefixes {
-		if strings.HasPrefix(path, prefix) {
-			log.Infof(ctx, "path %q matched excluded prefix %q", path, prefix)
-			return true, nil
-		}
+	if prefix := excludedPrefixes.set.match(path); prefix != "" {
+		log.Infof(ctx, "path %q matched excluded prefix %q", path, prefix)
+		return true, nil
 	}
 	return false, nil
 }
 
-// InsertExcludedPrefix inserts prefix into the excluded_prefixes table.
+// InsertExcludedPrefix inserts prefix into the excluded_prefixes table. The
+// prefix may be a pattern; see IsExcluded. The user and reason are recorded
+// with it, and both are required.
 //
-// For real-time administration (e.g. DOS prevention), use the dbadmin tool.
-// to exclude or unexclude a prefix. If the exclusion is permanent (e.g. a user
-// request), also add the prefix and reason to the excluded.txt file.
+// For real-time administration (e.g. DOS prevention), use the worker's
+// /exclude and /unexclude endpoints to exclude or unexclude a prefix. If the
+// exclusion is permanent (e.g. a user request), also add the prefix and
+// reason to the excluded.txt file.
 func (db *DB) InsertExcludedPrefix(ctx context.Context, prefix, user, reason string) (err error) {
 	defer derrors.Wrap(&err, "DB.InsertExcludedPrefix(ctx, %q, %q)", prefix, reason)
 
+	if user == "" || reason == "" {
+		return fmt.Errorf("user and reason are required: %w", derrors.InvalidArgument)
+	}
+	if err := validateExcludedPrefix(prefix); err != nil {
+		return err
+	}
 	_, err = db.db.Exec(ctx, "INSERT INTO excluded_prefixes (prefix, created_by, reason) VALUES ($1, $2, $3)",
 		prefix, user, reason)
+	// Arrange to re-read the excluded_prefixes table on the next call to
+	// IsExcluded. Other processes see the change once their copy expires.
+	setExcludedPrefixesLastFetched(time.Time{})
+	return err
+}
+
+// DeleteExcludedPrefix deletes prefix from the excluded_prefixes table. It
+// returns an error wrapping derrors.NotFound if prefix is not there.
+func (db *DB) DeleteExcludedPrefix(ctx context.Context, prefix string) (err error) {
+	defer derrors.Wrap(&err, "DB.DeleteExcludedPrefix(ctx, %q)", prefix)
+
+	n, err := db.db.Exec(ctx, "DELETE FROM excluded_prefixes WHERE prefix = $1", prefix)
+	setExcludedPrefixesLastFetched(time.Time{})
 	if err != nil {
-		// Arrange to re-read the excluded_prefixes table on the next call to IsExcluded.
-		setExcludedPrefixesLastFetched(time.Time{})
+		return err
 	}
-	return err
+	if n == 0 {
+		return derrors.NotFound
+	}
+	return nil
 }
 
 // In-memory copy of excluded_prefixes.
 var excludedPrefixes struct {
 	mu          sync.Mutex
-	prefixes    []string
+	set         *exclusionSet
 	err         error
 	lastFetched time.Time
 }
@@ -76,26 +119,39 @@ func (db *DB) ensureExcludedPrefixes(ctx context.Context) {
 	if time.Since(lastFetched) < excludedPrefixesExpiration {
 		return
 	}
-	prefixes, err := db.GetExcludedPrefixes(ctx)
+	eps, err := db.GetExcludedPrefixes(ctx)
+	var prefixes []string
+	for _, ep := range eps {
+		prefixes = append(prefixes, ep.Prefix)
+	}
+	set := newExclusionSet(prefixes)
 	excludedPrefixes.mu.Lock()
 	defer excludedPrefixes.mu.Unlock()
 	excludedPrefixes.lastFetched = time.Now()
-	excludedPrefixes.prefixes = prefixes
+	excludedPrefixes.set = set
 	excludedPrefixes.err = err
 	if err != nil {
 		log.Errorf(ctx, "reading excluded_prefixes: %v", err)
 	}
 }
 
-// GetExcludedPrefixes reads all the excluded prefixes from the database.
-func (db *DB) GetExcludedPrefixes(ctx context.Context) ([]string, error) {
-	var eps []string
-	err := db.db.RunQuery(ctx, `SELECT prefix FROM excluded_prefixes`, func(rows *sql.Rows) error {
-		var ep string
-		if err := rows.Scan(&ep); err != nil {
+// GetExcludedPrefixes reads all the excluded prefixes from the database,
+// ordered by prefix.
+func (db *DB) GetExcludedPrefixes(ctx context.Context) ([]*ExcludedPrefix, error) {
+	var eps []*ExcludedPrefix
+	err := db.db.RunQuery(ctx, `
+		SELECT prefix, created_by, reason, created_at
+		FROM excluded_prefixes
+		ORDER BY prefix`, func(rows *sql.Rows) error {
+		var (
+			ep        ExcludedPrefix
+			createdAt sql.NullTime
+		)
+		if err := rows.Scan(&ep.Prefix, &ep.CreatedBy, &ep.Reason, &createdAt); err != nil {
 			return err
 		}
-		eps = append(eps, ep)
+		ep.CreatedAt = createdAt.Time
+		eps = append(eps, &ep)
 		return nil
 	})
 	if err != nil {
@@ -103,3 +159,98 @@ func (db *DB) GetExcludedPrefixes(ctx context.Context) ([]string, error) {
 	}
 	return eps, nil
 }
+
+// isExcludedPattern reports whether prefix is a pattern rather than a
+// literal prefix.
+func isExcludedPattern(prefix string) bool {
+	return strings.ContainsAny(prefix, `*?[\`)
+}
+
+// validateExcludedPrefix returns an error wrapping derrors.InvalidArgument if
+// prefix is empty, or is a malformed pattern.
+func validateExcludedPrefix(prefix string) error {
+	if prefix == "" {
+		return fmt.Errorf("empty prefix: %w", derrors.InvalidArgument)
+	}
+	if !isExcludedPattern(prefix) {
+		return nil
+	}
+	for _, elem := range strings.Split(strings.TrimSuffix(prefix, "/"), "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return fmt.Errorf("bad pattern element %q: %w", elem, derrors.InvalidArgument)
+		}
+	}
+	return nil
+}
+
+// An exclusionSet is the compiled form of the excluded_prefixes table.
+type exclusionSet struct {
+	literals []string
+	patterns []exclusionPattern
+}
+
+type exclusionPattern struct {
+	prefix string   // as stored in the table
+	elems  []string // prefix split at slashes, without a trailing slash
+	dir    bool     // prefix ends in a slash
+}
+
+// newExclusionSet compiles prefixes. Malformed patterns, which
+// InsertExcludedPrefix does not allow, never match.
+func newExclusionSet(prefixes []string) *exclusionSet {
+	s := &exclusionSet{}
+	for _, p := range prefixes {
+		if !isExcludedPattern(p) {
+			s.literals = append(s.literals, p)
+			continue
+		}
+		if validateExcludedPrefix(p) != nil {
+			continue
+		}
+		s.patterns = append(s.patterns, exclusionPattern{
+			prefix: p,
+			elems:  strings.Split(strings.TrimSuffix(p, "/"), "/"),
+			dir:    strings.HasSuffix(p, "/"),
+		})
+	}
+	sort.Strings(s.literals)
+	sort.Slice(s.patterns, func(i, j int) bool { return s.patterns[i].prefix < s.patterns[j].prefix })
+	return s
+}
+
+// match returns the excluded prefix that matches path, or the empty string
+// if there is none. Literal prefixes take precedence over patterns, and
+// otherwise the lowest matching prefix is returned, so the result does not
+// depend on the order of the table.
+func (s *exclusionSet) match(p string) string {
+	if s == nil {
+		return ""
+	}
+	for _, prefix := range s.literals {
+		if strings.HasPrefix(p, prefix) {
+			return prefix
+		}
+	}
+	if len(s.patterns) == 0 {
+		return ""
+	}
+	elems := strings.Split(p, "/")
+	for _, pat := range s.patterns {
+		if pat.matches(elems) {
+			return pat.prefix
+		}
+	}
+	return ""
+}
+
+func (pat *exclusionPattern) matches(elems []string) bool {
+	if len(elems) < len(pat.elems) || (pat.dir && len(elems) == len(pat.elems)) {
+		return false
+	}
+	for i, pe := range pat.elems {
+		if ok, _ := path.Match(pe, elems[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
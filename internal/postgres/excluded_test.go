@@ -6,7 +6,11 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal/derrors"
 )
 
 func TestIsExcluded(t *testing.T) {
@@ -14,8 +18,10 @@ func TestIsExcluded(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
 	defer cancel()
 
-	if _, err := testDB.db.Exec(ctx, "INSERT INTO excluded_prefixes (prefix, created_by, reason) VALUES ('bad', 'someone', 'because')"); err != nil {
-		t.Fatal(err)
+	for _, prefix := range []string{"bad", "*.corp.example.com/", "spam.com/family/v*"} {
+		if _, err := testDB.db.Exec(ctx, "INSERT INTO excluded_prefixes (prefix, created_by, reason) VALUES ($1, 'someone', 'because')", prefix); err != nil {
+			t.Fatal(err)
+		}
 	}
 
 	for _, test := range []struct {
@@ -27,6 +33,13 @@ func TestIsExcluded(t *testing.T) {
 		{"bad", true},
 		{"badness", true},
 		{"bad.com/foo", true},
+		{"a.corp.example.com/foo", true},
+		{"a.corp.example.com", false},
+		{"corp.example.com/foo", false},
+		{"spam.com/family", false},
+		{"spam.com/family/v2", true},
+		{"spam.com/family/v3/sub", true},
+		{"spam.com/familyv2", false},
 	} {
 		got, err := testDB.IsExcluded(ctx, test.path)
 		if err != nil {
@@ -37,3 +50,95 @@ func TestIsExcluded(t *testing.T) {
 		}
 	}
 }
+
+func TestInsertDeleteExcludedPrefix(t *testing.T) {
+	defer ResetTestDB(testDB, t)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	const path = "example.com/spam/v2"
+	check := func(want bool) {
+		t.Helper()
+		got, err := testDB.IsExcluded(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("IsExcluded(%q) = %t, want %t", path, got, want)
+		}
+	}
+
+	// Read the table, so that the in-memory copy must be invalidated for the
+	// insertion to be seen.
+	check(false)
+	if err := testDB.InsertExcludedPrefix(ctx, "example.com/spam/v*", "someone", "spam"); err != nil {
+		t.Fatal(err)
+	}
+	check(true)
+
+	eps, err := testDB.GetExcludedPrefixes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eps) != 1 {
+		t.Fatalf("got %d excluded prefixes, want 1", len(eps))
+	}
+	got := eps[0]
+	if got.CreatedAt.IsZero() {
+		t.Error("CreatedAt is zero")
+	}
+	want := &ExcludedPrefix{Prefix: "example.com/spam/v*", CreatedBy: "someone", Reason: "spam", CreatedAt: got.CreatedAt}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetExcludedPrefixes mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := testDB.DeleteExcludedPrefix(ctx, "example.com/spam/v*"); err != nil {
+		t.Fatal(err)
+	}
+	check(false)
+	if err := testDB.DeleteExcludedPrefix(ctx, "example.com/spam/v*"); !errors.Is(err, derrors.NotFound) {
+		t.Errorf("second DeleteExcludedPrefix: got %v, want NotFound", err)
+	}
+
+	for _, test := range []struct {
+		prefix, user, reason string
+	}{
+		{"", "someone", "spam"},
+		{"example.com/[", "someone", "spam"},
+		{"example.com/x", "", "spam"},
+		{"example.com/x", "someone", ""},
+	} {
+		if err := testDB.InsertExcludedPrefix(ctx, test.prefix, test.user, test.reason); !errors.Is(err, derrors.InvalidArgument) {
+			t.Errorf("InsertExcludedPrefix(%q, %q, %q): got %v, want InvalidArgument", test.prefix, test.user, test.reason, err)
+		}
+	}
+}
+
+func TestExclusionSetMatch(t *testing.T) {
+	set := newExclusionSet([]string{
+		"example.com/spam/v*",
+		"example.com/spam",
+		"*.corp.example.com/",
+		"*.example.com/x",
+		"bad.example.com/[", // malformed, never matches
+	})
+	for _, test := range []struct {
+		path, want string
+	}{
+		{"fine.com", ""},
+		// Literal prefixes take precedence over patterns that also match.
+		{"example.com/spam/v2", "example.com/spam"},
+		{"example.com/spammer", "example.com/spam"},
+		{"a.corp.example.com/foo", "*.corp.example.com/"},
+		{"a.corp.example.com", ""},
+		// Of several matching patterns, the lowest wins.
+		{"a.corp.example.com/x", "*.corp.example.com/"},
+		{"b.example.com/x/y", "*.example.com/x"},
+		{"b.example.com/xy", ""},
+		{"bad.example.com/[", ""},
+	} {
+		if got := set.match(test.path); got != test.want {
+			t.Errorf("match(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// FetchStats holds statistics about the fetch of a module version by the
+// worker. It is a row of the module_fetch_stats table.
+type FetchStats struct {
+	ModulePath  string
+	Version     string
+	FetchedAt   time.Time
+	Status      int
+	ZipSize     int64
+	NumZipFiles int
+	NumPackages int
+	Duration    time.Duration
+	// PhaseDurations are the durations of the phases of the fetch, keyed by
+	// phase. They are stored with millisecond precision.
+	PhaseDurations map[string]time.Duration
+	// MaxAlloc estimates the heap memory, in bytes, that the fetch needed.
+	MaxAlloc int64
+
+	// NumFetches is the number of fetches of the module version that have
+	// been recorded, including this one, and TotalDuration and MaxDuration
+	// are the total and longest of their durations. They are ignored by
+	// InsertFetchStats.
+	NumFetches    int
+	TotalDuration time.Duration
+	MaxDuration   time.Duration
+}
+
+// InsertFetchStats records the statistics of a fetch of a module version.
+// Only the latest fetch of each module version is kept, along with the
+// number of its fetches and their total and longest durations.
+func (db *DB) InsertFetchStats(ctx context.Context, s *FetchStats) (err error) {
+	defer derrors.Wrap(&err, "InsertFetchStats(ctx, %q, %q)", s.ModulePath, s.Version)
+
+	phases := map[string]int64{}
+	for name, d := range s.PhaseDurations {
+		phases[name] = d.Milliseconds()
+	}
+	phasesJSON, err := json.Marshal(phases)
+	if err != nil {
+		return err
+	}
+	_, err = db.db.Exec(ctx, `
+		INSERT INTO module_fetch_stats (
+			module_path, version, fetched_at, status, zip_size, num_zip_files,
+			num_packages, duration_ms, phase_durations_ms, max_alloc,
+			num_fetches, total_duration_ms, max_duration_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, 1, $8, $8)
+		ON CONFLICT (module_path, version)
+		DO UPDATE SET
+			fetched_at=excluded.fetched_at,
+			status=excluded.status,
+			zip_size=excluded.zip_size,
+			num_zip_files=excluded.num_zip_files,
+			num_packages=excluded.num_packages,
+			duration_ms=excluded.duration_ms,
+			phase_durations_ms=excluded.phase_durations_ms,
+			max_alloc=excluded.max_alloc,
+			num_fetches=module_fetch_stats.num_fetches + 1,
+			total_duration_ms=module_fetch_stats.total_duration_ms + excluded.duration_ms,
+			max_duration_ms=GREATEST(module_fetch_stats.max_duration_ms, excluded.duration_ms)`,
+		s.ModulePath, s.Version, s.FetchedAt, s.Status, s.ZipSize, s.NumZipFiles,
+		s.NumPackages, s.Duration.Milliseconds(), phasesJSON, s.MaxAlloc)
+	return err
+}
+
+// GetSlowestFetches returns the statistics of the at most limit module
+// versions whose latest fetches were at or after since, slowest first.
+func (db *DB) GetSlowestFetches(ctx context.Context, since time.Time, limit int) (_ []*FetchStats, err error) {
+	defer derrors.Wrap(&err, "GetSlowestFetches(ctx, %s, %d)", since, limit)
+	return db.queryFetchStats(ctx, `
+		WHERE fetched_at >= $1
+		ORDER BY duration_ms DESC, module_path, version
+		LIMIT $2`, since, limit)
+}
+
+// GetLargestModules returns the statistics of the at most limit module
+// versions with the largest zips that have been fetched, largest first.
+func (db *DB) GetLargestModules(ctx context.Context, limit int) (_ []*FetchStats, err error) {
+	defer derrors.Wrap(&err, "GetLargestModules(ctx, %d)", limit)
+	return db.queryFetchStats(ctx, `
+		ORDER BY zip_size DESC, module_path, version
+		LIMIT $1`, limit)
+}
+
+// GetModuleFetchStats returns the statistics of the at most limit versions
+// of modulePath that were fetched most recently, most recent first.
+func (db *DB) GetModuleFetchStats(ctx context.Context, modulePath string, limit int) (_ []*FetchStats, err error) {
+	defer derrors.Wrap(&err, "GetModuleFetchStats(ctx, %q, %d)", modulePath, limit)
+	return db.queryFetchStats(ctx, `
+		WHERE module_path = $1
+		ORDER BY fetched_at DESC, version
+		LIMIT $2`, modulePath, limit)
+}
+
+// queryFetchStats returns the rows of module_fetch_stats selected by the
+// given WHERE, ORDER BY and LIMIT clauses.
+func (db *DB) queryFetchStats(ctx context.Context, clauses string, args ...interface{}) ([]*FetchStats, error) {
+	query := `
+		SELECT
+			module_path, version, fetched_at, status, zip_size, num_zip_files,
+			num_packages, duration_ms, phase_durations_ms, max_alloc,
+			num_fetches, total_duration_ms, max_duration_ms
+		FROM module_fetch_stats ` + clauses
+	var stats []*FetchStats
+	err := db.db.RunQuery(ctx, query, func(rows *sql.Rows) error {
+		var (
+			s                                  FetchStats
+			phases                             map[string]int64
+			durationMS, totalMS, maxDurationMS int64
+		)
+		if err := rows.Scan(&s.ModulePath, &s.Version, &s.FetchedAt, &s.Status, &s.ZipSize, &s.NumZipFiles,
+			&s.NumPackages, &durationMS, jsonbScanner{&phases}, &s.MaxAlloc,
+			&s.NumFetches, &totalMS, &maxDurationMS); err != nil {
+			return err
+		}
+		s.Duration = time.Duration(durationMS) * time.Millisecond
+		s.TotalDuration = time.Duration(totalMS) * time.Millisecond
+		s.MaxDuration = time.Duration(maxDurationMS) * time.Millisecond
+		s.PhaseDurations = map[string]time.Duration{}
+		for name, ms := range phases {
+			s.PhaseDurations[name] = time.Duration(ms) * time.Millisecond
+		}
+		stats = append(stats, &s)
+		return nil
+	}, args...)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
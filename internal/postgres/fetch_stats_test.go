@@ -0,0 +1,82 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFetchStats(t *testing.T) {
+	defer ResetTestDB(testDB, t)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	now := time.Now().Truncate(time.Millisecond)
+	for _, s := range []*FetchStats{
+		{ModulePath: "a.com/m", Version: "v1.0.0", FetchedAt: now, ZipSize: 100, Duration: 3 * time.Second},
+		{ModulePath: "b.com/m", Version: "v1.0.0", FetchedAt: now, ZipSize: 300, Duration: time.Second},
+		// Too long ago to be among the slowest.
+		{ModulePath: "c.com/m", Version: "v1.0.0", FetchedAt: now.Add(-48 * time.Hour), ZipSize: 200, Duration: time.Hour},
+		// A refetch replaces the statistics of the first, and updates the
+		// aggregates.
+		{ModulePath: "a.com/m", Version: "v1.0.0", FetchedAt: now, ZipSize: 100, Duration: 2 * time.Second,
+			Status: 200, NumZipFiles: 4, NumPackages: 2, MaxAlloc: 1 << 20,
+			PhaseDurations: map[string]time.Duration{"fetch.download": 1500 * time.Millisecond}},
+	} {
+		if err := testDB.InsertFetchStats(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	slowest, err := testDB.GetSlowestFetches(ctx, now.Add(-24*time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &FetchStats{
+		ModulePath:     "a.com/m",
+		Version:        "v1.0.0",
+		FetchedAt:      now,
+		Status:         200,
+		ZipSize:        100,
+		NumZipFiles:    4,
+		NumPackages:    2,
+		Duration:       2 * time.Second,
+		PhaseDurations: map[string]time.Duration{"fetch.download": 1500 * time.Millisecond},
+		MaxAlloc:       1 << 20,
+		NumFetches:     2,
+		TotalDuration:  5 * time.Second,
+		MaxDuration:    3 * time.Second,
+	}
+	if len(slowest) != 2 || slowest[1].ModulePath != "b.com/m" {
+		t.Fatalf("got %d slowest fetches, want a.com/m and b.com/m", len(slowest))
+	}
+	if diff := cmp.Diff(want, slowest[0], cmp.Comparer(time.Time.Equal)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	moduleStats, err := testDB.GetModuleFetchStats(ctx, "a.com/m", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]*FetchStats{want}, moduleStats, cmp.Comparer(time.Time.Equal)); diff != "" {
+		t.Errorf("GetModuleFetchStats mismatch (-want +got):\n%s", diff)
+	}
+
+	largest, err := testDB.GetLargestModules(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range largest {
+		got = append(got, s.ModulePath)
+	}
+	if want := []string{"b.com/m", "c.com/m"}; !cmp.Equal(got, want) {
+		t.Errorf("GetLargestModules: got %v, want %v", got, want)
+	}
+}
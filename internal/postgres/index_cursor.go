@@ -0,0 +1,150 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/database"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// IndexCursorPoll is the IndexCursor.UpdatedBy of a cursor that was advanced
+// by polling the index.
+const IndexCursorPoll = "poll"
+
+// An IndexCursor is the position up to which the module index has been read.
+type IndexCursor struct {
+	// Timestamp is the index timestamp of the last module version read.
+	Timestamp time.Time
+	// ModulePath and Version identify the last module version read. They
+	// are empty if the cursor was reset to a timestamp, or was never stored.
+	ModulePath string
+	Version    string
+	// UpdatedAt and UpdatedBy record when and by whom the cursor was last
+	// changed. They are zero if the cursor was never stored.
+	UpdatedAt time.Time
+	UpdatedBy string
+}
+
+// GetIndexCursor returns the stored index cursor. If none is stored, it
+// returns a cursor at the latest index timestamp in module_version_states.
+func (db *DB) GetIndexCursor(ctx context.Context) (_ *IndexCursor, err error) {
+	defer derrors.Wrap(&err, "GetIndexCursor(ctx)")
+
+	c, err := getIndexCursor(ctx, db.db, false)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		return c, nil
+	}
+	ts, err := db.LatestIndexTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &IndexCursor{Timestamp: ts}, nil
+}
+
+// getIndexCursor returns the stored index cursor, or nil if there is none.
+// If forUpdate is true, the row is locked until the end of the transaction.
+func getIndexCursor(ctx context.Context, db *database.DB, forUpdate bool) (*IndexCursor, error) {
+	query := `
+		SELECT index_timestamp, module_path, version, updated_at, updated_by
+		FROM index_cursor`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	var c IndexCursor
+	err := db.QueryRow(ctx, query).Scan(&c.Timestamp, &c.ModulePath, &c.Version, &c.UpdatedAt, &c.UpdatedBy)
+	switch err {
+	case nil:
+		return &c, nil
+	case sql.ErrNoRows:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+// SetIndexCursor stores an index cursor at timestamp, recording user as the
+// one who set it. Polling the index resumes from there.
+func (db *DB) SetIndexCursor(ctx context.Context, timestamp time.Time, user string) (err error) {
+	defer derrors.Wrap(&err, "SetIndexCursor(ctx, %s, %q)", timestamp, user)
+
+	return putIndexCursor(ctx, db.db, &IndexCursor{Timestamp: timestamp, UpdatedBy: user})
+}
+
+func putIndexCursor(ctx context.Context, db *database.DB, c *IndexCursor) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO index_cursor (index_timestamp, module_path, version, updated_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (singleton) DO UPDATE SET
+			index_timestamp = excluded.index_timestamp,
+			module_path = excluded.module_path,
+			version = excluded.version,
+			updated_at = CURRENT_TIMESTAMP,
+			updated_by = excluded.updated_by`,
+		c.Timestamp, c.ModulePath, c.Version, c.UpdatedBy)
+	return err
+}
+
+// InsertIndexVersionsAndAdvanceCursor inserts versions, a page of the module
+// index in index order, into module_version_states, and advances the index
+// cursor to the last of them, in a single transaction. If the page is not
+// stored, the cursor does not move, so the page is read again.
+//
+// Versions with timestamps at or before the cursor, which are read again
+// when polling overlaps the part of the index already read, are only inserted
+// if they are not already in module_version_states. The cursor never moves
+// backwards.
+//
+// It returns the new cursor.
+func (db *DB) InsertIndexVersionsAndAdvanceCursor(ctx context.Context, versions []*internal.IndexVersion) (_ *IndexCursor, err error) {
+	defer derrors.Wrap(&err, "InsertIndexVersionsAndAdvanceCursor(ctx, %d versions)", len(versions))
+
+	var cursor *IndexCursor
+	err = db.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		cursor, err = getIndexCursor(ctx, tx, true)
+		if err != nil {
+			return err
+		}
+		var seen, unseen []*internal.IndexVersion
+		for _, v := range versions {
+			if cursor != nil && !v.Timestamp.After(cursor.Timestamp) {
+				seen = append(seen, v)
+			} else {
+				unseen = append(unseen, v)
+			}
+		}
+		if err := insertIndexVersions(ctx, tx, seen, false); err != nil {
+			return err
+		}
+		if err := insertIndexVersions(ctx, tx, unseen, true); err != nil {
+			return err
+		}
+		if len(unseen) == 0 {
+			return nil
+		}
+		last := unseen[len(unseen)-1]
+		cursor = &IndexCursor{
+			Timestamp:  last.Timestamp,
+			ModulePath: last.Path,
+			Version:    last.Version,
+			UpdatedBy:  IndexCursorPoll,
+		}
+		return putIndexCursor(ctx, tx, cursor)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cursor == nil {
+		return db.GetIndexCursor(ctx)
+	}
+	return cursor, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"golang.org/x/pkgsite/internal"
+)
+
+func TestInsertIndexVersionsAndAdvanceCursor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer ResetTestDB(testDB, t)
+	cleanCursor := func() {
+		if _, err := testDB.db.Exec(ctx, `TRUNCATE index_cursor`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleanCursor()
+	defer cleanCursor()
+
+	start := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	iv := func(path string, minutes int) *internal.IndexVersion {
+		return &internal.IndexVersion{Path: path, Version: "v1.0.0", Timestamp: start.Add(time.Duration(minutes) * time.Minute)}
+	}
+	ignore := cmpopts.IgnoreFields(IndexCursor{}, "UpdatedAt")
+	advance := func(want *IndexCursor, versions ...*internal.IndexVersion) {
+		t.Helper()
+		got, err := testDB.InsertIndexVersionsAndAdvanceCursor(ctx, versions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got, ignore); diff != "" {
+			t.Errorf("returned cursor mismatch (-want +got):\n%s", diff)
+		}
+		got, err = testDB.GetIndexCursor(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got, ignore); diff != "" {
+			t.Errorf("stored cursor mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	// Without a stored cursor, the cursor is at the latest index timestamp.
+	if err := testDB.InsertIndexVersions(ctx, []*internal.IndexVersion{iv("a.com/m", 0)}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := testDB.GetIndexCursor(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&IndexCursor{Timestamp: start}, got); diff != "" {
+		t.Errorf("initial cursor mismatch (-want +got):\n%s", diff)
+	}
+
+	advance(&IndexCursor{Timestamp: start.Add(2 * time.Minute), ModulePath: "c.com/m", Version: "v1.0.0", UpdatedBy: IndexCursorPoll},
+		iv("a.com/m", 1), iv("b.com/m", 2), iv("c.com/m", 2))
+
+	// Make a.com/m not due, so we can tell whether reading it again in an
+	// overlapping page makes it due.
+	if _, err := testDB.db.Exec(ctx, `
+		UPDATE module_version_states SET next_processed_after = CURRENT_TIMESTAMP + INTERVAL '1 day'
+		WHERE module_path = 'a.com/m'`); err != nil {
+		t.Fatal(err)
+	}
+	// A page that is all before the cursor leaves it alone, but inserts
+	// versions it has not seen.
+	advance(&IndexCursor{Timestamp: start.Add(2 * time.Minute), ModulePath: "c.com/m", Version: "v1.0.0", UpdatedBy: IndexCursorPoll},
+		iv("a.com/m", 1), iv("late.com/m", 1))
+	for _, path := range []string{"a.com/m", "late.com/m"} {
+		mvs, err := testDB.GetModuleVersionState(ctx, path, "v1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path == "a.com/m" && mvs.NextProcessedAfter.Before(time.Now()) {
+			t.Errorf("%s was made due by reading it again", path)
+		}
+	}
+
+	advance(&IndexCursor{Timestamp: start.Add(3 * time.Minute), ModulePath: "d.com/m", Version: "v1.0.0", UpdatedBy: IndexCursorPoll},
+		iv("c.com/m", 2), iv("d.com/m", 3))
+
+	if err := testDB.SetIndexCursor(ctx, start, "someone"); err != nil {
+		t.Fatal(err)
+	}
+	advance(&IndexCursor{Timestamp: start, UpdatedBy: "someone"})
+}
@@ -6,7 +6,9 @@ package postgres
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -52,14 +54,19 @@ func (db *DB) InsertModule(ctx context.Context, m *internal.Module) (err error)
 	// inserted. Rows that currently exist should not be missing from the
 	// new module. We want to be sure that we will overwrite every row that
 	// pertains to the module.
-	if err := db.compareLicenses(ctx, m); err != nil {
-		return err
-	}
-	if err := db.comparePackages(ctx, m); err != nil {
-		return err
-	}
-	if err := db.comparePaths(ctx, m); err != nil {
-		return err
+	//
+	// Which packages of a truncated module are processed depends on the
+	// limit at the time, so saveModule replaces it instead.
+	if m.TotalPackages == 0 {
+		if err := db.compareLicenses(ctx, m); err != nil {
+			return err
+		}
+		if err := db.comparePackages(ctx, m); err != nil {
+			return err
+		}
+		if err := db.comparePaths(ctx, m); err != nil {
+			return err
+		}
 	}
 	if !db.bypassLicenseCheck {
 		// If we are not bypassing license checking, remove data for non-redistributable modules.
@@ -70,19 +77,60 @@ func (db *DB) InsertModule(ctx context.Context, m *internal.Module) (err error)
 
 // saveModule inserts a Module into the database along with its packages,
 // imports, and licenses.  If any of these rows already exist, the module and
-// corresponding will be deleted and reinserted.
+// corresponding will be deleted and reinserted. An existing module whose
+// packages were truncated is deleted first.
 // If the module is malformed then insertion will fail.
 //
+// The rows of each table are sent with a single COPY statement, so the number
+// of round trips to the database does not grow with the number of packages.
+//
 // A derrors.InvalidArgument error will be returned if the given module and
 // licenses are invalid.
+//
+// Concurrent calls for the same module version are serialized. If the
+// identical module version has already been inserted, for example by another
+// worker that processed a redelivered task at the same time, saveModule does
+// nothing and succeeds, unless the module version has been marked to be
+// processed again, as by reprocessing or requeueing.
 func (db *DB) saveModule(ctx context.Context, m *internal.Module) (err error) {
 	defer derrors.Wrap(&err, "saveModule(ctx, tx, Module(%q, %q))", m.ModulePath, m.Version)
 	ctx, span := trace.StartSpan(ctx, "saveModule")
 	defer span.End()
 
 	logMemory(ctx, "at start of saveModule")
+	contentHash, err := moduleContentHash(m, db.docCodec)
+	if err != nil {
+		return err
+	}
 	return db.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
-		moduleID, err := insertModule(ctx, tx, m)
+		// Hold a lock on the module version for the whole transaction, so that
+		// a concurrent insertion of the same version waits for this one to
+		// commit instead of failing partway with a unique violation. This is
+		// a different lock from the one on the module path below, which is
+		// held only briefly, so versions of the same module can still be
+		// inserted concurrently. It is also different from the lock of
+		// WithModuleVersionLock, which the worker holds on another connection
+		// while it calls InsertModule.
+		if err := lock(ctx, tx, insertLockKey(m.ModulePath, m.Version)); err != nil {
+			return err
+		}
+		inserted, err := isInserted(ctx, tx, m.ModulePath, m.Version, contentHash)
+		if err != nil {
+			return err
+		}
+		if inserted {
+			log.Infof(ctx, "%s@%s: identical version already inserted", m.ModulePath, m.Version)
+			return nil
+		}
+		if m.TotalPackages > 0 {
+			// Delete the rows of packages that an earlier processing of the
+			// module inserted but this one did not process, along with their
+			// imports and search documents, by deleting the module.
+			if _, err := tx.Exec(ctx, `DELETE FROM modules WHERE module_path=$1 AND version=$2`, m.ModulePath, m.Version); err != nil {
+				return err
+			}
+		}
+		moduleID, err := insertModule(ctx, tx, m, contentHash)
 		if err != nil {
 			return err
 		}
@@ -98,7 +146,7 @@ func (db *DB) saveModule(ctx context.Context, m *internal.Module) (err error) {
 		}
 		logMemory(ctx, "after insertPackages")
 
-		if err := insertUnits(ctx, tx, m, moduleID); err != nil {
+		if err := insertUnits(ctx, tx, m, moduleID, db.docCodec); err != nil {
 			return err
 		}
 		logMemory(ctx, "after insertUnits")
@@ -123,7 +171,8 @@ func (db *DB) saveModule(ctx context.Context, m *internal.Module) (err error) {
 			return nil
 		}
 
-		if err := insertImportsUnique(ctx, tx, m); err != nil {
+		oldImports, err := insertImportsUnique(ctx, tx, m)
+		if err != nil {
 			return err
 		}
 
@@ -157,11 +206,94 @@ func (db *DB) saveModule(ctx context.Context, m *internal.Module) (err error) {
 			return err
 		}
 		// Insert the module's packages into search_documents.
-		return upsertSearchDocuments(ctx, tx, m)
+		if err := upsertSearchDocuments(ctx, tx, m); err != nil {
+			return err
+		}
+		// Now that the importers are in search_documents, count their new
+		// imports.
+		return updateImportedByCountsForModule(ctx, tx, m.ModulePath, oldImports, moduleImports(m))
 	})
 }
 
-func insertModule(ctx context.Context, db *database.DB, m *internal.Module) (_ int, err error) {
+// insertLockKey returns the string whose advisory lock saveModule holds while
+// inserting modulePath@version. Module paths cannot contain ":", so it is not
+// the key of any other lock.
+func insertLockKey(modulePath, version string) string {
+	return "insert:" + modulePath + "@" + version
+}
+
+// moduleContentHash returns a hash of the data of m that saveModule writes
+// with docCodec.
+func moduleContentHash(m *internal.Module, docCodec *codec) (_ string, err error) {
+	defer derrors.Wrap(&err, "moduleContentHash(%q, %q)", m.ModulePath, m.Version)
+
+	h := sha256.New()
+	if docCodec != nil {
+		io.WriteString(h, docCodec.name)
+	}
+	// Encode the module piece by piece, so that the source and API of the
+	// documentation, which can be large, are hashed as they are instead of
+	// being copied into the JSON encoding in base64. Documentation HTML does not
+	// encode to JSON, so it is hashed separately too.
+	enc := json.NewEncoder(h)
+	mc := *m
+	mc.Units = nil
+	if err := enc.Encode(&mc); err != nil {
+		return "", err
+	}
+	for _, u := range m.Units {
+		uc := *u
+		uc.Documentation = nil
+		if err := enc.Encode(&uc); err != nil {
+			return "", err
+		}
+		for _, d := range u.Documentation {
+			dc := *d
+			dc.Source = nil
+			dc.API = nil
+			if err := enc.Encode(&dc); err != nil {
+				return "", err
+			}
+			io.WriteString(h, d.HTML.String())
+			h.Write(d.Source)
+			h.Write(d.API)
+		}
+	}
+	for _, p := range m.LegacyPackages {
+		io.WriteString(h, p.DocumentationHTML.String())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// isInserted reports whether the module version is in the modules table with
+// the given content hash, and has not been marked to be processed again since
+// it was inserted. Reprocessing and requeueing a module version clear the
+// last_processed_at column of its module_version_states row, so that it is
+// inserted again even if its data has not changed, since the code that
+// inserts it may have.
+func isInserted(ctx context.Context, db *database.DB, modulePath, version, contentHash string) (bool, error) {
+	var (
+		h   string
+		due bool
+	)
+	err := db.QueryRow(ctx, `
+		SELECT m.content_hash, s.module_path IS NOT NULL AND s.last_processed_at IS NULL
+		FROM modules m
+		LEFT JOIN module_version_states s
+		ON s.module_path = m.module_path AND s.version = m.version
+		WHERE m.module_path = $1 AND m.version = $2`,
+		modulePath, version).Scan(&h, &due)
+	switch err {
+	case sql.ErrNoRows:
+		return false, nil
+	case nil:
+		return h == contentHash && !due, nil
+	default:
+		return false, err
+	}
+}
+
+func insertModule(ctx context.Context, db *database.DB, m *internal.Module, contentHash string) (_ int, err error) {
 	ctx, span := trace.StartSpan(ctx, "insertModule")
 	defer span.End()
 	defer derrors.Wrap(&err, "insertModule(ctx, %q, %q)", m.ModulePath, m.Version)
@@ -173,6 +305,18 @@ func insertModule(ctx context.Context, db *database.DB, m *internal.Module) (_ i
 	if err != nil {
 		return 0, err
 	}
+	// Mark the version as retracted if the go.mod file of the latest version
+	// of the module retracts it, so that it is not chosen as the latest
+	// version before UpdateLatestModuleVersions runs again.
+	var rv internal.RetractedVersion
+	retracted := false
+	lmv, err := getLatestModuleVersions(ctx, db, m.ModulePath)
+	switch {
+	case err == nil:
+		rv, retracted = lmv.Retraction(m.Version)
+	case !errors.Is(err, derrors.NotFound):
+		return 0, err
+	}
 	var moduleID int
 	err = db.QueryRow(ctx,
 		`INSERT INTO modules(
@@ -187,15 +331,33 @@ func insertModule(ctx context.Context, db *database.DB, m *internal.Module) (_ i
 			source_info,
 			redistributable,
 			has_go_mod,
-			incompatible)
-		VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+			has_security_policy,
+			incompatible,
+			processed_packages,
+			total_packages,
+			go_version,
+			toolchain,
+			checksum_status,
+			retracted,
+			retraction_rationale,
+			content_hash)
+		VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21)
 		ON CONFLICT
 			(module_path, version)
 		DO UPDATE SET
 			readme_file_path=excluded.readme_file_path,
 			readme_contents=excluded.readme_contents,
 			source_info=excluded.source_info,
-			redistributable=excluded.redistributable
+			redistributable=excluded.redistributable,
+			has_security_policy=excluded.has_security_policy,
+			processed_packages=excluded.processed_packages,
+			total_packages=excluded.total_packages,
+			go_version=excluded.go_version,
+			toolchain=excluded.toolchain,
+			checksum_status=excluded.checksum_status,
+			retracted=excluded.retracted,
+			retraction_rationale=excluded.retraction_rationale,
+			content_hash=excluded.content_hash
 		RETURNING id`,
 		m.ModulePath,
 		m.Version,
@@ -208,7 +370,16 @@ func insertModule(ctx context.Context, db *database.DB, m *internal.Module) (_ i
 		sourceInfoJSON,
 		m.IsRedistributable,
 		m.HasGoMod,
+		m.HasSecurityPolicy,
 		isIncompatible(m.Version),
+		m.ProcessedPackages,
+		m.TotalPackages,
+		m.GoVersion,
+		m.Toolchain,
+		m.ChecksumStatus,
+		retracted,
+		rv.Rationale,
+		contentHash,
 	).Scan(&moduleID)
 	if err != nil {
 		return 0, err
@@ -227,7 +398,7 @@ func insertLicenses(ctx context.Context, db *database.DB, m *internal.Module, mo
 			return fmt.Errorf("marshalling %+v: %v", l.Coverage, err)
 		}
 		licenseValues = append(licenseValues, m.ModulePath, m.Version,
-			l.FilePath, makeValidUnicode(string(l.Contents)), pq.Array(l.Types), covJSON, moduleID)
+			l.FilePath, makeValidUnicode(string(l.Contents)), pq.Array(l.Types), string(covJSON), moduleID)
 	}
 	if len(licenseValues) > 0 {
 		licenseCols := []string{
@@ -239,7 +410,7 @@ func insertLicenses(ctx context.Context, db *database.DB, m *internal.Module, mo
 			"coverage",
 			"module_id",
 		}
-		return db.BulkUpsert(ctx, "licenses", licenseCols, licenseValues,
+		return db.CopyUpsert(ctx, "licenses", licenseCols, licenseValues,
 			[]string{"module_path", "version", "file_path"})
 	}
 	return nil
@@ -322,7 +493,7 @@ func legacyInsertPackages(ctx context.Context, db *database.DB, m *internal.Modu
 			"goarch",
 			"commit_time",
 		}
-		if err := db.BulkUpsert(ctx, "packages", pkgCols, pkgValues, uniqueCols); err != nil {
+		if err := db.CopyUpsert(ctx, "packages", pkgCols, pkgValues, uniqueCols); err != nil {
 			return err
 		}
 	}
@@ -334,7 +505,7 @@ func legacyInsertPackages(ctx context.Context, db *database.DB, m *internal.Modu
 			"from_version",
 			"to_path",
 		}
-		if err := db.BulkUpsert(ctx, "imports", importCols, importValues, importCols); err != nil {
+		if err := db.CopyUpsert(ctx, "imports", importCols, importValues, importCols); err != nil {
 			return err
 		}
 	}
@@ -342,34 +513,63 @@ func legacyInsertPackages(ctx context.Context, db *database.DB, m *internal.Modu
 }
 
 // insertImportsUnique inserts and removes rows from the imports_unique table. It should only
-// be called if the given module's version is the latest.
-func insertImportsUnique(ctx context.Context, tx *database.DB, m *internal.Module) (err error) {
+// be called if the given module's version is the latest. It returns the
+// imports of the module that it removed.
+func insertImportsUnique(ctx context.Context, tx *database.DB, m *internal.Module) (oldImports []importEdge, err error) {
 	ctx, span := trace.StartSpan(ctx, "insertImportsUnique")
 	defer span.End()
 	defer derrors.Wrap(&err, "insertImportsUnique(%q, %q)", m.ModulePath, m.Version)
 
 	// Remove the previous rows for this module. We'll replace them with
 	// new ones below.
-	if _, err := tx.Exec(ctx,
-		`DELETE FROM imports_unique WHERE from_module_path = $1`,
-		m.ModulePath); err != nil {
-		return err
+	err = tx.RunQuery(ctx,
+		`DELETE FROM imports_unique WHERE from_module_path = $1 RETURNING from_path, to_path`,
+		func(rows *sql.Rows) error {
+			var e importEdge
+			if err := rows.Scan(&e.from, &e.to); err != nil {
+				return err
+			}
+			oldImports = append(oldImports, e)
+			return nil
+		}, m.ModulePath)
+	if err != nil {
+		return nil, err
 	}
 
 	var values []interface{}
-	for _, u := range m.Units {
-		for _, i := range u.Imports {
-			values = append(values, u.Path, m.ModulePath, i)
-		}
+	for _, e := range moduleImports(m) {
+		values = append(values, e.from, m.ModulePath, e.to)
 	}
 	if len(values) == 0 {
-		return nil
+		return oldImports, nil
 	}
 	cols := []string{"from_path", "from_module_path", "to_path"}
-	return tx.BulkUpsert(ctx, "imports_unique", cols, values, cols)
+	if err := tx.CopyUpsert(ctx, "imports_unique", cols, values, cols); err != nil {
+		return nil, err
+	}
+	return oldImports, nil
+}
+
+// An importEdge is the path of a package and the path of a package that it
+// imports.
+type importEdge struct {
+	from, to string
 }
 
-func insertUnits(ctx context.Context, db *database.DB, m *internal.Module, moduleID int) (err error) {
+// moduleImports returns the imports of the units of m.
+func moduleImports(m *internal.Module) []importEdge {
+	var edges []importEdge
+	for _, u := range m.Units {
+		for _, i := range u.Imports {
+			edges = append(edges, importEdge{u.Path, i})
+		}
+	}
+	return edges
+}
+
+// insertUnits inserts the units of m. It compresses their documentation with
+// docCodec, unless it is nil.
+func insertUnits(ctx context.Context, db *database.DB, m *internal.Module, moduleID int, docCodec *codec) (err error) {
 	defer derrors.Wrap(&err, "insertUnits(ctx, tx, %q, %q)", m.ModulePath, m.Version)
 	ctx, span := trace.StartSpan(ctx, "insertUnits")
 	defer span.End()
@@ -393,7 +593,7 @@ func insertUnits(ctx context.Context, db *database.DB, m *internal.Module, modul
 		paths         []string
 		pathToID      = map[string]int{}
 		pathToReadme  = map[string]*internal.Readme{}
-		pathToDoc     = map[string]*internal.Documentation{}
+		pathToDoc     = map[string][]*internal.Documentation{}
 		pathToImports = map[string][]string{}
 	)
 	for _, d := range m.Units {
@@ -421,14 +621,19 @@ func insertUnits(ctx context.Context, db *database.DB, m *internal.Module, modul
 			pq.Array(licenseTypes),
 			pq.Array(licensePaths),
 			d.IsRedistributable,
+			d.ContentHash,
 		)
 		if d.Readme != nil {
 			pathToReadme[d.Path] = d.Readme
 		}
-		if d.Documentation != nil && d.Documentation.HTML.String() == internal.StringFieldMissing {
-			return errors.New("saveModule: package missing Documentation.HTML")
+		for _, doc := range d.Documentation {
+			if doc.HTML.String() == internal.StringFieldMissing {
+				return errors.New("saveModule: package missing Documentation.HTML")
+			}
+		}
+		if len(d.Documentation) > 0 {
+			pathToDoc[d.Path] = d.Documentation
 		}
-		pathToDoc[d.Path] = d.Documentation
 		if len(d.Imports) > 0 {
 			pathToImports[d.Path] = d.Imports
 		}
@@ -443,12 +648,13 @@ func insertUnits(ctx context.Context, db *database.DB, m *internal.Module, modul
 			"license_types",
 			"license_paths",
 			"redistributable",
+			"content_hash",
 		}
 		logMemory(ctx, "before inserting into paths")
 
 		uniqueCols := []string{"path", "module_id"}
 		returningCols := []string{"id", "path"}
-		if err := db.BulkUpsertReturning(ctx, "paths", pathCols, pathValues, uniqueCols, returningCols, func(rows *sql.Rows) error {
+		if err := db.CopyUpsertReturning(ctx, "paths", pathCols, pathValues, uniqueCols, returningCols, func(rows *sql.Rows) error {
 			var (
 				pathID int
 				path   string
@@ -488,25 +694,55 @@ func insertUnits(ctx context.Context, db *database.DB, m *internal.Module, modul
 			readmeValues = append(readmeValues, id, readme.Filepath, readmeContents)
 		}
 		readmeCols := []string{"path_id", "file_path", "contents"}
-		if err := db.BulkUpsert(ctx, "readmes", readmeCols, readmeValues, []string{"path_id"}); err != nil {
+		if err := db.CopyUpsert(ctx, "readmes", readmeCols, readmeValues, []string{"path_id"}); err != nil {
 			return err
 		}
 	}
 
+	// Remove the documentation of build contexts that a unit no longer has,
+	// which a module that is reprocessed would otherwise keep.
+	var (
+		pathIDs                []int
+		docPathIDs             []int
+		docGOOSes, docGOARCHes []string
+	)
+	for _, path := range paths {
+		id := pathToID[path]
+		pathIDs = append(pathIDs, id)
+		for _, doc := range pathToDoc[path] {
+			docPathIDs = append(docPathIDs, id)
+			docGOOSes = append(docGOOSes, doc.GOOS)
+			docGOARCHes = append(docGOARCHes, doc.GOARCH)
+		}
+	}
+	if _, err := db.Exec(ctx, `
+		DELETE FROM documentation
+		WHERE
+			path_id = ANY($1)
+			AND (path_id, goos, goarch) NOT IN (
+				SELECT * FROM unnest($2::integer[], $3::text[], $4::text[])
+			)`,
+		pq.Array(pathIDs), pq.Array(docPathIDs), pq.Array(docGOOSes), pq.Array(docGOARCHes)); err != nil {
+		return err
+	}
+
 	if len(pathToDoc) > 0 {
 		logMemory(ctx, "before inserting into documentation")
 		var docValues []interface{}
 		for _, path := range paths {
-			doc := pathToDoc[path]
-			if doc == nil {
-				continue
-			}
 			id := pathToID[path]
-			docValues = append(docValues, id, doc.GOOS, doc.GOARCH, doc.Synopsis, makeValidUnicode(doc.HTML.String()))
+			for _, doc := range pathToDoc[path] {
+				html, compressedHTML, source, api, err := encodeDocumentation(doc, docCodec)
+				if err != nil {
+					return err
+				}
+				docValues = append(docValues, id, doc.GOOS, doc.GOARCH, doc.Synopsis, doc.FullSynopsis, html, compressedHTML, source,
+					api, pq.Array(doc.Symbols))
+			}
 		}
 		uniqueCols := []string{"path_id", "goos", "goarch"}
-		docCols := append(uniqueCols, "synopsis", "html")
-		if err := db.BulkUpsert(ctx, "documentation", docCols, docValues, uniqueCols); err != nil {
+		docCols := append(uniqueCols, "synopsis", "full_synopsis", "html", "compressed_html", "zip", "api", "symbols")
+		if err := db.CopyUpsert(ctx, "documentation", docCols, docValues, uniqueCols); err != nil {
 			return err
 		}
 	}
@@ -524,7 +760,7 @@ func insertUnits(ctx context.Context, db *database.DB, m *internal.Module, modul
 		}
 	}
 	importCols := []string{"path_id", "to_path"}
-	return db.BulkUpsert(ctx, "package_imports", importCols, importValues, importCols)
+	return db.CopyUpsert(ctx, "package_imports", importCols, importValues, importCols)
 }
 
 // lock obtains an exclusive, transaction-scoped advisory lock on modulePath.
@@ -533,18 +769,7 @@ func lock(ctx context.Context, tx *database.DB, modulePath string) (err error) {
 	if !tx.InTransaction() {
 		return errors.New("not in a transaction")
 	}
-	// Postgres advisory locks use a 64-bit integer key. Convert modulePath to a
-	// key by hashing.
-	//
-	// This can result in collisions (two module paths hashing to the same key),
-	// but they are unlikely and at worst will slow things down a bit.
-	//
-	// We use the FNV hash algorithm from the standard library. It fits into 64
-	// bits unlike a crypto hash, and is stable across processes, unlike
-	// hash/maphash.
-	hasher := fnv.New64()
-	io.WriteString(hasher, modulePath) // Writing to a hash.Hash never returns an error.
-	h := int64(hasher.Sum64())
+	h := advisoryLockKey(modulePath)
 	log.Debugf(ctx, "locking %s (%d) ...", modulePath, h)
 	// See https://www.postgresql.org/docs/11/functions-admin.html#FUNCTIONS-ADVISORY-LOCKS.
 	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, h); err != nil {
@@ -554,6 +779,22 @@ func lock(ctx context.Context, tx *database.DB, modulePath string) (err error) {
 	return nil
 }
 
+// advisoryLockKey returns the key of the Postgres advisory lock for s.
+func advisoryLockKey(s string) int64 {
+	// Postgres advisory locks use a 64-bit integer key. Convert s to a key by
+	// hashing.
+	//
+	// This can result in collisions (two strings hashing to the same key),
+	// but they are unlikely and at worst will slow things down a bit.
+	//
+	// We use the FNV hash algorithm from the standard library. It fits into 64
+	// bits unlike a crypto hash, and is stable across processes, unlike
+	// hash/maphash.
+	hasher := fnv.New64()
+	io.WriteString(hasher, s) // Writing to a hash.Hash never returns an error.
+	return int64(hasher.Sum64())
+}
+
 // isIncompatible reports whether the build metadata of the version is
 // "+incompatible", https://semver.org clause 10.
 func isIncompatible(version string) bool {
@@ -700,6 +941,9 @@ func (db *DB) DeleteModule(ctx context.Context, modulePath, version string) (err
 		if _, err = tx.Exec(ctx, `DELETE FROM version_map WHERE module_path = $1 AND resolved_version = $2`, modulePath, version); err != nil {
 			return err
 		}
+		if _, err = tx.Exec(ctx, `DELETE FROM symbol_history WHERE module_path = $1 AND version = $2`, modulePath, version); err != nil {
+			return err
+		}
 
 		var x int
 		err = tx.QueryRow(ctx, `SELECT 1 FROM modules WHERE module_path=$1 LIMIT 1`, modulePath).Scan(&x)
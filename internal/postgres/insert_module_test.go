@@ -7,9 +7,11 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -20,12 +22,14 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/google/safehtml"
 	"github.com/google/safehtml/testconversions"
+	"github.com/lib/pq"
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/database"
 	"golang.org/x/pkgsite/internal/derrors"
 	"golang.org/x/pkgsite/internal/licenses"
 	"golang.org/x/pkgsite/internal/source"
 	"golang.org/x/pkgsite/internal/stdlib"
+	"golang.org/x/pkgsite/internal/testing/dbtest"
 	"golang.org/x/pkgsite/internal/testing/sample"
 )
 
@@ -127,7 +131,10 @@ func checkModule(ctx context.Context, t *testing.T, want *internal.Module) {
 		for _, u := range want.Units {
 			if u.IsPackage() && (strings.HasPrefix(u.Path, wantu.Path) ||
 				wantu.Path == stdlib.ModulePath) {
-				subdirectories = append(subdirectories, sample.PackageMeta(u.Path))
+				pm := sample.PackageMeta(u.Path)
+				pm.ModulePath = want.ModulePath
+				pm.Version = want.Version
+				subdirectories = append(subdirectories, pm)
 			}
 		}
 		wantu.Subdirectories = subdirectories
@@ -168,7 +175,7 @@ func TestInsertModuleLicenseCheck(t *testing.T) {
 
 			mod := sample.Module(sample.ModulePath, sample.VersionString, "")
 			checkHasRedistData(mod.LegacyReadmeContents, mod.LegacyPackages[0].DocumentationHTML, true)
-			checkHasRedistData(mod.Units[0].Readme.Contents, mod.Units[0].Documentation.HTML, true)
+			checkHasRedistData(mod.Units[0].Readme.Contents, mod.Units[0].Documentation[0].HTML, true)
 			mod.IsRedistributable = false
 			mod.LegacyPackages[0].IsRedistributable = false
 			mod.Units[0].IsRedistributable = false
@@ -204,7 +211,7 @@ func TestInsertModuleLicenseCheck(t *testing.T) {
 			}
 			var doc safehtml.HTML
 			if u.Documentation != nil {
-				doc = u.Documentation.HTML
+				doc = u.Documentation[0].HTML
 			}
 			checkHasRedistData(readme, doc, bypass)
 		})
@@ -243,6 +250,131 @@ func TestUpsertModule(t *testing.T) {
 	checkModule(ctx, t, m)
 }
 
+func TestUpsertModuleBuildContexts(t *testing.T) {
+	defer ResetTestDB(testDB, t)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	m := sample.Module("upsert.org", "v1.2.3", "p")
+	var u *internal.Unit
+	for _, u = range m.Units {
+		if u.Path == "upsert.org/p" {
+			break
+		}
+	}
+	darwin := *u.Documentation[0]
+	darwin.GOOS = "darwin"
+	u.Documentation = append(u.Documentation, &darwin)
+	if err := testDB.InsertModule(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	// Reprocessing finds that the package is the same on every build context.
+	u.Documentation = u.Documentation[:1]
+	if err := testDB.InsertModule(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	if err := testDB.db.RunQuery(ctx, `
+		SELECT d.goos || '/' || d.goarch
+		FROM documentation d
+		INNER JOIN paths p ON p.id = d.path_id
+		WHERE p.path = $1`, func(rows *sql.Rows) error {
+		var bc string
+		if err := rows.Scan(&bc); err != nil {
+			return err
+		}
+		got = append(got, bc)
+		return nil
+	}, u.Path); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{sample.GOOS + "/" + sample.GOARCH}
+	if !cmp.Equal(got, want) {
+		t.Errorf("got build contexts %v, want %v", got, want)
+	}
+}
+
+func TestInsertModuleConcurrent(t *testing.T) {
+	// Two workers can process the same module version at the same time, for
+	// example after a task is redelivered. Both insertions should succeed and
+	// leave one copy of the module, and a clean version state.
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout*2)
+	defer cancel()
+	defer ResetTestDB(testDB, t)
+
+	const n = 2
+	errc := make(chan error)
+	for i := 0; i < n; i++ {
+		// InsertModule modifies its argument, so give each its own copy.
+		m := sample.Module(sample.ModulePath, sample.VersionString, "a", "b/c")
+		go func() {
+			if err := testDB.InsertModule(ctx, m); err != nil {
+				errc <- err
+				return
+			}
+			errc <- testDB.UpsertModuleVersionState(ctx, m.ModulePath, m.Version, "app", time.Time{},
+				http.StatusOK, m.ModulePath, "", "", "", nil, nil, nil)
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var count int
+	if err := testDB.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM modules WHERE module_path = $1 AND version = $2`,
+		sample.ModulePath, sample.VersionString).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("got %d modules rows, want 1", count)
+	}
+	checkModule(ctx, t, sample.Module(sample.ModulePath, sample.VersionString, "a", "b/c"))
+
+	vs, err := testDB.GetModuleVersionState(ctx, sample.ModulePath, sample.VersionString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vs.Status != http.StatusOK || vs.Error != "" {
+		t.Errorf("version state: got status %d, error %q; want %d, no error", vs.Status, vs.Error, http.StatusOK)
+	}
+
+	// Inserting a different module for the same version is not a no-op.
+	m := sample.Module(sample.ModulePath, sample.VersionString, "a", "b/c")
+	m.LegacyReadmeContents = "new readme"
+	if err := testDB.InsertModule(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	mi, err := testDB.LegacyGetModuleInfo(ctx, sample.ModulePath, sample.VersionString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mi.LegacyReadmeContents != "new readme" {
+		t.Errorf("after changed insert: got README %q, want %q", mi.LegacyReadmeContents, "new readme")
+	}
+
+	// Once the module version is marked to be processed again, inserting the
+	// identical module is not a no-op either.
+	if _, err := testDB.db.Exec(ctx, `UPDATE modules SET commit_time = '2000-01-01' WHERE module_path = $1`, sample.ModulePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.ResetModuleVersionStatesWithPrefix(ctx, sample.ModulePath, AnyStatus, internal.Modver{}, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := testDB.InsertModule(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	mi, err = testDB.LegacyGetModuleInfo(ctx, sample.ModulePath, sample.VersionString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mi.CommitTime.Equal(m.CommitTime) {
+		t.Errorf("after reinsert: got commit time %s, want %s", mi.CommitTime, m.CommitTime)
+	}
+}
+
 func TestInsertModuleErrors(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), testTimeout*2)
 	defer cancel()
@@ -473,7 +605,7 @@ func TestPostgres_NewerAlternative(t *testing.T) {
 	)
 
 	err := testDB.UpsertModuleVersionState(ctx, modulePath, altVersion, "appVersion", time.Now(),
-		derrors.ToStatus(derrors.AlternativeModule), "example.com/mod", derrors.AlternativeModule, nil)
+		derrors.ToStatus(derrors.AlternativeModule), "example.com/mod", "", "", "", derrors.AlternativeModule, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -486,6 +618,42 @@ func TestPostgres_NewerAlternative(t *testing.T) {
 	}
 }
 
+func TestInsertModuleTruncated(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer ResetTestDB(testDB, t)
+
+	const modulePath = "example.com/mod"
+	if err := testDB.InsertModule(ctx, sample.Module(modulePath, sample.VersionString, "a", "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Processing the module again with a lower limit on its packages
+	// replaces it.
+	m := sample.Module(modulePath, sample.VersionString, "a")
+	m.ProcessedPackages = 1
+	m.TotalPackages = 3
+	if err := testDB.InsertModule(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	um, err := testDB.GetUnitMeta(ctx, modulePath+"/a", modulePath, sample.VersionString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if um.ProcessedPackages != 1 || um.TotalPackages != 3 {
+		t.Errorf("got %d of %d packages processed, want 1 of 3", um.ProcessedPackages, um.TotalPackages)
+	}
+	for _, suffix := range []string{"b", "c"} {
+		pkgPath := modulePath + "/" + suffix
+		if _, err := testDB.GetUnitMeta(ctx, pkgPath, modulePath, sample.VersionString); !errors.Is(err, derrors.NotFound) {
+			t.Errorf("GetUnitMeta(%q): got %v, want NotFound", pkgPath, err)
+		}
+		if _, _, found := GetFromSearchDocuments(ctx, t, testDB, pkgPath); found {
+			t.Errorf("%s is still in search_documents", pkgPath)
+		}
+	}
+}
+
 func TestMakeValidUnicode(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
 	defer cancel()
@@ -573,3 +741,154 @@ func TestLock(t *testing.T) {
 		t.Errorf("got %d, want %d", count, n)
 	}
 }
+
+func TestInsertLargeModuleRoundTrips(t *testing.T) {
+	// Verify that the number of round trips to the database that inserting
+	// a module takes does not grow with the number of its packages.
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout*6)
+	defer cancel()
+	defer ResetTestDB(testDB, t)
+
+	drv := testCountingDriver
+	ddb, err := database.Open("postgres-counting", dbtest.DBConnURI("discovery_postgres_test"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ddb.Close()
+	db := New(ddb)
+
+	const numPackages = 1000
+	m := sample.LargeModule(sample.ModulePath, sample.VersionString, numPackages)
+	start := drv.count()
+	startTime := time.Now()
+	if err := db.InsertModule(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	got := drv.count() - start
+	t.Logf("inserting %d packages took %s and %d round trips", numPackages, time.Since(startTime), got)
+	// Inserting the search document of each package separately alone took
+	// two round trips per package.
+	if max := numPackages / 10; got > max {
+		t.Errorf("got %d round trips, want at most %d", got, max)
+	}
+	checkModule(ctx, t, m)
+}
+
+// testCountingDriver is registered as "postgres-counting".
+var testCountingDriver = &countingDriver{}
+
+func init() {
+	sql.Register("postgres-counting", testCountingDriver)
+}
+
+// countingDriver is a driver.Driver that wraps the Postgres driver and counts
+// the round trips that its connections make to the database.
+type countingDriver struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (d *countingDriver) add(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.n += n
+}
+
+func (d *countingDriver) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.n
+}
+
+func (d *countingDriver) Open(name string) (driver.Conn, error) {
+	c, err := (&pq.Driver{}).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: c, d: d}, nil
+}
+
+// roundTrips returns the number of round trips that the Postgres driver takes
+// to run a query with nargs arguments: one if there are none, and otherwise
+// one to prepare the query and one to execute it.
+func roundTrips(nargs int) int {
+	if nargs == 0 {
+		return 1
+	}
+	return 2
+}
+
+type countingConn struct {
+	driver.Conn
+	d *countingDriver
+}
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.add(1)
+	s, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &countingStmt{Stmt: s, d: c.d, copy: strings.HasPrefix(query, "COPY")}, nil
+}
+
+func (c *countingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.d.add(1)
+	tx, err := c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &countingTx{Tx: tx, d: c.d}, nil
+}
+
+func (c *countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.add(roundTrips(len(args)))
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func (c *countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.add(roundTrips(len(args)))
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+type countingStmt struct {
+	driver.Stmt
+	d    *countingDriver
+	copy bool // a COPY statement
+}
+
+func (s *countingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	// The rows of a COPY are sent without waiting for a response, until the
+	// statement is executed with no arguments to end it.
+	if !s.copy || len(args) == 0 {
+		s.d.add(1)
+	}
+	return s.Stmt.Exec(args)
+}
+
+func (s *countingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.add(1)
+	return s.Stmt.Query(args)
+}
+
+func (s *countingStmt) Close() error {
+	if !s.copy {
+		s.d.add(1)
+	}
+	return s.Stmt.Close()
+}
+
+type countingTx struct {
+	driver.Tx
+	d *countingDriver
+}
+
+func (tx *countingTx) Commit() error {
+	tx.d.add(1)
+	return tx.Tx.Commit()
+}
+
+func (tx *countingTx) Rollback() error {
+	tx.d.add(1)
+	return tx.Tx.Rollback()
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/database"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// GetLatestModuleVersions returns the row of the latest_module_versions table
+// for modulePath. It returns an error wrapping derrors.NotFound if there is
+// none.
+func (db *DB) GetLatestModuleVersions(ctx context.Context, modulePath string) (_ *internal.LatestModuleVersions, err error) {
+	defer derrors.Wrap(&err, "DB.GetLatestModuleVersions(ctx, %q)", modulePath)
+	return getLatestModuleVersions(ctx, db.db, modulePath)
+}
+
+func getLatestModuleVersions(ctx context.Context, db *database.DB, modulePath string) (*internal.LatestModuleVersions, error) {
+	lmv := &internal.LatestModuleVersions{ModulePath: modulePath}
+	err := db.QueryRow(ctx, `
+		SELECT raw_version, good_version, retractions, deprecation
+		FROM latest_module_versions
+		WHERE module_path = $1`, modulePath).Scan(
+		&lmv.RawVersion, &lmv.GoodVersion, jsonbScanner{&lmv.Retractions}, &lmv.Deprecation)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, derrors.NotFound
+	case nil:
+		return lmv, nil
+	default:
+		return nil, err
+	}
+}
+
+// UpdateLatestModuleVersions upserts lmv into the latest_module_versions
+// table, and marks the versions of the module in the modules table that the
+// retractions of lmv cover as retracted, and the others as not. It also
+// records whether the module is deprecated in its search documents.
+func (db *DB) UpdateLatestModuleVersions(ctx context.Context, lmv *internal.LatestModuleVersions) (err error) {
+	defer derrors.Wrap(&err, "DB.UpdateLatestModuleVersions(ctx, %q)", lmv.ModulePath)
+
+	retractions := lmv.Retractions
+	if retractions == nil {
+		retractions = []internal.RetractedVersion{}
+	}
+	retractionsJSON, err := json.Marshal(retractions)
+	if err != nil {
+		return err
+	}
+	return db.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO latest_module_versions (module_path, raw_version, good_version, retractions, deprecation)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (module_path)
+			DO UPDATE SET
+				raw_version=excluded.raw_version,
+				good_version=excluded.good_version,
+				retractions=excluded.retractions,
+				deprecation=excluded.deprecation`,
+			lmv.ModulePath, lmv.RawVersion, lmv.GoodVersion, retractionsJSON, lmv.Deprecation); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE search_documents
+			SET deprecated = $2
+			WHERE module_path = $1 AND deprecated != $2`,
+			lmv.ModulePath, lmv.Deprecation != ""); err != nil {
+			return err
+		}
+
+		type moduleRow struct {
+			id        int64
+			version   string
+			retracted bool
+			rationale string
+		}
+		var rows []moduleRow
+		err := tx.RunQuery(ctx, `
+			SELECT id, version, retracted, retraction_rationale
+			FROM modules
+			WHERE module_path = $1`, func(rs *sql.Rows) error {
+			var r moduleRow
+			if err := rs.Scan(&r.id, &r.version, &r.retracted, &r.rationale); err != nil {
+				return err
+			}
+			rows = append(rows, r)
+			return nil
+		}, lmv.ModulePath)
+		if err != nil {
+			return err
+		}
+		for _, r := range rows {
+			rv, retracted := lmv.Retraction(r.version)
+			if retracted == r.retracted && rv.Rationale == r.rationale {
+				continue
+			}
+			if _, err := tx.Exec(ctx, `
+				UPDATE modules
+				SET retracted = $2, retraction_rationale = $3
+				WHERE id = $1`, r.id, retracted, rv.Rationale); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
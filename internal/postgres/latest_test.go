@@ -0,0 +1,198 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/testing/sample"
+)
+
+func TestLatestModuleVersions(t *testing.T) {
+	defer ResetTestDB(testDB, t)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	const modulePath = "example.com/retract"
+	for _, v := range []string{"v1.0.0", "v1.1.0", "v1.1.1", "v1.2.0"} {
+		if err := testDB.InsertModule(ctx, sample.Module(modulePath, v, "")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := testDB.GetLatestModuleVersions(ctx, modulePath); !errors.Is(err, derrors.NotFound) {
+		t.Fatalf("GetLatestModuleVersions before update: got %v, want NotFound", err)
+	}
+
+	check := func(lmv *internal.LatestModuleVersions, wantRetracted map[string]string) {
+		t.Helper()
+		if err := testDB.UpdateLatestModuleVersions(ctx, lmv); err != nil {
+			t.Fatal(err)
+		}
+		got, err := testDB.GetLatestModuleVersions(ctx, modulePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(lmv, got); diff != "" {
+			t.Errorf("GetLatestModuleVersions mismatch (-want +got):\n%s", diff)
+		}
+		versions, err := testDB.GetVersionsForPath(ctx, modulePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotRetracted := map[string]string{}
+		for _, mi := range versions {
+			if mi.Retracted {
+				gotRetracted[mi.Version] = mi.RetractionRationale
+			}
+		}
+		if diff := cmp.Diff(wantRetracted, gotRetracted); diff != "" {
+			t.Errorf("retracted versions mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	// v1.2.0 retracts itself and the v1.1.x versions, so the latest
+	// version of the module falls back to v1.0.0.
+	check(&internal.LatestModuleVersions{
+		ModulePath:  modulePath,
+		RawVersion:  "v1.2.0",
+		GoodVersion: "v1.0.0",
+		Retractions: []internal.RetractedVersion{
+			{Version: "v1.1.0", High: "v1.1.9", Rationale: "Broken."},
+			{Version: "v1.2.0"},
+		},
+	}, map[string]string{"v1.1.0": "Broken.", "v1.1.1": "Broken.", "v1.2.0": ""})
+	um, err := testDB.GetUnitMeta(ctx, modulePath, internal.UnknownModulePath, internal.LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if um.Version != "v1.0.0" {
+		t.Errorf("GetUnitMeta(%q, latest): got version %q, want v1.0.0", modulePath, um.Version)
+	}
+
+	if um.Deprecation != "" {
+		t.Errorf("GetUnitMeta(%q, latest): got deprecation %q, want none", modulePath, um.Deprecation)
+	}
+
+	// A later update that retracts less unmarks the versions.
+	const deprecation = "use example.com/new instead."
+	check(&internal.LatestModuleVersions{
+		ModulePath:  modulePath,
+		RawVersion:  "v1.2.0",
+		GoodVersion: "v1.2.0",
+		Retractions: []internal.RetractedVersion{{Version: "v1.1.0"}},
+		Deprecation: deprecation,
+	}, map[string]string{"v1.1.0": ""})
+	um, err = testDB.GetUnitMeta(ctx, modulePath, internal.UnknownModulePath, internal.LatestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if um.Version != "v1.2.0" || um.Deprecation != deprecation {
+		t.Errorf("GetUnitMeta(%q, latest): got version %q, deprecation %q; want v1.2.0, %q",
+			modulePath, um.Version, um.Deprecation, deprecation)
+	}
+}
+
+func TestLatestVersionRetractions(t *testing.T) {
+	const modulePath = "example.com/retract"
+	for _, test := range []struct {
+		name          string
+		before, after []string // versions inserted before and after the update
+		lmv           *internal.LatestModuleVersions
+		wantVersion   string
+		wantRetracted bool
+	}{
+		{
+			name:   "range",
+			before: []string{"v1.0.0", "v1.1.0", "v1.1.5", "v1.2.0"},
+			lmv: &internal.LatestModuleVersions{
+				RawVersion:  "v1.2.0",
+				Retractions: []internal.RetractedVersion{{Version: "v1.1.0", High: "v1.2.0"}},
+			},
+			wantVersion: "v1.0.0",
+		},
+		{
+			name:   "self-retraction",
+			before: []string{"v1.0.0", "v1.1.0"},
+			lmv: &internal.LatestModuleVersions{
+				RawVersion:  "v1.1.0",
+				Retractions: []internal.RetractedVersion{{Version: "v1.1.0"}},
+			},
+			wantVersion: "v1.0.0",
+		},
+		{
+			name:   "incompatible",
+			before: []string{"v1.0.0", "v2.0.0+incompatible"},
+			lmv: &internal.LatestModuleVersions{
+				RawVersion:  "v2.0.0+incompatible",
+				Retractions: []internal.RetractedVersion{{Version: "v1.0.0"}},
+			},
+			wantVersion: "v2.0.0+incompatible",
+		},
+		{
+			name:   "retracted incompatible",
+			before: []string{"v2.0.0+incompatible", "v2.1.0+incompatible"},
+			lmv: &internal.LatestModuleVersions{
+				RawVersion:  "v2.1.0+incompatible",
+				Retractions: []internal.RetractedVersion{{Version: "v2.1.0+incompatible"}},
+			},
+			wantVersion: "v2.0.0+incompatible",
+		},
+		{
+			name:   "inserted after update",
+			before: []string{"v1.0.0"},
+			after:  []string{"v1.1.0"},
+			lmv: &internal.LatestModuleVersions{
+				RawVersion:  "v1.1.0",
+				Retractions: []internal.RetractedVersion{{Version: "v1.1.0"}},
+			},
+			wantVersion: "v1.0.0",
+		},
+		{
+			name:   "all retracted",
+			before: []string{"v1.0.0", "v1.1.0"},
+			lmv: &internal.LatestModuleVersions{
+				RawVersion:  "v1.1.0",
+				Retractions: []internal.RetractedVersion{{Version: "v1.0.0", High: "v1.1.0"}},
+			},
+			wantVersion:   "v1.1.0",
+			wantRetracted: true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			defer ResetTestDB(testDB, t)
+			ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+			defer cancel()
+
+			insert := func(versions []string) {
+				for _, v := range versions {
+					if err := testDB.InsertModule(ctx, sample.Module(modulePath, v, "")); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			insert(test.before)
+			test.lmv.ModulePath = modulePath
+			test.lmv.GoodVersion = test.wantVersion
+			if err := testDB.UpdateLatestModuleVersions(ctx, test.lmv); err != nil {
+				t.Fatal(err)
+			}
+			insert(test.after)
+
+			um, err := testDB.GetUnitMeta(ctx, modulePath, internal.UnknownModulePath, internal.LatestVersion)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if um.Version != test.wantVersion || um.Retracted != test.wantRetracted {
+				t.Errorf("GetUnitMeta(%q, latest): got version %q, retracted %t; want %q, %t",
+					modulePath, um.Version, um.Retracted, test.wantVersion, test.wantRetracted)
+			}
+		})
+	}
+}
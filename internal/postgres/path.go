@@ -20,7 +20,9 @@ const orderByLatest = `
 			ORDER BY
 				-- Order the versions by release then prerelease.
 				-- The default version should be the first release
-				-- version available, if one exists.
+				-- version available, if one exists. Versions that are
+				-- retracted come after all others.
+				m.retracted,
 				m.incompatible,
 				m.version_type = 'release' DESC,
 				m.sort_version DESC,
@@ -68,12 +70,22 @@ func (db *DB) GetUnitMeta(ctx context.Context, path, requestedModulePath, reques
 		    m.version,
 		    m.commit_time,
 		    m.source_info,
+		    m.has_security_policy,
+		    m.processed_packages,
+		    m.total_packages,
+		    m.go_version,
+		    m.toolchain,
+		    m.checksum_status,
+		    m.retracted,
+		    m.retraction_rationale,
+		    COALESCE(l.deprecation, ''),
 		    p.name,
 		    p.redistributable,
 		    p.license_types,
 		    p.license_paths
 		FROM paths p
 		INNER JOIN modules m ON (p.module_id = m.id)
+		LEFT JOIN latest_module_versions l ON (l.module_path = m.module_path)
 		%s
 		WHERE p.path = $1
 		%s
@@ -85,6 +97,15 @@ func (db *DB) GetUnitMeta(ctx context.Context, path, requestedModulePath, reques
 		&um.Version,
 		&um.CommitTime,
 		jsonbScanner{&um.SourceInfo},
+		&um.HasSecurityPolicy,
+		&um.ProcessedPackages,
+		&um.TotalPackages,
+		&um.GoVersion,
+		&um.Toolchain,
+		&um.ChecksumStatus,
+		&um.Retracted,
+		&um.RetractionRationale,
+		&um.Deprecation,
 		&um.Name,
 		&um.IsRedistributable,
 		pq.Array(&licenseTypes),
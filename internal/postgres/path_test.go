@@ -63,7 +63,7 @@ func TestGetUnitMeta(t *testing.T) {
 			}
 			if d == pkgPath {
 				dir.Name = pkgName
-				dir.Documentation = &internal.Documentation{}
+				dir.Documentation = []*internal.Documentation{{}}
 			}
 			sample.AddUnit(m, dir)
 		}
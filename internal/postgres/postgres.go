@@ -7,24 +7,27 @@
 package postgres
 
 import (
+	"golang.org/x/pkgsite/internal/config"
 	"golang.org/x/pkgsite/internal/database"
 )
 
 type DB struct {
 	db                 *database.DB
 	bypassLicenseCheck bool
+	docCodec           *codec // nil if documentation is not compressed
+	searchRanking      config.SearchRankingSettings // see SetSearchRanking
 }
 
 // New returns a new postgres DB.
 func New(db *database.DB) *DB {
-	return &DB{db, false}
+	return &DB{db: db}
 }
 
 // NewBypassingLicenseCheck returns a new postgres DB that bypasses license
 // checks. That means all data will be inserted and returned for
 // non-redistributable modules, packages and directories.
 func NewBypassingLicenseCheck(db *database.DB) *DB {
-	return &DB{db, true}
+	return &DB{db: db, bypassLicenseCheck: true}
 }
 
 // Close closes a DB.
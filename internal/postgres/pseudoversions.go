@@ -0,0 +1,145 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"golang.org/x/pkgsite/internal/database"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/log"
+)
+
+// DeletePseudoVersionsExcept deletes all but the keep highest pseudo-versions
+// of the module with modulePath, and returns the versions that it deleted.
+//
+// It never deletes release or prerelease versions, the version that is shown
+// as the latest version of the module, or the raw and good versions of the
+// module in the latest_module_versions table. It returns an error wrapping
+// derrors.NotFound if the module has no versions.
+//
+// Deleting the modules rows of the versions deletes their units,
+// documentation, imports and licenses through ON DELETE CASCADE constraints.
+// Their search documents are deleted too. Their version_map and
+// module_version_states rows are kept, with the status and error code of
+// derrors.PseudoVersionDeleted, so that it is clear why the versions are
+// missing, and so that they are not reprocessed.
+func (db *DB) DeletePseudoVersionsExcept(ctx context.Context, modulePath string, keep int) (deleted []string, err error) {
+	defer derrors.Wrap(&err, "DeletePseudoVersionsExcept(ctx, %q, %d)", modulePath, keep)
+
+	if keep < 0 {
+		return nil, fmt.Errorf("keep cannot be negative: %w", derrors.InvalidArgument)
+	}
+	err = db.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		// Hold the same lock as InsertModule, so that the latest version
+		// cannot change while we decide what to delete.
+		if err := lock(ctx, tx, modulePath); err != nil {
+			return err
+		}
+		protected, err := protectedVersions(ctx, tx, modulePath)
+		if err != nil {
+			return err
+		}
+		n := 0
+		err = tx.RunQuery(ctx, `
+			SELECT version
+			FROM modules
+			WHERE module_path = $1 AND version_type = 'pseudo'
+			ORDER BY sort_version DESC`,
+			func(rows *sql.Rows) error {
+				var v string
+				if err := rows.Scan(&v); err != nil {
+					return err
+				}
+				if n >= keep && !protected[v] {
+					deleted = append(deleted, v)
+				}
+				n++
+				return nil
+			}, modulePath)
+		if err != nil {
+			return err
+		}
+		if len(deleted) == 0 {
+			return nil
+		}
+		return deleteModuleVersions(ctx, tx, modulePath, deleted,
+			fmt.Errorf("not among the %d highest pseudo-versions of the module: %w", keep, derrors.PseudoVersionDeleted))
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof(ctx, "deleted %d pseudo-versions of %s", len(deleted), modulePath)
+	return deleted, nil
+}
+
+// protectedVersions returns the versions of the module with modulePath that
+// must not be deleted: the one shown as its latest version, and the ones in
+// its row of latest_module_versions, if there is one.
+func protectedVersions(ctx context.Context, tx *database.DB, modulePath string) (map[string]bool, error) {
+	var latest string
+	err := tx.QueryRow(ctx, fmt.Sprintf(`
+		SELECT version FROM modules m WHERE m.module_path = $1
+		%s
+		LIMIT 1`, orderByLatest), modulePath).Scan(&latest)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, derrors.NotFound
+	case nil:
+	default:
+		return nil, err
+	}
+	protected := map[string]bool{latest: true}
+
+	var raw, good string
+	err = tx.QueryRow(ctx, `
+		SELECT raw_version, good_version
+		FROM latest_module_versions
+		WHERE module_path = $1`, modulePath).Scan(&raw, &good)
+	switch err {
+	case sql.ErrNoRows:
+	case nil:
+		protected[raw] = true
+		protected[good] = true
+	default:
+		return nil, err
+	}
+	return protected, nil
+}
+
+// deleteModuleVersions deletes the given versions of the module with
+// modulePath, and their search documents. It marks their version_map and
+// module_version_states rows with the status, error and error code of reason.
+func deleteModuleVersions(ctx context.Context, tx *database.DB, modulePath string, versions []string, reason error) error {
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM modules
+		WHERE module_path = $1 AND version = ANY($2)`,
+		modulePath, pq.Array(versions)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM search_documents
+		WHERE module_path = $1 AND version = ANY($2)`,
+		modulePath, pq.Array(versions)); err != nil {
+		return err
+	}
+	status, msg, code := derrors.ToStatus(reason), reason.Error(), derrors.ToCode(reason)
+	if _, err := tx.Exec(ctx, `
+		UPDATE version_map
+		SET status = $3, error = $4, error_code = $5, module_id = NULL
+		WHERE module_path = $1 AND resolved_version = ANY($2)`,
+		modulePath, pq.Array(versions), status, msg, code); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+		UPDATE module_version_states
+		SET status = $3, error = $4, error_code = $5
+		WHERE module_path = $1 AND version = ANY($2)`,
+		modulePath, pq.Array(versions), status, msg, code)
+	return err
+}
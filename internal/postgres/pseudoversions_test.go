@@ -0,0 +1,139 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/testing/sample"
+)
+
+func TestDeletePseudoVersionsExcept(t *testing.T) {
+	const (
+		modulePath = "example.com/pseudo"
+		release    = "v1.0.0"
+		pseudo1    = "v1.0.1-0.20200101000000-aaaaaaaaaaaa"
+		pseudo2    = "v1.0.1-0.20200102000000-bbbbbbbbbbbb"
+		pseudo3    = "v1.0.1-0.20200103000000-cccccccccccc"
+	)
+	for _, test := range []struct {
+		name        string
+		versions    []string
+		lmvVersion  string // raw and good version in latest_module_versions, if not empty
+		keep        int
+		wantDeleted []string
+	}{
+		{
+			name:        "keep one",
+			versions:    []string{release, pseudo1, pseudo2, pseudo3},
+			keep:        1,
+			wantDeleted: []string{pseudo2, pseudo1},
+		},
+		{
+			name:        "keep more than there are",
+			versions:    []string{release, pseudo1, pseudo2, pseudo3},
+			keep:        5,
+			wantDeleted: nil,
+		},
+		{
+			name:        "latest pseudo-version is kept",
+			versions:    []string{pseudo1, pseudo2, pseudo3},
+			keep:        0,
+			wantDeleted: []string{pseudo2, pseudo1},
+		},
+		{
+			name:        "latest_module_versions is kept",
+			versions:    []string{release, pseudo1, pseudo2, pseudo3},
+			lmvVersion:  pseudo2,
+			keep:        0,
+			wantDeleted: []string{pseudo3, pseudo1},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+			defer cancel()
+			defer ResetTestDB(testDB, t)
+
+			for _, v := range test.versions {
+				if err := testDB.InsertModule(ctx, sample.Module(modulePath, v, "p")); err != nil {
+					t.Fatal(err)
+				}
+				if err := testDB.UpsertVersionMap(ctx, &internal.VersionMap{
+					ModulePath:       modulePath,
+					RequestedVersion: v,
+					ResolvedVersion:  v,
+					GoModPath:        modulePath,
+					Status:           http.StatusOK,
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.lmvVersion != "" {
+				if err := testDB.UpdateLatestModuleVersions(ctx, &internal.LatestModuleVersions{
+					ModulePath:  modulePath,
+					RawVersion:  test.lmvVersion,
+					GoodVersion: test.lmvVersion,
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := testDB.DeletePseudoVersionsExcept(ctx, modulePath, test.keep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(test.wantDeleted, got); diff != "" {
+				t.Errorf("deleted mismatch (-want, +got):\n%s", diff)
+			}
+
+			deleted := map[string]bool{}
+			for _, v := range test.wantDeleted {
+				deleted[v] = true
+			}
+			for _, v := range test.versions {
+				_, err := testDB.GetModuleInfo(ctx, modulePath, v)
+				vm, vmErr := testDB.GetVersionMap(ctx, modulePath, v)
+				if vmErr != nil {
+					t.Fatal(vmErr)
+				}
+				if deleted[v] {
+					if !errors.Is(err, derrors.NotFound) {
+						t.Errorf("%s: GetModuleInfo: got %v, want NotFound", v, err)
+					}
+					if vm.Status != http.StatusNotFound || vm.ErrorCode != derrors.CodePseudoVersionDeleted {
+						t.Errorf("%s: version_map status, code = %d, %q; want %d, %q",
+							v, vm.Status, vm.ErrorCode, http.StatusNotFound, derrors.CodePseudoVersionDeleted)
+					}
+				} else {
+					if err != nil {
+						t.Errorf("%s: GetModuleInfo: %v", v, err)
+					}
+					if vm.Status != http.StatusOK {
+						t.Errorf("%s: version_map status = %d, want %d", v, vm.Status, http.StatusOK)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDeletePseudoVersionsExceptErrors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer ResetTestDB(testDB, t)
+
+	if _, err := testDB.DeletePseudoVersionsExcept(ctx, "example.com/unknown", 1); !errors.Is(err, derrors.NotFound) {
+		t.Errorf("unknown module: got %v, want NotFound", err)
+	}
+	if _, err := testDB.DeletePseudoVersionsExcept(ctx, "example.com/unknown", -1); !errors.Is(err, derrors.InvalidArgument) {
+		t.Errorf("negative keep: got %v, want InvalidArgument", err)
+	}
+}
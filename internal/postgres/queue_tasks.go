@@ -0,0 +1,76 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// A QueueTask is a pending task of a local queue, as stored in the
+// queue_tasks table.
+type QueueTask struct {
+	ModulePath string
+	Version    string
+	Suffix     string
+	// Attempts is the number of times the task has been tried and failed
+	// with an error that is retried.
+	Attempts int
+	// Priority is the queue.Priority of the task.
+	Priority int
+}
+
+// PutQueueTask records t as a pending task of the queue with the given name,
+// replacing its number of attempts and priority if it is already recorded.
+func (db *DB) PutQueueTask(ctx context.Context, queueName string, t *QueueTask) (err error) {
+	defer derrors.Wrap(&err, "PutQueueTask(ctx, %q, %s@%s)", queueName, t.ModulePath, t.Version)
+
+	_, err = db.db.Exec(ctx, `
+		INSERT INTO queue_tasks (queue_name, module_path, version, suffix, attempts, priority)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (queue_name, module_path, version, suffix)
+		DO UPDATE SET attempts = excluded.attempts, priority = excluded.priority`,
+		queueName, t.ModulePath, t.Version, t.Suffix, t.Attempts, t.Priority)
+	return err
+}
+
+// DeleteQueueTask deletes t from the pending tasks of the queue with the
+// given name. It is not an error if t is not there.
+func (db *DB) DeleteQueueTask(ctx context.Context, queueName string, t *QueueTask) (err error) {
+	defer derrors.Wrap(&err, "DeleteQueueTask(ctx, %q, %s@%s)", queueName, t.ModulePath, t.Version)
+
+	_, err = db.db.Exec(ctx, `
+		DELETE FROM queue_tasks
+		WHERE queue_name = $1 AND module_path = $2 AND version = $3 AND suffix = $4`,
+		queueName, t.ModulePath, t.Version, t.Suffix)
+	return err
+}
+
+// GetQueueTasks returns the pending tasks of the queue with the given name,
+// oldest first.
+func (db *DB) GetQueueTasks(ctx context.Context, queueName string) (_ []*QueueTask, err error) {
+	defer derrors.Wrap(&err, "GetQueueTasks(ctx, %q)", queueName)
+
+	var tasks []*QueueTask
+	query := `
+		SELECT module_path, version, suffix, attempts, priority
+		FROM queue_tasks
+		WHERE queue_name = $1
+		ORDER BY created_at, module_path, version, suffix`
+	err = db.db.RunQuery(ctx, query, func(rows *sql.Rows) error {
+		var t QueueTask
+		if err := rows.Scan(&t.ModulePath, &t.Version, &t.Suffix, &t.Attempts, &t.Priority); err != nil {
+			return err
+		}
+		tasks = append(tasks, &t)
+		return nil
+	}, queueName)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
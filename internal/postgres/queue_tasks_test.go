@@ -0,0 +1,60 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestQueueTasks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer func() {
+		if _, err := testDB.db.Exec(ctx, `TRUNCATE queue_tasks`); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	a := &QueueTask{ModulePath: "example.com/a", Version: "v1.0.0", Priority: 1}
+	b := &QueueTask{ModulePath: "example.com/b", Version: "v1.2.0", Suffix: "x"}
+	other := &QueueTask{ModulePath: "example.com/c", Version: "v1.0.0"}
+	for _, task := range []*QueueTask{a, b} {
+		if err := testDB.PutQueueTask(ctx, "q", task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := testDB.PutQueueTask(ctx, "other", other); err != nil {
+		t.Fatal(err)
+	}
+	// Putting a task again updates its attempts and priority.
+	b.Attempts = 2
+	b.Priority = 1
+	if err := testDB.PutQueueTask(ctx, "q", b); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(want []*QueueTask) {
+		t.Helper()
+		got, err := testDB.GetQueueTasks(ctx, "q")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	}
+	check([]*QueueTask{a, b})
+	if err := testDB.DeleteQueueTask(ctx, "q", a); err != nil {
+		t.Fatal(err)
+	}
+	check([]*QueueTask{b})
+	// Deleting a missing task is not an error.
+	if err := testDB.DeleteQueueTask(ctx, "q", a); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/config"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/experiment"
+)
+
+// pseudoVersionPattern is a regular expression, in the syntax of both Go and
+// Postgres, that matches pseudo-versions. It must match the one in the
+// popular_search function.
+const pseudoVersionPattern = `[-.][0-9]{14}-[0-9a-f]{12}(\+incompatible)?$`
+
+// secondsPerYear is the number of seconds in a year, on average.
+const secondsPerYear = 31557600
+
+// SetSearchRanking sets the weights of the parts of the search score that
+// are used for requests in the search-freshness experiment. The weights
+// cannot raise the score of a package, since the popular searcher relies on
+// the score being at most the log of the package's popularity.
+func (db *DB) SetSearchRanking(r config.SearchRankingSettings) (err error) {
+	defer derrors.Wrap(&err, "SetSearchRanking(%+v)", r)
+
+	if r.FreshnessWeight < 0 {
+		return fmt.Errorf("negative freshness weight: %w", derrors.InvalidArgument)
+	}
+	if r.StalePseudoVersionPenalty < 0 || r.StalePseudoVersionPenalty > 1 {
+		return fmt.Errorf("stale pseudo-version penalty not between 0 and 1: %w", derrors.InvalidArgument)
+	}
+	if r.StalePseudoVersionAge < 0 {
+		return fmt.Errorf("negative stale pseudo-version age: %w", derrors.InvalidArgument)
+	}
+	db.searchRanking = r
+	return nil
+}
+
+// rankingFor returns the search ranking weights for ctx: those set with
+// SetSearchRanking if the search-freshness experiment is active, and ones
+// that leave scores unchanged otherwise.
+func (db *DB) rankingFor(ctx context.Context) config.SearchRankingSettings {
+	if experiment.IsActive(ctx, internal.ExperimentSearchFreshness) {
+		return db.searchRanking
+	}
+	return config.SearchRankingSettings{}
+}
+
+// rankedScoreExpr returns scoreExpr, an expression for the search score of a
+// row of search_documents, multiplied by the factors that r adds to it:
+//   - 1 / (1 + FreshnessWeight * ln(1 + age)), where age is the age of the
+//     version in years. Taking the log makes the decay gentle: a package
+//     released ten years ago scores about half as well as one released a
+//     year ago with the default weight, not a tenth.
+//   - StalePseudoVersionPenalty, if the version is a pseudo-version older
+//     than StalePseudoVersionAge. Modules whose latest version is such a
+//     pseudo-version are likely to be unmaintained.
+//
+// If r adds no factors, scoreExpr is returned unchanged.
+func rankedScoreExpr(scoreExpr string, r config.SearchRankingSettings) string {
+	var factors []string
+	if r.FreshnessWeight != 0 {
+		factors = append(factors, fmt.Sprintf(
+			"1 / (1 + %f * ln(1 + GREATEST(EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - commit_time), 0) / %d))",
+			r.FreshnessWeight, secondsPerYear))
+	}
+	if r.StalePseudoVersionAge != 0 {
+		factors = append(factors, fmt.Sprintf(
+			"CASE WHEN version ~ '%s' AND commit_time < CURRENT_TIMESTAMP - interval '%d seconds' THEN %f ELSE 1 END",
+			pseudoVersionPattern, int64(r.StalePseudoVersionAge.Seconds()), r.StalePseudoVersionPenalty))
+	}
+	if len(factors) == 0 {
+		return scoreExpr
+	}
+	return fmt.Sprintf("(%s) * %s", scoreExpr, strings.Join(factors, " * "))
+}
+
+// popularSearchRankingArgs returns the arguments of the popular_search
+// function that correspond to r.
+func popularSearchRankingArgs(r config.SearchRankingSettings) []interface{} {
+	return []interface{}{
+		r.FreshnessWeight,
+		r.StalePseudoVersionPenalty,
+		fmt.Sprintf("%d seconds", int64(r.StalePseudoVersionAge.Seconds())),
+	}
+}
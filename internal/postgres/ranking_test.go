@@ -0,0 +1,161 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/config"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/experiment"
+	"golang.org/x/pkgsite/internal/testing/sample"
+	"golang.org/x/pkgsite/internal/version"
+)
+
+func TestPseudoVersionPattern(t *testing.T) {
+	re := regexp.MustCompile(pseudoVersionPattern)
+	for _, v := range []string{
+		"v0.0.0-20190124233150-8f9f8e9b1c7e",
+		"v1.2.4-0.20191109021931-daa7c04131f5",
+		"v1.2.4-pre.0.20191109021931-daa7c04131f5",
+		"v2.0.1-0.20191109021931-daa7c04131f5+incompatible",
+		"v1.0.0",
+		"v1.2.3-pre",
+		"v2.0.0+incompatible",
+	} {
+		if got, want := re.MatchString(v), version.IsPseudo(v); got != want {
+			t.Errorf("%s: matches pattern = %t, want %t", v, got, want)
+		}
+	}
+}
+
+func TestSetSearchRanking(t *testing.T) {
+	db := &DB{}
+	for _, r := range []config.SearchRankingSettings{
+		{FreshnessWeight: -1},
+		{StalePseudoVersionPenalty: 2},
+		{StalePseudoVersionAge: -time.Hour},
+	} {
+		if err := db.SetSearchRanking(r); !errors.Is(err, derrors.InvalidArgument) {
+			t.Errorf("SetSearchRanking(%+v): got %v, want InvalidArgument", r, err)
+		}
+	}
+	if err := db.SetSearchRanking(config.SearchRankingSettings{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rankedScoreExpr(scoreExpr, db.searchRanking), scoreExpr; got != want {
+		t.Errorf("with zero weights, rankedScoreExpr changed the score:\n%s", got)
+	}
+}
+
+// TestSearchRanking checks the order of the results of a few queries on a
+// small corpus, with and without the search-freshness experiment.
+func TestSearchRanking(t *testing.T) {
+	defer ResetTestDB(testDB, t)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	if err := testDB.SetSearchRanking(config.SearchRankingSettings{
+		FreshnessWeight:           0.25,
+		StalePseudoVersionPenalty: 0.5,
+		StalePseudoVersionAge:     2 * 365 * 24 * time.Hour,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.SetSearchRanking(config.SearchRankingSettings{})
+
+	now := time.Now()
+	for _, m := range []struct {
+		path       string
+		version    string
+		commitTime time.Time
+		importedBy int
+		deprecated bool
+	}{
+		// An old, very popular release.
+		{"old.com/yaml", "v1.0.0", time.Date(2012, 1, 1, 0, 0, 0, 0, time.UTC), 100, false},
+		// A new, less popular release.
+		{"new.com/yaml", "v1.0.0", now.AddDate(0, -1, 0), 60, false},
+		// A years-old pseudo-version.
+		{"stale.com/yaml", "v0.0.0-20150101000000-abcdefabcdef", time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC), 80, false},
+		// A new, popular release of a deprecated module.
+		{"deprecated.com/yaml", "v1.0.0", now.AddDate(0, -1, 0), 150, true},
+
+		{"old.com/errors", "v1.0.0", time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC), 1000, false},
+		{"new.com/errors", "v1.0.0", now.AddDate(0, -2, 0), 200, false},
+	} {
+		if err := testDB.InsertModule(ctx, sample.Module(m.path, m.version, "")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := testDB.db.Exec(ctx, `
+			UPDATE search_documents
+			SET commit_time = $2, imported_by_count = $3
+			WHERE module_path = $1`, m.path, m.commitTime, m.importedBy); err != nil {
+			t.Fatal(err)
+		}
+		if m.deprecated {
+			if err := testDB.UpdateLatestModuleVersions(ctx, &internal.LatestModuleVersions{
+				ModulePath:  m.path,
+				RawVersion:  m.version,
+				GoodVersion: m.version,
+				Deprecation: "use something else",
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		q                   string
+		wantControl         []string
+		wantSearchFreshness []string
+	}{
+		{
+			q: "yaml",
+			// Without the experiment, popularity wins, but deprecation is
+			// penalized.
+			wantControl: []string{"old.com/yaml", "stale.com/yaml", "new.com/yaml", "deprecated.com/yaml"},
+			// With it, the new release beats the old one, and the stale
+			// pseudo-version falls to the bottom.
+			wantSearchFreshness: []string{"new.com/yaml", "old.com/yaml", "deprecated.com/yaml", "stale.com/yaml"},
+		},
+		{
+			q:                   "errors",
+			wantControl:         []string{"old.com/errors", "new.com/errors"},
+			wantSearchFreshness: []string{"new.com/errors", "old.com/errors"},
+		},
+	} {
+		for _, exp := range []struct {
+			name string
+			ctx  context.Context
+			want []string
+		}{
+			{"control", ctx, test.wantControl},
+			{internal.ExperimentSearchFreshness, experiment.NewContext(ctx, internal.ExperimentSearchFreshness), test.wantSearchFreshness},
+		} {
+			for method, searcher := range searchers {
+				t.Run(test.q+"/"+exp.name+"/"+method, func(t *testing.T) {
+					res := searcher(testDB, exp.ctx, test.q, 10, 0)
+					if res.err != nil {
+						t.Fatal(res.err)
+					}
+					var got []string
+					for _, r := range res.results {
+						got = append(got, r.ModulePath)
+					}
+					if diff := cmp.Diff(exp.want, got); diff != "" {
+						t.Errorf("mismatch (-want +got):\n%s", diff)
+					}
+				})
+			}
+		}
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/derrors"
@@ -33,6 +35,12 @@ func (db *DB) UpdateModuleVersionStatesForReprocessing(ctx context.Context, appV
 	return nil
 }
 
+// notStdSnapshot is a condition on module_version_states that leaves out the
+// snapshots of the standard library at master, whose versions are all
+// pseudo-versions. Only the current head of master can be fetched, so they are
+// neither reprocessed nor requeued.
+const notStdSnapshot = `NOT (module_path = 'std' AND version LIKE 'v0.0.0-%')`
+
 func (db *DB) UpdateModuleVersionStatesWithStatus(ctx context.Context, status int, appVersion string) (err error) {
 	query := `UPDATE module_version_states
 			SET
@@ -41,7 +49,8 @@ func (db *DB) UpdateModuleVersionStatesWithStatus(ctx context.Context, status in
 				last_processed_at = NULL
 			WHERE
 				app_version < $1
-				AND status = $3;`
+				AND status = $3
+				AND `+notStdSnapshot+`;`
 	affected, err := db.db.Exec(ctx, query, appVersion, derrors.ToReprocessStatus(status), status)
 	if err != nil {
 		return err
@@ -52,6 +61,22 @@ func (db *DB) UpdateModuleVersionStatesWithStatus(ctx context.Context, status in
 	return nil
 }
 
+// PostponeNewModuleVersionState makes a module version that has not been
+// processed yet due only after d, so that GetNextModulesToFetch does not return
+// it while a fetch of it that was scheduled on another queue is pending. Task
+// names are unique only within a queue, so the two fetches would not be
+// deduplicated.
+func (db *DB) PostponeNewModuleVersionState(ctx context.Context, modulePath, version string, d time.Duration) (err error) {
+	defer derrors.Wrap(&err, "PostponeNewModuleVersionState(ctx, %q, %q, %s)", modulePath, version, d)
+
+	_, err = db.db.Exec(ctx, `
+		UPDATE module_version_states
+		SET next_processed_after = $3
+		WHERE module_path = $1 AND version = $2 AND status = 0`,
+		modulePath, version, time.Now().Add(d))
+	return err
+}
+
 // largeModulePackageThresold represents the package threshold at which it
 // becomes difficult to process packages. Modules with more than this number
 // of packages are generally different versions or forks of kubernetes,
@@ -147,7 +172,8 @@ const nextModulesToProcessQuery = `
 		FROM module_version_states
 	) s
 	WHERE next_processed_after < CURRENT_TIMESTAMP
-		AND (status = 0 OR status >= 500)
+		-- every retry class but RetryDone; see retryClass
+		AND (status = 0 OR status >= 400)
 	ORDER BY
 		CASE
 			 -- new modules
@@ -190,3 +216,77 @@ const nextModulesToProcessQuery = `
 		version -- for reproducibility
 	LIMIT $2
 `
+
+// AnyStatus is the status argument that makes
+// CountModuleVersionStatesWithPrefix and ResetModuleVersionStatesWithPrefix
+// match rows of module_version_states with any status.
+const AnyStatus = -1
+
+// CountModuleVersionStatesWithPrefix returns the number of rows of
+// module_version_states whose module path is prefix or a path under it and,
+// unless status is AnyStatus, whose status is status. The prefix matches
+// whole path elements, so "a.com/m" does not match "a.com/mm".
+func (db *DB) CountModuleVersionStatesWithPrefix(ctx context.Context, prefix string, status int) (n int, err error) {
+	defer derrors.Wrap(&err, "CountModuleVersionStatesWithPrefix(ctx, %q, %d)", prefix, status)
+
+	query := `
+		SELECT COUNT(*)
+		FROM module_version_states
+		WHERE (module_path = $1 OR module_path LIKE $3)
+			AND ($2 < 0 OR status = $2)
+			AND `+notStdSnapshot
+	prefix = strings.TrimSuffix(prefix, "/")
+	if err := db.db.QueryRow(ctx, query, prefix, status, escapeLikePattern(prefix)+"/%").Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// ResetModuleVersionStatesWithPrefix makes at most limit rows of
+// module_version_states due for processing, and returns their module
+// versions. The rows are those matching prefix and status as for
+// CountModuleVersionStatesWithPrefix that come after the module version
+// after, in order of module path and version. Passing the last module
+// version returned as after pages through all the matching rows.
+//
+// Their last_processed_at is cleared, so that InsertModule inserts them again
+// even if their data is unchanged.
+func (db *DB) ResetModuleVersionStatesWithPrefix(ctx context.Context, prefix string, status int, after internal.Modver, limit int) (mvs []internal.Modver, err error) {
+	defer derrors.Wrap(&err, "ResetModuleVersionStatesWithPrefix(ctx, %q, %d, %q, %d)", prefix, status, after, limit)
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	query := `
+		WITH page AS (
+			SELECT module_path, version
+			FROM module_version_states
+			WHERE (module_path = $1 OR module_path LIKE $6)
+				AND ($2 < 0 OR status = $2)
+				AND `+notStdSnapshot+`
+				AND (module_path, version) > ($3, $4)
+			ORDER BY module_path, version
+			LIMIT $5
+			FOR UPDATE
+		), reset AS (
+			UPDATE module_version_states m
+			SET
+				next_processed_after = CURRENT_TIMESTAMP,
+				last_processed_at = NULL
+			FROM page p
+			WHERE m.module_path = p.module_path AND m.version = p.version
+		)
+		SELECT module_path, version
+		FROM page
+		ORDER BY module_path, version`
+	err = db.db.RunQuery(ctx, query, func(rows *sql.Rows) error {
+		var mv internal.Modver
+		if err := rows.Scan(&mv.Path, &mv.Version); err != nil {
+			return err
+		}
+		mvs = append(mvs, mv)
+		return nil
+	}, prefix, status, after.Path, after.Version, limit, escapeLikePattern(prefix)+"/%")
+	if err != nil {
+		return nil, err
+	}
+	return mvs, nil
+}
@@ -113,7 +113,7 @@ func TestGetNextModulesToFetchAndUpdateModuleVersionStatesForReprocessing(t *tes
 	updateStates := func(wantData []*testData) {
 		for _, m := range wantData {
 			if err := upsertModuleVersionState(ctx, testDB.db, m.modulePath, m.version, "2020-04-29t14", &m.numPackages, now, m.status,
-				m.modulePath, derrors.FromStatus(m.status, "test string")); err != nil {
+				m.modulePath, "", "", "", derrors.FromStatus(m.status, "test string"), nil); err != nil {
 				t.Fatal(err)
 			}
 		}
@@ -130,7 +130,7 @@ func TestGetNextModulesToFetchAndUpdateModuleVersionStatesForReprocessing(t *tes
 	checkNextToRequeue(want, len(mods))
 	// Mark all modules for reprocessing.
 	for _, m := range mods {
-		if err := upsertModuleVersionState(ctx, testDB.db, m.modulePath, m.version, "2020-04-29t14", &m.numPackages, now, m.status, m.modulePath, derrors.FromStatus(m.status, "test string")); err != nil {
+		if err := upsertModuleVersionState(ctx, testDB.db, m.modulePath, m.version, "2020-04-29t14", &m.numPackages, now, m.status, m.modulePath, "", "", "", derrors.FromStatus(m.status, "test string"), nil); err != nil {
 			t.Fatal(err)
 		}
 	}
@@ -159,7 +159,7 @@ func TestGetNextModulesToFetchAndUpdateModuleVersionStatesForReprocessing(t *tes
 	// Lastly, not-latest large modules.
 	want = append(want, generateMods([]string{notLatest}, []int{big}, statuses)...)
 
-	want = append(want, generateMods([]string{latest, notLatest}, []int{small, big}, []int{500})...)
+	want = append(want, generateMods([]string{latest, notLatest}, []int{small, big}, []int{400, 500})...)
 	checkNextToRequeue(want, len(mods))
 
 	// Take modules in groups by passing a limit.
@@ -174,13 +174,13 @@ func TestGetNextModulesToFetchAndUpdateModuleVersionStatesForReprocessing(t *tes
 		updateStates(w)
 	}
 
-	// At this point, everything should have been queued except modules with
-	// status=400 and >= 500, and the latter have a next_processed_after time
-	// that is in the future.
+	// At this point, everything should have been queued, and the modules
+	// with status 400 and 500 have a next_processed_after time that is in
+	// the future.
 	checkNextToRequeue(nil, 5)
 }
 
-func TestGetNextModulesToFetchOnlyPicksUpStatus0AndStatusGreaterThan500(t *testing.T) {
+func TestGetNextModulesToFetchSkipsDoneModules(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
 	defer cancel()
 	defer ResetTestDB(testDB, t)
@@ -225,7 +225,13 @@ func TestGetNextModulesToFetchOnlyPicksUpStatus0AndStatusGreaterThan500(t *testi
 	}
 	var (
 		want         []*internal.ModuleVersionState
-		wantStatuses = []int{http.StatusInternalServerError, 0}
+		wantStatuses = []int{
+			derrors.ToStatus(derrors.AlternativeModule),
+			derrors.ToStatus(derrors.BadModule),
+			http.StatusBadRequest,
+			http.StatusInternalServerError,
+			0,
+		}
 	)
 	for _, status := range wantStatuses {
 		m := &internal.ModuleVersionState{
@@ -238,6 +244,30 @@ func TestGetNextModulesToFetchOnlyPicksUpStatus0AndStatusGreaterThan500(t *testi
 	compareModules(t, got, want)
 }
 
+func TestPostponeNewModuleVersionState(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer ResetTestDB(testDB, t)
+
+	now := time.Now()
+	if err := testDB.InsertIndexVersions(ctx, []*internal.IndexVersion{
+		{Path: "a.com/new", Version: "v1.0.0", Timestamp: now},
+		{Path: "a.com/other", Version: "v1.0.0", Timestamp: now},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := testDB.PostponeNewModuleVersionState(ctx, "a.com/new", "v1.0.0", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	got, err := testDB.GetNextModulesToFetch(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareModules(t, got, []*internal.ModuleVersionState{
+		{ModulePath: "a.com/other", Version: "v1.0.0"},
+	})
+}
+
 func TestGetNextModulesToFetchLargeModulesLimit(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
 	defer cancel()
@@ -318,3 +348,110 @@ func compareModules(t *testing.T, got, want []*internal.ModuleVersionState) {
 		t.Fatalf("mismatch (-want, +got):\n%s", diff)
 	}
 }
+
+func TestResetModuleVersionStatesWithPrefix(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer ResetTestDB(testDB, t)
+
+	var ivs []*internal.IndexVersion
+	for _, mv := range []internal.Modver{
+		{Path: "golang.org/x/net", Version: "v1.0.0"},
+		{Path: "golang.org/x/net", Version: "v1.1.0"},
+		{Path: "golang.org/x/netx", Version: "v1.0.0"},
+		{Path: "golang.org/x/tools", Version: "v1.0.0"},
+		{Path: "golang.org/x_y", Version: "v1.0.0"},
+		{Path: "github.com/a/b", Version: "v1.0.0"},
+	} {
+		ivs = append(ivs, &internal.IndexVersion{Path: mv.Path, Version: mv.Version, Timestamp: time.Now()})
+	}
+	if err := testDB.InsertIndexVersions(ctx, ivs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.db.Exec(ctx, `
+		UPDATE module_version_states
+		SET status = 200, next_processed_after = CURRENT_TIMESTAMP + INTERVAL '1 day'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.db.Exec(ctx, `
+		UPDATE module_version_states SET status = 500
+		WHERE module_path = 'golang.org/x/tools'`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		status int
+		want   []internal.Modver
+	}{
+		{
+			status: AnyStatus,
+			want: []internal.Modver{
+				{Path: "golang.org/x/net", Version: "v1.0.0"},
+				{Path: "golang.org/x/net", Version: "v1.1.0"},
+				{Path: "golang.org/x/netx", Version: "v1.0.0"},
+				{Path: "golang.org/x/tools", Version: "v1.0.0"},
+			},
+		},
+		{
+			status: 500,
+			want:   []internal.Modver{{Path: "golang.org/x/tools", Version: "v1.0.0"}},
+		},
+		{status: 404},
+	} {
+		n, err := testDB.CountModuleVersionStatesWithPrefix(ctx, "golang.org/x/", test.status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(test.want) {
+			t.Errorf("CountModuleVersionStatesWithPrefix(status=%d) = %d, want %d", test.status, n, len(test.want))
+		}
+
+		// Page through the rows two at a time.
+		var (
+			got   []internal.Modver
+			after internal.Modver
+		)
+		for {
+			mvs, err := testDB.ResetModuleVersionStatesWithPrefix(ctx, "golang.org/x/", test.status, after, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, mvs...)
+			if len(mvs) < 2 {
+				break
+			}
+			after = mvs[len(mvs)-1]
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("ResetModuleVersionStatesWithPrefix(status=%d) mismatch (-want +got):\n%s", test.status, diff)
+		}
+	}
+
+	// A prefix matches whole path elements.
+	n, err := testDB.CountModuleVersionStatesWithPrefix(ctx, "golang.org/x/net", AnyStatus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf(`CountModuleVersionStatesWithPrefix("golang.org/x/net") = %d, want 2`, n)
+	}
+
+	// Only the rows under the prefix are due for processing.
+	for _, mv := range []struct {
+		internal.Modver
+		wantDue bool
+	}{
+		{internal.Modver{Path: "golang.org/x/net", Version: "v1.0.0"}, true},
+		{internal.Modver{Path: "golang.org/x/tools", Version: "v1.0.0"}, true},
+		{internal.Modver{Path: "golang.org/x_y", Version: "v1.0.0"}, false},
+		{internal.Modver{Path: "github.com/a/b", Version: "v1.0.0"}, false},
+	} {
+		state, err := testDB.GetModuleVersionState(ctx, mv.Path, mv.Version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if due := !state.NextProcessedAfter.After(time.Now()); due != mv.wantDue {
+			t.Errorf("%s: due = %t, want %t", mv.Modver, due, mv.wantDue)
+		}
+	}
+}
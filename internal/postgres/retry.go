@@ -0,0 +1,165 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// A RetryClass classifies the module versions in module_version_states by
+// whether and how soon they are processed again.
+type RetryClass string
+
+const (
+	// RetryNew is the class of module versions that have not been processed.
+	RetryNew RetryClass = "new"
+	// RetryDone is the class of module versions that were processed
+	// successfully, and are not retried.
+	RetryDone RetryClass = "done"
+	// RetryReprocess is the class of module versions that were marked for
+	// reprocessing.
+	RetryReprocess RetryClass = "reprocess"
+	// RetryTransient is the class of module versions that failed with errors
+	// that may go away, such as proxy timeouts. They are retried with
+	// exponential backoff.
+	RetryTransient RetryClass = "transient"
+	// RetryPermanent is the class of module versions that failed with errors
+	// that are not expected to go away, such as a bad go.mod file. They are
+	// only retried after permanentRetryDelay.
+	RetryPermanent RetryClass = "permanent"
+)
+
+// RetryClasses lists the retry classes in the order they are displayed.
+var RetryClasses = []RetryClass{RetryNew, RetryTransient, RetryPermanent, RetryReprocess, RetryDone}
+
+// permanentErrorCodes are the error codes of fetches that will fail the same
+// way if they are retried.
+var permanentErrorCodes = map[string]bool{
+	derrors.CodeNotFound:                   true,
+	derrors.CodePseudoVersionDeleted:       true,
+	derrors.CodeInvalidArgument:            true,
+	derrors.CodeExcluded:                   true,
+	derrors.CodeBadModule:                  true,
+	derrors.CodeBadModuleZip:               true,
+	derrors.CodeBadGoMod:                   true,
+	derrors.CodeModuleHasNoPackages:        true,
+	derrors.CodeAlternativeModule:          true,
+	derrors.CodeModulePathCasing:           true,
+	derrors.CodeModuleTooLarge:             true,
+	derrors.CodeModuleTooManyPackages:      true,
+	derrors.CodeChecksumVerificationFailed: true,
+}
+
+const (
+	// A transient failure is first retried after transientRetryMin, and
+	// the delay doubles with each try up to transientRetryMax. Up to
+	// transientRetryJitter of the delay is added to it at random, so that
+	// module versions that failed together are not retried together.
+	transientRetryMin    = time.Minute
+	transientRetryMax    = time.Hour
+	transientRetryJitter = 0.2
+
+	// permanentRetryDelay is how long a module version that failed
+	// permanently waits before it is tried again.
+	permanentRetryDelay = 30 * 24 * time.Hour
+)
+
+// retryClass returns the retry class of a module version whose last
+// processing resulted in status and errorCode.
+func retryClass(status int, errorCode string) RetryClass {
+	switch {
+	case status == 0:
+		return RetryNew
+	case status >= 520 && status < 550:
+		// Reprocessing keeps the error code of the last fetch, so check
+		// for it before the permanent error codes.
+		return RetryReprocess
+	case permanentErrorCodes[errorCode]:
+		return RetryPermanent
+	case status < 400:
+		return RetryDone
+	case errorCode == derrors.CodeProxyTimedOut || status >= 500:
+		return RetryTransient
+	default:
+		return RetryPermanent
+	}
+}
+
+// nextProcessedAfter returns the time after which a module version should be
+// processed again, if its tryCount'th try ended at now with status and
+// errorCode. The jitter is a random number in [0, 1) that spreads out the
+// retries of transient failures.
+func nextProcessedAfter(now time.Time, status int, errorCode string, tryCount int, jitter float64) time.Time {
+	switch retryClass(status, errorCode) {
+	case RetryTransient:
+		delay := transientRetryMin
+		for i := 1; i < tryCount && delay < transientRetryMax; i++ {
+			delay *= 2
+		}
+		if delay > transientRetryMax {
+			delay = transientRetryMax
+		}
+		return now.Add(delay + time.Duration(jitter*transientRetryJitter*float64(delay)))
+	case RetryPermanent:
+		return now.Add(permanentRetryDelay)
+	default:
+		// Module versions in the other classes are not retried by the
+		// scheduler; they are made due again when they are reprocessed.
+		return now
+	}
+}
+
+// RetryClassCount is the number of module versions in a retry class, and how
+// many of them are due to be processed.
+type RetryClassCount struct {
+	Class RetryClass
+	Total int
+	Due   int
+}
+
+// GetRetryClassCounts returns the number of module versions in each retry
+// class, in the order of RetryClasses.
+func (db *DB) GetRetryClassCounts(ctx context.Context) (_ []*RetryClassCount, err error) {
+	defer derrors.Wrap(&err, "GetRetryClassCounts(ctx)")
+
+	query := `
+		SELECT
+			status,
+			COALESCE(error_code, ''),
+			count(*),
+			count(*) FILTER (WHERE next_processed_after < CURRENT_TIMESTAMP)
+		FROM module_version_states
+		GROUP BY 1, 2`
+	counts := map[RetryClass]*RetryClassCount{}
+	for _, c := range RetryClasses {
+		counts[c] = &RetryClassCount{Class: c}
+	}
+	err = db.db.RunQuery(ctx, query, func(rows *sql.Rows) error {
+		var (
+			status     int
+			code       string
+			total, due int
+		)
+		if err := rows.Scan(&status, &code, &total, &due); err != nil {
+			return err
+		}
+		c := counts[retryClass(status, code)]
+		c.Total += total
+		c.Due += due
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var cs []*RetryClassCount
+	for _, c := range RetryClasses {
+		cs = append(cs, counts[c])
+	}
+	return cs, nil
+}
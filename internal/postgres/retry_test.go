@@ -0,0 +1,109 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+func TestNextProcessedAfter(t *testing.T) {
+	now := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name      string
+		status    int
+		code      string
+		tryCount  int
+		jitter    float64
+		wantClass RetryClass
+		want      time.Duration // from now
+	}{
+		{"ok", http.StatusOK, "", 1, 0, RetryDone, 0},
+		{"incomplete packages", 290, "", 3, 0.5, RetryDone, 0},
+		{"reprocess", 520, "", 3, 0, RetryReprocess, 0},
+		{"reprocess bad module", 540, derrors.CodeBadModule, 2, 0, RetryReprocess, 0},
+		{"first transient", 500, derrors.CodeUnknown, 1, 0, RetryTransient, time.Minute},
+		{"second transient", 500, derrors.CodeUnknown, 2, 0, RetryTransient, 2 * time.Minute},
+		{"fourth transient", http.StatusGatewayTimeout, derrors.CodeProxyTimedOut, 4, 0, RetryTransient, 8 * time.Minute},
+		{"transient with jitter", 500, "", 4, 0.5, RetryTransient, 8*time.Minute + 48*time.Second},
+		{"transient at max", 500, "", 7, 0, RetryTransient, time.Hour},
+		{"transient past max", 500, "", 1000, 0.99, RetryTransient, time.Hour + time.Duration(0.99*0.2*float64(time.Hour))},
+		{"bad casing", 490, derrors.CodeModulePathCasing, 1, 0.5, RetryPermanent, permanentRetryDelay},
+		{"bad go.mod", 490, derrors.CodeBadGoMod, 5, 0, RetryPermanent, permanentRetryDelay},
+		{"too large", 492, derrors.CodeModuleTooLarge, 1, 0, RetryPermanent, permanentRetryDelay},
+		{"not found", http.StatusNotFound, derrors.CodeNotFound, 1, 0, RetryPermanent, permanentRetryDelay},
+		{"permanent code with 5xx status", 500, derrors.CodeBadModuleZip, 1, 0, RetryPermanent, permanentRetryDelay},
+		{"other 4xx", 480, derrors.CodeDBModuleInsertInvalid, 2, 0, RetryPermanent, permanentRetryDelay},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := retryClass(test.status, test.code); got != test.wantClass {
+				t.Errorf("retryClass(%d, %q) = %q, want %q", test.status, test.code, got, test.wantClass)
+			}
+			got := nextProcessedAfter(now, test.status, test.code, test.tryCount, test.jitter).Sub(now)
+			if got != test.want {
+				t.Errorf("nextProcessedAfter(now, %d, %q, %d, %g) = now + %s, want now + %s",
+					test.status, test.code, test.tryCount, test.jitter, got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetRetryClassCounts(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer ResetTestDB(testDB, t)
+
+	now := time.Now()
+	var ivs []*internal.IndexVersion
+	for _, p := range []string{"new.com/a", "ok.com/a", "casing.com/a", "timeout.com/a", "timeout.com/b"} {
+		ivs = append(ivs, &internal.IndexVersion{Path: p, Version: "v1.0.0", Timestamp: now})
+	}
+	if err := testDB.InsertIndexVersions(ctx, ivs); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []struct {
+		path string
+		err  error
+	}{
+		{"ok.com/a", nil},
+		{"casing.com/a", derrors.ModulePathCasing},
+		{"timeout.com/a", derrors.ProxyTimedOut},
+		{"timeout.com/b", derrors.ProxyTimedOut},
+	} {
+		if err := testDB.UpsertModuleVersionState(ctx, m.path, "v1.0.0", "app", now, derrors.ToStatus(m.err),
+			"", "", "", "", m.err, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Make one of the transient failures due.
+	if _, err := testDB.db.Exec(ctx, `
+		UPDATE module_version_states SET next_processed_after = CURRENT_TIMESTAMP - INTERVAL '1 minute'
+		WHERE module_path = 'timeout.com/b'`); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := testDB.GetRetryClassCounts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*RetryClassCount{
+		{Class: RetryNew, Total: 1, Due: 1},
+		{Class: RetryTransient, Total: 2, Due: 1},
+		{Class: RetryPermanent, Total: 1, Due: 0},
+		{Class: RetryReprocess},
+		// Successful fetches are due at once, but are not scheduled
+		// because of their status.
+		{Class: RetryDone, Total: 1, Due: 1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -117,22 +117,49 @@ var searchers = map[string]searcher{
 // The gap in this optimization is search terms that are very frequent, but
 // rarely relevant: "int" or "package", for example. In these cases we'll pay
 // the penalty of a deep search that scans nearly every package.
+//
+// Queries with filters, like "yaml license:MIT", are instead run by
+// filteredSearch alone; see internal.ParseSearchQuery.
+//
+// Search returns the best-ranked package of each module, with the other
+// matching packages of the module listed in the result for it.
 func (db *DB) Search(ctx context.Context, q string, limit, offset int) (_ []*internal.SearchResult, err error) {
 	defer derrors.Wrap(&err, "DB.Search(ctx, %q, %d, %d)", q, limit, offset)
-	resp, err := db.hedgedSearch(ctx, q, limit, offset, searchers, nil)
+	var resp *searchResponse
+	if sq := internal.ParseSearchQuery(q); len(sq.Filters) > 0 {
+		resp, err = db.searchWithFilters(ctx, sq, limit, offset)
+	} else {
+		resp, err = db.hedgedSearch(ctx, q, limit, offset, searchers, nil)
+	}
 	if err != nil {
 		return nil, err
 	}
-	// Filter out excluded paths.
-	var results []*internal.SearchResult
+	if len(resp.results) == 0 {
+		return nil, nil
+	}
+	groups, err := db.getModuleGroups(ctx, q, resp.results)
+	if err != nil {
+		return nil, err
+	}
+	// Add the other packages of each module, and filter out excluded paths.
+	// A module whose best package is excluded is represented by its next
+	// best package, which needs package data.
+	var results, replaced []*internal.SearchResult
 	for _, r := range resp.results {
-		ex, err := db.IsExcluded(ctx, r.PackagePath)
+		gr, err := db.groupSearchResult(ctx, r, groups[r.ModulePath])
 		if err != nil {
 			return nil, err
 		}
-		if !ex {
-			results = append(results, r)
+		if gr == nil {
+			continue
+		}
+		if gr != r {
+			replaced = append(replaced, gr)
 		}
+		results = append(results, gr)
+	}
+	if err := db.addPackageDataToSearchResults(ctx, replaced); err != nil {
+		return nil, err
 	}
 	return results, nil
 }
@@ -145,6 +172,8 @@ const (
 	// Start this off gently (close to 1), but consider lowering
 	// it as time goes by and more of the ecosystem converts to modules.
 	noGoModPenalty = 0.8
+	// Module is deprecated by the go.mod file of its latest version.
+	deprecatedPenalty = 0.5
 )
 
 // scoreExpr is the expression that computes the search score.
@@ -156,15 +185,19 @@ const (
 //   dramatic: being 2x as popular only has an additive effect.
 // - A penalty factor for non-redistributable modules, since a lot of
 //   details cannot be displayed.
+// - A penalty factor for deprecated modules, since their authors recommend
+//   against using them.
 // The first argument to ts_rank is an array of weights for the four tsvector sections,
 // in the order D, C, B, A.
 // The weights below match the defaults except for B.
+// rankedScoreExpr adds factors for the freshness of the module.
 var scoreExpr = fmt.Sprintf(`
 		ts_rank('{0.1, 0.2, 1.0, 1.0}', tsv_search_tokens, websearch_to_tsquery($1)) *
 		ln(exp(1)+imported_by_count) *
 		CASE WHEN redistributable THEN 1 ELSE %f END *
-		CASE WHEN COALESCE(has_go_mod, true) THEN 1 ELSE %f END
-	`, nonRedistributablePenalty, noGoModPenalty)
+		CASE WHEN COALESCE(has_go_mod, true) THEN 1 ELSE %f END *
+		CASE WHEN deprecated THEN %f ELSE 1 END
+	`, nonRedistributablePenalty, noGoModPenalty, deprecatedPenalty)
 
 // hedgedSearch executes multiple search methods and returns the first
 // available result.
@@ -276,7 +309,8 @@ func (db *DB) hedgedSearch(ctx context.Context, q string, limit, offset int, sea
 
 const hllRegisterCount = 128
 
-// hllQuery estimates search result counts using the hyperloglog algorithm.
+// hllQuery returns a query that estimates search result counts using the
+// hyperloglog algorithm, for results whose score is computed by scoreExpr.
 // https://en.wikipedia.org/wiki/HyperLogLog
 //
 // Here's how this works:
@@ -301,7 +335,8 @@ const hllRegisterCount = 128
 //   This should work for any register count >= 128. If we are to decrease this
 //   register count, we should adjust the estimate for a_m below according to
 //   the formulas in the wikipedia article above.
-var hllQuery = fmt.Sprintf(`
+func hllQuery(scoreExpr string) string {
+	return fmt.Sprintf(`
 	WITH hll_data AS (
 		SELECT (
 			SELECT * FROM (
@@ -336,6 +371,7 @@ var hllQuery = fmt.Sprintf(`
 			%[1]d - count(1) AS empty_register_count
 		FROM nonempty_registers
 	) d`, hllRegisterCount, scoreExpr)
+}
 
 type estimateResponse struct {
 	estimate uint64
@@ -343,9 +379,11 @@ type estimateResponse struct {
 }
 
 // EstimateResultsCount uses the hyperloglog algorithm to estimate the number
-// of results for the given search term.
+// of results for the given search term. It estimates the number of matching
+// packages rather than modules, so it overestimates the number of results,
+// which are grouped by module.
 func (db *DB) estimateResultsCount(ctx context.Context, q string) estimateResponse {
-	row := db.db.QueryRow(ctx, hllQuery, q)
+	row := db.db.QueryRow(ctx, hllQuery(rankedScoreExpr(scoreExpr, db.rankingFor(ctx))), q)
 	var estimate sql.NullInt64
 	if err := row.Scan(&estimate); err != nil {
 		return estimateResponse{err: fmt.Errorf("row.Scan(): %v", err)}
@@ -358,27 +396,8 @@ func (db *DB) estimateResultsCount(ctx context.Context, q string) estimateRespon
 // deepSearch searches all packages for the query. It is slower, but results
 // are always valid.
 func (db *DB) deepSearch(ctx context.Context, q string, limit, offset int) searchResponse {
-	query := fmt.Sprintf(`
-		SELECT *, COUNT(*) OVER() AS total
-		FROM (
-			SELECT
-				package_path,
-				version,
-				module_path,
-				commit_time,
-				imported_by_count,
-				(%s) AS score
-				FROM
-					search_documents
-				WHERE tsv_search_tokens @@ websearch_to_tsquery($1)
-				ORDER BY
-					score DESC,
-					commit_time DESC,
-					package_path
-		) r
-		WHERE r.score > 0.1
-		LIMIT $2
-		OFFSET $3`, scoreExpr)
+	query := groupedSearchQuery(rankedScoreExpr(scoreExpr, db.rankingFor(ctx)),
+		"tsv_search_tokens @@ websearch_to_tsquery($1)", "score > 0.1")
 	var results []*internal.SearchResult
 	collect := func(rows *sql.Rows) error {
 		var r internal.SearchResult
@@ -400,6 +419,54 @@ func (db *DB) deepSearch(ctx context.Context, q string, limit, offset int) searc
 	}
 }
 
+// groupedSearchQuery returns a query for the best-ranked package of each
+// module among the rows of search_documents that satisfy cond and whose score,
+// computed by scoreExpr, satisfies minScore. The query returns the packages
+// in order of score, along with the number of modules, and takes the search
+// text, limit and offset as its first three parameters.
+//
+// Ranking only the best package of each module keeps a module with many
+// matching packages from filling a page of results; its other packages are
+// added by addOtherPackagesToSearchResults.
+func groupedSearchQuery(scoreExpr, cond, minScore string) string {
+	return fmt.Sprintf(`
+		SELECT
+			package_path,
+			version,
+			module_path,
+			commit_time,
+			imported_by_count,
+			score,
+			COUNT(*) OVER() AS total
+		FROM (
+			SELECT
+				*,
+				ROW_NUMBER() OVER (
+					PARTITION BY module_path
+					ORDER BY score DESC, commit_time DESC, package_path
+				) AS module_rank
+			FROM (
+				SELECT
+					package_path,
+					version,
+					module_path,
+					commit_time,
+					imported_by_count,
+					(%s) AS score
+				FROM search_documents
+				WHERE %s
+			) s
+			WHERE %s
+		) r
+		WHERE r.module_rank = 1
+		ORDER BY
+			score DESC,
+			commit_time DESC,
+			package_path
+		LIMIT $2
+		OFFSET $3`, scoreExpr, cond, minScore)
+}
+
 func (db *DB) popularSearch(ctx context.Context, searchQuery string, limit, offset int) searchResponse {
 	query := `
 		SELECT
@@ -409,7 +476,7 @@ func (db *DB) popularSearch(ctx context.Context, searchQuery string, limit, offs
 			commit_time,
 			imported_by_count,
 			score
-		FROM popular_search($1, $2, $3, $4, $5)`
+		FROM popular_search($1, $2, $3, $4, $5, $6, $7, $8, $9)`
 	var results []*internal.SearchResult
 	collect := func(rows *sql.Rows) error {
 		var r internal.SearchResult
@@ -420,7 +487,9 @@ func (db *DB) popularSearch(ctx context.Context, searchQuery string, limit, offs
 		results = append(results, &r)
 		return nil
 	}
-	err := db.db.RunQuery(ctx, query, collect, searchQuery, limit, offset, nonRedistributablePenalty, noGoModPenalty)
+	args := append([]interface{}{searchQuery, limit, offset, nonRedistributablePenalty, noGoModPenalty, deprecatedPenalty},
+		popularSearchRankingArgs(db.rankingFor(ctx))...)
+	err := db.db.RunQuery(ctx, query, collect, args...)
 	if err != nil {
 		results = nil
 	}
@@ -489,8 +558,133 @@ func (db *DB) addPackageDataToSearchResults(ctx context.Context, results []*inte
 	return db.db.RunQuery(ctx, query, collect)
 }
 
-var upsertSearchStatement = fmt.Sprintf(`
-	INSERT INTO search_documents (
+// maxOtherPackages is the maximum number of the other packages of a module
+// that are listed with a search result.
+const maxOtherPackages = 5
+
+// A moduleGroup holds the best-ranked packages of a module that match a
+// search query, in order, and the number of all of them.
+type moduleGroup struct {
+	packages    []*internal.SearchResult
+	numPackages uint64
+}
+
+// getModuleGroups returns the module groups of the modules of results for
+// the search query q, keyed by module path. Each group holds a few more
+// packages than are listed with a result, so that the result can be replaced
+// if its package is excluded.
+func (db *DB) getModuleGroups(ctx context.Context, q string, results []*internal.SearchResult) (_ map[string]*moduleGroup, err error) {
+	defer derrors.Wrap(&err, "DB.getModuleGroups(ctx, %q, results)", q)
+	var modulePaths []string
+	for _, r := range results {
+		modulePaths = append(modulePaths, r.ModulePath)
+	}
+	sq := internal.ParseSearchQuery(q)
+	cond, args, err := searchCondition(sq, []interface{}{sq.Text, pq.Array(modulePaths), maxOtherPackages + 2})
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`
+		SELECT
+			package_path,
+			version,
+			module_path,
+			commit_time,
+			imported_by_count,
+			score,
+			num_packages
+		FROM (
+			SELECT
+				*,
+				ROW_NUMBER() OVER (
+					PARTITION BY module_path
+					ORDER BY score DESC, commit_time DESC, package_path
+				) AS module_rank,
+				COUNT(*) OVER (PARTITION BY module_path) AS num_packages
+			FROM (
+				SELECT
+					package_path,
+					version,
+					module_path,
+					commit_time,
+					imported_by_count,
+					(%s) AS score
+				FROM search_documents
+				WHERE module_path = ANY($2) AND %s
+			) s
+			WHERE %s
+		) r
+		WHERE module_rank <= $3
+		ORDER BY module_path, module_rank`, rankedScoreExpr(filteredScoreExpr, db.rankingFor(ctx)), cond, filteredMinScore)
+	groups := map[string]*moduleGroup{}
+	collect := func(rows *sql.Rows) error {
+		var (
+			r internal.SearchResult
+			n uint64
+		)
+		if err := rows.Scan(&r.PackagePath, &r.Version, &r.ModulePath, &r.CommitTime,
+			&r.NumImportedBy, &r.Score, &n); err != nil {
+			return fmt.Errorf("rows.Scan(): %v", err)
+		}
+		g := groups[r.ModulePath]
+		if g == nil {
+			g = &moduleGroup{numPackages: n}
+			groups[r.ModulePath] = g
+		}
+		g.packages = append(g.packages, &r)
+		return nil
+	}
+	if err := db.db.RunQuery(ctx, query, collect, args...); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// groupSearchResult returns the search result for the module of r, whose
+// matching packages are in g: the best-ranked of them that is not excluded,
+// listing the others. It returns nil if all of them are excluded.
+func (db *DB) groupSearchResult(ctx context.Context, r *internal.SearchResult, g *moduleGroup) (*internal.SearchResult, error) {
+	candidates := []*internal.SearchResult{r}
+	numPackages := uint64(1)
+	if g != nil {
+		numPackages = g.numPackages
+		for _, p := range g.packages {
+			if p.PackagePath != r.PackagePath {
+				candidates = append(candidates, p)
+			}
+		}
+	}
+	var best *internal.SearchResult
+	for _, c := range candidates {
+		ex, err := db.IsExcluded(ctx, c.PackagePath)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case ex:
+			if numPackages > 0 {
+				numPackages--
+			}
+		case best == nil:
+			best = c
+		case len(best.OtherPackages) < maxOtherPackages:
+			best.OtherPackages = append(best.OtherPackages, c.PackagePath)
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	if numPackages > 0 {
+		best.NumOtherPackages = numPackages - 1
+	}
+	best.NumResults = r.NumResults
+	best.Approximate = r.Approximate
+	return best, nil
+}
+
+// searchDocumentColumns are the columns of search_documents that
+// upsertSearchStatement and bulkUpsertSearchStatement set.
+const searchDocumentColumns = `
 		package_path,
 		version,
 		module_path,
@@ -503,7 +697,32 @@ var upsertSearchStatement = fmt.Sprintf(`
 		has_go_mod,
 		tsv_search_tokens,
 		hll_register,
-		hll_leading_zeros
+		hll_leading_zeros`
+
+// upsertSearchConflictAction is the conflict action of upsertSearchStatement
+// and bulkUpsertSearchStatement.
+const upsertSearchConflictAction = `
+	ON CONFLICT (package_path)
+	DO UPDATE SET
+		package_path=excluded.package_path,
+		version=excluded.version,
+		module_path=excluded.module_path,
+		name=excluded.name,
+		synopsis=excluded.synopsis,
+		license_types=excluded.license_types,
+		redistributable=excluded.redistributable,
+		commit_time=excluded.commit_time,
+		has_go_mod=excluded.has_go_mod,
+		tsv_search_tokens=excluded.tsv_search_tokens,
+		-- the hll fields are functions of path, so they don't change
+		version_updated_at=(
+			CASE WHEN excluded.version = search_documents.version
+			THEN search_documents.version_updated_at
+			ELSE CURRENT_TIMESTAMP
+			END)`
+
+var upsertSearchStatement = fmt.Sprintf(`
+	INSERT INTO search_documents (%[3]s
 	)
 	SELECT
 		p.path,
@@ -534,50 +753,126 @@ var upsertSearchStatement = fmt.Sprintf(`
 		AND p.version = m.version
 	WHERE
 		p.path = $1
-	%s
+	%[2]s
 	LIMIT 1
-	ON CONFLICT (package_path)
-	DO UPDATE SET
-		package_path=excluded.package_path,
-		version=excluded.version,
-		module_path=excluded.module_path,
-		name=excluded.name,
-		synopsis=excluded.synopsis,
-		license_types=excluded.license_types,
-		redistributable=excluded.redistributable,
-		commit_time=excluded.commit_time,
-		has_go_mod=excluded.has_go_mod,
-		tsv_search_tokens=excluded.tsv_search_tokens,
-		-- the hll fields are functions of path, so they don't change
-		version_updated_at=(
-			CASE WHEN excluded.version = search_documents.version
-			THEN search_documents.version_updated_at
-			ELSE CURRENT_TIMESTAMP
-			END)
-	;`, hllRegisterCount, orderByLatest)
+	%[4]s
+	;`, hllRegisterCount, orderByLatest, searchDocumentColumns, upsertSearchConflictAction)
+
+// searchDocumentArgsTable is the name of the temporary table that holds the
+// arguments of bulkUpsertSearchStatement, one row per package.
+const searchDocumentArgsTable = "search_document_args"
+
+// bulkUpsertSearchStatement is like upsertSearchStatement, but upserts the
+// search documents of all the packages in searchDocumentArgsTable.
+var bulkUpsertSearchStatement = fmt.Sprintf(`
+	INSERT INTO search_documents (%[3]s
+	)
+	SELECT
+		l.path,
+		l.version,
+		l.module_path,
+		l.name,
+		l.synopsis,
+		l.license_types,
+		l.redistributable,
+		CURRENT_TIMESTAMP,
+		l.commit_time,
+		l.has_go_mod,
+		(
+			SETWEIGHT(TO_TSVECTOR('path_tokens', a.path_tokens), 'A') ||
+			SETWEIGHT(TO_TSVECTOR(a.section_b), 'B') ||
+			SETWEIGHT(TO_TSVECTOR(a.section_c), 'C') ||
+			SETWEIGHT(TO_TSVECTOR(a.section_d), 'D')
+		),
+		hll_hash(l.path) & (%[1]d - 1),
+		hll_zeros(hll_hash(l.path))
+	FROM
+		%[5]s a
+	CROSS JOIN LATERAL (
+		SELECT
+			p.path,
+			p.version,
+			p.module_path,
+			p.name,
+			p.synopsis,
+			p.license_types,
+			p.redistributable,
+			m.commit_time,
+			m.has_go_mod
+		FROM
+			packages p
+		INNER JOIN
+			modules m
+		ON
+			p.module_path = m.module_path
+			AND p.version = m.version
+		WHERE
+			p.path = a.package_path
+		%[2]s
+		LIMIT 1
+	) l
+	ORDER BY l.path
+	%[4]s
+	;`, hllRegisterCount, orderByLatest, searchDocumentColumns, upsertSearchConflictAction, searchDocumentArgsTable)
 
 // upsertSearchDocuments adds search information for mod ot the search_documents table.
 // It assumes that all non-redistributable data has been removed from mod.
+//
+// It must be called in a transaction. The arguments for all the packages are
+// copied to the database at once, and the search documents are upserted with
+// a single statement.
 func upsertSearchDocuments(ctx context.Context, db *database.DB, mod *internal.Module) (err error) {
 	defer derrors.Wrap(&err, "UpsertSearchDocuments(ctx, %q)", mod.ModulePath)
 	ctx, span := trace.StartSpan(ctx, "UpsertSearchDocuments")
 	defer span.End()
+
+	var values []interface{}
 	for _, pkg := range mod.LegacyPackages {
 		if isInternalPackage(pkg.Path) {
 			continue
 		}
-		err := UpsertSearchDocument(ctx, db, upsertSearchDocumentArgs{
+		pathTokens, sectionB, sectionC, sectionD := searchDocumentValues(upsertSearchDocumentArgs{
 			PackagePath:    pkg.Path,
 			ModulePath:     mod.ModulePath,
 			Synopsis:       pkg.Synopsis,
 			ReadmeFilePath: mod.LegacyReadmeFilePath,
 			ReadmeContents: mod.LegacyReadmeContents,
 		})
-		if err != nil {
-			return err
-		}
+		values = append(values, pkg.Path, pathTokens, sectionB, sectionC, sectionD)
 	}
-	return nil
+	if err := bulkUpsertSearchDocuments(ctx, db, values); err != nil {
+		return err
+	}
+	return upsertSymbolSearchDocuments(ctx, db, mod)
+}
+
+// bulkUpsertSearchDocuments upserts the search documents of the packages
+// described by values, which holds the package path, path tokens and sections
+// B, C and D of each package in turn.
+//
+// It must be called in a transaction.
+func bulkUpsertSearchDocuments(ctx context.Context, db *database.DB, values []interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+	// Both statements are sent together, in a single round trip.
+	if _, err := db.Exec(ctx, fmt.Sprintf(`
+		DROP TABLE IF EXISTS %[1]s;
+		CREATE TEMPORARY TABLE %[1]s (
+			package_path TEXT,
+			path_tokens TEXT,
+			section_b TEXT,
+			section_c TEXT,
+			section_d TEXT
+		) ON COMMIT DROP`, searchDocumentArgsTable)); err != nil {
+		return err
+	}
+	cols := []string{"package_path", "path_tokens", "section_b", "section_c", "section_d"}
+	if err := db.CopyIn(ctx, searchDocumentArgsTable, cols, values); err != nil {
+		return err
+	}
+	_, err := db.Exec(ctx, bulkUpsertSearchStatement)
+	return err
 }
 
 type upsertSearchDocumentArgs struct {
@@ -596,15 +891,22 @@ type upsertSearchDocumentArgs struct {
 func UpsertSearchDocument(ctx context.Context, db *database.DB, args upsertSearchDocumentArgs) (err error) {
 	defer derrors.Wrap(&err, "UpsertSearchDocument(ctx, db, %q, %q)", args.PackagePath, args.ModulePath)
 
+	pathTokens, sectionB, sectionC, sectionD := searchDocumentValues(args)
+	_, err = db.Exec(ctx, upsertSearchStatement, args.PackagePath, pathTokens, sectionB, sectionC, sectionD)
+	return err
+}
+
+// searchDocumentValues returns the path tokens and the text of sections B, C
+// and D of the search document described by args.
+func searchDocumentValues(args upsertSearchDocumentArgs) (pathTokens, sectionB, sectionC, sectionD string) {
 	// Only summarize the README if the package and module have the same path.
 	if args.PackagePath != args.ModulePath {
 		args.ReadmeFilePath = ""
 		args.ReadmeContents = ""
 	}
-	pathTokens := strings.Join(GeneratePathTokens(args.PackagePath), " ")
-	sectionB, sectionC, sectionD := SearchDocumentSections(args.Synopsis, args.ReadmeFilePath, args.ReadmeContents)
-	_, err = db.Exec(ctx, upsertSearchStatement, args.PackagePath, pathTokens, sectionB, sectionC, sectionD)
-	return err
+	pathTokens = strings.Join(GeneratePathTokens(args.PackagePath), " ")
+	sectionB, sectionC, sectionD = SearchDocumentSections(args.Synopsis, args.ReadmeFilePath, args.ReadmeContents)
+	return pathTokens, sectionB, sectionC, sectionD
 }
 
 // GetPackagesForSearchDocumentUpsert fetches search information for packages in search_documents
@@ -726,9 +1028,7 @@ func (db *DB) computeImportedByCounts(ctx context.Context, searchDocsPackages ma
 			continue
 		}
 		// Don't count an importer if it's in the same module as what it's importing.
-		// Approximate that check by seeing if from_module_path is a prefix of to_path.
-		// (In some cases, e.g. when to_path is in a nested module, that is not correct.)
-		if (fromMod == stdlib.ModulePath && stdlib.Contains(to)) || strings.HasPrefix(to+"/", fromMod+"/") {
+		if isSameModuleImport(fromMod, to) {
 			continue
 		}
 		counts[to]++
@@ -739,6 +1039,103 @@ func (db *DB) computeImportedByCounts(ctx context.Context, searchDocsPackages ma
 	return counts, nil
 }
 
+// isSameModuleImport reports whether importing the package with path to from
+// a package of the module with fromModulePath is an import within a single
+// module. It approximates that check by seeing if fromModulePath is a prefix
+// of to. (In some cases, e.g. when to is in a nested module, that is not
+// correct.)
+func isSameModuleImport(fromModulePath, to string) bool {
+	return (fromModulePath == stdlib.ModulePath && stdlib.Contains(to)) || strings.HasPrefix(to+"/", fromModulePath+"/")
+}
+
+// updateImportedByCountsForModule adjusts the imported_by_count of the
+// packages imported by the packages of the module with modulePath, by the
+// difference between oldImports, the imports of its previous latest version,
+// and newImports, those of its new latest version. That way the counts reflect
+// a new version as soon as it is inserted, rather than after the next run of
+// UpdateSearchDocumentsImportedByCount, which recomputes all of the counts and
+// corrects any drift. As in that recomputation, importers that are not in
+// search_documents, or are in the same module as the package they import, are
+// not counted.
+func updateImportedByCountsForModule(ctx context.Context, db *database.DB, modulePath string, oldImports, newImports []importEdge) (err error) {
+	defer derrors.Wrap(&err, "updateImportedByCountsForModule(ctx, db, %q)", modulePath)
+
+	fromSet := map[string]bool{}
+	for _, edges := range [][]importEdge{oldImports, newImports} {
+		for _, e := range edges {
+			fromSet[e.from] = true
+		}
+	}
+	if len(fromSet) == 0 {
+		return nil
+	}
+	var froms []string
+	for f := range fromSet {
+		froms = append(froms, f)
+	}
+	inSearch := map[string]bool{}
+	err = db.RunQuery(ctx, `SELECT package_path FROM search_documents WHERE package_path = ANY($1)`,
+		func(rows *sql.Rows) error {
+			var p string
+			if err := rows.Scan(&p); err != nil {
+				return err
+			}
+			inSearch[p] = true
+			return nil
+		}, pq.Array(froms))
+	if err != nil {
+		return err
+	}
+
+	deltas := map[string]int{}
+	count := func(edges []importEdge, d int) {
+		seen := map[importEdge]bool{}
+		for _, e := range edges {
+			if seen[e] || !inSearch[e.from] || isSameModuleImport(modulePath, e.to) {
+				continue
+			}
+			seen[e] = true
+			deltas[e.to] += d
+		}
+	}
+	count(oldImports, -1)
+	count(newImports, 1)
+	var (
+		paths  []string
+		counts []int64
+	)
+	for p, d := range deltas {
+		if d != 0 {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		counts = append(counts, int64(deltas[p]))
+	}
+	// Lock the rows in path order first, so that concurrent inserts of
+	// modules that import the same packages cannot deadlock.
+	if _, err := db.Exec(ctx, `
+		SELECT 1 FROM search_documents
+		WHERE package_path = ANY($1)
+		ORDER BY package_path
+		FOR UPDATE`, pq.Array(paths)); err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx, `
+		UPDATE search_documents s
+		SET
+			imported_by_count = GREATEST(s.imported_by_count + d.delta, 0),
+			imported_by_count_updated_at = CURRENT_TIMESTAMP
+		FROM unnest($1::text[], $2::int[]) AS d(package_path, delta)
+		WHERE s.package_path = d.package_path`,
+		pq.Array(paths), pq.Array(counts))
+	return err
+}
+
 func insertImportedByCounts(ctx context.Context, db *database.DB, counts map[string]int) (err error) {
 	defer derrors.Wrap(&err, "insertImportedByCounts(ctx, db, counts)")
 
@@ -0,0 +1,138 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"golang.org/x/pkgsite/internal"
+)
+
+// popularityScoreExpr is the search score of a package when a query has
+// filters but no text: scoreExpr without its ts_rank factor.
+var popularityScoreExpr = fmt.Sprintf(`
+		ln(exp(1)+imported_by_count) *
+		CASE WHEN redistributable THEN 1 ELSE %f END *
+		CASE WHEN COALESCE(has_go_mod, true) THEN 1 ELSE %f END *
+		CASE WHEN deprecated THEN %f ELSE 1 END
+	`, nonRedistributablePenalty, noGoModPenalty, deprecatedPenalty)
+
+// filteredScoreExpr and filteredMinScore are the search score of a package,
+// and the condition on it, for a query whose text, which may be empty, is
+// parameter $1.
+var (
+	filteredScoreExpr = fmt.Sprintf("CASE WHEN $1 = '' THEN %s ELSE %s END", popularityScoreExpr, scoreExpr)
+	filteredMinScore  = "$1 = '' OR score > 0.1"
+)
+
+// searchWithFilters returns the results of filteredSearch for sq, with the
+// package data that hedgedSearch adds.
+func (db *DB) searchWithFilters(ctx context.Context, sq *internal.SearchQuery, limit, offset int) (*searchResponse, error) {
+	resp := db.filteredSearch(ctx, sq, limit, offset)
+	if resp.err != nil {
+		return nil, fmt.Errorf("%q search failed: %v", resp.source, resp.err)
+	}
+	if err := db.addPackageDataToSearchResults(ctx, resp.results); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// filteredSearch is deepSearch for a query with filters. Since the popular
+// search function cannot apply the filters, it is the only searcher used
+// for such queries, and its results are always counted.
+//
+// If sq has no text, every package that satisfies the filters matches, and
+// packages are ranked by popularity alone.
+func (db *DB) filteredSearch(ctx context.Context, sq *internal.SearchQuery, limit, offset int) searchResponse {
+	cond, args, err := searchCondition(sq, []interface{}{sq.Text, limit, offset})
+	if err != nil {
+		return searchResponse{source: "filtered", err: err}
+	}
+	query := groupedSearchQuery(rankedScoreExpr(filteredScoreExpr, db.rankingFor(ctx)), cond, filteredMinScore)
+	var results []*internal.SearchResult
+	collect := func(rows *sql.Rows) error {
+		var r internal.SearchResult
+		if err := rows.Scan(&r.PackagePath, &r.Version, &r.ModulePath, &r.CommitTime,
+			&r.NumImportedBy, &r.Score, &r.NumResults); err != nil {
+			return fmt.Errorf("rows.Scan(): %v", err)
+		}
+		results = append(results, &r)
+		return nil
+	}
+	err = db.db.RunQuery(ctx, query, collect, args...)
+	if err != nil {
+		results = nil
+	}
+	return searchResponse{
+		source:  "filtered",
+		results: results,
+		err:     err,
+	}
+}
+
+// searchCondition returns the condition on the columns of search_documents
+// that is true for the rows that match sq, whose text must be parameter $1.
+// The values of the parameters of the filters of sq are appended to args,
+// and numbered accordingly.
+func searchCondition(sq *internal.SearchQuery, args []interface{}) (string, []interface{}, error) {
+	conds := []string{"($1 = '' OR tsv_search_tokens @@ websearch_to_tsquery($1))"}
+	for _, f := range sq.Filters {
+		pred, arg, err := searchFilterPredicate(f, len(args)+1)
+		if err != nil {
+			return "", nil, err
+		}
+		conds = append(conds, pred)
+		args = append(args, arg)
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// searchFilterPredicate returns a predicate on the columns of
+// search_documents that is true for the rows that satisfy f, and the value
+// of its parameter, which is numbered n.
+func searchFilterPredicate(f internal.SearchFilter, n int) (string, interface{}, error) {
+	switch f.Qualifier {
+	case internal.LicenseQualifier:
+		return fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM unnest(license_types) l
+			WHERE lower(l) = lower($%d))`, n), f.Value, nil
+	case internal.ModuleQualifier:
+		if !strings.Contains(f.Value, "*") {
+			return fmt.Sprintf("module_path = $%d", n), f.Value, nil
+		}
+		return fmt.Sprintf("module_path LIKE $%d", n), modulePatternToLike(f.Value), nil
+	case internal.GOOSQualifier:
+		// Documentation is stored only for the build contexts that select
+		// different files, so a package that builds the same way everywhere
+		// has documentation only for the first of internal.BuildContexts.
+		// Such a package has a single documentation row, and matches any
+		// GOOS. So, unavoidably, does a package that builds for only one
+		// GOOS.
+		return fmt.Sprintf(`EXISTS (
+			SELECT 1
+			FROM documentation d
+			INNER JOIN paths p ON p.id = d.path_id
+			INNER JOIN modules m ON m.id = p.module_id
+			WHERE p.path = search_documents.package_path
+			AND m.module_path = search_documents.module_path
+			AND m.version = search_documents.version
+			GROUP BY d.path_id
+			HAVING COUNT(*) = 1 OR bool_or(d.goos = $%d))`, n), f.Value, nil
+	case internal.NameQualifier:
+		return fmt.Sprintf("name = $%d", n), f.Value, nil
+	default:
+		return "", nil, fmt.Errorf("unknown search qualifier %q", f.Qualifier)
+	}
+}
+
+// modulePatternToLike converts the value of a module filter to a LIKE
+// pattern, escaping the characters that are special to LIKE.
+func modulePatternToLike(pattern string) string {
+	return strings.ReplaceAll(escapeLikePattern(pattern), "*", "%")
+}
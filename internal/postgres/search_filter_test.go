@@ -0,0 +1,82 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal/testing/sample"
+)
+
+func TestSearchWithFilters(t *testing.T) {
+	defer ResetTestDB(testDB, t)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	// Every package is named "foo". The one in b.com/m is documented for
+	// sample.GOOS and darwin, and the others only for sample.GOOS, as if
+	// they built the same way everywhere.
+	for _, path := range []string{"a.com/m", "a.com/n", "b.com/m"} {
+		m := sample.Module(path, sample.VersionString, "foo")
+		if path == "b.com/m" {
+			for _, u := range m.Units {
+				if u.Path == "b.com/m/foo" {
+					darwin := *u.Documentation[0]
+					darwin.GOOS = "darwin"
+					u.Documentation = append(u.Documentation, &darwin)
+				}
+			}
+		}
+		if err := testDB.InsertModule(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := testDB.db.Exec(ctx, `
+		UPDATE search_documents
+		SET license_types = '{BSD-3-Clause}', imported_by_count = 10
+		WHERE module_path = 'a.com/n'`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		q    string
+		want []string
+	}{
+		{"foo license:MIT", []string{"a.com/m/foo", "b.com/m/foo"}},
+		{`foo license:"bsd-3-clause"`, []string{"a.com/n/foo"}},
+		{"foo module:a.com/*", []string{"a.com/n/foo", "a.com/m/foo"}},
+		{"foo module:a.com/m", []string{"a.com/m/foo"}},
+		// Without text, packages are ordered by popularity.
+		{"module:a.com/*", []string{"a.com/n/foo", "a.com/m/foo"}},
+		{"foo goos:" + sample.GOOS, []string{"a.com/n/foo", "a.com/m/foo", "b.com/m/foo"}},
+		{"foo goos:darwin", []string{"a.com/n/foo", "a.com/m/foo", "b.com/m/foo"}},
+		{"foo goos:plan9", []string{"a.com/n/foo", "a.com/m/foo"}},
+		{"name:foo module:b.com/m", []string{"b.com/m/foo"}},
+		{"name:bar", nil},
+		// Filters combine with AND, so conflicting filters match nothing.
+		{"foo module:a.com/m module:b.com/m", nil},
+		{"foo license:MIT module:a.com/*", []string{"a.com/m/foo"}},
+		{"foo license:MIT license:BSD-3-Clause", nil},
+		// The "_" in the module pattern is not a wildcard.
+		{"foo module:a_com/*", nil},
+	} {
+		results, err := testDB.Search(ctx, test.q, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.PackagePath)
+			if r.NumResults != uint64(len(test.want)) {
+				t.Errorf("%q: %s: NumResults = %d, want %d", test.q, r.PackagePath, r.NumResults, len(test.want))
+			}
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("%q: mismatch (-want +got):\n%s", test.q, diff)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"golang.org/x/pkgsite/internal/database"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// GetSearchDocumentPaths returns, in order, at most limit package paths in
+// search_documents that begin with prefix and come after the path after. It is
+// used to page through the search documents under a prefix.
+func (db *DB) GetSearchDocumentPaths(ctx context.Context, prefix, after string, limit int) (paths []string, err error) {
+	defer derrors.Wrap(&err, "GetSearchDocumentPaths(ctx, %q, %q, %d)", prefix, after, limit)
+
+	query := `
+		SELECT package_path
+		FROM search_documents
+		WHERE package_path LIKE $1 AND package_path > $2
+		ORDER BY package_path
+		LIMIT $3`
+	err = db.db.RunQuery(ctx, query, func(rows *sql.Rows) error {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return err
+		}
+		paths = append(paths, p)
+		return nil
+	}, escapeLikePattern(prefix)+"%", after, limit)
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// UpsertSearchDocuments re-derives the search documents of the packages with
+// the given paths from their latest versions, and recomputes their
+// imported-by counts. It is used to refresh search_documents after a change
+// to how it is derived, such as to license classification, without waiting
+// for the jobs that refresh all of it.
+//
+// Internal packages, and packages that are no longer in the packages table,
+// are skipped.
+//
+// It is safe to call while modules are being inserted: everything is done in
+// one transaction, and rows are upserted in path order, as they are by
+// upsertSearchDocuments.
+func (db *DB) UpsertSearchDocuments(ctx context.Context, paths []string) (err error) {
+	defer derrors.Wrap(&err, "UpsertSearchDocuments(ctx, %d paths)", len(paths))
+
+	var nonInternal []string
+	for _, p := range paths {
+		if !isInternalPackage(p) {
+			nonInternal = append(nonInternal, p)
+		}
+	}
+	if len(nonInternal) == 0 {
+		return nil
+	}
+	return db.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		argsList, err := db.getLatestSearchDocumentArgs(ctx, tx, nonInternal)
+		if err != nil {
+			return err
+		}
+		var values []interface{}
+		for _, args := range argsList {
+			pathTokens, sectionB, sectionC, sectionD := searchDocumentValues(args)
+			values = append(values, args.PackagePath, pathTokens, sectionB, sectionC, sectionD)
+		}
+		if err := bulkUpsertSearchDocuments(ctx, tx, values); err != nil {
+			return err
+		}
+		return setImportedByCounts(ctx, tx, nonInternal)
+	})
+}
+
+// getLatestSearchDocumentArgs returns the arguments for upserting the search
+// documents of the latest versions of the packages with the given paths. As
+// in GetPackagesForSearchDocumentUpsert, the synopsis and README of a
+// non-redistributable package are omitted.
+func (db *DB) getLatestSearchDocumentArgs(ctx context.Context, tx *database.DB, paths []string) (argsList []upsertSearchDocumentArgs, err error) {
+	defer derrors.Wrap(&err, "getLatestSearchDocumentArgs(ctx, tx, %d paths)", len(paths))
+
+	query := fmt.Sprintf(`
+		SELECT
+			l.path,
+			l.module_path,
+			l.synopsis,
+			l.redistributable,
+			l.readme_file_path,
+			l.readme_contents
+		FROM
+			unnest($1::text[]) AS a(package_path)
+		CROSS JOIN LATERAL (
+			SELECT
+				p.path,
+				p.module_path,
+				p.synopsis,
+				p.redistributable,
+				m.readme_file_path,
+				m.readme_contents
+			FROM
+				packages p
+			INNER JOIN
+				modules m
+			ON
+				p.module_path = m.module_path
+				AND p.version = m.version
+			WHERE
+				p.path = a.package_path
+			%s
+			LIMIT 1
+		) l
+		ORDER BY l.path`, orderByLatest)
+
+	collect := func(rows *sql.Rows) error {
+		var (
+			a      upsertSearchDocumentArgs
+			redist bool
+		)
+		if err := rows.Scan(&a.PackagePath, &a.ModulePath, database.NullIsEmpty(&a.Synopsis), &redist,
+			database.NullIsEmpty(&a.ReadmeFilePath), database.NullIsEmpty(&a.ReadmeContents)); err != nil {
+			return err
+		}
+		if !redist && !db.bypassLicenseCheck {
+			a.Synopsis = ""
+			a.ReadmeFilePath = ""
+			a.ReadmeContents = ""
+		}
+		argsList = append(argsList, a)
+		return nil
+	}
+	if err := tx.RunQuery(ctx, query, collect, pq.Array(paths)); err != nil {
+		return nil, err
+	}
+	return argsList, nil
+}
+
+// setImportedByCounts sets the imported_by_count of the packages with the
+// given paths in search_documents to the number of packages that import them,
+// counting them as UpdateSearchDocumentsImportedByCount does.
+func setImportedByCounts(ctx context.Context, tx *database.DB, paths []string) (err error) {
+	defer derrors.Wrap(&err, "setImportedByCounts(ctx, tx, %d paths)", len(paths))
+
+	counts := map[string]int{}
+	query := `
+		SELECT DISTINCT
+			i.from_path, i.from_module_path, i.to_path
+		FROM
+			imports_unique i
+		INNER JOIN
+			search_documents s
+		ON
+			i.from_path = s.package_path
+		WHERE
+			i.to_path = ANY($1)`
+	err = tx.RunQuery(ctx, query, func(rows *sql.Rows) error {
+		var from, fromMod, to string
+		if err := rows.Scan(&from, &fromMod, &to); err != nil {
+			return err
+		}
+		if !isSameModuleImport(fromMod, to) {
+			counts[to]++
+		}
+		return nil
+	}, pq.Array(paths))
+	if err != nil {
+		return err
+	}
+	var values []int64
+	for _, p := range paths {
+		values = append(values, int64(counts[p]))
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE search_documents s
+		SET
+			imported_by_count = c.imported_by_count,
+			imported_by_count_updated_at = CURRENT_TIMESTAMP
+		FROM unnest($1::text[], $2::int[]) AS c(package_path, imported_by_count)
+		WHERE s.package_path = c.package_path`,
+		pq.Array(paths), pq.Array(values))
+	return err
+}
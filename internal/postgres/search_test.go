@@ -256,7 +256,7 @@ func TestSearch(t *testing.T) {
 			resultOrder: []string{"popular", "deep", "estimate"},
 			wantSource:  "deep",
 			wantResults: []string{"foo.com/popularB", "foo.com/popularA"},
-			wantTotal:   72,
+			wantTotal:   3, // modules, not packages
 		},
 		// Adding a test for *very* popular results requires ~300 importers
 		// minimum, which is pretty slow to set up at the moment (~5 seconds), and
@@ -571,8 +571,8 @@ func TestInsertSearchDocumentAndSearch(t *testing.T) {
 }
 
 func TestSearchPenalties(t *testing.T) {
-	// Verify that the penalties for non-redistributable modules and modules without
-	// go.mod files are applied correctly.
+	// Verify that the penalties for non-redistributable modules, modules without
+	// go.mod files and deprecated modules are applied correctly.
 	defer ResetTestDB(testDB, t)
 
 	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
@@ -583,12 +583,14 @@ func TestSearchPenalties(t *testing.T) {
 	modules := map[string]struct {
 		redist     bool
 		hasGoMod   bool
+		deprecated bool
 		multiplier float64 // applied to base score
 	}{
-		"both.com/foo":      {true, true, 1},
-		"nogomod.com/foo":   {true, false, noGoModPenalty},
-		"nonredist.com/foo": {false, true, nonRedistributablePenalty},
-		"neither.com/foo":   {false, false, noGoModPenalty * nonRedistributablePenalty},
+		"both.com/foo":       {true, true, false, 1},
+		"nogomod.com/foo":    {true, false, false, noGoModPenalty},
+		"nonredist.com/foo":  {false, true, false, nonRedistributablePenalty},
+		"neither.com/foo":    {false, false, false, noGoModPenalty * nonRedistributablePenalty},
+		"deprecated.com/foo": {true, true, true, deprecatedPenalty},
 	}
 
 	for path, m := range modules {
@@ -599,6 +601,16 @@ func TestSearchPenalties(t *testing.T) {
 		if err := testDB.InsertModule(ctx, v); err != nil {
 			t.Fatal(err)
 		}
+		if m.deprecated {
+			if err := testDB.UpdateLatestModuleVersions(ctx, &internal.LatestModuleVersions{
+				ModulePath:  path,
+				RawVersion:  sample.VersionString,
+				GoodVersion: sample.VersionString,
+				Deprecation: "use something else",
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
 	}
 
 	for method, searcher := range searchers {
@@ -621,6 +633,76 @@ func TestSearchPenalties(t *testing.T) {
 	}
 }
 
+func TestSearchGroupsByModule(t *testing.T) {
+	defer ResetTestDB(testDB, t)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	for _, m := range []*internal.Module{
+		sample.Module("a.com/m", sample.VersionString, "foo", "x/foo", "y/foo"),
+		sample.Module("b.com/n", sample.VersionString, "foo"),
+	} {
+		if err := testDB.InsertModule(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := testDB.db.Exec(ctx, `
+		UPDATE search_documents SET imported_by_count = 5 WHERE package_path = 'a.com/m/foo'`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every searcher returns one package for each module.
+	for method, searcher := range searchers {
+		res := searcher(testDB, ctx, "foo", 10, 0)
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		var got []string
+		for _, r := range res.results {
+			got = append(got, r.PackagePath)
+		}
+		if want := []string{"a.com/m/foo", "b.com/n/foo"}; !cmp.Equal(got, want) {
+			t.Errorf("%s: got %v, want %v", method, got, want)
+		}
+	}
+
+	type result struct {
+		Path             string
+		Name             string
+		NumOtherPackages uint64
+		OtherPackages    []string
+		NumResults       uint64
+	}
+	check := func(want []result) {
+		t.Helper()
+		results, err := testDB.Search(ctx, "foo", 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []result
+		for _, r := range results {
+			got = append(got, result{r.PackagePath, r.Name, r.NumOtherPackages, r.OtherPackages, r.NumResults})
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	}
+	check([]result{
+		{"a.com/m/foo", "foo", 2, []string{"a.com/m/x/foo", "a.com/m/y/foo"}, 2},
+		{"b.com/n/foo", "foo", 0, nil, 2},
+	})
+
+	// If the best package of a module is excluded, the next best one
+	// represents the module.
+	if err := testDB.InsertExcludedPrefix(ctx, "a.com/m/foo", "no user", "no reason"); err != nil {
+		t.Fatal(err)
+	}
+	check([]result{
+		{"a.com/m/x/foo", "foo", 1, []string{"a.com/m/y/foo"}, 2},
+		{"b.com/n/foo", "foo", 0, nil, 2},
+	})
+}
+
 func TestExcludedFromSearch(t *testing.T) {
 	// Verify that excluded paths are omitted from search results.
 	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
@@ -907,6 +989,36 @@ func TestUpdateSearchDocumentsImportedByCount(t *testing.T) {
 		_ = validateImportedByCountAndGetSearchDocument(t, pkgPath(mD), 1)
 	})
 
+	t.Run("incremental", func(t *testing.T) {
+		// Inserting the latest version of a module updates the counts of
+		// the packages it imports, without waiting for the recomputation.
+		defer ResetTestDB(testDB, t)
+
+		mA := insertPackageVersion(t, "A", "v1.0.0", nil)
+		mB := insertPackageVersion(t, "B", "v1.0.0", nil)
+		insertPackageVersion(t, "C", "v1.0.0", []string{"A"})
+		_ = validateImportedByCountAndGetSearchDocument(t, pkgPath(mA), 1)
+
+		// Reinserting the same version does not count C twice.
+		insertPackageVersion(t, "C", "v1.0.0", []string{"A"})
+		_ = validateImportedByCountAndGetSearchDocument(t, pkgPath(mA), 1)
+
+		// An older version of C does not change the counts.
+		insertPackageVersion(t, "C", "v0.9.0", []string{"B"})
+		_ = validateImportedByCountAndGetSearchDocument(t, pkgPath(mA), 1)
+		_ = validateImportedByCountAndGetSearchDocument(t, pkgPath(mB), 0)
+
+		// A newer version of C that imports B instead of A moves the count.
+		insertPackageVersion(t, "C", "v1.1.0", []string{"B"})
+		_ = validateImportedByCountAndGetSearchDocument(t, pkgPath(mA), 0)
+		_ = validateImportedByCountAndGetSearchDocument(t, pkgPath(mB), 1)
+
+		// The recomputation agrees.
+		updateImportedByCount()
+		_ = validateImportedByCountAndGetSearchDocument(t, pkgPath(mA), 0)
+		_ = validateImportedByCountAndGetSearchDocument(t, pkgPath(mB), 1)
+	})
+
 	t.Run("alternative", func(t *testing.T) {
 		// Test with alternative modules that are removed from search_documents.
 		defer ResetTestDB(testDB, t)
@@ -921,7 +1033,7 @@ func TestUpdateSearchDocumentsImportedByCount(t *testing.T) {
 		alternativeModulePath := strings.ToLower(canonicalModule.ModulePath)
 		alternativeStatus := derrors.ToStatus(derrors.AlternativeModule)
 		err := testDB.UpsertModuleVersionState(ctx, alternativeModulePath, "v1.2.0", "",
-			time.Now(), alternativeStatus, canonicalModule.ModulePath, nil, nil)
+			time.Now(), alternativeStatus, canonicalModule.ModulePath, "", "", "", nil, nil, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -0,0 +1,60 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// A ShortcutCandidate is a package that a shortcut path, like /yaml, may
+// refer to.
+type ShortcutCandidate struct {
+	PackagePath     string
+	Synopsis        string
+	ImportedByCount int
+}
+
+// GetShortcutCandidates returns the packages in search_documents whose name
+// or last path element is shortcut, excluding excluded packages. At most
+// limit candidates are returned, from the most to the least imported.
+//
+// Both conditions are served by indexes, idx_search_documents_name and
+// idx_search_documents_package_path_last_element, so that the lookup stays
+// cheap for any path that is not found.
+func (db *DB) GetShortcutCandidates(ctx context.Context, shortcut string, limit int) (_ []*ShortcutCandidate, err error) {
+	defer derrors.Wrap(&err, "DB.GetShortcutCandidates(ctx, %q, %d)", shortcut, limit)
+
+	var candidates []*ShortcutCandidate
+	err = db.db.RunQuery(ctx, `
+		SELECT package_path, synopsis, imported_by_count
+		FROM search_documents
+		WHERE name = $1 OR substring(package_path from '[^/]*$') = $1
+		ORDER BY imported_by_count DESC, package_path
+		LIMIT $2`, func(rows *sql.Rows) error {
+		var c ShortcutCandidate
+		if err := rows.Scan(&c.PackagePath, &c.Synopsis, &c.ImportedByCount); err != nil {
+			return err
+		}
+		candidates = append(candidates, &c)
+		return nil
+	}, shortcut, limit)
+	if err != nil {
+		return nil, err
+	}
+	var included []*ShortcutCandidate
+	for _, c := range candidates {
+		excluded, err := db.IsExcluded(ctx, c.PackagePath)
+		if err != nil {
+			return nil, err
+		}
+		if !excluded {
+			included = append(included, c)
+		}
+	}
+	return included, nil
+}
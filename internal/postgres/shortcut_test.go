@@ -0,0 +1,65 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal/testing/sample"
+)
+
+func TestGetShortcutCandidates(t *testing.T) {
+	defer ResetTestDB(testDB, t)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	for _, m := range []struct {
+		path     string
+		suffixes []string
+	}{
+		{"github.com/a/mod", []string{"yaml", "other"}},
+		{"github.com/b/mod", []string{"yaml"}},
+		{"github.com/c/mod", []string{"x/yaml"}},
+		{"github.com/spam/mod", []string{"yaml"}},
+	} {
+		if err := testDB.InsertModule(ctx, sample.Module(m.path, sample.VersionString, m.suffixes...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := testDB.db.Exec(ctx, `
+		UPDATE search_documents SET imported_by_count = 5
+		WHERE package_path = 'github.com/b/mod/yaml'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := testDB.InsertExcludedPrefix(ctx, "github.com/spam", "someone", "because"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		shortcut string
+		limit    int
+		want     []string
+	}{
+		// More imported packages come first.
+		{"yaml", 10, []string{"github.com/b/mod/yaml", "github.com/a/mod/yaml", "github.com/c/mod/x/yaml"}},
+		{"yaml", 1, []string{"github.com/b/mod/yaml"}},
+		{"other", 10, []string{"github.com/a/mod/other"}},
+		{"mod", 10, nil},
+	} {
+		got, err := testDB.GetShortcutCandidates(ctx, test.shortcut, test.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, c := range got {
+			paths = append(paths, c.PackagePath)
+		}
+		if diff := cmp.Diff(test.want, paths); diff != "" {
+			t.Errorf("GetShortcutCandidates(%q, %d) mismatch (-want, +got):\n%s", test.shortcut, test.limit, diff)
+		}
+	}
+}
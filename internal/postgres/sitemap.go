@@ -0,0 +1,114 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// A SitemapEntry is a package listed in the sitemap.
+type SitemapEntry struct {
+	PackagePath  string
+	LastModified time.Time // the commit time of the latest version
+}
+
+// A SitemapPage is a sitemap file: a range of the packages listed in the
+// sitemap, ordered by package path.
+type SitemapPage struct {
+	First        string    // the path of its first package
+	LastModified time.Time // the latest commit time of its packages
+}
+
+// GetSitemapPages splits the packages listed in the sitemap into pages of at
+// most pageSize packages. The packages listed are the latest version of each
+// package in search_documents that is redistributable and not excluded. Only
+// the pages are kept in memory; the rows are read as they are streamed.
+func (db *DB) GetSitemapPages(ctx context.Context, pageSize int) (_ []*SitemapPage, err error) {
+	defer derrors.Wrap(&err, "DB.GetSitemapPages(ctx, %d)", pageSize)
+
+	excluded, err := db.sitemapExclusions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		pages []*SitemapPage
+		n     int
+	)
+	err = db.db.RunQuery(ctx, `
+		SELECT package_path, commit_time
+		FROM search_documents
+		WHERE redistributable
+		ORDER BY package_path`, func(rows *sql.Rows) error {
+		var e SitemapEntry
+		if err := rows.Scan(&e.PackagePath, &e.LastModified); err != nil {
+			return err
+		}
+		if excluded.match(e.PackagePath) != "" {
+			return nil
+		}
+		if n%pageSize == 0 {
+			pages = append(pages, &SitemapPage{First: e.PackagePath})
+		}
+		n++
+		if p := pages[len(pages)-1]; e.LastModified.After(p.LastModified) {
+			p.LastModified = e.LastModified
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// GetSitemapEntries returns the entries of a sitemap page: up to limit of
+// the packages listed in the sitemap whose paths are at least first and less
+// than end, ordered by package path. If end is empty, the paths are not
+// bounded above.
+func (db *DB) GetSitemapEntries(ctx context.Context, first, end string, limit int) (_ []*SitemapEntry, err error) {
+	defer derrors.Wrap(&err, "DB.GetSitemapEntries(ctx, %q, %q, %d)", first, end, limit)
+
+	excluded, err := db.sitemapExclusions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*SitemapEntry
+	err = db.db.RunQuery(ctx, `
+		SELECT package_path, commit_time
+		FROM search_documents
+		WHERE
+			redistributable
+			AND package_path >= $1
+			AND ($2 = '' OR package_path < $2)
+		ORDER BY package_path`, func(rows *sql.Rows) error {
+		var e SitemapEntry
+		if err := rows.Scan(&e.PackagePath, &e.LastModified); err != nil {
+			return err
+		}
+		// Packages added since the pages were generated can make a page
+		// longer; they are left out until the next generation.
+		if excluded.match(e.PackagePath) == "" && len(entries) < limit {
+			entries = append(entries, &e)
+		}
+		return nil
+	}, first, end)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// sitemapExclusions returns the excluded prefixes, which are left out of the
+// sitemap.
+func (db *DB) sitemapExclusions(ctx context.Context) (*exclusionSet, error) {
+	db.ensureExcludedPrefixes(ctx)
+	excludedPrefixes.mu.Lock()
+	defer excludedPrefixes.mu.Unlock()
+	return excludedPrefixes.set, excludedPrefixes.err
+}
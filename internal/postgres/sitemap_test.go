@@ -0,0 +1,84 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/testing/sample"
+)
+
+func TestSitemap(t *testing.T) {
+	defer ResetTestDB(testDB, t)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	nonRedist := sample.Module("github.com/nonredist/mod", "v1.0.0", "pkg")
+	nonRedist.IsRedistributable = false
+	for _, u := range nonRedist.Units {
+		u.IsRedistributable = false
+	}
+	for _, p := range nonRedist.LegacyPackages {
+		p.IsRedistributable = false
+	}
+	for _, m := range []*internal.Module{
+		sample.Module("github.com/a/mod", "v1.0.0", "foo", "bar"),
+		sample.Module("github.com/a/mod", "v1.1.0", "foo", "bar"),
+		sample.Module("github.com/spam/mod", "v1.0.0", "pkg"),
+		nonRedist,
+	} {
+		if err := testDB.InsertModule(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := testDB.InsertExcludedPrefix(ctx, "github.com/spam", "someone", "because"); err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := testDB.GetSitemapPages(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var firsts []string
+	for _, p := range pages {
+		if !p.LastModified.Equal(sample.CommitTime) {
+			t.Errorf("%s: LastModified = %v, want %v", p.First, p.LastModified, sample.CommitTime)
+		}
+		firsts = append(firsts, p.First)
+	}
+	want := []string{"github.com/a/mod/bar", "github.com/a/mod/foo"}
+	if diff := cmp.Diff(want, firsts); diff != "" {
+		t.Errorf("pages mismatch (-want, +got):\n%s", diff)
+	}
+
+	for _, test := range []struct {
+		first, end string
+		limit      int
+		want       []string
+	}{
+		{"", "", 10, []string{"github.com/a/mod/bar", "github.com/a/mod/foo"}},
+		{"github.com/a/mod/bar", "github.com/a/mod/foo", 10, []string{"github.com/a/mod/bar"}},
+		{"github.com/a/mod/foo", "", 10, []string{"github.com/a/mod/foo"}},
+		{"", "", 1, []string{"github.com/a/mod/bar"}},
+	} {
+		entries, err := testDB.GetSitemapEntries(ctx, test.first, test.end, test.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range entries {
+			if !e.LastModified.Equal(sample.CommitTime) {
+				t.Errorf("%s: LastModified = %v, want %v", e.PackagePath, e.LastModified, sample.CommitTime)
+			}
+			got = append(got, e.PackagePath)
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("GetSitemapEntries(%q, %q, %d) mismatch (-want, +got):\n%s", test.first, test.end, test.limit, diff)
+		}
+	}
+}
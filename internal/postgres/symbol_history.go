@@ -0,0 +1,213 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/lib/pq"
+	"golang.org/x/mod/semver"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/database"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/version"
+)
+
+// ModuleSymbols holds the symbols of the packages of a release version of a
+// module.
+type ModuleSymbols struct {
+	Version string
+	// Packages maps the path of each package of the module version to its
+	// documentation, with only the GOOS, GOARCH and Symbols fields set.
+	// Documentation inserted before symbols were recorded is omitted.
+	Packages map[string][]*internal.Documentation
+}
+
+// A PackageSymbolIntroduction is a row of the symbol_history table.
+type PackageSymbolIntroduction struct {
+	PackagePath string
+	SymbolName  string
+	internal.SymbolIntroduction
+}
+
+// InsertSymbolHistory updates the symbol history of the module with
+// modulePath for the insertion of its release version, which must already be
+// in the database.
+//
+// Introductions are computed by comparing the symbols of a version with
+// those of the preceding release version, so inserting a version can change
+// the introductions at the version itself and at the following release
+// version, if there is one. InsertSymbolHistory calls introductions with the
+// symbols of the preceding version (nil if there is none), the version and
+// the following version (nil if there is none), and replaces the rows of the
+// module at the version and the following version with those that it
+// returns.
+//
+// It holds the same lock as InsertModule, so that the adjacent versions
+// cannot change while it runs.
+func (db *DB) InsertSymbolHistory(ctx context.Context, modulePath, vers string,
+	introductions func(prev, cur, next *ModuleSymbols) []*PackageSymbolIntroduction) (err error) {
+	defer derrors.Wrap(&err, "InsertSymbolHistory(ctx, %q, %q)", modulePath, vers)
+
+	if vt, err := version.ParseType(vers); err != nil || vt != version.TypeRelease {
+		return fmt.Errorf("not a release version: %w", derrors.InvalidArgument)
+	}
+	return db.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		if err := lock(ctx, tx, modulePath); err != nil {
+			return err
+		}
+		prev, cur, next, err := adjacentModuleSymbols(ctx, tx, modulePath, vers)
+		if err != nil {
+			return err
+		}
+		versions := []string{vers}
+		if next != nil {
+			versions = append(versions, next.Version)
+		}
+		if _, err := tx.Exec(ctx, `
+			DELETE FROM symbol_history
+			WHERE module_path = $1 AND version = ANY($2)`,
+			modulePath, pq.Array(versions)); err != nil {
+			return err
+		}
+		var values []interface{}
+		for _, in := range introductions(prev, cur, next) {
+			if in.Version != vers && (next == nil || in.Version != next.Version) {
+				return fmt.Errorf("introduction of %s in %s at %s: %w",
+					in.SymbolName, in.PackagePath, in.Version, derrors.InvalidArgument)
+			}
+			values = append(values, in.PackagePath, modulePath, in.SymbolName, in.GOOS, in.GOARCH, in.Version)
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		return tx.CopyIn(ctx, "symbol_history",
+			[]string{"package_path", "module_path", "symbol_name", "goos", "goarch", "version"}, values)
+	})
+}
+
+// GetSymbolHistory returns the symbol history of the package with
+// packagePath in the module with modulePath, keyed by symbol name. Symbols
+// with no introductions are not in the map.
+func (db *DB) GetSymbolHistory(ctx context.Context, packagePath, modulePath string) (_ internal.SymbolHistory, err error) {
+	defer derrors.Wrap(&err, "GetSymbolHistory(ctx, %q, %q)", packagePath, modulePath)
+
+	h := internal.SymbolHistory{}
+	err = db.db.RunQuery(ctx, `
+		SELECT symbol_name, goos, goarch, version
+		FROM symbol_history
+		WHERE package_path = $1 AND module_path = $2`,
+		func(rows *sql.Rows) error {
+			var (
+				name string
+				in   internal.SymbolIntroduction
+			)
+			if err := rows.Scan(&name, &in.GOOS, &in.GOARCH, &in.Version); err != nil {
+				return err
+			}
+			h[name] = append(h[name], &in)
+			return nil
+		}, packagePath, modulePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, intros := range h {
+		sortSymbolIntroductions(intros)
+	}
+	return h, nil
+}
+
+// adjacentModuleSymbols returns the symbols of modulePath@vers, and of the
+// release versions of the module immediately before and after it. prev or
+// next is nil if there is no such version. It returns an error wrapping
+// derrors.NotFound if modulePath@vers is not in the database.
+func adjacentModuleSymbols(ctx context.Context, db *database.DB, modulePath, vers string) (prev, cur, next *ModuleSymbols, err error) {
+	defer derrors.Wrap(&err, "adjacentModuleSymbols(ctx, %q, %q)", modulePath, vers)
+
+	var x int
+	err = db.QueryRow(ctx, `SELECT 1 FROM modules WHERE module_path = $1 AND version = $2`,
+		modulePath, vers).Scan(&x)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil, nil, derrors.NotFound
+	case nil:
+	default:
+		return nil, nil, nil, err
+	}
+	adjacent := func(cmp, order string) (*ModuleSymbols, error) {
+		var v string
+		err := db.QueryRow(ctx, fmt.Sprintf(`
+			SELECT version
+			FROM modules
+			WHERE module_path = $1 AND version_type = 'release' AND sort_version %s $2
+			ORDER BY sort_version %s
+			LIMIT 1`, cmp, order),
+			modulePath, version.ForSorting(vers)).Scan(&v)
+		switch err {
+		case sql.ErrNoRows:
+			return nil, nil
+		case nil:
+			return moduleSymbols(ctx, db, modulePath, v)
+		default:
+			return nil, err
+		}
+	}
+	if prev, err = adjacent("<", "DESC"); err != nil {
+		return nil, nil, nil, err
+	}
+	if next, err = adjacent(">", "ASC"); err != nil {
+		return nil, nil, nil, err
+	}
+	if cur, err = moduleSymbols(ctx, db, modulePath, vers); err != nil {
+		return nil, nil, nil, err
+	}
+	return prev, cur, next, nil
+}
+
+// moduleSymbols returns the symbols of the packages of modulePath@vers.
+func moduleSymbols(ctx context.Context, db *database.DB, modulePath, vers string) (*ModuleSymbols, error) {
+	ms := &ModuleSymbols{Version: vers, Packages: map[string][]*internal.Documentation{}}
+	err := db.RunQuery(ctx, `
+		SELECT p.path, d.goos, d.goarch, d.symbols
+		FROM modules m
+		INNER JOIN paths p ON p.module_id = m.id
+		INNER JOIN documentation d ON d.path_id = p.id
+		WHERE m.module_path = $1 AND m.version = $2 AND d.symbols IS NOT NULL`,
+		func(rows *sql.Rows) error {
+			var (
+				path string
+				doc  internal.Documentation
+			)
+			if err := rows.Scan(&path, &doc.GOOS, &doc.GOARCH, pq.Array(&doc.Symbols)); err != nil {
+				return err
+			}
+			ms.Packages[path] = append(ms.Packages[path], &doc)
+			return nil
+		}, modulePath, vers)
+	if err != nil {
+		return nil, err
+	}
+	for _, docs := range ms.Packages {
+		internal.SortDocumentation(docs)
+	}
+	return ms, nil
+}
+
+// sortSymbolIntroductions sorts intros by version, then by build context.
+func sortSymbolIntroductions(intros []*internal.SymbolIntroduction) {
+	sort.Slice(intros, func(i, j int) bool {
+		a, b := intros[i], intros[j]
+		if c := semver.Compare(a.Version, b.Version); c != 0 {
+			return c < 0
+		}
+		if a.GOOS != b.GOOS {
+			return a.GOOS < b.GOOS
+		}
+		return a.GOARCH < b.GOARCH
+	})
+}
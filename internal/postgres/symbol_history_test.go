@@ -0,0 +1,128 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/testing/sample"
+)
+
+func TestSymbolHistory(t *testing.T) {
+	defer ResetTestDB(testDB, t)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	const (
+		modulePath = "example.com/symbols"
+		pkgPath    = modulePath + "/p"
+	)
+	insert := func(version string, symbols ...string) {
+		t.Helper()
+		m := sample.Module(modulePath, version, "p")
+		for _, u := range m.Units {
+			if u.Path != pkgPath {
+				continue
+			}
+			d := *sample.Documentation
+			d.Symbols = symbols
+			u.Documentation = []*internal.Documentation{&d}
+		}
+		if err := testDB.InsertModule(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// introductions records the symbols of each version that are not in the
+	// previous one, for the only build context of the test.
+	introductions := func(prev, cur, next *ModuleSymbols) []*PackageSymbolIntroduction {
+		var ins []*PackageSymbolIntroduction
+		add := func(prev, cur *ModuleSymbols) {
+			if prev == nil || cur == nil || len(prev.Packages[pkgPath]) == 0 {
+				return
+			}
+			old := map[string]bool{}
+			for _, s := range prev.Packages[pkgPath][0].Symbols {
+				old[s] = true
+			}
+			for _, s := range cur.Packages[pkgPath][0].Symbols {
+				if !old[s] {
+					ins = append(ins, &PackageSymbolIntroduction{
+						PackagePath: pkgPath,
+						SymbolName:  s,
+						SymbolIntroduction: internal.SymbolIntroduction{
+							Version: cur.Version,
+							GOOS:    sample.GOOS,
+							GOARCH:  sample.GOARCH,
+						},
+					})
+				}
+			}
+		}
+		add(prev, cur)
+		add(cur, next)
+		return ins
+	}
+	insertHistory := func(version string) {
+		t.Helper()
+		if err := testDB.InsertSymbolHistory(ctx, modulePath, version, introductions); err != nil {
+			t.Fatal(err)
+		}
+	}
+	in := func(version string) *internal.SymbolIntroduction {
+		return &internal.SymbolIntroduction{Version: version, GOOS: sample.GOOS, GOARCH: sample.GOARCH}
+	}
+	check := func(want internal.SymbolHistory) {
+		t.Helper()
+		got, err := testDB.GetSymbolHistory(ctx, pkgPath, modulePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("GetSymbolHistory mismatch (-want, +got):\n%s", diff)
+		}
+	}
+
+	// Insert versions out of order. B is removed in v1.2.0 and restored in
+	// v1.3.0.
+	insert("v1.0.0", "A")
+	insertHistory("v1.0.0")
+	insert("v1.3.0", "A", "B", "C")
+	insertHistory("v1.3.0")
+	check(internal.SymbolHistory{"B": {in("v1.3.0")}, "C": {in("v1.3.0")}})
+
+	insert("v1.1.0", "A", "B")
+	insertHistory("v1.1.0")
+	check(internal.SymbolHistory{"B": {in("v1.1.0")}, "C": {in("v1.3.0")}})
+
+	insert("v1.2.0", "A", "C")
+	insertHistory("v1.2.0")
+	want := internal.SymbolHistory{"B": {in("v1.1.0"), in("v1.3.0")}, "C": {in("v1.2.0")}}
+	check(want)
+
+	// Pseudo-versions are not part of the history.
+	const pseudo = "v1.3.1-0.20200101000000-aaaaaaaaaaaa"
+	insert(pseudo, "A", "B", "C", "D")
+	if err := testDB.InsertSymbolHistory(ctx, modulePath, pseudo, introductions); !errors.Is(err, derrors.InvalidArgument) {
+		t.Errorf("InsertSymbolHistory(%q): got %v, want InvalidArgument", pseudo, err)
+	}
+	// Introductions must be at the inserted version or the next one.
+	wrongVersion := func(prev, cur, next *ModuleSymbols) []*PackageSymbolIntroduction {
+		return []*PackageSymbolIntroduction{{PackagePath: pkgPath, SymbolName: "A", SymbolIntroduction: *in("v1.0.0")}}
+	}
+	if err := testDB.InsertSymbolHistory(ctx, modulePath, "v1.2.0", wrongVersion); !errors.Is(err, derrors.InvalidArgument) {
+		t.Errorf("InsertSymbolHistory with a wrong version: got %v, want InvalidArgument", err)
+	}
+	check(want)
+
+	if err := testDB.DeleteModule(ctx, modulePath, "v1.3.0"); err != nil {
+		t.Fatal(err)
+	}
+	check(internal.SymbolHistory{"B": {in("v1.1.0")}, "C": {in("v1.2.0")}})
+}
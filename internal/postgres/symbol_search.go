@@ -0,0 +1,173 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/database"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/godoc"
+)
+
+// Weights of the ways that the name of a symbol can match a symbol search
+// query, applied as multipliers to the score.
+const (
+	// The symbol name is the query, like "Client.Do" for "Client.Do".
+	exactSymbolMatch = 1.0
+	// The symbol name is the query, ignoring case.
+	caseInsensitiveSymbolMatch = 0.5
+	// The last component of the symbol name is the query, ignoring case,
+	// like "Client.Do" for "do".
+	memberSymbolMatch = 0.25
+)
+
+// upsertSymbolSearchDocuments replaces the rows of symbol_search_documents of
+// the packages of mod whose search documents are at the version of mod, so
+// that the symbols of a package are those of the version that search shows.
+// Like upsertSearchDocuments, it assumes that all non-redistributable data
+// has been removed from mod, and it must be called in a transaction, after
+// upsertSearchDocuments.
+func upsertSymbolSearchDocuments(ctx context.Context, db *database.DB, mod *internal.Module) (err error) {
+	defer derrors.Wrap(&err, "upsertSymbolSearchDocuments(ctx, %q, %q)", mod.ModulePath, mod.Version)
+
+	var paths []string
+	for _, u := range mod.Units {
+		if u.IsPackage() && !isInternalPackage(u.Path) {
+			paths = append(paths, u.Path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	current := map[string]bool{}
+	err = db.RunQuery(ctx, `
+		SELECT package_path
+		FROM search_documents
+		WHERE package_path = ANY($1) AND module_path = $2 AND version = $3`,
+		func(rows *sql.Rows) error {
+			var path string
+			if err := rows.Scan(&path); err != nil {
+				return err
+			}
+			current[path] = true
+			return nil
+		}, pq.Array(paths), mod.ModulePath, mod.Version)
+	if err != nil {
+		return err
+	}
+	if len(current) == 0 {
+		return nil
+	}
+	var (
+		currentPaths []string
+		values       []interface{}
+	)
+	for _, u := range mod.Units {
+		if !current[u.Path] {
+			continue
+		}
+		currentPaths = append(currentPaths, u.Path)
+		kinds := godoc.SymbolKinds(u.Documentation)
+		var names []string
+		for name := range kinds {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			values = append(values, u.Path, name, name[strings.LastIndex(name, ".")+1:], kinds[name])
+		}
+	}
+	if _, err := db.Exec(ctx, `DELETE FROM symbol_search_documents WHERE package_path = ANY($1)`,
+		pq.Array(currentPaths)); err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	cols := []string{"package_path", "symbol_name", "name", "kind"}
+	return db.BulkInsert(ctx, "symbol_search_documents", cols, values, "")
+}
+
+// SearchSymbols returns the symbols of the packages in search_documents that
+// match sq, with the highest scoring first, and at most limit of them.
+//
+// A symbol matches if its name is sq.Name, ignoring case, or, if sq.Name is
+// not qualified by a type, if sq.Name is the name of a method or field. The
+// score of a symbol is the product of the weight of the way that it matched,
+// the log of the number of packages that import its package, and the same
+// penalties for non-redistributable and deprecated modules as in Search.
+func (db *DB) SearchSymbols(ctx context.Context, sq *internal.SymbolQuery, limit int) (_ []*internal.SymbolSearchResult, err error) {
+	defer derrors.Wrap(&err, "DB.SearchSymbols(ctx, %+v, %d)", sq, limit)
+
+	nameColumn := "s.name"
+	if strings.Contains(sq.Name, ".") {
+		nameColumn = "s.symbol_name"
+	}
+	terms := sq.PackageTerms
+	if terms == nil {
+		terms = []string{}
+	}
+	query := fmt.Sprintf(`
+		SELECT
+			s.symbol_name,
+			s.kind,
+			d.package_path,
+			d.module_path,
+			d.version,
+			d.imported_by_count,
+			CASE
+				WHEN s.symbol_name = $1 THEN %[2]f
+				WHEN lower(s.symbol_name) = lower($1) THEN %[3]f
+				ELSE %[4]f
+			END *
+			ln(exp(1)+d.imported_by_count) *
+			CASE WHEN d.redistributable THEN 1 ELSE %[5]f END *
+			CASE WHEN d.deprecated THEN %[6]f ELSE 1 END AS score
+		FROM symbol_search_documents s
+		INNER JOIN search_documents d
+		ON s.package_path = d.package_path
+		WHERE lower(%[1]s) = lower($1)
+		AND ($2 = '' OR d.name = $2)
+		AND NOT EXISTS (
+			SELECT 1 FROM unnest($3::text[]) t
+			WHERE strpos(lower(d.package_path), lower(t)) = 0
+		)
+		ORDER BY score DESC, d.package_path, s.symbol_name
+		LIMIT $4`,
+		nameColumn, exactSymbolMatch, caseInsensitiveSymbolMatch, memberSymbolMatch,
+		nonRedistributablePenalty, deprecatedPenalty)
+	var results []*internal.SymbolSearchResult
+	collect := func(rows *sql.Rows) error {
+		var r internal.SymbolSearchResult
+		if err := rows.Scan(&r.SymbolName, &r.SymbolKind, &r.PackagePath, &r.ModulePath, &r.Version,
+			&r.NumImportedBy, &r.Score); err != nil {
+			return fmt.Errorf("rows.Scan(): %v", err)
+		}
+		results = append(results, &r)
+		return nil
+	}
+	if err := db.db.RunQuery(ctx, query, collect, sq.Name, sq.PackageName, pq.Array(terms), limit); err != nil {
+		return nil, err
+	}
+	// Filter out excluded paths, as Search does.
+	var unexcluded []*internal.SymbolSearchResult
+	for _, r := range results {
+		ex, err := db.IsExcluded(ctx, r.PackagePath)
+		if err != nil {
+			return nil, err
+		}
+		if !ex {
+			unexcluded = append(unexcluded, r)
+		}
+	}
+	return unexcluded, nil
+}
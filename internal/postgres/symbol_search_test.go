@@ -0,0 +1,98 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/safehtml/testconversions"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/testing/sample"
+)
+
+func TestSearchSymbols(t *testing.T) {
+	defer ResetTestDB(testDB, t)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	// insert inserts a module with a single package, whose documentation
+	// has the given symbols and HTML.
+	insert := func(modulePath, version, suffix, docHTML string, symbols ...string) {
+		t.Helper()
+		m := sample.Module(modulePath, version, suffix)
+		for _, u := range m.Units {
+			if u.IsPackage() {
+				u.Documentation[0].Symbols = symbols
+				u.Documentation[0].HTML = testconversions.MakeHTMLForTest(docHTML)
+			}
+		}
+		if err := testDB.InsertModule(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const unmarshalHTML = `<div class="Documentation-function"><h3 id="Unmarshal" data-kind="function">func Unmarshal</h3><pre>func Unmarshal()</pre></div>`
+	insert("example.com/json", "v1.0.0", "json", unmarshalHTML, "Unmarshal", "Old")
+	// The symbols of the latest version replace those of earlier versions,
+	// but not the other way around.
+	insert("example.com/json", "v1.1.0", "json", unmarshalHTML, "Decoder", "Decoder.Unmarshal", "Unmarshal")
+	insert("example.com/json", "v0.9.0", "json", "", "Older")
+	insert("example.com/yaml", "v1.0.0", "yaml", "", "Unmarshal", "Client.Do")
+	insert("example.com/internal", "v1.0.0", "internal/json", "", "Unmarshal")
+	if _, err := testDB.db.Exec(ctx, `
+		UPDATE search_documents SET imported_by_count = 10 WHERE package_path = 'example.com/yaml/yaml'`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		q    string
+		want []string
+	}{
+		// The more popular package is first, then the exact match of the
+		// name of the method.
+		{"Unmarshal", []string{
+			"example.com/yaml/yaml Unmarshal ",
+			"example.com/json/json Unmarshal function",
+			"example.com/json/json Decoder.Unmarshal ",
+		}},
+		{"unmarshal", nil},
+		{"#unmarshal json", []string{
+			"example.com/json/json Unmarshal function",
+			"example.com/json/json Decoder.Unmarshal ",
+		}},
+		{"yaml.Unmarshal", []string{"example.com/yaml/yaml Unmarshal "}},
+		{"Client.Do", []string{"example.com/yaml/yaml Client.Do "}},
+		{"Old", nil},
+		{"Older", nil},
+	} {
+		var got []string
+		if sq, ok := internal.ParseSymbolQuery(test.q); ok {
+			results, err := testDB.SearchSymbols(ctx, sq, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range results {
+				got = append(got, r.PackagePath+" "+r.SymbolName+" "+r.SymbolKind)
+			}
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("%q: mismatch (-want +got):\n%s", test.q, diff)
+		}
+	}
+
+	// Deleting the module removes its symbols.
+	if err := testDB.DeleteModule(ctx, "example.com/yaml", "v1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	sq, _ := internal.ParseSymbolQuery("Client.Do")
+	results, err := testDB.SearchSymbols(ctx, sq, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("after DeleteModule: got %d results, want none", len(results))
+	}
+}
@@ -106,7 +106,11 @@ func ResetTestDB(db *DB, t *testing.T) {
 			TRUNCATE modules CASCADE;
 			TRUNCATE version_map;
 			TRUNCATE imports_unique;
-			TRUNCATE experiments;`); err != nil {
+			TRUNCATE experiments;
+			TRUNCATE latest_module_versions;
+			TRUNCATE symbol_history;
+			TRUNCATE module_fetch_stats;
+			TRUNCATE vuln_entries CASCADE;`); err != nil {
 			return err
 		}
 		if _, err := tx.Exec(ctx, `TRUNCATE module_version_states CASCADE;`); err != nil {
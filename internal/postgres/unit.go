@@ -36,8 +36,8 @@ func (db *DB) GetUnit(ctx context.Context, um *internal.UnitMeta, fields interna
 		}
 		u.Readme = readme
 	}
-	if fields&internal.WithDocumentation != 0 {
-		doc, err := db.getDocumentation(ctx, pathID)
+	if fields&(internal.WithDocumentation|internal.WithDocumentationSource|internal.WithDocumentationAPI) != 0 {
+		doc, err := db.getDocumentation(ctx, pathID, fields)
 		if err != nil && !errors.Is(err, derrors.NotFound) {
 			return nil, err
 		}
@@ -72,6 +72,53 @@ func (db *DB) GetUnit(ctx context.Context, um *internal.UnitMeta, fields interna
 	return u, nil
 }
 
+// GetUnitByContentHash returns the package at pkgPath whose content hash is
+// contentHash, from the highest version of its module that was last processed
+// by the worker with the given app version. Only the fields needed to reuse
+// the package for another version are populated: its name, the module path
+// and version, its documentation, including source, and its imports. It
+// returns an error wrapping derrors.NotFound if there is no such package.
+func (db *DB) GetUnitByContentHash(ctx context.Context, pkgPath, contentHash, appVersion string) (_ *internal.Unit, err error) {
+	defer derrors.Wrap(&err, "GetUnitByContentHash(ctx, %q, %q, %q)", pkgPath, contentHash, appVersion)
+
+	if contentHash == "" {
+		return nil, derrors.NotFound
+	}
+	var pathID int
+	u := &internal.Unit{UnitMeta: internal.UnitMeta{Path: pkgPath}, ContentHash: contentHash}
+	err = db.db.QueryRow(ctx, `
+		SELECT p.id, p.name, m.module_path, m.version
+		FROM paths p
+		INNER JOIN modules m ON p.module_id = m.id
+		INNER JOIN module_version_states s
+		ON s.module_path = m.module_path AND s.version = m.version
+		WHERE
+			p.path = $1
+			AND p.content_hash = $2
+			AND s.app_version = $3
+		ORDER BY m.sort_version DESC
+		LIMIT 1`, pkgPath, contentHash, appVersion).Scan(&pathID, &u.Name, &u.ModulePath, &u.Version)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, derrors.NotFound
+	case nil:
+	default:
+		return nil, err
+	}
+	u.Documentation, err = db.getDocumentation(ctx, pathID, internal.WithDocumentationSource|internal.WithDocumentationAPI)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.getDocumentationSymbols(ctx, pathID, u.Documentation); err != nil {
+		return nil, err
+	}
+	u.Imports, err = db.getImports(ctx, pathID)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
 func (db *DB) getPathID(ctx context.Context, fullPath, modulePath, version string) (_ int, err error) {
 	defer derrors.Wrap(&err, "getPathID(ctx, %q, %q, %q)", fullPath, modulePath, version)
 	var pathID int
@@ -94,36 +141,130 @@ func (db *DB) getPathID(ctx context.Context, fullPath, modulePath, version strin
 	}
 }
 
-// getDocumentation returns the documentation corresponding to pathID.
-func (db *DB) getDocumentation(ctx context.Context, pathID int) (_ *internal.Documentation, err error) {
-	defer derrors.Wrap(&err, "getDocumentation(ctx, %d)", pathID)
-	var (
-		doc     internal.Documentation
-		docHTML string
-	)
-	err = db.db.QueryRow(ctx, `
+// getDocumentation returns the documentation corresponding to pathID, for
+// each build context, in the order of internal.BuildContexts. If fields
+// contains internal.WithDocumentationSource or internal.WithDocumentationAPI,
+// the Source or API field of each Documentation is also read.
+func (db *DB) getDocumentation(ctx context.Context, pathID int, fields internal.FieldSet) (_ []*internal.Documentation, err error) {
+	defer derrors.Wrap(&err, "getDocumentation(ctx, %d, %d)", pathID, fields)
+	withSource := fields&internal.WithDocumentationSource != 0
+	withAPI := fields&internal.WithDocumentationAPI != 0
+	var docs []*internal.Documentation
+	collect := func(rows *sql.Rows) error {
+		var (
+			doc            internal.Documentation
+			docHTML        string
+			compressedHTML []byte
+			source, api    []byte
+		)
+		dest := []interface{}{
+			database.NullIsEmpty(&doc.GOOS),
+			database.NullIsEmpty(&doc.GOARCH),
+			database.NullIsEmpty(&doc.Synopsis),
+			database.NullIsEmpty(&doc.FullSynopsis),
+			database.NullIsEmpty(&docHTML),
+			&compressedHTML,
+		}
+		if withSource {
+			dest = append(dest, &source)
+		}
+		if withAPI {
+			dest = append(dest, &api)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if err := decodeDocumentation(&doc, docHTML, compressedHTML, source, api); err != nil {
+			return err
+		}
+		docs = append(docs, &doc)
+		return nil
+	}
+	extraCols := ""
+	if withSource {
+		extraCols = ", d.zip"
+	}
+	if withAPI {
+		extraCols += ", d.api"
+	}
+	if err := db.db.RunQuery(ctx, `
 		SELECT
 			d.goos,
 			d.goarch,
 			d.synopsis,
-			d.html
+			d.full_synopsis,
+			d.html,
+			d.compressed_html`+extraCols+`
 		FROM documentation d
 		WHERE
-		    d.path_id=$1;`, pathID).Scan(
-		database.NullIsEmpty(&doc.GOOS),
-		database.NullIsEmpty(&doc.GOARCH),
-		database.NullIsEmpty(&doc.Synopsis),
-		database.NullIsEmpty(&docHTML),
+		    d.path_id=$1;`, collect, pathID); err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, derrors.NotFound
+	}
+	internal.SortDocumentation(docs)
+	return docs, nil
+}
+
+// getDocumentationSymbols sets the Symbols of each of docs, the documentation
+// corresponding to pathID.
+func (db *DB) getDocumentationSymbols(ctx context.Context, pathID int, docs []*internal.Documentation) (err error) {
+	defer derrors.Wrap(&err, "getDocumentationSymbols(ctx, %d)", pathID)
+	return db.db.RunQuery(ctx, `
+		SELECT goos, goarch, symbols
+		FROM documentation
+		WHERE path_id = $1`, func(rows *sql.Rows) error {
+		var (
+			goos, goarch string
+			symbols      []string
+		)
+		if err := rows.Scan(&goos, &goarch, pq.Array(&symbols)); err != nil {
+			return err
+		}
+		for _, d := range docs {
+			if d.GOOS == goos && d.GOARCH == goarch {
+				d.Symbols = symbols
+			}
+		}
+		return nil
+	}, pathID)
+}
+
+// GetModuleReadme returns the README of the module with modulePath at
+// version, without reading any other data of the module's units. If the root
+// of the module is not redistributable, the contents of the README are
+// removed. It returns an error wrapping derrors.NotFound if the module has no
+// README.
+func (db *DB) GetModuleReadme(ctx context.Context, modulePath, version string) (_ *internal.Readme, err error) {
+	defer derrors.Wrap(&err, "GetModuleReadme(ctx, %q, %q)", modulePath, version)
+
+	var (
+		readme          internal.Readme
+		redistributable bool
 	)
+	err = db.db.QueryRow(ctx, `
+		SELECT r.file_path, r.contents, p.redistributable
+		FROM modules m
+		INNER JOIN paths p
+		ON p.module_id = m.id
+		INNER JOIN readmes r
+		ON p.id = r.path_id
+		WHERE
+		    m.module_path = $1
+			AND m.version = $2
+			AND p.path = m.module_path`, modulePath, version).Scan(&readme.Filepath, &readme.Contents, &redistributable)
 	switch err {
 	case sql.ErrNoRows:
 		return nil, derrors.NotFound
 	case nil:
-		doc.HTML = convertDocumentation(docHTML)
-		return &doc, nil
 	default:
 		return nil, err
 	}
+	if !redistributable && !db.bypassLicenseCheck {
+		readme.Contents = ""
+	}
+	return &readme, nil
 }
 
 // getReadme returns the README corresponding to the modulePath and version.
@@ -175,28 +316,64 @@ func (db *DB) getImports(ctx context.Context, pathID int) (_ []string, err error
 	return imports, nil
 }
 
+// buildContextNames returns the build contexts of internal.BuildContexts as
+// "GOOS/GOARCH" strings, in order of preference. Queries pass them as a
+// parameter and rank the rows of the documentation table d with
+// array_position($n::text[], d.goos || '/' || d.goarch), which puts other
+// build contexts last.
+func buildContextNames() []string {
+	var names []string
+	for _, bc := range internal.BuildContexts {
+		names = append(names, bc.GOOS+"/"+bc.GOARCH)
+	}
+	return names
+}
+
 // getPackagesInUnit returns all of the packages in a unit from a
 // module version, including the package that lives at fullPath, if present.
+// It also returns the packages below fullPath in the latest version of each
+// nested module, whose ModulePath differs from modulePath. Packages are
+// sorted by path, and those of the module version come first for a path.
 func (db *DB) getPackagesInUnit(ctx context.Context, fullPath, modulePath, resolvedVersion string) (_ []*internal.PackageMeta, err error) {
 	defer derrors.Wrap(&err, "DB.getPackagesInUnit(ctx, %q, %q, %q)", fullPath, modulePath, resolvedVersion)
 
+	// A package has a row in documentation for each of its build contexts.
+	// Take the synopsis from the preferred one.
+	// Nested modules are chosen as in GetNestedModules, excluding the other
+	// major versions of modulePath.
 	query := `
-		SELECT
+		WITH nested AS (
+			SELECT DISTINCT ON (series_path) id
+			FROM modules
+			WHERE
+				$3 != $4
+				AND module_path LIKE $3 || '/%'
+				AND series_path != $5
+			ORDER BY
+				series_path,
+				retracted,
+				incompatible,
+				version_type = 'release' DESC,
+				sort_version DESC
+		)
+		SELECT DISTINCT ON (p.path, m.module_path != $1, m.module_path)
 			p.path,
 			p.name,
 			p.redistributable,
 			d.synopsis,
 			p.license_types,
-			p.license_paths
+			p.license_paths,
+			m.module_path,
+			m.version
 		FROM modules m
 		INNER JOIN paths p
 		ON p.module_id = m.id
 		INNER JOIN documentation d
 		ON d.path_id = p.id
 		WHERE
-			m.module_path = $1
-			AND m.version = $2
-		ORDER BY path;`
+			(m.module_path = $1 AND m.version = $2)
+			OR m.id IN (SELECT id FROM nested)
+		ORDER BY p.path, m.module_path != $1, m.module_path, array_position($6::text[], d.goos || '/' || d.goarch);`
 	var packages []*internal.PackageMeta
 	collect := func(rows *sql.Rows) error {
 		var (
@@ -211,6 +388,8 @@ func (db *DB) getPackagesInUnit(ctx context.Context, fullPath, modulePath, resol
 			&pkg.Synopsis,
 			pq.Array(&licenseTypes),
 			pq.Array(&licensePaths),
+			&pkg.ModulePath,
+			&pkg.Version,
 		); err != nil {
 			return fmt.Errorf("row.Scan(): %v", err)
 		}
@@ -224,7 +403,8 @@ func (db *DB) getPackagesInUnit(ctx context.Context, fullPath, modulePath, resol
 		}
 		return nil
 	}
-	if err := db.db.RunQuery(ctx, query, collect, modulePath, resolvedVersion); err != nil {
+	if err := db.db.RunQuery(ctx, query, collect, modulePath, resolvedVersion,
+		fullPath, stdlib.ModulePath, internal.SeriesPathForModule(modulePath), pq.Array(buildContextNames())); err != nil {
 		return nil, err
 	}
 	if !db.bypassLicenseCheck {
@@ -6,16 +6,27 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"net/http"
 	"path"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/google/safehtml"
+	"github.com/lib/pq"
 	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/database"
+	"golang.org/x/pkgsite/internal/derrors"
 	"golang.org/x/pkgsite/internal/licenses"
 	"golang.org/x/pkgsite/internal/source"
 	"golang.org/x/pkgsite/internal/stdlib"
+	"golang.org/x/pkgsite/internal/testing/dbtest"
 	"golang.org/x/pkgsite/internal/testing/sample"
 )
 
@@ -51,17 +62,24 @@ func TestGetUnit(t *testing.T) {
 			path:       "github.com/hashicorp/vault",
 			modulePath: "github.com/hashicorp/vault",
 			version:    "v1.0.3",
-			want: unit("github.com/hashicorp/vault", "github.com/hashicorp/vault", "v1.0.3", "",
-				&internal.Readme{
-					Filepath: sample.ReadmeFilePath,
-					Contents: sample.ReadmeContents,
-				},
-				[]string{
-					"api",
-					"builtin/audit/file",
-					"builtin/audit/socket",
-				},
-			),
+			want: func() *internal.Unit {
+				u := unit("github.com/hashicorp/vault", "github.com/hashicorp/vault", "v1.0.3", "",
+					&internal.Readme{
+						Filepath: sample.ReadmeFilePath,
+						Contents: sample.ReadmeContents,
+					},
+					[]string{
+						"api",
+						"builtin/audit/file",
+						"builtin/audit/socket",
+					},
+				)
+				// The package of the module version comes before the
+				// package of the nested module with the same path.
+				nested := subdirectories("github.com/hashicorp/vault/api", "v1.1.2", []string{""})
+				u.Subdirectories = append(u.Subdirectories[:1], append(nested, u.Subdirectories[1:]...)...)
+				return u
+			}(),
 		},
 		{
 			name:       "package path",
@@ -198,7 +216,7 @@ func TestGetUnitFieldSet(t *testing.T) {
 	cleanFields := func(u *internal.Unit, fields internal.FieldSet) {
 		// Add/remove fields based on the FieldSet specified.
 		if fields&internal.WithDocumentation != 0 {
-			u.Documentation = sample.Documentation
+			u.Documentation = []*internal.Documentation{sample.Documentation}
 		}
 		if fields&internal.WithImports != 0 {
 			u.Imports = sample.Imports
@@ -264,6 +282,70 @@ func TestGetUnitFieldSet(t *testing.T) {
 	}
 }
 
+func TestGetUnitByContentHash(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	defer ResetTestDB(testDB, t)
+
+	const (
+		modulePath = "a.com/m"
+		pkgPath    = "a.com/m/p"
+		hash       = "hash"
+	)
+	for _, v := range []struct{ version, appVersion string }{
+		{"v1.0.0", "app"},
+		{"v1.1.0", "app"},
+		{"v1.2.0", "old-app"},
+	} {
+		m := sample.Module(modulePath, v.version, "p")
+		findDirectory(m, pkgPath).ContentHash = hash
+		if err := testDB.InsertModule(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+		if err := testDB.UpsertModuleVersionState(ctx, modulePath, v.version, v.appVersion, time.Now(), http.StatusOK, modulePath, "", "", "", nil, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := testDB.GetUnitByContentHash(ctx, pkgPath, hash, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &internal.Unit{
+		UnitMeta: internal.UnitMeta{
+			Path:       pkgPath,
+			Name:       sample.PackageName,
+			ModulePath: modulePath,
+			Version:    "v1.1.0",
+		},
+		Documentation: []*internal.Documentation{sample.Documentation},
+		Imports:       sample.Imports,
+		ContentHash:   hash,
+	}
+	opts := []cmp.Option{
+		cmp.AllowUnexported(safehtml.HTML{}),
+		cmpopts.EquateEmpty(),
+		cmpopts.SortSlices(func(a, b string) bool { return a < b }),
+	}
+	if diff := cmp.Diff(want, got, opts...); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	for _, test := range []struct {
+		pkgPath, hash, appVersion string
+	}{
+		{pkgPath, "other-hash", "app"},
+		{pkgPath, hash, "new-app"},
+		{modulePath, hash, "app"},
+		{pkgPath, "", "app"},
+	} {
+		if _, err := testDB.GetUnitByContentHash(ctx, test.pkgPath, test.hash, test.appVersion); !errors.Is(err, derrors.NotFound) {
+			t.Errorf("GetUnitByContentHash(%q, %q, %q): got error %v, want %v", test.pkgPath, test.hash, test.appVersion, err, derrors.NotFound)
+		}
+	}
+}
+
 func unit(fullPath, modulePath, version, name string, readme *internal.Readme, suffixes []string) *internal.Unit {
 	u := &internal.Unit{
 		UnitMeta: internal.UnitMeta{
@@ -278,22 +360,25 @@ func unit(fullPath, modulePath, version, name string, readme *internal.Readme, s
 		Readme:          readme,
 	}
 
-	u.Subdirectories = subdirectories(modulePath, suffixes)
+	u.Subdirectories = subdirectories(modulePath, version, suffixes)
 	if u.IsPackage() {
 		u.Imports = sample.Imports
-		u.Documentation = sample.Documentation
+		u.Documentation = []*internal.Documentation{sample.Documentation}
 	}
 	return u
 }
 
-func subdirectories(modulePath string, suffixes []string) []*internal.PackageMeta {
+func subdirectories(modulePath, version string, suffixes []string) []*internal.PackageMeta {
 	var want []*internal.PackageMeta
 	for _, suffix := range suffixes {
 		p := suffix
 		if modulePath != stdlib.ModulePath {
 			p = path.Join(modulePath, suffix)
 		}
-		want = append(want, sample.PackageMeta(p))
+		pm := sample.PackageMeta(p)
+		pm.ModulePath = modulePath
+		pm.Version = version
+		want = append(want, pm)
 	}
 	return want
 }
@@ -363,3 +448,176 @@ func findDirectory(m *internal.Module, path string) *internal.Unit {
 	}
 	return nil
 }
+
+func TestGetModuleReadme(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer ResetTestDB(testDB, t)
+
+	m := sample.Module("a.com/m", "v1.2.3", "dir/p")
+	if err := testDB.InsertModule(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	// Insert the non-redistributable module bypassing the license check, so
+	// that its README is stored.
+	bypassDB := NewBypassingLicenseCheck(testDB.db)
+	nr := sample.Module("a.com/nr", "v1.0.0", "p")
+	for _, u := range nr.Units {
+		u.IsRedistributable = false
+	}
+	if err := bypassDB.InsertModule(ctx, nr); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := testDB.GetModuleReadme(ctx, "a.com/m", "v1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &internal.Readme{Filepath: sample.ReadmeFilePath, Contents: sample.ReadmeContents}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	got, err = testDB.GetModuleReadme(ctx, "a.com/nr", "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&internal.Readme{Filepath: sample.ReadmeFilePath}); !cmp.Equal(got, want) {
+		t.Errorf("non-redistributable: got %+v, want %+v", got, want)
+	}
+	got, err = bypassDB.GetModuleReadme(ctx, "a.com/nr", "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Contents != sample.ReadmeContents {
+		t.Errorf("bypassing license check: got contents %q, want %q", got.Contents, sample.ReadmeContents)
+	}
+
+	if _, err := testDB.GetModuleReadme(ctx, "a.com/m", "v1.0.0"); !errors.Is(err, derrors.NotFound) {
+		t.Errorf("unknown version: got %v, want NotFound", err)
+	}
+}
+
+func TestOverviewBytesRead(t *testing.T) {
+	// Compare the bytes read from the database to render the overview of a
+	// package with large documentation, by loading the whole unit as the
+	// frontend used to, and by reading only the README.
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer ResetTestDB(testDB, t)
+
+	m := sample.Module("a.com/m", "v1.0.0", "pkg")
+	// Random text does not compress well, so the stored documentation is
+	// about as large as it would be for a real package.
+	r := rand.New(rand.NewSource(1))
+	doc := make([]byte, 256*1024)
+	for i := range doc {
+		doc[i] = byte('a' + r.Intn(26))
+	}
+	pkg := findDirectory(m, "a.com/m/pkg")
+	pkg.Documentation[0].HTML = safehtml.HTMLEscaped(string(doc))
+	if err := testDB.InsertModule(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+
+	drv := testRecordingDriver
+	ddb, err := database.Open("postgres-recording", dbtest.DBConnURI("discovery_postgres_test"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ddb.Close()
+	db := New(ddb)
+
+	um := sample.UnitMeta(pkg.Path, m.ModulePath, m.Version, pkg.Name, true)
+	start := drv.bytes()
+	if _, err := db.GetUnit(ctx, um, internal.AllFields); err != nil {
+		t.Fatal(err)
+	}
+	whole := drv.bytes() - start
+	start = drv.bytes()
+	if _, err := db.GetModuleReadme(ctx, m.ModulePath, m.Version); err != nil {
+		t.Fatal(err)
+	}
+	readme := drv.bytes() - start
+	t.Logf("overview: read %d bytes for the whole unit, %d bytes for the README only (%.1f%% less)",
+		whole, readme, 100*float64(whole-readme)/float64(whole))
+	if readme*100 > whole {
+		t.Errorf("reading the README took %d bytes, want at most 1%% of the %d bytes of the whole unit", readme, whole)
+	}
+}
+
+// testRecordingDriver is registered as "postgres-recording".
+var testRecordingDriver = &recordingDriver{}
+
+func init() {
+	sql.Register("postgres-recording", testRecordingDriver)
+}
+
+// recordingDriver is a driver.Driver that wraps the Postgres driver and
+// records the number of bytes in the rows that its connections read.
+// Variable-length values count their length, and others eight bytes.
+type recordingDriver struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (d *recordingDriver) add(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.n += n
+}
+
+func (d *recordingDriver) bytes() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.n
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	c, err := (&pq.Driver{}).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingConn{Conn: c, d: d}, nil
+}
+
+type recordingConn struct {
+	driver.Conn
+	d *recordingDriver
+}
+
+func (c *recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingRows{Rows: rows, d: c.d}, nil
+}
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+type recordingRows struct {
+	driver.Rows
+	d *recordingDriver
+}
+
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if err := r.Rows.Next(dest); err != nil {
+		return err
+	}
+	n := 0
+	for _, v := range dest {
+		switch v := v.(type) {
+		case []byte:
+			n += len(v)
+		case string:
+			n += len(v)
+		default:
+			n += 8
+		}
+	}
+	r.d.add(n)
+	return nil
+}
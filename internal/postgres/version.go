@@ -151,76 +151,109 @@ func getModuleVersions(ctx context.Context, db *DB, modulePath string, versionTy
 	return vinfos, nil
 }
 
-// GetVersionsForPath returns a list of tagged versions sorted in
-// descending semver order if any exist. If none, it returns the 10 most
-// recent from a list of pseudo-versions sorted in descending semver order.
+// maxPseudoVersionsForPath is the number of pseudo-versions returned by
+// GetVersionsForPath.
+const maxPseudoVersionsForPath = 100
+
+// GetVersionsForPath returns the versions of the modules that have a path
+// with the same v1 path as path: all their release and prerelease versions,
+// and their maxPseudoVersionsForPath most recent pseudo-versions. The
+// versions are sorted with compatible versions first, then by module path and
+// version, both in descending order. Deprecation is set from the latest
+// version of each module.
 func (db *DB) GetVersionsForPath(ctx context.Context, path string) (_ []*internal.ModuleInfo, err error) {
 	defer derrors.Wrap(&err, "GetVersionsForPath(ctx, %q)", path)
 
-	versions, err := getPathVersions(ctx, db, path, version.TypeRelease, version.TypePrerelease)
-	if err != nil {
-		return nil, err
-	}
-	if len(versions) != 0 {
-		return versions, nil
+	query := `
+		WITH series AS (
+			SELECT m.id, m.version_type, m.sort_version
+			FROM modules m
+			INNER JOIN paths p
+			ON p.module_id = m.id
+			WHERE p.v1_path = (
+				SELECT p2.v1_path
+				FROM paths as p2
+				WHERE p2.path = $1
+				LIMIT 1
+			)
+		)
+		SELECT
+			m.module_path,
+			m.version,
+			m.commit_time,
+			m.redistributable,
+			m.has_go_mod,
+			m.source_info,
+			m.retracted,
+			m.retraction_rationale,
+			COALESCE(l.deprecation, '')
+		FROM modules m
+		LEFT JOIN latest_module_versions l
+		ON l.module_path = m.module_path
+		WHERE m.id IN (
+			SELECT id FROM series WHERE version_type <> 'pseudo'
+			UNION ALL
+			(
+				SELECT id FROM series
+				WHERE version_type = 'pseudo'
+				ORDER BY sort_version DESC
+				LIMIT $2
+			)
+		)
+		ORDER BY
+			m.incompatible,
+			m.module_path DESC,
+			m.sort_version DESC`
+	var versions []*internal.ModuleInfo
+	collect := func(rows *sql.Rows) error {
+		var mi internal.ModuleInfo
+		if err := rows.Scan(&mi.ModulePath, &mi.Version, &mi.CommitTime,
+			&mi.IsRedistributable, &mi.HasGoMod, jsonbScanner{&mi.SourceInfo},
+			&mi.Retracted, &mi.RetractionRationale, &mi.Deprecation); err != nil {
+			return fmt.Errorf("row.Scan(): %v", err)
+		}
+		versions = append(versions, &mi)
+		return nil
 	}
-	versions, err = getPathVersions(ctx, db, path, version.TypePseudo)
-	if err != nil {
+	if err := db.db.RunQuery(ctx, query, collect, path, maxPseudoVersionsForPath); err != nil {
 		return nil, err
 	}
 	return versions, nil
 }
 
-// getPathVersions returns a list of versions sorted in descending semver
-// order. The version types included in the list are specified by a list of
-// VersionTypes.
-func getPathVersions(ctx context.Context, db *DB, path string, versionTypes ...version.Type) (_ []*internal.ModuleInfo, err error) {
-	defer derrors.Wrap(&err, "getPathVersions(ctx, db, %q, %v)", path, versionTypes)
-
-	baseQuery := `
-	SELECT
-		m.module_path,
-		m.version,
-		m.commit_time,
-		m.redistributable,
-		m.has_go_mod,
-		m.source_info
-	FROM modules m
-	INNER JOIN paths p
-	ON p.module_id = m.id
-	WHERE
-		p.v1_path = (
-			SELECT p2.v1_path
-			FROM paths as p2
-			WHERE p2.path = $1
-			LIMIT 1
-		)
-		AND version_type in (%s)
-	ORDER BY
-		m.incompatible,
-		m.module_path DESC,
-		m.sort_version DESC %s`
+// GetSeriesModuleVersions returns the latest version of each module in the
+// series with seriesPath, ordered by module path. A module with both
+// +incompatible and other versions has an entry for the latest version of
+// each kind, since +incompatible versions have their own major versions.
+// Retracted versions are ignored.
+func (db *DB) GetSeriesModuleVersions(ctx context.Context, seriesPath string) (_ []internal.Modver, err error) {
+	defer derrors.Wrap(&err, "DB.GetSeriesModuleVersions(ctx, %q)", seriesPath)
 
-	queryEnd := `;`
-	if len(versionTypes) == 0 {
-		return nil, fmt.Errorf("error: must specify at least one version type")
-	} else if len(versionTypes) == 1 && versionTypes[0] == version.TypePseudo {
-		queryEnd = `LIMIT 10;`
-	}
-	query := fmt.Sprintf(baseQuery, versionTypeExpr(versionTypes), queryEnd)
-	var versions []*internal.ModuleInfo
+	query := `
+		SELECT DISTINCT ON (m.module_path, m.incompatible)
+			m.module_path,
+			m.version
+		FROM modules m
+		WHERE m.series_path = $1
+		AND NOT m.retracted
+		ORDER BY
+			m.module_path,
+			m.incompatible,
+			m.version_type = 'release' DESC,
+			m.sort_version DESC`
+	var mvs []internal.Modver
 	collect := func(rows *sql.Rows) error {
-		mi, err := scanModuleInfo(rows.Scan)
-		if err != nil {
-			return fmt.Errorf("row.Scan(): %v", err)
+		var mv internal.Modver
+		if err := rows.Scan(&mv.Path, &mv.Version); err != nil {
+			return err
 		}
-		versions = append(versions, mi)
+		mvs = append(mvs, mv)
 		return nil
 	}
-	if err := db.db.RunQuery(ctx, query, collect, path); err != nil {
+	if err := db.db.RunQuery(ctx, query, collect, seriesPath); err != nil {
 		return nil, err
 	}
-	return versions, nil
+	return mvs, nil
 }
 
 // GetLatestMajorVersion returns the latest major version string of a module
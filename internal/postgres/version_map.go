@@ -9,6 +9,7 @@ import (
 	"database/sql"
 	"fmt"
 
+	"github.com/lib/pq"
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/derrors"
 	"golang.org/x/pkgsite/internal/version"
@@ -39,9 +40,10 @@ func (db *DB) UpsertVersionMap(ctx context.Context, vm *internal.VersionMap) (er
 				go_mod_path,
 				status,
 				error,
+				error_code,
 				sort_version,
 				module_id)
-			VALUES($1,$2,$3,$4,$5,$6,$7,$8)
+			VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9)
 			ON CONFLICT (module_path, requested_version)
 			DO UPDATE SET
 				module_path=excluded.module_path,
@@ -50,6 +52,7 @@ func (db *DB) UpsertVersionMap(ctx context.Context, vm *internal.VersionMap) (er
 				resolved_version=excluded.resolved_version,
 				status=excluded.status,
 				error=excluded.error,
+				error_code=excluded.error_code,
 				sort_version=excluded.sort_version,
 				module_id=excluded.module_id`,
 		vm.ModulePath,
@@ -58,6 +61,7 @@ func (db *DB) UpsertVersionMap(ctx context.Context, vm *internal.VersionMap) (er
 		vm.GoModPath,
 		vm.Status,
 		vm.Error,
+		vm.ErrorCode,
 		sortVersion,
 		moduleID)
 	return err
@@ -71,24 +75,15 @@ func (db *DB) GetVersionMap(ctx context.Context, modulePath, requestedVersion st
 		return nil, fmt.Errorf("modulePath must be specified: %w", derrors.InvalidArgument)
 	}
 
-	query := `
-		SELECT
-			module_path,
-			requested_version,
-			resolved_version,
-			go_mod_path,
-			status,
-			error,
-			updated_at
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM
 			version_map
 		WHERE
 			module_path=$1
-			AND requested_version=$2;`
+			AND requested_version=$2;`, versionMapColumns)
 	var vm internal.VersionMap
-	err = db.db.QueryRow(ctx, query, modulePath, requestedVersion).Scan(
-		&vm.ModulePath, &vm.RequestedVersion, &vm.ResolvedVersion, &vm.GoModPath,
-		&vm.Status, &vm.Error, &vm.UpdatedAt)
+	err = db.db.QueryRow(ctx, query, modulePath, requestedVersion).Scan(versionMapScanDest(&vm)...)
 	switch err {
 	case nil:
 		return &vm, nil
@@ -98,3 +93,73 @@ func (db *DB) GetVersionMap(ctx context.Context, modulePath, requestedVersion st
 		return nil, err
 	}
 }
+
+// GetVersionMaps returns the version_map entries for the module paths and
+// requested versions in paths, using a single query. The result has an entry
+// for each element of paths, in the same order; the entry is nil if there is
+// no row for that module path and requested version.
+func (db *DB) GetVersionMaps(ctx context.Context, paths []internal.Modver) (_ []*internal.VersionMap, err error) {
+	defer derrors.Wrap(&err, "DB.GetVersionMaps(ctx, %d paths)", len(paths))
+
+	var modulePaths, requestedVersions []string
+	for _, mv := range paths {
+		if mv.Path == internal.UnknownModulePath {
+			return nil, fmt.Errorf("modulePath must be specified: %w", derrors.InvalidArgument)
+		}
+		modulePaths = append(modulePaths, mv.Path)
+		requestedVersions = append(requestedVersions, mv.Version)
+	}
+	result := make([]*internal.VersionMap, len(paths))
+	if len(paths) == 0 {
+		return result, nil
+	}
+	// Join the version_map rows to the requested paths, numbered in order,
+	// so that each row can be put in the place of the path it matches.
+	// A path that appears more than once gets a row for each appearance.
+	query := fmt.Sprintf(`
+		SELECT r.i, %s
+		FROM
+			unnest($1::text[], $2::text[]) WITH ORDINALITY AS r(path, version, i)
+		INNER JOIN
+			version_map
+		ON
+			module_path = r.path
+			AND requested_version = r.version`, versionMapColumns)
+	collect := func(rows *sql.Rows) error {
+		var (
+			i  int
+			vm internal.VersionMap
+		)
+		if err := rows.Scan(append([]interface{}{&i}, versionMapScanDest(&vm)...)...); err != nil {
+			return err
+		}
+		// WITH ORDINALITY numbers from 1.
+		result[i-1] = &vm
+		return nil
+	}
+	if err := db.db.RunQuery(ctx, query, collect, pq.Array(modulePaths), pq.Array(requestedVersions)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// versionMapColumns are the columns of version_map that are read into an
+// internal.VersionMap, in the order of versionMapScanDest.
+const versionMapColumns = `
+			module_path,
+			requested_version,
+			resolved_version,
+			go_mod_path,
+			status,
+			error,
+			error_code,
+			updated_at`
+
+// versionMapScanDest returns the destinations for scanning versionMapColumns
+// into vm.
+func versionMapScanDest(vm *internal.VersionMap) []interface{} {
+	return []interface{}{
+		&vm.ModulePath, &vm.RequestedVersion, &vm.ResolvedVersion, &vm.GoModPath,
+		&vm.Status, &vm.Error, &vm.ErrorCode, &vm.UpdatedAt,
+	}
+}
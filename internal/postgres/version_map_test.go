@@ -11,6 +11,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
 	"golang.org/x/pkgsite/internal/testing/sample"
 )
 
@@ -69,10 +70,87 @@ func TestUpsertVersionMap(t *testing.T) {
 		ResolvedVersion:  "",
 		Status:           404,
 		Error:            "not found",
+		ErrorCode:        derrors.CodeNotFound,
 	}
 	upsertAndVerifyVersionMap(vm)
 
 	vm.ResolvedVersion = "v1.0.0"
 	vm.Status = 200
+	vm.Error = ""
+	vm.ErrorCode = ""
 	upsertAndVerifyVersionMap(vm)
 }
+
+func TestGetVersionMaps(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer ResetTestDB(testDB, t)
+
+	vm1 := &internal.VersionMap{
+		ModulePath:       "github.com/a",
+		RequestedVersion: "master",
+		ResolvedVersion:  "v1.0.0",
+		Status:           200,
+	}
+	vm2 := &internal.VersionMap{
+		ModulePath:       "github.com/b",
+		RequestedVersion: "v1.2.3",
+		Status:           404,
+		Error:            "not found",
+		ErrorCode:        derrors.CodeNotFound,
+	}
+	for _, vm := range []*internal.VersionMap{vm1, vm2} {
+		if err := testDB.UpsertVersionMap(ctx, vm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name  string
+		paths []internal.Modver
+		want  []*internal.VersionMap
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "in order",
+			paths: []internal.Modver{
+				{Path: "github.com/b", Version: "v1.2.3"},
+				{Path: "github.com/a", Version: "master"},
+			},
+			want: []*internal.VersionMap{vm2, vm1},
+		},
+		{
+			name: "missing",
+			paths: []internal.Modver{
+				{Path: "github.com/a", Version: "v1.0.0"},
+				{Path: "github.com/a", Version: "master"},
+				{Path: "github.com/c", Version: "master"},
+			},
+			want: []*internal.VersionMap{nil, vm1, nil},
+		},
+		{
+			name: "duplicates",
+			paths: []internal.Modver{
+				{Path: "github.com/a", Version: "master"},
+				{Path: "github.com/b", Version: "v1.2.3"},
+				{Path: "github.com/a", Version: "master"},
+			},
+			want: []*internal.VersionMap{vm1, vm2, vm1},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := testDB.GetVersionMaps(ctx, test.paths)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.want == nil {
+				test.want = []*internal.VersionMap{}
+			}
+			if diff := cmp.Diff(test.want, got, cmpopts.IgnoreFields(internal.VersionMap{}, "UpdatedAt")); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -189,10 +189,10 @@ func TestGetVersions(t *testing.T) {
 		}
 	)
 
-	// Add 12 pseudo versions to the test modules. Below we only
-	// expect to return the 10 most recent.
-	for i := 1; i <= 12; i++ {
-		testModules = append(testModules, sample.Module(pseudoModule, fmt.Sprintf("v0.0.0-202001011200%02d-000000000000", i), "blog"))
+	// Add pseudo versions to the test modules. Below we only expect to
+	// return the maxPseudoVersionsForPath most recent.
+	for i := 1; i <= maxPseudoVersionsForPath+2; i++ {
+		testModules = append(testModules, sample.Module(pseudoModule, fmt.Sprintf("v0.0.0-2020010112%04d-000000000000", i), "blog"))
 	}
 
 	defer ResetTestDB(testDB, t)
@@ -246,6 +246,10 @@ func TestGetVersions(t *testing.T) {
 			ModulePath: taggedAndPseudoModule,
 			Version:    "v1.5.2",
 		},
+		{
+			ModulePath: taggedAndPseudoModule,
+			Version:    "v0.0.0-20200101120000-000000000000",
+		},
 	}
 
 	testCases := []struct {
@@ -268,12 +272,12 @@ func TestGetVersions(t *testing.T) {
 			want: stdModuleVersions,
 		},
 		{
-			name: "want_tagged_versions_only",
+			name: "want_tagged_and_pseudo_versions",
 			path: "path.to/foo/bar",
 			want: fooModuleVersions,
 		},
 		{
-			name: "want_all_tagged_versions_at_v2_path",
+			name: "want_all_versions_at_v2_path",
 			path: "path.to/foo/v2/bar",
 			want: fooModuleVersions,
 		},
@@ -282,11 +286,11 @@ func TestGetVersions(t *testing.T) {
 			path: "golang.org/x/tools/blog",
 			want: func() []*internal.ModuleInfo {
 				versions := []*internal.ModuleInfo{}
-				// Expect the 10 most recent in DESC order
-				for i := 12; i > 2; i-- {
+				// Expect the most recent in DESC order.
+				for i := maxPseudoVersionsForPath + 2; i > 2; i-- {
 					versions = append(versions, &internal.ModuleInfo{
 						ModulePath: pseudoModule,
-						Version:    fmt.Sprintf("v0.0.0-202001011200%02d-000000000000", i),
+						Version:    fmt.Sprintf("v0.0.0-2020010112%04d-000000000000", i),
 					})
 				}
 				return versions
@@ -415,3 +419,34 @@ func TestGetLatestMajorVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestGetSeriesModuleVersions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	defer ResetTestDB(testDB, t)
+	for _, mv := range []internal.Modver{
+		{Path: "foo.com/bar", Version: "v1.0.0"},
+		{Path: "foo.com/bar", Version: "v1.1.0"},
+		{Path: "foo.com/bar", Version: "v3.0.0+incompatible"},
+		{Path: "foo.com/bar/v2", Version: "v2.0.0"},
+		{Path: "foo.com/bar/v2", Version: "v2.1.0-pre"},
+		{Path: "bar.com/foo", Version: "v1.0.0"},
+	} {
+		if err := testDB.InsertModule(ctx, sample.Module(mv.Path, mv.Version, sample.Suffix)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := testDB.GetSeriesModuleVersions(ctx, "foo.com/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []internal.Modver{
+		{Path: "foo.com/bar", Version: "v1.1.0"},
+		{Path: "foo.com/bar", Version: "v3.0.0+incompatible"},
+		{Path: "foo.com/bar/v2", Version: "v2.0.0"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"sort"
 	"time"
@@ -25,6 +26,19 @@ import (
 func (db *DB) InsertIndexVersions(ctx context.Context, versions []*internal.IndexVersion) (err error) {
 	defer derrors.Wrap(&err, "InsertIndexVersions(ctx, %v)", versions)
 
+	return db.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		return insertIndexVersions(ctx, tx, versions, true)
+	})
+}
+
+// insertIndexVersions inserts versions into the module_version_states table
+// with a status of zero. If update is true, versions that are already there
+// get the new index timestamp and become due for processing; otherwise they
+// are left alone.
+func insertIndexVersions(ctx context.Context, tx *database.DB, versions []*internal.IndexVersion, update bool) error {
+	if len(versions) == 0 {
+		return nil
+	}
 	var vals []interface{}
 	for _, v := range versions {
 		vals = append(vals, v.Path, v.Version, version.ForSorting(v.Version), v.Timestamp, 0, "", "", isIncompatible(v.Version))
@@ -36,16 +50,19 @@ func (db *DB) InsertIndexVersions(ctx context.Context, versions []*internal.Inde
 		DO UPDATE SET
 			index_timestamp=excluded.index_timestamp,
 			next_processed_after=CURRENT_TIMESTAMP`
-	return db.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
-		return tx.BulkInsert(ctx, "module_version_states", cols, vals, conflictAction)
-	})
+	if !update {
+		conflictAction = `ON CONFLICT (module_path, version) DO NOTHING`
+	}
+	return tx.BulkInsert(ctx, "module_version_states", cols, vals, conflictAction)
 }
 
 // UpsertModuleVersionState inserts or updates the module_version_state table with
-// the results of a fetch operation for a given module version.
-func (db *DB) UpsertModuleVersionState(ctx context.Context, modulePath, vers, appVersion string, timestamp time.Time, status int, goModPath string, fetchErr error, packageVersionStates []*internal.PackageVersionState) (err error) {
-	defer derrors.Wrap(&err, "UpsertModuleVersionState(ctx, %q, %q, %q, %s, %d, %q, %v",
-		modulePath, vers, appVersion, timestamp, status, goModPath, fetchErr)
+// the results of a fetch operation for a given module version, including the
+// go and toolchain directives of its go.mod file and the warnings that the
+// fetch reported.
+func (db *DB) UpsertModuleVersionState(ctx context.Context, modulePath, vers, appVersion string, timestamp time.Time, status int, goModPath, goVersion, toolchain, proxyURL string, fetchErr error, warnings []string, packageVersionStates []*internal.PackageVersionState) (err error) {
+	defer derrors.Wrap(&err, "UpsertModuleVersionState(ctx, %q, %q, %q, %s, %d, %q, %q, %v",
+		modulePath, vers, appVersion, timestamp, status, goModPath, proxyURL, fetchErr)
 	ctx, span := trace.StartSpan(ctx, "UpsertModuleVersionState")
 	defer span.End()
 
@@ -58,7 +75,7 @@ func (db *DB) UpsertModuleVersionState(ctx context.Context, modulePath, vers, ap
 	}
 
 	return db.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
-		if err := upsertModuleVersionState(ctx, tx, modulePath, vers, appVersion, numPackages, timestamp, status, goModPath, fetchErr); err != nil {
+		if err := upsertModuleVersionState(ctx, tx, modulePath, vers, appVersion, numPackages, timestamp, status, goModPath, goVersion, toolchain, proxyURL, fetchErr, warnings); err != nil {
 			return err
 		}
 		// Sync modules.status if the module exists in the modules table.
@@ -72,9 +89,9 @@ func (db *DB) UpsertModuleVersionState(ctx context.Context, modulePath, vers, ap
 	})
 }
 
-func upsertModuleVersionState(ctx context.Context, db *database.DB, modulePath, vers, appVersion string, numPackages *int, timestamp time.Time, status int, goModPath string, fetchErr error) (err error) {
-	defer derrors.Wrap(&err, "upsertModuleVersionState(ctx, %q, %q, %q, %s, %d, %q, %v",
-		modulePath, vers, appVersion, timestamp, status, goModPath, fetchErr)
+func upsertModuleVersionState(ctx context.Context, db *database.DB, modulePath, vers, appVersion string, numPackages *int, timestamp time.Time, status int, goModPath, goVersion, toolchain, proxyURL string, fetchErr error, warnings []string) (err error) {
+	defer derrors.Wrap(&err, "upsertModuleVersionState(ctx, %q, %q, %q, %s, %d, %q, %q, %v",
+		modulePath, vers, appVersion, timestamp, status, goModPath, proxyURL, fetchErr)
 	ctx, span := trace.StartSpan(ctx, "upsertModuleVersionState")
 	defer span.End()
 
@@ -82,6 +99,19 @@ func upsertModuleVersionState(ctx context.Context, db *database.DB, modulePath,
 	if fetchErr != nil {
 		sqlErrorMsg = fetchErr.Error()
 	}
+	errorCode := derrors.ToCode(fetchErr)
+
+	// This is the first try if there is no row yet.
+	tryCount := 1
+	err = db.QueryRow(ctx, `
+		SELECT try_count + 1
+		FROM module_version_states
+		WHERE module_path = $1 AND version = $2`,
+		modulePath, vers).Scan(&tryCount)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	next := nextProcessedAfter(time.Now(), status, errorCode, tryCount, rand.Float64())
 
 	affected, err := db.Exec(ctx, `
 			INSERT INTO module_version_states AS mvs (
@@ -93,9 +123,16 @@ func upsertModuleVersionState(ctx context.Context, db *database.DB, modulePath,
 				status,
 				go_mod_path,
 				error,
+				error_code,
 				num_packages,
-				incompatible)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+				incompatible,
+				proxy_url,
+				warnings,
+				go_version,
+				toolchain,
+				next_processed_after,
+				last_processed_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, CURRENT_TIMESTAMP)
 			ON CONFLICT (module_path, version)
 			DO UPDATE
 			SET
@@ -103,20 +140,18 @@ func upsertModuleVersionState(ctx context.Context, db *database.DB, modulePath,
 				status=excluded.status,
 				go_mod_path=excluded.go_mod_path,
 				error=excluded.error,
+				error_code=excluded.error_code,
 				num_packages=excluded.num_packages,
+				proxy_url=excluded.proxy_url,
+				warnings=excluded.warnings,
+				go_version=excluded.go_version,
+				toolchain=excluded.toolchain,
 				try_count=mvs.try_count+1,
 				last_processed_at=CURRENT_TIMESTAMP,
-			    -- back off exponentially until 1 hour, then at constant 1-hour intervals
-				next_processed_after=CASE
-					WHEN mvs.last_processed_at IS NULL THEN
-						CURRENT_TIMESTAMP + INTERVAL '1 minute'
-					WHEN 2*(mvs.next_processed_after - mvs.last_processed_at) < INTERVAL '1 hour' THEN
-						CURRENT_TIMESTAMP + 2*(mvs.next_processed_after - mvs.last_processed_at)
-					ELSE
-						CURRENT_TIMESTAMP + INTERVAL '1 hour'
-					END;`,
+				-- see nextProcessedAfter for the retry policy
+				next_processed_after=excluded.next_processed_after;`,
 		modulePath, vers, version.ForSorting(vers),
-		appVersion, timestamp, status, goModPath, sqlErrorMsg, numPackages, isIncompatible(vers))
+		appVersion, timestamp, status, goModPath, sqlErrorMsg, errorCode, numPackages, isIncompatible(vers), proxyURL, pq.Array(warnings), goVersion, toolchain, next)
 	if err != nil {
 		return err
 	}
@@ -207,12 +242,17 @@ const moduleVersionStateColumns = `
 			created_at,
 			status,
 			error,
+			error_code,
 			try_count,
 			last_processed_at,
 			next_processed_after,
 			app_version,
 			go_mod_path,
-			num_packages`
+			num_packages,
+			proxy_url,
+			warnings,
+			go_version,
+			toolchain`
 
 // scanModuleVersionState constructs an *internal.ModuleModuleVersionState from the given
 // scanner. It expects columns to be in the order of moduleVersionStateColumns.
@@ -222,8 +262,8 @@ func scanModuleVersionState(scan func(dest ...interface{}) error) (*internal.Mod
 		lastProcessedAt pq.NullTime
 		numPackages     sql.NullInt64
 	)
-	if err := scan(&v.ModulePath, &v.Version, &v.IndexTimestamp, &v.CreatedAt, &v.Status, &v.Error,
-		&v.TryCount, &v.LastProcessedAt, &v.NextProcessedAfter, &v.AppVersion, &v.GoModPath, &numPackages); err != nil {
+	if err := scan(&v.ModulePath, &v.Version, &v.IndexTimestamp, &v.CreatedAt, &v.Status, &v.Error, &v.ErrorCode,
+		&v.TryCount, &v.LastProcessedAt, &v.NextProcessedAfter, &v.AppVersion, &v.GoModPath, &numPackages, &v.ProxyURL, pq.Array(&v.Warnings), &v.GoVersion, &v.Toolchain); err != nil {
 		return nil, err
 	}
 	if lastProcessedAt.Valid {
@@ -287,6 +327,22 @@ func (db *DB) GetRecentVersions(ctx context.Context, limit int) (_ []*internal.M
 	return db.queryModuleVersionStates(ctx, queryFormat, limit)
 }
 
+// GetModuleVersionStatesForModule returns the at most limit versions of
+// modulePath in module_version_states, most recently processed first.
+// Versions that have never been processed come last.
+func (db *DB) GetModuleVersionStatesForModule(ctx context.Context, modulePath string, limit int) (_ []*internal.ModuleVersionState, err error) {
+	defer derrors.Wrap(&err, "GetModuleVersionStatesForModule(ctx, %q, %d)", modulePath, limit)
+
+	queryFormat := `
+		SELECT %s
+		FROM
+			module_version_states
+		WHERE module_path = $1
+		ORDER BY last_processed_at DESC NULLS LAST, index_timestamp DESC
+		LIMIT $2`
+	return db.queryModuleVersionStates(ctx, queryFormat, modulePath, limit)
+}
+
 // GetModuleVersionState returns the current module version state for
 // modulePath and version.
 func (db *DB) GetModuleVersionState(ctx context.Context, modulePath, version string) (_ *internal.ModuleVersionState, err error) {
@@ -424,3 +480,50 @@ func (db *DB) GetVersionStats(ctx context.Context) (_ *VersionStats, err error)
 	}
 	return stats, nil
 }
+
+// WithModuleVersionLock calls f while holding an exclusive advisory lock on
+// modulePath@version, so that only one process at a time works on that module
+// version. The lock is released when f returns. The argument to f reports
+// whether another holder of the lock had to be waited for, in which case that
+// holder may have already processed the module version.
+//
+// The lock is held in a transaction, so it takes a connection from the pool
+// for as long as f runs.
+func (db *DB) WithModuleVersionLock(ctx context.Context, modulePath, version string, f func(waited bool)) (err error) {
+	defer derrors.Wrap(&err, "WithModuleVersionLock(ctx, %q, %q)", modulePath, version)
+
+	// Module paths cannot contain "@", so this key never collides with the
+	// keys of the locks on module paths taken by InsertModule. InsertModule
+	// also locks module versions, but under a key of its own (see
+	// insertLockKey), since the worker calls it while holding this lock.
+	key := advisoryLockKey(modulePath + "@" + version)
+	return db.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		// See https://www.postgresql.org/docs/11/functions-admin.html#FUNCTIONS-ADVISORY-LOCKS.
+		var locked bool
+		if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, key).Scan(&locked); err != nil {
+			return err
+		}
+		if !locked {
+			if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, key); err != nil {
+				return err
+			}
+		}
+		f(!locked)
+		return nil
+	})
+}
+
+// ReleaseModuleVersionState makes modulePath@version due to be processed at
+// once, after a fetch of it was abandoned. Its other columns are left as they
+// were before the fetch. It is not an error if there is no such module
+// version.
+func (db *DB) ReleaseModuleVersionState(ctx context.Context, modulePath, version string) (err error) {
+	defer derrors.Wrap(&err, "ReleaseModuleVersionState(ctx, %q, %q)", modulePath, version)
+
+	_, err = db.db.Exec(ctx, `
+		UPDATE module_version_states
+		SET next_processed_after = CURRENT_TIMESTAMP
+		WHERE module_path = $1 AND version = $2`,
+		modulePath, version)
+	return err
+}
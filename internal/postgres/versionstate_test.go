@@ -76,6 +76,10 @@ func TestModuleVersionState(t *testing.T) {
 		statusCode      = 500
 		fetchErr        = errors.New("bad request")
 		goModPath       = "goModPath"
+		goVersion       = "1.21.0"
+		toolchain       = "go1.21.3"
+		proxyURL        = "https://proxy.example.com"
+		warnings        = []string{`skipped file "foo/Foo.go": collides with "foo/FOO.go"`}
 		pkgVersionState = &internal.PackageVersionState{
 			ModulePath:  "foo.com/bar",
 			PackagePath: "foo.com/bar/foo",
@@ -83,7 +87,7 @@ func TestModuleVersionState(t *testing.T) {
 			Status:      500,
 		}
 	)
-	if err := testDB.UpsertModuleVersionState(ctx, fooVersion.Path, fooVersion.Version, "", fooVersion.Timestamp, statusCode, goModPath, fetchErr, []*internal.PackageVersionState{pkgVersionState}); err != nil {
+	if err := testDB.UpsertModuleVersionState(ctx, fooVersion.Path, fooVersion.Version, "", fooVersion.Timestamp, statusCode, goModPath, goVersion, toolchain, proxyURL, fetchErr, warnings, []*internal.PackageVersionState{pkgVersionState}); err != nil {
 		t.Fatal(err)
 	}
 	errString := fetchErr.Error()
@@ -97,6 +101,10 @@ func TestModuleVersionState(t *testing.T) {
 		Error:          errString,
 		Status:         statusCode,
 		NumPackages:    &numPackages,
+		ProxyURL:       proxyURL,
+		Warnings:       warnings,
+		GoVersion:      goVersion,
+		Toolchain:      toolchain,
 	}
 	gotFooState, err := testDB.GetModuleVersionState(ctx, wantFooState.ModulePath, wantFooState.Version)
 	if err != nil {
@@ -106,6 +114,14 @@ func TestModuleVersionState(t *testing.T) {
 		t.Errorf("testDB.GetModuleVersionState(ctx, %q, %q) mismatch (-want +got)\n%s", wantFooState.ModulePath, wantFooState.Version, diff)
 	}
 
+	gotModuleStates, err := testDB.GetModuleVersionStatesForModule(ctx, wantFooState.ModulePath, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]*internal.ModuleVersionState{wantFooState}, gotModuleStates, ignore); diff != "" {
+		t.Errorf("testDB.GetModuleVersionStatesForModule(ctx, %q, 10) mismatch (-want +got)\n%s", wantFooState.ModulePath, diff)
+	}
+
 	gotPVS, err := testDB.GetPackageVersionState(ctx, pkgVersionState.PackagePath, pkgVersionState.ModulePath, pkgVersionState.Version)
 	if err != nil {
 		t.Fatal(err)
@@ -214,7 +230,7 @@ func TestUpsertModuleVersionStates(t *testing.T) {
 				}
 			}
 
-			err := testDB.UpsertModuleVersionState(ctx, m.ModulePath, m.Version, appVersion, time.Now(), test.status, "", nil, nil)
+			err := testDB.UpsertModuleVersionState(ctx, m.ModulePath, m.Version, appVersion, time.Now(), test.status, "", "", "", "", nil, nil, nil)
 			if test.wantUpsertMVSError != (err != nil) {
 				t.Fatalf("db.UpsertModuleVersionState(): %v, want error: %t", err, test.wantUpsertMVSError)
 			}
@@ -225,6 +241,11 @@ func TestUpsertModuleVersionStates(t *testing.T) {
 			if mvs.Status != test.wantMVSStatus {
 				t.Errorf("module_version_states.status = %d, want %d", mvs.Status, test.wantMVSStatus)
 			}
+			// The first result recorded for a module version is a processing
+			// of it too.
+			if mvs.LastProcessedAt == nil {
+				t.Error("module_version_states.last_processed_at is NULL, want the time of the upsert")
+			}
 
 			if !test.insertModuleBeforeMVS && test.shouldInsertModule {
 				if err := testDB.InsertModule(ctx, m); err != nil {
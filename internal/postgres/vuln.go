@@ -0,0 +1,193 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/lib/pq"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/database"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/vuln"
+)
+
+// UpsertVulnEntry stores e, and records the stored versions of the packages
+// that it affects, replacing those recorded before. A withdrawn entry affects
+// no packages. UpsertVulnEntry returns the number of affected package
+// versions.
+func (db *DB) UpsertVulnEntry(ctx context.Context, e *vuln.Entry) (n int, err error) {
+	defer derrors.Wrap(&err, "UpsertVulnEntry(ctx, %q)", e.ID)
+
+	entryJSON, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+	err = db.db.Transact(ctx, sql.LevelDefault, func(tx *database.DB) error {
+		n = 0
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO vuln_entries (id, modified, withdrawn, entry)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (id)
+			DO UPDATE SET
+				modified = excluded.modified,
+				withdrawn = excluded.withdrawn,
+				entry = excluded.entry,
+				updated_at = CURRENT_TIMESTAMP`,
+			e.ID, e.Modified, e.Withdrawn, entryJSON); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM vuln_affected_units WHERE vuln_id = $1`, e.ID); err != nil {
+			return err
+		}
+		if e.Withdrawn != nil {
+			return nil
+		}
+		for i := range e.Affected {
+			m, err := insertVulnAffectedUnits(ctx, tx, e.ID, &e.Affected[i])
+			if err != nil {
+				return err
+			}
+			n += int(m)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// insertVulnAffectedUnits records the stored versions of the packages that a,
+// part of the entry with vulnID, affects. It returns the number of rows
+// inserted.
+func insertVulnAffectedUnits(ctx context.Context, tx *database.DB, vulnID string, a *vuln.Affected) (int64, error) {
+	modulePath := a.ModulePath()
+	var versions []string
+	err := tx.RunQuery(ctx, `SELECT version FROM modules WHERE module_path = $1`,
+		func(rows *sql.Rows) error {
+			var v string
+			if err := rows.Scan(&v); err != nil {
+				return err
+			}
+			if a.AffectsVersion(v) {
+				versions = append(versions, v)
+			}
+			return nil
+		}, modulePath)
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, nil
+	}
+	// If a lists no packages, every package of the module is affected.
+	return tx.Exec(ctx, `
+		INSERT INTO vuln_affected_units (vuln_id, unit_path, module_path, version)
+		SELECT $1, p.path, m.module_path, m.version
+		FROM modules m
+		INNER JOIN paths p ON p.module_id = m.id
+		WHERE
+			m.module_path = $2
+			AND m.version = ANY($3)
+			AND p.name <> ''
+			AND (cardinality($4::text[]) = 0 OR p.path = ANY($4))
+		ON CONFLICT DO NOTHING`,
+		vulnID, modulePath, pq.Array(versions), pq.Array(a.PackagePaths()))
+}
+
+// DeleteVulnEntriesExcept deletes the stored entries whose IDs are not in
+// ids, along with the package versions they affect. It returns the number of
+// entries deleted.
+func (db *DB) DeleteVulnEntriesExcept(ctx context.Context, ids []string) (n int64, err error) {
+	defer derrors.Wrap(&err, "DeleteVulnEntriesExcept(ctx, %d ids)", len(ids))
+
+	return db.db.Exec(ctx, `DELETE FROM vuln_entries WHERE id <> ALL($1)`, pq.Array(ids))
+}
+
+// GetVulnEntries returns every stored entry that has not been withdrawn,
+// most recent first.
+func (db *DB) GetVulnEntries(ctx context.Context) (_ []*vuln.Entry, err error) {
+	defer derrors.Wrap(&err, "GetVulnEntries(ctx)")
+
+	return getVulnEntries(ctx, db.db, `
+		SELECT entry
+		FROM vuln_entries
+		WHERE withdrawn IS NULL
+		ORDER BY id DESC`)
+}
+
+// GetVulnEntriesForUnit returns the entries that affect the package with
+// unitPath at modulePath@version, sorted by ID. If unitPath is empty, it
+// returns the entries that affect any package of the module version.
+func (db *DB) GetVulnEntriesForUnit(ctx context.Context, unitPath, modulePath, version string) (_ []*vuln.Entry, err error) {
+	defer derrors.Wrap(&err, "GetVulnEntriesForUnit(ctx, %q, %q, %q)", unitPath, modulePath, version)
+
+	return getVulnEntries(ctx, db.db, `
+		SELECT e.entry
+		FROM vuln_entries e
+		WHERE e.id IN (
+			SELECT vuln_id
+			FROM vuln_affected_units
+			WHERE
+				module_path = $1
+				AND version = $2
+				AND ($3 = '' OR unit_path = $3)
+		)
+		ORDER BY e.id`, modulePath, version, unitPath)
+}
+
+func getVulnEntries(ctx context.Context, db *database.DB, query string, args ...interface{}) ([]*vuln.Entry, error) {
+	var entries []*vuln.Entry
+	err := db.RunQuery(ctx, query, func(rows *sql.Rows) error {
+		var e vuln.Entry
+		if err := rows.Scan(jsonbScanner{&e}); err != nil {
+			return err
+		}
+		entries = append(entries, &e)
+		return nil
+	}, args...)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// GetVulnCounts returns the number of entries that affect each of the given
+// package versions. The Path of each internal.Modver is a package path.
+// Package versions that are not affected by any entries are not in the map.
+func (db *DB) GetVulnCounts(ctx context.Context, pkgs []internal.Modver) (_ map[internal.Modver]int, err error) {
+	defer derrors.Wrap(&err, "GetVulnCounts(ctx, %d packages)", len(pkgs))
+
+	var paths, versions []string
+	for _, p := range pkgs {
+		paths = append(paths, p.Path)
+		versions = append(versions, p.Version)
+	}
+	counts := map[internal.Modver]int{}
+	err = db.db.RunQuery(ctx, `
+		SELECT a.unit_path, a.version, COUNT(DISTINCT a.vuln_id)
+		FROM vuln_affected_units a
+		INNER JOIN unnest($1::text[], $2::text[]) AS u(path, version)
+		ON a.unit_path = u.path AND a.version = u.version
+		GROUP BY a.unit_path, a.version`,
+		func(rows *sql.Rows) error {
+			var (
+				mv internal.Modver
+				n  int
+			)
+			if err := rows.Scan(&mv.Path, &mv.Version, &n); err != nil {
+				return err
+			}
+			counts[mv] = n
+			return nil
+		}, pq.Array(paths), pq.Array(versions))
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/testing/sample"
+	"golang.org/x/pkgsite/internal/vuln"
+)
+
+func TestVulnEntries(t *testing.T) {
+	defer ResetTestDB(testDB, t)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	const modulePath = "example.com/mod"
+	for _, v := range []string{"v1.0.0", "v1.1.0", "v1.2.0"} {
+		if err := testDB.InsertModule(ctx, sample.Module(modulePath, v, "a", "b")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	semverRange := func(introduced, fixed string) []vuln.Range {
+		return []vuln.Range{{Type: vuln.RangeTypeSemver, Events: []vuln.RangeEvent{{Introduced: introduced}, {Fixed: fixed}}}}
+	}
+	modified := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []*vuln.Entry{
+		{
+			// Affects package a before v1.2.0.
+			ID:       "GO-2021-0001",
+			Modified: modified,
+			Affected: []vuln.Affected{{
+				Package:           vuln.Package{Name: modulePath, Ecosystem: "Go"},
+				Ranges:            semverRange("0", "1.2.0"),
+				EcosystemSpecific: vuln.EcosystemSpecific{Imports: []vuln.Import{{Path: modulePath + "/a"}}},
+			}},
+		},
+		{
+			// Affects every package at v1.1.0.
+			ID:       "GO-2021-0002",
+			Modified: modified,
+			Affected: []vuln.Affected{{
+				Package: vuln.Package{Name: modulePath, Ecosystem: "Go"},
+				Ranges:  semverRange("1.1.0", "1.2.0"),
+			}},
+		},
+	}
+	wantCounts := []int{2, 4}
+	for i, e := range entries {
+		n, err := testDB.UpsertVulnEntry(ctx, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != wantCounts[i] {
+			t.Errorf("UpsertVulnEntry(%q) = %d, want %d", e.ID, n, wantCounts[i])
+		}
+	}
+
+	ids := func(es []*vuln.Entry) []string {
+		var ids []string
+		for _, e := range es {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+	for _, test := range []struct {
+		unitPath, version string
+		want              []string
+	}{
+		{modulePath + "/a", "v1.0.0", []string{"GO-2021-0001"}},
+		{modulePath + "/a", "v1.1.0", []string{"GO-2021-0001", "GO-2021-0002"}},
+		{modulePath + "/b", "v1.1.0", []string{"GO-2021-0002"}},
+		{modulePath + "/a", "v1.2.0", nil},
+		{"", "v1.0.0", []string{"GO-2021-0001"}},
+	} {
+		got, err := testDB.GetVulnEntriesForUnit(ctx, test.unitPath, modulePath, test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(test.want, ids(got)); diff != "" {
+			t.Errorf("GetVulnEntriesForUnit(%q, %q) mismatch (-want +got):\n%s", test.unitPath, test.version, diff)
+		}
+	}
+
+	counts, err := testDB.GetVulnCounts(ctx, []internal.Modver{
+		{Path: modulePath + "/a", Version: "v1.1.0"},
+		{Path: modulePath + "/b", Version: "v1.0.0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[internal.Modver]int{{Path: modulePath + "/a", Version: "v1.1.0"}: 2}, counts); diff != "" {
+		t.Errorf("GetVulnCounts mismatch (-want +got):\n%s", diff)
+	}
+
+	// Withdrawing an entry removes the packages it affects and hides it from
+	// the listing, and deleting an entry removes it.
+	withdrawn := *entries[0]
+	withdrawn.Withdrawn = &modified
+	if _, err := testDB.UpsertVulnEntry(ctx, &withdrawn); err != nil {
+		t.Fatal(err)
+	}
+	got, err := testDB.GetVulnEntriesForUnit(ctx, modulePath+"/a", modulePath, "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("after withdrawal: got %v, want none", ids(got))
+	}
+	if _, err := testDB.DeleteVulnEntriesExcept(ctx, []string{"GO-2021-0001"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = testDB.GetVulnEntries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("GetVulnEntries after deletion: got %v, want none", ids(got))
+	}
+}
@@ -0,0 +1,388 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/sync/singleflight"
+)
+
+// A DiskCache stores the .info, .mod and .zip files of module versions on
+// disk, so that a Client does not download them again. Its directory has the
+// layout of the go command's module download cache, $GOMODCACHE/cache/download,
+// so it can be seeded with a copy of a developer's cache.
+//
+// Only the files of canonical versions, which never change, are cached. A zip
+// file is used only if its hash matches the .ziphash file next to it and, if
+// it has a go.mod file, that matches the .mod file of the version. When the
+// total size of the cached zip files exceeds the cache's maximum size, the
+// least recently used ones are removed.
+//
+// A DiskCache is safe for concurrent use. Concurrent requests for the same
+// file share a single download.
+type DiskCache struct {
+	dir     string
+	maxSize int64
+	group   singleflight.Group
+
+	mu       sync.Mutex
+	size     int64           // total size of the zip files in dir
+	verified map[string]bool // zip files whose hashes have been checked
+}
+
+// NewDiskCache returns a DiskCache that stores files in dir, creating it if
+// necessary. If maxSize is positive, the total size of the zip files in the
+// cache is kept below maxSize bytes.
+func NewDiskCache(dir string, maxSize int64) (_ *DiskCache, err error) {
+	defer derrors.Wrap(&err, "NewDiskCache(%q, %d)", dir, maxSize)
+
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	dc := &DiskCache{
+		dir:      dir,
+		maxSize:  maxSize,
+		verified: map[string]bool{},
+	}
+	zips, err := dc.zipFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, z := range zips {
+		dc.size += z.Size()
+	}
+	return dc, nil
+}
+
+// URL returns the URL of the cache directory, which is reported as the proxy
+// URL of zips served from the cache.
+func (dc *DiskCache) URL() string {
+	return "file://" + filepath.ToSlash(dc.dir)
+}
+
+// cacheable reports whether the files of version can be cached.
+func cacheable(version string) bool {
+	return semver.IsValid(version) && module.CanonicalVersion(version) == version
+}
+
+// filePath returns the path of the file with the given suffix for
+// modulePath@version in the cache.
+func (dc *DiskCache) filePath(modulePath, version, suffix string) (string, error) {
+	escapedPath, err := module.EscapePath(modulePath)
+	if err != nil {
+		return "", fmt.Errorf("path: %v: %w", err, derrors.InvalidArgument)
+	}
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", fmt.Errorf("version: %v: %w", err, derrors.InvalidArgument)
+	}
+	return filepath.Join(dc.dir, filepath.FromSlash(escapedPath), "@v", escapedVersion+"."+suffix), nil
+}
+
+// readThrough returns the contents of the .info or .mod file of
+// modulePath@version from the cache or, if it is not there, from fetch, in
+// which case they are also stored in the cache.
+func (dc *DiskCache) readThrough(modulePath, version, suffix string, fetch func() ([]byte, error)) (_ []byte, err error) {
+	defer derrors.Wrap(&err, "DiskCache.readThrough(%q, %q, %q)", modulePath, version, suffix)
+
+	p, err := dc.filePath(modulePath, version, suffix)
+	if err != nil {
+		return nil, err
+	}
+	v, err, _ := dc.group.Do(p, func() (interface{}, error) {
+		if data, err := ioutil.ReadFile(p); err == nil && validFile(version, suffix, data) {
+			return data, nil
+		}
+		data, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		if validFile(version, suffix, data) {
+			if err := writeFileAtomic(p, data); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// validFile reports whether data is a valid .info or .mod file for version.
+// A .info file must name version.
+func validFile(version, suffix string, data []byte) bool {
+	if suffix != "info" {
+		return true
+	}
+	var info VersionInfo
+	return json.Unmarshal(data, &info) == nil && info.Version == version
+}
+
+// zipThrough returns the path of the zip file of modulePath@version in the
+// cache, after calling download to download it to a file if it is not
+// there. It also returns the proxy URL that download returned, or the URL of
+// the cache if it did not download the zip. Zips larger than maxSize, if it
+// is positive, are not downloaded completely; download should return an error
+// for them.
+func (dc *DiskCache) zipThrough(modulePath, version string, maxSize int64, download func(f *os.File) (string, error)) (zipPath, proxyURL string, err error) {
+	defer derrors.Wrap(&err, "DiskCache.zipThrough(%q, %q, %d)", modulePath, version, maxSize)
+
+	zipPath, err = dc.filePath(modulePath, version, "zip")
+	if err != nil {
+		return "", "", err
+	}
+	v, err, _ := dc.group.Do(fmt.Sprintf("%s %d", zipPath, maxSize), func() (interface{}, error) {
+		if dc.checkZip(modulePath, version, zipPath) {
+			now := time.Now()
+			os.Chtimes(zipPath, now, now) // for least recently used eviction
+			return dc.URL(), nil
+		}
+		if err := os.MkdirAll(filepath.Dir(zipPath), 0755); err != nil {
+			return nil, err
+		}
+		f, err := ioutil.TempFile(filepath.Dir(zipPath), "*.tmp")
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			f.Close()
+			os.Remove(f.Name())
+		}()
+		proxyURL, err := download(f)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+		if err := dc.addZip(f.Name(), zipPath); err != nil {
+			return nil, err
+		}
+		return proxyURL, nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return zipPath, v.(string), nil
+}
+
+// checkZip reports whether the zip file of modulePath@version at zipPath
+// exists and matches its .ziphash file and its .mod file, if there is one.
+// Zips that fail the check are removed.
+func (dc *DiskCache) checkZip(modulePath, version, zipPath string) bool {
+	fi, err := os.Stat(zipPath)
+	if err != nil {
+		return false
+	}
+	dc.mu.Lock()
+	verified := dc.verified[zipPath]
+	dc.mu.Unlock()
+	if verified {
+		return true
+	}
+	hashPath := strings.TrimSuffix(zipPath, ".zip") + ".ziphash"
+	ok := func() bool {
+		want, err := ioutil.ReadFile(hashPath)
+		if err != nil {
+			return false
+		}
+		got, err := dirhash.HashZip(zipPath, dirhash.Hash1)
+		if err != nil || got != strings.TrimSpace(string(want)) {
+			return false
+		}
+		goMod, err := ioutil.ReadFile(strings.TrimSuffix(zipPath, ".zip") + ".mod")
+		if err != nil {
+			// There is nothing to compare the go.mod file with.
+			return true
+		}
+		zipGoMod, found, err := readZipGoMod(zipPath, modulePath, version)
+		return err == nil && (!found || bytes.Equal(zipGoMod, goMod))
+	}()
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if !ok {
+		if os.Remove(zipPath) == nil {
+			dc.size -= fi.Size()
+		}
+		os.Remove(hashPath)
+		delete(dc.verified, zipPath)
+		return false
+	}
+	dc.verified[zipPath] = true
+	return true
+}
+
+// readZipGoMod returns the contents of the go.mod file at the root of the
+// zip file of modulePath@version at zipPath, and whether there is one.
+func readZipGoMod(zipPath, modulePath, version string) (_ []byte, found bool, err error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, false, err
+	}
+	defer zr.Close()
+	name := modulePath + "@" + version + "/go.mod"
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, false, err
+		}
+		defer r.Close()
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, false, err
+		}
+		return data, true, nil
+	}
+	return nil, false, nil
+}
+
+// addZip moves the downloaded zip file at tmpPath to zipPath, writes its
+// .ziphash file, and evicts other zips if the cache has grown too large.
+func (dc *DiskCache) addZip(tmpPath, zipPath string) error {
+	hash, err := dirhash.HashZip(tmpPath, dirhash.Hash1)
+	if err != nil {
+		return fmt.Errorf("%v: %w", err, derrors.BadModuleZip)
+	}
+	fi, err := os.Stat(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(strings.TrimSuffix(zipPath, ".zip")+".ziphash", []byte(hash+"\n")); err != nil {
+		return err
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if old, err := os.Stat(zipPath); err == nil {
+		dc.size -= old.Size()
+	}
+	if err := os.Rename(tmpPath, zipPath); err != nil {
+		return err
+	}
+	dc.size += fi.Size()
+	dc.verified[zipPath] = true
+	return dc.evict(zipPath)
+}
+
+// evict removes the least recently used zip files other than keep, with
+// their .ziphash files, until the total size of the zip files in the cache is
+// at most its maximum size. dc.mu must be held.
+func (dc *DiskCache) evict(keep string) error {
+	if dc.maxSize <= 0 || dc.size <= dc.maxSize {
+		return nil
+	}
+	zips, err := dc.zipFiles()
+	if err != nil {
+		return err
+	}
+	sort.Slice(zips, func(i, j int) bool { return zips[i].ModTime().Before(zips[j].ModTime()) })
+	for _, z := range zips {
+		if dc.size <= dc.maxSize {
+			break
+		}
+		if z.path == keep {
+			continue
+		}
+		if err := os.Remove(z.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		os.Remove(strings.TrimSuffix(z.path, ".zip") + ".ziphash")
+		delete(dc.verified, z.path)
+		dc.size -= z.Size()
+	}
+	return nil
+}
+
+// A zipFileInfo describes a zip file in the cache.
+type zipFileInfo struct {
+	os.FileInfo
+	path string
+}
+
+// zipFiles returns the zip files in the cache.
+func (dc *DiskCache) zipFiles() ([]zipFileInfo, error) {
+	var zips []zipFileInfo
+	err := filepath.Walk(dc.dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Removed by a concurrent eviction.
+				return nil
+			}
+			return err
+		}
+		if fi.Mode().IsRegular() && strings.HasSuffix(p, ".zip") {
+			zips = append(zips, zipFileInfo{fi, p})
+		}
+		return nil
+	})
+	return zips, err
+}
+
+// writeFileAtomic writes data to the file at p, creating its directory if
+// necessary, so that readers see either the old contents of the file or the
+// new ones.
+func writeFileAtomic(p string, data []byte) (err error) {
+	defer derrors.Wrap(&err, "writeFileAtomic(%q)", p)
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p), "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// copyZip copies the zip file at zipPath to w. If maxSize is positive and the
+// zip is larger, it returns an error wrapping derrors.ModuleTooLarge instead.
+func copyZip(zipPath string, w io.Writer, maxSize int64) error {
+	f, err := os.Open(zipPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 && fi.Size() > maxSize {
+		return fmt.Errorf("zip is larger than %d bytes: %w", maxSize, derrors.ModuleTooLarge)
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
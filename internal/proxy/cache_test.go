@@ -0,0 +1,342 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/testing/sample"
+)
+
+// countingTransport counts the requests made through it.
+type countingTransport struct {
+	rt    http.RoundTripper
+	delay time.Duration // before each response
+
+	mu sync.Mutex
+	n  int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.n++
+	t.mu.Unlock()
+	time.Sleep(t.delay)
+	return t.rt.RoundTrip(req)
+}
+
+func (t *countingTransport) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.n
+}
+
+// setupCachingClient returns a client for a test proxy serving modules, which
+// uses a disk cache in dir with the given maximum size, and a transport that
+// counts its requests.
+func setupCachingClient(t *testing.T, modules []*Module, dir string, maxSize int64) (*Client, *countingTransport, func()) {
+	t.Helper()
+	client, teardown := SetupTestClient(t, modules)
+	ct := &countingTransport{rt: client.httpClient.Transport}
+	client.httpClient.Transport = ct
+	dc, err := NewDiskCache(dir, maxSize)
+	if err != nil {
+		teardown()
+		t.Fatal(err)
+	}
+	client.SetDiskCache(dc)
+	return client, ct, teardown
+}
+
+// fetchAll gets the info, go.mod and zip of modulePath@version, and returns
+// their contents.
+func fetchAll(ctx context.Context, t *testing.T, client *Client, modulePath, version string) []string {
+	t.Helper()
+	info, err := client.GetInfo(ctx, modulePath, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod, err := client.GetMod(ctx, modulePath, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var zip bytes.Buffer
+	if _, err := client.DownloadZip(ctx, modulePath, version, &zip, 0); err != nil {
+		t.Fatal(err)
+	}
+	return []string{info.Version + " " + info.Time.String(), string(mod), zip.String()}
+}
+
+func TestDiskCache(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "proxy-cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client, ct, teardown := setupCachingClient(t, []*Module{testModule}, dir, 0)
+	defer teardown()
+	want := fetchAll(ctx, t, client, sample.ModulePath, sample.VersionString)
+	if got := ct.count(); got != 3 {
+		t.Errorf("first fetch made %d requests, want 3", got)
+	}
+	for _, suffix := range []string{"info", "mod", "zip", "ziphash"} {
+		p := cachePath(dir, sample.VersionString, suffix)
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%s file not in module download cache layout: %v", suffix, err)
+		}
+	}
+
+	// A new client, with a new cache in the same directory, finds everything
+	// on disk.
+	client, ct, teardown2 := setupCachingClient(t, []*Module{testModule}, dir, 0)
+	defer teardown2()
+	got := fetchAll(ctx, t, client, sample.ModulePath, sample.VersionString)
+	if n := ct.count(); n != 0 {
+		t.Errorf("second fetch made %d requests, want 0", n)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("cached file %d differs: got %q, want %q", i, got[i], want[i])
+		}
+	}
+	if _, err := client.GetZip(ctx, sample.ModulePath, sample.VersionString); err != nil {
+		t.Fatal(err)
+	}
+	if n := ct.count(); n != 0 {
+		t.Errorf("GetZip made %d requests, want 0", n)
+	}
+
+	// The latest version is not cached.
+	if _, err := client.GetInfo(ctx, sample.ModulePath, "latest"); err != nil {
+		t.Fatal(err)
+	}
+	if n := ct.count(); n != 1 {
+		t.Errorf("GetInfo(latest) made %d requests, want 1", n)
+	}
+
+	// A zip too large for the caller is not copied.
+	var buf bytes.Buffer
+	if _, err := client.DownloadZip(ctx, sample.ModulePath, sample.VersionString, &buf, 10); !errors.Is(err, derrors.ModuleTooLarge) {
+		t.Errorf("DownloadZip with small max size: got error %v, want %v", err, derrors.ModuleTooLarge)
+	}
+}
+
+func TestDiskCacheVerification(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	for _, test := range []struct {
+		name    string
+		corrupt func(t *testing.T, dir string) error
+	}{
+		{
+			name: "zip changed",
+			corrupt: func(t *testing.T, dir string) error {
+				return ioutil.WriteFile(cachePath(dir, sample.VersionString, "zip"), testZip(t, map[string]string{
+					sample.ModulePath + "@" + sample.VersionString + "/bar/bar.go": "package bar\n",
+				}), 0644)
+			},
+		},
+		{
+			name: "ziphash missing",
+			corrupt: func(t *testing.T, dir string) error {
+				return os.Remove(cachePath(dir, sample.VersionString, "ziphash"))
+			},
+		},
+		{
+			name: "go.mod does not match",
+			corrupt: func(t *testing.T, dir string) error {
+				p := cachePath(dir, sample.VersionString, "mod")
+				return ioutil.WriteFile(p, []byte("module example.com/other\n"), 0644)
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "proxy-cache-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			client, _, teardown := setupCachingClient(t, []*Module{testModule}, dir, 0)
+			defer teardown()
+			var want bytes.Buffer
+			if _, err := client.DownloadZip(ctx, sample.ModulePath, sample.VersionString, &want, 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := test.corrupt(t, dir); err != nil {
+				t.Fatal(err)
+			}
+
+			client, ct, teardown2 := setupCachingClient(t, []*Module{testModule}, dir, 0)
+			defer teardown2()
+			var got bytes.Buffer
+			if _, err := client.DownloadZip(ctx, sample.ModulePath, sample.VersionString, &got, 0); err != nil {
+				t.Fatal(err)
+			}
+			if n := ct.count(); n != 1 {
+				t.Errorf("made %d requests, want 1", n)
+			}
+			if diff := cmp.Diff(zipFileContents(t, want.Bytes()), zipFileContents(t, got.Bytes())); diff != "" {
+				t.Errorf("zip mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// cachePath returns the path of the file with the given suffix for
+// sample.ModulePath@version in the cache directory dir.
+func cachePath(dir, version, suffix string) string {
+	return filepath.Join(dir, filepath.FromSlash(sample.ModulePath), "@v", version+"."+suffix)
+}
+
+// testZip returns a zip file with the given files.
+func testZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// zipFileContents returns the contents of the files in the zip file z, by
+// name.
+func zipFileContents(t *testing.T, z []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(z), int64(len(z)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(b)
+	}
+	return files
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "proxy-cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var modules []*Module
+	for _, v := range []string{"v1.0.0", "v1.1.0", "v1.2.0"} {
+		modules = append(modules, &Module{
+			ModulePath: sample.ModulePath,
+			Version:    v,
+			Files:      map[string]string{"p.go": "package p\n\n// " + strings.Repeat(v, 100) + "\n"},
+		})
+	}
+	// Measure the zips without a size limit.
+	client, _, teardown := setupCachingClient(t, modules, dir, 0)
+	var zipSize int64
+	var buf bytes.Buffer
+	if _, err := client.DownloadZip(ctx, sample.ModulePath, "v1.0.0", &buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	zipSize = int64(buf.Len())
+	teardown()
+	os.RemoveAll(dir)
+
+	// Room for two zips.
+	client, _, teardown = setupCachingClient(t, modules, dir, 2*zipSize+zipSize/2)
+	defer teardown()
+	for _, v := range []string{"v1.0.0", "v1.1.0", "v1.0.0", "v1.2.0"} {
+		if _, err := client.DownloadZip(ctx, sample.ModulePath, v, ioutil.Discard, 0); err != nil {
+			t.Fatal(err)
+		}
+		// Make modification times distinct.
+		time.Sleep(10 * time.Millisecond)
+	}
+	// v1.1.0 was the least recently used.
+	for v, want := range map[string]bool{"v1.0.0": true, "v1.1.0": false, "v1.2.0": true} {
+		_, err := os.Stat(cachePath(dir, v, "zip"))
+		if got := err == nil; got != want {
+			t.Errorf("%s cached: got %t, want %t", v, got, want)
+		}
+	}
+}
+
+func TestDiskCacheSingleFlight(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "proxy-cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client, ct, teardown := setupCachingClient(t, []*Module{testModule}, dir, 0)
+	defer teardown()
+	// Slow responses keep the download in flight while the other goroutines
+	// ask for it.
+	ct.delay = 100 * time.Millisecond
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			_, err := client.DownloadZip(ctx, sample.ModulePath, sample.VersionString, &buf, 0)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := ct.count(); n != 1 {
+		t.Errorf("made %d requests, want 1", n)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
@@ -29,11 +30,15 @@ import (
 // A Client is used by the fetch service to communicate with a module
 // proxy. It handles all methods defined by go help goproxy.
 type Client struct {
-	// URL of the module proxy web server
-	url string
+	// URLs of the module proxy web servers, in the order in which they are
+	// tried.
+	urls []string
 
 	// client used for HTTP requests. It is mutable for testing purposes.
 	httpClient *http.Client
+
+	// cache, if non-nil, stores the files of module versions on disk.
+	cache *DiskCache
 }
 
 // A VersionInfo contains metadata about a given version of a module.
@@ -44,14 +49,41 @@ type VersionInfo struct {
 
 // New constructs a *Client using the provided url, which is expected to
 // be an absolute URI that can be directly passed to http.Get.
+//
+// The url may also be a comma-separated list of URIs, as in the GOPROXY
+// environment variable. Each request is then sent to the proxies in turn,
+// falling back to the next one if a proxy responds with 404 Not Found,
+// 410 Gone or a 5xx status, or cannot be reached. Other responses, including
+// other 4xx statuses, are final. The "off" and "direct" values of GOPROXY,
+// and "|" separators, are not supported.
 func New(u string) (_ *Client, err error) {
 	defer derrors.Wrap(&err, "proxy.New(%q)", u)
+	var urls []string
+	for _, pu := range strings.Split(u, ",") {
+		pu = strings.TrimSpace(pu)
+		switch {
+		case pu == "":
+			return nil, fmt.Errorf("empty proxy URL: %w", derrors.InvalidArgument)
+		case pu == "off" || pu == "direct":
+			return nil, fmt.Errorf("%q is not supported, only proxy URLs are: %w", pu, derrors.InvalidArgument)
+		case strings.Contains(pu, "|"):
+			return nil, fmt.Errorf("%q: \"|\" separators are not supported, only \",\": %w", pu, derrors.InvalidArgument)
+		}
+		urls = append(urls, strings.TrimRight(pu, "/"))
+	}
 	return &Client{
-		url:        strings.TrimRight(u, "/"),
+		urls:       urls,
 		httpClient: &http.Client{Transport: &ochttp.Transport{}},
 	}, nil
 }
 
+// SetDiskCache makes c look up the .info, .mod and .zip files of module
+// versions in dc before requesting them from the proxy, and store them there
+// afterwards.
+func (c *Client) SetDiskCache(dc *DiskCache) {
+	c.cache = dc
+}
+
 // GetInfo makes a request to $GOPROXY/<module>/@v/<requestedVersion>.info and
 // transforms that data into a *VersionInfo.
 func (c *Client) GetInfo(ctx context.Context, modulePath, requestedVersion string) (_ *VersionInfo, err error) {
@@ -84,17 +116,77 @@ func (c *Client) GetZip(ctx context.Context, requestedPath, requestedVersion str
 	if err != nil {
 		return nil, err
 	}
-	bodyBytes, err := c.readBody(ctx, requestedPath, info.Version, "zip")
-	if err != nil {
+	var buf bytes.Buffer
+	if _, err := c.DownloadZip(ctx, requestedPath, info.Version, &buf, 0); err != nil {
 		return nil, err
 	}
-	zipReader, err := zip.NewReader(bytes.NewReader(bodyBytes), int64(len(bodyBytes)))
+	zipReader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
 	if err != nil {
-		return nil, fmt.Errorf("zip.NewReader: %v: %w", err, derrors.BadModule)
+		return nil, fmt.Errorf("zip.NewReader: %v: %w", err, derrors.BadModuleZip)
 	}
 	return zipReader, nil
 }
 
+// DownloadZip makes a request to $GOPROXY/<path>/@v/<resolvedVersion>.zip and
+// copies the zip to w as it is received. It returns the URL of the proxy that
+// the zip was downloaded from.
+//
+// If maxSize is positive, it stops downloading a zip that is larger than
+// maxSize bytes, and returns an error wrapping derrors.ModuleTooLarge.
+func (c *Client) DownloadZip(ctx context.Context, modulePath, resolvedVersion string, w io.Writer, maxSize int64) (proxyURL string, err error) {
+	defer derrors.Wrap(&err, "proxy.Client.DownloadZip(ctx, %q, %q, w, %d)", modulePath, resolvedVersion, maxSize)
+
+	if c.cache != nil && cacheable(resolvedVersion) {
+		return c.downloadZipCached(ctx, modulePath, resolvedVersion, w, maxSize)
+	}
+	return c.downloadZip(ctx, modulePath, resolvedVersion, w, maxSize)
+}
+
+// downloadZipCached copies the zip of modulePath@resolvedVersion from the
+// disk cache to w, after downloading it to the cache if it is not there.
+func (c *Client) downloadZipCached(ctx context.Context, modulePath, resolvedVersion string, w io.Writer, maxSize int64) (proxyURL string, err error) {
+	// A zip can be evicted by another goroutine between being added to the
+	// cache and being copied from it. Try again once if that happens.
+	for i := 0; ; i++ {
+		zipPath, proxyURL, err := c.cache.zipThrough(modulePath, resolvedVersion, maxSize, func(f *os.File) (string, error) {
+			return c.downloadZip(ctx, modulePath, resolvedVersion, f, maxSize)
+		})
+		if err != nil {
+			return "", err
+		}
+		err = copyZip(zipPath, w, maxSize)
+		if os.IsNotExist(err) && i == 0 {
+			continue
+		}
+		return proxyURL, err
+	}
+}
+
+// downloadZip downloads the zip of modulePath@resolvedVersion from the proxy
+// to w, as described by DownloadZip.
+func (c *Client) downloadZip(ctx context.Context, modulePath, resolvedVersion string, w io.Writer, maxSize int64) (proxyURL string, err error) {
+	u, err := c.escapedURL(modulePath, resolvedVersion, "zip")
+	if err != nil {
+		return "", err
+	}
+	return c.executeRequest(ctx, u, func(body io.Reader) error {
+		if maxSize > 0 {
+			// Read one more byte than allowed, to detect larger zips.
+			body = io.LimitReader(body, maxSize+1)
+		}
+		n, err := io.Copy(w, body)
+		if err != nil {
+			return err
+		}
+		if maxSize > 0 && n > maxSize {
+			return fmt.Errorf("zip is larger than %d bytes: %w", maxSize, derrors.ModuleTooLarge)
+		}
+		return nil
+	})
+}
+
+// escapedURL returns the URL for the given module path, version and suffix,
+// relative to the URL of a proxy.
 func (c *Client) escapedURL(modulePath, version, suffix string) (_ string, err error) {
 	defer func() {
 		derrors.Wrap(&err, "Client.escapedURL(%q, %q, %q)", modulePath, version, suffix)
@@ -111,29 +203,42 @@ func (c *Client) escapedURL(modulePath, version, suffix string) (_ string, err e
 		if suffix != "info" {
 			return "", fmt.Errorf("cannot ask for latest with suffix %q", suffix)
 		}
-		return fmt.Sprintf("%s/%s/@latest", c.url, escapedPath), nil
+		return fmt.Sprintf("/%s/@latest", escapedPath), nil
 	}
 	escapedVersion, err := module.EscapeVersion(version)
 	if err != nil {
 		return "", fmt.Errorf("version: %v: %w", err, derrors.InvalidArgument)
 	}
-	return fmt.Sprintf("%s/%s/@v/%s.%s", c.url, escapedPath, escapedVersion, suffix), nil
+	return fmt.Sprintf("/%s/@v/%s.%s", escapedPath, escapedVersion, suffix), nil
 }
 
+// readBody returns the body of the response to a request for the given
+// module path, version and suffix, or the file with the same contents in the
+// disk cache.
 func (c *Client) readBody(ctx context.Context, modulePath, version, suffix string) (_ []byte, err error) {
 	defer derrors.Wrap(&err, "Client.readBody(%q, %q, %q)", modulePath, version, suffix)
 
+	if c.cache != nil && cacheable(version) {
+		return c.cache.readThrough(modulePath, version, suffix, func() ([]byte, error) {
+			return c.requestBody(ctx, modulePath, version, suffix)
+		})
+	}
+	return c.requestBody(ctx, modulePath, version, suffix)
+}
+
+// requestBody returns the body of the response to a request to the proxy for
+// the given module path, version and suffix.
+func (c *Client) requestBody(ctx context.Context, modulePath, version, suffix string) (_ []byte, err error) {
 	u, err := c.escapedURL(modulePath, version, suffix)
 	if err != nil {
 		return nil, err
 	}
 	var data []byte
-	err = c.executeRequest(ctx, u, func(body io.Reader) error {
+	if _, err := c.executeRequest(ctx, u, func(body io.Reader) error {
 		var err error
 		data, err = ioutil.ReadAll(body)
 		return err
-	})
-	if err != nil {
+	}); err != nil {
 		return nil, err
 	}
 	return data, nil
@@ -146,7 +251,7 @@ func (c *Client) ListVersions(ctx context.Context, modulePath string) ([]string,
 	if err != nil {
 		return nil, fmt.Errorf("module.EscapePath(%q): %w", modulePath, derrors.InvalidArgument)
 	}
-	u := fmt.Sprintf("%s/%s/@v/list", c.url, escapedPath)
+	u := fmt.Sprintf("/%s/@v/list", escapedPath)
 	var versions []string
 	collect := func(body io.Reader) error {
 		scanner := bufio.NewScanner(body)
@@ -155,24 +260,42 @@ func (c *Client) ListVersions(ctx context.Context, modulePath string) ([]string,
 		}
 		return scanner.Err()
 	}
-	if err := c.executeRequest(ctx, u, collect); err != nil {
+	if _, err := c.executeRequest(ctx, u, collect); err != nil {
 		return nil, err
 	}
 	return versions, nil
 }
 
-// executeRequest executes an HTTP GET request for u, then calls the bodyFunc
-// on the response body, if no error occurred.
-func (c *Client) executeRequest(ctx context.Context, u string, bodyFunc func(body io.Reader) error) (err error) {
+// executeRequest executes an HTTP GET request for the URL u, relative to the
+// URL of each proxy in turn, until a proxy gives a response that doesn't call
+// for falling back to the next one. It then calls the bodyFunc on the response
+// body, if no error occurred, and returns the URL of the proxy that responded.
+// If every proxy fails, it returns the error from the last one.
+func (c *Client) executeRequest(ctx context.Context, u string, bodyFunc func(body io.Reader) error) (proxyURL string, err error) {
+	for i, pu := range c.urls {
+		var fallBack bool
+		fallBack, err = c.executeRequestTo(ctx, pu+u, bodyFunc)
+		if !fallBack || i == len(c.urls)-1 || ctx.Err() != nil {
+			return pu, err
+		}
+	}
+	return "", errors.New("no proxy URLs")
+}
+
+// executeRequestTo executes an HTTP GET request for u, then calls the bodyFunc
+// on the response body, if no error occurred. It also reports whether the
+// request should be retried with the next proxy: that is the case if the
+// proxy could not be reached, or responded with a 404, 410 or 5xx status.
+func (c *Client) executeRequestTo(ctx context.Context, u string, bodyFunc func(body io.Reader) error) (fallBack bool, err error) {
 	defer func() {
 		if ctx.Err() != nil {
 			err = fmt.Errorf("%v: %w", err, derrors.ProxyTimedOut)
 		}
-		derrors.Wrap(&err, "executeRequest(ctx, %q)", u)
+		derrors.Wrap(&err, "executeRequestTo(ctx, %q)", u)
 	}()
 	r, err := ctxhttp.Get(ctx, c.httpClient, u)
 	if err != nil {
-		return fmt.Errorf("ctxhttp.Get(ctx, client, %q): %v", u, err)
+		return true, fmt.Errorf("ctxhttp.Get(ctx, client, %q): %v", u, err)
 	}
 	defer r.Body.Close()
 	switch {
@@ -187,15 +310,15 @@ func (c *Client) executeRequest(ctx context.Context, u string, bodyFunc func(bod
 		// later.
 		data, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			return fmt.Errorf("ioutil.readall: %v", err)
+			return true, fmt.Errorf("ioutil.readall: %v", err)
 		}
 		d := string(data)
 		if strings.Contains(d, "fetch timed out") {
-			return fmt.Errorf("%q: %w", d, derrors.ProxyTimedOut)
+			return true, fmt.Errorf("%q: %w", d, derrors.ProxyTimedOut)
 		}
-		return fmt.Errorf("%q: %w", d, derrors.NotFound)
+		return true, fmt.Errorf("%q: %w", d, derrors.NotFound)
 	default:
-		return fmt.Errorf("unexpected status %d %s", r.StatusCode, r.Status)
+		return r.StatusCode >= 500, fmt.Errorf("unexpected status %d %s", r.StatusCode, r.Status)
 	}
-	return bodyFunc(r.Body)
+	return false, bodyFunc(r.Body)
 }
@@ -5,10 +5,14 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -242,15 +246,35 @@ func TestGetZipNonExist(t *testing.T) {
 	}
 }
 
+func TestDownloadZip(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	client, teardownProxy := SetupTestClient(t, []*Module{testModule})
+	defer teardownProxy()
+
+	var buf bytes.Buffer
+	if _, err := client.DownloadZip(ctx, sample.ModulePath, sample.VersionString, &buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	size := int64(buf.Len())
+	if _, err := client.DownloadZip(ctx, sample.ModulePath, sample.VersionString, ioutil.Discard, size); err != nil {
+		t.Errorf("DownloadZip with maxSize = size: %v", err)
+	}
+	if _, err := client.DownloadZip(ctx, sample.ModulePath, sample.VersionString, ioutil.Discard, size-1); !errors.Is(err, derrors.ModuleTooLarge) {
+		t.Errorf("DownloadZip with maxSize = size-1: got %v, want %v", err, derrors.ModuleTooLarge)
+	}
+}
+
 func TestEncodedURL(t *testing.T) {
-	c := &Client{url: "u"}
+	c := &Client{}
 	for _, test := range []struct {
 		path, version, suffix string
 		want                  string // empty => error
 	}{
 		{
 			"mod.com", "v1.0.0", "info",
-			"u/mod.com/@v/v1.0.0.info",
+			"/mod.com/@v/v1.0.0.info",
 		},
 		{
 			"mod", "v1.0.0", "info",
@@ -258,11 +282,11 @@ func TestEncodedURL(t *testing.T) {
 		},
 		{
 			"mod.com", "v1.0.0-rc1", "info",
-			"u/mod.com/@v/v1.0.0-rc1.info",
+			"/mod.com/@v/v1.0.0-rc1.info",
 		},
 		{
 			"mod.com/Foo", "v1.0.0-RC1", "info",
-			"u/mod.com/!foo/@v/v1.0.0-!r!c1.info",
+			"/mod.com/!foo/@v/v1.0.0-!r!c1.info",
 		},
 		{
 			"mod.com", ".", "info",
@@ -270,7 +294,7 @@ func TestEncodedURL(t *testing.T) {
 		},
 		{
 			"mod.com", "v1.0.0", "zip",
-			"u/mod.com/@v/v1.0.0.zip",
+			"/mod.com/@v/v1.0.0.zip",
 		},
 		{
 			"mod", "v1.0.0", "zip",
@@ -278,11 +302,11 @@ func TestEncodedURL(t *testing.T) {
 		},
 		{
 			"mod.com", "v1.0.0-rc1", "zip",
-			"u/mod.com/@v/v1.0.0-rc1.zip",
+			"/mod.com/@v/v1.0.0-rc1.zip",
 		},
 		{
 			"mod.com/Foo", "v1.0.0-RC1", "zip",
-			"u/mod.com/!foo/@v/v1.0.0-!r!c1.zip",
+			"/mod.com/!foo/@v/v1.0.0-!r!c1.zip",
 		},
 		{
 			"mod.com", ".", "zip",
@@ -290,7 +314,7 @@ func TestEncodedURL(t *testing.T) {
 		},
 		{
 			"mod.com", internal.LatestVersion, "info",
-			"u/mod.com/@latest",
+			"/mod.com/@latest",
 		},
 		{
 			"mod.com", internal.LatestVersion, "zip",
@@ -307,3 +331,114 @@ func TestEncodedURL(t *testing.T) {
 		}
 	}
 }
+
+func TestNew(t *testing.T) {
+	for _, test := range []struct {
+		in       string
+		wantURLs []string // nil => error
+	}{
+		{"https://proxy.golang.org/", []string{"https://proxy.golang.org"}},
+		{"https://a.com, https://b.com/", []string{"https://a.com", "https://b.com"}},
+		{"https://a.com,direct", nil},
+		{"off", nil},
+		{"https://a.com,,https://b.com", nil},
+		{"https://a.com|https://b.com", nil},
+	} {
+		c, err := New(test.in)
+		if test.wantURLs == nil {
+			if !errors.Is(err, derrors.InvalidArgument) {
+				t.Errorf("New(%q): got error %v, want %v", test.in, err, derrors.InvalidArgument)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("New(%q): %v", test.in, err)
+		}
+		if diff := cmp.Diff(test.wantURLs, c.urls); diff != "" {
+			t.Errorf("New(%q): urls mismatch (-want +got):\n%s", test.in, diff)
+		}
+	}
+}
+
+func TestFallback(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	module := func(path, contents string) *Module {
+		return &Module{
+			ModulePath: path,
+			Version:    sample.VersionString,
+			Files:      map[string]string{"go.mod": "module " + path + "\n\n// " + contents},
+		}
+	}
+	// The primary proxy has only one module, and fails in different ways for
+	// others. The secondary proxy has all of them, with different go.mod
+	// files.
+	primary := NewServer([]*Module{module("both.com/m", "primary")})
+	for path, status := range map[string]int{
+		"unavailable.com/m": http.StatusServiceUnavailable,
+		"gone.com/m":        http.StatusGone,
+		"forbidden.com/m":   http.StatusForbidden,
+	} {
+		status := status
+		primary.AddRoute(fmt.Sprintf("/%s/@v/%s.mod", path, sample.VersionString),
+			func(w http.ResponseWriter, r *http.Request) { http.Error(w, "error", status) })
+	}
+	var modules []*Module
+	for _, path := range []string{"both.com/m", "secondary.com/m", "unavailable.com/m", "gone.com/m", "forbidden.com/m"} {
+		modules = append(modules, module(path, "secondary"))
+	}
+	secondary := NewServer(modules)
+	client, teardownProxy, err := NewClientForServers(primary, secondary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer teardownProxy()
+
+	for _, test := range []struct {
+		modulePath string
+		want       string // empty => error
+	}{
+		{"both.com/m", "primary"},
+		{"secondary.com/m", "secondary"},
+		{"unavailable.com/m", "secondary"},
+		{"gone.com/m", "secondary"},
+		{"forbidden.com/m", ""},
+	} {
+		got, err := client.GetMod(ctx, test.modulePath, sample.VersionString)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("GetMod(%q): got %q, want error", test.modulePath, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("GetMod(%q): %v", test.modulePath, err)
+		}
+		if !strings.HasSuffix(string(got), "// "+test.want) {
+			t.Errorf("GetMod(%q) = %q, want the go.mod file of the %s proxy", test.modulePath, got, test.want)
+		}
+	}
+
+	// The proxy that served a zip is reported.
+	if proxyURL, err := client.DownloadZip(ctx, "secondary.com/m", sample.VersionString, ioutil.Discard, 0); err != nil {
+		t.Fatal(err)
+	} else if proxyURL != client.urls[1] {
+		t.Errorf("DownloadZip: got proxy URL %q, want %q", proxyURL, client.urls[1])
+	}
+
+	// A proxy that can't be reached is skipped.
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	client.urls = append([]string{down.URL}, client.urls...)
+	if proxyURL, err := client.DownloadZip(ctx, "both.com/m", sample.VersionString, ioutil.Discard, 0); err != nil {
+		t.Fatal(err)
+	} else if proxyURL != client.urls[1] {
+		t.Errorf("DownloadZip: got proxy URL %q, want %q", proxyURL, client.urls[1])
+	}
+
+	// If all proxies fail, the error of the last one is returned.
+	if _, err := client.GetInfo(ctx, "nowhere.com/m", sample.VersionString); !errors.Is(err, derrors.NotFound) {
+		t.Errorf("GetInfo: got %v, want %v", err, derrors.NotFound)
+	}
+}
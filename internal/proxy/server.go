@@ -65,8 +65,9 @@ func (s *Server) handleLatest(modulePath, urlPath string) {
 // handleMod creates a mod endpoint for the specified module version.
 func (s *Server) handleMod(m *Module) {
 	defaultGoMod := func(modulePath string) string {
-		// defaultGoMod creates a bare-bones go.mod contents.
-		return fmt.Sprintf("module %s\n\ngo 1.12", modulePath)
+		// defaultGoMod creates a bare-bones go.mod contents, like the one
+		// that the proxy synthesizes for a module without a go.mod file.
+		return fmt.Sprintf("module %s\n", modulePath)
 	}
 	goMod := m.Files["go.mod"]
 	if goMod == "" {
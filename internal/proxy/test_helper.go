@@ -5,6 +5,10 @@
 package proxy
 
 import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"golang.org/x/pkgsite/internal/testing/testhelper"
@@ -16,7 +20,7 @@ import (
 //
 // It returns a function for tearing down the proxy after the test is completed
 // and a Client for interacting with the test proxy.
-func SetupTestClient(t *testing.T, modules []*Module) (*Client, func()) {
+func SetupTestClient(t testing.TB, modules []*Module) (*Client, func()) {
 	t.Helper()
 	s := NewServer(modules)
 	client, serverClose, err := NewClientForServer(s)
@@ -38,3 +42,34 @@ func NewClientForServer(s *Server) (*Client, func(), error) {
 	client.httpClient = httpClient
 	return client, serverClose, nil
 }
+
+// NewClientForServers starts serving each of servers locally. It returns a
+// client that tries the servers in order, as a proxy client constructed from a
+// comma-separated list of URLs does, and a function to shut down the servers.
+func NewClientForServers(servers ...*Server) (*Client, func(), error) {
+	var (
+		urls   []string
+		closes []func()
+	)
+	for _, s := range servers {
+		srv := httptest.NewTLSServer(s.mux)
+		urls = append(urls, srv.URL)
+		closes = append(closes, srv.Close)
+	}
+	teardown := func() {
+		for _, c := range closes {
+			c()
+		}
+	}
+	client, err := New(strings.Join(urls, ","))
+	if err != nil {
+		teardown()
+		return nil, nil, err
+	}
+	client.httpClient = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	return client, teardown, nil
+}
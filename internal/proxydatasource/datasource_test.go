@@ -113,7 +113,7 @@ var (
 		LegacyPackage: wantPackage,
 	}
 	cmpOpts = append([]cmp.Option{
-		cmpopts.IgnoreFields(internal.LegacyPackage{}, "DocumentationHTML"),
+		cmpopts.IgnoreFields(internal.LegacyPackage{}, "DocumentationHTML", "Documentation", "ContentHash"),
 		cmpopts.IgnoreFields(licenses.License{}, "Contents"),
 	}, sample.LicenseCmpOpts...)
 )
@@ -246,6 +246,46 @@ func TestDataSource_LegacyGetLicenses(t *testing.T) {
 	}
 }
 
+func TestDataSource_GetUnit_Licenses(t *testing.T) {
+	ctx, ds, teardown := setup(t)
+	defer teardown()
+
+	for _, test := range []struct {
+		path, modulePath string
+		wantContents     bool
+	}{
+		{"foo.com/bar/baz", "foo.com/bar", true},
+		{"foo.com/nr/baz", "foo.com/nr", false},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			um := &internal.UnitMeta{Path: test.path, ModulePath: test.modulePath, Version: "v1.1.0"}
+			got, err := ds.GetUnit(ctx, um, internal.WithLicenses)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.LicenseContents) != 1 {
+				t.Fatalf("got %d licenses, want 1", len(got.LicenseContents))
+			}
+			lic := got.LicenseContents[0]
+			if lic.FilePath != "LICENSE" {
+				t.Errorf("got FilePath %q, want %q", lic.FilePath, "LICENSE")
+			}
+			if gotContents := len(lic.Contents) > 0; gotContents != test.wantContents {
+				t.Errorf("got contents %t, want %t", gotContents, test.wantContents)
+			}
+
+			// The licenses are not requested, so they should not be populated.
+			got, err = ds.GetUnit(ctx, um, internal.MinimalFields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.LicenseContents != nil {
+				t.Errorf("got LicenseContents %v without WithLicenses, want nil", got.LicenseContents)
+			}
+		})
+	}
+}
+
 func TestDataSource_LegacyGetModuleLicenses(t *testing.T) {
 	ctx, ds, teardown := setup(t)
 	defer teardown()
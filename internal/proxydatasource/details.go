@@ -13,6 +13,7 @@ import (
 	"strings"
 
 	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/complete"
 	"golang.org/x/pkgsite/internal/derrors"
 	"golang.org/x/pkgsite/internal/licenses"
 	"golang.org/x/pkgsite/internal/proxy"
@@ -21,7 +22,24 @@ import (
 // GetUnit returns information about a directory at a path.
 func (ds *DataSource) GetUnit(ctx context.Context, um *internal.UnitMeta, field internal.FieldSet) (_ *internal.Unit, err error) {
 	defer derrors.Wrap(&err, "GetUnit(%q, %q, %q)", um.Path, um.ModulePath, um.Version)
-	return ds.getUnit(ctx, um.Path, um.ModulePath, um.Version)
+	u, err := ds.getUnit(ctx, um.Path, um.ModulePath, um.Version)
+	if err != nil {
+		return nil, err
+	}
+	if field&internal.WithLicenses == 0 {
+		return u, nil
+	}
+	m, err := ds.getModule(ctx, um.ModulePath, um.Version)
+	if err != nil {
+		return nil, err
+	}
+	// Copy the unit so that the cached module is not modified.
+	unit := *u
+	unit.LicenseContents = licensesForPath(m, unit.Path)
+	if !ds.bypassLicenseCheck {
+		unit.RemoveNonRedistributableData()
+	}
+	return &unit, nil
 }
 
 // LegacyGetLicenses return licenses at path for the given module path and version.
@@ -32,23 +50,46 @@ func (ds *DataSource) LegacyGetLicenses(ctx context.Context, fullPath, modulePat
 		return nil, err
 	}
 
-	var lics []*licenses.License
+	lics := licensesForPath(v, fullPath)
+	if len(lics) == 0 {
+		return nil, fmt.Errorf("path %s is missing from module %s: %w", fullPath, modulePath, derrors.NotFound)
+	}
+	return lics, nil
+}
 
-	// ds.getModule() returns all licenses for the module version. We need to
-	// filter the licenses that applies to the specified fullPath, i.e.
-	// A license in the current or any parent directory of the specified
-	// fullPath applies to it.
-	for _, license := range v.Licenses {
-		licensePath := path.Join(modulePath, path.Dir(license.FilePath))
+// licensesForPath returns the licenses of m that apply to fullPath.
+//
+// ds.getModule() returns all licenses for the module version. We need to
+// filter the licenses that applies to the specified fullPath, i.e.
+// A license in the current or any parent directory of the specified
+// fullPath applies to it.
+func licensesForPath(m *internal.Module, fullPath string) []*licenses.License {
+	var lics []*licenses.License
+	for _, license := range m.Licenses {
+		licensePath := path.Join(m.ModulePath, path.Dir(license.FilePath))
 		if strings.HasPrefix(fullPath, licensePath) {
 			lics = append(lics, license)
 		}
 	}
+	return lics
+}
 
-	if len(lics) == 0 {
-		return nil, fmt.Errorf("path %s is missing from module %s: %w", fullPath, modulePath, derrors.NotFound)
+// GetModuleReadme returns the README at the root of the module version
+// specified by modulePath and version.
+func (ds *DataSource) GetModuleReadme(ctx context.Context, modulePath, version string) (_ *internal.Readme, err error) {
+	defer derrors.Wrap(&err, "GetModuleReadme(%q, %q)", modulePath, version)
+	u, err := ds.getUnit(ctx, modulePath, modulePath, version)
+	if err != nil {
+		return nil, err
 	}
-	return lics, nil
+	if u.Readme == nil {
+		return nil, fmt.Errorf("README of %s@%s: %w", modulePath, version, derrors.NotFound)
+	}
+	readme := *u.Readme
+	if !u.IsRedistributable && !ds.bypassLicenseCheck {
+		readme.Contents = ""
+	}
+	return &readme, nil
 }
 
 // GetModuleInfo returns the ModuleInfo as fetched from the proxy for module
@@ -79,9 +120,15 @@ func (ds *DataSource) GetUnitMeta(ctx context.Context, path, inModulePath, inVer
 		return nil, err
 	}
 	um := &internal.UnitMeta{
-		Path:       path,
-		ModulePath: inModulePath,
-		Version:    inVersion,
+		Path:              path,
+		ModulePath:        inModulePath,
+		Version:           inVersion,
+		HasSecurityPolicy: m.HasSecurityPolicy,
+		ProcessedPackages: m.ProcessedPackages,
+		TotalPackages:     m.TotalPackages,
+		GoVersion:         m.GoVersion,
+		Toolchain:         m.Toolchain,
+		ChecksumStatus:    m.ChecksumStatus,
 	}
 	for _, d := range m.Units {
 		if d.Path == path {
@@ -102,3 +149,49 @@ func (*DataSource) GetExperiments(ctx context.Context) ([]*internal.Experiment,
 func (ds *DataSource) GetNestedModules(ctx context.Context, modulePath string) (_ []*internal.ModuleInfo, err error) {
 	return nil, nil
 }
+
+// GetVersionsForPath returns the tagged versions of the module containing
+// path, as listed by the proxy, followed by its pseudo-versions.
+func (ds *DataSource) GetVersionsForPath(ctx context.Context, path string) (_ []*internal.ModuleInfo, err error) {
+	defer derrors.Wrap(&err, "GetVersionsForPath(%q)", path)
+	versions, err := ds.listPackageVersions(ctx, path, false)
+	if err != nil {
+		return nil, err
+	}
+	pseudo, err := ds.listPackageVersions(ctx, path, true)
+	if err != nil {
+		return nil, err
+	}
+	return append(versions, pseudo...), nil
+}
+
+// GetImportedBy is unsupported in proxy mode, since it would require
+// fetching every module.
+func (*DataSource) GetImportedBy(ctx context.Context, pkgPath, modulePath, cursor string, limit int) ([]string, string, error) {
+	return nil, "", fmt.Errorf("GetImportedBy: %w", derrors.Unsupported)
+}
+
+// GetImportedByCount is unsupported in proxy mode.
+func (*DataSource) GetImportedByCount(ctx context.Context, pkgPath string) (int, error) {
+	return 0, fmt.Errorf("GetImportedByCount: %w", derrors.Unsupported)
+}
+
+// Search is unsupported in proxy mode.
+func (*DataSource) Search(ctx context.Context, q string, limit, offset int) ([]*internal.SearchResult, error) {
+	return nil, fmt.Errorf("Search: %w", derrors.Unsupported)
+}
+
+// SearchSymbols is unsupported in proxy mode.
+func (*DataSource) SearchSymbols(ctx context.Context, sq *internal.SymbolQuery, limit int) ([]*internal.SymbolSearchResult, error) {
+	return nil, fmt.Errorf("SearchSymbols: %w", derrors.Unsupported)
+}
+
+// GetStdlibPathsWithSuffix is unsupported in proxy mode.
+func (*DataSource) GetStdlibPathsWithSuffix(ctx context.Context, suffix string) ([]string, error) {
+	return nil, fmt.Errorf("GetStdlibPathsWithSuffix: %w", derrors.Unsupported)
+}
+
+// GetPathCompletions is unsupported in proxy mode.
+func (*DataSource) GetPathCompletions(ctx context.Context, prefix string, limit int) ([]*complete.Completion, error) {
+	return nil, fmt.Errorf("GetPathCompletions: %w", derrors.Unsupported)
+}
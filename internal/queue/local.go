@@ -0,0 +1,402 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/pkgsite/internal/config"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/experiment"
+	"golang.org/x/pkgsite/internal/log"
+	"golang.org/x/pkgsite/internal/postgres"
+)
+
+var (
+	keyLocalQueueName  = tag.MustNewKey("queue.name")
+	keyLocalTaskResult = tag.MustNewKey("queue.task_result")
+
+	localQueueDepth = stats.Int64(
+		"go-discovery/queue/local_depth",
+		"The number of tasks of a local queue that are waiting, running or waiting to be retried.",
+		stats.UnitDimensionless,
+	)
+	localTaskLatency = stats.Float64(
+		"go-discovery/queue/local_task_latency",
+		"The time taken by a try of a task of a local queue.",
+		stats.UnitMilliseconds,
+	)
+
+	// LocalQueueDepth is the number of pending tasks of local queues.
+	LocalQueueDepth = &view.View{
+		Name:        "go-discovery/queue/local_depth",
+		Measure:     localQueueDepth,
+		Aggregation: view.LastValue(),
+		Description: "local queue depth, by queue",
+		TagKeys:     []tag.Key{keyLocalQueueName},
+	}
+	// LocalTaskLatency is the distribution of the latencies of tries of tasks
+	// of local queues, by their result: "ok", "retry" or "failed".
+	LocalTaskLatency = &view.View{
+		Name:        "go-discovery/queue/local_task_latency",
+		Measure:     localTaskLatency,
+		Aggregation: ochttp.DefaultLatencyDistribution,
+		Description: "local queue task latency, by queue and result",
+		TagKeys:     []tag.Key{keyLocalQueueName, keyLocalTaskResult},
+	}
+)
+
+// A Store persists the pending tasks of a Local queue. It is implemented by
+// *postgres.DB.
+type Store interface {
+	PutQueueTask(ctx context.Context, queueName string, t *postgres.QueueTask) error
+	DeleteQueueTask(ctx context.Context, queueName string, t *postgres.QueueTask) error
+	GetQueueTasks(ctx context.Context, queueName string) ([]*postgres.QueueTask, error)
+}
+
+// localOptions configures a Local queue.
+type localOptions struct {
+	concurrency  int
+	taskTimeout  time.Duration
+	maxRetries   int
+	retryBackoff time.Duration
+	experiments  []string
+	store        Store // if nil, tasks are not persisted
+}
+
+// Local is a Queue implementation that processes tasks in-process with a
+// fixed number of workers, for deployments that do not use Cloud Tasks. Like
+// Cloud Tasks, it de-duplicates tasks, and retries tasks that fail with
+// errors that the worker's /fetch endpoint reports as retryable. Waiting
+// tasks of higher priority run first. It can store its pending tasks in the
+// database, so that they are resumed after a restart.
+type Local struct {
+	name        string
+	opts        localOptions
+	processFunc inMemoryProcessFunc
+
+	mu sync.Mutex
+	// waiting holds the tasks that are waiting to run, oldest first, by
+	// priority.
+	waiting [numPriorities][]*postgres.QueueTask
+	// pending holds the tasks that are waiting, running or waiting to be
+	// retried, by key.
+	pending map[string]*postgres.QueueTask
+	// wake has a value for each idle worker that should look for a task.
+	wake chan struct{}
+	// running counts the tasks that are running or waiting to be retried.
+	running sync.WaitGroup
+}
+
+// NewLocal returns a Local queue with name queueName, configured by
+// cfg.LocalQueue, that runs processFunc on numWorkers tasks at once until ctx
+// is done. If cfg.LocalQueue.Persist is set, its pending tasks are stored in
+// db, and the tasks stored there by a previous run are resumed.
+func NewLocal(ctx context.Context, cfg *config.Config, queueName string, numWorkers int, db *postgres.DB, processFunc inMemoryProcessFunc) (_ *Local, err error) {
+	defer derrors.Wrap(&err, "NewLocal(ctx, cfg, %q, %d)", queueName, numWorkers)
+
+	experiments, err := activeExperiments(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	opts := localOptions{
+		concurrency:  numWorkers,
+		taskTimeout:  cfg.LocalQueue.TaskTimeout,
+		maxRetries:   cfg.LocalQueue.MaxRetries,
+		retryBackoff: cfg.LocalQueue.RetryBackoff,
+		experiments:  experiments,
+	}
+	if cfg.LocalQueue.Persist {
+		opts.store = db
+	}
+	return newLocal(ctx, queueName, opts, processFunc)
+}
+
+func newLocal(ctx context.Context, name string, opts localOptions, processFunc inMemoryProcessFunc) (*Local, error) {
+	if opts.concurrency < 1 {
+		return nil, fmt.Errorf("concurrency is %d, want at least 1", opts.concurrency)
+	}
+	if opts.taskTimeout <= 0 {
+		opts.taskTimeout = 5 * time.Minute
+	}
+	q := &Local{
+		name:        name,
+		opts:        opts,
+		processFunc: processFunc,
+		pending:     map[string]*postgres.QueueTask{},
+		wake:        make(chan struct{}, opts.concurrency),
+	}
+	if opts.store != nil {
+		tasks, err := opts.store.GetQueueTasks(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tasks {
+			q.add(ctx, t)
+		}
+		if len(tasks) > 0 {
+			log.Infof(ctx, "queue %q: resuming %d pending tasks", name, len(tasks))
+		}
+	}
+	for i := 0; i < opts.concurrency; i++ {
+		go q.work(ctx)
+	}
+	return q, nil
+}
+
+// ScheduleFetch adds a task to fetch modulePath at version with priority to
+// the queue. If the same task, with the same suffix, is already pending, it
+// returns false; if that task is waiting with a lower priority, it is given
+// priority instead.
+func (q *Local) ScheduleFetch(ctx context.Context, modulePath, version, suffix string, priority Priority, taskIDChangeInterval time.Duration) (enqueued bool, err error) {
+	defer derrors.Wrap(&err, "queue.Local.ScheduleFetch(%q, %q, %q, %s)", modulePath, version, suffix, priority)
+
+	t := &postgres.QueueTask{ModulePath: modulePath, Version: version, Suffix: suffix, Priority: int(priority)}
+	q.mu.Lock()
+	dup := q.pending[taskKey(t)] != nil
+	promoted := dup && q.promoteLocked(taskKey(t), priority)
+	q.mu.Unlock()
+	if promoted {
+		// The new priority is not stored, so a task resumed after a restart
+		// has the priority it was first scheduled with.
+		log.Infof(ctx, "queue %q: raised the priority of waiting task %s@%s to %s", q.name, modulePath, version, priority)
+		return false, nil
+	}
+	if dup {
+		log.Infof(ctx, "queue %q: ignoring duplicate task %s@%s", q.name, modulePath, version)
+		return false, nil
+	}
+	// Store the task before it can run, so that it can't be deleted from the
+	// store before it is put there.
+	if q.opts.store != nil {
+		if err := q.opts.store.PutQueueTask(ctx, q.name, t); err != nil {
+			return false, err
+		}
+	}
+	return q.add(ctx, t), nil
+}
+
+func taskKey(t *postgres.QueueTask) string {
+	return t.ModulePath + "@" + t.Version + "-" + t.Suffix
+}
+
+// add makes t wait to be run, unless it is already pending. It reports
+// whether it did.
+func (q *Local) add(ctx context.Context, t *postgres.QueueTask) bool {
+	q.mu.Lock()
+	key := taskKey(t)
+	if q.pending[key] != nil {
+		q.mu.Unlock()
+		return false
+	}
+	q.pending[key] = t
+	q.waitLocked(t)
+	q.running.Add(1)
+	q.recordDepthLocked(ctx)
+	q.mu.Unlock()
+	q.signal()
+	return true
+}
+
+// signal wakes an idle worker, if there is one that is not already awake.
+func (q *Local) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// priority returns the priority of t. Stored tasks with an unknown priority
+// have PriorityBackfill.
+func priority(t *postgres.QueueTask) Priority {
+	p := Priority(t.Priority)
+	if p < 0 || p >= numPriorities {
+		return PriorityBackfill
+	}
+	return p
+}
+
+// waitLocked makes t wait to run after the other waiting tasks of its
+// priority.
+func (q *Local) waitLocked(t *postgres.QueueTask) {
+	p := priority(t)
+	q.waiting[p] = append(q.waiting[p], t)
+}
+
+// promoteLocked gives the waiting task with key priority p, if its priority
+// is lower. It reports whether it did.
+func (q *Local) promoteLocked(key string, p Priority) bool {
+	t := q.pending[key]
+	old := priority(t)
+	if old >= p {
+		return false
+	}
+	for i, w := range q.waiting[old] {
+		if w == t {
+			q.waiting[old] = append(q.waiting[old][:i], q.waiting[old][i+1:]...)
+			t.Priority = int(p)
+			q.waitLocked(t)
+			return true
+		}
+	}
+	// t is running or waiting to be retried.
+	return false
+}
+
+// next removes and returns the task of highest priority that has waited
+// longest, or nil if none is waiting.
+func (q *Local) next() *postgres.QueueTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for p := numPriorities - 1; p >= 0; p-- {
+		if len(q.waiting[p]) > 0 {
+			t := q.waiting[p][0]
+			q.waiting[p][0] = nil
+			q.waiting[p] = q.waiting[p][1:]
+			return t
+		}
+	}
+	return nil
+}
+
+// work runs tasks as they become available, until ctx is done.
+func (q *Local) work(ctx context.Context) {
+	for {
+		if t := q.next(); t != nil {
+			q.run(ctx, t)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		}
+	}
+}
+
+// run tries t once, and then either schedules a retry or finishes it.
+func (q *Local) run(ctx context.Context, t *postgres.QueueTask) {
+	if ctx.Err() != nil {
+		// Leave t in the store, to be resumed.
+		q.finish(ctx, t, false)
+		return
+	}
+	log.Infof(ctx, "queue %q: fetch requested: %s@%s (attempt %d)", q.name, t.ModulePath, t.Version, t.Attempts+1)
+	fetchCtx, cancel := context.WithTimeout(ctx, q.opts.taskTimeout)
+	fetchCtx = experiment.NewContext(fetchCtx, q.opts.experiments...)
+	start := time.Now()
+	status, err := q.processFunc(fetchCtx, t.ModulePath, t.Version)
+	cancel()
+	latency := time.Since(start)
+	if err != nil {
+		log.Error(ctx, err)
+	}
+
+	switch {
+	case !shouldRetry(status):
+		q.recordLatency(ctx, "ok", latency)
+		q.finish(ctx, t, true)
+	case ctx.Err() != nil:
+		// The fetch was canceled because the queue is stopping. Leave t in
+		// the store, to be resumed.
+		q.recordLatency(ctx, "retry", latency)
+		q.finish(ctx, t, false)
+	case t.Attempts >= q.opts.maxRetries:
+		log.Errorf(ctx, "queue %q: giving up on %s@%s after %d attempts; last status %d",
+			q.name, t.ModulePath, t.Version, t.Attempts+1, status)
+		q.recordLatency(ctx, "failed", latency)
+		q.finish(ctx, t, true)
+	default:
+		q.recordLatency(ctx, "retry", latency)
+		t.Attempts++
+		if q.opts.store != nil {
+			if err := q.opts.store.PutQueueTask(ctx, q.name, t); err != nil {
+				log.Error(ctx, err)
+			}
+		}
+		delay := retryDelay(q.opts.retryBackoff, t.Attempts, rand.Float64())
+		log.Infof(ctx, "queue %q: retrying %s@%s in %s after status %d", q.name, t.ModulePath, t.Version, delay, status)
+		time.AfterFunc(delay, func() {
+			q.mu.Lock()
+			q.waitLocked(t)
+			q.mu.Unlock()
+			q.signal()
+		})
+	}
+}
+
+// finish removes t from the pending tasks, and also from the store if
+// remove is true.
+func (q *Local) finish(ctx context.Context, t *postgres.QueueTask, remove bool) {
+	if remove && q.opts.store != nil {
+		if err := q.opts.store.DeleteQueueTask(ctx, q.name, t); err != nil {
+			log.Error(ctx, err)
+		}
+	}
+	q.mu.Lock()
+	delete(q.pending, taskKey(t))
+	q.recordDepthLocked(ctx)
+	q.mu.Unlock()
+	q.running.Done()
+}
+
+func (q *Local) recordDepthLocked(ctx context.Context) {
+	stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(keyLocalQueueName, q.name)},
+		localQueueDepth.M(int64(len(q.pending))))
+}
+
+func (q *Local) recordLatency(ctx context.Context, result string, latency time.Duration) {
+	stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(keyLocalQueueName, q.name), tag.Upsert(keyLocalTaskResult, result)},
+		localTaskLatency.M(float64(latency)/float64(time.Millisecond)))
+}
+
+// shouldRetry reports whether a task whose fetch returned status should be
+// retried. These are the statuses for which the worker's /fetch endpoint
+// responds with an error, so that Cloud Tasks retries the task.
+func shouldRetry(status int) bool {
+	return status == http.StatusInternalServerError || status == http.StatusServiceUnavailable
+}
+
+// maxRetryDelay bounds the delay before a retry.
+const maxRetryDelay = time.Hour
+
+// retryDelay returns how long to wait before the attempts'th retry of a task,
+// which is backoff before the first one, and twice as long before each one
+// after that, plus up to a quarter of that as determined by jitter, a random
+// number in [0, 1).
+func retryDelay(backoff time.Duration, attempts int, jitter float64) time.Duration {
+	d := backoff
+	for i := 1; i < attempts && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d + time.Duration(jitter*float64(d)/4)
+}
+
+// WaitForTesting waits for all pending tasks to finish. It should only be
+// used by test code.
+func (q *Local) WaitForTesting(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		q.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal/postgres"
+)
+
+// fakeStore is an in-memory Store.
+type fakeStore struct {
+	mu    sync.Mutex
+	tasks map[string]postgres.QueueTask
+}
+
+func newFakeStore(tasks ...*postgres.QueueTask) *fakeStore {
+	s := &fakeStore{tasks: map[string]postgres.QueueTask{}}
+	for _, t := range tasks {
+		s.tasks[taskKey(t)] = *t
+	}
+	return s
+}
+
+func (s *fakeStore) PutQueueTask(ctx context.Context, queueName string, t *postgres.QueueTask) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[taskKey(t)] = *t
+	return nil
+}
+
+func (s *fakeStore) DeleteQueueTask(ctx context.Context, queueName string, t *postgres.QueueTask) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tasks, taskKey(t))
+	return nil
+}
+
+func (s *fakeStore) GetQueueTasks(ctx context.Context, queueName string) ([]*postgres.QueueTask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ts []*postgres.QueueTask
+	for _, t := range s.tasks {
+		t := t
+		ts = append(ts, &t)
+	}
+	sort.Slice(ts, func(i, j int) bool { return taskKey(ts[i]) < taskKey(ts[j]) })
+	return ts, nil
+}
+
+func (s *fakeStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tasks)
+}
+
+func TestLocalConcurrencyAndDeduplication(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	const concurrency = 2
+	var (
+		mu              sync.Mutex
+		running, maxRun int
+		fetched         []string
+	)
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	q, err := newLocal(ctx, "test", localOptions{concurrency: concurrency}, func(ctx context.Context, modulePath, version string) (int, error) {
+		mu.Lock()
+		running++
+		if running > maxRun {
+			maxRun = running
+		}
+		fetched = append(fetched, modulePath)
+		mu.Unlock()
+		started <- struct{}{}
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return http.StatusOK, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for i := 0; i < 5; i++ {
+		path := fmt.Sprintf("example.com/m%d", i)
+		want = append(want, path)
+		enqueued, err := q.ScheduleFetch(ctx, path, "v1.0.0", "", PriorityBackfill, 0)
+		if err != nil || !enqueued {
+			t.Fatalf("ScheduleFetch(%q) = %t, %v, want true, nil", path, enqueued, err)
+		}
+	}
+	// A pending task is not added again, unless its suffix differs.
+	if enqueued, err := q.ScheduleFetch(ctx, "example.com/m4", "v1.0.0", "", PriorityBackfill, 0); err != nil || enqueued {
+		t.Errorf("ScheduleFetch of duplicate = %t, %v, want false, nil", enqueued, err)
+	}
+	if enqueued, err := q.ScheduleFetch(ctx, "example.com/m4", "v1.0.0", "again", PriorityBackfill, 0); err != nil || !enqueued {
+		t.Errorf("ScheduleFetch with suffix = %t, %v, want true, nil", enqueued, err)
+	}
+	want = append(want, "example.com/m4")
+	// Wait for the workers to be busy, and give the queue a chance to start
+	// more tasks than it should.
+	for i := 0; i < concurrency; i++ {
+		<-started
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	if maxRun != concurrency {
+		t.Errorf("at most %d tasks ran at once, want %d", maxRun, concurrency)
+	}
+	mu.Unlock()
+	close(release)
+	q.WaitForTesting(ctx)
+
+	sort.Strings(fetched)
+	if diff := cmp.Diff(want, fetched); diff != "" {
+		t.Errorf("fetched mismatch (-want +got):\n%s", diff)
+	}
+	// A finished task can be added again.
+	if enqueued, err := q.ScheduleFetch(ctx, "example.com/m0", "v1.0.0", "", PriorityBackfill, 0); err != nil || !enqueued {
+		t.Errorf("ScheduleFetch of finished task = %t, %v, want true, nil", enqueued, err)
+	}
+	q.WaitForTesting(ctx)
+}
+
+func TestLocalPriority(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		fetched []string
+	)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	q, err := newLocal(ctx, "test", localOptions{concurrency: 1}, func(ctx context.Context, modulePath, version string) (int, error) {
+		mu.Lock()
+		fetched = append(fetched, modulePath)
+		n := len(fetched)
+		mu.Unlock()
+		if n == 1 {
+			started <- struct{}{}
+			<-release
+		}
+		return http.StatusOK, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule := func(path string, p Priority, wantEnqueued bool) {
+		t.Helper()
+		enqueued, err := q.ScheduleFetch(ctx, path, "v1.0.0", "", p, 0)
+		if err != nil || enqueued != wantEnqueued {
+			t.Fatalf("ScheduleFetch(%q, %s) = %t, %v, want %t, nil", path, p, enqueued, err, wantEnqueued)
+		}
+	}
+	// Occupy the only worker, and build up a backlog behind it.
+	schedule("example.com/running", PriorityBackfill, true)
+	<-started
+	const backlog = 1000
+	for i := 0; i < backlog; i++ {
+		schedule(fmt.Sprintf("example.com/backfill%d", i), PriorityBackfill, true)
+	}
+	schedule("example.com/user", PriorityInteractive, true)
+	// A waiting backfill task that is requested interactively moves up.
+	schedule("example.com/backfill500", PriorityInteractive, false)
+	close(release)
+	q.WaitForTesting(ctx)
+
+	if len(fetched) != backlog+2 {
+		t.Fatalf("fetched %d tasks, want %d", len(fetched), backlog+2)
+	}
+	want := []string{"example.com/running", "example.com/user", "example.com/backfill500", "example.com/backfill0"}
+	if diff := cmp.Diff(want, fetched[:len(want)]); diff != "" {
+		t.Errorf("first fetches mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLocalRetries(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, test := range []struct {
+		name         string
+		statuses     []int // returned by successive tries
+		maxRetries   int
+		wantAttempts int
+	}{
+		{"success", []int{http.StatusOK}, 3, 1},
+		{"terminal error", []int{http.StatusNotFound}, 3, 1},
+		{"transient errors", []int{500, 503, http.StatusOK}, 3, 3},
+		{"give up", []int{500, 500, 500, 500, 500}, 2, 3},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				mu       sync.Mutex
+				attempts int
+			)
+			store := newFakeStore()
+			opts := localOptions{
+				concurrency:  1,
+				maxRetries:   test.maxRetries,
+				retryBackoff: time.Millisecond,
+				store:        store,
+			}
+			q, err := newLocal(ctx, "test", opts, func(ctx context.Context, modulePath, version string) (int, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				status := test.statuses[attempts]
+				attempts++
+				if status != http.StatusOK {
+					return status, fmt.Errorf("status %d", status)
+				}
+				return status, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := q.ScheduleFetch(ctx, "example.com/m", "v1.0.0", "", PriorityBackfill, 0); err != nil {
+				t.Fatal(err)
+			}
+			q.WaitForTesting(ctx)
+			if attempts != test.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, test.wantAttempts)
+			}
+			if n := store.len(); n != 0 {
+				t.Errorf("%d tasks left in store, want 0", n)
+			}
+		})
+	}
+}
+
+func TestLocalResumesStoredTasks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	store := newFakeStore(
+		&postgres.QueueTask{ModulePath: "example.com/a", Version: "v1.0.0"},
+		&postgres.QueueTask{ModulePath: "example.com/b", Version: "v1.2.0", Attempts: 2},
+		&postgres.QueueTask{ModulePath: "example.com/c", Version: "v1.0.0", Priority: int(PriorityInteractive)},
+	)
+	var (
+		mu      sync.Mutex
+		fetched []string
+	)
+	q, err := newLocal(ctx, "test", localOptions{concurrency: 1, store: store}, func(ctx context.Context, modulePath, version string) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetched = append(fetched, modulePath+"@"+version)
+		return http.StatusOK, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.WaitForTesting(ctx)
+	// Resumed tasks keep their priority.
+	want := []string{"example.com/c@v1.0.0", "example.com/a@v1.0.0", "example.com/b@v1.2.0"}
+	if diff := cmp.Diff(want, fetched); diff != "" {
+		t.Errorf("fetched mismatch (-want +got):\n%s", diff)
+	}
+	if n := store.len(); n != 0 {
+		t.Errorf("%d tasks left in store, want 0", n)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for _, test := range []struct {
+		attempts int
+		jitter   float64
+		want     time.Duration
+	}{
+		{1, 0, 30 * time.Second},
+		{2, 0, time.Minute},
+		{3, 0.5, 2*time.Minute + 15*time.Second},
+		{8, 0, maxRetryDelay},
+		{100, 0, maxRetryDelay},
+	} {
+		if got := retryDelay(30*time.Second, test.attempts, test.jitter); got != test.want {
+			t.Errorf("retryDelay(30s, %d, %g) = %s, want %s", test.attempts, test.jitter, got, test.want)
+		}
+	}
+}
@@ -26,23 +26,46 @@ import (
 
 // A Queue provides an interface for asynchronous scheduling of fetch actions.
 type Queue interface {
-	ScheduleFetch(ctx context.Context, modulePath, version, suffix string, taskIDChangeInterval time.Duration) (bool, error)
+	ScheduleFetch(ctx context.Context, modulePath, version, suffix string, priority Priority, taskIDChangeInterval time.Duration) (bool, error)
+}
+
+// A Priority determines which fetch tasks are processed first.
+type Priority int
+
+const (
+	// PriorityBackfill is the priority of tasks that bring the database up to
+	// date in bulk, such as those of the worker's /enqueue and /requeue
+	// endpoints.
+	PriorityBackfill Priority = iota
+	// PriorityInteractive is the priority of tasks that users are waiting
+	// for, such as fetches requested on the frontend, and fetches of new
+	// latest releases. They overtake tasks of PriorityBackfill.
+	PriorityInteractive
+
+	numPriorities
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityBackfill:
+		return "backfill"
+	case PriorityInteractive:
+		return "interactive"
+	default:
+		return fmt.Sprintf("Priority(%d)", int(p))
+	}
 }
 
 // New creates a new Queue with name queueName based on the configuration
-// in cfg. When running locally, Queue uses numWorkers concurrent workers.
-func New(ctx context.Context, cfg *config.Config, queueName string, numWorkers int, db *postgres.DB, processFunc inMemoryProcessFunc) (Queue, error) {
+// in cfg. On GCP, tasks of PriorityInteractive are added to the Cloud Tasks
+// queue interactiveQueueName instead, unless it is empty. When running
+// locally, Queue uses numWorkers concurrent workers.
+func New(ctx context.Context, cfg *config.Config, queueName, interactiveQueueName string, numWorkers int, db *postgres.DB, processFunc inMemoryProcessFunc) (Queue, error) {
 	if !cfg.OnGCP() {
-		experiments, err := db.GetExperiments(ctx)
+		names, err := activeExperiments(ctx, db)
 		if err != nil {
 			return nil, err
 		}
-		var names []string
-		for _, e := range experiments {
-			if e.Rollout > 0 {
-				names = append(names, e.Name)
-			}
-		}
 		return NewInMemory(ctx, numWorkers, names, processFunc), nil
 	}
 
@@ -50,31 +73,54 @@ func New(ctx context.Context, cfg *config.Config, queueName string, numWorkers i
 	if err != nil {
 		return nil, err
 	}
-	g, err := newGCP(cfg, client, queueName)
+	g, err := newGCP(cfg, client, queueName, interactiveQueueName)
 	if err != nil {
 		return nil, err
 	}
-	log.Infof(ctx, "enqueuing at %s with queueService=%q, queueURL=%q", g.queueName, g.queueService, g.queueURL)
+	log.Infof(ctx, "enqueuing at %s (interactive tasks at %s) with queueService=%q, queueURL=%q",
+		g.queueName, g.interactiveQueueName, g.queueService, g.queueURL)
 	return g, nil
 }
 
+// activeExperiments returns the names of the experiments in db that are
+// rolled out to any extent.
+func activeExperiments(ctx context.Context, db *postgres.DB) ([]string, error) {
+	experiments, err := db.GetExperiments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range experiments {
+		if e.Rollout > 0 {
+			names = append(names, e.Name)
+		}
+	}
+	return names, nil
+}
+
 // GCP provides a Queue implementation backed by the Google Cloud Tasks
 // API.
 type GCP struct {
-	client       *cloudtasks.Client
-	queueName    string // full GCP name of the queue
-	queueService string // AppEngine service to post tasks to
-	queueURL     string // non-AppEngine URL to post tasks to
+	client               *cloudtasks.Client
+	queueName            string // full GCP name of the queue
+	interactiveQueueName string // full GCP name of the queue for PriorityInteractive
+	queueService         string // AppEngine service to post tasks to
+	queueURL             string // non-AppEngine URL to post tasks to
 }
 
 // NewGCP returns a new Queue that can be used to enqueue tasks using the
 // cloud tasks API.  The given queueID should be the name of the queue in the
-// cloud tasks console.
-func newGCP(cfg *config.Config, client *cloudtasks.Client, queueID string) (_ *GCP, err error) {
-	defer derrors.Wrap(&err, "newGCP(cfg, client, %q)", queueID)
+// cloud tasks console, and interactiveQueueID that of the queue for tasks of
+// PriorityInteractive. If interactiveQueueID is empty, all tasks go to
+// queueID.
+func newGCP(cfg *config.Config, client *cloudtasks.Client, queueID, interactiveQueueID string) (_ *GCP, err error) {
+	defer derrors.Wrap(&err, "newGCP(cfg, client, %q, %q)", queueID, interactiveQueueID)
 	if queueID == "" {
 		return nil, errors.New("empty queueID")
 	}
+	if interactiveQueueID == "" {
+		interactiveQueueID = queueID
+	}
 	if cfg.ProjectID == "" {
 		return nil, errors.New("empty ProjectID")
 	}
@@ -91,23 +137,25 @@ func newGCP(cfg *config.Config, client *cloudtasks.Client, queueID string) (_ *G
 		return nil, errors.New("on AppEngine, but QueueService is empty")
 	}
 	return &GCP{
-		client:       client,
-		queueName:    fmt.Sprintf("projects/%s/locations/%s/queues/%s", cfg.ProjectID, cfg.LocationID, queueID),
-		queueService: cfg.QueueService,
-		queueURL:     cfg.QueueURL,
+		client:               client,
+		queueName:            fmt.Sprintf("projects/%s/locations/%s/queues/%s", cfg.ProjectID, cfg.LocationID, queueID),
+		interactiveQueueName: fmt.Sprintf("projects/%s/locations/%s/queues/%s", cfg.ProjectID, cfg.LocationID, interactiveQueueID),
+		queueService:         cfg.QueueService,
+		queueURL:             cfg.QueueURL,
 	}, nil
 }
 
 // ScheduleFetch enqueues a task on GCP to fetch the given modulePath and
-// version. It returns an error if there was an error hashing the task name, or
-// an error pushing the task to GCP. If the task was a duplicate, it returns (false, nil).
-func (q *GCP) ScheduleFetch(ctx context.Context, modulePath, version, suffix string, taskIDChangeInterval time.Duration) (enqueued bool, err error) {
+// version, on the queue for priority. It returns an error if there was an
+// error hashing the task name, or an error pushing the task to GCP. If the
+// task was a duplicate, it returns (false, nil).
+func (q *GCP) ScheduleFetch(ctx context.Context, modulePath, version, suffix string, priority Priority, taskIDChangeInterval time.Duration) (enqueued bool, err error) {
 	// the new taskqueue API requires a deadline of <= 30s
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
-	defer derrors.Wrap(&err, "queue.ScheduleFetch(%q, %q, %q, %d)", modulePath, version, suffix, taskIDChangeInterval)
+	defer derrors.Wrap(&err, "queue.ScheduleFetch(%q, %q, %q, %s, %d)", modulePath, version, suffix, priority, taskIDChangeInterval)
 
-	req := q.newTaskRequest(modulePath, version, suffix, taskIDChangeInterval)
+	req := q.newTaskRequest(modulePath, version, suffix, priority, taskIDChangeInterval)
 	enqueued = true
 	if _, err := q.client.CreateTask(ctx, req); err != nil {
 		if status.Code(err) == codes.AlreadyExists {
@@ -120,10 +168,14 @@ func (q *GCP) ScheduleFetch(ctx context.Context, modulePath, version, suffix str
 	return enqueued, nil
 }
 
-func (q *GCP) newTaskRequest(modulePath, version, suffix string, taskIDChangeInterval time.Duration) *taskspb.CreateTaskRequest {
+func (q *GCP) newTaskRequest(modulePath, version, suffix string, priority Priority, taskIDChangeInterval time.Duration) *taskspb.CreateTaskRequest {
+	queueName := q.queueName
+	if priority == PriorityInteractive {
+		queueName = q.interactiveQueueName
+	}
 	taskID := newTaskID(modulePath, version, time.Now(), taskIDChangeInterval)
 	relativeURI := fmt.Sprintf("/fetch/%s/@v/%s", modulePath, version)
-	task := &taskspb.Task{Name: fmt.Sprintf("%s/tasks/%s", q.queueName, taskID)}
+	task := &taskspb.Task{Name: fmt.Sprintf("%s/tasks/%s", queueName, taskID)}
 	if q.queueService != "" {
 		task.MessageType = &taskspb.Task_AppEngineHttpRequest{
 			AppEngineHttpRequest: &taskspb.AppEngineHttpRequest{
@@ -143,7 +195,7 @@ func (q *GCP) newTaskRequest(modulePath, version, suffix string, taskIDChangeInt
 		}
 	}
 	req := &taskspb.CreateTaskRequest{
-		Parent: q.queueName,
+		Parent: queueName,
 		Task:   task,
 	}
 	// If suffix is non-empty, append it to the task name. This lets us force reprocessing
@@ -173,7 +225,7 @@ type moduleVersion struct {
 
 // InMemory is a Queue implementation that schedules in-process fetch
 // operations. Unlike the GCP task queue, it will not automatically retry tasks
-// on failure.
+// on failure, and it processes tasks in order, regardless of their priority.
 //
 // This should only be used for local development.
 type InMemory struct {
@@ -223,7 +275,7 @@ func NewInMemory(ctx context.Context, workerCount int, experiments []string, pro
 
 // ScheduleFetch pushes a fetch task into the local queue to be processed
 // asynchronously.
-func (q *InMemory) ScheduleFetch(ctx context.Context, modulePath, version, suffix string, taskIDChangeInterval time.Duration) (bool, error) {
+func (q *InMemory) ScheduleFetch(ctx context.Context, modulePath, version, suffix string, priority Priority, taskIDChangeInterval time.Duration) (bool, error) {
 	q.queue <- moduleVersion{modulePath, version}
 	return true, nil
 }
@@ -5,6 +5,7 @@
 package queue
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -36,9 +37,10 @@ func TestNewTaskID(t *testing.T) {
 
 func TestNewTaskRequest(t *testing.T) {
 	for _, test := range []struct {
-		name string
-		cfg  config.Config
-		want *taskspb.CreateTaskRequest
+		name     string
+		cfg      config.Config
+		priority Priority
+		want     *taskspb.CreateTaskRequest
 	}{
 		{
 			"AppEngine",
@@ -47,6 +49,7 @@ func TestNewTaskRequest(t *testing.T) {
 				LocationID:   "us-central1",
 				QueueService: "Service",
 			},
+			PriorityBackfill,
 			&taskspb.CreateTaskRequest{
 				Parent: "projects/Project/locations/us-central1/queues/queueID",
 				Task: &taskspb.Task{
@@ -69,6 +72,7 @@ func TestNewTaskRequest(t *testing.T) {
 				LocationID: "us-central1",
 				QueueURL:   "http://1.2.3.4:8000",
 			},
+			PriorityBackfill,
 			&taskspb.CreateTaskRequest{
 				Parent: "projects/Project/locations/us-central1/queues/queueID",
 				Task: &taskspb.Task{
@@ -81,13 +85,36 @@ func TestNewTaskRequest(t *testing.T) {
 				},
 			},
 		},
+		{
+			"interactive",
+			config.Config{
+				ProjectID:  "Project",
+				LocationID: "us-central1",
+				QueueURL:   "http://1.2.3.4:8000",
+			},
+			PriorityInteractive,
+			&taskspb.CreateTaskRequest{
+				Parent: "projects/Project/locations/us-central1/queues/interactiveID",
+				Task: &taskspb.Task{
+					MessageType: &taskspb.Task_HttpRequest{
+						HttpRequest: &taskspb.HttpRequest{
+							HttpMethod: taskspb.HttpMethod_POST,
+							Url:        "http://1.2.3.4:8000/fetch/mod/@v/v1.2.3",
+						},
+					},
+				},
+			},
+		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
-			gcp, err := newGCP(&test.cfg, nil, "queueID")
+			gcp, err := newGCP(&test.cfg, nil, "queueID", "interactiveID")
 			if err != nil {
 				t.Fatal(err)
 			}
-			got := gcp.newTaskRequest("mod", "v1.2.3", "suf", time.Minute)
+			got := gcp.newTaskRequest("mod", "v1.2.3", "suf", test.priority, time.Minute)
+			if !strings.HasPrefix(got.Task.Name, test.want.Parent+"/tasks/") {
+				t.Errorf("task name %q is not in queue %q", got.Task.Name, test.want.Parent)
+			}
 			test.want.Task.Name = got.Task.Name
 			if diff := cmp.Diff(test.want, got, cmp.Comparer(proto.Equal)); diff != "" {
 				t.Errorf("mismatch (-want, +got):\n%s", diff)
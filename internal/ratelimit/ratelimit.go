@@ -0,0 +1,171 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ratelimit implements token buckets that are held either in memory,
+// for a single server instance, or in redis, so that all instances share them.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/golang/groupcache/lru"
+)
+
+// A Store holds token buckets, identified by their keys. A bucket holds at
+// most burst tokens and is refilled at perSecond tokens per second. A bucket
+// that has not been used yet is full.
+type Store interface {
+	// Take takes a token from the bucket named key. If the bucket is empty,
+	// it reports false and how long it will be until a token is available.
+	Take(ctx context.Context, key string, perSecond float64, burst int) (bool, time.Duration, error)
+	// Refund returns a token taken from the bucket named key.
+	Refund(ctx context.Context, key string, burst int) error
+}
+
+// neverAllowed returns the result of Store.Take for a bucket that never
+// holds a token, because burst or perSecond is not positive.
+func neverAllowed(perSecond float64) (bool, time.Duration, error) {
+	if perSecond <= 0 {
+		return false, time.Minute, nil
+	}
+	return false, time.Duration(math.Ceil(float64(time.Second) / perSecond)), nil
+}
+
+// MemoryStore is a Store for a single server instance. It keeps the buckets
+// that were used most recently.
+type MemoryStore struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets *lru.Cache // key to *bucket
+}
+
+// A bucket is a token bucket of a MemoryStore. It works like those of
+// takeScript.
+type bucket struct {
+	tokens float64
+	ts     time.Time // when tokens were counted
+}
+
+// NewMemoryStore returns a MemoryStore that keeps at most maxEntries buckets,
+// and reads the time with now. If now is nil, time.Now is used.
+func NewMemoryStore(maxEntries int, now func() time.Time) *MemoryStore {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryStore{now: now, buckets: lru.New(maxEntries)}
+}
+
+// Take implements Store.Take.
+func (s *MemoryStore) Take(_ context.Context, key string, perSecond float64, burst int) (bool, time.Duration, error) {
+	if burst <= 0 || perSecond <= 0 {
+		return neverAllowed(perSecond)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var b *bucket
+	if v, ok := s.buckets.Get(key); ok {
+		b = v.(*bucket)
+	} else {
+		b = &bucket{tokens: float64(burst), ts: now}
+		s.buckets.Add(key, b)
+	}
+	perNanosecond := perSecond / float64(time.Second)
+	if now.After(b.ts) {
+		b.tokens = math.Min(float64(burst), b.tokens+float64(now.Sub(b.ts))*perNanosecond)
+		b.ts = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	return false, time.Duration(math.Ceil((1 - b.tokens) / perNanosecond)), nil
+}
+
+// Refund implements Store.Refund.
+func (s *MemoryStore) Refund(_ context.Context, key string, burst int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.buckets.Get(key); ok {
+		b := v.(*bucket)
+		b.tokens = math.Min(float64(burst), b.tokens+1)
+	}
+	return nil
+}
+
+// RedisStore is a Store shared by all server instances.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore returns a RedisStore that keeps its buckets in client, under
+// keys that begin with prefix.
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// takeScript implements Store.Take in redis. The bucket is a hash holding the
+// number of tokens and the time they were counted, in milliseconds. It
+// expires once it would be full again.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1]) / 1000
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1]) or burst
+local ts = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local ok = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	ok = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate) + 1000)
+return {ok, wait}
+`)
+
+// Take implements Store.Take.
+func (s *RedisStore) Take(ctx context.Context, key string, perSecond float64, burst int) (bool, time.Duration, error) {
+	if burst <= 0 || perSecond <= 0 {
+		return neverAllowed(perSecond)
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	v, err := takeScript.Run(s.client.WithContext(ctx), []string{s.prefix + key}, perSecond, burst, now).Result()
+	if err != nil {
+		return false, 0, err
+	}
+	res, ok := v.([]interface{})
+	if !ok || len(res) != 2 {
+		return false, 0, fmt.Errorf("unexpected result %v from token bucket script", v)
+	}
+	allowed, _ := res[0].(int64)
+	wait, _ := res[1].(int64)
+	return allowed == 1, time.Duration(wait) * time.Millisecond, nil
+}
+
+// refundScript implements Store.Refund in redis, for buckets of takeScript.
+var refundScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local tokens = tonumber(redis.call('HGET', KEYS[1], 'tokens'))
+if tokens then
+	redis.call('HSET', KEYS[1], 'tokens', tostring(math.min(burst, tokens + 1)))
+end
+return 0
+`)
+
+// Refund implements Store.Refund.
+func (s *RedisStore) Refund(ctx context.Context, key string, burst int) error {
+	return refundScript.Run(s.client.WithContext(ctx), []string{s.prefix + key}, burst).Err()
+}
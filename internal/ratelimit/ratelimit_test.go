@@ -0,0 +1,96 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore(10, func() time.Time { return now })
+	testStore(t, s, func(d time.Duration) { now = now.Add(d) })
+}
+
+func TestRedisStore(t *testing.T) {
+	m, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// The redis store reads the time from the clock, so only check what
+	// happens within the first second.
+	testStore(t, NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}), "test:"), nil)
+}
+
+// testStore checks s. If advance is non-nil, it moves the clock of s forward.
+func testStore(t *testing.T, s Store, advance func(time.Duration)) {
+	t.Helper()
+	ctx := context.Background()
+
+	// Buckets hold two tokens, and get one back every ten seconds.
+	const perSecond, burst = 0.1, 2
+	take := func(key string, want bool) time.Duration {
+		t.Helper()
+		got, retryAfter, err := s.Take(ctx, key, perSecond, burst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("Take(%q) = %t; want %t", key, got, want)
+		}
+		return retryAfter
+	}
+
+	take("a", true)
+	take("a", true)
+	if got := take("a", false); got < 9*time.Second || got > 10*time.Second {
+		t.Errorf("retry after %s; want about 10s", got)
+	}
+	// Other buckets are not affected.
+	take("b", true)
+
+	if err := s.Refund(ctx, "a", burst); err != nil {
+		t.Fatal(err)
+	}
+	take("a", true)
+	take("a", false)
+	// A refund never makes a bucket hold more than burst tokens.
+	for i := 0; i < 3; i++ {
+		if err := s.Refund(ctx, "b", burst); err != nil {
+			t.Fatal(err)
+		}
+	}
+	take("b", true)
+	take("b", true)
+	take("b", false)
+
+	if advance != nil {
+		advance(10 * time.Second)
+		take("a", true)
+		take("a", false)
+	}
+
+	// Buckets that never hold a token.
+	for _, test := range []struct {
+		perSecond float64
+		burst     int
+		want      time.Duration
+	}{
+		{1, 0, time.Second},
+		{0, 1, time.Minute},
+	} {
+		ok, retryAfter, err := s.Take(ctx, "c", test.perSecond, test.burst)
+		if err != nil || ok || retryAfter != test.want {
+			t.Errorf("Take(%g, %d) = %t, %s, %v; want false, %s, nil", test.perSecond, test.burst, ok, retryAfter, err, test.want)
+		}
+	}
+}
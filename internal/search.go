@@ -0,0 +1,185 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"strings"
+)
+
+// Search qualifiers, which restrict search results to packages with the
+// given value of a property when written "qualifier:value" in a query.
+const (
+	// LicenseQualifier restricts results to packages with a license of the
+	// given type, like "MIT", ignoring case.
+	LicenseQualifier = "license"
+	// ModuleQualifier restricts results to packages in the module with the
+	// given path. A "*" in the value matches any sequence of characters, so
+	// "module:google.golang.org/*" matches every module under
+	// google.golang.org.
+	ModuleQualifier = "module"
+	// GOOSQualifier restricts results to packages that have documentation
+	// for the given GOOS.
+	GOOSQualifier = "goos"
+	// NameQualifier restricts results to packages with the given name.
+	NameQualifier = "name"
+)
+
+var searchQualifiers = map[string]bool{
+	LicenseQualifier: true,
+	ModuleQualifier:  true,
+	GOOSQualifier:    true,
+	NameQualifier:    true,
+}
+
+// A SearchFilter is a qualifier of a search query and its value.
+type SearchFilter struct {
+	Qualifier string
+	Value     string
+}
+
+// String returns f as it is written in a query, quoting the value if it
+// contains spaces.
+func (f SearchFilter) String() string {
+	v := f.Value
+	if strings.ContainsAny(v, " \t\n") {
+		v = `"` + v + `"`
+	}
+	return f.Qualifier + ":" + v
+}
+
+// A SearchQuery is a search query split into the text to search for and the
+// filters that every result must satisfy.
+type SearchQuery struct {
+	Text    string
+	Filters []SearchFilter
+}
+
+// ParseSearchQuery splits q into its filters and its remaining text.
+//
+// A filter is a word of the form "qualifier:value", where qualifier is one
+// of the search qualifiers, in any case. The value may be quoted, as in
+// `license:"BSD-3-Clause"`, and may not be empty. Words with other
+// qualifiers, or none, are part of the text, which keeps the quoting of q so
+// that phrases are still searched for as phrases. Repeated filters are
+// dropped.
+func ParseSearchQuery(q string) *SearchQuery {
+	sq := &SearchQuery{}
+	var text []string
+	for _, word := range splitSearchQuery(q) {
+		f, ok := parseSearchFilter(word)
+		if !ok {
+			text = append(text, word)
+			continue
+		}
+		if !sq.hasFilter(f) {
+			sq.Filters = append(sq.Filters, f)
+		}
+	}
+	sq.Text = strings.Join(text, " ")
+	return sq
+}
+
+// String returns the text of sq followed by its filters. ParseSearchQuery
+// returns a query equal to sq when given the result.
+func (sq *SearchQuery) String() string {
+	words := []string{}
+	if sq.Text != "" {
+		words = append(words, sq.Text)
+	}
+	for _, f := range sq.Filters {
+		words = append(words, f.String())
+	}
+	return strings.Join(words, " ")
+}
+
+// Without returns the query string of sq with the filter f removed.
+func (sq *SearchQuery) Without(f SearchFilter) string {
+	q := &SearchQuery{Text: sq.Text}
+	for _, g := range sq.Filters {
+		if g != f {
+			q.Filters = append(q.Filters, g)
+		}
+	}
+	return q.String()
+}
+
+func (sq *SearchQuery) hasFilter(f SearchFilter) bool {
+	for _, g := range sq.Filters {
+		if g == f {
+			return true
+		}
+	}
+	return false
+}
+
+// splitSearchQuery splits q into words at spaces outside of double quotes.
+// An unterminated quote extends to the end of q.
+func splitSearchQuery(q string) []string {
+	var (
+		words  []string
+		word   strings.Builder
+		quoted bool
+	)
+	for _, r := range q {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if word.Len() > 0 {
+				words = append(words, word.String())
+				word.Reset()
+			}
+			continue
+		}
+		word.WriteRune(r)
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// parseSearchFilter parses word as a search filter. It reports false if
+// word does not begin with a known qualifier or has an empty value.
+func parseSearchFilter(word string) (SearchFilter, bool) {
+	i := strings.IndexByte(word, ':')
+	if i < 0 {
+		return SearchFilter{}, false
+	}
+	qualifier := strings.ToLower(word[:i])
+	if !searchQualifiers[qualifier] {
+		return SearchFilter{}, false
+	}
+	value := strings.TrimSpace(strings.ReplaceAll(word[i+1:], `"`, ""))
+	if value == "" {
+		return SearchFilter{}, false
+	}
+	if qualifier == GOOSQualifier {
+		value = strings.ToLower(value)
+	}
+	return SearchFilter{Qualifier: qualifier, Value: value}, true
+}
+
+// MatchModulePattern reports whether modulePath matches pattern, the value
+// of a module filter, in which "*" matches any sequence of characters.
+func MatchModulePattern(pattern, modulePath string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == modulePath
+	}
+	if !strings.HasPrefix(modulePath, parts[0]) {
+		return false
+	}
+	modulePath = modulePath[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, p := range parts[1 : len(parts)-1] {
+		i := strings.Index(modulePath, p)
+		if i < 0 {
+			return false
+		}
+		modulePath = modulePath[i+len(p):]
+	}
+	return len(modulePath) >= len(last) && strings.HasSuffix(modulePath, last)
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	for _, test := range []struct {
+		q    string
+		want *SearchQuery
+	}{
+		{"yaml", &SearchQuery{Text: "yaml"}},
+		{"yaml license:MIT", &SearchQuery{
+			Text:    "yaml",
+			Filters: []SearchFilter{{LicenseQualifier, "MIT"}},
+		}},
+		{`license:"BSD-3-Clause" yaml`, &SearchQuery{
+			Text:    "yaml",
+			Filters: []SearchFilter{{LicenseQualifier, "BSD-3-Clause"}},
+		}},
+		{`license:"Some License"`, &SearchQuery{
+			Filters: []SearchFilter{{LicenseQualifier, "Some License"}},
+		}},
+		{"grpc module:google.golang.org/*", &SearchQuery{
+			Text:    "grpc",
+			Filters: []SearchFilter{{ModuleQualifier, "google.golang.org/*"}},
+		}},
+		{"tty GOOS:Windows", &SearchQuery{
+			Text:    "tty",
+			Filters: []SearchFilter{{GOOSQualifier, "windows"}},
+		}},
+		{"name:errors", &SearchQuery{
+			Filters: []SearchFilter{{NameQualifier, "errors"}},
+		}},
+		// Filters combine, and may conflict.
+		{"x module:a.com/m goos:linux module:b.com/m", &SearchQuery{
+			Text: "x",
+			Filters: []SearchFilter{
+				{ModuleQualifier, "a.com/m"},
+				{GOOSQualifier, "linux"},
+				{ModuleQualifier, "b.com/m"},
+			},
+		}},
+		// Repeated filters are dropped.
+		{"x license:MIT license:MIT", &SearchQuery{
+			Text:    "x",
+			Filters: []SearchFilter{{LicenseQualifier, "MIT"}},
+		}},
+		// Unknown qualifiers and empty values are text.
+		{"author:me license: go", &SearchQuery{Text: "author:me license: go"}},
+		{`license:"" go`, &SearchQuery{Text: `license:"" go`}},
+		// Quoted phrases are kept.
+		{`"go  cloud"   OR  aws`, &SearchQuery{Text: `"go  cloud" OR aws`}},
+	} {
+		got := ParseSearchQuery(test.q)
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("ParseSearchQuery(%q) mismatch (-want +got):\n%s", test.q, diff)
+		}
+		if again := ParseSearchQuery(got.String()); !cmp.Equal(got, again) {
+			t.Errorf("ParseSearchQuery(%q) = %+v, which does not round-trip: got %+v", test.q, got, again)
+		}
+	}
+}
+
+func TestSearchQueryWithout(t *testing.T) {
+	sq := ParseSearchQuery(`yaml license:"Some License" goos:linux`)
+	if got, want := sq.Without(SearchFilter{GOOSQualifier, "linux"}), `yaml license:"Some License"`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := sq.Without(SearchFilter{LicenseQualifier, "Some License"}), "yaml goos:linux"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMatchModulePattern(t *testing.T) {
+	for _, test := range []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"a.com/m", "a.com/m", true},
+		{"a.com/m", "a.com/m/v2", false},
+		{"a.com/*", "a.com/m/v2", true},
+		{"a.com/*", "b.com/m", false},
+		{"*/m", "a.com/m", true},
+		{"*/m", "a.com/m/v2", false},
+		{"a.com/*/v2", "a.com/m/v2", true},
+		{"a*m*m", "a.com/m", true},
+		{"a*m*m", "a.com", false},
+		{"ab*ba", "aba", false},
+	} {
+		if got := MatchModulePattern(test.pattern, test.path); got != test.want {
+			t.Errorf("MatchModulePattern(%q, %q) = %t, want %t", test.pattern, test.path, got, test.want)
+		}
+	}
+}
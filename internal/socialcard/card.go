@@ -0,0 +1,224 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package socialcard renders the images shown in previews of links to
+// pkg.go.dev pages, such as those of Open Graph and Twitter cards.
+package socialcard
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// Width and Height are the dimensions of a card, and of the template it is
+// drawn on, as recommended for Open Graph images.
+const (
+	Width  = 1200
+	Height = 630
+)
+
+// A Card holds the text drawn on a social card.
+type Card struct {
+	Path     string
+	Synopsis string // may be empty
+	Version  string
+	Licenses []string // license types, like "MIT"
+}
+
+const (
+	margin = 72
+
+	// The path is drawn at the largest of pathSizes at which it fits in
+	// maxPathLines lines.
+	maxPathLines = 3
+	synopsisSize = 32
+	// maxSynopsisLines is the number of lines the synopsis is truncated to.
+	maxSynopsisLines = 4
+	footerSize       = 26
+
+	// textWidthMax is the width of the space between the margins.
+	textWidthMax = Width - 2*margin
+
+	ellipsis = "..."
+)
+
+var (
+	pathSizes = []float64{64, 48, 40}
+
+	pathColor     = color.RGBA{0x20, 0x22, 0x24, 0xff}
+	synopsisColor = color.RGBA{0x55, 0x57, 0x59, 0xff}
+	labelColor    = color.RGBA{0x00, 0x7d, 0x9c, 0xff}
+	footerColor   = color.RGBA{0x3e, 0x40, 0x42, 0xff}
+)
+
+// Render draws c onto a copy of tmpl, which must be Width by Height pixels,
+// and returns the result encoded as a PNG.
+func Render(tmpl image.Image, c *Card) (_ []byte, err error) {
+	defer derrors.Wrap(&err, "socialcard.Render(%q)", c.Path)
+
+	if b := tmpl.Bounds(); b.Dx() != Width || b.Dy() != Height {
+		return nil, fmt.Errorf("template is %dx%d, want %dx%d", b.Dx(), b.Dy(), Width, Height)
+	}
+	var pathFaces []font.Face
+	for _, size := range pathSizes {
+		face, err := newFace(boldFont, size)
+		if err != nil {
+			return nil, err
+		}
+		defer face.Close()
+		pathFaces = append(pathFaces, face)
+	}
+	synopsisFace, err := newFace(regularFont, synopsisSize)
+	if err != nil {
+		return nil, err
+	}
+	defer synopsisFace.Close()
+	footerFace, err := newFace(regularFont, footerSize)
+	if err != nil {
+		return nil, err
+	}
+	defer footerFace.Close()
+
+	img := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	draw.Draw(img, img.Bounds(), tmpl, tmpl.Bounds().Min, draw.Src)
+
+	y := margin + 8
+	lines, pathFace := layoutPath(c.Path, pathFaces)
+	for _, l := range lines {
+		drawText(img, pathFace, margin, y, l, pathColor)
+		y += lineHeight(pathFace)
+	}
+	y += lineHeight(synopsisFace) / 4
+	for _, l := range wrapWords(c.Synopsis, fitsIn(synopsisFace, textWidthMax), maxSynopsisLines) {
+		drawText(img, synopsisFace, margin, y, l, synopsisColor)
+		y += lineHeight(synopsisFace)
+	}
+
+	footer := [][2]string{{"Version", c.Version}}
+	if len(c.Licenses) > 0 {
+		footer = append(footer, [2]string{"License", strings.Join(c.Licenses, ", ")})
+	}
+	y = Height - margin - len(footer)*lineHeight(footerFace)
+	for _, f := range footer {
+		label := f[0] + " "
+		drawText(img, footerFace, margin, y, label, labelColor)
+		x := margin + textWidth(footerFace, label)
+		drawText(img, footerFace, x, y, truncate(f[1], fitsIn(footerFace, Width/2-x)), footerColor)
+		y += lineHeight(footerFace)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fitsIn returns a function that reports whether a string drawn in face is at
+// most width pixels wide.
+func fitsIn(face font.Face, width int) func(string) bool {
+	return func(s string) bool { return textWidth(face, s) <= width }
+}
+
+// layoutPath splits path into lines, and returns them with the face in which
+// to draw them: the first of faces in which path fits in maxPathLines lines,
+// or else the last one, in which the path is truncated.
+func layoutPath(path string, faces []font.Face) ([]string, font.Face) {
+	var lines []string
+	for _, face := range faces {
+		lines = wrapPath(path, fitsIn(face, textWidthMax))
+		if len(lines) <= maxPathLines {
+			return lines, face
+		}
+	}
+	face := faces[len(faces)-1]
+	lines = lines[:maxPathLines]
+	lines[maxPathLines-1] = truncate(lines[maxPathLines-1]+ellipsis, fitsIn(face, textWidthMax))
+	return lines, face
+}
+
+// wrapPath splits path into lines that fit, breaking them after slashes where
+// possible.
+func wrapPath(path string, fits func(string) bool) []string {
+	var lines []string
+	line := ""
+	for _, elem := range strings.SplitAfter(path, "/") {
+		if line != "" && !fits(line+elem) {
+			lines = append(lines, line)
+			line = ""
+		}
+		line += elem
+		for !fits(line) {
+			p := fittingPrefix(line, fits)
+			lines = append(lines, p)
+			line = line[len(p):]
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// wrapWords splits s into at most maxLines lines that fit, breaking them
+// between words. If s does not fit, the last line ends with an ellipsis.
+func wrapWords(s string, fits func(string) bool, maxLines int) []string {
+	var lines []string
+	line := ""
+	for _, w := range strings.Fields(s) {
+		switch {
+		case line == "":
+			line = w
+		case fits(line + " " + w):
+			line += " " + w
+		default:
+			lines = append(lines, line)
+			line = w
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		lines[maxLines-1] = truncate(lines[maxLines-1]+" "+ellipsis, fits)
+	}
+	for i, l := range lines {
+		lines[i] = truncate(l, fits)
+	}
+	return lines
+}
+
+// fittingPrefix returns the longest prefix of s that fits, but at least its
+// first character, so that wrapping always makes progress.
+func fittingPrefix(s string, fits func(string) bool) string {
+	rs := []rune(s)
+	n := len(rs)
+	for n > 1 && !fits(string(rs[:n])) {
+		n--
+	}
+	return string(rs[:n])
+}
+
+// truncate returns s, shortened to end with an ellipsis if it does not fit.
+func truncate(s string, fits func(string) bool) string {
+	if fits(s) {
+		return s
+	}
+	rs := []rune(s)
+	for n := len(rs) - 1; n >= 0; n-- {
+		if t := string(rs[:n]) + ellipsis; fits(t) {
+			return t
+		}
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package socialcard
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/image/font"
+)
+
+// maxLen returns a function that reports whether a string has at most n
+// characters, to test layout independently of the fonts.
+func maxLen(n int) func(string) bool {
+	return func(s string) bool { return utf8.RuneCountInString(s) <= n }
+}
+
+func TestRender(t *testing.T) {
+	tmpl := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	data, err := Render(tmpl, &Card{
+		Path:     "github.com/a/b",
+		Synopsis: "Package b does things.",
+		Version:  "v1.2.3",
+		Licenses: []string{"MIT"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := img.Bounds(), tmpl.Bounds(); got != want {
+		t.Errorf("bounds = %v, want %v", got, want)
+	}
+
+	if _, err := Render(image.NewRGBA(image.Rect(0, 0, 100, 100)), &Card{Path: "p"}); err == nil {
+		t.Error("got nil error for a template of the wrong size, want non-nil")
+	}
+}
+
+func TestWrapPath(t *testing.T) {
+	for _, test := range []struct {
+		path string
+		want []string
+	}{
+		{"a.com/b", []string{"a.com/b"}},
+		{"a.com/bbb/cc", []string{"a.com/", "bbb/cc"}},
+		{"a.com/bbbbbbbbbbbbb", []string{"a.com/", "bbbbbbbb", "bbbbb"}},
+	} {
+		if got := wrapPath(test.path, maxLen(8)); !cmp.Equal(got, test.want) {
+			t.Errorf("wrapPath(%q, 8) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestLayoutPath(t *testing.T) {
+	var faces []font.Face
+	for _, size := range pathSizes {
+		face, err := newFace(boldFont, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer face.Close()
+		faces = append(faces, face)
+	}
+	lines, face := layoutPath("github.com/a/b", faces)
+	if face != faces[0] || len(lines) != 1 {
+		t.Errorf("short path: got %q in face %d, want one line in the largest", lines, faceIndex(faces, face))
+	}
+	lines, face = layoutPath(strings.Repeat("x", 1000), faces)
+	if face != faces[len(faces)-1] || len(lines) != maxPathLines {
+		t.Errorf("long path: got %d lines in face %d, want %d in the smallest", len(lines), faceIndex(faces, face), maxPathLines)
+	}
+	for _, l := range lines {
+		if w := textWidth(face, l); w > textWidthMax {
+			t.Errorf("long path: line %q is %d pixels wide, want at most %d", l, w, textWidthMax)
+		}
+	}
+	if last := lines[len(lines)-1]; !strings.HasSuffix(last, ellipsis) {
+		t.Errorf("long path: last line %q, want it to end with an ellipsis", last)
+	}
+}
+
+func faceIndex(faces []font.Face, face font.Face) int {
+	for i, f := range faces {
+		if f == face {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestWrapWords(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		want []string
+	}{
+		{"", nil},
+		{"one two three", []string{"one two", "three"}},
+		{"  one\ntwo  ", []string{"one two"}},
+		{"one two three four five six", []string{"one two", "three..."}},
+		{"abcdefghijk", []string{"abcde..."}},
+	} {
+		if got := wrapWords(test.s, maxLen(8), 2); !cmp.Equal(got, test.want) {
+			t.Errorf("wrapWords(%q, 8, 2) = %q, want %q", test.s, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package socialcard
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// The fonts of the card. Fonts are safe for concurrent use, but faces are
+// not, so a new face is made for each card.
+var (
+	boldFont    = mustParseFont(gobold.TTF)
+	regularFont = mustParseFont(goregular.TTF)
+)
+
+func mustParseFont(ttf []byte) *opentype.Font {
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		panic(fmt.Sprintf("socialcard: parsing font: %v", err))
+	}
+	return f
+}
+
+// newFace returns a face of f at size points. At 72 DPI, a point is a pixel.
+func newFace(f *opentype.Font, size float64) (font.Face, error) {
+	return opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+}
+
+// textWidth returns the width in pixels of s drawn in face.
+func textWidth(face font.Face, s string) int {
+	return font.MeasureString(face, s).Ceil()
+}
+
+// lineHeight returns the distance between the tops of consecutive lines
+// drawn in face.
+func lineHeight(face font.Face) int {
+	return face.Metrics().Height.Ceil()
+}
+
+// drawText draws s onto dst in face, with the top-left corner of its line at
+// (x, y).
+func drawText(dst draw.Image, face font.Face, x, y int, s string, c color.Color) {
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y+face.Metrics().Ascent.Ceil()),
+	}
+	d.DrawString(s)
+}
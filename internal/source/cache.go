@@ -0,0 +1,240 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/log"
+)
+
+var (
+	keyMetaCacheHit  = tag.MustNewKey("source.meta_cache.hit")
+	metaCacheResults = stats.Int64(
+		"go-discovery/source/meta_cache_result_count",
+		"The result of a source meta tag cache lookup.",
+		stats.UnitDimensionless,
+	)
+
+	// MetaCacheResultCount is a view of meta tag cache lookups, by whether
+	// they were a hit.
+	MetaCacheResultCount = &view.View{
+		Name:        "go-discovery/source/meta_cache_result_count",
+		Measure:     metaCacheResults,
+		Aggregation: view.Count(),
+		Description: "source meta tag cache results, by whether it was a hit",
+		TagKeys:     []tag.Key{keyMetaCacheHit},
+	}
+)
+
+func recordMetaCacheResult(ctx context.Context, hit bool) {
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(keyMetaCacheHit, strconv.FormatBool(hit)),
+	}, metaCacheResults.M(1))
+}
+
+// A MetaCache stores the results of fetching go-import and go-source meta
+// tags, keyed by module path. Implementations must be safe for concurrent use.
+type MetaCache interface {
+	// Get returns the value stored for key. It reports false if there is no
+	// value, or if the value has expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Put stores value for key, to expire after ttl.
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// cacheEntry is the JSON form of a cached meta tag lookup. If Err is
+// non-empty, the lookup failed and the other fields are empty: it found no
+// meta tags or, if Timeout is set, the host did not answer in time.
+type cacheEntry struct {
+	RepoRootPrefix string `json:",omitempty"`
+	RepoURL        string `json:",omitempty"`
+	DirTemplate    string `json:",omitempty"`
+	FileTemplate   string `json:",omitempty"`
+	Err            string `json:",omitempty"`
+	Timeout        bool   `json:",omitempty"`
+}
+
+// cachingConfig holds the cache used by a Client, and how long it keeps
+// entries.
+type cachingConfig struct {
+	cache       MetaCache
+	ttl         time.Duration // for successful lookups
+	negativeTTL time.Duration // for lookups that found no meta tags or timed out
+}
+
+// NewClientWithCache constructs a *Client using the provided timeout, which
+// caches meta tag lookups in mc. Successful lookups are cached for ttl, and
+// those that found no meta tags (for example, because of a 404) or timed out
+// for negativeTTL. Other failures, such as server errors, are not cached. If mc
+// is nil, an in-process cache is used.
+func NewClientWithCache(timeout time.Duration, mc MetaCache, ttl, negativeTTL time.Duration) *Client {
+	if mc == nil {
+		mc = NewMemoryCache()
+	}
+	c := NewClient(timeout)
+	c.caching = &cachingConfig{cache: mc, ttl: ttl, negativeTTL: negativeTTL}
+	return c
+}
+
+// fetchMetaCached is like fetchMeta, but consults c's cache first, if it has
+// one. Errors from the cache itself are logged and otherwise ignored.
+func fetchMetaCached(ctx context.Context, c *Client, modulePath string) (*sourceMeta, error) {
+	if c == nil || c.caching == nil {
+		return fetchMeta(ctx, c, modulePath)
+	}
+	cc := c.caching
+	data, ok, err := cc.cache.Get(ctx, modulePath)
+	if err != nil {
+		log.Errorf(ctx, "source meta cache: Get(%q): %v", modulePath, err)
+	}
+	if ok {
+		var e cacheEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			log.Errorf(ctx, "source meta cache: unmarshaling entry for %q: %v", modulePath, err)
+		} else {
+			recordMetaCacheResult(ctx, true)
+			if e.Timeout {
+				return nil, fmt.Errorf("%s (cached)", e.Err)
+			}
+			if e.Err != "" {
+				return nil, fmt.Errorf("%s (cached): %w", e.Err, derrors.NotFound)
+			}
+			return &sourceMeta{
+				repoRootPrefix: e.RepoRootPrefix,
+				repoURL:        e.RepoURL,
+				dirTemplate:    e.DirTemplate,
+				fileTemplate:   e.FileTemplate,
+			}, nil
+		}
+	}
+	recordMetaCacheResult(ctx, false)
+
+	sm, fetchErr := fetchMeta(ctx, c, modulePath)
+	// Only cache failures that are likely to recur: missing meta tags, and
+	// hosts too slow to answer. Don't cache the result of a lookup that was
+	// cut short by our own caller; the host may be fine.
+	timeout := isTimeout(fetchErr)
+	if (fetchErr != nil && !errors.Is(fetchErr, derrors.NotFound) && !timeout) || ctx.Err() != nil {
+		return sm, fetchErr
+	}
+	var (
+		e   cacheEntry
+		ttl = cc.ttl
+	)
+	if fetchErr != nil {
+		e.Err = fetchErr.Error()
+		e.Timeout = timeout
+		ttl = cc.negativeTTL
+	} else {
+		e = cacheEntry{
+			RepoRootPrefix: sm.repoRootPrefix,
+			RepoURL:        sm.repoURL,
+			DirTemplate:    sm.dirTemplate,
+			FileTemplate:   sm.fileTemplate,
+		}
+	}
+	if ttl > 0 {
+		data, err := json.Marshal(e)
+		if err == nil {
+			err = cc.cache.Put(ctx, modulePath, data, ttl)
+		}
+		if err != nil {
+			log.Errorf(ctx, "source meta cache: Put(%q): %v", modulePath, err)
+		}
+	}
+	return sm, fetchErr
+}
+
+// isTimeout reports whether err is the result of a request that timed out.
+func isTimeout(err error) bool {
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
+
+// memoryCache is a MetaCache that lives in process memory.
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+	now     func() time.Time // for testing
+}
+
+type memoryCacheEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache returns a MetaCache that stores entries in process memory.
+func NewMemoryCache() MetaCache {
+	return &memoryCache{
+		entries: map[string]memoryCacheEntry{},
+		now:     time.Now,
+	}
+}
+
+func (c *memoryCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !c.now().Before(e.expires) {
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+func (c *memoryCache) Put(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = memoryCacheEntry{value: value, expires: c.now().Add(ttl)}
+	return nil
+}
+
+// redisCache is a MetaCache backed by redis, so that it can be shared among
+// processes.
+type redisCache struct {
+	client *redis.Client
+}
+
+// redisKeyPrefix distinguishes meta tag cache keys from other keys in the
+// same redis instance.
+const redisKeyPrefix = "source-meta:"
+
+// NewRedisCache returns a MetaCache that stores entries in redis.
+func NewRedisCache(client *redis.Client) MetaCache {
+	return &redisCache{client: client}
+}
+
+func (c *redisCache) Get(ctx context.Context, key string) (_ []byte, _ bool, err error) {
+	defer derrors.Wrap(&err, "redisCache.Get(%q)", key)
+	value, err := c.client.WithContext(ctx).Get(redisKeyPrefix + key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (c *redisCache) Put(ctx context.Context, key string, value []byte, ttl time.Duration) (err error) {
+	defer derrors.Wrap(&err, "redisCache.Put(%q)", key)
+	return c.client.WithContext(ctx).Set(redisKeyPrefix+key, value, ttl).Err()
+}
@@ -0,0 +1,174 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// countingTransport serves meta tags for the hosts in pages, the status in
+// statuses for the hosts there, and a 404 for everything else. Requests to the
+// hosts in slow are not answered until they are canceled. It counts the
+// requests it receives, by host.
+type countingTransport struct {
+	mu       sync.Mutex
+	pages    map[string]string
+	statuses map[string]int
+	slow     map[string]bool
+	counts   map[string]int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.counts[req.URL.Host]++
+	if t.slow[req.URL.Host] {
+		t.mu.Unlock()
+		<-req.Context().Done()
+		t.mu.Lock()
+		return nil, req.Context().Err()
+	}
+	status := http.StatusOK
+	body, ok := t.pages[req.URL.Host]
+	if !ok {
+		status = http.StatusNotFound
+	}
+	if s, ok := t.statuses[req.URL.Host]; ok {
+		status = s
+	}
+	return &http.Response{
+		Status:     http.StatusText(status),
+		StatusCode: status,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestFetchMetaCached(t *testing.T) {
+	ctx := context.Background()
+	transport := &countingTransport{
+		pages: map[string]string{
+			"good.example.com": `<html><head><meta name="go-import" content="good.example.com/mod git https://github.com/a/b"></head></html>`,
+		},
+		statuses: map[string]int{"flaky.example.com": http.StatusServiceUnavailable},
+		counts:   map[string]int{},
+	}
+	client := NewClientWithCache(testTimeout, nil, time.Hour, time.Hour)
+	client.httpClient = &http.Client{Transport: transport}
+
+	for i := 0; i < 3; i++ {
+		got, err := fetchMetaCached(ctx, client, "good.example.com/mod")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := &sourceMeta{repoRootPrefix: "good.example.com/mod", repoURL: "https://github.com/a/b"}
+		if diff := cmp.Diff(want, got, cmp.AllowUnexported(sourceMeta{})); diff != "" {
+			t.Errorf("mismatch (-want, +got):\n%s", diff)
+		}
+		_, err = fetchMetaCached(ctx, client, "bad.example.com/mod")
+		if !errors.Is(err, derrors.NotFound) {
+			t.Errorf("got error %v, want NotFound", err)
+		}
+		_, err = fetchMetaCached(ctx, client, "flaky.example.com/mod")
+		if err == nil || errors.Is(err, derrors.NotFound) {
+			t.Errorf("got error %v, want a non-NotFound error", err)
+		}
+	}
+	// The good host is fetched once. The bad host is tried once with https
+	// and once with http. The failures of the flaky host may be transient,
+	// so it is tried that way every time.
+	if got, want := transport.counts, map[string]int{"good.example.com": 1, "bad.example.com": 2, "flaky.example.com": 6}; !cmp.Equal(got, want) {
+		t.Errorf("got request counts %v, want %v", got, want)
+	}
+}
+
+func TestFetchMetaCachedTimeout(t *testing.T) {
+	ctx := context.Background()
+	const modulePath = "slow.example.com/mod"
+	transport := &countingTransport{
+		slow:   map[string]bool{"slow.example.com": true},
+		counts: map[string]int{},
+	}
+	client := NewClientWithCache(testTimeout, nil, time.Hour, time.Hour)
+	client.httpClient = &http.Client{Transport: transport}
+
+	// A lookup cut short by the caller is not cached.
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := fetchMetaCached(cctx, client, modulePath); err == nil {
+		t.Fatal("got no error for a lookup canceled by the caller")
+	}
+	if _, ok, _ := client.caching.cache.Get(ctx, modulePath); ok {
+		t.Fatal("lookup canceled by the caller was cached")
+	}
+
+	// A lookup that the client's own timeout cuts short is.
+	client.httpClient.Timeout = 10 * time.Millisecond
+	before := transport.counts["slow.example.com"]
+	for i := 0; i < 3; i++ {
+		_, err := fetchMetaCached(ctx, client, modulePath)
+		if err == nil || errors.Is(err, derrors.NotFound) {
+			t.Errorf("got error %v, want a non-NotFound error", err)
+		}
+	}
+	// The host is tried once with https and once with http.
+	if got := transport.counts["slow.example.com"] - before; got != 2 {
+		t.Errorf("got %d requests after the first timeout, want 2", got)
+	}
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewMemoryCache().(*memoryCache)
+	c.now = func() time.Time { return now }
+
+	if err := c.Put(ctx, "k", []byte("v"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok, _ := c.Get(ctx, "k"); !ok || string(got) != "v" {
+		t.Fatalf(`Get = %q, %t; want "v", true`, got, ok)
+	}
+	now = now.Add(time.Minute)
+	if _, ok, _ := c.Get(ctx, "k"); ok {
+		t.Error("got entry after TTL, want none")
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	ctx := context.Background()
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c := NewRedisCache(redis.NewClient(&redis.Options{Addr: s.Addr()}))
+
+	if _, ok, err := c.Get(ctx, "k"); err != nil || ok {
+		t.Fatalf("Get of missing key = %t, %v; want false, nil", ok, err)
+	}
+	if err := c.Put(ctx, "k", []byte("v"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok, err := c.Get(ctx, "k"); err != nil || !ok || string(got) != "v" {
+		t.Fatalf(`Get = %q, %t, %v; want "v", true, nil`, got, ok, err)
+	}
+	s.FastForward(time.Minute)
+	if _, ok, _ := c.Get(ctx, "k"); ok {
+		t.Error("got entry after TTL, want none")
+	}
+}
@@ -55,6 +55,10 @@ func fetchMeta(ctx context.Context, client *Client, importPath string) (_ *sourc
 		}
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		// The server failed, so its page says nothing about meta tags.
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
 	return parseMeta(importPath, resp.Body)
 }
 
@@ -159,3 +163,90 @@ func attrValue(attrs []xml.Attr, name string) string {
 	}
 	return ""
 }
+
+// templatesFromMeta converts the directory and file URL templates of a go-source
+// meta tag into urlTemplates.
+//
+// The go-source templates use the placeholders
+//   {dir}  - the directory of the package, relative to the repo root
+//   {/dir} - the same, preceded by a slash if it is not empty
+//   {file} - the base name of a file
+//   {line} - a line number
+// The file template may have a fragment that mentions {line}, like
+// "#L{line}" or "#{file}-L{line}". That part is dropped from the file URL and
+// kept for the line URL.
+//
+// templatesFromMeta returns an error if the templates are not absolute HTTP
+// URLs, or use placeholders that it cannot fill in, rather than producing URLs
+// with leftover braces in them.
+func templatesFromMeta(dirTemplate, fileTemplate string) (_ urlTemplates, err error) {
+	defer derrors.Wrap(&err, "templatesFromMeta(%q, %q)", dirTemplate, fileTemplate)
+
+	for _, t := range []string{dirTemplate, fileTemplate} {
+		if !strings.HasPrefix(t, "https://") && !strings.HasPrefix(t, "http://") {
+			return urlTemplates{}, fmt.Errorf("template %q is not an HTTP URL", t)
+		}
+	}
+	if err := checkPlaceholders(dirTemplate, "{dir}", "{/dir}"); err != nil {
+		return urlTemplates{}, err
+	}
+	if err := checkPlaceholders(fileTemplate, "{dir}", "{/dir}", "{file}", "{line}"); err != nil {
+		return urlTemplates{}, err
+	}
+	if !strings.Contains(fileTemplate, "{file}") {
+		return urlTemplates{}, fmt.Errorf("file template %q does not mention {file}", fileTemplate)
+	}
+
+	// Our file templates call the base name {base}, and use {file} for the
+	// path from the repo root.
+	lineTemplate := strings.ReplaceAll(fileTemplate, "{file}", "{base}")
+	fileOnly := lineTemplate
+	if i := strings.Index(lineTemplate, "{line}"); i >= 0 {
+		hash := strings.LastIndex(lineTemplate[:i], "#")
+		if hash < 0 {
+			return urlTemplates{}, fmt.Errorf("file template %q has {line} outside of the fragment", fileTemplate)
+		}
+		fileOnly = lineTemplate[:hash]
+		// Keep a fragment that names the file, as in "#{file}-L{line}".
+		if j := strings.Index(lineTemplate[hash:i], "{base}"); j >= 0 {
+			fileOnly = lineTemplate[:hash+j+len("{base}")]
+		}
+	}
+	return urlTemplates{
+		Directory: dirTemplate,
+		File:      fileOnly,
+		Line:      lineTemplate,
+	}, nil
+}
+
+// checkPlaceholders returns an error if template contains a placeholder that
+// is not one of allowed.
+func checkPlaceholders(template string, allowed ...string) error {
+	rest := template
+	for {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(rest[i:], '}')
+		if j < 0 {
+			return fmt.Errorf("template %q has an unterminated placeholder", template)
+		}
+		ph := rest[i : i+j+1]
+		ok := false
+		for _, a := range allowed {
+			if ph == a {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("template %q has unsupported placeholder %s", template, ph)
+		}
+		rest = rest[i+j+1:]
+	}
+	if strings.IndexByte(rest, '}') >= 0 {
+		return fmt.Errorf("template %q has an unmatched '}'", template)
+	}
+	return nil
+}
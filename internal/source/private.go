@@ -0,0 +1,89 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"golang.org/x/pkgsite/internal/log"
+)
+
+// SetPrivatePatterns configures c to treat modules whose paths match patterns
+// as private. Like the GOPRIVATE environment variable of the go command,
+// patterns is a comma-separated list of glob patterns (in the syntax of
+// path.Match), each of which matches a module path or one of its prefixes.
+//
+// ModuleInfo makes no HTTP requests for private modules. It returns an Info
+// only if the module is on a host whose URL scheme it knows; otherwise it
+// returns nil.
+//
+// SetPrivatePatterns must be called before c is used.
+func (c *Client) SetPrivatePatterns(patterns string) {
+	c.privatePatterns = patterns
+}
+
+// isPrivate reports whether modulePath matches one of c's private patterns.
+// The first time it sees a private module, it logs that it will not look up
+// the module's source.
+func (c *Client) isPrivate(ctx context.Context, modulePath string) bool {
+	if c == nil || c.privatePatterns == "" {
+		return false
+	}
+	if !globsMatchPath(c.privatePatterns, modulePath) {
+		return false
+	}
+	if _, loaded := c.loggedPrivate.LoadOrStore(modulePath, true); !loaded {
+		log.Infof(ctx, "source: %s is a private module; not making HTTP requests for its source info", modulePath)
+	}
+	return true
+}
+
+// globsMatchPath reports whether any path prefix of target
+// matches one of the glob patterns (as defined by path.Match)
+// in the comma-separated globs list.
+// It ignores any empty or malformed patterns in the list.
+//
+// Copied from cmd/go/internal/str.
+func globsMatchPath(globs, target string) bool {
+	for globs != "" {
+		// Extract next non-empty glob in comma-separated list.
+		var glob string
+		if i := strings.Index(globs, ","); i >= 0 {
+			glob, globs = globs[:i], globs[i+1:]
+		} else {
+			glob, globs = globs, ""
+		}
+		if glob == "" {
+			continue
+		}
+
+		// A glob with N+1 path elements (N slashes) needs to be matched
+		// against the first N+1 path elements of target,
+		// which end just before the N+1'th slash.
+		n := strings.Count(glob, "/")
+		prefix := target
+		// Walk target, counting slashes, truncating at the N+1'th slash.
+		for i := 0; i < len(target); i++ {
+			if target[i] == '/' {
+				if n == 0 {
+					prefix = target[:i]
+					break
+				}
+				n--
+			}
+		}
+		if n > 0 {
+			// Not enough prefix elements.
+			continue
+		}
+		matched, _ := path.Match(glob, prefix)
+		if matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package source
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestModuleInfoPrivate(t *testing.T) {
+	ctx := context.Background()
+	transport := &countingTransport{pages: map[string]string{}, counts: map[string]int{}}
+	client := NewClient(testTimeout)
+	client.httpClient = &http.Client{Transport: transport}
+	client.SetPrivatePatterns("*.corp.example.com,github.com/private")
+
+	for _, version := range []string{"v1.0.0", "v2.1.0"} {
+		info, err := ModuleInfo(ctx, client, "git.corp.example.com/team/mod", version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info != nil {
+			t.Errorf("got %+v for unknown private host, want nil", info)
+		}
+
+		// A private module on a known host gets links without any lookups,
+		// even though its major version would normally be probed.
+		info, err = ModuleInfo(ctx, client, "github.com/private/repo/v2", version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := info.FileURL("f.go"), "https://github.com/private/repo/blob/"+version+"/f.go"; got != want {
+			t.Errorf("FileURL: got %q, want %q", got, want)
+		}
+	}
+	if len(transport.counts) != 0 {
+		t.Errorf("got requests %v for private modules, want none", transport.counts)
+	}
+
+	// Other modules are looked up as usual.
+	if _, err := ModuleInfo(ctx, client, "public.example.com/mod", "v1.0.0"); err == nil {
+		t.Fatal("got nil error for module with no meta tags")
+	}
+	if transport.counts["public.example.com"] == 0 {
+		t.Error("got no requests for public module, want some")
+	}
+}
+
+func TestGlobsMatchPath(t *testing.T) {
+	for _, test := range []struct {
+		globs, target string
+		want          bool
+	}{
+		{"", "example.com/a", false},
+		{"example.com", "example.com/a/b", true},
+		{"example.com/a", "example.com/a/b", true},
+		{"example.com/a", "example.com/ab", false},
+		{"example.com/a/b/c", "example.com/a/b", false},
+		{"*.example.com", "git.example.com/a", true},
+		{"*.example.com", "example.com/a", false},
+		{"other.com,,*.example.com", "git.example.com/a", true},
+		{"[", "example.com/a", false},
+	} {
+		if got := globsMatchPath(test.globs, test.target); got != test.want {
+			t.Errorf("globsMatchPath(%q, %q) = %t, want %t", test.globs, test.target, got, test.want)
+		}
+	}
+}
@@ -25,10 +25,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"path"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"go.opencensus.io/plugin/ochttp"
@@ -78,6 +80,7 @@ func (i *Info) DirectoryURL(dir string) string {
 		"importPath": path.Join(strings.TrimPrefix(i.repoURL, "https://"), dir),
 		"commit":     i.commit,
 		"dir":        path.Join(i.moduleDir, dir),
+		"/dir":       slashDir(path.Join(i.moduleDir, dir)),
 	}), "/")
 }
 
@@ -93,6 +96,8 @@ func (i *Info) FileURL(pathname string) string {
 		"commit":     i.commit,
 		"file":       path.Join(i.moduleDir, pathname),
 		"base":       base,
+		"dir":        path.Join(i.moduleDir, dir),
+		"/dir":       slashDir(path.Join(i.moduleDir, dir)),
 	})
 }
 
@@ -108,12 +113,24 @@ func (i *Info) LineURL(pathname string, line int) string {
 		"commit":     i.commit,
 		"file":       path.Join(i.moduleDir, pathname),
 		"base":       base,
+		"dir":        path.Join(i.moduleDir, dir),
+		"/dir":       slashDir(path.Join(i.moduleDir, dir)),
 		"line":       strconv.Itoa(line),
 	})
 }
 
+// slashDir returns dir preceded by a slash, or the empty string if dir is
+// empty. It is the value of the {/dir} template variable.
+func slashDir(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return "/" + dir
+}
+
 // RawURL returns a URL referring to the raw contents of a file relative to the
-// module's home directory.
+// module's home directory. It returns the empty string if the repository host
+// does not serve raw file contents.
 func (i *Info) RawURL(pathname string) string {
 	if i == nil {
 		return ""
@@ -146,8 +163,19 @@ var urlTemplatesByKind = map[string]urlTemplates{
 	"bitbucket": bitbucketURLTemplates,
 }
 
+// jsonInfoVersion is the version of the jsonInfo schema written by
+// MarshalJSON. Increment it when changing the meaning of an existing field,
+// and keep UnmarshalJSON able to read all earlier versions, since rows written
+// by older workers remain in the database.
+//
+// Version 0 (no Version field) is the format used before versioning.
+const jsonInfoVersion = 1
+
 // jsonInfo is a Go struct describing the JSON structure of an INFO.
+// Fields must not be renamed or removed, because the database holds values
+// in every past format.
 type jsonInfo struct {
+	Version   int `json:",omitempty"`
 	RepoURL   string
 	ModuleDir string
 	Commit    string
@@ -162,6 +190,7 @@ func (i *Info) MarshalJSON() (_ []byte, err error) {
 	defer derrors.Wrap(&err, "MarshalJSON")
 
 	ji := &jsonInfo{
+		Version:   jsonInfoVersion,
 		RepoURL:   i.repoURL,
 		ModuleDir: i.moduleDir,
 		Commit:    i.commit,
@@ -185,6 +214,11 @@ func (i *Info) MarshalJSON() (_ []byte, err error) {
 	return json.Marshal(ji)
 }
 
+// UnmarshalJSON decodes an Info stored by MarshalJSON, in the current format
+// or any earlier one. Fields it does not know about, such as those written by
+// a newer version, are ignored. If the data does not say which templates to
+// use, or names a kind of templates that this version does not know, the
+// templates are looked up from the repo URL's host.
 func (i *Info) UnmarshalJSON(data []byte) (err error) {
 	defer derrors.Wrap(&err, "UnmarshalJSON(data)")
 
@@ -200,12 +234,32 @@ func (i *Info) UnmarshalJSON(data []byte) (err error) {
 	} else if ji.Templates != nil {
 		i.templates = *ji.Templates
 	}
+	if i.templates == (urlTemplates{}) {
+		i.templates = templatesForRepoURL(i.repoURL)
+	}
 	return nil
 }
 
+// templatesForRepoURL returns the templates of the static pattern that
+// matches repoURL, or the zero urlTemplates if none does.
+func templatesForRepoURL(repoURL string) urlTemplates {
+	_, _, templates, _, err := matchStatic(removeHTTPScheme(repoURL))
+	if err != nil {
+		return urlTemplates{}
+	}
+	return templates
+}
+
 type Client struct {
 	// client used for HTTP requests. It is mutable for testing purposes.
 	httpClient *http.Client
+	// caching, if non-nil, is used to cache meta tag lookups.
+	caching *cachingConfig
+	// privatePatterns matches the paths of modules for which no HTTP requests
+	// should be made. See SetPrivatePatterns.
+	privatePatterns string
+	// loggedPrivate holds the private module paths that have been logged.
+	loggedPrivate sync.Map
 }
 
 // New constructs a *Client using the provided timeout.
@@ -253,41 +307,71 @@ func ModuleInfo(ctx context.Context, client *Client, modulePath, version string)
 	defer span.End()
 
 	if modulePath == stdlib.ModulePath {
-		commit, err := stdlib.TagForVersion(version)
-		if err != nil {
-			return nil, err
-		}
-		return &Info{
-			repoURL:   stdlib.GoSourceRepoURL,
-			moduleDir: stdlib.Directory(version),
-			commit:    commit,
-			templates: githubURLTemplates,
-		}, nil
+		return stdlibInfo(version)
 	}
+	private := client.isPrivate(ctx, modulePath)
 	repo, relativeModulePath, templates, transformCommit, err := matchStatic(modulePath)
 	if err != nil {
+		if private {
+			// Finding the source would mean fetching meta tags from the host.
+			return nil, nil
+		}
 		info, err = moduleInfoDynamic(ctx, client, modulePath, version)
 		if err != nil {
 			return nil, err
 		}
 	} else {
 		commit, isHash := commitFromVersion(version, relativeModulePath)
-		if transformCommit != nil {
-			commit = transformCommit(commit, isHash)
-		}
 		info = &Info{
 			repoURL:   "https://" + repo,
 			moduleDir: relativeModulePath,
-			commit:    commit,
+			commit:    formatCommit(commit, isHash, transformCommit),
 			templates: templates,
 		}
 	}
+	if private {
+		// Without probing the repo, assume the module lives in the directory
+		// without the major version, as adjustVersionedModuleDirectory does on
+		// failure.
+		info.moduleDir = removeVersionSuffix(info.moduleDir)
+		return info, nil
+	}
 	adjustVersionedModuleDirectory(ctx, client, info)
 	return info, nil
 	// TODO(golang/go#39627): support launchpad.net, including the special case
 	// in cmd/go/internal/get/vcs.go.
 }
 
+// stdlibInfo returns an Info for the standard library at the given version.
+//
+// Release versions correspond to tags, which are linked on GitHub. Other
+// versions, namely stdlib.MasterVersion and pseudo-versions, are linked to the
+// branch or commit on go.googlesource.com, the Go repo's Gerrit host.
+func stdlibInfo(vers string) (*Info, error) {
+	if !stdlib.IsDevelVersion(vers) {
+		commit, err := stdlib.TagForVersion(vers)
+		if err != nil {
+			return nil, err
+		}
+		return &Info{
+			repoURL:   stdlib.GoSourceRepoURL,
+			moduleDir: stdlib.Directory(vers),
+			commit:    commit,
+			templates: githubURLTemplates,
+		}, nil
+	}
+	ref, err := stdlib.RefForVersion(vers)
+	if err != nil {
+		return nil, err
+	}
+	return &Info{
+		repoURL:   stdlib.GoRepoURL,
+		moduleDir: stdlib.Directory(vers),
+		commit:    ref,
+		templates: googlesourceURLTemplates,
+	}, nil
+}
+
 // matchStatic matches the given module or repo path against a list of known
 // patterns. It returns the repo name, the module path relative to the repo
 // root, and URL templates if there is a match.
@@ -330,6 +414,12 @@ func matchStatic(moduleOrRepoPath string) (repo, relativeModulePath string, _ ur
 		if strings.HasPrefix(repo, apacheDomain) {
 			repo = strings.Replace(repo, apacheDomain, "github.com/apache/", 1)
 		}
+		// Special case: SourceHut owners are always written "~owner" in repo
+		// URLs, but a path may omit the "~".
+		const sourcehutDomain = "git.sr.ht/"
+		if strings.HasPrefix(repo, sourcehutDomain) && !strings.HasPrefix(repo, sourcehutDomain+"~") {
+			repo = sourcehutDomain + "~" + strings.TrimPrefix(repo, sourcehutDomain)
+		}
 		relativeModulePath = strings.TrimPrefix(moduleOrRepoPath, matches[0])
 		relativeModulePath = strings.TrimPrefix(relativeModulePath, "/")
 		return repo, relativeModulePath, pat.templates, pat.transformCommit, nil
@@ -341,7 +431,7 @@ func matchStatic(moduleOrRepoPath string) (repo, relativeModulePath string, _ ur
 func moduleInfoDynamic(ctx context.Context, client *Client, modulePath, version string) (_ *Info, err error) {
 	defer derrors.Wrap(&err, "source.moduleInfoDynamic(ctx, client, %q, %q)", modulePath, version)
 
-	sourceMeta, err := fetchMeta(ctx, client, modulePath)
+	sourceMeta, err := fetchMetaCached(ctx, client, modulePath)
 	if err != nil {
 		return nil, err
 	}
@@ -365,28 +455,35 @@ func moduleInfoDynamic(ctx context.Context, client *Client, modulePath, version
 	//    in the URL templates, like "https://github.com/go-yaml/yaml/tree/v2.2.3{/dir}". We can observe
 	//    that that template begins with a known pattern--a GitHub repo, ignore the rest of it, and use the
 	//    GitHub URL templates that we know.
+	// 3. If nothing matches, translate the go-source URL templates into our
+	//    own. Those URLs don't refer to the module's version, but they are
+	//    better than no links at all.
 	repoURL := sourceMeta.repoURL
 	_, _, templates, transformCommit, _ := matchStatic(removeHTTPScheme(repoURL))
 	// If err != nil, templates will be the zero value, so we can ignore it (same just below).
 	if templates == (urlTemplates{}) {
 		var repo string
 		repo, _, templates, transformCommit, _ = matchStatic(removeHTTPScheme(sourceMeta.dirTemplate))
+		if templates == (urlTemplates{}) && sourceMeta.dirTemplate != "" {
+			// Failing that, use the go-source templates themselves.
+			templates, err = templatesFromMeta(sourceMeta.dirTemplate, sourceMeta.fileTemplate)
+			if err != nil {
+				log.Infof(ctx, "unusable go-source templates for %q: %v", modulePath, err)
+			}
+		}
 		if templates == (urlTemplates{}) {
 			log.Infof(ctx, "no templates for repo URL %q from meta tag: err=%v", sourceMeta.repoURL, err)
-		} else {
+		} else if repo != "" {
 			// Use the repo from the template, not the original one.
 			repoURL = "https://" + repo
 		}
 	}
 	dir := strings.TrimPrefix(strings.TrimPrefix(modulePath, sourceMeta.repoRootPrefix), "/")
 	commit, isHash := commitFromVersion(version, dir)
-	if transformCommit != nil {
-		commit = transformCommit(commit, isHash)
-	}
 	return &Info{
 		repoURL:   strings.TrimSuffix(repoURL, "/"),
 		moduleDir: dir,
-		commit:    commit,
+		commit:    formatCommit(commit, isHash, transformCommit),
 		templates: templates,
 	}, nil
 }
@@ -447,7 +544,9 @@ var patterns = []struct {
 	pattern   string // uncompiled regexp
 	templates urlTemplates
 	re        *regexp.Regexp
-	// transformCommit may alter the commit before substitution
+	// transformCommit may alter the commit before substitution. If present,
+	// it is responsible for escaping the commit; otherwise, escapeRef is
+	// used.
 	transformCommit func(commit string, isHash bool) string
 }{
 	{
@@ -472,13 +571,8 @@ var patterns = []struct {
 		templates: githubURLTemplates,
 	},
 	{
-		pattern: `^(?P<repo>git\.sr\.ht/~[a-z0-9A-Z_.\-]+/[a-z0-9A-Z_.\-]+)`,
-		templates: urlTemplates{
-			Directory: "{repo}/tree/{commit}/{dir}",
-			File:      "{repo}/tree/{commit}/{file}",
-			Line:      "{repo}/tree/{commit}/{file}#L{line}",
-			Raw:       "{repo}/blob/{commit}/{file}",
-		},
+		pattern:   `^(?P<repo>git\.sr\.ht/~?[a-z0-9A-Z_.\-]+/[a-z0-9A-Z_.\-]+)`,
+		templates: sourcehutURLTemplates,
 	},
 	{
 		pattern: `^(?P<repo>git\.fd\.io/[a-z0-9A-Z_.\-]+)`,
@@ -494,7 +588,9 @@ var patterns = []struct {
 			if isHash {
 				p = "id"
 			}
-			return fmt.Sprintf("%s=%s", p, commit)
+			// The commit is a query parameter value, so slashes in
+			// nested-module tags must be escaped along with everything else.
+			return fmt.Sprintf("%s=%s", p, url.QueryEscape(commit))
 		},
 	},
 	{
@@ -550,13 +646,8 @@ var patterns = []struct {
 	// a ".git" repo suffix in an import path. If matching a repo URL from a meta tag,
 	// there is no ".git".
 	{
-		pattern: `^(?P<repo>[^.]+\.googlesource\.com/[^.]+)(\.git|$)`,
-		templates: urlTemplates{
-			Directory: "{repo}/+/{commit}/{dir}",
-			File:      "{repo}/+/{commit}/{file}",
-			Line:      "{repo}/+/{commit}/{file}#{line}",
-			// Gitiles has no support for serving raw content at this time.
-		},
+		pattern:   `^(?P<repo>[^.]+\.googlesource\.com/[^.]+)(\.git|$)`,
+		templates: googlesourceURLTemplates,
 	},
 	{
 		pattern:   `^(?P<repo>git\.apache\.org/[^.]+)(\.git|$)`,
@@ -597,7 +688,30 @@ func giteaTransformCommit(commit string, isHash bool) string {
 	if isHash {
 		return "commit/" + commit
 	}
-	return "tag/" + commit
+	return "tag/" + escapeRef(commit)
+}
+
+// formatCommit returns the form of commit to substitute into URL templates,
+// using transform if it is non-nil.
+func formatCommit(commit string, isHash bool, transform func(string, bool) string) string {
+	if transform != nil {
+		return transform(commit, isHash)
+	}
+	return escapeRef(commit)
+}
+
+// escapeRef escapes a tag or branch name for use in the path of a URL.
+//
+// Refs may contain slashes: every tag of a module nested in a repo does (for
+// example, "sdk/v0.2.0"). Hosts that put the ref in the path, like GitHub,
+// GitLab and Gitea, resolve such refs when the slashes are left intact, so
+// only the individual components are escaped.
+func escapeRef(ref string) string {
+	parts := strings.Split(ref, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
 }
 
 // urlTemplates describes how to build URLs from bits of source information.
@@ -609,15 +723,16 @@ func giteaTransformCommit(commit string, isHash bool) string {
 // 	• {importPath} - Package import path ("example.com/myrepo/mypkg").
 // 	• {commit}     - Tag name or commit hash corresponding to version ("v0.1.0" or "1234567890ab").
 // 	• {dir}        - Path to directory of the package, relative to repo root ("mypkg").
+// 	• {/dir}       - Like {dir}, but preceded by a slash if not empty ("/mypkg").
 // 	• {file}       - Path to file containing the identifier, relative to repo root ("mypkg/file.go").
 // 	• {base}       - Base name of file containing the identifier, including file extension ("file.go").
 // 	• {line}       - Line number for the identifier ("41").
 //
 type urlTemplates struct {
 	Repo      string `json:",omitempty"` // Optional URL template for the repository home page, with {repo}. If left empty, a default template "{repo}" is used.
-	Directory string // URL template for a directory, with {repo}, {importPath}, {commit}, {dir}.
-	File      string // URL template for a file, with {repo}, {importPath}, {commit}, {file}, {base}.
-	Line      string // URL template for a line, with {repo}, {importPath}, {commit}, {file}, {base}, {line}.
+	Directory string // URL template for a directory, with {repo}, {importPath}, {commit}, {dir}, {/dir}.
+	File      string // URL template for a file, with {repo}, {importPath}, {commit}, {file}, {base}, {dir}, {/dir}.
+	Line      string // URL template for a line, with {repo}, {importPath}, {commit}, {file}, {base}, {dir}, {/dir}, {line}.
 	Raw       string // Optional URL template for the raw contents of a file, with {repo}, {commit}, {file}.
 }
 
@@ -641,6 +756,18 @@ var (
 		Line:      "{repo}/src/{commit}/{file}#L{line}",
 		Raw:       "{repo}/raw/{commit}/{file}",
 	}
+	googlesourceURLTemplates = urlTemplates{
+		Directory: "{repo}/+/{commit}/{dir}",
+		File:      "{repo}/+/{commit}/{file}",
+		Line:      "{repo}/+/{commit}/{file}#{line}",
+		// Gitiles has no support for serving raw content at this time.
+	}
+	sourcehutURLTemplates = urlTemplates{
+		Directory: "{repo}/tree/{commit}/item/{dir}",
+		File:      "{repo}/tree/{commit}/item/{file}",
+		Line:      "{repo}/tree/{commit}/item/{file}#L{line}",
+		Raw:       "{repo}/blob/{commit}/{file}",
+	}
 )
 
 // commitFromVersion returns a string that refers to a commit corresponding to version.
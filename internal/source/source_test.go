@@ -19,6 +19,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-replayers/httpreplay"
+	"golang.org/x/pkgsite/internal/stdlib"
 )
 
 var (
@@ -213,26 +214,6 @@ func TestModuleInfo(t *testing.T) {
 			"https://gitee.com/Billcoding/gotypes/blob/v0.1.0/type.go#L1",
 			"https://gitee.com/Billcoding/gotypes/raw/v0.1.0/type.go",
 		},
-		{
-			"sourcehut",
-			"gioui.org", "v0.0.0-20200726090130-3b95e2918359", "op/op.go",
-
-			"https://git.sr.ht/~eliasnaur/gio",
-			"https://git.sr.ht/~eliasnaur/gio/tree/3b95e2918359",
-			"https://git.sr.ht/~eliasnaur/gio/tree/3b95e2918359/op/op.go",
-			"https://git.sr.ht/~eliasnaur/gio/tree/3b95e2918359/op/op.go#L1",
-			"https://git.sr.ht/~eliasnaur/gio/blob/3b95e2918359/op/op.go",
-		},
-		{
-			"sourcehut nested",
-			"gioui.org/app", "v0.0.0-20200726090130-3b95e2918359", "app.go",
-
-			"https://git.sr.ht/~eliasnaur/gio",
-			"https://git.sr.ht/~eliasnaur/gio/tree/3b95e2918359/app",
-			"https://git.sr.ht/~eliasnaur/gio/tree/3b95e2918359/app/app.go",
-			"https://git.sr.ht/~eliasnaur/gio/tree/3b95e2918359/app/app.go#L1",
-			"https://git.sr.ht/~eliasnaur/gio/blob/3b95e2918359/app/app.go",
-		},
 		{
 			"git.fd.io tag",
 			"git.fd.io/govpp", "v0.3.5", "doc.go",
@@ -355,7 +336,7 @@ func TestModuleInfo(t *testing.T) {
 		},
 	} {
 		t.Run(test.desc, func(t *testing.T) {
-			info, err := ModuleInfo(context.Background(), &Client{client}, test.modulePath, test.version)
+			info, err := ModuleInfo(context.Background(), &Client{httpClient: client}, test.modulePath, test.version)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -372,7 +353,7 @@ func TestModuleInfo(t *testing.T) {
 
 	t.Run("stdlib-raw", func(t *testing.T) {
 		// Test raw URLs from the standard library, which are a special case.
-		info, err := ModuleInfo(context.Background(), &Client{client}, "std", "v1.13.3")
+		info, err := ModuleInfo(context.Background(), &Client{httpClient: client}, "std", "v1.13.3")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -384,6 +365,126 @@ func TestModuleInfo(t *testing.T) {
 	})
 }
 
+func TestModuleInfoMonorepo(t *testing.T) {
+	// The go-import tag for a vanity path whose modules live in
+	// subdirectories of a single repo.
+	const vanityPage = `<html><head><meta name="go-import" content="example.com git https://github.com/org/mono"></head></html>`
+	for _, test := range []struct {
+		desc                string
+		modulePath, version string
+		// hasMajorDir reports whether the repo has a go.mod file in the "/v2"
+		// subdirectory.
+		hasMajorDir bool
+		wantModule  string
+		wantFile    string
+	}{
+		{
+			"major subdirectory",
+			"github.com/org/mono/services/thing/v2", "v2.1.0", true,
+			"https://github.com/org/mono/tree/services/thing/v2.1.0/services/thing/v2",
+			"https://github.com/org/mono/blob/services/thing/v2.1.0/services/thing/v2/f.go",
+		},
+		{
+			"major branch",
+			"github.com/org/mono/services/thing/v2", "v2.1.0", false,
+			"https://github.com/org/mono/tree/services/thing/v2.1.0/services/thing",
+			"https://github.com/org/mono/blob/services/thing/v2.1.0/services/thing/f.go",
+		},
+		{
+			"major branch, pseudo-version",
+			"github.com/org/mono/services/thing/v2", "v2.0.0-20200726090130-3b95e2918359", false,
+			"https://github.com/org/mono/tree/3b95e2918359/services/thing",
+			"https://github.com/org/mono/blob/3b95e2918359/services/thing/f.go",
+		},
+		{
+			"vanity, major subdirectory",
+			"example.com/services/thing/v2", "v2.1.0", true,
+			"https://github.com/org/mono/tree/services/thing/v2.1.0/services/thing/v2",
+			"https://github.com/org/mono/blob/services/thing/v2.1.0/services/thing/v2/f.go",
+		},
+		{
+			"vanity, major branch",
+			"example.com/services/thing/v2", "v2.1.0", false,
+			"https://github.com/org/mono/tree/services/thing/v2.1.0/services/thing",
+			"https://github.com/org/mono/blob/services/thing/v2.1.0/services/thing/f.go",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			transport := &countingTransport{
+				pages:  map[string]string{"example.com": vanityPage},
+				counts: map[string]int{},
+			}
+			if test.hasMajorDir {
+				transport.pages["github.com"] = ""
+			}
+			client := &Client{httpClient: &http.Client{Transport: transport}}
+			info, err := ModuleInfo(context.Background(), client, test.modulePath, test.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := info.RepoURL(); got != "https://github.com/org/mono" {
+				t.Errorf("RepoURL: got %q, want the repo root", got)
+			}
+			if got := info.ModuleURL(); got != test.wantModule {
+				t.Errorf("ModuleURL:\ngot  %s\nwant %s", got, test.wantModule)
+			}
+			if got := info.FileURL("f.go"); got != test.wantFile {
+				t.Errorf("FileURL:\ngot  %s\nwant %s", got, test.wantFile)
+			}
+		})
+	}
+}
+
+func TestModuleInfoStdlib(t *testing.T) {
+	for _, test := range []struct {
+		version                        string
+		wantModule, wantFile, wantLine string
+	}{
+		{
+			"v1.14.0",
+			"https://github.com/golang/go/tree/go1.14/src",
+			"https://github.com/golang/go/blob/go1.14/src/fmt/print.go",
+			"https://github.com/golang/go/blob/go1.14/src/fmt/print.go#L5",
+		},
+		{
+			"v1.15.0-rc.1",
+			"https://github.com/golang/go/tree/go1.15rc1/src",
+			"https://github.com/golang/go/blob/go1.15rc1/src/fmt/print.go",
+			"https://github.com/golang/go/blob/go1.15rc1/src/fmt/print.go#L5",
+		},
+		{
+			"master",
+			"https://go.googlesource.com/go/+/refs/heads/master/src",
+			"https://go.googlesource.com/go/+/refs/heads/master/src/fmt/print.go",
+			"https://go.googlesource.com/go/+/refs/heads/master/src/fmt/print.go#5",
+		},
+		{
+			"v0.0.0-20200827174030-2e9ea2ba0cf1",
+			"https://go.googlesource.com/go/+/2e9ea2ba0cf1/src",
+			"https://go.googlesource.com/go/+/2e9ea2ba0cf1/src/fmt/print.go",
+			"https://go.googlesource.com/go/+/2e9ea2ba0cf1/src/fmt/print.go#5",
+		},
+	} {
+		t.Run(test.version, func(t *testing.T) {
+			info, err := ModuleInfo(context.Background(), nil, stdlib.ModulePath, test.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range []struct {
+				name, got, want string
+			}{
+				{"ModuleURL", info.ModuleURL(), test.wantModule},
+				{"FileURL", info.FileURL("fmt/print.go"), test.wantFile},
+				{"LineURL", info.LineURL("fmt/print.go", 5), test.wantLine},
+			} {
+				if c.got != c.want {
+					t.Errorf("%s:\ngot  %s\nwant %s", c.name, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
 func newReplayClient(t *testing.T, record bool) (*http.Client, func()) {
 	replayFilePath := filepath.Join("testdata", t.Name()+".replay")
 	if record {
@@ -426,6 +527,8 @@ func TestMatchStatic(t *testing.T) {
 		{"git.com/repo.git/dir", "git.com/repo", "dir"},
 		{"mercurial.com/repo.hg", "mercurial.com/repo", ""},
 		{"mercurial.com/repo.hg/dir", "mercurial.com/repo", "dir"},
+		{"git.sr.ht/~a/b/c", "git.sr.ht/~a/b", "c"},
+		{"git.sr.ht/a/b/c", "git.sr.ht/~a/b", "c"},
 	} {
 		t.Run(test.in, func(t *testing.T) {
 			gotRepo, gotSuffix, _, _, err := matchStatic(test.in)
@@ -484,12 +587,17 @@ func TestModuleInfoDynamic(t *testing.T) {
 		},
 		{
 			"alice.org/pkg/source",
-			// Has a go-source tag, but we can't use the templates.
+			// Has a go-source tag with templates that don't match a known
+			// pattern, so we translate them.
 			&Info{
 				repoURL:   "http://alice.org/pkg",
 				moduleDir: "source",
 				commit:    "source/v1.2.3",
-				// empty templates
+				templates: urlTemplates{
+					Directory: "http://alice.org/pkg{/dir}",
+					File:      "http://alice.org/pkg{/dir}?f={base}",
+					Line:      "http://alice.org/pkg{/dir}?f={base}#Line{line}",
+				},
 			},
 		},
 
@@ -500,7 +608,11 @@ func TestModuleInfoDynamic(t *testing.T) {
 				repoURL:   "http://alice.org/pkg",
 				moduleDir: "ignore",
 				commit:    "ignore/v1.2.3",
-				// empty templates
+				templates: urlTemplates{
+					Directory: "http://alice.org/pkg{/dir}",
+					File:      "http://alice.org/pkg{/dir}?f={base}",
+					Line:      "http://alice.org/pkg{/dir}?f={base}#Line{line}",
+				},
 			},
 		},
 		{"alice.org/pkg/multiple", nil},
@@ -525,6 +637,30 @@ func TestModuleInfoDynamic(t *testing.T) {
 				// empty templates
 			},
 		},
+		{
+			"golang.zx2c4.com/wireguard",
+			// cgit, which has no known pattern.
+			&Info{
+				repoURL:   "https://git.zx2c4.com/wireguard-go",
+				moduleDir: "",
+				commit:    "v1.2.3",
+				templates: urlTemplates{
+					Directory: "https://git.zx2c4.com/wireguard-go/tree{/dir}",
+					File:      "https://git.zx2c4.com/wireguard-go/tree{/dir}/{base}",
+					Line:      "https://git.zx2c4.com/wireguard-go/tree{/dir}/{base}#n{line}",
+				},
+			},
+		},
+		{
+			"carol.dev/garbage",
+			// Unusable go-source templates are rejected.
+			&Info{
+				repoURL:   "https://vcs.carol.dev/garbage",
+				moduleDir: "",
+				commit:    "v1.2.3",
+				// empty templates
+			},
+		},
 		{
 			"azul3d.org/examples/abs",
 			// The go-source tag has a template that is handled incorrectly by godoc; but we
@@ -828,6 +964,17 @@ var testWeb = map[string]string{
 		`<meta http-equiv="refresh" content="0; url=https://godoc.org/azul3d.org/examples/abs">` +
 		`</head>`,
 
+	// cgit installation, with a go-source tag.
+	"https://golang.zx2c4.com/wireguard": `<!DOCTYPE html><html><head>` +
+		`<meta name="go-import" content="golang.zx2c4.com/wireguard git https://git.zx2c4.com/wireguard-go">` +
+		`<meta name="go-source" content="golang.zx2c4.com/wireguard https://git.zx2c4.com/wireguard-go https://git.zx2c4.com/wireguard-go/tree{/dir} https://git.zx2c4.com/wireguard-go/tree{/dir}/{file}#n{line}">` +
+		`</head>`,
+	// go-source tag with templates we can't fill in.
+	"https://carol.dev/garbage": `<head>` +
+		`<meta name="go-import" content="carol.dev/garbage git https://vcs.carol.dev/garbage">` +
+		`<meta name="go-source" content="carol.dev/garbage https://vcs.carol.dev/garbage https://vcs.carol.dev/garbage/{branch}{/dir} https://vcs.carol.dev/garbage/{branch}{/dir}/{file}#L{line}">` +
+		`</head>`,
+
 	// Multiple go-import meta tags; one of which is a vgo-special mod vcs type
 	"http://myitcv.io/blah2": `<!DOCTYPE html><html><head>` +
 		`<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>` +
@@ -847,19 +994,19 @@ func TestJSON(t *testing.T) {
 		},
 		{
 			&Info{repoURL: "r", moduleDir: "m", commit: "c"},
-			`{"RepoURL":"r","ModuleDir":"m","Commit":"c"}`,
+			`{"Version":1,"RepoURL":"r","ModuleDir":"m","Commit":"c"}`,
 		},
 		{
 			&Info{repoURL: "r", moduleDir: "m", commit: "c", templates: githubURLTemplates},
-			`{"RepoURL":"r","ModuleDir":"m","Commit":"c","Kind":"github"}`,
+			`{"Version":1,"RepoURL":"r","ModuleDir":"m","Commit":"c","Kind":"github"}`,
 		},
 		{
 			&Info{repoURL: "r", moduleDir: "m", commit: "c", templates: urlTemplates{File: "f"}},
-			`{"RepoURL":"r","ModuleDir":"m","Commit":"c","Templates":{"Directory":"","File":"f","Line":"","Raw":""}}`,
+			`{"Version":1,"RepoURL":"r","ModuleDir":"m","Commit":"c","Templates":{"Directory":"","File":"f","Line":"","Raw":""}}`,
 		},
 		{
 			&Info{repoURL: "r", moduleDir: "m", commit: "c", templates: urlTemplates{Repo: "r", File: "f"}},
-			`{"RepoURL":"r","ModuleDir":"m","Commit":"c","Templates":{"Repo":"r","Directory":"","File":"f","Line":"","Raw":""}}`,
+			`{"Version":1,"RepoURL":"r","ModuleDir":"m","Commit":"c","Templates":{"Repo":"r","Directory":"","File":"f","Line":"","Raw":""}}`,
 		},
 	} {
 		bytes, err := json.Marshal(&test.in)
@@ -885,6 +1032,72 @@ func TestJSON(t *testing.T) {
 	}
 }
 
+func TestJSONCompatibility(t *testing.T) {
+	// Values in the formats that the database holds. Each must decode to want,
+	// and re-encoding want must decode to want again.
+	for _, test := range []struct {
+		desc string
+		in   string
+		want Info
+	}{
+		{
+			"unversioned, by kind",
+			`{"RepoURL":"https://github.com/a/b","ModuleDir":"c","Commit":"v1.2.3","Kind":"github"}`,
+			Info{repoURL: "https://github.com/a/b", moduleDir: "c", commit: "v1.2.3", templates: githubURLTemplates},
+		},
+		{
+			"unversioned, old gitlab kind",
+			`{"RepoURL":"https://gitlab.com/a/b","ModuleDir":"","Commit":"v1.2.3","Kind":"gitlab"}`,
+			Info{repoURL: "https://gitlab.com/a/b", commit: "v1.2.3", templates: githubURLTemplates},
+		},
+		{
+			"unversioned, explicit templates",
+			`{"RepoURL":"https://x.org/a","ModuleDir":"","Commit":"v1.0.0","Templates":{"Directory":"{repo}/d/{dir}","File":"{repo}/f/{file}","Line":"{repo}/f/{file}#{line}","Raw":""}}`,
+			Info{repoURL: "https://x.org/a", commit: "v1.0.0", templates: urlTemplates{
+				Directory: "{repo}/d/{dir}",
+				File:      "{repo}/f/{file}",
+				Line:      "{repo}/f/{file}#{line}",
+			}},
+		},
+		{
+			"unversioned, no templates",
+			`{"RepoURL":"https://bitbucket.org/a/b","ModuleDir":"","Commit":"abcdef"}`,
+			Info{repoURL: "https://bitbucket.org/a/b", commit: "abcdef", templates: bitbucketURLTemplates},
+		},
+		{
+			"no templates, unknown host",
+			`{"RepoURL":"https://x.org/a","ModuleDir":"","Commit":"v1.0.0"}`,
+			Info{repoURL: "https://x.org/a", commit: "v1.0.0"},
+		},
+		{
+			"newer version",
+			`{"Version":99,"RepoURL":"https://git.sr.ht/~a/b","ModuleDir":"","Commit":"v1.0.0","Kind":"sourcehut","Extra":true}`,
+			Info{repoURL: "https://git.sr.ht/~a/b", commit: "v1.0.0", templates: sourcehutURLTemplates},
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			var got Info
+			if err := json.Unmarshal([]byte(test.in), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Fatalf("got  %#v\nwant %#v", got, test.want)
+			}
+			data, err := json.Marshal(&got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var again Info
+			if err := json.Unmarshal(data, &again); err != nil {
+				t.Fatal(err)
+			}
+			if again != test.want {
+				t.Errorf("after round trip through %s:\ngot  %#v\nwant %#v", data, again, test.want)
+			}
+		})
+	}
+}
+
 func TestURLTemplates(t *testing.T) {
 	// Check that templates contain the right variables.
 
@@ -907,3 +1120,486 @@ func TestURLTemplates(t *testing.T) {
 		check(p.templates.Raw, "commit", "file")
 	}
 }
+
+func TestRawURL(t *testing.T) {
+	for _, test := range []struct {
+		desc     string
+		info     *Info
+		pathname string
+		want     string
+	}{
+		{
+			"nil info",
+			nil,
+			"README.md",
+			"",
+		},
+		{
+			"module at repo root",
+			NewGitHubInfo("https://github.com/a/b", "", "v1.0.0"),
+			"docs/arch.png",
+			"https://github.com/a/b/raw/v1.0.0/docs/arch.png",
+		},
+		{
+			"module in repo subdirectory",
+			NewGitHubInfo("https://github.com/a/b", "sub/mod", "sub/mod/v1.0.0"),
+			"docs/arch.png",
+			"https://github.com/a/b/raw/sub/mod/v1.0.0/sub/mod/docs/arch.png",
+		},
+		{
+			"no raw template",
+			&Info{
+				repoURL:   "https://go.googlesource.com/image",
+				commit:    "v0.1.0",
+				templates: urlTemplates{File: "{repo}/+/{commit}/{file}"},
+			},
+			"README.md",
+			"",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := test.info.RawURL(test.pathname); got != test.want {
+				t.Errorf("got  %q\nwant %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRefsWithSlashes(t *testing.T) {
+	// A module in the "release" directory of its repo has tags like
+	// "release/v1.2.0".
+	const (
+		tagged = "v1.2.0"
+		pseudo = "v0.0.0-20200726090130-3b95e2918359"
+	)
+	for _, test := range []struct {
+		modulePath, version string
+		wantFile, wantRaw   string
+	}{
+		{
+			"github.com/a/b/release", tagged,
+			"https://github.com/a/b/blob/release/v1.2.0/release/f.go",
+			"https://github.com/a/b/raw/release/v1.2.0/release/f.go",
+		},
+		{
+			"github.com/a/b/release", pseudo,
+			"https://github.com/a/b/blob/3b95e2918359/release/f.go",
+			"https://github.com/a/b/raw/3b95e2918359/release/f.go",
+		},
+		{
+			"gitlab.com/a/b/release", tagged,
+			"https://gitlab.com/a/b/blob/release/v1.2.0/release/f.go",
+			"https://gitlab.com/a/b/raw/release/v1.2.0/release/f.go",
+		},
+		{
+			"gitlab.com/a/b/release", pseudo,
+			"https://gitlab.com/a/b/blob/3b95e2918359/release/f.go",
+			"https://gitlab.com/a/b/raw/3b95e2918359/release/f.go",
+		},
+		{
+			"bitbucket.org/a/b/release", tagged,
+			"https://bitbucket.org/a/b/src/release/v1.2.0/release/f.go",
+			"https://bitbucket.org/a/b/raw/release/v1.2.0/release/f.go",
+		},
+		{
+			"bitbucket.org/a/b/release", pseudo,
+			"https://bitbucket.org/a/b/src/3b95e2918359/release/f.go",
+			"https://bitbucket.org/a/b/raw/3b95e2918359/release/f.go",
+		},
+		{
+			"gitea.com/a/b.git/release", tagged,
+			"https://gitea.com/a/b/src/tag/release/v1.2.0/release/f.go",
+			"https://gitea.com/a/b/raw/tag/release/v1.2.0/release/f.go",
+		},
+		{
+			"gitea.com/a/b.git/release", pseudo,
+			"https://gitea.com/a/b/src/commit/3b95e2918359/release/f.go",
+			"https://gitea.com/a/b/raw/commit/3b95e2918359/release/f.go",
+		},
+		{
+			"gogs.example.com/a/b.git/release", tagged,
+			"https://gogs.example.com/a/b/src/release/v1.2.0/release/f.go",
+			"https://gogs.example.com/a/b/raw/release/v1.2.0/release/f.go",
+		},
+		{
+			"git.sr.ht/~a/b/release", tagged,
+			"https://git.sr.ht/~a/b/tree/release/v1.2.0/item/release/f.go",
+			"https://git.sr.ht/~a/b/blob/release/v1.2.0/release/f.go",
+		},
+		{
+			"git.sr.ht/~a/b/release", pseudo,
+			"https://git.sr.ht/~a/b/tree/3b95e2918359/item/release/f.go",
+			"https://git.sr.ht/~a/b/blob/3b95e2918359/release/f.go",
+		},
+		{
+			"git.fd.io/b/release", tagged,
+			"https://git.fd.io/b/tree/release/f.go?h=release%2Fv1.2.0",
+			"https://git.fd.io/b/plain/release/f.go?h=release%2Fv1.2.0",
+		},
+		{
+			"git.fd.io/b/release", pseudo,
+			"https://git.fd.io/b/tree/release/f.go?id=3b95e2918359",
+			"https://git.fd.io/b/plain/release/f.go?id=3b95e2918359",
+		},
+		{
+			"git.pirl.io/a/b/release", tagged,
+			"https://git.pirl.io/a/b/-/blob/release/v1.2.0/release/f.go",
+			"https://git.pirl.io/a/b/-/raw/release/v1.2.0/release/f.go",
+		},
+		{
+			"go.googlesource.com/b.git/release", tagged,
+			"https://go.googlesource.com/b/+/release/v1.2.0/release/f.go",
+			"",
+		},
+		{
+			"go.googlesource.com/b.git/release", pseudo,
+			"https://go.googlesource.com/b/+/3b95e2918359/release/f.go",
+			"",
+		},
+	} {
+		t.Run(test.modulePath+"@"+test.version, func(t *testing.T) {
+			info, err := ModuleInfo(context.Background(), NewClient(testTimeout), test.modulePath, test.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := info.FileURL("f.go"); got != test.wantFile {
+				t.Errorf("FileURL:\ngot  %s\nwant %s", got, test.wantFile)
+			}
+			if got := info.RawURL("f.go"); got != test.wantRaw {
+				t.Errorf("RawURL:\ngot  %s\nwant %s", got, test.wantRaw)
+			}
+		})
+	}
+}
+
+func TestModuleInfoSourceHut(t *testing.T) {
+	for _, test := range []struct {
+		modulePath, version                     string
+		wantModule, wantFile, wantLine, wantRaw string
+	}{
+		{
+			"git.sr.ht/~a/b", "v1.2.0",
+			"https://git.sr.ht/~a/b/tree/v1.2.0/item",
+			"https://git.sr.ht/~a/b/tree/v1.2.0/item/c/f.go",
+			"https://git.sr.ht/~a/b/tree/v1.2.0/item/c/f.go#L5",
+			"https://git.sr.ht/~a/b/blob/v1.2.0/c/f.go",
+		},
+		{
+			"git.sr.ht/~a/b", "v0.0.0-20200726090130-3b95e2918359",
+			"https://git.sr.ht/~a/b/tree/3b95e2918359/item",
+			"https://git.sr.ht/~a/b/tree/3b95e2918359/item/c/f.go",
+			"https://git.sr.ht/~a/b/tree/3b95e2918359/item/c/f.go#L5",
+			"https://git.sr.ht/~a/b/blob/3b95e2918359/c/f.go",
+		},
+		{
+			"git.sr.ht/~a/b/sub", "v1.2.0",
+			"https://git.sr.ht/~a/b/tree/sub/v1.2.0/item/sub",
+			"https://git.sr.ht/~a/b/tree/sub/v1.2.0/item/sub/c/f.go",
+			"https://git.sr.ht/~a/b/tree/sub/v1.2.0/item/sub/c/f.go#L5",
+			"https://git.sr.ht/~a/b/blob/sub/v1.2.0/sub/c/f.go",
+		},
+		{
+			// The owner is missing its "~".
+			"git.sr.ht/a/b", "v0.0.0-20200726090130-3b95e2918359",
+			"https://git.sr.ht/~a/b/tree/3b95e2918359/item",
+			"https://git.sr.ht/~a/b/tree/3b95e2918359/item/c/f.go",
+			"https://git.sr.ht/~a/b/tree/3b95e2918359/item/c/f.go#L5",
+			"https://git.sr.ht/~a/b/blob/3b95e2918359/c/f.go",
+		},
+	} {
+		t.Run(test.modulePath+"@"+test.version, func(t *testing.T) {
+			info, err := ModuleInfo(context.Background(), NewClient(testTimeout), test.modulePath, test.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range []struct {
+				name, got, want string
+			}{
+				{"ModuleURL", info.ModuleURL(), test.wantModule},
+				{"FileURL", info.FileURL("c/f.go"), test.wantFile},
+				{"LineURL", info.LineURL("c/f.go", 5), test.wantLine},
+				{"RawURL", info.RawURL("c/f.go"), test.wantRaw},
+			} {
+				if c.got != c.want {
+					t.Errorf("%s:\ngot  %s\nwant %s", c.name, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+// sourceHutTransport fakes gioui.org, whose meta tags point to a SourceHut
+// repository, and that repository on git.sr.ht. The repository has the paths
+// in sourceHutPaths at every revision. Like git.sr.ht, it serves directories
+// and files under /tree/REV/item/, and raw files under /blob/REV/.
+type sourceHutTransport struct{}
+
+const sourceHutRepo = "/~eliasnaur/gio"
+
+// sourceHutPaths maps the directories and files of the repository of
+// sourceHutTransport to whether they are files.
+var sourceHutPaths = map[string]bool{
+	"":           false,
+	"op":         false,
+	"op/op.go":   true,
+	"app":        false,
+	"app/app.go": true,
+}
+
+// gioMetaPage is the page that gioui.org serves to the go command.
+const gioMetaPage = `<html><head>
+<meta name="go-import" content="gioui.org git https://git.sr.ht/~eliasnaur/gio">
+<meta name="go-source" content="gioui.org _ https://git.sr.ht/~eliasnaur/gio/tree/master{/dir} https://git.sr.ht/~eliasnaur/gio/tree/master{/dir}/{file}#L{line}">
+</head></html>`
+
+func (sourceHutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	status := http.StatusNotFound
+	body := ""
+	switch req.URL.Host {
+	case "gioui.org":
+		status = http.StatusOK
+		body = gioMetaPage
+	case "git.sr.ht":
+		if sourceHutExists(req.URL.Path) {
+			status = http.StatusOK
+		}
+	}
+	return &http.Response{
+		Status:     http.StatusText(status),
+		StatusCode: status,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// sourceHutExists reports whether the fake git.sr.ht of sourceHutTransport
+// serves p.
+func sourceHutExists(p string) bool {
+	if p == sourceHutRepo {
+		return true
+	}
+	rest := strings.TrimPrefix(p, sourceHutRepo+"/")
+	if rest == p {
+		return false
+	}
+	parts := strings.SplitN(rest, "/", 3)
+	if len(parts) < 2 || parts[1] == "" {
+		return false
+	}
+	switch parts[0] {
+	case "tree":
+		// tree/REV/item[/PATH]
+		if len(parts) < 3 {
+			return false
+		}
+		item := strings.TrimPrefix(parts[2], "item")
+		if item != "" && !strings.HasPrefix(item, "/") {
+			return false
+		}
+		_, ok := sourceHutPaths[strings.TrimPrefix(item, "/")]
+		return ok
+	case "blob":
+		// blob/REV/PATH
+		return len(parts) == 3 && sourceHutPaths[parts[2]]
+	default:
+		return false
+	}
+}
+
+func TestModuleInfoSourceHutVanity(t *testing.T) {
+	client := &http.Client{Transport: sourceHutTransport{}}
+	for _, test := range []struct {
+		modulePath, file                        string
+		wantModule, wantFile, wantLine, wantRaw string
+	}{
+		{
+			"gioui.org", "op/op.go",
+			"https://git.sr.ht/~eliasnaur/gio/tree/3b95e2918359/item",
+			"https://git.sr.ht/~eliasnaur/gio/tree/3b95e2918359/item/op/op.go",
+			"https://git.sr.ht/~eliasnaur/gio/tree/3b95e2918359/item/op/op.go#L1",
+			"https://git.sr.ht/~eliasnaur/gio/blob/3b95e2918359/op/op.go",
+		},
+		{
+			"gioui.org/app", "app.go",
+			"https://git.sr.ht/~eliasnaur/gio/tree/3b95e2918359/item/app",
+			"https://git.sr.ht/~eliasnaur/gio/tree/3b95e2918359/item/app/app.go",
+			"https://git.sr.ht/~eliasnaur/gio/tree/3b95e2918359/item/app/app.go#L1",
+			"https://git.sr.ht/~eliasnaur/gio/blob/3b95e2918359/app/app.go",
+		},
+	} {
+		t.Run(test.modulePath, func(t *testing.T) {
+			info, err := ModuleInfo(context.Background(), &Client{httpClient: client}, test.modulePath, "v0.0.0-20200726090130-3b95e2918359")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range []struct {
+				name, got, want string
+			}{
+				{"RepoURL", info.RepoURL(), "https://git.sr.ht/~eliasnaur/gio"},
+				{"ModuleURL", info.ModuleURL(), test.wantModule},
+				{"FileURL", info.FileURL(test.file), test.wantFile},
+				{"LineURL", info.LineURL(test.file, 1), test.wantLine},
+				{"RawURL", info.RawURL(test.file), test.wantRaw},
+			} {
+				if c.got != c.want {
+					t.Errorf("%s:\ngot  %s\nwant %s", c.name, c.got, c.want)
+					continue
+				}
+				res, err := client.Head(c.got)
+				if err != nil {
+					t.Fatalf("%s: %v", c.got, err)
+				}
+				res.Body.Close()
+				if res.StatusCode != http.StatusOK {
+					t.Errorf("%s: %s", c.got, res.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestEscapeRef(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"v1.2.0", "v1.2.0"},
+		{"release/v1.2", "release/v1.2"},
+		{"a#b/v1.0.0", "a%23b/v1.0.0"},
+		{"a b/v1.0.0", "a%20b/v1.0.0"},
+	} {
+		if got := escapeRef(test.in); got != test.want {
+			t.Errorf("escapeRef(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestTemplatesFromMeta(t *testing.T) {
+	for _, test := range []struct {
+		desc         string
+		dir, file    string
+		want         urlTemplates
+		wantErr      bool
+		wantDirURL   string
+		wantFileURL  string
+		wantLineURL  string
+		moduleDir    string
+		fileInModule string
+	}{
+		{
+			desc: "sr.ht",
+			dir:  "https://git.sr.ht/~sircmpwn/getopt/tree/master{/dir}",
+			file: "https://git.sr.ht/~sircmpwn/getopt/tree/master{/dir}/{file}#L{line}",
+			want: urlTemplates{
+				Directory: "https://git.sr.ht/~sircmpwn/getopt/tree/master{/dir}",
+				File:      "https://git.sr.ht/~sircmpwn/getopt/tree/master{/dir}/{base}",
+				Line:      "https://git.sr.ht/~sircmpwn/getopt/tree/master{/dir}/{base}#L{line}",
+			},
+			moduleDir:    "",
+			fileInModule: "sub/getopt.go",
+			wantDirURL:   "https://git.sr.ht/~sircmpwn/getopt/tree/master/sub",
+			wantFileURL:  "https://git.sr.ht/~sircmpwn/getopt/tree/master/sub/getopt.go",
+			wantLineURL:  "https://git.sr.ht/~sircmpwn/getopt/tree/master/sub/getopt.go#L5",
+		},
+		{
+			desc: "gogs",
+			dir:  "https://try.gogs.io/alice/pkg/src/master{/dir}",
+			file: "https://try.gogs.io/alice/pkg/src/master{/dir}/{file}#L{line}",
+			want: urlTemplates{
+				Directory: "https://try.gogs.io/alice/pkg/src/master{/dir}",
+				File:      "https://try.gogs.io/alice/pkg/src/master{/dir}/{base}",
+				Line:      "https://try.gogs.io/alice/pkg/src/master{/dir}/{base}#L{line}",
+			},
+			moduleDir:    "mod",
+			fileInModule: "pkg.go",
+			wantDirURL:   "https://try.gogs.io/alice/pkg/src/master/mod/sub",
+			wantFileURL:  "https://try.gogs.io/alice/pkg/src/master/mod/pkg.go",
+			wantLineURL:  "https://try.gogs.io/alice/pkg/src/master/mod/pkg.go#L5",
+		},
+		{
+			desc: "cgit",
+			dir:  "https://git.zx2c4.com/wireguard-go/tree{/dir}",
+			file: "https://git.zx2c4.com/wireguard-go/tree{/dir}/{file}#n{line}",
+			want: urlTemplates{
+				Directory: "https://git.zx2c4.com/wireguard-go/tree{/dir}",
+				File:      "https://git.zx2c4.com/wireguard-go/tree{/dir}/{base}",
+				Line:      "https://git.zx2c4.com/wireguard-go/tree{/dir}/{base}#n{line}",
+			},
+			moduleDir:    "",
+			fileInModule: "main.go",
+			wantDirURL:   "https://git.zx2c4.com/wireguard-go/tree/sub",
+			wantFileURL:  "https://git.zx2c4.com/wireguard-go/tree/main.go",
+			wantLineURL:  "https://git.zx2c4.com/wireguard-go/tree/main.go#n5",
+		},
+		{
+			desc: "file in fragment",
+			dir:  "https://gotools.org/azul3d.org/examples{/dir}",
+			file: "https://gotools.org/azul3d.org/examples{/dir}#{file}-L{line}",
+			want: urlTemplates{
+				Directory: "https://gotools.org/azul3d.org/examples{/dir}",
+				File:      "https://gotools.org/azul3d.org/examples{/dir}#{base}",
+				Line:      "https://gotools.org/azul3d.org/examples{/dir}#{base}-L{line}",
+			},
+			moduleDir:    "",
+			fileInModule: "abs/main.go",
+			wantDirURL:   "https://gotools.org/azul3d.org/examples/sub",
+			wantFileURL:  "https://gotools.org/azul3d.org/examples/abs#main.go",
+			wantLineURL:  "https://gotools.org/azul3d.org/examples/abs#main.go-L5",
+		},
+		{
+			desc:    "unknown placeholder",
+			dir:     "https://example.com{/dir}",
+			file:    "https://example.com/{branch}{/dir}/{file}#L{line}",
+			wantErr: true,
+		},
+		{
+			desc:    "not a URL",
+			dir:     "foo",
+			file:    "bar",
+			wantErr: true,
+		},
+		{
+			desc:    "line outside fragment",
+			dir:     "https://example.com{/dir}",
+			file:    "https://example.com{/dir}/{file}?line={line}",
+			wantErr: true,
+		},
+		{
+			desc:    "no file",
+			dir:     "https://example.com{/dir}",
+			file:    "https://example.com{/dir}",
+			wantErr: true,
+		},
+		{
+			desc:    "unterminated placeholder",
+			dir:     "https://example.com{/dir",
+			file:    "https://example.com{/dir}/{file}",
+			wantErr: true,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := templatesFromMeta(test.dir, test.file)
+			if err != nil {
+				if !test.wantErr {
+					t.Fatal(err)
+				}
+				return
+			}
+			if test.wantErr {
+				t.Fatalf("got %+v, want error", got)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+			info := &Info{repoURL: "https://example.com", moduleDir: test.moduleDir, commit: "v1.0.0", templates: got}
+			if got := info.DirectoryURL("sub"); got != test.wantDirURL {
+				t.Errorf("DirectoryURL: got %s, want %s", got, test.wantDirURL)
+			}
+			if got := info.FileURL(test.fileInModule); got != test.wantFileURL {
+				t.Errorf("FileURL: got %s, want %s", got, test.wantFileURL)
+			}
+			if got := info.LineURL(test.fileInModule, 5); got != test.wantLineURL {
+				t.Errorf("LineURL: got %s, want %s", got, test.wantLineURL)
+			}
+		})
+	}
+}
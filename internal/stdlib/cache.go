@@ -0,0 +1,301 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stdlib
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/log"
+)
+
+// A BlobStore stores named blobs of data.
+type BlobStore interface {
+	// Get returns the contents of the named blob. If there is no such blob,
+	// the error wraps derrors.NotFound.
+	Get(ctx context.Context, name string) ([]byte, error)
+	// Put stores data as the named blob, replacing any previous contents.
+	Put(ctx context.Context, name string, data []byte) error
+}
+
+// zipCache holds the zips built by Zip, or is nil. See SetZipCache.
+var zipCache BlobStore
+
+// SetZipCache makes Zip store the zips it builds from the Go repo in bs, and
+// reuse them instead of cloning the repo again. A nil bs turns caching off.
+//
+// The zips are keyed by the Go tag of the version, or, for MasterVersion, by
+// the hash of the commit at the head of master, so that a zip is reused only
+// for the same commit. They do not depend on the module path, so all the
+// modules derived from one clone of the Go repo share them. A zip is used only
+// if it matches the hash recorded with it; otherwise it is rebuilt.
+func SetZipCache(bs BlobStore) {
+	zipCache = bs
+}
+
+// OpenBlobStore returns the BlobStore for location, which is either a URL
+// of the form gs://BUCKET/PREFIX, for the objects of a GCS bucket whose names
+// begin with PREFIX, or the path of a directory.
+func OpenBlobStore(ctx context.Context, location string) (_ BlobStore, err error) {
+	defer derrors.Wrap(&err, "OpenBlobStore(ctx, %q)", location)
+
+	if strings.HasPrefix(location, "gs://") {
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, err
+		}
+		client, err := storage.NewClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return NewGCSStore(client, u.Host, strings.TrimPrefix(u.Path, "/")), nil
+	}
+	return NewDirStore(location)
+}
+
+// A DirStore is a BlobStore that keeps each blob in a file of a directory.
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore returns a DirStore for dir, creating it if necessary.
+func NewDirStore(dir string) (_ *DirStore, err error) {
+	defer derrors.Wrap(&err, "NewDirStore(%q)", dir)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+// Get implements BlobStore.Get.
+func (s *DirStore) Get(ctx context.Context, name string) (_ []byte, err error) {
+	defer derrors.Wrap(&err, "DirStore.Get(ctx, %q)", name)
+
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%v: %w", err, derrors.NotFound)
+	}
+	return data, err
+}
+
+// Put implements BlobStore.Put. Readers see either the old contents of the
+// blob or the new ones.
+func (s *DirStore) Put(ctx context.Context, name string, data []byte) (err error) {
+	defer derrors.Wrap(&err, "DirStore.Put(ctx, %q)", name)
+
+	f, err := ioutil.TempFile(s.dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(s.dir, name))
+}
+
+// A GCSStore is a BlobStore that keeps each blob in an object of a GCS
+// bucket.
+type GCSStore struct {
+	bucket *storage.BucketHandle
+	prefix string
+}
+
+// NewGCSStore returns a GCSStore for the objects of bucket whose names begin
+// with prefix.
+func NewGCSStore(client *storage.Client, bucket, prefix string) *GCSStore {
+	return &GCSStore{bucket: client.Bucket(bucket), prefix: prefix}
+}
+
+// Get implements BlobStore.Get.
+func (s *GCSStore) Get(ctx context.Context, name string) (_ []byte, err error) {
+	defer derrors.Wrap(&err, "GCSStore.Get(ctx, %q)", name)
+
+	r, err := s.bucket.Object(s.prefix + name).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, fmt.Errorf("%v: %w", err, derrors.NotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// Put implements BlobStore.Put.
+func (s *GCSStore) Put(ctx context.Context, name string, data []byte) (err error) {
+	defer derrors.Wrap(&err, "GCSStore.Put(ctx, %q)", name)
+
+	w := s.bucket.Object(s.prefix + name).NewWriter(ctx)
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// cachedZipInfo describes a zip in the cache. It is stored next to the zip.
+type cachedZipInfo struct {
+	// Version is the resolved version of the zip.
+	Version    string
+	CommitTime time.Time
+	// Hash is the SHA-256 hash of the zip, in hex.
+	Hash string
+}
+
+// cachedZip returns the contents of the zip of the standard library at
+// version, which is a release, a prerelease or MasterVersion, from bs. If it
+// is not there, it builds the zip and stores it in bs. It also returns the
+// commit time and resolved version of the zip. Failures to use bs are
+// logged, and the zip is built instead.
+func cachedZip(ctx context.Context, bs BlobStore, version string) (_ []byte, commitTime time.Time, resolvedVersion string, err error) {
+	key, err := zipCacheKey(version)
+	if err != nil {
+		log.Errorf(ctx, "stdlib zip cache: %v", err)
+	} else {
+		data, info, err := getCachedZip(ctx, bs, key)
+		if err == nil {
+			return data, info.CommitTime, info.Version, nil
+		}
+		if !errors.Is(err, derrors.NotFound) {
+			log.Errorf(ctx, "stdlib zip cache: %v", err)
+		}
+	}
+
+	data, commitTime, resolvedVersion, err := buildZip(version)
+	if err != nil {
+		return nil, time.Time{}, "", err
+	}
+	// Master may have moved since its head was looked up.
+	if key != "" && (version != MasterVersion || key == masterKey(resolvedVersion[strings.LastIndex(resolvedVersion, "-")+1:])) {
+		if err := putCachedZip(ctx, bs, key, data, &cachedZipInfo{Version: resolvedVersion, CommitTime: commitTime}); err != nil {
+			log.Errorf(ctx, "stdlib zip cache: %v", err)
+		}
+	}
+	return data, commitTime, resolvedVersion, nil
+}
+
+// zipCacheKey returns the name of the zip of version in the cache, without
+// an extension: the Go tag of a release or prerelease, or a name made from
+// the hash of the head of master for MasterVersion.
+func zipCacheKey(version string) (_ string, err error) {
+	defer derrors.Wrap(&err, "zipCacheKey(%q)", version)
+
+	if version != MasterVersion {
+		return TagForVersion(version)
+	}
+	hash, err := masterHead()
+	if err != nil {
+		return "", err
+	}
+	return masterKey(hash), nil
+}
+
+// masterKey returns the cache key for the commit of master with the given
+// hash, which may be abbreviated to the 12 characters of a pseudo-version.
+func masterKey(hash string) string {
+	if len(hash) > 12 {
+		hash = hash[:12]
+	}
+	return "master-" + hash
+}
+
+// masterHead returns the hash of the commit at the head of the master branch
+// of the Go repo, without cloning it.
+func masterHead() (_ string, err error) {
+	if UseTestData {
+		repo, err := getTestGoRepo(MasterVersion)
+		if err != nil {
+			return "", err
+		}
+		head, err := repo.Head()
+		if err != nil {
+			return "", err
+		}
+		return head.Hash().String(), nil
+	}
+	re := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		URLs: []string{GoRepoURL},
+	})
+	refs, err := re.List(&git.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	for _, r := range refs {
+		if r.Name() == plumbing.NewBranchReferenceName("master") {
+			return r.Hash().String(), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no master branch", GoRepoURL)
+}
+
+// getCachedZip returns the zip with the given key from bs, and its info,
+// after checking that it matches the hash in its info.
+func getCachedZip(ctx context.Context, bs BlobStore, key string) (_ []byte, _ *cachedZipInfo, err error) {
+	defer derrors.Wrap(&err, "getCachedZip(ctx, bs, %q)", key)
+
+	infoData, err := bs.Get(ctx, key+".info")
+	if err != nil {
+		return nil, nil, err
+	}
+	var info cachedZipInfo
+	if err := json.Unmarshal(infoData, &info); err != nil {
+		return nil, nil, err
+	}
+	data, err := bs.Get(ctx, key+".zip")
+	if err != nil {
+		return nil, nil, err
+	}
+	if got := zipHash(data); got != info.Hash {
+		return nil, nil, fmt.Errorf("zip has hash %s, want %s", got, info.Hash)
+	}
+	if _, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err != nil {
+		return nil, nil, err
+	}
+	return data, &info, nil
+}
+
+// putCachedZip stores the zip data with the given key in bs, along with
+// info, whose hash it sets. The zip is stored first, so that its info never
+// describes a zip that was not stored.
+func putCachedZip(ctx context.Context, bs BlobStore, key string, data []byte, info *cachedZipInfo) (err error) {
+	defer derrors.Wrap(&err, "putCachedZip(ctx, bs, %q)", key)
+
+	info.Hash = zipHash(data)
+	infoData, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := bs.Put(ctx, key+".zip", data); err != nil {
+		return err
+	}
+	return bs.Put(ctx, key+".info", infoData)
+}
+
+func zipHash(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stdlib
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+func TestZipCache(t *testing.T) {
+	ctx := context.Background()
+	UseTestData = true
+	defer func() { UseTestData = false }()
+	const version = "v1.14.6"
+	uncached, _, _, err := Zip(version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "stdlib-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bs, err := NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetZipCache(bs)
+	defer SetZipCache(nil)
+
+	// The first Zip builds the zip and stores it.
+	zr, gotTime, resolvedVersion, err := Zip(version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolvedVersion != version || !gotTime.Equal(TestCommitTime) {
+		t.Errorf("got %s, %s, want %s, %s", resolvedVersion, gotTime, version, TestCommitTime)
+	}
+	if diff := cmp.Diff(zipFileNames(uncached), zipFileNames(zr)); diff != "" {
+		t.Errorf("files mismatch (-want +got):\n%s", diff)
+	}
+	if _, _, err := getCachedZip(ctx, bs, "go1.14.6"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Later Zips reuse the stored zip, which is replaced here to tell it apart.
+	fake := fakeZip(t, "std@"+version+"/FAKE")
+	if err := putCachedZip(ctx, bs, "go1.14.6", fake, &cachedZipInfo{Version: version, CommitTime: TestCommitTime}); err != nil {
+		t.Fatal(err)
+	}
+	zr, _, _, err = Zip("go1.14.6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"std@" + version + "/FAKE"}, zipFileNames(zr)); diff != "" {
+		t.Errorf("files mismatch (-want +got):\n%s", diff)
+	}
+
+	// A zip that does not match its hash is rebuilt.
+	if err := bs.Put(ctx, "go1.14.6.zip", fakeZip(t, "std@"+version+"/CORRUPT")); err != nil {
+		t.Fatal(err)
+	}
+	zr, _, _, err = Zip(version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(zipFileNames(uncached), zipFileNames(zr)); diff != "" {
+		t.Errorf("files mismatch (-want +got):\n%s", diff)
+	}
+	if _, _, err := getCachedZip(ctx, bs, "go1.14.6"); err != nil {
+		t.Errorf("zip was not stored again: %v", err)
+	}
+}
+
+func TestZipCacheMaster(t *testing.T) {
+	ctx := context.Background()
+	UseTestData = true
+	defer func() { UseTestData = false }()
+	dir, err := ioutil.TempDir("", "stdlib-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bs, err := NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetZipCache(bs)
+	defer SetZipCache(nil)
+
+	_, _, resolvedVersion, err := Zip(MasterVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := masterHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, info, err := getCachedZip(ctx, bs, masterKey(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != resolvedVersion {
+		t.Errorf("cached version %q, want %q", info.Version, resolvedVersion)
+	}
+	// The pseudo-version of the head of master is found in the cache too.
+	if _, _, got, err := Zip(resolvedVersion); err != nil || got != resolvedVersion {
+		t.Errorf("Zip(%q) = %q, %v, want %q, nil", resolvedVersion, got, err, resolvedVersion)
+	}
+
+	// So is an older snapshot, which can no longer be read from the repo.
+	data, _, err := getCachedZip(ctx, bs, masterKey(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := "v0.0.0-20180101000000-8ea2fd3b7e95"
+	if err := putCachedZip(ctx, bs, masterKey("8ea2fd3b7e95"), data, &cachedZipInfo{Version: old, CommitTime: TestCommitTime}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, got, err := Zip(old); err != nil || got != old {
+		t.Errorf("Zip(%q) = %q, %v, want %q, nil", old, got, err, old)
+	}
+}
+
+func TestDirStoreNotFound(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stdlib-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bs, err := NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bs.Get(context.Background(), "go1.14.6.zip"); !errors.Is(err, derrors.NotFound) {
+		t.Errorf("got error %v, want NotFound", err)
+	}
+}
+
+// fakeZip returns the contents of a zip file holding an empty file with the
+// given name.
+func fakeZip(t *testing.T, name string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	if _, err := z.Create(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
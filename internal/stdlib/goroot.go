@@ -0,0 +1,170 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stdlib
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// local is the Go installation that Zip and Versions read the standard
+// library from instead of the Go repo, or nil. See UseGOROOT.
+var local *goroot
+
+// A goroot is a Go installation holding the standard library at a single
+// version.
+type goroot struct {
+	dir     string
+	version string
+}
+
+// LocalGOROOT returns the GOROOT of the go command on the PATH, as reported
+// by "go env GOROOT".
+func LocalGOROOT() (_ string, err error) {
+	defer derrors.Wrap(&err, "LocalGOROOT()")
+
+	out, err := exec.Command("go", "env", "GOROOT").Output()
+	if err != nil {
+		return "", err
+	}
+	dir := strings.TrimSpace(string(out))
+	if dir == "" {
+		return "", fmt.Errorf("go env GOROOT is empty")
+	}
+	return dir, nil
+}
+
+// UseGOROOT makes Zip and Versions read the standard library from the Go
+// installation in dir, such as the one returned by LocalGOROOT, instead of
+// downloading the Go repo. The standard library then has the single version
+// given by runtime.Version, so dir should hold the Go that built this binary.
+func UseGOROOT(dir string) error {
+	return useGOROOT(dir, runtime.Version())
+}
+
+// useGOROOT is UseGOROOT with the Go version, as reported by runtime.Version,
+// given by goVersion.
+func useGOROOT(dir, goVersion string) (err error) {
+	defer derrors.Wrap(&err, "UseGOROOT(%q)", dir)
+
+	// runtime.Version may be followed by the enabled experiments, as in
+	// "go1.16 X:regabi".
+	fields := strings.Fields(goVersion)
+	if len(fields) == 0 {
+		return fmt.Errorf("%w: empty Go version", derrors.InvalidArgument)
+	}
+	v := VersionForTag(fields[0])
+	if v == "" || IsDevelVersion(v) {
+		return fmt.Errorf("%w: Go version %q is not a release or prerelease", derrors.InvalidArgument, goVersion)
+	}
+	libdir := filepath.Join(dir, filepath.FromSlash(Directory(v)))
+	fi, err := os.Stat(libdir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", libdir)
+	}
+	local = &goroot{dir: dir, version: v}
+	return nil
+}
+
+// zip is Zip for the Go installation g. Only its own version is found.
+func (g *goroot) zip(requestedVersion string) (_ *zip.Reader, commitTime time.Time, _ string, err error) {
+	if requestedVersion != "latest" && requestedVersion != g.version && VersionForTag(requestedVersion) != g.version {
+		return nil, time.Time{}, "", fmt.Errorf("%w: the standard library in %s is at %s", derrors.NotFound, g.dir, g.version)
+	}
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	prefixPath := ModulePath + "@" + g.version
+	// Add top-level files.
+	if err := addDirFiles(z, g.dir, prefixPath, false); err != nil {
+		return nil, time.Time{}, "", err
+	}
+	// Add files from the stdlib directory.
+	if err := addDirFiles(z, filepath.Join(g.dir, filepath.FromSlash(Directory(g.version))), prefixPath, true); err != nil {
+		return nil, time.Time{}, "", err
+	}
+	if err := z.Close(); err != nil {
+		return nil, time.Time{}, "", err
+	}
+	br := bytes.NewReader(buf.Bytes())
+	zr, err := zip.NewReader(br, int64(br.Len()))
+	if err != nil {
+		return nil, time.Time{}, "", err
+	}
+	return zr, g.commitTime(), g.version, nil
+}
+
+// commitTime returns the time to use as the commit time of the installation:
+// the modification time of its VERSION file, which is written when the
+// distribution is built, or else that of its stdlib directory.
+func (g *goroot) commitTime() time.Time {
+	for _, name := range []string{"VERSION", Directory(g.version)} {
+		if fi, err := os.Stat(filepath.Join(g.dir, filepath.FromSlash(name))); err == nil {
+			return fi.ModTime().UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// addDirFiles adds the files in dir to z, using dirpath as the path prefix.
+// If recursive is true, it also adds the files in all subdirectories. It
+// skips the same files as addFiles.
+func addDirFiles(z *zip.Writer, dir, dirpath string, recursive bool) (err error) {
+	defer derrors.Wrap(&err, "addDirFiles(zip, %q, %q, %t)", dir, dirpath, recursive)
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		name := fi.Name()
+		if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+			continue
+		}
+		if name == "go.mod" {
+			// ignore; we'll synthesize our own
+			continue
+		}
+		if name == "README.vendor" && !strings.Contains(dirpath, "/") {
+			// See addFiles.
+			continue
+		}
+		switch {
+		case fi.Mode().IsRegular():
+			f, err := os.Open(filepath.Join(dir, name))
+			if err != nil {
+				return err
+			}
+			if err := writeZipFile(z, path.Join(dirpath, name), f); err != nil {
+				_ = f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		case fi.IsDir():
+			if !recursive || name == "testdata" {
+				continue
+			}
+			if err := addDirFiles(z, filepath.Join(dir, name), path.Join(dirpath, name), recursive); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
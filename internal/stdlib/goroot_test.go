@@ -0,0 +1,80 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stdlib
+
+import (
+	"archive/zip"
+	"errors"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/testing/testhelper"
+)
+
+func TestZipGOROOT(t *testing.T) {
+	const version = "v1.14.6"
+	UseTestData = true
+	want, _, _, err := Zip(version)
+	UseTestData = false
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { local = nil }()
+	dir := filepath.Join(testhelper.TestDataPath("testdata"), version)
+	if err := useGOROOT(dir, "go1.14.6 X:framepointer"); err != nil {
+		t.Fatal(err)
+	}
+	vs, err := Versions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{version}, vs); diff != "" {
+		t.Errorf("Versions() mismatch (-want +got):\n%s", diff)
+	}
+	for _, requested := range []string{version, "go1.14.6", "latest"} {
+		got, _, resolvedVersion, err := Zip(requested)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolvedVersion != version {
+			t.Errorf("Zip(%q): resolved version %q, want %q", requested, resolvedVersion, version)
+		}
+		// The zip has the same layout as the one built from the Go repo.
+		if diff := cmp.Diff(zipFileNames(want), zipFileNames(got)); diff != "" {
+			t.Errorf("Zip(%q) files mismatch (-want +got):\n%s", requested, diff)
+		}
+	}
+	for _, requested := range []string{"v1.12.5", MasterVersion} {
+		if _, _, _, err := Zip(requested); !errors.Is(err, derrors.NotFound) {
+			t.Errorf("Zip(%q): got error %v, want NotFound", requested, err)
+		}
+	}
+}
+
+func TestUseGOROOTBadVersion(t *testing.T) {
+	defer func() { local = nil }()
+	dir := filepath.Join(testhelper.TestDataPath("testdata"), "v1.14.6")
+	for _, goVersion := range []string{"", "devel +8ea2fd3b7e Fri Oct 16 15:48:02 2020 +0000"} {
+		if err := useGOROOT(dir, goVersion); !errors.Is(err, derrors.InvalidArgument) {
+			t.Errorf("useGOROOT(%q): got error %v, want InvalidArgument", goVersion, err)
+		}
+	}
+	if local != nil {
+		t.Errorf("got local GOROOT %v, want none", local)
+	}
+}
+
+func zipFileNames(zr *zip.Reader) []string {
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
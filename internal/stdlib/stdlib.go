@@ -11,17 +11,22 @@ package stdlib
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"golang.org/x/mod/semver"
 	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/log"
 	"golang.org/x/pkgsite/internal/testing/testhelper"
 	"golang.org/x/pkgsite/internal/version"
 
@@ -44,16 +49,31 @@ var (
 	// 3  the entire prerelease, if present
 	// 4  the prerelease type ("beta" or "rc")
 	// 5  the prerelease number
-	tagRegexp = regexp.MustCompile(`^go(\d+\.\d+)(\.\d+|)((beta|rc)(\d+))?$`)
+	// Numbers have no leading zeros, so that they are valid in semantic
+	// versions.
+	tagRegexp = regexp.MustCompile(`^go((?:0|[1-9]\d*)\.(?:0|[1-9]\d*))(\.(?:0|[1-9]\d*)|)((beta|rc)([1-9]\d*))?$`)
 )
 
+// firstDotZeroMinor is the first minor version of Go 1 whose initial release
+// is tagged "go1.N.0" instead of "go1.N".
+const firstDotZeroMinor = 21
+
 // VersionForTag returns the semantic version for the Go tag, or "" if
 // tag doesn't correspond to a Go release or beta tag.
 // Examples:
 //   "go1" => "v1.0.0"
 //   "go1.2" => "v1.2.0"
+//   "go1.21.0" => "v1.21.0"
 //   "go1.13beta1" => "v1.13.0-beta.1"
 //   "go1.9rc2" => "v1.9.0-rc.2"
+//
+// The initial release of a minor version may be named either way, so "go1.21"
+// and "go1.2.0" are accepted too. Old-style tags, like "weekly.2012-02-14" and
+// "release.r60", are not Go versions and return "".
+//
+// Development versions, which have no tags, are their own tags:
+//   "master" => "master"
+//   "v0.0.0-20201015204451-8ea2fd3b7e95" => "v0.0.0-20201015204451-8ea2fd3b7e95"
 func VersionForTag(tag string) string {
 	// Special cases for go1.
 	if tag == "go1" {
@@ -66,6 +86,9 @@ func VersionForTag(tag string) string {
 	if tag == "latest" {
 		return "latest"
 	}
+	if IsDevelVersion(tag) {
+		return tag
+	}
 	m := tagRegexp.FindStringSubmatch(tag)
 	if m == nil {
 		return ""
@@ -84,7 +107,10 @@ func VersionForTag(tag string) string {
 
 // TagForVersion returns the Go standard library repository tag corresponding
 // to semver. The Go tags differ from standard semantic versions in a few ways,
-// such as beginning with "go" instead of "v".
+// such as beginning with "go" instead of "v", and the initial release of a
+// minor version before Go 1.21 having no patch version. Development versions,
+// which have no tags, are returned unchanged, as VersionForTag expects.
+// TagForVersion is the inverse of VersionForTag on the versions of Go tags.
 func TagForVersion(version string) (_ string, err error) {
 	defer derrors.Wrap(&err, "TagForVersion(%q)", version)
 
@@ -92,6 +118,9 @@ func TagForVersion(version string) (_ string, err error) {
 	if version == "v1.0.0" {
 		return "go1", nil
 	}
+	if IsDevelVersion(version) {
+		return version, nil
+	}
 	if !semver.IsValid(version) {
 		return "", fmt.Errorf("%w: requested version is not a valid semantic version: %q ", derrors.InvalidArgument, version)
 	}
@@ -99,7 +128,7 @@ func TagForVersion(version string) (_ string, err error) {
 	prerelease := semver.Prerelease(goVersion)
 	versionWithoutPrerelease := strings.TrimSuffix(goVersion, prerelease)
 	patch := strings.TrimPrefix(versionWithoutPrerelease, semver.MajorMinor(goVersion)+".")
-	if patch == "0" {
+	if patch == "0" && (prerelease != "" || !hasDotZeroTag(goVersion)) {
 		versionWithoutPrerelease = strings.TrimSuffix(versionWithoutPrerelease, ".0")
 	}
 
@@ -121,11 +150,52 @@ func TagForVersion(version string) (_ string, err error) {
 	return goVersion, nil
 }
 
+// hasDotZeroTag reports whether the initial release of the minor version of
+// the canonical semantic version v is tagged "goN.M.0".
+func hasDotZeroTag(v string) bool {
+	if semver.Major(v) != "v1" {
+		return false
+	}
+	minor, err := strconv.Atoi(strings.TrimPrefix(semver.MajorMinor(v), "v1."))
+	return err == nil && minor >= firstDotZeroMinor
+}
+
+// LatestVersion returns the version that "latest" refers to among versions:
+// the highest release, or if there are no releases, the highest prerelease.
+// Development versions are never the latest. It returns "" if there is no
+// such version.
+func LatestVersion(versions []string) string {
+	var latest string
+	for _, v := range versions {
+		if IsDevelVersion(v) || !semver.IsValid(v) {
+			continue
+		}
+		if latest == "" {
+			latest = v
+			continue
+		}
+		if isRelease, latestIsRelease := semver.Prerelease(v) == "", semver.Prerelease(latest) == ""; isRelease != latestIsRelease {
+			if isRelease {
+				latest = v
+			}
+			continue
+		}
+		if semver.Compare(v, latest) > 0 {
+			latest = v
+		}
+	}
+	return latest
+}
+
 // MajorVersionForVersion returns the Go major version for version.
-// E.g. "v1.13.3" => "go1".
+// E.g. "v1.13.3" => "go1". Development versions are of the major version
+// that the master branch is developing, "go1".
 func MajorVersionForVersion(version string) (_ string, err error) {
 	defer derrors.Wrap(&err, "MajorVersionForVersion(%q)", version)
 
+	if IsDevelVersion(version) {
+		return "go1", nil
+	}
 	tag, err := TagForVersion(version)
 	if err != nil {
 		return "", err
@@ -161,6 +231,52 @@ const (
 	GoSourceRepoURL = "https://github.com/golang/go"
 )
 
+// MasterVersion is the version of the standard library at the head of the
+// Go repo's master branch.
+const MasterVersion = "master"
+
+// IsDevelVersion reports whether v is a development version of the standard
+// library: MasterVersion, or the pseudo-version of a snapshot of the master
+// branch, which is what MasterVersion resolves to. Releases and prereleases
+// of the standard library are tagged, so they are never pseudo-versions.
+func IsDevelVersion(v string) bool {
+	return v == MasterVersion || version.IsPseudo(v)
+}
+
+// RefForVersion returns the ref of the Go repo at which the standard library
+// has the given version: the tag of a release or prerelease, the master
+// branch for MasterVersion, or the commit hash of a snapshot of master.
+func RefForVersion(v string) (_ string, err error) {
+	defer derrors.Wrap(&err, "RefForVersion(%q)", v)
+
+	switch {
+	case v == MasterVersion:
+		return plumbing.NewBranchReferenceName("master").String(), nil
+	case version.IsPseudo(v):
+		return v[strings.LastIndex(v, "-")+1:], nil
+	default:
+		tag, err := TagForVersion(v)
+		if err != nil {
+			return "", err
+		}
+		return plumbing.NewTagReferenceName(tag).String(), nil
+	}
+}
+
+// pseudoVersion returns the pseudo-version of a snapshot of the master branch
+// at the commit with the given time and hash. Since the pseudo-versions of
+// snapshots are based on v0.0.0, they sort below all releases.
+func pseudoVersion(commitTime time.Time, hash string) string {
+	if len(hash) > 12 {
+		hash = hash[:12]
+	}
+	return fmt.Sprintf("v0.0.0-%s-%s", commitTime.UTC().Format("20060102150405"), hash)
+}
+
+// testMasterDir is the directory in testdata that holds the master branch
+// when UseTestData is true: the same files as the latest release there.
+const testMasterDir = "v1.14.6"
+
 // UseTestData determines whether to really clone the Go repo, or use
 // stripped-down versions of the repo from the testdata directory.
 var UseTestData = false
@@ -168,17 +284,18 @@ var UseTestData = false
 // TestCommitTime is the time used for all commits when UseTestData is true.
 var TestCommitTime = time.Date(2019, 9, 4, 1, 2, 3, 0, time.UTC)
 
-// getGoRepo returns a repo object for the Go repo at version.
+// getGoRepo returns a repo object for the Go repo at version, which is a
+// release, a prerelease or MasterVersion.
 func getGoRepo(version string) (_ *git.Repository, err error) {
 	defer derrors.Wrap(&err, "getGoRepo(%q)", version)
 
-	tag, err := TagForVersion(version)
+	ref, err := RefForVersion(version)
 	if err != nil {
 		return nil, err
 	}
 	return git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
 		URL:           GoRepoURL,
-		ReferenceName: plumbing.NewTagReferenceName(tag),
+		ReferenceName: plumbing.ReferenceName(ref),
 		SingleBranch:  true,
 		Depth:         1,
 		Tags:          git.NoTags,
@@ -189,6 +306,9 @@ func getGoRepo(version string) (_ *git.Repository, err error) {
 func getTestGoRepo(version string) (_ *git.Repository, err error) {
 	defer derrors.Wrap(&err, "getTestGoRepo(%q)", version)
 
+	if version == MasterVersion {
+		version = testMasterDir
+	}
 	fs := osfs.New(filepath.Join(testhelper.TestDataPath("testdata"), version))
 	repo, err := git.Init(memory.NewStorage(), fs)
 	if err != nil {
@@ -216,10 +336,14 @@ func getTestGoRepo(version string) (_ *git.Repository, err error) {
 // Versions returns all the versions of Go that are relevant to the discovery
 // site. These are all release versions (tags of the forms "goN.N" and
 // "goN.N.N", where N is a number) and beta or rc versions (tags of the forms
-// "goN.NbetaN" and "goN.N.NbetaN", and similarly for "rc" replacing "beta").
+// "goN.NbetaN" and "goN.N.NbetaN", and similarly for "rc" replacing "beta"),
+// in descending semver order. After UseGOROOT, the only version is that of the local Go installation.
 func Versions() (_ []string, err error) {
 	defer derrors.Wrap(&err, "Versions()")
 
+	if local != nil {
+		return []string{local.version}, nil
+	}
 	var refNames []plumbing.ReferenceName
 	if UseTestData {
 		refNames = testRefs
@@ -246,43 +370,105 @@ func Versions() (_ []string, err error) {
 			versions = append(versions, v)
 		}
 	}
+	sort.Slice(versions, func(i, j int) bool { return semver.Compare(versions[i], versions[j]) > 0 })
 	return versions, nil
 }
 
 // Directory returns the directory of the standard library relative to the repo root.
 func Directory(version string) string {
 	// For versions older than v1.4.0-beta.1, the stdlib is in src/pkg.
-	if semver.Compare(version, "v1.4.0-beta.1") < 0 {
+	// Development versions are newer than all releases.
+	if !IsDevelVersion(version) && semver.Compare(version, "v1.4.0-beta.1") < 0 {
 		return "src/pkg"
 	}
 	return "src"
 }
 
+// ErrSnapshotGone is the error returned by Zip for a snapshot of master that
+// can no longer be read, because master has moved on. It wraps
+// derrors.NotFound, but the snapshot, if it was stored before, is still good
+// and should be kept.
+var ErrSnapshotGone = fmt.Errorf("%w: snapshot of master is no longer available", derrors.NotFound)
+
 // Zip creates a module zip representing the entire Go standard library at the
 // given version and returns a reader to it. It also returns the time of the
 // commit for that version. The zip file is in module form, with each path
 // prefixed by ModuleName + "@" + version. It also returns the resolved version.
 //
 // Zip reads the standard library at the Go repository tag corresponding to to
-// the given semantic version.
+// the given semantic version. Given MasterVersion, it reads the head of the
+// master branch, and the resolved version is a pseudo-version for that
+// commit. Given such a pseudo-version, it succeeds only if the commit is still
+// the head of master, or if the zip cache holds the zip of the commit;
+// otherwise the error wraps ErrSnapshotGone.
 //
 // Zip ignores go.mod files in the standard library, treating it as if it were a
 // single module named "std" at the given version.
+//
+// If a cache is set with SetZipCache, Zip reuses the zips it has built.
+//
+// After UseGOROOT, Zip reads the files of the local Go installation instead,
+// and only its version, or "latest", can be requested.
 func Zip(requestedVersion string) (_ *zip.Reader, commitTime time.Time, _ string, err error) {
 	// This code taken, with modifications, from
 	// https://github.com/shurcooL/play/blob/master/256/moduleproxy/std/std.go.
 	defer derrors.Wrap(&err, "stdlib.Zip(%q)", requestedVersion)
 
+	if local != nil {
+		return local.zip(requestedVersion)
+	}
+	if zipCache != nil && version.IsPseudo(requestedVersion) {
+		// The zips of snapshots are cached by commit hash, so an older
+		// snapshot may still be there.
+		data, info, err := getCachedZip(context.Background(), zipCache, masterKey(requestedVersion[strings.LastIndex(requestedVersion, "-")+1:]))
+		if err == nil && info.Version == requestedVersion {
+			br := bytes.NewReader(data)
+			zr, err := zip.NewReader(br, int64(br.Len()))
+			if err != nil {
+				return nil, time.Time{}, "", err
+			}
+			return zr, info.CommitTime, info.Version, nil
+		}
+		if err != nil && !errors.Is(err, derrors.NotFound) {
+			log.Errorf(context.Background(), "stdlib zip cache: %v", err)
+		}
+	}
 	resolvedVersion, err := semanticVersion(requestedVersion)
 	if err != nil {
 		return nil, time.Time{}, "", err
 	}
+	var data []byte
+	if zipCache != nil {
+		data, commitTime, resolvedVersion, err = cachedZip(context.Background(), zipCache, resolvedVersion)
+	} else {
+		data, commitTime, resolvedVersion, err = buildZip(resolvedVersion)
+	}
+	if err != nil {
+		return nil, time.Time{}, "", err
+	}
+	if IsDevelVersion(requestedVersion) && requestedVersion != MasterVersion && requestedVersion != resolvedVersion {
+		return nil, time.Time{}, "", fmt.Errorf("%w: %s is not the head of master, which is %s", ErrSnapshotGone, requestedVersion, resolvedVersion)
+	}
+	br := bytes.NewReader(data)
+	zr, err := zip.NewReader(br, int64(br.Len()))
+	if err != nil {
+		return nil, time.Time{}, "", err
+	}
+	return zr, commitTime, resolvedVersion, nil
+}
+
+// buildZip reads the standard library at version, which is a release, a
+// prerelease or MasterVersion, from the Go repo, and returns the contents of
+// its zip, as described for Zip. It also returns the commit time and the
+// resolved version.
+func buildZip(version string) (_ []byte, commitTime time.Time, resolvedVersion string, err error) {
+	defer derrors.Wrap(&err, "buildZip(%q)", version)
 
 	var repo *git.Repository
 	if UseTestData {
-		repo, err = getTestGoRepo(resolvedVersion)
+		repo, err = getTestGoRepo(version)
 	} else {
-		repo, err = getGoRepo(resolvedVersion)
+		repo, err = getGoRepo(version)
 	}
 	if err != nil {
 		return nil, time.Time{}, "", err
@@ -301,6 +487,10 @@ func Zip(requestedVersion string) (_ *zip.Reader, commitTime time.Time, _ string
 	if err != nil {
 		return nil, time.Time{}, "", err
 	}
+	resolvedVersion = version
+	if version == MasterVersion {
+		resolvedVersion = pseudoVersion(commit.Committer.When, commit.Hash.String())
+	}
 	prefixPath := ModulePath + "@" + resolvedVersion
 	// Add top-level files.
 	if err := addFiles(z, repo, root, prefixPath, false); err != nil {
@@ -320,37 +510,32 @@ func Zip(requestedVersion string) (_ *zip.Reader, commitTime time.Time, _ string
 	if err := z.Close(); err != nil {
 		return nil, time.Time{}, "", err
 	}
-	br := bytes.NewReader(buf.Bytes())
-	zr, err := zip.NewReader(br, int64(br.Len()))
-	if err != nil {
-		return nil, time.Time{}, "", err
-	}
-	return zr, commit.Committer.When, resolvedVersion, nil
+	return buf.Bytes(), commit.Committer.When, resolvedVersion, nil
 }
 
 // semanticVersion returns the semantic version corresponding to the
-// requestedVersion.
+// requestedVersion, which may also be a Go tag like "go1.16rc1". Development
+// versions resolve to MasterVersion, since they can only be read from the
+// head of master.
 func semanticVersion(requestedVersion string) (_ string, err error) {
 	defer derrors.Wrap(&err, "semanticVersion(%q)", requestedVersion)
 
+	if IsDevelVersion(requestedVersion) {
+		return MasterVersion, nil
+	}
+	if strings.HasPrefix(requestedVersion, "go") {
+		if v := VersionForTag(requestedVersion); v != "" {
+			requestedVersion = v
+		}
+	}
 	knownVersions, err := Versions()
 	if err != nil {
 		return "", err
 	}
 	if requestedVersion == "latest" {
-		var latestVersion string
-		for _, v := range knownVersions {
-			versionType, err := version.ParseType(v)
-			if err != nil {
-				return "", err
-			}
-			if versionType != version.TypeRelease {
-				// We expect there to always be at least 1 release version.
-				continue
-			}
-			if semver.Compare(v, latestVersion) > 0 {
-				latestVersion = v
-			}
+		latestVersion := LatestVersion(knownVersions)
+		if latestVersion == "" {
+			return "", fmt.Errorf("%w: no versions", derrors.NotFound)
 		}
 		return latestVersion, nil
 	}
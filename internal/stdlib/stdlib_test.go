@@ -5,12 +5,15 @@
 package stdlib
 
 import (
+	"errors"
 	"io/ioutil"
 	"reflect"
 	"strings"
 	"testing"
 
 	"golang.org/x/mod/semver"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/version"
 )
 
 func TestTagForVersion(t *testing.T) {
@@ -55,6 +58,56 @@ func TestTagForVersion(t *testing.T) {
 			version: "v1.13.0",
 			want:    "go1.13",
 		},
+		{
+			name:    "v1.20.0, before .0 tags",
+			version: "v1.20.0",
+			want:    "go1.20",
+		},
+		{
+			name:    "v1.20.14",
+			version: "v1.20.14",
+			want:    "go1.20.14",
+		},
+		{
+			name:    "v1.21.0, with a .0 tag",
+			version: "v1.21.0",
+			want:    "go1.21.0",
+		},
+		{
+			name:    "v1.21, incomplete canonical version with a .0 tag",
+			version: "v1.21",
+			want:    "go1.21.0",
+		},
+		{
+			name:    "v1.21.0-rc.2",
+			version: "v1.21.0-rc.2",
+			want:    "go1.21rc2",
+		},
+		{
+			name:    "v1.22.0-beta.1",
+			version: "v1.22.0-beta.1",
+			want:    "go1.22beta1",
+		},
+		{
+			name:    "v1.21.3",
+			version: "v1.21.3",
+			want:    "go1.21.3",
+		},
+		{
+			name:    "v2.0.0",
+			version: "v2.0.0",
+			want:    "go2.0",
+		},
+		{
+			name:    "master",
+			version: "master",
+			want:    "master",
+		},
+		{
+			name:    "snapshot of master",
+			version: "v0.0.0-20201015204451-8ea2fd3b7e95",
+			want:    "v0.0.0-20201015204451-8ea2fd3b7e95",
+		},
 		{
 			name:    "bad std semver",
 			version: "v1.x",
@@ -100,6 +153,8 @@ func TestMajorVersionForVersion(t *testing.T) {
 		{"v1.13.3", "go1"},
 		{"v1.9.0-rc.2", "go1"},
 		{"v2.1.3", "go2"},
+		{"master", "go1"},
+		{"v0.0.0-20201015204451-8ea2fd3b7e95", "go1"},
 	} {
 		got, err := MajorVersionForVersion(test.in)
 		if (err != nil) != (test.want == "") {
@@ -174,6 +229,77 @@ func TestZip(t *testing.T) {
 	}
 }
 
+func TestZipMaster(t *testing.T) {
+	UseTestData = true
+	defer func() { UseTestData = false }()
+
+	_, gotTime, resolvedVersion, err := Zip(MasterVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotTime.Equal(TestCommitTime) {
+		t.Errorf("commit time: got %s, want %s", gotTime, TestCommitTime)
+	}
+	if !version.IsPseudo(resolvedVersion) || !strings.HasPrefix(resolvedVersion, "v0.0.0-20190904010203-") {
+		t.Fatalf("got resolved version %q, want a pseudo-version for the commit", resolvedVersion)
+	}
+	// The snapshot can be read by its pseudo-version while it is the head of
+	// master, but older snapshots can't.
+	if _, _, got, err := Zip(resolvedVersion); err != nil || got != resolvedVersion {
+		t.Errorf("Zip(%q) = %q, %v, want %q, nil", resolvedVersion, got, err, resolvedVersion)
+	}
+	old := "v0.0.0-20180101000000-8ea2fd3b7e95"
+	if _, _, _, err := Zip(old); !errors.Is(err, ErrSnapshotGone) || !errors.Is(err, derrors.NotFound) {
+		t.Errorf("Zip(%q): got error %v, want ErrSnapshotGone, which is NotFound", old, err)
+	}
+}
+
+func TestZipTag(t *testing.T) {
+	UseTestData = true
+	defer func() { UseTestData = false }()
+
+	_, _, resolvedVersion, err := Zip("go1.12.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "v1.12.5"; resolvedVersion != want {
+		t.Errorf("got resolved version %q, want %q", resolvedVersion, want)
+	}
+}
+
+func TestRefForVersion(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"v1.12.5", "refs/tags/go1.12.5"},
+		{"v1.13.0-beta.1", "refs/tags/go1.13beta1"},
+		{"master", "refs/heads/master"},
+		{"v0.0.0-20201015204451-8ea2fd3b7e95", "8ea2fd3b7e95"},
+	} {
+		got, err := RefForVersion(test.in)
+		if err != nil || got != test.want {
+			t.Errorf("RefForVersion(%q) = %q, %v, want %q, nil", test.in, got, err, test.want)
+		}
+	}
+	if _, err := RefForVersion("v1.x"); err == nil {
+		t.Error("RefForVersion(\"v1.x\"): got nil error, want error")
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"v1.3.2", "src/pkg"},
+		{"v1.4.0", "src"},
+		{"v0.0.0-20201015204451-8ea2fd3b7e95", "src"},
+	} {
+		if got := Directory(test.in); got != test.want {
+			t.Errorf("Directory(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
 func TestVersions(t *testing.T) {
 	UseTestData = true
 	defer func() { UseTestData = false }()
@@ -197,6 +323,11 @@ func TestVersions(t *testing.T) {
 			t.Errorf("missing %s", w)
 		}
 	}
+	for i := 1; i < len(got); i++ {
+		if semver.Compare(got[i-1], got[i]) <= 0 {
+			t.Errorf("versions not in descending order: %s before %s", got[i-1], got[i])
+		}
+	}
 }
 
 func TestVersionForTag(t *testing.T) {
@@ -210,10 +341,37 @@ func TestVersionForTag(t *testing.T) {
 		{"go1.9.7", "v1.9.7"},
 		{"go2.0", "v2.0.0"},
 		{"go1.9rc2", "v1.9.0-rc.2"},
+		{"go1.0.1", "v1.0.1"},
+		{"go1.2.0", "v1.2.0"},
+		{"go1.20", "v1.20.0"},
+		{"go1.20.14", "v1.20.14"},
+		{"go1.21", "v1.21.0"},
+		{"go1.21.0", "v1.21.0"},
+		{"go1.21.3", "v1.21.3"},
+		{"go1.21rc2", "v1.21.0-rc.2"},
+		{"go1.22beta1", "v1.22.0-beta.1"},
+		{"go1.8.5rc5", "v1.8.5-rc.5"},
 		{"go1.1beta", ""},
 		{"go1.0", ""},
+		{"go1.09", ""},
+		{"go1.9.07", ""},
+		{"go1.9rc0", ""},
+		{"go1.9rc01", ""},
+		{"go1.21alpha1", ""},
+		{"go1.21.0.1", ""},
+		{"go1.21-rc2", ""},
+		{"go1.21rc2-custom", ""},
+		{"v1.21.0", ""},
+		{"1.21.0", ""},
 		{"weekly.2012-02-14", ""},
+		{"weekly", ""},
+		{"release.r60", ""},
+		{"release.r60.3", ""},
+		{"release", ""},
 		{"latest", "latest"},
+		{"master", "master"},
+		{"v0.0.0-20201015204451-8ea2fd3b7e95", "v0.0.0-20201015204451-8ea2fd3b7e95"},
+		{"v0.0.0-2020", ""},
 	} {
 		got := VersionForTag(tc.in)
 		if got != tc.want {
@@ -222,6 +380,47 @@ func TestVersionForTag(t *testing.T) {
 	}
 }
 
+// TestVersionTagRoundTrip checks that TagForVersion inverts VersionForTag on
+// the canonical tags of each kind.
+func TestVersionTagRoundTrip(t *testing.T) {
+	for _, tag := range []string{
+		"go1", "go1.0.3", "go1.1", "go1.13beta1", "go1.9rc2", "go1.20", "go1.20.14",
+		"go1.21.0", "go1.21.3", "go1.21rc2", "go1.22beta1", "go1.8.5rc5",
+	} {
+		v := VersionForTag(tag)
+		if v == "" {
+			t.Errorf("VersionForTag(%q) = \"\"", tag)
+			continue
+		}
+		got, err := TagForVersion(v)
+		if err != nil || got != tag {
+			t.Errorf("TagForVersion(VersionForTag(%q)) = %q, %v, want %q, nil", tag, got, err, tag)
+		}
+	}
+}
+
+func TestLatestVersion(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		versions []string
+		want     string
+	}{
+		{"none", nil, ""},
+		{"release over higher rc", []string{"v1.20.14", "v1.21.0-rc.2", "v1.21.0-rc.1"}, "v1.20.14"},
+		{"release over its rcs", []string{"v1.21.0-rc.2", "v1.21.0", "v1.21.0-rc.1"}, "v1.21.0"},
+		{"point release", []string{"v1.21.0", "v1.20.14", "v1.21.1", "v1.22.0-beta.1"}, "v1.21.1"},
+		{"only prereleases", []string{"v1.21.0-rc.1", "v1.21.0-beta.1", "v1.21.0-rc.2"}, "v1.21.0-rc.2"},
+		{"not devel", []string{"master", "v0.0.0-20201015204451-8ea2fd3b7e95", "v1.15.3"}, "v1.15.3"},
+		{"only devel", []string{"master"}, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := LatestVersion(test.versions); got != test.want {
+				t.Errorf("LatestVersion(%q) = %q, want %q", test.versions, got, test.want)
+			}
+		})
+	}
+}
+
 func TestContains(t *testing.T) {
 	for _, test := range []struct {
 		in   string
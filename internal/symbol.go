@@ -0,0 +1,129 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"go/token"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// A SymbolIntroduction records that a symbol of a package appeared in a
+// version of its module, for a build context, and has been in every release
+// version of the module since, up to the next introduction of the same
+// symbol, if any. A symbol that is removed and later restored has one
+// introduction for each time it appeared.
+type SymbolIntroduction struct {
+	Version string
+	GOOS    string
+	GOARCH  string
+}
+
+// SymbolHistory maps the names of the symbols of a package, as in
+// Documentation.Symbols, to their introductions, in increasing order of
+// version.
+//
+// Only release versions are part of the history. Symbols of the earliest
+// release version of the module that has the package have no introductions,
+// because they are as old as the package.
+type SymbolHistory map[string][]*SymbolIntroduction
+
+// IntroducedIn returns the version that introduced the symbol with the given
+// name, as of version, in the documentation for goos and goarch. It returns
+// the empty string if the symbol has been in the package since the package's
+// earliest release version.
+//
+// If the symbol has no introductions for goos/goarch, those of the build
+// context that best matches it are used, as in Unit.DocumentationFor.
+func (h SymbolHistory) IntroducedIn(name, goos, goarch, version string) string {
+	intros := h[name]
+	// Choose the build context as DocumentationFor does.
+	var best *Documentation
+	for _, in := range intros {
+		d := &Documentation{GOOS: in.GOOS, GOARCH: in.GOARCH}
+		if best == nil {
+			best = d
+			continue
+		}
+		ds, bs := buildContextScore(d.GOOS, d.GOARCH, goos, goarch), buildContextScore(best.GOOS, best.GOARCH, goos, goarch)
+		if ds > bs || (ds == bs && buildContextRank(d) < buildContextRank(best)) {
+			best = d
+		}
+	}
+	var v string
+	for _, in := range intros {
+		if in.GOOS != best.GOOS || in.GOARCH != best.GOARCH {
+			continue
+		}
+		if semver.Compare(in.Version, version) <= 0 && semver.Compare(in.Version, v) > 0 {
+			v = in.Version
+		}
+	}
+	return v
+}
+
+// A SymbolQuery is a search query for the symbols of packages.
+type SymbolQuery struct {
+	// Name is the name of the symbol, which may be qualified by its type,
+	// like "Client.Do".
+	Name string
+	// PackageName, if non-empty, is the name of the package of the symbol,
+	// as in the query "json.Unmarshal".
+	PackageName string
+	// PackageTerms are strings that the path of the package of the symbol
+	// must contain, as in the query "#Reader io".
+	PackageTerms []string
+	// Explicit reports whether the query starts with "#", which asks for
+	// symbols only.
+	Explicit bool
+}
+
+// ParseSymbolQuery reports whether the search query q looks like an
+// identifier, and if so returns the SymbolQuery for it.
+//
+// A query looks like an identifier if it is a single word that is either
+// capitalized, like "Unmarshal", or contains a dot, like "Client.Do". If
+// the word starts with a lower-case identifier followed by a dot, like
+// "json.Unmarshal", the identifier is the name of the package.
+//
+// A query that starts with "#", like "#Reader io", is always a symbol
+// query. The first word, without the "#", is the symbol, and the other
+// words must all be part of the path of its package.
+func ParseSymbolQuery(q string) (_ *SymbolQuery, ok bool) {
+	words := strings.Fields(q)
+	if len(words) == 0 {
+		return nil, false
+	}
+	sq := &SymbolQuery{}
+	word := words[0]
+	if strings.HasPrefix(word, "#") {
+		sq.Explicit = true
+		word = word[1:]
+		sq.PackageTerms = words[1:]
+	} else if len(words) > 1 {
+		return nil, false
+	}
+	parts := strings.Split(word, ".")
+	for _, p := range parts {
+		if !token.IsIdentifier(p) {
+			return nil, false
+		}
+	}
+	if len(parts) > 1 && !token.IsExported(parts[0]) {
+		sq.PackageName = parts[0]
+		parts = parts[1:]
+	}
+	switch {
+	case len(parts) > 2:
+		return nil, false
+	case len(parts) == 1 && sq.PackageName == "" && !sq.Explicit && !token.IsExported(parts[0]):
+		// A lower-case word, like "errors", is more likely to be a search
+		// for a package.
+		return nil, false
+	}
+	sq.Name = strings.Join(parts, ".")
+	return sq, true
+}
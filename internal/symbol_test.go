@@ -0,0 +1,75 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIntroducedIn(t *testing.T) {
+	h := SymbolHistory{
+		// Removed in v1.2.0 and restored in v1.3.0.
+		"F": {
+			{Version: "v1.1.0", GOOS: "linux", GOARCH: "amd64"},
+			{Version: "v1.3.0", GOOS: "linux", GOARCH: "amd64"},
+		},
+		// Added on windows later than elsewhere.
+		"T.M": {
+			{Version: "v1.1.0", GOOS: "linux", GOARCH: "amd64"},
+			{Version: "v1.1.0", GOOS: "darwin", GOARCH: "amd64"},
+			{Version: "v1.2.0", GOOS: "windows", GOARCH: "amd64"},
+		},
+	}
+	for _, test := range []struct {
+		name, goos, goarch, version, want string
+	}{
+		{"F", "linux", "amd64", "v1.0.0", ""},
+		{"F", "linux", "amd64", "v1.1.0", "v1.1.0"},
+		{"F", "linux", "amd64", "v1.2.5", "v1.1.0"},
+		{"F", "linux", "amd64", "v1.3.0", "v1.3.0"},
+		{"F", "windows", "amd64", "v1.4.0", "v1.3.0"}, // falls back to linux/amd64
+		{"T.M", "windows", "amd64", "v1.4.0", "v1.2.0"},
+		{"T.M", "darwin", "amd64", "v1.4.0", "v1.1.0"},
+		{"T.M", "windows", "", "v1.4.0", "v1.2.0"},
+		{"T.M", "", "", "v1.4.0", "v1.1.0"},
+		{"G", "linux", "amd64", "v1.4.0", ""},
+	} {
+		if got := h.IntroducedIn(test.name, test.goos, test.goarch, test.version); got != test.want {
+			t.Errorf("IntroducedIn(%q, %q, %q, %q) = %q, want %q",
+				test.name, test.goos, test.goarch, test.version, got, test.want)
+		}
+	}
+}
+
+func TestParseSymbolQuery(t *testing.T) {
+	for _, test := range []struct {
+		q    string
+		want *SymbolQuery
+	}{
+		{"Unmarshal", &SymbolQuery{Name: "Unmarshal"}},
+		{"Client.Do", &SymbolQuery{Name: "Client.Do"}},
+		{"json.Unmarshal", &SymbolQuery{Name: "Unmarshal", PackageName: "json"}},
+		{"http.Client.Do", &SymbolQuery{Name: "Client.Do", PackageName: "http"}},
+		{"#Reader io", &SymbolQuery{Name: "Reader", PackageTerms: []string{"io"}, Explicit: true}},
+		{"#reader", &SymbolQuery{Name: "reader", PackageTerms: []string{}, Explicit: true}},
+		{"errors", nil},
+		{"Unmarshal json", nil},
+		{"github.com/a/b", nil},
+		{"A.B.C", nil},
+		{"#", nil},
+		{"", nil},
+	} {
+		got, ok := ParseSymbolQuery(test.q)
+		if ok != (test.want != nil) {
+			t.Errorf("ParseSymbolQuery(%q): got ok = %t, want %t", test.q, ok, test.want != nil)
+			continue
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("ParseSymbolQuery(%q) mismatch (-want +got):\n%s", test.q, diff)
+		}
+	}
+}
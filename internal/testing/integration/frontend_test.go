@@ -193,8 +193,8 @@ func setupFrontend(ctx context.Context, t *testing.T, q queue.Queue) *httptest.S
 	mw := middleware.Chain(
 		middleware.AcceptRequests(http.MethodGet, http.MethodPost),
 		middleware.SecureHeaders(),
-		middleware.LatestVersions(s.GetLatestMinorVersion, s.GetLatestMajorVersion),
-		middleware.Experiment(experimenter),
+		middleware.LatestVersions(s.GetLatestMinorVersion),
+		middleware.Experiment(experimenter, 0),
 	)
 	return httptest.NewServer(mw(mux))
 }
@@ -68,13 +68,6 @@ func TestEndToEndProcessing(t *testing.T) {
 	defer redisCache.Close()
 	redisCacheClient := redis.NewClient(&redis.Options{Addr: redisCache.Addr()})
 
-	redisHA, err := miniredis.Run()
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer redisHA.Close()
-	redisHAClient := redis.NewClient(&redis.Options{Addr: redisHA.Addr()})
-
 	// TODO: it would be better if InMemory made http requests
 	// back to worker, rather than calling fetch itself.
 	sourceClient := source.NewClient(1 * time.Second)
@@ -86,7 +79,6 @@ func TestEndToEndProcessing(t *testing.T) {
 		IndexClient:          indexClient,
 		ProxyClient:          proxyClient,
 		SourceClient:         source.NewClient(1 * time.Second),
-		RedisHAClient:        redisHAClient,
 		RedisCacheClient:     redisCacheClient,
 		Queue:                queue,
 		TaskIDChangeInterval: 10 * time.Minute,
@@ -102,7 +94,6 @@ func TestEndToEndProcessing(t *testing.T) {
 	frontendServer, err := frontend.NewServer(frontend.ServerConfig{
 		DataSourceGetter:     func(context.Context) internal.DataSource { return testDB },
 		Queue:                queue,
-		CompletionClient:     redisHAClient,
 		TaskIDChangeInterval: 10 * time.Minute,
 		StaticPath:           template.TrustedSourceFromConstant("../../../content/static"),
 		ThirdPartyPath:       "../../../third_party",
@@ -135,11 +126,8 @@ func TestEndToEndProcessing(t *testing.T) {
 		t.Error("Documentation constant 525600 not found in body")
 	}
 
-	// Populate the auto-completion indexes from the search documents that should
-	// have been inserted above.
-	if _, err := doGet(workerHTTP.URL + "/update-redis-indexes"); err != nil {
-		t.Fatal(err)
-	}
+	// Completions are read from the search documents that should have been
+	// inserted above.
 	completionBody, err := doGet(frontendHTTP.URL + "/autocomplete?q=foo")
 	if err != nil {
 		t.Fatal(err)
@@ -109,15 +109,15 @@ func DirectoryHeader(p *Page, versionedURL bool) htmlcheck.Checker {
 
 // SubdirectoriesDetails checks the detail section of a subdirectories tab.
 // If firstHref isn't empty, it and firstText should exactly match
-// href and text of the first link in the Directories table.
+// href and text of the first link in the Directories tree.
 func SubdirectoriesDetails(firstHref, firstText string) htmlcheck.Checker {
 	var link htmlcheck.Checker
 	if firstHref != "" {
-		link = in("table.Directories a", href(firstHref), exactText(firstText))
+		link = in(".Directories-tree a", href(firstHref), exactText(firstText))
 	}
 	return in("",
-		in("th:nth-child(1)", text("^Path$")),
-		in("th:nth-child(2)", text("^Synopsis$")),
+		in(".Directories-header .Directories-path", text("^Path$")),
+		in(".Directories-header .Directories-synopsis", text("^Synopsis$")),
 		link)
 }
 
@@ -17,6 +17,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/google/licensecheck"
+	"github.com/google/safehtml"
 	"github.com/google/safehtml/template"
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/licenses"
@@ -62,13 +63,32 @@ var (
 	GOOS              = "linux"
 	GOARCH            = "amd64"
 	Documentation     = &internal.Documentation{
-		Synopsis: Synopsis,
-		HTML:     DocumentationHTML,
-		GOOS:     GOOS,
-		GOARCH:   GOARCH,
+		Synopsis:     Synopsis,
+		FullSynopsis: Synopsis,
+		HTML:         DocumentationHTML,
+		GOOS:         GOOS,
+		GOARCH:       GOARCH,
 	}
 )
 
+// SecurityPolicyContents are the contents of a SECURITY.md file, for use with
+// modules created with WithSecurityPolicy.
+var SecurityPolicyContents = "Report vulnerabilities to security@example.com"
+
+// OFLLicenseMetadata is a variant of LicenseMetadata for a module that is
+// licensed under the SIL Open Font License, as modules that embed fonts often
+// are.
+var OFLLicenseMetadata = []*licenses.Metadata{
+	{
+		Types:    []string{"OFL-1.1"},
+		FilePath: "LICENSE",
+		Coverage: licensecheck.Coverage{
+			Percent: 100,
+			Match:   []licensecheck.Match{{Name: "OFL-1.1", Type: licensecheck.Other, Percent: 100}},
+		},
+	},
+}
+
 // LicenseCmpOpts are options to use when comparing licenses with the cmp package.
 var LicenseCmpOpts = []cmp.Option{
 	cmp.Comparer(coveragePercentEqual),
@@ -116,6 +136,15 @@ func LegacyPackage(modulePath, suffix string) *internal.LegacyPackage {
 	}
 }
 
+// LegacyPackageWithBuildFailure constructs a package like LegacyPackage, but
+// whose documentation could not be generated for the given reason.
+func LegacyPackageWithBuildFailure(modulePath, suffix, reason string) *internal.LegacyPackage {
+	p := LegacyPackage(modulePath, suffix)
+	p.DocumentationHTML = safehtml.HTML{}
+	p.BuildFailureReason = reason
+	return p
+}
+
 func PackageMeta(fullPath string) *internal.PackageMeta {
 	return &internal.PackageMeta{
 		Path:              fullPath,
@@ -168,6 +197,7 @@ func DefaultVersionMap() *internal.VersionMap {
 		Status:           http.StatusOK,
 		GoModPath:        "",
 		Error:            "",
+		ErrorCode:        "",
 	}
 }
 
@@ -194,6 +224,55 @@ func Module(modulePath, version string, suffixes ...string) *internal.Module {
 	return m
 }
 
+// A ModuleOption modifies a Module constructed by ModuleWithOptions.
+type ModuleOption func(*internal.Module)
+
+// WithSecurityPolicy returns a ModuleOption that marks the module as having a
+// SECURITY.md file at its root.
+func WithSecurityPolicy() ModuleOption {
+	return func(m *internal.Module) {
+		m.HasSecurityPolicy = true
+		for _, u := range m.Units {
+			u.HasSecurityPolicy = true
+		}
+	}
+}
+
+// WithRetractedVersions returns a ModuleOption that makes the module's go.mod
+// file retract rvs.
+func WithRetractedVersions(rvs ...internal.RetractedVersion) ModuleOption {
+	return func(m *internal.Module) {
+		m.RetractedVersions = append(m.RetractedVersions, rvs...)
+	}
+}
+
+// RetractWithRationale returns a RetractedVersion for a go.mod line of the
+// form
+//   retract version // rationale
+func RetractWithRationale(version, rationale string) internal.RetractedVersion {
+	return internal.RetractedVersion{Version: version, Rationale: rationale}
+}
+
+// ModuleWithOptions is like Module, but applies opts to the module after it
+// is constructed.
+func ModuleWithOptions(modulePath, version string, suffixes []string, opts ...ModuleOption) *internal.Module {
+	m := Module(modulePath, version, suffixes...)
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// LargeModule creates a Module with the given path and version, and
+// numPackages packages, with suffixes "p0", "p1" and so on.
+func LargeModule(modulePath, version string, numPackages int) *internal.Module {
+	var suffixes []string
+	for i := 0; i < numPackages; i++ {
+		suffixes = append(suffixes, fmt.Sprintf("p%d", i))
+	}
+	return Module(modulePath, version, suffixes...)
+}
+
 func AddPackage(m *internal.Module, p *internal.LegacyPackage) *internal.Module {
 	if m.ModulePath != stdlib.ModulePath && !strings.HasPrefix(p.Path, m.ModulePath) {
 		panic(fmt.Sprintf("package path %q not a prefix of module path %q",
@@ -263,17 +342,22 @@ func UnitForModuleRoot(m *internal.LegacyModuleInfo, licenses []*licenses.Metada
 }
 
 func UnitForPackage(pkg *internal.LegacyPackage, modulePath, version string) *internal.Unit {
-	return &internal.Unit{
-		UnitMeta:        *UnitMeta(pkg.Path, modulePath, version, pkg.Name, pkg.IsRedistributable),
-		Imports:         pkg.Imports,
-		LicenseContents: Licenses,
-		Documentation: &internal.Documentation{
-			Synopsis: pkg.Synopsis,
-			HTML:     pkg.DocumentationHTML,
-			GOOS:     pkg.GOOS,
-			GOARCH:   pkg.GOARCH,
-		},
+	u := &internal.Unit{
+		UnitMeta:           *UnitMeta(pkg.Path, modulePath, version, pkg.Name, pkg.IsRedistributable),
+		Imports:            pkg.Imports,
+		LicenseContents:    Licenses,
+		BuildFailureReason: pkg.BuildFailureReason,
+	}
+	if pkg.BuildFailureReason == "" {
+		u.Documentation = []*internal.Documentation{{
+			Synopsis:     pkg.Synopsis,
+			FullSynopsis: pkg.Synopsis,
+			HTML:         pkg.DocumentationHTML,
+			GOOS:         pkg.GOOS,
+			GOARCH:       pkg.GOARCH,
+		}}
 	}
+	return u
 }
 
 func UnitMeta(path, modulePath, version, name string, isRedistributable bool) *internal.UnitMeta {
@@ -5,6 +5,7 @@
 package internal
 
 import (
+	"sort"
 	"time"
 
 	"github.com/google/safehtml"
@@ -23,10 +24,33 @@ type UnitMeta struct {
 
 	// Module level information
 	//
-	Version    string
-	ModulePath string
-	CommitTime time.Time
-	SourceInfo *source.Info
+	Version           string
+	ModulePath        string
+	CommitTime        time.Time
+	HasSecurityPolicy bool
+	SourceInfo        *source.Info
+
+	// Retracted reports whether the module version is retracted by the go.mod
+	// file of the latest version of the module, and RetractionRationale is
+	// the explanation given for it, if any.
+	Retracted           bool
+	RetractionRationale string
+
+	// Deprecation is the deprecation message of the module, from the go.mod
+	// file of its latest version, or empty if the module is not deprecated.
+	Deprecation string
+
+	// ProcessedPackages and TotalPackages are the module's; see
+	// ModuleInfo.
+	ProcessedPackages int
+	TotalPackages     int
+
+	// GoVersion and Toolchain are the module's; see ModuleInfo.
+	GoVersion string
+	Toolchain string
+
+	// ChecksumStatus is the module's; see ModuleInfo.
+	ChecksumStatus string
 }
 
 // IsPackage reports whether the path represents a package path.
@@ -46,10 +70,87 @@ func (um *UnitMeta) IsModule() bool {
 type Unit struct {
 	UnitMeta
 	Readme          *Readme
-	Documentation   *Documentation
+	Documentation   []*Documentation // one for each build context whose files differ
 	Subdirectories  []*PackageMeta
 	Imports         []string
 	LicenseContents []*licenses.License
+
+	// BuildFailureReason, if non-empty, explains why documentation could not
+	// be generated for the unit. Documentation is nil in that case.
+	BuildFailureReason string
+
+	// ContentHash, if non-empty, is a hash of the files of the package and
+	// of the properties of its module that its documentation depends on.
+	// Packages with the same path and content hash have the same
+	// documentation, up to links to the module version.
+	ContentHash string
+}
+
+// A BuildContext is a pair of values for the GOOS and GOARCH environment
+// variables, used to select the files that make up a package.
+type BuildContext struct {
+	GOOS, GOARCH string
+}
+
+// BuildContexts are the build contexts for which documentation is rendered,
+// in order of preference.
+var BuildContexts = []BuildContext{
+	{"linux", "amd64"},
+	{"windows", "amd64"},
+	{"darwin", "amd64"},
+	{"js", "wasm"},
+	{"linux", "js"},
+}
+
+// DocumentationFor returns the documentation of the unit that best matches
+// goos and goarch, either of which may be empty. Documentation for the exact
+// build context is best, followed by documentation with the same GOOS, then
+// the same GOARCH. Ties are broken by the order of BuildContexts. It returns
+// nil if the unit has no documentation.
+func (u *Unit) DocumentationFor(goos, goarch string) *Documentation {
+	score := func(d *Documentation) int {
+		return buildContextScore(d.GOOS, d.GOARCH, goos, goarch)
+	}
+	var best *Documentation
+	for _, d := range u.Documentation {
+		if best == nil || score(d) > score(best) ||
+			(score(d) == score(best) && buildContextRank(d) < buildContextRank(best)) {
+			best = d
+		}
+	}
+	return best
+}
+
+// buildContextScore returns how well the build context dgoos/dgoarch matches
+// goos and goarch, either of which may be empty: 3 for both, 2 for the GOOS,
+// 1 for the GOARCH and 0 for neither.
+func buildContextScore(dgoos, dgoarch, goos, goarch string) int {
+	s := 0
+	if goos != "" && dgoos == goos {
+		s += 2
+	}
+	if goarch != "" && dgoarch == goarch {
+		s++
+	}
+	return s
+}
+
+// SortDocumentation sorts docs in the order of BuildContexts.
+func SortDocumentation(docs []*Documentation) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		return buildContextRank(docs[i]) < buildContextRank(docs[j])
+	})
+}
+
+// buildContextRank returns the position of the build context of d in
+// BuildContexts, or len(BuildContexts) if it is not there.
+func buildContextRank(d *Documentation) int {
+	for i, bc := range BuildContexts {
+		if bc.GOOS == d.GOOS && bc.GOARCH == d.GOARCH {
+			return i
+		}
+	}
+	return len(BuildContexts)
 }
 
 // Documentation is the rendered documentation for a given package
@@ -57,10 +158,30 @@ type Unit struct {
 type Documentation struct {
 	// The values of the GOOS and GOARCH environment variables used to parse the
 	// package.
-	GOOS     string
-	GOARCH   string
-	Synopsis string
-	HTML     safehtml.HTML
+	GOOS   string
+	GOARCH string
+	// Synopsis is the package synopsis as displayed on search and directory
+	// pages, which may be shortened. FullSynopsis is the complete first
+	// sentence of the package comment.
+	Synopsis     string
+	FullSynopsis string
+	HTML         safehtml.HTML
+	// Source is a zip archive of the package's .go files for this build
+	// context. It is only stored when HTML is abbreviated because the full
+	// documentation is too large, so that the full documentation can be
+	// rendered on demand. It is only read with WithDocumentationSource.
+	Source []byte
+	// API is the JSON encoding of the package's godoc.API for this build
+	// context, computed from its go/doc AST when the module was fetched. It
+	// is nil for documentation stored before it was computed. It is only
+	// read with WithDocumentationAPI.
+	API []byte
+	// Symbols are the sorted names of the exported symbols of the package
+	// for this build context: package-level constants, variables, functions
+	// and types, and methods and struct fields qualified by their type, like
+	// "Buffer.Len". They are used to compute the SymbolHistory of the
+	// package, and are not read by GetUnit.
+	Symbols []string
 }
 
 // Readme is a README at the specified filepath.
@@ -76,6 +197,11 @@ type PackageMeta struct {
 	Synopsis          string
 	IsRedistributable bool
 	Licenses          []*licenses.Metadata // metadata of applicable licenses
+	// ModulePath and Version identify the module version containing the
+	// package. Among the Subdirectories of a Unit, they differ from those of
+	// the Unit for packages in nested modules. They may be empty elsewhere.
+	ModulePath string
+	Version    string
 }
 
 // A FieldSet is a bit set of struct fields. It is used to avoid reading large
@@ -111,4 +237,6 @@ const (
 	WithImports
 	WithLicenses
 	WithSubdirectories
+	WithDocumentationSource
+	WithDocumentationAPI
 )
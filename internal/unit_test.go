@@ -0,0 +1,35 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package internal
+
+import "testing"
+
+func TestDocumentationFor(t *testing.T) {
+	u := &Unit{Documentation: []*Documentation{
+		{GOOS: "windows", GOARCH: "amd64"},
+		{GOOS: "linux", GOARCH: "amd64"},
+		{GOOS: "js", GOARCH: "wasm"},
+	}}
+	for _, test := range []struct {
+		goos, goarch string
+		want         BuildContext
+	}{
+		{"", "", BuildContext{"linux", "amd64"}},
+		{"windows", "amd64", BuildContext{"windows", "amd64"}},
+		{"js", "", BuildContext{"js", "wasm"}},
+		{"", "wasm", BuildContext{"js", "wasm"}},
+		{"linux", "wasm", BuildContext{"linux", "amd64"}},
+		{"darwin", "amd64", BuildContext{"linux", "amd64"}},
+		{"plan9", "386", BuildContext{"linux", "amd64"}},
+	} {
+		d := u.DocumentationFor(test.goos, test.goarch)
+		if got := (BuildContext{d.GOOS, d.GOARCH}); got != test.want {
+			t.Errorf("DocumentationFor(%q, %q) = %v, want %v", test.goos, test.goarch, got, test.want)
+		}
+	}
+	if d := (&Unit{}).DocumentationFor("linux", "amd64"); d != nil {
+		t.Errorf("DocumentationFor on unit without documentation = %+v, want nil", d)
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package vuln provides a client for the Go vulnerability database, and the
+// types of its entries.
+package vuln
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opencensus.io/plugin/ochttp"
+	"golang.org/x/mod/module"
+	"golang.org/x/net/context/ctxhttp"
+	"golang.org/x/pkgsite/internal/derrors"
+)
+
+// A Client is used by the worker to read the Go vulnerability database.
+//
+// The database is served over HTTP as JSON files: index.json maps the path of
+// each module that has entries to the time they were last modified, and
+// <module>.json, where <module> is the escaped module path, holds the entries
+// of the module.
+type Client struct {
+	// URL of the vulnerability database
+	url string
+
+	// client used for HTTP requests. It is mutable for testing purposes.
+	httpClient *http.Client
+
+	// cacheDir is the directory in which the entries of each module are
+	// cached, along with the time they were modified, so that they are only
+	// downloaded again after they change. If it is empty, nothing is cached.
+	cacheDir string
+}
+
+// An Index maps the path of each module in the database to the time its
+// entries were last modified.
+type Index map[string]time.Time
+
+// New constructs a *Client using the provided rawurl, which is expected to
+// be an absolute URI that can be directly passed to http.Get, and the
+// directory in which to cache entries, which may be empty.
+func New(rawurl, cacheDir string) (_ *Client, err error) {
+	defer derrors.Add(&err, "vuln.New(%q, %q)", rawurl, cacheDir)
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("url.Parse(%q): %v", rawurl, err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("scheme must be https (got %s)", u.Scheme)
+	}
+	return &Client{
+		url:        strings.TrimRight(rawurl, "/"),
+		httpClient: &http.Client{Transport: &ochttp.Transport{}},
+		cacheDir:   cacheDir,
+	}, nil
+}
+
+// GetIndex returns the index of the database.
+func (c *Client) GetIndex(ctx context.Context) (_ Index, err error) {
+	defer derrors.Wrap(&err, "vuln.Client.GetIndex(ctx)")
+
+	var index Index
+	if err := c.getJSON(ctx, "index.json", &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// GetAll returns every entry in the database, sorted by ID.
+func (c *Client) GetAll(ctx context.Context) (_ []*Entry, err error) {
+	defer derrors.Wrap(&err, "vuln.Client.GetAll(ctx)")
+
+	index, err := c.GetIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var entries []*Entry
+	for modulePath, modified := range index {
+		es, err := c.getByModule(ctx, modulePath, modified)
+		if err != nil {
+			return nil, err
+		}
+		// An entry about several modules is listed under each of them.
+		for _, e := range es {
+			if !seen[e.ID] {
+				seen[e.ID] = true
+				entries = append(entries, e)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+// GetByModule returns the entries about the module with modulePath.
+func (c *Client) GetByModule(ctx context.Context, modulePath string) (_ []*Entry, err error) {
+	defer derrors.Wrap(&err, "vuln.Client.GetByModule(ctx, %q)", modulePath)
+
+	index, err := c.GetIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	modified, ok := index[modulePath]
+	if !ok {
+		return nil, nil
+	}
+	return c.getByModule(ctx, modulePath, modified)
+}
+
+// cachedEntries is the contents of the cache file of a module.
+type cachedEntries struct {
+	Modified time.Time
+	Entries  []*Entry
+}
+
+// getByModule returns the entries about the module with modulePath, which
+// were last modified at modified, from the cache if they have not been
+// modified since they were cached.
+func (c *Client) getByModule(ctx context.Context, modulePath string, modified time.Time) ([]*Entry, error) {
+	name, err := escapeModulePath(modulePath)
+	if err != nil {
+		return nil, err
+	}
+	name += ".json"
+	cached, err := c.readCache(name)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && !cached.Modified.Before(modified) {
+		return cached.Entries, nil
+	}
+	var entries []*Entry
+	if err := c.getJSON(ctx, name, &entries); err != nil {
+		return nil, err
+	}
+	if err := c.writeCache(name, &cachedEntries{Modified: modified, Entries: entries}); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// getJSON decodes the JSON file with the given name into v.
+func (c *Client) getJSON(ctx context.Context, name string, v interface{}) error {
+	u := c.url + "/" + name
+	r, err := ctxhttp.Get(ctx, c.httpClient, u)
+	if err != nil {
+		return fmt.Errorf("ctxhttp.Get(ctx, nil, %q): %v", u, err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return derrors.FromStatus(r.StatusCode, "GET %s: %s", u, r.Status)
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("decoding %s: %v", u, err)
+	}
+	return nil
+}
+
+// readCache returns the cached contents of the file with the given name, or
+// nil if it is not cached.
+func (c *Client) readCache(name string) (*cachedEntries, error) {
+	if c.cacheDir == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(c.cacheDir, filepath.FromSlash(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cached cachedEntries
+	if err := json.Unmarshal(data, &cached); err != nil {
+		// Treat a corrupt cache file as missing; it will be overwritten.
+		return nil, nil
+	}
+	return &cached, nil
+}
+
+// writeCache caches contents as those of the file with the given name. The
+// file is written atomically, so that a reader never sees it half-written.
+func (c *Client) writeCache(name string, contents *cachedEntries) error {
+	if c.cacheDir == "" {
+		return nil
+	}
+	data, err := json.Marshal(contents)
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(c.cacheDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// escapeModulePath returns the name, without the ".json" suffix, of the file
+// that holds the entries of the module with modulePath.
+func escapeModulePath(modulePath string) (string, error) {
+	switch modulePath {
+	case StdlibName, ToolchainName:
+		return modulePath, nil
+	default:
+		return module.EscapePath(modulePath)
+	}
+}
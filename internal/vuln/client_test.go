@@ -0,0 +1,99 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vuln
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var testEntries = []*Entry{
+	{
+		ID:       "GO-2021-0001",
+		Modified: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		Details:  "A vulnerability in text.",
+		Affected: []Affected{{
+			Package: Package{Name: "golang.org/x/text", Ecosystem: "Go"},
+			Ranges:  []Range{{Type: RangeTypeSemver, Events: []RangeEvent{{Introduced: "0"}, {Fixed: "0.3.3"}}}},
+		}},
+	},
+	{
+		ID:       "GO-2021-0002",
+		Modified: time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC),
+		Details:  "A vulnerability in text and net/http.",
+		Affected: []Affected{
+			{
+				Package: Package{Name: "golang.org/x/text", Ecosystem: "Go"},
+				Ranges:  []Range{{Type: RangeTypeSemver, Events: []RangeEvent{{Introduced: "0.3.0"}, {Fixed: "0.3.5"}}}},
+			},
+			{
+				Package:           Package{Name: StdlibName, Ecosystem: "Go"},
+				EcosystemSpecific: EcosystemSpecific{Imports: []Import{{Path: "net/http"}}},
+			},
+		},
+	},
+}
+
+// countingTransport counts the requests that it sends.
+type countingTransport struct {
+	http.RoundTripper
+	n int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.n, 1)
+	return t.RoundTripper.RoundTrip(r)
+}
+
+func TestGetAll(t *testing.T) {
+	ctx := context.Background()
+	client, teardown := SetupTestClient(t, testEntries)
+	defer teardown()
+	dir, err := ioutil.TempDir("", "vuln-cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	client.cacheDir = dir
+	transport := &countingTransport{RoundTripper: client.httpClient.Transport}
+	client.httpClient.Transport = transport
+
+	for i, want := range []int32{3, 1} {
+		got, err := client.GetAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(testEntries, got); diff != "" {
+			t.Errorf("#%d: mismatch (-want +got):\n%s", i, diff)
+		}
+		// The first call fetches the index and both modules; the second
+		// reads the modules from the cache.
+		if n := atomic.SwapInt32(&transport.n, 0); n != want {
+			t.Errorf("#%d: got %d requests, want %d", i, n, want)
+		}
+	}
+
+	got, err := client.GetByModule(ctx, StdlibName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(testEntries[1:], got); diff != "" {
+		t.Errorf("GetByModule mismatch (-want +got):\n%s", diff)
+	}
+	got, err = client.GetByModule(ctx, "example.com/none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("GetByModule of a module without entries: got %v, want nil", got)
+	}
+}
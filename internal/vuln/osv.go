@@ -0,0 +1,191 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vuln
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/semver"
+	"golang.org/x/pkgsite/internal/stdlib"
+)
+
+// An Entry is a report in the Go vulnerability database, in the OSV format
+// (https://ossf.github.io/osv-schema).
+type Entry struct {
+	ID         string      `json:"id"`
+	Published  time.Time   `json:"published"`
+	Modified   time.Time   `json:"modified"`
+	Withdrawn  *time.Time  `json:"withdrawn,omitempty"`
+	Aliases    []string    `json:"aliases,omitempty"`
+	Details    string      `json:"details"`
+	Affected   []Affected  `json:"affected"`
+	References []Reference `json:"references,omitempty"`
+}
+
+// Affected describes the versions of a module, and the packages of it, that an
+// Entry is about.
+type Affected struct {
+	Package           Package           `json:"package"`
+	Ranges            []Range           `json:"ranges,omitempty"`
+	DatabaseSpecific  DatabaseSpecific  `json:"database_specific"`
+	EcosystemSpecific EcosystemSpecific `json:"ecosystem_specific"`
+}
+
+// Package is the module that an Affected is about. Its Name is a module path,
+// or one of StdlibName and ToolchainName.
+type Package struct {
+	Name      string `json:"name"`
+	Ecosystem string `json:"ecosystem"`
+}
+
+const (
+	// StdlibName is the Package.Name of the standard library.
+	StdlibName = "stdlib"
+
+	// ToolchainName is the Package.Name of the go command and the other
+	// commands of the Go distribution.
+	ToolchainName = "toolchain"
+)
+
+// RangeTypeSemver is the type of a Range whose events are semantic versions.
+// Ranges of other types are ignored.
+const RangeTypeSemver = "SEMVER"
+
+// A Range is a set of versions, described by the events that introduce and
+// fix the vulnerability.
+type Range struct {
+	Type   string       `json:"type"`
+	Events []RangeEvent `json:"events"`
+}
+
+// A RangeEvent is a version at which a vulnerability is introduced or fixed.
+// Exactly one of its fields is set. The versions are semantic versions without
+// the "v" prefix, and an Introduced version of "0" means that every version
+// before the next event is affected.
+type RangeEvent struct {
+	Introduced string `json:"introduced,omitempty"`
+	Fixed      string `json:"fixed,omitempty"`
+}
+
+// DatabaseSpecific holds the fields of an Affected that are specific to the
+// Go vulnerability database.
+type DatabaseSpecific struct {
+	URL string `json:"url,omitempty"`
+}
+
+// EcosystemSpecific holds the fields of an Affected that are specific to Go.
+type EcosystemSpecific struct {
+	// Imports are the affected packages. If there are none, every package
+	// of the module is affected.
+	Imports []Import `json:"imports,omitempty"`
+}
+
+// An Import is an affected package.
+type Import struct {
+	Path    string   `json:"path"`
+	GOOS    []string `json:"goos,omitempty"`
+	GOARCH  []string `json:"goarch,omitempty"`
+	Symbols []string `json:"symbols,omitempty"`
+}
+
+// A Reference is a link to more information about an Entry.
+type Reference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// ModulePath returns the path of the module that a is about, as it is stored
+// in the database: the standard library and the toolchain are both in
+// stdlib.ModulePath.
+func (a *Affected) ModulePath() string {
+	switch a.Package.Name {
+	case StdlibName, ToolchainName:
+		return stdlib.ModulePath
+	default:
+		return a.Package.Name
+	}
+}
+
+// PackagePaths returns the paths of the packages that a is about, or nil if it
+// is about every package of its module.
+func (a *Affected) PackagePaths() []string {
+	var paths []string
+	for _, imp := range a.EcosystemSpecific.Imports {
+		paths = append(paths, imp.Path)
+	}
+	return paths
+}
+
+// AffectsVersion reports whether v, a semantic version with the "v" prefix,
+// is in one of the ranges of a. Only ranges of type RangeTypeSemver are
+// considered, and if a has no ranges, every version is affected.
+func (a *Affected) AffectsVersion(v string) bool {
+	if len(a.Ranges) == 0 {
+		return true
+	}
+	for _, r := range a.Ranges {
+		if r.Type == RangeTypeSemver && r.containsSemver(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsSemver reports whether v is in r. The events of r are applied in
+// version order, up to and including the last one that is at or before v: v
+// is affected if that event introduced the vulnerability, and not if it
+// fixed it or if there is no such event.
+func (r *Range) containsSemver(v string) bool {
+	affected := false
+	for _, e := range r.SortedEvents() {
+		ev := e.version()
+		if ev != "0" && semver.Compare(canonicalVersion(ev), v) > 0 {
+			break
+		}
+		affected = e.Introduced != ""
+	}
+	return affected
+}
+
+// SortedEvents returns the events of r in version order, which they need not
+// be in.
+func (r *Range) SortedEvents() []RangeEvent {
+	events := append([]RangeEvent(nil), r.Events...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return compareEventVersions(events[i].version(), events[j].version()) < 0
+	})
+	return events
+}
+
+// version returns the version of e.
+func (e RangeEvent) version() string {
+	if e.Introduced != "" {
+		return e.Introduced
+	}
+	return e.Fixed
+}
+
+// compareEventVersions compares the versions of two events, where "0" comes
+// before every other version.
+func compareEventVersions(v1, v2 string) int {
+	switch {
+	case v1 == v2:
+		return 0
+	case v1 == "0":
+		return -1
+	case v2 == "0":
+		return 1
+	default:
+		return semver.Compare(canonicalVersion(v1), canonicalVersion(v2))
+	}
+}
+
+// canonicalVersion returns v, a version in an OSV range, with the "v" prefix
+// that the semver package needs.
+func canonicalVersion(v string) string {
+	return "v" + strings.TrimPrefix(v, "v")
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vuln
+
+import (
+	"testing"
+
+	"golang.org/x/pkgsite/internal/stdlib"
+)
+
+func TestAffectsVersion(t *testing.T) {
+	semverRange := func(events ...RangeEvent) Range {
+		return Range{Type: RangeTypeSemver, Events: events}
+	}
+	intro := func(v string) RangeEvent { return RangeEvent{Introduced: v} }
+	fixed := func(v string) RangeEvent { return RangeEvent{Fixed: v} }
+
+	for _, test := range []struct {
+		name    string
+		ranges  []Range
+		version string
+		want    bool
+	}{
+		{"no ranges", nil, "v1.0.0", true},
+		{"empty range", []Range{semverRange()}, "v1.0.0", false},
+		{"introduced at 0", []Range{semverRange(intro("0"))}, "v0.0.1", true},
+		{"before fix", []Range{semverRange(intro("0"), fixed("1.2.0"))}, "v1.1.9", true},
+		{"at fix", []Range{semverRange(intro("0"), fixed("1.2.0"))}, "v1.2.0", false},
+		{"after fix", []Range{semverRange(intro("0"), fixed("1.2.0"))}, "v1.3.0", false},
+		{"before introduced", []Range{semverRange(intro("1.1.0"), fixed("1.2.0"))}, "v1.0.0", false},
+		{"at introduced", []Range{semverRange(intro("1.1.0"), fixed("1.2.0"))}, "v1.1.0", true},
+		{"prerelease of fix", []Range{semverRange(intro("0"), fixed("1.2.0"))}, "v1.2.0-pre", true},
+		{"pseudo-version", []Range{semverRange(intro("0"), fixed("1.2.0"))}, "v1.1.1-0.20200101000000-abcdefabcdef", true},
+		{
+			"between ranges",
+			[]Range{semverRange(intro("1.0.0"), fixed("1.1.0"), intro("1.5.0"), fixed("1.6.0"))},
+			"v1.3.0", false,
+		},
+		{
+			"second range",
+			[]Range{semverRange(intro("1.0.0"), fixed("1.1.0"), intro("1.5.0"), fixed("1.6.0"))},
+			"v1.5.1", true,
+		},
+		{
+			"unordered events",
+			[]Range{semverRange(fixed("1.6.0"), intro("1.5.0"), fixed("1.1.0"), intro("0"))},
+			"v1.5.1", true,
+		},
+		{
+			"several ranges",
+			[]Range{semverRange(intro("0"), fixed("1.1.0")), semverRange(intro("2.0.0"), fixed("2.1.0"))},
+			"v2.0.5", true,
+		},
+		{"non-semver range", []Range{{Type: "GIT", Events: []RangeEvent{intro("0")}}}, "v1.0.0", false},
+		{"incompatible", []Range{semverRange(intro("0"), fixed("3.0.1"))}, "v3.0.0+incompatible", true},
+		{"Go release", []Range{semverRange(intro("1.16.0"), fixed("1.16.5"))}, "v1.16.4", true},
+		{"Go release without patch", []Range{semverRange(intro("0"), fixed("1.17"))}, "v1.16.4", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Affected{Ranges: test.ranges}
+			if got := a.AffectsVersion(test.version); got != test.want {
+				t.Errorf("AffectsVersion(%q) = %t, want %t", test.version, got, test.want)
+			}
+		})
+	}
+}
+
+func TestAffectedModulePath(t *testing.T) {
+	for _, test := range []struct {
+		name, want string
+	}{
+		{"golang.org/x/text", "golang.org/x/text"},
+		{StdlibName, stdlib.ModulePath},
+		{ToolchainName, stdlib.ModulePath},
+	} {
+		a := &Affected{Package: Package{Name: test.name, Ecosystem: "Go"}}
+		if got := a.ModulePath(); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vuln
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/pkgsite/internal/testing/testhelper"
+)
+
+// SetupTestClient creates a vulnerability database for testing that serves
+// the given entries. It returns a Client for reading the database, and a
+// function for tearing down the server after the test is completed.
+func SetupTestClient(t *testing.T, entries []*Entry) (*Client, func()) {
+	t.Helper()
+
+	index := Index{}
+	byName := map[string][]*Entry{}
+	for _, e := range entries {
+		seen := map[string]bool{}
+		for _, a := range e.Affected {
+			name, err := escapeModulePath(a.Package.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			byName[name] = append(byName[name], e)
+			if e.Modified.After(index[a.Package.Name]) {
+				index[a.Package.Name] = e.Modified
+			}
+		}
+	}
+
+	httpClient, server, serverCloseFn := testhelper.SetupTestClientAndServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var v interface{}
+			switch name := strings.TrimPrefix(r.URL.Path, "/"); {
+			case name == "index.json":
+				v = index
+			case strings.HasSuffix(name, ".json") && byName[strings.TrimSuffix(name, ".json")] != nil:
+				v = byName[strings.TrimSuffix(name, ".json")]
+			default:
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(v)
+		}))
+
+	client, err := New(server.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.httpClient = httpClient
+	return client, serverCloseFn
+}
@@ -6,6 +6,7 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"sort"
@@ -22,6 +23,10 @@ import (
 	"golang.org/x/pkgsite/internal/postgres"
 	"golang.org/x/pkgsite/internal/proxy"
 	"golang.org/x/pkgsite/internal/source"
+	"golang.org/x/pkgsite/internal/stdlib"
+	"golang.org/x/pkgsite/internal/version"
+	"golang.org/x/pkgsite/internal/xcontext"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
@@ -55,12 +60,126 @@ func FetchAndUpdateState(ctx context.Context, modulePath, requestedVersion strin
 		trace.StringAttribute("version", requestedVersion))
 	defer span.End()
 
-	ft := fetchAndInsertModule(ctx, modulePath, requestedVersion, proxyClient, sourceClient, db)
+	// Concurrent requests for the same module version in this process share
+	// a single fetch.
+	v, err, shared := fetchGroup.Do(modulePath+"@"+requestedVersion, func() (interface{}, error) {
+		// The fetch is shared, so it must not fail because the request that
+		// started it was canceled. It keeps that request's deadline, and can
+		// still be canceled when the worker shuts down.
+		fctx := xcontext.Detach(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			fctx, cancel = context.WithDeadline(fctx, deadline)
+			defer cancel()
+		}
+		return inFlight.run(fctx, modulePath, requestedVersion, func(ctx context.Context) (int, error) {
+			return fetchAndUpdateStateExclusive(ctx, modulePath, requestedVersion, proxyClient, sourceClient, db, appVersionLabel)
+		})
+	})
+	span.AddAttributes(trace.BoolAttribute("shared", shared))
+	return v.(int), err
+}
+
+// fetchGroup coalesces the concurrent calls to FetchAndUpdateState for a
+// module version.
+var fetchGroup singleflight.Group
+
+// fetchAndUpdateStateExclusive calls fetchAndUpdateState, unless too many
+// versions of modulePath are already being processed, in which case it
+// returns http.StatusServiceUnavailable so that the fetch is retried later.
+//
+// A module version is fetched by at most one process at a time. If
+// fetchAndUpdateStateExclusive has to wait for another process to finish
+// fetching it, it returns the result that the other process recorded in
+// module_version_states rather than fetching the module version again.
+func fetchAndUpdateStateExclusive(ctx context.Context, modulePath, requestedVersion string, proxyClient *proxy.Client, sourceClient *source.Client, db *postgres.DB, appVersionLabel string) (int, error) {
+	if !moduleFetches.acquire(modulePath) {
+		return http.StatusServiceUnavailable, fmt.Errorf("already processing %d versions of %s", moduleFetches.limit(), modulePath)
+	}
+	defer moduleFetches.release(modulePath)
+
+	if !semver.IsValid(requestedVersion) {
+		// Queries like "latest" and branch names are resolved during the
+		// fetch, and are not recorded in module_version_states.
+		return fetchAndUpdateState(ctx, modulePath, requestedVersion, proxyClient, sourceClient, db, appVersionLabel)
+	}
+	prev, err := db.GetModuleVersionState(ctx, modulePath, requestedVersion)
+	if err != nil && !errors.Is(err, derrors.NotFound) {
+		return http.StatusInternalServerError, err
+	}
+	var (
+		code     int
+		fetchErr error
+	)
+	err = db.WithModuleVersionLock(ctx, modulePath, requestedVersion, func(waited bool) {
+		if waited {
+			vs, err := db.GetModuleVersionState(ctx, modulePath, requestedVersion)
+			if err == nil && processedSince(vs, prev) {
+				log.Infof(ctx, "%s@%s was processed by another worker with status %d", modulePath, requestedVersion, vs.Status)
+				code = vs.Status
+				if vs.Error != "" {
+					fetchErr = derrors.FromStatus(vs.Status, "%s", vs.Error)
+				}
+				return
+			}
+		}
+		code, fetchErr = fetchAndUpdateState(ctx, modulePath, requestedVersion, proxyClient, sourceClient, db, appVersionLabel)
+	})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return code, fetchErr
+}
+
+// processedSince reports whether the module version state vs records a result
+// of the fetch service that is newer than that of prev, which is nil if there
+// was no state.
+func processedSince(vs, prev *internal.ModuleVersionState) bool {
+	if vs.LastProcessedAt == nil || vs.Status == 0 {
+		return false
+	}
+	return prev == nil || prev.LastProcessedAt == nil || vs.LastProcessedAt.After(*prev.LastProcessedAt)
+}
+
+// recordTimeout bounds the time taken to record the result of a fetch whose
+// deadline has passed.
+const recordTimeout = time.Minute
+
+// phaseInsert is the phase of a fetch in which the module is inserted into
+// the database, following the phases of package fetch.
+const phaseInsert = "insert"
+
+// fetchAndUpdateState does the work of FetchAndUpdateState.
+func fetchAndUpdateState(ctx context.Context, modulePath, requestedVersion string, proxyClient *proxy.Client, sourceClient *source.Client, db *postgres.DB, appVersionLabel string) (_ int, err error) {
+	fetchStart := time.Now()
+	span := trace.FromContext(ctx)
+	ft := fetchAndInsertModule(ctx, modulePath, requestedVersion, proxyClient, sourceClient, db, appVersionLabel)
 	span.AddAttributes(trace.Int64Attribute("numPackages", int64(len(ft.PackageVersionStates))))
+	defer recordFetch(ft)
+	defer recordFetchStats(ctx, ft)
+
+	if errors.Is(ctx.Err(), context.Canceled) {
+		// The fetch was abandoned, as when the worker shuts down before it
+		// finishes. Its work was rolled back; leave module_version_states as
+		// it was, so that the module version is fetched again.
+		return http.StatusServiceUnavailable, fmt.Errorf("fetch of %s@%s abandoned: %w", modulePath, requestedVersion, ctx.Err())
+	}
+	if ctx.Err() != nil {
+		// Record the result even though the deadline of the fetch passed, so
+		// that module_version_states says where the fetch stopped.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(xcontext.Detach(ctx), recordTimeout)
+		defer cancel()
+	}
+	// Record the statistics of the fetch once everything else is done, so
+	// that they include the time taken to update the database.
+	defer func() { insertFetchStats(ctx, db, ft, time.Since(fetchStart)) }()
 
 	// If there were any errors processing the module then we didn't insert it.
-	// Delete it in case we are reprocessing an existing module.
-	if ft.Status >= 400 {
+	// Delete it in case we are reprocessing an existing module. A snapshot of
+	// the standard library at master cannot be fetched again once master has
+	// moved on, but what was stored for it is still good, so keep it.
+	if ft.Status >= 400 && !errors.Is(ft.Error, stdlib.ErrSnapshotGone) {
 		if err := deleteModule(ctx, db, ft); err != nil {
 			log.Error(ctx, err)
 			ft.Error = err
@@ -97,7 +216,7 @@ func FetchAndUpdateState(ctx context.Context, modulePath, requestedVersion strin
 	// InsertModuleVersionState and UpdateModuleVersionState.
 	start := time.Now()
 	err = db.UpsertModuleVersionState(ctx, ft.ModulePath, ft.ResolvedVersion, appVersionLabel,
-		time.Time{}, ft.Status, ft.GoModPath, ft.Error, ft.PackageVersionStates)
+		time.Time{}, ft.Status, ft.GoModPath, ft.GoVersion, ft.Toolchain, ft.ProxyURL, ft.Error, ft.Warnings, ft.PackageVersionStates)
 	ft.timings["db.UpsertModuleVersionState"] = time.Since(start)
 	if err != nil {
 		log.Error(ctx, err)
@@ -112,6 +231,18 @@ func FetchAndUpdateState(ctx context.Context, modulePath, requestedVersion strin
 	return ft.Status, ft.Error
 }
 
+// packageCache is a fetch.PackageCache that finds packages in the database,
+// among the module versions that were last processed by the given app
+// version, so that documentation rendered by other code is never reused.
+type packageCache struct {
+	db         *postgres.DB
+	appVersion string
+}
+
+func (c packageCache) GetUnitByContentHash(ctx context.Context, pkgPath, contentHash string) (*internal.Unit, error) {
+	return c.db.GetUnitByContentHash(ctx, pkgPath, contentHash, c.appVersion)
+}
+
 // fetchAndInsertModule fetches the given module version from the module proxy
 // or (in the case of the standard library) from the Go repo and writes the
 // resulting data to the database.
@@ -119,7 +250,11 @@ func FetchAndUpdateState(ctx context.Context, modulePath, requestedVersion strin
 // The given parentCtx is used for tracing, but fetches actually execute in a
 // detached context with fixed timeout, so that fetches are allowed to complete
 // even for short-lived requests.
-func fetchAndInsertModule(ctx context.Context, modulePath, requestedVersion string, proxyClient *proxy.Client, sourceClient *source.Client, db *postgres.DB) *fetchTask {
+//
+// Packages whose content is unchanged from a version of the module that was
+// processed by the same app version are copied from that version rather than
+// processed again.
+func fetchAndInsertModule(ctx context.Context, modulePath, requestedVersion string, proxyClient *proxy.Client, sourceClient *source.Client, db *postgres.DB, appVersionLabel string) *fetchTask {
 	ft := &fetchTask{
 		FetchResult: fetch.FetchResult{
 			ModulePath:       modulePath,
@@ -152,12 +287,16 @@ func fetchAndInsertModule(ctx context.Context, modulePath, requestedVersion stri
 	}
 
 	start := time.Now()
-	fr := fetch.FetchModule(ctx, modulePath, requestedVersion, proxyClient, sourceClient)
+	cache := packageCache{db: db, appVersion: appVersionLabel}
+	fr := fetch.FetchModuleWithCache(ctx, modulePath, requestedVersion, proxyClient, sourceClient, cache)
 	if fr == nil {
 		panic("fetch.FetchModule should never return a nil FetchResult")
 	}
 	ft.FetchResult = *fr
 	ft.timings["fetch.FetchModule"] = time.Since(start)
+	for phase, d := range fr.Timings {
+		ft.timings["fetch."+phase] = d
+	}
 	if ft.Error != nil {
 		logf := log.Infof
 		if ft.Status >= 500 && ft.Status != derrors.ToStatus(derrors.ProxyTimedOut) {
@@ -172,6 +311,12 @@ func fetchAndInsertModule(ctx context.Context, modulePath, requestedVersion stri
 	err = db.InsertModule(ctx, ft.Module)
 	ft.timings["db.InsertModule"] = time.Since(start)
 	if err != nil {
+		if ctx.Err() != nil {
+			if !errors.Is(err, ctx.Err()) {
+				err = fmt.Errorf("%v: %w", err, ctx.Err())
+			}
+			err = &fetch.PhaseError{Phase: phaseInsert, Err: err}
+		}
 		log.Error(ctx, err)
 
 		ft.Status = derrors.ToStatus(err)
@@ -179,9 +324,89 @@ func fetchAndInsertModule(ctx context.Context, modulePath, requestedVersion stri
 		return ft
 	}
 	log.Infof(ctx, "db.InsertModule succeeded for %s@%s", ft.ModulePath, ft.RequestedVersion)
+	if vt, err := version.ParseType(ft.Module.Version); err == nil && vt == version.TypeRelease {
+		// Like the retractions, a failure here shouldn't fail the fetch: the
+		// history is recomputed when the next adjacent version is processed.
+		start = time.Now()
+		if err := db.InsertSymbolHistory(ctx, ft.Module.ModulePath, ft.Module.Version, symbolIntroductions); err != nil {
+			log.Error(ctx, err)
+		}
+		ft.timings["db.InsertSymbolHistory"] = time.Since(start)
+	}
+	if modulePath != stdlib.ModulePath {
+		// Failing to read the retractions of the module shouldn't fail the
+		// fetch; they will be updated the next time a version of the
+		// module is processed.
+		if err := updateLatestModuleVersions(ctx, db, proxyClient, ft); err != nil {
+			log.Error(ctx, err)
+		}
+		if err := insertDirectVersions(ctx, db, ft); err != nil {
+			log.Error(ctx, err)
+		}
+	}
 	return ft
 }
 
+// updateLatestModuleVersions reads the latest version of the module from the
+// proxy, along with the retract directives of its go.mod file, and records
+// them in the database so that retracted versions of the module are flagged.
+func updateLatestModuleVersions(ctx context.Context, db *postgres.DB, proxyClient *proxy.Client, ft *fetchTask) (err error) {
+	start := time.Now()
+	defer func() {
+		ft.timings["worker.updateLatestModuleVersions"] = time.Since(start)
+		derrors.Wrap(&err, "updateLatestModuleVersions(%q)", ft.ModulePath)
+	}()
+	ctx, span := trace.StartSpan(ctx, "worker.updateLatestModuleVersions")
+	defer span.End()
+
+	lmv, err := fetch.LatestModuleVersions(ctx, ft.ModulePath, proxyClient)
+	if err != nil {
+		return err
+	}
+	return db.UpdateLatestModuleVersions(ctx, lmv)
+}
+
+// insertDirectVersions adds the versions of a module that is fetched directly
+// from its repository, which are tagged there but not yet in
+// module_version_states, to that table. They are then processed like the
+// versions that are read from the module index, and so appear on the
+// versions page of the module. It does nothing for modules that are fetched
+// from the proxy.
+func insertDirectVersions(ctx context.Context, db *postgres.DB, ft *fetchTask) (err error) {
+	start := time.Now()
+	defer func() {
+		ft.timings["worker.insertDirectVersions"] = time.Since(start)
+		derrors.Wrap(&err, "insertDirectVersions(%q)", ft.ModulePath)
+	}()
+
+	versions, direct, err := fetch.ListDirectVersions(ctx, ft.ModulePath)
+	if err != nil || !direct {
+		return err
+	}
+	var newVersions []*internal.IndexVersion
+	for _, v := range versions {
+		if v == ft.ResolvedVersion {
+			continue
+		}
+		_, err := db.GetModuleVersionState(ctx, ft.ModulePath, v)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, derrors.NotFound) {
+			return err
+		}
+		newVersions = append(newVersions, &internal.IndexVersion{
+			Path:      ft.ModulePath,
+			Version:   v,
+			Timestamp: start,
+		})
+	}
+	if len(newVersions) == 0 {
+		return nil
+	}
+	return db.InsertIndexVersions(ctx, newVersions)
+}
+
 func updateVersionMap(ctx context.Context, db *postgres.DB, ft *fetchTask) (err error) {
 	start := time.Now()
 	defer func() {
@@ -203,6 +428,7 @@ func updateVersionMap(ctx context.Context, db *postgres.DB, ft *fetchTask) (err
 		Status:           ft.Status,
 		GoModPath:        ft.GoModPath,
 		Error:            errMsg,
+		ErrorCode:        derrors.ToCode(ft.Error),
 	}
 	if err := db.UpsertVersionMap(ctx, vm); err != nil {
 		return err
@@ -241,6 +467,31 @@ func deleteModule(ctx context.Context, db *postgres.DB, ft *fetchTask) (err erro
 	return nil
 }
 
+// insertFetchStats records the statistics of ft, which took d, in the
+// database. Like the result of the fetch in module_version_states, they are
+// only recorded for valid versions. Failing to record them doesn't fail the
+// fetch.
+func insertFetchStats(ctx context.Context, db *postgres.DB, ft *fetchTask, d time.Duration) {
+	if !semver.IsValid(ft.ResolvedVersion) {
+		return
+	}
+	err := db.InsertFetchStats(ctx, &postgres.FetchStats{
+		ModulePath:     ft.ModulePath,
+		Version:        ft.ResolvedVersion,
+		FetchedAt:      time.Now(),
+		Status:         ft.Status,
+		ZipSize:        ft.ZipSize,
+		NumZipFiles:    ft.NumZipFiles,
+		NumPackages:    len(ft.PackageVersionStates),
+		Duration:       d,
+		PhaseDurations: ft.timings,
+		MaxAlloc:       int64(ft.MaxAlloc),
+	})
+	if err != nil {
+		log.Error(ctx, err)
+	}
+}
+
 func logTaskResult(ctx context.Context, ft *fetchTask, prefix string) {
 	var times []string
 	for k, v := range ft.timings {
@@ -350,6 +350,43 @@ func TestFetch_V1Path(t *testing.T) {
 	}
 }
 
+func TestFetchAndUpdateState_FetchStats(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer postgres.ResetTestDB(testDB, t)
+	proxyClient, tearDown := proxy.SetupTestClient(t, []*proxy.Module{
+		{
+			ModulePath: sample.ModulePath,
+			Version:    sample.VersionString,
+			Files: map[string]string{
+				"foo.go":     "package foo\nconst Foo = 41",
+				"bar/bar.go": "package bar\nconst Bar = 42",
+				"LICENSE":    testhelper.MITLicense,
+			},
+		},
+	})
+	defer tearDown()
+	// Fetch twice, to check that only one row is kept for the version.
+	fetchAndCheckStatus(ctx, t, proxyClient, sample.ModulePath, sample.VersionString, http.StatusOK)
+	fetchAndCheckStatus(ctx, t, proxyClient, sample.ModulePath, sample.VersionString, http.StatusOK)
+
+	stats, err := testDB.GetSlowestFetches(ctx, time.Now().Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("got %d rows, want 1", len(stats))
+	}
+	s := stats[0]
+	if s.ModulePath != sample.ModulePath || s.Version != sample.VersionString || s.Status != http.StatusOK ||
+		s.NumPackages != 2 || s.NumZipFiles == 0 || s.ZipSize == 0 || s.NumFetches != 2 {
+		t.Errorf("got %+v", s)
+	}
+	if _, ok := s.PhaseDurations["db.InsertModule"]; !ok {
+		t.Errorf("got phase durations %v, want db.InsertModule among them", s.PhaseDurations)
+	}
+}
+
 func TestReFetch(t *testing.T) {
 	// This test checks that re-fetching a version will cause its data to be
 	// overwritten.  This is achieved by fetching against two different versions
@@ -897,6 +934,166 @@ func TestFetchAndUpdateState_ProxyTimedOut(t *testing.T) {
 	fetchAndCheckStatus(ctx, t, proxyClient, sample.ModulePath, sample.VersionString, derrors.ToStatus(derrors.ProxyTimedOut))
 }
 
+// Check that concurrent calls to FetchAndUpdateState for the same module
+// version fetch it once.
+func TestFetchAndUpdateState_Concurrent(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer postgres.ResetTestDB(testDB, t)
+
+	proxyClient, teardownProxy := proxy.SetupTestClient(t, []*proxy.Module{concurrentModule(sample.VersionString)})
+	defer teardownProxy()
+	sourceClient := source.NewClient(sourceTimeout)
+
+	const n = 5
+	codes := make(chan int, n)
+	// Hold the lock on the module version, so that the calls to
+	// FetchAndUpdateState run concurrently.
+	err := testDB.WithModuleVersionLock(ctx, sample.ModulePath, sample.VersionString, func(bool) {
+		for i := 0; i < n; i++ {
+			go func() {
+				code, err := FetchAndUpdateState(ctx, sample.ModulePath, sample.VersionString, proxyClient, sourceClient, testDB, testAppVersion)
+				if err != nil {
+					t.Error(err)
+				}
+				codes <- code
+			}()
+		}
+		// The calls share a single fetch, which waits for the lock.
+		waitForLockWaiters(ctx, t, 1)
+		time.Sleep(100 * time.Millisecond)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("got code %d, want %d", code, http.StatusOK)
+		}
+	}
+	checkTryCount(ctx, t, sample.ModulePath, sample.VersionString, 1)
+}
+
+// Check that FetchAndUpdateState does not fetch a module version again after
+// waiting for another process to fetch it.
+func TestFetchAndUpdateState_ConcurrentProcesses(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer postgres.ResetTestDB(testDB, t)
+
+	proxyClient, teardownProxy := proxy.SetupTestClient(t, []*proxy.Module{concurrentModule(sample.VersionString)})
+	defer teardownProxy()
+	sourceClient := source.NewClient(sourceTimeout)
+
+	codes := make(chan int, 1)
+	err := testDB.WithModuleVersionLock(ctx, sample.ModulePath, sample.VersionString, func(bool) {
+		go func() {
+			code, err := FetchAndUpdateState(ctx, sample.ModulePath, sample.VersionString, proxyClient, sourceClient, testDB, testAppVersion)
+			if err != nil {
+				t.Error(err)
+			}
+			codes <- code
+		}()
+		waitForLockWaiters(ctx, t, 1)
+		// Fetch the module version as another process holding the lock would.
+		if code, err := fetchAndUpdateState(ctx, sample.ModulePath, sample.VersionString, proxyClient, sourceClient, testDB, testAppVersion); err != nil {
+			t.Fatalf("fetchAndUpdateState: %d, %v", code, err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := <-codes; code != http.StatusOK {
+		t.Errorf("got code %d, want %d", code, http.StatusOK)
+	}
+	checkTryCount(ctx, t, sample.ModulePath, sample.VersionString, 1)
+}
+
+// Check that FetchAndUpdateState returns http.StatusServiceUnavailable for a
+// module with too many versions being processed.
+func TestFetchAndUpdateState_ModuleFetchLimit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer postgres.ResetTestDB(testDB, t)
+
+	SetModuleFetchLimit(1)
+	defer SetModuleFetchLimit(defaultModuleFetchLimit)
+
+	const otherVersion = "v1.1.0"
+	proxyClient, teardownProxy := proxy.SetupTestClient(t, []*proxy.Module{
+		concurrentModule(sample.VersionString),
+		concurrentModule(otherVersion),
+	})
+	defer teardownProxy()
+	sourceClient := source.NewClient(sourceTimeout)
+
+	codes := make(chan int, 1)
+	err := testDB.WithModuleVersionLock(ctx, sample.ModulePath, sample.VersionString, func(bool) {
+		go func() {
+			code, _ := FetchAndUpdateState(ctx, sample.ModulePath, sample.VersionString, proxyClient, sourceClient, testDB, testAppVersion)
+			codes <- code
+		}()
+		waitForLockWaiters(ctx, t, 1)
+		code, err := FetchAndUpdateState(ctx, sample.ModulePath, otherVersion, proxyClient, sourceClient, testDB, testAppVersion)
+		if code != http.StatusServiceUnavailable || err == nil {
+			t.Errorf("FetchAndUpdateState(%q): got %d, %v; want %d and an error", otherVersion, code, err, http.StatusServiceUnavailable)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := <-codes; code != http.StatusOK {
+		t.Errorf("got code %d, want %d", code, http.StatusOK)
+	}
+	if _, err := testDB.GetModuleVersionState(ctx, sample.ModulePath, otherVersion); !errors.Is(err, derrors.NotFound) {
+		t.Errorf("GetModuleVersionState(%q): got %v, want NotFound", otherVersion, err)
+	}
+	fetchAndCheckStatus(ctx, t, proxyClient, sample.ModulePath, otherVersion, http.StatusOK)
+}
+
+func concurrentModule(version string) *proxy.Module {
+	return &proxy.Module{
+		ModulePath: sample.ModulePath,
+		Version:    version,
+		Files: map[string]string{
+			"foo/foo.go": "// Package foo\npackage foo\n\nconst Foo = 42",
+			"LICENSE":    testhelper.MITLicense,
+		},
+	}
+}
+
+// waitForLockWaiters waits until at least n sessions are waiting for
+// advisory locks.
+func waitForLockWaiters(ctx context.Context, t *testing.T, n int) {
+	t.Helper()
+	for {
+		var got int
+		err := testDB.Underlying().QueryRow(ctx, `SELECT count(*) FROM pg_locks WHERE locktype = 'advisory' AND NOT granted`).Scan(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got >= n {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func checkTryCount(ctx context.Context, t *testing.T, modulePath, version string, want int) {
+	t.Helper()
+	vs, err := testDB.GetModuleVersionState(ctx, modulePath, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vs.TryCount != want {
+		t.Errorf("got try count %d, want %d", vs.TryCount, want)
+	}
+}
+
 func fetchAndCheckStatus(ctx context.Context, t *testing.T, proxyClient *proxy.Client, modulePath, version string, wantCode int) {
 	t.Helper()
 	sourceClient := source.NewClient(sourceTimeout)
@@ -942,10 +1139,25 @@ func fetchAndCheckStatus(ctx context.Context, t *testing.T, proxyClient *proxy.C
 			t.Fatalf("got %v, want Is(NotFound)", err)
 		}
 	}
+	var wantErrorCode string
+	switch code {
+	case derrors.ToStatus(derrors.AlternativeModule):
+		wantErrorCode = derrors.CodeAlternativeModule
+	case http.StatusNotFound:
+		wantErrorCode = derrors.CodeNotFound
+	case http.StatusForbidden:
+		wantErrorCode = derrors.CodeExcluded
+	case derrors.ToStatus(derrors.ProxyTimedOut):
+		wantErrorCode = derrors.CodeProxyTimedOut
+	}
 	if semver.IsValid(version) {
-		if _, err := testDB.GetModuleVersionState(ctx, modulePath, version); err != nil {
+		mvs, err := testDB.GetModuleVersionState(ctx, modulePath, version)
+		if err != nil {
 			t.Fatal(err)
 		}
+		if mvs.ErrorCode != wantErrorCode {
+			t.Fatalf("testDB.GetModuleVersionState(ctx, %q, %q): error code = %q, want = %q", modulePath, version, mvs.ErrorCode, wantErrorCode)
+		}
 	}
 	vm, err := testDB.GetVersionMap(ctx, modulePath, version)
 	if err != nil {
@@ -954,6 +1166,9 @@ func fetchAndCheckStatus(ctx context.Context, t *testing.T, proxyClient *proxy.C
 	if vm.Status != wantCode {
 		t.Fatalf("testDB.GetVersionMap(ctx, %q, %q): status = %d, want = %d", modulePath, version, vm.Status, wantCode)
 	}
+	if vm.ErrorCode != wantErrorCode {
+		t.Fatalf("testDB.GetVersionMap(ctx, %q, %q): error code = %q, want = %q", modulePath, version, vm.ErrorCode, wantErrorCode)
+	}
 }
 
 func checkPackageVersionStates(ctx context.Context, t *testing.T, modulePath, version string, wantStates []*internal.PackageVersionState) {
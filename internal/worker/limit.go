@@ -0,0 +1,73 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import "sync"
+
+// defaultModuleFetchLimit is the default maximum number of versions of a
+// single module that the worker processes at once.
+const defaultModuleFetchLimit = 3
+
+// moduleFetches limits the number of versions of each module that
+// FetchAndUpdateState processes at once, so that the many versions of a large
+// module cannot occupy all of the worker's fetches. See SetModuleFetchLimit.
+var moduleFetches = newModuleLimiter(defaultModuleFetchLimit)
+
+// SetModuleFetchLimit sets the maximum number of versions of a single module
+// that FetchAndUpdateState processes at once to n, unless n is not positive.
+// A fetch of a module that is at the limit fails with
+// http.StatusServiceUnavailable, so that it is retried later.
+func SetModuleFetchLimit(n int) {
+	if n > 0 {
+		moduleFetches.setLimit(n)
+	}
+}
+
+// A moduleLimiter counts the operations in progress on each module path, and
+// limits their number.
+type moduleLimiter struct {
+	mu     sync.Mutex
+	max    int
+	counts map[string]int // module path to number of operations in progress
+}
+
+func newModuleLimiter(max int) *moduleLimiter {
+	return &moduleLimiter{max: max, counts: map[string]int{}}
+}
+
+// acquire reports whether an operation on modulePath may start, and if so
+// counts it. Each successful call to acquire must be followed by a call to
+// release.
+func (l *moduleLimiter) acquire(modulePath string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts[modulePath] >= l.max {
+		return false
+	}
+	l.counts[modulePath]++
+	return true
+}
+
+// release records that an operation on modulePath has finished.
+func (l *moduleLimiter) release(modulePath string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.counts[modulePath]--
+	if l.counts[modulePath] <= 0 {
+		delete(l.counts, modulePath)
+	}
+}
+
+func (l *moduleLimiter) limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.max
+}
+
+func (l *moduleLimiter) setLimit(max int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.max = max
+}
@@ -0,0 +1,29 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import "testing"
+
+func TestModuleLimiter(t *testing.T) {
+	l := newModuleLimiter(2)
+	for i, want := range []bool{true, true, false} {
+		if got := l.acquire("m"); got != want {
+			t.Fatalf("acquire #%d: got %t, want %t", i, got, want)
+		}
+	}
+	if !l.acquire("other") {
+		t.Fatal("acquire(other): got false, want true")
+	}
+	l.release("m")
+	if !l.acquire("m") {
+		t.Fatal("acquire after release: got false, want true")
+	}
+	l.release("m")
+	l.release("m")
+	l.release("other")
+	if len(l.counts) != 0 {
+		t.Errorf("got counts %v, want none", l.counts)
+	}
+}
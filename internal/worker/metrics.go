@@ -0,0 +1,243 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/fetch"
+)
+
+// The phases of a fetch whose latencies are measured, in the order of the
+// fetch, with the timings of the fetch that they are measured by.
+var measuredPhases = []struct {
+	name, timing string
+}{
+	{"download", "fetch." + fetch.PhaseDownload},
+	{"extract", "fetch." + fetch.PhaseExtract},
+	{"render", "fetch." + fetch.PhaseDocs},
+	{phaseInsert, "db.InsertModule"},
+}
+
+// A StatsRecorder records measurements of the fetches of the worker.
+type StatsRecorder interface {
+	// RecordPhase records that a phase of a fetch, such as "download",
+	// took d.
+	RecordPhase(ctx context.Context, phase string, d time.Duration)
+	// RecordError records that a fetch failed with the given status code.
+	RecordError(ctx context.Context, code int)
+}
+
+// statsRecorder records the measurements of the fetches of this process.
+// Tests replace it to capture them.
+var statsRecorder StatsRecorder = defaultStatsRecorder{}
+
+// recordFetchStats records the phase latencies of ft, and its status code if
+// it failed, with statsRecorder.
+func recordFetchStats(ctx context.Context, ft *fetchTask) {
+	for _, p := range measuredPhases {
+		if d, ok := ft.timings[p.timing]; ok {
+			statsRecorder.RecordPhase(ctx, p.name, d)
+		}
+	}
+	if ft.Status >= 400 {
+		statsRecorder.RecordError(ctx, ft.Status)
+	}
+}
+
+var (
+	keyFetchPhase     = tag.MustNewKey("worker.fetch.phase")
+	fetchPhaseLatency = stats.Float64(
+		"go-discovery/worker/fetch-phase-latency",
+		"Latency of a phase of a worker fetch.",
+		stats.UnitMilliseconds,
+	)
+	// FetchPhaseLatencyDistribution aggregates the latency of the phases of
+	// worker fetches by phase.
+	FetchPhaseLatencyDistribution = &view.View{
+		Name:        "go-discovery/worker/fetch-phase-latency",
+		Measure:     fetchPhaseLatency,
+		Aggregation: ochttp.DefaultLatencyDistribution,
+		Description: "Worker fetch phase latency, by phase",
+		TagKeys:     []tag.Key{keyFetchPhase},
+	}
+
+	keyFetchErrorCode = tag.MustNewKey("worker.fetch.error_code")
+	fetchError        = stats.Int64(
+		"go-discovery/worker/fetch-error",
+		"The status code of a failed worker fetch.",
+		stats.UnitDimensionless,
+	)
+	// FetchErrorCount counts failed worker fetches by status code.
+	FetchErrorCount = &view.View{
+		Name:        "go-discovery/worker/fetch-error/count",
+		Measure:     fetchError,
+		Aggregation: view.Count(),
+		Description: "Worker fetch error count, by status code",
+		TagKeys:     []tag.Key{keyFetchErrorCode},
+	}
+)
+
+// defaultStatsRecorder records measurements with OpenCensus, and in
+// recentStats for the status page.
+type defaultStatsRecorder struct{}
+
+func (defaultStatsRecorder) RecordPhase(ctx context.Context, phase string, d time.Duration) {
+	stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(keyFetchPhase, phase)},
+		fetchPhaseLatency.M(float64(d)/float64(time.Millisecond)))
+	recentStats.recordPhase(time.Now(), phase, d)
+}
+
+func (defaultStatsRecorder) RecordError(ctx context.Context, code int) {
+	stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(keyFetchErrorCode, strconv.Itoa(code))},
+		fetchError.M(int64(code)))
+	recentStats.recordError(time.Now(), code)
+}
+
+const (
+	// statsWindow is the period over which the status page summarizes the
+	// measurements of fetches.
+	statsWindow = time.Hour
+
+	// maxStatsSamples bounds the number of latencies of each phase that are
+	// kept for the status page. If there are more in statsWindow, the oldest
+	// are dropped.
+	maxStatsSamples = 10000
+)
+
+// recentStats holds the measurements of the fetches of this process in the
+// last statsWindow.
+var recentStats = newWindowStats(statsWindow, maxStatsSamples)
+
+// windowStats keeps the measurements of a trailing window of time.
+type windowStats struct {
+	window     time.Duration
+	maxSamples int
+
+	mu     sync.Mutex
+	phases map[string][]latencySample
+	errors map[int][]time.Time
+}
+
+// A latencySample is a latency measured at a time.
+type latencySample struct {
+	at time.Time
+	d  time.Duration
+}
+
+func newWindowStats(window time.Duration, maxSamples int) *windowStats {
+	return &windowStats{
+		window:     window,
+		maxSamples: maxSamples,
+		phases:     map[string][]latencySample{},
+		errors:     map[int][]time.Time{},
+	}
+}
+
+func (w *windowStats) recordPhase(now time.Time, phase string, d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ss := append(w.phases[phase], latencySample{now, d})
+	if len(ss) > w.maxSamples {
+		ss = ss[len(ss)-w.maxSamples:]
+	}
+	w.phases[phase] = ss
+}
+
+func (w *windowStats) recordError(now time.Time, code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ts := append(w.errors[code], now)
+	if len(ts) > w.maxSamples {
+		ts = ts[len(ts)-w.maxSamples:]
+	}
+	w.errors[code] = ts
+}
+
+// A phaseLatency summarizes the latencies of a phase of fetches.
+type phaseLatency struct {
+	Phase         string
+	Count         int
+	P50, P95, P99 time.Duration
+}
+
+// An errorCount is the number of fetches that failed with a status code.
+type errorCount struct {
+	Code  int
+	Desc  string
+	Count int
+}
+
+// summary drops the measurements from before the window that ends at now,
+// and summarizes the rest: the latencies of the measured phases, in the
+// order of measuredPhases, and the number of errors for each status code,
+// in code order.
+func (w *windowStats) summary(now time.Time) ([]*phaseLatency, []*errorCount) {
+	start := now.Add(-w.window)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var latencies []*phaseLatency
+	for _, p := range measuredPhases {
+		ss := w.phases[p.name]
+		i := sort.Search(len(ss), func(i int) bool { return !ss[i].at.Before(start) })
+		ss = ss[i:]
+		w.phases[p.name] = ss
+		ds := make([]time.Duration, len(ss))
+		for i, s := range ss {
+			ds[i] = s.d
+		}
+		sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+		latencies = append(latencies, &phaseLatency{
+			Phase: p.name,
+			Count: len(ds),
+			P50:   percentile(ds, 50),
+			P95:   percentile(ds, 95),
+			P99:   percentile(ds, 99),
+		})
+	}
+
+	var counts []*errorCount
+	for code, ts := range w.errors {
+		i := sort.Search(len(ts), func(i int) bool { return !ts[i].Before(start) })
+		if i == len(ts) {
+			delete(w.errors, code)
+			continue
+		}
+		w.errors[code] = ts[i:]
+		c := &errorCount{Code: code, Count: len(ts) - i}
+		if e := derrors.FromStatus(code, ""); e != nil && e != derrors.Unknown {
+			c.Desc = e.Error()
+		}
+		counts = append(counts, c)
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Code < counts[j].Code })
+	return latencies, counts
+}
+
+// percentile returns the pth percentile of the sorted durations ds, using
+// the nearest-rank method. It returns 0 if ds is empty.
+func percentile(ds []time.Duration, p float64) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(ds))))
+	if rank < 1 {
+		rank = 1
+	}
+	return ds[rank-1]
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal/fetch"
+)
+
+// capturingRecorder is a StatsRecorder that keeps what it records.
+type capturingRecorder struct {
+	mu     sync.Mutex
+	phases []timing
+	errors []int
+}
+
+func (r *capturingRecorder) RecordPhase(ctx context.Context, phase string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.phases = append(r.phases, timing{phase, d})
+}
+
+func (r *capturingRecorder) RecordError(ctx context.Context, code int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, code)
+}
+
+func TestRecordFetchStats(t *testing.T) {
+	defer func(r StatsRecorder) { statsRecorder = r }(statsRecorder)
+	rec := &capturingRecorder{}
+	statsRecorder = rec
+
+	for _, status := range []int{200, 404, 500} {
+		recordFetchStats(context.Background(), &fetchTask{
+			FetchResult: fetch.FetchResult{ModulePath: "example.com/m", Status: status},
+			timings: map[string]time.Duration{
+				"fetch.FetchModule":   10,
+				"fetch.download":      1,
+				"fetch.checksum":      2,
+				"fetch.docs":          3,
+				"db.InsertModule":     4,
+				"worker.deleteModule": 5,
+			},
+		})
+	}
+	wantPhases := []timing{{"download", 1}, {"render", 3}, {"insert", 4}}
+	if diff := cmp.Diff(wantPhases, rec.phases[:3]); diff != "" {
+		t.Errorf("phases mismatch (-want +got):\n%s", diff)
+	}
+	if len(rec.phases) != 9 {
+		t.Errorf("recorded %d phases, want 9", len(rec.phases))
+	}
+	if diff := cmp.Diff([]int{404, 500}, rec.errors); diff != "" {
+		t.Errorf("errors mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWindowStats(t *testing.T) {
+	start := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	w := newWindowStats(time.Hour, 50)
+	// Too old to be summarized.
+	w.recordPhase(start, "download", time.Hour)
+	w.recordError(start, 500)
+	// Only the latest 50 are kept.
+	for i := 1; i <= 100; i++ {
+		w.recordPhase(start.Add(30*time.Minute), "download", time.Duration(i)*time.Millisecond)
+	}
+	w.recordPhase(start.Add(time.Hour), "render", time.Second)
+	w.recordError(start.Add(time.Hour), 404)
+	w.recordError(start.Add(time.Hour), 404)
+	w.recordError(start.Add(time.Hour), 490)
+
+	latencies, errors := w.summary(start.Add(time.Hour + time.Minute))
+	ms := time.Millisecond
+	wantLatencies := []*phaseLatency{
+		{Phase: "download", Count: 50, P50: 75 * ms, P95: 98 * ms, P99: 100 * ms},
+		{Phase: "extract"},
+		{Phase: "render", Count: 1, P50: time.Second, P95: time.Second, P99: time.Second},
+		{Phase: "insert"},
+	}
+	if diff := cmp.Diff(wantLatencies, latencies); diff != "" {
+		t.Errorf("latencies mismatch (-want +got):\n%s", diff)
+	}
+	wantErrors := []*errorCount{
+		{Code: 404, Desc: "not found", Count: 2},
+		{Code: 490, Desc: "bad module", Count: 1},
+	}
+	if diff := cmp.Diff(wantErrors, errors); diff != "" {
+		t.Errorf("errors mismatch (-want +got):\n%s", diff)
+	}
+
+	// Later, everything has expired.
+	latencies, errors = w.summary(start.Add(3 * time.Hour))
+	if latencies[0].Count != 0 || len(errors) != 0 {
+		t.Errorf("got %d download latencies and %d error codes after the window, want none", latencies[0].Count, len(errors))
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	ds := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	for _, test := range []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, 1},
+		{50, 5},
+		{95, 10},
+		{99, 10},
+		{100, 10},
+	} {
+		if got := percentile(ds, test.p); got != test.want {
+			t.Errorf("percentile(1..10, %g) = %d, want %d", test.p, got, test.want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile(nil, 50) = %d, want 0", got)
+	}
+}
@@ -7,6 +7,7 @@ package worker
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
@@ -34,7 +35,8 @@ func (s *Server) doIndexPage(w http.ResponseWriter, r *http.Request) (err error)
 	defer derrors.Wrap(&err, "doIndexPage")
 	var (
 		experiments []*internal.Experiment
-		excluded    []string
+		excluded    []*postgres.ExcludedPrefix
+		retryCounts []*postgres.RetryClassCount
 	)
 	g, ctx := errgroup.WithContext(r.Context())
 	g.Go(func() error {
@@ -53,6 +55,14 @@ func (s *Server) doIndexPage(w http.ResponseWriter, r *http.Request) (err error)
 		}
 		return nil
 	})
+	g.Go(func() error {
+		var err error
+		retryCounts, err = s.db.GetRetryClassCounts(ctx)
+		if err != nil {
+			return annotation{err, "error fetching retry class counts"}
+		}
+		return nil
+	})
 	if err := g.Wait(); err != nil {
 		var e annotation
 		if errors.As(err, &e) {
@@ -62,21 +72,30 @@ func (s *Server) doIndexPage(w http.ResponseWriter, r *http.Request) (err error)
 	}
 
 	page := struct {
-		Config          *config.Config
-		Env             string
-		ResourcePrefix  string
-		LatestTimestamp *time.Time
-		LocationID      string
-		Experiments     []*internal.Experiment
-		Excluded        []string
+		Config           *config.Config
+		Env              string
+		ResourcePrefix   string
+		LatestTimestamp  *time.Time
+		LocationID       string
+		Experiments      []*internal.Experiment
+		Excluded         []*postgres.ExcludedPrefix
+		RetryClassCounts []*postgres.RetryClassCount
+		RecentFetches    []*fetchSummary
+		StatsWindow      time.Duration
+		PhaseLatencies   []*phaseLatency
+		ErrorCounts      []*errorCount
 	}{
-		Config:         s.cfg,
-		Env:            env(s.cfg),
-		ResourcePrefix: strings.ToLower(env(s.cfg)) + "-",
-		LocationID:     s.cfg.LocationID,
-		Experiments:    experiments,
-		Excluded:       excluded,
+		Config:           s.cfg,
+		Env:              env(s.cfg),
+		ResourcePrefix:   strings.ToLower(env(s.cfg)) + "-",
+		LocationID:       s.cfg.LocationID,
+		Experiments:      experiments,
+		Excluded:         excluded,
+		RetryClassCounts: retryCounts,
+		RecentFetches:    getRecentFetches(),
+		StatsWindow:      statsWindow,
 	}
+	page.PhaseLatencies, page.ErrorCounts = recentStats.summary(time.Now())
 	return renderPage(ctx, w, page, s.templates[indexTemplate])
 }
 
@@ -128,6 +147,14 @@ func (s *Server) doVersionsPage(w http.ResponseWriter, r *http.Request) (err err
 		return err
 	}
 
+	// Look up the version_map rows of all of the listed versions at once,
+	// rather than with a query for each.
+	rows, err := s.versionRows(ctx, next, recents, failures)
+	if err != nil {
+		log.Errorf(ctx, "error fetching version maps: %v", err)
+		return err
+	}
+
 	type count struct {
 		Code  int
 		Desc  string
@@ -143,16 +170,16 @@ func (s *Server) doVersionsPage(w http.ResponseWriter, r *http.Request) (err err
 	}
 	sort.Slice(counts, func(i, j int) bool { return counts[i].Code < counts[j].Code })
 	page := struct {
-		Next, Recent, RecentFailures []*internal.ModuleVersionState
+		Next, Recent, RecentFailures []*versionRow
 		Config                       *config.Config
 		Env                          string
 		ResourcePrefix               string
 		LatestTimestamp              *time.Time
 		Counts                       []*count
 	}{
-		Next:            next,
-		Recent:          recents,
-		RecentFailures:  failures,
+		Next:            rows[0],
+		Recent:          rows[1],
+		RecentFailures:  rows[2],
 		Config:          s.cfg,
 		Env:             env(s.cfg),
 		ResourcePrefix:  strings.ToLower(env(s.cfg)) + "-",
@@ -162,6 +189,161 @@ func (s *Server) doVersionsPage(w http.ResponseWriter, r *http.Request) (err err
 	return renderPage(ctx, w, page, s.templates[versionsTemplate])
 }
 
+// doFetchStatsPage writes a page of the module versions whose latest fetches
+// in the last day were slowest, and of the module versions with the largest
+// zips. With the query parameter "format=json", it writes them as JSON.
+func (s *Server) doFetchStatsPage(w http.ResponseWriter, r *http.Request) (err error) {
+	defer derrors.Wrap(&err, "doFetchStatsPage")
+	limit := parseLimitParam(r, 20)
+	g, ctx := errgroup.WithContext(r.Context())
+	var slowest, largest []*postgres.FetchStats
+	g.Go(func() error {
+		var err error
+		slowest, err = s.db.GetSlowestFetches(ctx, time.Now().Add(-24*time.Hour), limit)
+		if err != nil {
+			return annotation{err, "error fetching slowest fetches"}
+		}
+		return nil
+	})
+	g.Go(func() error {
+		var err error
+		largest, err = s.db.GetLargestModules(ctx, limit)
+		if err != nil {
+			return annotation{err, "error fetching largest modules"}
+		}
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		var e annotation
+		if errors.As(err, &e) {
+			log.Errorf(ctx, e.msg, err)
+		}
+		return err
+	}
+
+	if r.FormValue("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(struct {
+			Slowest, Largest []*postgres.FetchStats
+		}{slowest, largest})
+	}
+	page := struct {
+		Config           *config.Config
+		Env              string
+		ResourcePrefix   string
+		Slowest, Largest []*postgres.FetchStats
+	}{
+		Config:         s.cfg,
+		Env:            env(s.cfg),
+		ResourcePrefix: strings.ToLower(env(s.cfg)) + "-",
+		Slowest:        slowest,
+		Largest:        largest,
+	}
+	return renderPage(ctx, w, page, s.templates[fetchStatsTemplate])
+}
+
+// doModuleHistoryPage writes a page of the recent processing history of the
+// module whose path is the "path" query parameter: the fetches of its
+// versions by this worker since it started, and the latest state and fetch
+// statistics of its versions in the database. The number of versions listed
+// is given by the "limit" query parameter.
+func (s *Server) doModuleHistoryPage(w http.ResponseWriter, r *http.Request) (err error) {
+	modulePath := r.FormValue("path")
+	if modulePath == "" {
+		return &serverError{http.StatusBadRequest, errors.New("must provide 'path' query param")}
+	}
+	defer derrors.Wrap(&err, "doModuleHistoryPage(%q)", modulePath)
+	limit := parseLimitParam(r, 20)
+	g, ctx := errgroup.WithContext(r.Context())
+	var (
+		states     []*internal.ModuleVersionState
+		fetchStats []*postgres.FetchStats
+	)
+	g.Go(func() error {
+		var err error
+		states, err = s.db.GetModuleVersionStatesForModule(ctx, modulePath, limit)
+		if err != nil {
+			return annotation{err, "error fetching module version states"}
+		}
+		return nil
+	})
+	g.Go(func() error {
+		var err error
+		fetchStats, err = s.db.GetModuleFetchStats(ctx, modulePath, limit)
+		if err != nil {
+			return annotation{err, "error fetching fetch stats"}
+		}
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		var e annotation
+		if errors.As(err, &e) {
+			log.Errorf(ctx, e.msg, err)
+		}
+		return err
+	}
+
+	var recent []*fetchSummary
+	for _, f := range getRecentFetches() {
+		if f.ModulePath == modulePath {
+			recent = append(recent, f)
+		}
+	}
+	page := struct {
+		Config         *config.Config
+		Env            string
+		ResourcePrefix string
+		ModulePath     string
+		RecentFetches  []*fetchSummary
+		States         []*internal.ModuleVersionState
+		FetchStats     []*postgres.FetchStats
+	}{
+		Config:         s.cfg,
+		Env:            env(s.cfg),
+		ResourcePrefix: strings.ToLower(env(s.cfg)) + "-",
+		ModulePath:     modulePath,
+		RecentFetches:  recent,
+		States:         states,
+		FetchStats:     fetchStats,
+	}
+	return renderPage(ctx, w, page, s.templates[moduleHistoryTemplate])
+}
+
+// A versionRow is a row of a table of module versions on the versions page.
+type versionRow struct {
+	*internal.ModuleVersionState
+	// VersionMap is the row of version_map for the module version, or nil if
+	// there is none.
+	VersionMap *internal.VersionMap
+}
+
+// versionRows returns a slice of versionRows for each of the given slices of
+// module version states.
+func (s *Server) versionRows(ctx context.Context, stateLists ...[]*internal.ModuleVersionState) (_ [][]*versionRow, err error) {
+	defer derrors.Wrap(&err, "versionRows")
+
+	var mvs []internal.Modver
+	for _, states := range stateLists {
+		for _, st := range states {
+			mvs = append(mvs, internal.Modver{Path: st.ModulePath, Version: st.Version})
+		}
+	}
+	vms, err := s.db.GetVersionMaps(ctx, mvs)
+	if err != nil {
+		return nil, err
+	}
+	var rows [][]*versionRow
+	for _, states := range stateLists {
+		var rs []*versionRow
+		for _, st := range states {
+			rs = append(rs, &versionRow{ModuleVersionState: st, VersionMap: vms[0]})
+			vms = vms[1:]
+		}
+		rows = append(rows, rs)
+	}
+	return rows, nil
+}
+
 func env(cfg *config.Config) string {
 	e := cfg.DeploymentEnvironment()
 	return strings.ToUpper(e[:1]) + e[1:]
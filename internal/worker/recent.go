@@ -0,0 +1,95 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRecentFetches is the number of recent fetches that are shown on the
+	// status page.
+	maxRecentFetches = 20
+
+	// maxSlowestPackages is the number of packages of a fetch whose timings
+	// are shown on the status page.
+	maxSlowestPackages = 5
+)
+
+// A fetchSummary describes a fetch that this worker completed, for the status
+// page.
+type fetchSummary struct {
+	ModulePath string
+	Version    string
+	Status     int
+	Error      string
+	Finished   *time.Time
+	// Timings are the durations of the steps of the fetch, in name order.
+	Timings []timing
+	// SlowestPackages are the durations of processing the slowest packages
+	// of the module, slowest first.
+	SlowestPackages []timing
+}
+
+// A timing is the duration of a named step.
+type timing struct {
+	Name     string
+	Duration time.Duration
+}
+
+// recentFetches holds the most recent fetches that this worker completed,
+// most recent first.
+var recentFetches struct {
+	mu      sync.Mutex
+	fetches []*fetchSummary
+}
+
+// recordFetch adds ft to the recent fetches.
+func recordFetch(ft *fetchTask) {
+	now := time.Now()
+	s := &fetchSummary{
+		ModulePath:      ft.ModulePath,
+		Version:         ft.ResolvedVersion,
+		Status:          ft.Status,
+		Finished:        &now,
+		Timings:         sortedTimings(ft.timings),
+		SlowestPackages: sortedTimings(ft.PackageTimings),
+	}
+	if ft.Error != nil {
+		s.Error = ft.Error.Error()
+	}
+	sort.SliceStable(s.SlowestPackages, func(i, j int) bool {
+		return s.SlowestPackages[i].Duration > s.SlowestPackages[j].Duration
+	})
+	if len(s.SlowestPackages) > maxSlowestPackages {
+		s.SlowestPackages = s.SlowestPackages[:maxSlowestPackages]
+	}
+
+	recentFetches.mu.Lock()
+	defer recentFetches.mu.Unlock()
+	recentFetches.fetches = append([]*fetchSummary{s}, recentFetches.fetches...)
+	if len(recentFetches.fetches) > maxRecentFetches {
+		recentFetches.fetches = recentFetches.fetches[:maxRecentFetches]
+	}
+}
+
+// getRecentFetches returns the recent fetches, most recent first.
+func getRecentFetches() []*fetchSummary {
+	recentFetches.mu.Lock()
+	defer recentFetches.mu.Unlock()
+	return append([]*fetchSummary(nil), recentFetches.fetches...)
+}
+
+// sortedTimings returns the timings of m in name order.
+func sortedTimings(m map[string]time.Duration) []timing {
+	var ts []timing
+	for name, d := range m {
+		ts = append(ts, timing{name, d})
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i].Name < ts[j].Name })
+	return ts
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal/fetch"
+)
+
+func TestRecordFetch(t *testing.T) {
+	defer func() { recentFetches.fetches = nil }()
+
+	for i := 0; i < maxRecentFetches+1; i++ {
+		ft := &fetchTask{
+			FetchResult: fetch.FetchResult{
+				ModulePath:      "example.com/m",
+				ResolvedVersion: fmt.Sprintf("v1.0.%d", i),
+				Status:          500,
+				Error:           errors.New("bad"),
+				PackageTimings:  map[string]time.Duration{},
+			},
+			timings: map[string]time.Duration{"b": 2, "a": 1},
+		}
+		for j := 0; j < maxSlowestPackages+1; j++ {
+			ft.PackageTimings[fmt.Sprintf("p%d", j)] = time.Duration(j)
+		}
+		recordFetch(ft)
+	}
+
+	got := getRecentFetches()
+	if len(got) != maxRecentFetches {
+		t.Fatalf("got %d recent fetches, want %d", len(got), maxRecentFetches)
+	}
+	s := got[0]
+	if want := fmt.Sprintf("v1.0.%d", maxRecentFetches); s.Version != want || s.Error != "bad" {
+		t.Errorf("got version %q, error %q; want %q, %q", s.Version, s.Error, want, "bad")
+	}
+	if diff := cmp.Diff([]timing{{"a", 1}, {"b", 2}}, s.Timings); diff != "" {
+		t.Errorf("timings mismatch (-want +got):\n%s", diff)
+	}
+	wantSlowest := []timing{{"p5", 5}, {"p4", 4}, {"p3", 3}, {"p2", 2}, {"p1", 1}}
+	if diff := cmp.Diff(wantSlowest, s.SlowestPackages); diff != "" {
+		t.Errorf("slowest packages mismatch (-want +got):\n%s", diff)
+	}
+}
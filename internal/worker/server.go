@@ -18,12 +18,14 @@ import (
 	"time"
 
 	"cloud.google.com/go/errorreporting"
+	"contrib.go.opencensus.io/exporter/prometheus"
 	"github.com/go-redis/redis/v7"
 	"github.com/google/safehtml/template"
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
 	"go.opencensus.io/trace"
+	"golang.org/x/mod/semver"
 	"golang.org/x/pkgsite/internal"
 	"golang.org/x/pkgsite/internal/config"
 	"golang.org/x/pkgsite/internal/derrors"
@@ -35,6 +37,7 @@ import (
 	"golang.org/x/pkgsite/internal/queue"
 	"golang.org/x/pkgsite/internal/source"
 	"golang.org/x/pkgsite/internal/stdlib"
+	"golang.org/x/pkgsite/internal/vuln"
 )
 
 // Server can be installed to serve the go discovery worker.
@@ -43,7 +46,7 @@ type Server struct {
 	indexClient          *index.Client
 	proxyClient          *proxy.Client
 	sourceClient         *source.Client
-	redisHAClient        *redis.Client
+	vulnClient           *vuln.Client
 	redisCacheClient     *redis.Client
 	db                   *postgres.DB
 	queue                queue.Queue
@@ -51,6 +54,8 @@ type Server struct {
 	taskIDChangeInterval time.Duration
 	templates            map[string]*template.Template
 	staticPath           template.TrustedSource
+	// metrics serves the OpenCensus views of this process.
+	metrics http.Handler
 }
 
 // ServerConfig contains everything needed by a Server.
@@ -59,7 +64,7 @@ type ServerConfig struct {
 	IndexClient          *index.Client
 	ProxyClient          *proxy.Client
 	SourceClient         *source.Client
-	RedisHAClient        *redis.Client
+	VulnClient           *vuln.Client
 	RedisCacheClient     *redis.Client
 	Queue                queue.Queue
 	ReportingClient      *errorreporting.Client
@@ -68,8 +73,10 @@ type ServerConfig struct {
 }
 
 const (
-	indexTemplate    = "index.tmpl"
-	versionsTemplate = "versions.tmpl"
+	indexTemplate         = "index.tmpl"
+	versionsTemplate      = "versions.tmpl"
+	fetchStatsTemplate    = "fetch_stats.tmpl"
+	moduleHistoryTemplate = "module_history.tmpl"
 )
 
 // NewServer creates a new Server with the given dependencies.
@@ -83,9 +90,23 @@ func NewServer(cfg *config.Config, scfg ServerConfig) (_ *Server, err error) {
 	if err != nil {
 		return nil, err
 	}
+	t3, err := parseTemplate(scfg.StaticPath, template.TrustedSourceFromConstant(fetchStatsTemplate))
+	if err != nil {
+		return nil, err
+	}
+	t4, err := parseTemplate(scfg.StaticPath, template.TrustedSourceFromConstant(moduleHistoryTemplate))
+	if err != nil {
+		return nil, err
+	}
 	templates := map[string]*template.Template{
-		indexTemplate:    t1,
-		versionsTemplate: t2,
+		indexTemplate:         t1,
+		versionsTemplate:      t2,
+		fetchStatsTemplate:    t3,
+		moduleHistoryTemplate: t4,
+	}
+	metrics, err := prometheus.NewExporter(prometheus.Options{})
+	if err != nil {
+		return nil, err
 	}
 
 	return &Server{
@@ -94,13 +115,14 @@ func NewServer(cfg *config.Config, scfg ServerConfig) (_ *Server, err error) {
 		indexClient:          scfg.IndexClient,
 		proxyClient:          scfg.ProxyClient,
 		sourceClient:         scfg.SourceClient,
-		redisHAClient:        scfg.RedisHAClient,
+		vulnClient:           scfg.VulnClient,
 		redisCacheClient:     scfg.RedisCacheClient,
 		queue:                scfg.Queue,
 		reportingClient:      scfg.ReportingClient,
 		taskIDChangeInterval: scfg.TaskIDChangeInterval,
 		templates:            templates,
 		staticPath:           scfg.StaticPath,
+		metrics:              metrics,
 	}, nil
 }
 
@@ -121,15 +143,20 @@ func (s *Server) Install(handle func(string, http.Handler)) {
 	// See the note about duplicate tasks for "/enqueue" below.
 	handle("/poll", rmw(s.errorHandler(s.handlePollIndex)))
 
+	// manual: index-cursor shows the position up to which "/poll" has read
+	// the module index. The "reset" query parameter, an RFC 3339 timestamp,
+	// moves the cursor, so that the next poll reads the index from there.
+	handle("/index-cursor", rmw(s.errorHandler(s.handleIndexCursor)))
+
 	// scheduled: update-imported-by-count update the imported_by_count for
 	// packages in search_documents where imported_by_count_updated_at is null
 	// or imported_by_count_updated_at < version_updated_at.
 	// This endpoint is intended to be invoked periodically by a scheduler.
 	handle("/update-imported-by-count", rmw(s.errorHandler(s.handleUpdateImportedByCount)))
 
-	// scheduled: download search document data and update the redis sorted
-	// set(s) used in auto-completion.
-	handle("/update-redis-indexes", rmw(s.errorHandler(s.handleUpdateRedisIndexes)))
+	// scheduled: update-vulns reads the Go vulnerability database, stores its
+	// entries, and records the stored package versions that they affect.
+	handle("/update-vulns", rmw(s.errorHandler(s.handleUpdateVulns)))
 
 	// task-queue: fetch fetches a module version from the Module Mirror, and
 	// processes the contents, and inserts it into the database. If a fetch
@@ -150,16 +177,18 @@ func (s *Server) Install(handle func(string, http.Handler)) {
 	// duplicate tasks by providing any string as the "suffix" query parameter.
 	handle("/enqueue", rmw(s.errorHandler(s.handleEnqueue)))
 
-	// TODO: remove after /queue is in production and the scheduler jobs have been changed.
-	// scheduled: requeue queries the module_version_states table for the next
-	// batch of module versions to process, and enqueues them for processing.
-	// Normally this will not cause duplicate processing, because Cloud Tasks
-	// are de-duplicated. That does not apply after a task has been finished or
-	// deleted for Server.taskIDChangeInterval (see
-	// https://cloud.google.com/tasks/docs/reference/rpc/google.cloud.tasks.v2#createtaskrequest,
-	// under "Task De-duplication"). If you cannot wait, you can force
-	// duplicate tasks by providing any string as the "suffix" query parameter.
-	handle("/requeue", rmw(s.errorHandler(s.handleEnqueue)))
+	// manual: requeue makes the module versions whose paths begin with the
+	// "prefix" query parameter due for processing, and enqueues them. If the
+	// "status" query parameter is provided, only module versions with that
+	// status are requeued, and if the "limit" query parameter is provided, at
+	// most that many are. With "dry_run=true", it only reports how many module
+	// versions would be requeued. Duplicate tasks are handled as for
+	// "/enqueue", above.
+	//
+	// scheduled: without a prefix, requeue behaves like "/enqueue".
+	// TODO: remove that fallback after /queue is in production and the
+	// scheduler jobs have been changed.
+	handle("/requeue", rmw(s.errorHandler(s.handleRequeue)))
 
 	// manual: reprocess sets a reprocess status for all records in the
 	// module_version_states table that were processed by an app_version that
@@ -176,11 +205,23 @@ func (s *Server) Install(handle func(string, http.Handler)) {
 	// see the comments on duplicate tasks for "/requeue", above.
 	handle("/populate-stdlib", rmw(s.errorHandler(s.handlePopulateStdLib)))
 
+	// scheduled: refresh-stdlib-master schedules a fetch of the standard
+	// library at master, so that the development version shown by the
+	// frontend follows the head of the Go repo. It is run daily. The task
+	// suffix defaults to the date, so a day's refresh is only scheduled once.
+	handle("/refresh-stdlib-master", rmw(s.errorHandler(s.handleRefreshStdlibMaster)))
+
 	// manual: populate-search-documents repopulates every row in the
 	// search_documents table that was last updated before the time in the
 	// "before" query parameter.
 	handle("/repopulate-search-documents", rmw(s.errorHandler(s.handleRepopulateSearchDocuments)))
 
+	// manual: reindex-search re-derives the search documents of the packages
+	// whose paths begin with the "prefix" query parameter, in batches of the
+	// size given by the "limit" query parameter. A run can be resumed from the
+	// "cursor" query parameter.
+	handle("/reindex-search", rmw(s.errorHandler(s.handleReindexSearch)))
+
 	// manual: clear-cache clears the redis cache.
 	handle("/clear-cache", rmw(s.errorHandler(s.clearCache)))
 
@@ -190,11 +231,38 @@ func (s *Server) Install(handle func(string, http.Handler)) {
 	// manual: delete the specified module version.
 	handle("/delete/", http.StripPrefix("/delete", rmw(s.errorHandler(s.handleDelete))))
 
+	// manual: clean-pseudoversions deletes all but the newest pseudo-versions
+	// of the module in the "module" query parameter. The number to keep is
+	// given by the "keep" query parameter.
+	handle("/clean-pseudoversions", rmw(s.errorHandler(s.handleCleanPseudoVersions)))
+
+	// manual: exclude adds the prefix or pattern in the "prefix" query
+	// parameter to the excluded prefixes, with the reason in the "reason"
+	// query parameter. unexclude removes it, and excluded lists them.
+	handle("/exclude", rmw(s.errorHandler(s.handleExclude)))
+	handle("/unexclude", rmw(s.errorHandler(s.handleUnexclude)))
+	handle("/excluded", rmw(s.errorHandler(s.handleListExcluded)))
+
 	handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(s.staticPath.String()))))
 
 	// returns an HTML page displaying information about recent versions that were processed.
 	handle("/versions", http.HandlerFunc(s.handleHTMLPage(s.doVersionsPage)))
 
+	// returns an HTML page displaying the slowest fetches of the last day and
+	// the largest modules that were fetched, or JSON with the query parameter
+	// "format=json". The number of each is given by the "limit" query
+	// parameter.
+	handle("/fetch-stats", http.HandlerFunc(s.handleHTMLPage(s.doFetchStatsPage)))
+
+	// returns an HTML page displaying the recent processing history of the
+	// module whose path is given by the "path" query parameter.
+	handle("/module-history", s.errorHandler(s.doModuleHistoryPage))
+
+	// returns the OpenCensus metrics of the worker, such as the latencies of
+	// the phases of fetches and the counts of their errors, in the
+	// Prometheus text format.
+	handle("/metrics", s.metrics)
+
 	// Health check.
 	handle("/healthz", http.HandlerFunc(s.handleHealthCheck))
 
@@ -212,6 +280,41 @@ func (s *Server) handleUpdateImportedByCount(w http.ResponseWriter, r *http.Requ
 	return nil
 }
 
+// handleUpdateVulns stores every entry in the Go vulnerability database,
+// along with the package versions that it affects, and deletes the stored
+// entries that are no longer in the database. Since modules are inserted
+// continually, the affected versions of every entry are recomputed, not just
+// those of the entries that changed.
+func (s *Server) handleUpdateVulns(w http.ResponseWriter, r *http.Request) error {
+	if s.vulnClient == nil {
+		return &serverError{http.StatusFailedDependency, errors.New("no vulnerability database configured")}
+	}
+	ctx := r.Context()
+	entries, err := s.vulnClient.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	var (
+		ids      []string
+		affected int
+	)
+	for _, e := range entries {
+		n, err := s.db.UpsertVulnEntry(ctx, e)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, e.ID)
+		affected += n
+	}
+	deleted, err := s.db.DeleteVulnEntriesExcept(ctx, ids)
+	if err != nil {
+		return err
+	}
+	log.Infof(ctx, "Updated %d vulnerabilities affecting %d package versions; deleted %d", len(entries), affected, deleted)
+	fmt.Fprintf(w, "Updated %d vulnerabilities affecting %d package versions; deleted %d\n", len(entries), affected, deleted)
+	return nil
+}
+
 // handleRepopulateSearchDocuments repopulates every row in the search_documents table
 // that was last updated before the given time.
 func (s *Server) handleRepopulateSearchDocuments(w http.ResponseWriter, r *http.Request) error {
@@ -243,9 +346,50 @@ func (s *Server) handleRepopulateSearchDocuments(w http.ResponseWriter, r *http.
 	return nil
 }
 
+// handleReindexSearch re-derives the search documents of the packages under a
+// path prefix, in batches, in path order. After each batch it logs the path
+// of the last package reindexed, and an interrupted run can be resumed by
+// passing that path as the "cursor" query parameter.
+func (s *Server) handleReindexSearch(w http.ResponseWriter, r *http.Request) error {
+	prefix := r.FormValue("prefix")
+	if prefix == "" {
+		return &serverError{http.StatusBadRequest, errors.New("must provide 'prefix' query param")}
+	}
+	limit := parseLimitParam(r, 100)
+	if limit <= 0 {
+		return &serverError{http.StatusBadRequest, fmt.Errorf("limit is invalid: %q", r.FormValue("limit"))}
+	}
+	cursor := r.FormValue("cursor")
+
+	ctx := r.Context()
+	log.Infof(ctx, "Reindexing search documents under %q after %q", prefix, cursor)
+	n := 0
+	for {
+		paths, err := s.db.GetSearchDocumentPaths(ctx, prefix, cursor, limit)
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			break
+		}
+		if err := s.db.UpsertSearchDocuments(ctx, paths); err != nil {
+			return fmt.Errorf("reindexing after cursor %q: %w", cursor, err)
+		}
+		n += len(paths)
+		cursor = paths[len(paths)-1]
+		log.Infof(ctx, "Reindexed %d search documents under %q; cursor=%q", n, prefix, cursor)
+		if len(paths) < limit {
+			break
+		}
+	}
+	fmt.Fprintf(w, "Reindexed %d search documents under %q\n", n, prefix)
+	return nil
+}
+
 // handleFetch executes a fetch request and returns a http.StatusOK if the
-// status is not http.StatusInternalServerError, so that the task queue does
-// not retry fetching module versions that have a terminal error.
+// status is not http.StatusInternalServerError or
+// http.StatusServiceUnavailable, so that the task queue does not retry
+// fetching module versions that have a terminal error.
 func (s *Server) handleFetch(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path == "/" {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -258,7 +402,7 @@ func (s *Server) handleFetch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	msg, code := s.doFetch(r)
-	if code == http.StatusInternalServerError {
+	if code == http.StatusInternalServerError || code == http.StatusServiceUnavailable {
 		log.Infof(r.Context(), "doFetch of %s returned %d; returning that code to retry task", r.URL.Path, code)
 		http.Error(w, http.StatusText(code), code)
 		return
@@ -312,22 +456,136 @@ func parseModulePathAndVersion(requestPath string) (string, string, error) {
 	return parts[0], parts[1], nil
 }
 
+// handlePollIndex reads a page of the module index after the index cursor,
+// inserts it into module_version_states and advances the cursor. It starts
+// reading cfg.IndexPollOverlap before the cursor. New latest releases are
+// enqueued at once, with interactive priority.
 func (s *Server) handlePollIndex(w http.ResponseWriter, r *http.Request) (err error) {
 	defer derrors.Wrap(&err, "handlePollIndex(%q)", r.URL.Path)
 	ctx := r.Context()
 	limit := parseLimitParam(r, 10)
-	since, err := s.db.LatestIndexTimestamp(ctx)
+	cursor, err := s.db.GetIndexCursor(ctx)
 	if err != nil {
 		return err
 	}
+	since := cursor.Timestamp
+	if !since.IsZero() {
+		since = since.Add(-s.cfg.IndexPollOverlap)
+	}
 	modules, err := s.indexClient.GetVersions(ctx, since, limit)
 	if err != nil {
 		return err
 	}
-	if err := s.db.InsertIndexVersions(ctx, modules); err != nil {
+	if since.Before(cursor.Timestamp) && len(modules) > 0 && len(modules) == limit &&
+		!modules[len(modules)-1].Timestamp.After(cursor.Timestamp) {
+		// The overlap fills the whole page. Read from the cursor instead, so
+		// that polling makes progress.
+		modules, err = s.indexClient.GetVersions(ctx, cursor.Timestamp, limit)
+		if err != nil {
+			return err
+		}
+	}
+	// When the index is read from the start, everything is a backfill.
+	var unseen []*internal.IndexVersion
+	if !cursor.Timestamp.IsZero() {
+		for _, m := range modules {
+			if m.Timestamp.After(cursor.Timestamp) {
+				unseen = append(unseen, m)
+			}
+		}
+	}
+	cursor, err = s.db.InsertIndexVersionsAndAdvanceCursor(ctx, modules)
+	if err != nil {
+		return err
+	}
+	log.Infof(ctx, "Inserted %d modules from the index; cursor is at %s (%s@%s)",
+		len(modules), cursor.Timestamp.Format(time.RFC3339Nano), cursor.ModulePath, cursor.Version)
+	// The versions are stored, so /enqueue will fetch them even if this
+	// fails.
+	if err := s.scheduleNewLatestReleases(ctx, unseen); err != nil {
+		log.Error(ctx, err)
+	}
+	return nil
+}
+
+// scheduleNewLatestReleases enqueues, with interactive priority, the latest
+// release version of each module in ivs, if it is later than the latest
+// version of the module known so far, so that users do not wait for new
+// releases behind a backlog of other fetches.
+func (s *Server) scheduleNewLatestReleases(ctx context.Context, ivs []*internal.IndexVersion) (err error) {
+	defer derrors.Wrap(&err, "scheduleNewLatestReleases(ctx, %d versions)", len(ivs))
+
+	var paths []string
+	latest := map[string]string{}
+	for _, iv := range ivs {
+		if !semver.IsValid(iv.Version) || semver.Prerelease(iv.Version) != "" {
+			continue
+		}
+		v, ok := latest[iv.Path]
+		if !ok {
+			paths = append(paths, iv.Path)
+		}
+		if !ok || semver.Compare(iv.Version, v) > 0 {
+			latest[iv.Path] = iv.Version
+		}
+	}
+	for _, path := range paths {
+		v := latest[path]
+		lmv, err := s.db.GetLatestModuleVersions(ctx, path)
+		if err != nil && !errors.Is(err, derrors.NotFound) {
+			return err
+		}
+		if lmv != nil && semver.Compare(v, lmv.RawVersion) <= 0 {
+			continue
+		}
+		if _, err := s.queue.ScheduleFetch(ctx, path, v, "", queue.PriorityInteractive, s.taskIDChangeInterval); err != nil {
+			return err
+		}
+		// Keep /enqueue from scheduling the same fetch on the backfill
+		// queue, where the task would not be deduplicated.
+		if err := s.db.PostponeNewModuleVersionState(ctx, path, v, s.taskIDChangeInterval); err != nil {
+			return err
+		}
+		log.Infof(ctx, "Scheduled new latest release %s@%s", path, v)
+	}
+	return nil
+}
+
+// handleIndexCursor shows the index cursor. With the "reset" query parameter,
+// an RFC 3339 timestamp, it first moves the cursor there, so that the next
+// poll reads the index from that time.
+func (s *Server) handleIndexCursor(w http.ResponseWriter, r *http.Request) (err error) {
+	defer derrors.Wrap(&err, "handleIndexCursor(%q)", r.URL.Path)
+	ctx := r.Context()
+	if param := r.FormValue("reset"); param != "" {
+		ts, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return &serverError{http.StatusBadRequest, fmt.Errorf("reset is invalid: %q", param)}
+		}
+		user := r.Header.Get(iapUserHeader)
+		if user == "" {
+			user = r.FormValue("user")
+		}
+		if user == "" {
+			user = "unknown user"
+		}
+		if err := s.db.SetIndexCursor(ctx, ts, user); err != nil {
+			return err
+		}
+		log.Infof(ctx, "%s reset the index cursor to %s", user, ts.Format(time.RFC3339Nano))
+	}
+	cursor, err := s.db.GetIndexCursor(ctx)
+	if err != nil {
 		return err
 	}
-	log.Infof(ctx, "Inserted %d modules from the index", len(modules))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "Timestamp: %s\n", cursor.Timestamp.Format(time.RFC3339Nano))
+	if cursor.ModulePath != "" {
+		fmt.Fprintf(w, "Module version: %s@%s\n", cursor.ModulePath, cursor.Version)
+	}
+	if cursor.UpdatedBy != "" {
+		fmt.Fprintf(w, "Updated at %s by %s\n", cursor.UpdatedAt.Format(time.RFC3339), cursor.UpdatedBy)
+	}
 	return nil
 }
 
@@ -373,7 +631,7 @@ func (s *Server) handleEnqueue(w http.ResponseWriter, r *http.Request) (err erro
 		stats.RecordWithTags(r.Context(),
 			[]tag.Mutator{tag.Upsert(keyEnqueueStatus, strconv.Itoa(m.Status))},
 			enqueueStatus.M(int64(m.Status)))
-		enqueued, err := s.queue.ScheduleFetch(ctx, m.ModulePath, m.Version, suffixParam, s.taskIDChangeInterval)
+		enqueued, err := s.queue.ScheduleFetch(ctx, m.ModulePath, m.Version, suffixParam, queue.PriorityBackfill, s.taskIDChangeInterval)
 		if err != nil {
 			return err
 		}
@@ -385,6 +643,92 @@ func (s *Server) handleEnqueue(w http.ResponseWriter, r *http.Request) (err erro
 	return nil
 }
 
+// requeueBatchSize is the number of module versions that handleRequeue
+// reads from the database at a time.
+const requeueBatchSize = 1000
+
+// handleRequeue makes the module versions under a path prefix due for
+// processing, and enqueues them, reading them from the database in batches.
+// Without a prefix, it behaves like handleEnqueue.
+func (s *Server) handleRequeue(w http.ResponseWriter, r *http.Request) (err error) {
+	prefix := r.FormValue("prefix")
+	if prefix == "" {
+		return s.handleEnqueue(w, r)
+	}
+	defer derrors.Wrap(&err, "handleRequeue(%q)", prefix)
+
+	limit := parseLimitParam(r, 0) // 0 means no limit
+	if limit < 0 {
+		return &serverError{http.StatusBadRequest, fmt.Errorf("limit is invalid: %q", r.FormValue("limit"))}
+	}
+	status := postgres.AnyStatus
+	if param := r.FormValue("status"); param != "" {
+		status, err = strconv.Atoi(param)
+		if err != nil || status < 0 {
+			return &serverError{http.StatusBadRequest, fmt.Errorf("status is invalid: %q", param)}
+		}
+	}
+	// Only the identity established by IAP is logged, since the request
+	// cannot be trusted to say who made it.
+	user := r.Header.Get(iapUserHeader)
+	if user == "" {
+		user = "unknown user"
+	}
+
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if r.FormValue("dry_run") == "true" {
+		n, err := s.db.CountModuleVersionStatesWithPrefix(ctx, prefix, status)
+		if err != nil {
+			return err
+		}
+		if limit > 0 && n > limit {
+			n = limit
+		}
+		log.Infof(ctx, "%s requested a dry run of requeuing module versions under %q (status=%d, limit=%d): %d would be requeued",
+			user, prefix, status, limit, n)
+		fmt.Fprintf(w, "Would requeue %d module versions under %q\n", n, prefix)
+		return nil
+	}
+
+	log.Infof(ctx, "%s is requeuing module versions under %q (status=%d, limit=%d)", user, prefix, status, limit)
+	suffix := r.FormValue("suffix")
+	var (
+		after            internal.Modver
+		nReset, nEnqueue int
+	)
+	for limit == 0 || nReset < limit {
+		size := requeueBatchSize
+		if limit > 0 && limit-nReset < size {
+			size = limit - nReset
+		}
+		mvs, err := s.db.ResetModuleVersionStatesWithPrefix(ctx, prefix, status, after, size)
+		if err != nil {
+			return err
+		}
+		for _, mv := range mvs {
+			enqueued, err := s.queue.ScheduleFetch(ctx, mv.Path, mv.Version, suffix, queue.PriorityBackfill, s.taskIDChangeInterval)
+			if err != nil {
+				return fmt.Errorf("after requeuing %d module versions: %w", nReset, err)
+			}
+			if enqueued {
+				nEnqueue++
+			}
+		}
+		nReset += len(mvs)
+		if len(mvs) > 0 {
+			after = mvs[len(mvs)-1]
+			log.Infof(ctx, "Requeued %d module versions under %q; last=%s", nReset, prefix, after)
+		}
+		if len(mvs) < size {
+			break
+		}
+	}
+	log.Infof(ctx, "%s requeued %d module versions under %q; %d enqueued", user, nReset, prefix, nEnqueue)
+	fmt.Fprintf(w, "Requeued %d module versions under %q; %d enqueued\n", nReset, prefix, nEnqueue)
+	return nil
+}
+
 // handleHTMLPage returns an HTML page using a template from s.templates.
 func (s *Server) handleHTMLPage(f func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -406,13 +750,32 @@ func (s *Server) handlePopulateStdLib(w http.ResponseWriter, r *http.Request) er
 	return nil
 }
 
+func (s *Server) handleRefreshStdlibMaster(w http.ResponseWriter, r *http.Request) error {
+	suffix := r.FormValue("suffix")
+	if suffix == "" {
+		suffix = time.Now().UTC().Format("2006-01-02")
+	}
+	enqueued, err := s.queue.ScheduleFetch(r.Context(), stdlib.ModulePath, stdlib.MasterVersion, suffix, queue.PriorityBackfill, s.taskIDChangeInterval)
+	if err != nil {
+		return fmt.Errorf("handleRefreshStdlibMaster: %v", err)
+	}
+	msg := fmt.Sprintf("Scheduled %s@%s to be fetched.\n", stdlib.ModulePath, stdlib.MasterVersion)
+	if !enqueued {
+		msg = fmt.Sprintf("%s@%s is already scheduled.\n", stdlib.ModulePath, stdlib.MasterVersion)
+	}
+	log.Infof(r.Context(), "handleRefreshStdlibMaster: %s", msg)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.WriteString(w, msg)
+	return nil
+}
+
 func (s *Server) doPopulateStdLib(ctx context.Context, suffix string) (string, error) {
 	versions, err := stdlib.Versions()
 	if err != nil {
 		return "", err
 	}
 	for _, v := range versions {
-		if _, err := s.queue.ScheduleFetch(ctx, stdlib.ModulePath, v, suffix, s.taskIDChangeInterval); err != nil {
+		if _, err := s.queue.ScheduleFetch(ctx, stdlib.ModulePath, v, suffix, queue.PriorityBackfill, s.taskIDChangeInterval); err != nil {
 			return "", fmt.Errorf("error scheduling fetch for %s: %w", v, err)
 		}
 	}
@@ -472,6 +835,77 @@ func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// handleCleanPseudoVersions deletes all but the newest pseudo-versions of a
+// module.
+func (s *Server) handleCleanPseudoVersions(w http.ResponseWriter, r *http.Request) error {
+	modulePath := r.FormValue("module")
+	if modulePath == "" {
+		return &serverError{http.StatusBadRequest, errors.New("must provide 'module' query param")}
+	}
+	keep, err := strconv.Atoi(r.FormValue("keep"))
+	if err != nil || keep < 0 {
+		return &serverError{http.StatusBadRequest, fmt.Errorf("keep is invalid: %q", r.FormValue("keep"))}
+	}
+	deleted, err := s.db.DeletePseudoVersionsExcept(r.Context(), modulePath, keep)
+	if err != nil {
+		return &serverError{derrors.ToStatus(err), err}
+	}
+	fmt.Fprintf(w, "Deleted %d pseudo-versions of %s\n", len(deleted), modulePath)
+	for _, v := range deleted {
+		fmt.Fprintln(w, v)
+	}
+	return nil
+}
+
+// iapUserHeader is the header in which Identity-Aware Proxy passes the
+// email address of the authenticated user.
+const iapUserHeader = "X-Goog-Authenticated-User-Email"
+
+func (s *Server) handleExclude(w http.ResponseWriter, r *http.Request) error {
+	prefix := r.FormValue("prefix")
+	reason := r.FormValue("reason")
+	if prefix == "" || reason == "" {
+		return &serverError{http.StatusBadRequest, errors.New("must provide 'prefix' and 'reason' query params")}
+	}
+	user := r.Header.Get(iapUserHeader)
+	if user == "" {
+		user = r.FormValue("user")
+	}
+	if user == "" {
+		return &serverError{http.StatusBadRequest, errors.New("must provide 'user' query param")}
+	}
+	if err := s.db.InsertExcludedPrefix(r.Context(), prefix, user, reason); err != nil {
+		return &serverError{derrors.ToStatus(err), err}
+	}
+	log.Infof(r.Context(), "%s excluded %q: %s", user, prefix, reason)
+	fmt.Fprintf(w, "Excluded %q\n", prefix)
+	return nil
+}
+
+func (s *Server) handleUnexclude(w http.ResponseWriter, r *http.Request) error {
+	prefix := r.FormValue("prefix")
+	if prefix == "" {
+		return &serverError{http.StatusBadRequest, errors.New("must provide 'prefix' query param")}
+	}
+	if err := s.db.DeleteExcludedPrefix(r.Context(), prefix); err != nil {
+		return &serverError{derrors.ToStatus(err), err}
+	}
+	log.Infof(r.Context(), "%s unexcluded %q", r.Header.Get(iapUserHeader), prefix)
+	fmt.Fprintf(w, "Unexcluded %q\n", prefix)
+	return nil
+}
+
+func (s *Server) handleListExcluded(w http.ResponseWriter, r *http.Request) error {
+	eps, err := s.db.GetExcludedPrefixes(r.Context())
+	if err != nil {
+		return &serverError{http.StatusInternalServerError, err}
+	}
+	for _, ep := range eps {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", ep.Prefix, ep.CreatedBy, ep.CreatedAt.Format(time.RFC3339), ep.Reason)
+	}
+	return nil
+}
+
 func (s *Server) updateExperiment(w http.ResponseWriter, r *http.Request) error {
 	name := r.FormValue("name")
 	description := r.FormValue("description")
@@ -6,11 +6,13 @@ package worker
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -25,7 +27,9 @@ import (
 	"golang.org/x/pkgsite/internal/proxy"
 	"golang.org/x/pkgsite/internal/queue"
 	"golang.org/x/pkgsite/internal/source"
+	"golang.org/x/pkgsite/internal/stdlib"
 	"golang.org/x/pkgsite/internal/testing/sample"
+	"golang.org/x/pkgsite/internal/vuln"
 )
 
 const testTimeout = 60 * time.Second
@@ -243,6 +247,267 @@ func TestWorker(t *testing.T) {
 	}
 }
 
+func TestReindexSearch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer postgres.ResetTestDB(testDB, t)
+
+	for _, m := range []*internal.Module{
+		sample.Module("github.com/org/a", "v1.0.0", "foo", "bar"),
+		sample.Module("github.com/org/b", "v1.2.0", ""),
+		sample.Module("github.com/other/c", "v1.0.0", ""),
+	} {
+		if err := testDB.InsertModule(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type searchRow struct {
+		Version         string
+		Synopsis        string
+		Redistributable bool
+		ImportedByCount int
+	}
+	getRows := func() map[string]searchRow {
+		rows := map[string]searchRow{}
+		query := `SELECT package_path, version, synopsis, redistributable, imported_by_count FROM search_documents`
+		err := testDB.Underlying().RunQuery(ctx, query, func(r *sql.Rows) error {
+			var (
+				path string
+				row  searchRow
+			)
+			if err := r.Scan(&path, &row.Version, &row.Synopsis, &row.Redistributable, &row.ImportedByCount); err != nil {
+				return err
+			}
+			rows[path] = row
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+	want := getRows()
+
+	// Corrupt every row.
+	if _, err := testDB.Underlying().Exec(ctx, `
+		UPDATE search_documents
+		SET version = 'v0.0.1', synopsis = 'corrupt', redistributable = NOT redistributable,
+			imported_by_count = imported_by_count + 42`); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := getRows()
+	// Only rows under the prefix should be repaired.
+	want["github.com/other/c"] = corrupt["github.com/other/c"]
+
+	s, err := NewServer(&config.Config{}, ServerConfig{DB: testDB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	s.Install(mux.Handle)
+
+	// Reindex in batches of one, resuming from a cursor that skips the
+	// packages of github.com/org/a, which are then repaired separately.
+	for _, target := range []string{
+		"/reindex-search?prefix=github.com/org/&limit=1&cursor=github.com/org/a/foo",
+		"/reindex-search?prefix=github.com/org/a&limit=1",
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("POST", target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got code %d, want %d: %s", target, w.Code, http.StatusOK, w.Body.String())
+		}
+	}
+	if diff := cmp.Diff(want, getRows()); diff != "" {
+		t.Errorf("search_documents mismatch (-want +got):\n%s", diff)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/reindex-search", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("without prefix: got code %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+// recordingQueue is a queue.Queue that records the module versions scheduled
+// on it instead of fetching them.
+type recordingQueue struct {
+	scheduled []internal.Modver
+	// interactive holds the module versions scheduled with
+	// queue.PriorityInteractive.
+	interactive []internal.Modver
+}
+
+func (q *recordingQueue) ScheduleFetch(ctx context.Context, modulePath, version, suffix string, priority queue.Priority, taskIDChangeInterval time.Duration) (bool, error) {
+	mv := internal.Modver{Path: modulePath, Version: version}
+	q.scheduled = append(q.scheduled, mv)
+	if priority == queue.PriorityInteractive {
+		q.interactive = append(q.interactive, mv)
+	}
+	return true, nil
+}
+
+func TestRequeue(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer postgres.ResetTestDB(testDB, t)
+
+	var ivs []*internal.IndexVersion
+	for _, path := range []string{"golang.org/x/net", "golang.org/x/text", "golang.org/x/tools", "github.com/a/b"} {
+		ivs = append(ivs, &internal.IndexVersion{Path: path, Version: "v1.0.0", Timestamp: time.Now()})
+	}
+	if err := testDB.InsertIndexVersions(ctx, ivs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testDB.Underlying().Exec(ctx, `
+		UPDATE module_version_states SET status = 500
+		WHERE module_path = 'golang.org/x/text'`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		target   string
+		wantCode int
+		wantBody string
+		want     []string // paths of the module versions scheduled
+	}{
+		{
+			target:   "/requeue?prefix=golang.org/x/&dry_run=true",
+			wantCode: http.StatusOK,
+			wantBody: "Would requeue 3 module versions",
+		},
+		{
+			target:   "/requeue?prefix=golang.org/x/&limit=2",
+			wantCode: http.StatusOK,
+			wantBody: "Requeued 2 module versions",
+			want:     []string{"golang.org/x/net", "golang.org/x/text"},
+		},
+		{
+			target:   "/requeue?prefix=golang.org/x/&status=500",
+			wantCode: http.StatusOK,
+			wantBody: "Requeued 1 module versions",
+			want:     []string{"golang.org/x/text"},
+		},
+		{
+			target:   "/requeue?prefix=golang.org/x/&status=bad",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			target:   "/requeue?prefix=golang.org/x/&limit=-1",
+			wantCode: http.StatusBadRequest,
+		},
+	} {
+		t.Run(test.target, func(t *testing.T) {
+			q := &recordingQueue{}
+			s, err := NewServer(&config.Config{}, ServerConfig{DB: testDB, Queue: q})
+			if err != nil {
+				t.Fatal(err)
+			}
+			mux := http.NewServeMux()
+			s.Install(mux.Handle)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", test.target, nil)
+			r.Header.Set(iapUserHeader, "someone@example.com")
+			mux.ServeHTTP(w, r)
+			if w.Code != test.wantCode {
+				t.Fatalf("got code %d, want %d: %s", w.Code, test.wantCode, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), test.wantBody) {
+				t.Errorf("body %q does not contain %q", w.Body.String(), test.wantBody)
+			}
+			var got []string
+			for _, mv := range q.scheduled {
+				got = append(got, mv.Path)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("scheduled mismatch (-want +got):\n%s", diff)
+			}
+			if len(q.interactive) > 0 {
+				t.Errorf("scheduled %v with interactive priority, want backfill", q.interactive)
+			}
+		})
+	}
+}
+
+func TestRefreshStdlibMaster(t *testing.T) {
+	q := &recordingQueue{}
+	s, err := NewServer(&config.Config{}, ServerConfig{DB: testDB, Queue: q})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	s.Install(mux.Handle)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/refresh-stdlib-master", nil)
+	r.Header.Set(iapUserHeader, "someone@example.com")
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got code %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	want := []internal.Modver{{Path: stdlib.ModulePath, Version: stdlib.MasterVersion}}
+	if diff := cmp.Diff(want, q.scheduled); diff != "" {
+		t.Errorf("scheduled mismatch (-want +got):\n%s", diff)
+	}
+	if len(q.interactive) > 0 {
+		t.Errorf("scheduled %v with interactive priority, want backfill", q.interactive)
+	}
+}
+
+func TestUpdateVulns(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer postgres.ResetTestDB(testDB, t)
+
+	for _, v := range []string{"v1.0.0", "v1.1.0"} {
+		if err := testDB.InsertModule(ctx, sample.Module("example.com/mod", v, "a")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vulnClient, teardown := vuln.SetupTestClient(t, []*vuln.Entry{{
+		ID:       "GO-2021-0001",
+		Modified: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		Affected: []vuln.Affected{{
+			Package: vuln.Package{Name: "example.com/mod", Ecosystem: "Go"},
+			Ranges: []vuln.Range{{
+				Type:   vuln.RangeTypeSemver,
+				Events: []vuln.RangeEvent{{Introduced: "0"}, {Fixed: "1.1.0"}},
+			}},
+		}},
+	}})
+	defer teardown()
+
+	s, err := NewServer(&config.Config{}, ServerConfig{DB: testDB, VulnClient: vulnClient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	s.Install(mux.Handle)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/update-vulns", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got code %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	for _, test := range []struct {
+		version string
+		want    int
+	}{
+		{"v1.0.0", 1},
+		{"v1.1.0", 0},
+	} {
+		got, err := testDB.GetVulnEntriesForUnit(ctx, "example.com/mod/a", "example.com/mod", test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != test.want {
+			t.Errorf("%s: got %d entries, want %d", test.version, len(got), test.want)
+		}
+	}
+}
+
 func TestParseIntParam(t *testing.T) {
 	for _, test := range []struct {
 		in   string
@@ -326,3 +591,146 @@ type fakeTransport struct{}
 func (fakeTransport) RoundTrip(*http.Request) (*http.Response, error) {
 	return nil, errors.New("bad")
 }
+
+func TestPollIndexCursor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	defer postgres.ResetTestDB(testDB, t)
+	cleanCursor := func() {
+		if _, err := testDB.Underlying().Exec(ctx, `TRUNCATE index_cursor`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleanCursor()
+	defer cleanCursor()
+
+	start := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	var versions []*internal.IndexVersion
+	for i := 0; i < 5; i++ {
+		versions = append(versions, &internal.IndexVersion{
+			Path:      fmt.Sprintf("example.com/m%d", i),
+			Version:   "v1.0.0",
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	ix, indexClient, teardownIndex := index.SetupTestPagedIndex(t, versions)
+	defer teardownIndex()
+
+	q := &recordingQueue{}
+	s, err := NewServer(&config.Config{IndexPollOverlap: 2 * time.Minute}, ServerConfig{
+		DB:          testDB,
+		IndexClient: indexClient,
+		Queue:       q,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	s.Install(mux.Handle)
+
+	poll := func(limit, wantCode int) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("POST", fmt.Sprintf("/poll?limit=%d", limit), nil))
+		if w.Code != wantCode {
+			t.Fatalf("poll: got code %d, want %d: %s", w.Code, wantCode, w.Body.String())
+		}
+	}
+	checkInteractive := func(want ...string) {
+		t.Helper()
+		var got []string
+		for _, mv := range q.interactive {
+			got = append(got, mv.Path)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("scheduled with interactive priority mismatch (-want +got):\n%s", diff)
+		}
+	}
+	check := func(wantCursor string, wantPaths ...string) {
+		t.Helper()
+		cursor, err := testDB.GetIndexCursor(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cursor.ModulePath; got != wantCursor {
+			t.Errorf("cursor is at %q, want %q", got, wantCursor)
+		}
+		var got []string
+		err = testDB.Underlying().RunQuery(ctx, `
+			SELECT module_path FROM module_version_states ORDER BY module_path`,
+			func(rows *sql.Rows) error {
+				var p string
+				if err := rows.Scan(&p); err != nil {
+					return err
+				}
+				got = append(got, p)
+				return nil
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(wantPaths, got); diff != "" {
+			t.Errorf("module_version_states mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	// Reading the index from the start is a backfill.
+	poll(2, http.StatusOK)
+	check("example.com/m1", "example.com/m0", "example.com/m1")
+	checkInteractive()
+
+	// If the index fails in the middle of a page, nothing from the page is
+	// stored and the cursor does not move.
+	ix.CutOffNextResponse(1)
+	poll(2, http.StatusInternalServerError)
+	check("example.com/m1", "example.com/m0", "example.com/m1")
+
+	// The overlap fills the page, so the page after the cursor is read.
+	poll(2, http.StatusOK)
+	check("example.com/m2", "example.com/m0", "example.com/m1", "example.com/m2")
+	// New latest releases are fetched at once.
+	checkInteractive("example.com/m2")
+
+	// A version published late, before the cursor but within the overlap,
+	// is picked up.
+	ix.Add(&internal.IndexVersion{Path: "example.com/late", Version: "v1.0.0", Timestamp: start.Add(90 * time.Second)})
+	// A version that is not later than the latest known one is not a new
+	// latest release.
+	if err := testDB.UpdateLatestModuleVersions(ctx, &internal.LatestModuleVersions{
+		ModulePath:  "example.com/m3",
+		RawVersion:  "v1.1.0",
+		GoodVersion: "v1.1.0",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	poll(10, http.StatusOK)
+	check("example.com/m4", "example.com/late", "example.com/m0", "example.com/m1",
+		"example.com/m2", "example.com/m3", "example.com/m4")
+	checkInteractive("example.com/m2", "example.com/m4")
+
+	// Reset the cursor, and view it.
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/index-cursor?reset=2020-10-01T00:01:00Z&user=someone", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("reset: got code %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got, want := w.Body.String(), "by someone"; !strings.Contains(got, want) {
+		t.Errorf("reset: got %q, want it to contain %q", got, want)
+	}
+	check("", "example.com/late", "example.com/m0", "example.com/m1",
+		"example.com/m2", "example.com/m3", "example.com/m4")
+	cursor, err := testDB.GetIndexCursor(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := start.Add(time.Minute); !cursor.Timestamp.Equal(want) || cursor.UpdatedBy != "someone" {
+		t.Errorf("after reset, cursor is at %s, updated by %q; want %s, updated by %q",
+			cursor.Timestamp, cursor.UpdatedBy, want, "someone")
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/index-cursor?reset=yesterday", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("bad reset: got code %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
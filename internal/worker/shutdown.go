@@ -0,0 +1,196 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/semver"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/derrors"
+	"golang.org/x/pkgsite/internal/log"
+	"golang.org/x/pkgsite/internal/postgres"
+	"golang.org/x/pkgsite/internal/xcontext"
+)
+
+// errShuttingDown is the error of fetches that are refused because the
+// worker is shutting down.
+var errShuttingDown = errors.New("worker is shutting down")
+
+// inFlight tracks the fetches that FetchAndUpdateState is running, so that
+// they can be drained when the worker shuts down. See Drain.
+var inFlight = newFetchTracker()
+
+// A fetchTracker tracks fetches in progress. Once it is draining, it refuses
+// new fetches.
+type fetchTracker struct {
+	mu       sync.Mutex
+	draining bool
+	fetches  map[*trackedFetch]bool
+	running  sync.WaitGroup
+}
+
+type trackedFetch struct {
+	mv     internal.Modver
+	cancel context.CancelFunc
+}
+
+func newFetchTracker() *fetchTracker {
+	return &fetchTracker{fetches: map[*trackedFetch]bool{}}
+}
+
+// run calls fetch with a context derived from ctx that is canceled if the
+// tracker has to stop it while draining. If the tracker is already
+// draining, run returns http.StatusServiceUnavailable without calling fetch,
+// so that the fetch is retried later.
+func (t *fetchTracker) run(ctx context.Context, modulePath, version string, fetch func(context.Context) (int, error)) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	f := &trackedFetch{mv: internal.Modver{Path: modulePath, Version: version}, cancel: cancel}
+
+	t.mu.Lock()
+	if t.draining {
+		t.mu.Unlock()
+		return http.StatusServiceUnavailable, errShuttingDown
+	}
+	t.fetches[f] = true
+	t.running.Add(1)
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		delete(t.fetches, f)
+		t.mu.Unlock()
+		t.running.Done()
+	}()
+	return fetch(ctx)
+}
+
+// wait waits until no fetches are running, or ctx is done. It reports
+// whether the fetches finished.
+func (t *fetchTracker) wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		t.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// drain refuses new fetches, and lets the ones in progress finish until ctx
+// is done. It then cancels the remaining fetches, waits up to releaseTimeout
+// for them to return, and returns their module versions.
+func (t *fetchTracker) drain(ctx context.Context, releaseTimeout time.Duration) []internal.Modver {
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	if t.wait(ctx) {
+		return nil
+	}
+	var canceled []internal.Modver
+	seen := map[internal.Modver]bool{}
+	t.mu.Lock()
+	for f := range t.fetches {
+		f.cancel()
+		if !seen[f.mv] {
+			seen[f.mv] = true
+			canceled = append(canceled, f.mv)
+		}
+	}
+	t.mu.Unlock()
+
+	wctx, cancel := context.WithTimeout(xcontext.Detach(ctx), releaseTimeout)
+	defer cancel()
+	if !t.wait(wctx) {
+		log.Errorf(ctx, "canceled fetches did not return within %s", releaseTimeout)
+	}
+	return canceled
+}
+
+// releaseTimeout bounds the time that Drain waits for canceled fetches to
+// return and releases their module versions.
+const releaseTimeout = 30 * time.Second
+
+// Drain stops the fetches of this process for shutdown. New fetches fail with
+// http.StatusServiceUnavailable, so that they are retried later, and the
+// fetches in progress may finish until ctx is done. The fetches that are
+// still running then are canceled, which rolls back their work, and their
+// module versions are released: module_version_states is left as it was
+// before the fetch, except that the module versions are due to be processed
+// at once.
+func Drain(ctx context.Context, db *postgres.DB) (err error) {
+	defer derrors.Wrap(&err, "Drain(ctx)")
+
+	canceled := inFlight.drain(ctx, releaseTimeout)
+	if len(canceled) == 0 {
+		log.Infof(ctx, "all fetches finished")
+		return nil
+	}
+	rctx, cancel := context.WithTimeout(xcontext.Detach(ctx), releaseTimeout)
+	defer cancel()
+	var errs []error
+	for _, mv := range canceled {
+		// Only semantic versions are recorded in module_version_states.
+		if !semver.IsValid(mv.Version) {
+			continue
+		}
+		if err := db.ReleaseModuleVersionState(rctx, mv.Path, mv.Version); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Infof(ctx, "released %s after canceling its fetch", mv)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d errors, first: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// Serve serves h on l until a signal is received on stop, as when the
+// process gets SIGTERM. It then shuts down gracefully, taking up to
+// drainTimeout: it stops accepting connections, and it drains the fetches
+// and requests in progress, as described for Drain.
+func Serve(ctx context.Context, l net.Listener, h http.Handler, db *postgres.DB, drainTimeout time.Duration, stop <-chan os.Signal) (err error) {
+	defer derrors.Wrap(&err, "Serve(ctx, %s)", l.Addr())
+
+	srv := &http.Server{Handler: h}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(l) }()
+	select {
+	case err := <-serveErr:
+		return err
+	case sig := <-stop:
+		log.Infof(ctx, "received %s; draining for up to %s", sig, drainTimeout)
+	}
+
+	// Requests whose fetches are canceled when the drain deadline passes
+	// still need to respond, so the server waits a little longer.
+	sctx, scancel := context.WithTimeout(ctx, drainTimeout+releaseTimeout)
+	defer scancel()
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- srv.Shutdown(sctx) }()
+	dctx, dcancel := context.WithTimeout(ctx, drainTimeout)
+	defer dcancel()
+	drainErr := Drain(dctx, db)
+	if err := <-shutdownErr; err != nil {
+		log.Errorf(ctx, "requests did not finish: %v", err)
+		srv.Close()
+	}
+	log.Infof(ctx, "shut down")
+	return drainErr
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/postgres"
+)
+
+func TestFetchTrackerDrain(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tr := newFetchTracker()
+	started := make(chan struct{}, 2)
+	results := make(chan error, 2)
+	for _, d := range []time.Duration{10 * time.Millisecond, time.Hour} {
+		d := d
+		go func() {
+			_, err := tr.run(ctx, "example.com/m", d.String(), func(ctx context.Context) (int, error) {
+				started <- struct{}{}
+				select {
+				case <-ctx.Done():
+					return http.StatusServiceUnavailable, ctx.Err()
+				case <-time.After(d):
+					return http.StatusOK, nil
+				}
+			})
+			results <- err
+		}()
+	}
+	<-started
+	<-started
+	dctx, dcancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer dcancel()
+	got := tr.drain(dctx, time.Minute)
+	want := []internal.Modver{{Path: "example.com/m", Version: time.Hour.String()}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("canceled mismatch (-want +got):\n%s", diff)
+	}
+	var nCanceled int
+	for i := 0; i < 2; i++ {
+		if err := <-results; err == context.Canceled {
+			nCanceled++
+		}
+	}
+	if nCanceled != 1 {
+		t.Errorf("%d fetches were canceled, want 1", nCanceled)
+	}
+}
+
+func TestServeDrainsFetches(t *testing.T) {
+	const (
+		modulePath = "example.com/slow"
+		version    = "v1.0.0"
+	)
+	for _, test := range []struct {
+		name string
+		// fetch takes this long, unless it is canceled.
+		fetchTime    time.Duration
+		drainTimeout time.Duration
+		wantCode     int
+		wantStatus   int
+	}{
+		{"finished", 100 * time.Millisecond, 10 * time.Second, http.StatusOK, http.StatusOK},
+		{"released", time.Hour, 100 * time.Millisecond, http.StatusServiceUnavailable, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+			defer cancel()
+			defer postgres.ResetTestDB(testDB, t)
+			defer func(t *fetchTracker) { inFlight = t }(inFlight)
+			inFlight = newFetchTracker()
+
+			if err := testDB.InsertIndexVersions(ctx, []*internal.IndexVersion{
+				{Path: modulePath, Version: version, Timestamp: time.Now()},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			// Make the module version not due, to see that releasing it makes
+			// it due again.
+			if _, err := testDB.Underlying().Exec(ctx, `
+				UPDATE module_version_states SET next_processed_after = CURRENT_TIMESTAMP + INTERVAL '1 day'`); err != nil {
+				t.Fatal(err)
+			}
+
+			started := make(chan struct{})
+			fetch := func(ctx context.Context) (int, error) {
+				close(started)
+				select {
+				case <-ctx.Done():
+					return http.StatusServiceUnavailable, ctx.Err()
+				case <-time.After(test.fetchTime):
+				}
+				if err := testDB.UpsertModuleVersionState(ctx, modulePath, version, "app", time.Time{}, http.StatusOK,
+					"", "", "", "", nil, nil, nil); err != nil {
+					return http.StatusInternalServerError, err
+				}
+				return http.StatusOK, nil
+			}
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				code, _ := inFlight.run(r.Context(), modulePath, version, fetch)
+				w.WriteHeader(code)
+			})
+
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			stop := make(chan os.Signal, 1)
+			served := make(chan error, 1)
+			go func() { served <- Serve(ctx, l, h, testDB, test.drainTimeout, stop) }()
+
+			codes := make(chan int, 1)
+			go func() {
+				resp, err := http.Get("http://" + l.Addr().String() + "/fetch")
+				if err != nil {
+					t.Error(err)
+					codes <- 0
+					return
+				}
+				resp.Body.Close()
+				codes <- resp.StatusCode
+			}()
+			<-started
+			stop <- syscall.SIGTERM
+			if err := <-served; err != nil {
+				t.Fatal(err)
+			}
+			if got := <-codes; got != test.wantCode {
+				t.Errorf("fetch request got code %d, want %d", got, test.wantCode)
+			}
+
+			// Fetches that start after the shutdown are refused.
+			if code, err := inFlight.run(ctx, "example.com/late", version, fetch); code != http.StatusServiceUnavailable || err != errShuttingDown {
+				t.Errorf("fetch after shutdown = %d, %v, want %d, %v", code, err, http.StatusServiceUnavailable, errShuttingDown)
+			}
+
+			vs, err := testDB.GetModuleVersionState(ctx, modulePath, version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vs.Status != test.wantStatus {
+				t.Errorf("got status %d, want %d", vs.Status, test.wantStatus)
+			}
+			if vs.NextProcessedAfter.After(time.Now()) {
+				t.Errorf("module version is not due until %s", vs.NextProcessedAfter)
+			}
+		})
+	}
+}
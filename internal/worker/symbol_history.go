@@ -0,0 +1,87 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"sort"
+
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/postgres"
+)
+
+// symbolIntroductions computes the rows of the symbol_history table at the
+// versions of cur and next. It is passed to postgres.DB.InsertSymbolHistory.
+func symbolIntroductions(prev, cur, next *postgres.ModuleSymbols) []*postgres.PackageSymbolIntroduction {
+	intros := introductionsAt(prev, cur)
+	if next != nil {
+		intros = append(intros, introductionsAt(cur, next)...)
+	}
+	return intros
+}
+
+// introductionsAt returns the symbols of the packages of cur that are not in
+// the same package of prev, the release version before it, for each build
+// context documented in either version. Packages that are not in prev have
+// no introductions, because their symbols are as old as the package.
+func introductionsAt(prev, cur *postgres.ModuleSymbols) []*postgres.PackageSymbolIntroduction {
+	if prev == nil {
+		return nil
+	}
+	var paths []string
+	for path := range cur.Packages {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var intros []*postgres.PackageSymbolIntroduction
+	for _, path := range paths {
+		prevDocs, ok := prev.Packages[path]
+		if !ok {
+			continue
+		}
+		curDocs := cur.Packages[path]
+		for _, bc := range buildContextsOf(prevDocs, curDocs) {
+			p := (&internal.Unit{Documentation: prevDocs}).DocumentationFor(bc.GOOS, bc.GOARCH)
+			c := (&internal.Unit{Documentation: curDocs}).DocumentationFor(bc.GOOS, bc.GOARCH)
+			old := map[string]bool{}
+			for _, name := range p.Symbols {
+				old[name] = true
+			}
+			for _, name := range c.Symbols {
+				if old[name] {
+					continue
+				}
+				intros = append(intros, &postgres.PackageSymbolIntroduction{
+					PackagePath: path,
+					SymbolName:  name,
+					SymbolIntroduction: internal.SymbolIntroduction{
+						Version: cur.Version,
+						GOOS:    bc.GOOS,
+						GOARCH:  bc.GOARCH,
+					},
+				})
+			}
+		}
+	}
+	return intros
+}
+
+// buildContextsOf returns the build contexts of the documentation in any of
+// docss, in the order of internal.BuildContexts.
+func buildContextsOf(docss ...[]*internal.Documentation) []internal.BuildContext {
+	var bcs []internal.BuildContext
+	for _, bc := range internal.BuildContexts {
+	search:
+		for _, docs := range docss {
+			for _, d := range docs {
+				if d.GOOS == bc.GOOS && d.GOARCH == bc.GOARCH {
+					bcs = append(bcs, bc)
+					break search
+				}
+			}
+		}
+	}
+	return bcs
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/pkgsite/internal"
+	"golang.org/x/pkgsite/internal/postgres"
+)
+
+func TestSymbolIntroductions(t *testing.T) {
+	const pkg = "example.com/m/p"
+	linux := func(symbols ...string) *internal.Documentation {
+		return &internal.Documentation{GOOS: "linux", GOARCH: "amd64", Symbols: symbols}
+	}
+	windows := func(symbols ...string) *internal.Documentation {
+		return &internal.Documentation{GOOS: "windows", GOARCH: "amd64", Symbols: symbols}
+	}
+	ms := func(version string, docs ...*internal.Documentation) *postgres.ModuleSymbols {
+		m := &postgres.ModuleSymbols{Version: version, Packages: map[string][]*internal.Documentation{}}
+		if len(docs) > 0 {
+			m.Packages[pkg] = docs
+		}
+		return m
+	}
+	intro := func(name, version, goos string) *postgres.PackageSymbolIntroduction {
+		return &postgres.PackageSymbolIntroduction{
+			PackagePath:        pkg,
+			SymbolName:         name,
+			SymbolIntroduction: internal.SymbolIntroduction{Version: version, GOOS: goos, GOARCH: "amd64"},
+		}
+	}
+
+	for _, test := range []struct {
+		name            string
+		prev, cur, next *postgres.ModuleSymbols
+		want            []*postgres.PackageSymbolIntroduction
+	}{
+		{
+			name: "first version",
+			cur:  ms("v1.0.0", linux("A", "B")),
+		},
+		{
+			name: "new package",
+			prev: ms("v1.0.0"),
+			cur:  ms("v1.1.0", linux("A", "B")),
+		},
+		{
+			name: "added symbol",
+			prev: ms("v1.0.0", linux("A")),
+			cur:  ms("v1.1.0", linux("A", "B", "T.M")),
+			want: []*postgres.PackageSymbolIntroduction{
+				intro("B", "v1.1.0", "linux"),
+				intro("T.M", "v1.1.0", "linux"),
+			},
+		},
+		{
+			name: "reappearing symbol",
+			prev: ms("v1.1.0", linux("A")),
+			cur:  ms("v1.2.0", linux("A", "B")),
+			want: []*postgres.PackageSymbolIntroduction{intro("B", "v1.2.0", "linux")},
+		},
+		{
+			name: "GOOS-specific symbol",
+			prev: ms("v1.0.0", linux("A"), windows("A")),
+			cur:  ms("v1.1.0", linux("A"), windows("A", "W")),
+			want: []*postgres.PackageSymbolIntroduction{intro("W", "v1.1.0", "windows")},
+		},
+		{
+			// Once the package is the same on all systems, the windows
+			// documentation is that of linux, without W.
+			name: "build context dropped",
+			prev: ms("v1.0.0", linux("A"), windows("A", "W")),
+			cur:  ms("v1.1.0", linux("A", "W")),
+			want: []*postgres.PackageSymbolIntroduction{intro("W", "v1.1.0", "linux")},
+		},
+		{
+			name: "next version",
+			prev: ms("v1.0.0", linux("A")),
+			cur:  ms("v1.1.0", linux("A", "B")),
+			next: ms("v1.2.0", linux("A", "B", "C")),
+			want: []*postgres.PackageSymbolIntroduction{
+				intro("B", "v1.1.0", "linux"),
+				intro("C", "v1.2.0", "linux"),
+			},
+		},
+		{
+			// The first version to be inserted, but not the earliest.
+			name: "earlier version inserted later",
+			cur:  ms("v1.0.0", linux("A")),
+			next: ms("v1.1.0", linux("A", "B")),
+			want: []*postgres.PackageSymbolIntroduction{intro("B", "v1.1.0", "linux")},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := symbolIntroductions(test.prev, test.cur, test.next)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
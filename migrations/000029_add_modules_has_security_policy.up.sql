@@ -0,0 +1,12 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE modules ADD COLUMN has_security_policy boolean NOT NULL DEFAULT false;
+
+COMMENT ON COLUMN modules.has_security_policy IS
+'COLUMN has_security_policy records whether the module zip contains a SECURITY.md file at its root.';
+
+END;
@@ -0,0 +1,12 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE documentation ADD COLUMN full_synopsis text;
+
+COMMENT ON COLUMN documentation.full_synopsis IS
+'COLUMN full_synopsis is the complete first sentence of the package comment. The synopsis column holds the form displayed on search and directory pages, which may be shortened.';
+
+END;
@@ -0,0 +1,12 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE module_version_states ADD COLUMN proxy_url text DEFAULT '' NOT NULL;
+
+COMMENT ON COLUMN module_version_states.proxy_url IS
+'COLUMN proxy_url is the URL of the module proxy that the module zip was most recently downloaded from. It is empty for the standard library and for fetches that failed before downloading the zip. It is used for debugging.';
+
+END;
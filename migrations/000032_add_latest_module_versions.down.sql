@@ -0,0 +1,13 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE modules
+    DROP COLUMN retracted,
+    DROP COLUMN retraction_rationale;
+
+DROP TABLE latest_module_versions;
+
+END;
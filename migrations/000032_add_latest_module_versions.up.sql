@@ -0,0 +1,32 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+CREATE TABLE latest_module_versions (
+    module_path  text NOT NULL PRIMARY KEY,
+    raw_version  text NOT NULL,
+    good_version text NOT NULL, -- empty if every version is retracted
+    retractions  jsonb NOT NULL,
+    created_at   timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    updated_at   timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+COMMENT ON TABLE latest_module_versions IS
+'TABLE latest_module_versions holds the latest version of each module, as reported by the proxy, the retract directives of the go.mod file at that version, and the latest version that they do not retract.';
+
+CREATE TRIGGER set_updated_at BEFORE INSERT OR UPDATE ON latest_module_versions
+    FOR EACH ROW EXECUTE PROCEDURE trigger_modify_updated_at();
+COMMENT ON TRIGGER set_updated_at ON latest_module_versions IS
+'TRIGGER set_updated_at updates the value of the updated_at column to the current timestamp whenever a row is inserted or updated to the table.';
+
+ALTER TABLE modules
+    ADD COLUMN retracted boolean DEFAULT false NOT NULL,
+    ADD COLUMN retraction_rationale text DEFAULT '' NOT NULL;
+
+COMMENT ON COLUMN modules.retracted IS
+'COLUMN retracted is true if the go.mod file of the latest version of the module, in latest_module_versions, retracts this version.';
+COMMENT ON COLUMN modules.retraction_rationale IS
+'COLUMN retraction_rationale is the explanation given by the go.mod file for retracting this version, if any.';
+
+END;
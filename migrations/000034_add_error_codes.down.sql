@@ -0,0 +1,10 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE version_map DROP COLUMN error_code;
+ALTER TABLE module_version_states DROP COLUMN error_code;
+
+END;
@@ -0,0 +1,52 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE version_map ADD COLUMN error_code text DEFAULT '' NOT NULL;
+COMMENT ON COLUMN version_map.error_code IS
+'COLUMN error_code is a stable identifier for the kind of error that occurred when fetching the module, such as "module_too_large", or empty if there was none. It is set by derrors.ToCode.';
+
+ALTER TABLE module_version_states ADD COLUMN error_code text DEFAULT '' NOT NULL;
+COMMENT ON COLUMN module_version_states.error_code IS
+'COLUMN error_code is a stable identifier for the kind of error that occurred when processing the module, or empty if there was none. It is set by derrors.ToCode.';
+
+-- Existing rows only record a status, so derive the coarser codes from it.
+-- Modules awaiting reprocessing after a successful fetch (520, 521) have no
+-- error.
+UPDATE version_map SET error_code =
+	CASE status
+		WHEN 400 THEN 'invalid_argument'
+		WHEN 403 THEN 'excluded'
+		WHEN 404 THEN 'not_found'
+		WHEN 480 THEN 'db_module_insert_invalid'
+		WHEN 490 THEN 'bad_module'
+		WHEN 491 THEN 'alternative_module'
+		WHEN 492 THEN 'module_too_large'
+		WHEN 504 THEN 'proxy_timed_out'
+		WHEN 540 THEN 'bad_module'
+		WHEN 541 THEN 'alternative_module'
+		WHEN 542 THEN 'db_module_insert_invalid'
+		ELSE 'unknown'
+	END
+WHERE status >= 400 AND status NOT IN (520, 521);
+
+UPDATE module_version_states SET error_code =
+	CASE status
+		WHEN 400 THEN 'invalid_argument'
+		WHEN 403 THEN 'excluded'
+		WHEN 404 THEN 'not_found'
+		WHEN 480 THEN 'db_module_insert_invalid'
+		WHEN 490 THEN 'bad_module'
+		WHEN 491 THEN 'alternative_module'
+		WHEN 492 THEN 'module_too_large'
+		WHEN 504 THEN 'proxy_timed_out'
+		WHEN 540 THEN 'bad_module'
+		WHEN 541 THEN 'alternative_module'
+		WHEN 542 THEN 'db_module_insert_invalid'
+		ELSE 'unknown'
+	END
+WHERE status >= 400 AND status NOT IN (520, 521);
+
+END;
@@ -0,0 +1,13 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE paths ADD COLUMN content_hash text DEFAULT '' NOT NULL;
+COMMENT ON COLUMN paths.content_hash IS
+'COLUMN content_hash is a hash of the files of the package at this path and of the properties of its module that its documentation depends on, or empty if the path is not a package. Packages with the same path and content hash have the same documentation, up to links to the module version.';
+
+CREATE INDEX idx_paths_path_content_hash ON paths(path, content_hash) WHERE content_hash != '';
+
+END;
@@ -0,0 +1,11 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE module_version_states ADD COLUMN warnings text[];
+COMMENT ON COLUMN module_version_states.warnings IS
+'COLUMN warnings describes problems with the module that did not prevent it from being processed, such as files in its zip that were skipped because their names were invalid or collided with other files.';
+
+END;
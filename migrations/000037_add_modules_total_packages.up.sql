@@ -0,0 +1,15 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE modules ADD COLUMN processed_packages integer DEFAULT 0 NOT NULL;
+ALTER TABLE modules ADD COLUMN total_packages integer DEFAULT 0 NOT NULL;
+
+COMMENT ON COLUMN modules.processed_packages IS
+'COLUMN processed_packages is the number of packages of the module that were processed, if the module had more packages than the worker processes for a module; otherwise it is 0.';
+COMMENT ON COLUMN modules.total_packages IS
+'COLUMN total_packages is the number of packages in the module, if it had more than the worker processes for a module, in which case only the first processed_packages of them, in path order, were processed; otherwise it is 0.';
+
+END;
@@ -0,0 +1,12 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE modules DROP COLUMN go_version;
+ALTER TABLE modules DROP COLUMN toolchain;
+ALTER TABLE module_version_states DROP COLUMN go_version;
+ALTER TABLE module_version_states DROP COLUMN toolchain;
+
+END;
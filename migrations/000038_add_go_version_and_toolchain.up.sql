@@ -0,0 +1,21 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE modules ADD COLUMN go_version text DEFAULT '' NOT NULL;
+ALTER TABLE modules ADD COLUMN toolchain text DEFAULT '' NOT NULL;
+ALTER TABLE module_version_states ADD COLUMN go_version text DEFAULT '' NOT NULL;
+ALTER TABLE module_version_states ADD COLUMN toolchain text DEFAULT '' NOT NULL;
+
+COMMENT ON COLUMN modules.go_version IS
+'COLUMN go_version is the Go version declared by the go directive of the module''s go.mod file, or empty if there is none or it is invalid.';
+COMMENT ON COLUMN modules.toolchain IS
+'COLUMN toolchain is the toolchain declared by the toolchain directive of the module''s go.mod file, or empty if there is none or it is invalid.';
+COMMENT ON COLUMN module_version_states.go_version IS
+'COLUMN go_version is the Go version declared by the go directive of the module''s go.mod file, or empty if there is none, it is invalid, or the go.mod file was not fetched.';
+COMMENT ON COLUMN module_version_states.toolchain IS
+'COLUMN toolchain is the toolchain declared by the toolchain directive of the module''s go.mod file, or empty if there is none, it is invalid, or the go.mod file was not fetched.';
+
+END;
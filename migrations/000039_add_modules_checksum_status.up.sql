@@ -0,0 +1,12 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE modules ADD COLUMN checksum_status text DEFAULT '' NOT NULL;
+
+COMMENT ON COLUMN modules.checksum_status IS
+'COLUMN checksum_status is "verified" if the module zip matched the checksum database, "skipped" if the module path matched a pattern of modules that are not checked, or empty if the module was not checked.';
+
+END;
@@ -0,0 +1,15 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE documentation ADD COLUMN compressed_html BYTEA;
+
+COMMENT ON COLUMN documentation.compressed_html IS
+'COLUMN compressed_html contains the documentation HTML, compressed by the codec that its prefix names, in which case html is empty. It is NULL for documentation that is not compressed.';
+
+COMMENT ON COLUMN documentation.zip IS
+'COLUMN zip contains the compressed zip of the source files for the package. It may be compressed again by the codec that its prefix names, like compressed_html.';
+
+END;
@@ -0,0 +1,12 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE modules ADD COLUMN content_hash text DEFAULT '' NOT NULL;
+
+COMMENT ON COLUMN modules.content_hash IS
+'COLUMN content_hash is a hash of the module data that was inserted for this version, used to recognize a second insertion of identical data. It is empty for versions inserted before the column was added.';
+
+END;
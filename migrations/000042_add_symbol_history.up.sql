@@ -0,0 +1,26 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE documentation ADD COLUMN symbols text[];
+
+COMMENT ON COLUMN documentation.symbols IS
+'COLUMN symbols contains the sorted names of the exported symbols of the package for the build context, with methods and struct fields qualified by their type, like "Buffer.Len". It is NULL for documentation inserted before the column was added.';
+
+CREATE TABLE symbol_history (
+    package_path text NOT NULL,
+    module_path text NOT NULL,
+    symbol_name text NOT NULL,
+    goos text NOT NULL,
+    goarch text NOT NULL,
+    version text NOT NULL,
+    PRIMARY KEY (package_path, module_path, symbol_name, goos, goarch, version)
+);
+CREATE INDEX idx_symbol_history_module_path_version ON symbol_history(module_path, version);
+
+COMMENT ON TABLE symbol_history IS
+'TABLE symbol_history records the release versions of a module that introduced each symbol of its packages, for each build context. A symbol that is removed and later restored has a row for each time it appeared. Symbols of the earliest release version of the module that has the package have no rows.';
+
+END;
@@ -0,0 +1,35 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+CREATE TABLE module_fetch_stats (
+    module_path text NOT NULL,
+    version text NOT NULL,
+    fetched_at timestamp with time zone NOT NULL,
+    status integer NOT NULL,
+    zip_size bigint NOT NULL,
+    num_zip_files integer NOT NULL,
+    num_packages integer NOT NULL,
+    duration_ms bigint NOT NULL,
+    phase_durations_ms jsonb NOT NULL,
+    max_alloc bigint NOT NULL,
+    num_fetches integer NOT NULL,
+    total_duration_ms bigint NOT NULL,
+    max_duration_ms bigint NOT NULL,
+    PRIMARY KEY (module_path, version)
+);
+CREATE INDEX idx_module_fetch_stats_fetched_at_duration_ms ON module_fetch_stats(fetched_at, duration_ms);
+CREATE INDEX idx_module_fetch_stats_zip_size ON module_fetch_stats(zip_size);
+
+COMMENT ON TABLE module_fetch_stats IS
+'TABLE module_fetch_stats holds statistics about the latest fetch of each module version by the worker, along with aggregates over all of the fetches of the version: num_fetches, total_duration_ms and max_duration_ms.';
+
+COMMENT ON COLUMN module_fetch_stats.phase_durations_ms IS
+'COLUMN phase_durations_ms maps the name of each phase of the fetch, such as "fetch.download" or "db.InsertModule", to its duration in milliseconds.';
+
+COMMENT ON COLUMN module_fetch_stats.max_alloc IS
+'COLUMN max_alloc is the most heap memory, in bytes, that the worker had allocated between the phases of the fetch. It is only an estimate of the memory that the fetch needed, since the worker may have been running other fetches.';
+
+END;
@@ -0,0 +1,29 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+CREATE TABLE symbol_search_documents (
+    package_path text NOT NULL REFERENCES search_documents(package_path) ON DELETE CASCADE,
+    symbol_name text NOT NULL,
+    name text NOT NULL,
+    kind text NOT NULL,
+    PRIMARY KEY (package_path, symbol_name)
+);
+CREATE INDEX idx_symbol_search_documents_lower_symbol_name ON symbol_search_documents(lower(symbol_name));
+CREATE INDEX idx_symbol_search_documents_lower_name ON symbol_search_documents(lower(name));
+
+COMMENT ON TABLE symbol_search_documents IS
+'TABLE symbol_search_documents holds the exported symbols of the packages in search_documents, at the version in search_documents, so that they can be searched by name.';
+
+COMMENT ON COLUMN symbol_search_documents.symbol_name IS
+'COLUMN symbol_name is the name of the symbol, qualified by its type for methods and fields, like "Client.Do".';
+
+COMMENT ON COLUMN symbol_search_documents.name IS
+'COLUMN name is the last component of symbol_name, like "Do" for "Client.Do", so that methods and fields can be found by their own name.';
+
+COMMENT ON COLUMN symbol_search_documents.kind IS
+'COLUMN kind is the kind of the symbol: "constant", "variable", "function", "type" or "method", or empty if it is not known, as for struct fields.';
+
+END;
@@ -0,0 +1,12 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+CREATE INDEX idx_search_documents_lower_package_path_text_pattern_ops
+    ON search_documents (lower(package_path) text_pattern_ops);
+COMMENT ON INDEX idx_search_documents_lower_package_path_text_pattern_ops IS
+'INDEX idx_search_documents_lower_package_path_text_pattern_ops is used to improve performance of LIKE statements for lower(package_path). It is used to complete package paths by prefix, ignoring case.';
+
+END;
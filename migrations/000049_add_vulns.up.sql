@@ -0,0 +1,37 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+CREATE TABLE vuln_entries (
+    id text PRIMARY KEY,
+    modified timestamp with time zone NOT NULL,
+    withdrawn timestamp with time zone,
+    entry jsonb NOT NULL,
+    updated_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+COMMENT ON TABLE vuln_entries IS
+'TABLE vuln_entries holds the entries of the Go vulnerability database, in the OSV format.';
+
+COMMENT ON COLUMN vuln_entries.id IS
+'COLUMN id is the ID of the entry, like "GO-2021-0001".';
+
+COMMENT ON COLUMN vuln_entries.entry IS
+'COLUMN entry is the OSV JSON of the entry.';
+
+CREATE TABLE vuln_affected_units (
+    vuln_id text NOT NULL REFERENCES vuln_entries(id) ON DELETE CASCADE,
+    unit_path text NOT NULL,
+    module_path text NOT NULL,
+    version text NOT NULL,
+    PRIMARY KEY (module_path, version, unit_path, vuln_id)
+);
+CREATE INDEX idx_vuln_affected_units_unit_path_version ON vuln_affected_units(unit_path, version);
+CREATE INDEX idx_vuln_affected_units_vuln_id ON vuln_affected_units(vuln_id);
+
+COMMENT ON TABLE vuln_affected_units IS
+'TABLE vuln_affected_units records the stored versions of packages that are affected by each entry in vuln_entries. It is recomputed for every entry by the worker''s /update-vulns job, so versions inserted since the job last ran are not in it.';
+
+END;
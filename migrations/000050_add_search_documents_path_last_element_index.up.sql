@@ -0,0 +1,12 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+CREATE INDEX idx_search_documents_package_path_last_element
+    ON search_documents (substring(package_path from '[^/]*$'));
+COMMENT ON INDEX idx_search_documents_package_path_last_element IS
+'INDEX idx_search_documents_package_path_last_element is used to find packages by the last element of their path, for shortcut paths like /yaml.';
+
+END;
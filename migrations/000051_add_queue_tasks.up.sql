@@ -0,0 +1,21 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+CREATE TABLE queue_tasks (
+    queue_name text NOT NULL,
+    module_path text NOT NULL,
+    version text NOT NULL,
+    suffix text NOT NULL,
+    attempts integer DEFAULT 0 NOT NULL,
+    created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (queue_name, module_path, version, suffix)
+);
+COMMENT ON TABLE queue_tasks IS
+'TABLE queue_tasks holds the pending tasks of local queues, which are used instead of Cloud Tasks when the worker is not running on GCP, so that a restarted worker resumes them.';
+COMMENT ON COLUMN queue_tasks.attempts IS
+'COLUMN attempts is the number of times the task has been tried and failed with an error that is retried.';
+
+END;
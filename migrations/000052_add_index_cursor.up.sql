@@ -0,0 +1,22 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+CREATE TABLE index_cursor (
+    singleton boolean DEFAULT true PRIMARY KEY CHECK (singleton),
+    index_timestamp timestamp with time zone NOT NULL,
+    module_path text NOT NULL,
+    version text NOT NULL,
+    updated_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    updated_by text NOT NULL
+);
+COMMENT ON TABLE index_cursor IS
+'TABLE index_cursor holds the position up to which the worker has read the module index. It has at most one row.';
+COMMENT ON COLUMN index_cursor.module_path IS
+'COLUMN module_path and version identify the last module version read from the index, whose timestamp is index_timestamp. They are empty if the cursor was reset to a timestamp.';
+COMMENT ON COLUMN index_cursor.updated_by IS
+'COLUMN updated_by is "poll" if the cursor was advanced by polling the index, and otherwise the user who reset it.';
+
+END;
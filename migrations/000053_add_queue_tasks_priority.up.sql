@@ -0,0 +1,11 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE queue_tasks ADD COLUMN priority integer DEFAULT 0 NOT NULL;
+COMMENT ON COLUMN queue_tasks.priority IS
+'COLUMN priority is the queue.Priority of the task. Waiting tasks of higher priority run first.';
+
+END;
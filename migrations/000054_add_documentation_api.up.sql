@@ -0,0 +1,12 @@
+-- Copyright 2020 The Go Authors. All rights reserved.
+-- Use of this source code is governed by a BSD-style
+-- license that can be found in the LICENSE file.
+
+BEGIN;
+
+ALTER TABLE documentation ADD COLUMN api bytea;
+
+COMMENT ON COLUMN documentation.api IS
+'COLUMN api contains the JSON encoding of the package''s documented API for the build context, computed from its go/doc AST, compressed like compressed_html if that is set. It is NULL for documentation inserted before the column was added.';
+
+END;